@@ -0,0 +1,216 @@
+// Package invittimer is a Go client for the invit-timer HTTP API.
+//
+//	c := invittimer.NewClient("https://invites.example.com", os.Getenv("INVIT_API_KEY"))
+//	inv, err := c.CreateInvitation(ctx, invittimer.CreateInvitationRequest{
+//		PhoneNumber: "+15551234567",
+//		Message:     "Dinner at 7?",
+//		DurationMin: 60,
+//	})
+//
+// Requests that are safe to repeat are retried on network errors, rate
+// limiting and temporary server failures. Creates are made safe to repeat
+// by sending an Idempotency-Key, generated unless one is given.
+package invittimer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	mrand "math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls the API on behalf of one API key. Its fields may be changed
+// before first use.
+type Client struct {
+	BaseURL string
+	APIKey  string
+
+	// HTTPClient defaults to a client with a 30 second timeout.
+	HTTPClient *http.Client
+	// MaxRetries is how many times a failed request is repeated.
+	MaxRetries int
+	// RetryBackoff is the wait before the first retry; it doubles after
+	// each one unless the server asks for longer with Retry-After.
+	RetryBackoff time.Duration
+}
+
+// NewClient returns a client for the API at baseURL, authenticating with
+// apiKey, which may be empty when the server doesn't require keys.
+func NewClient(baseURL, apiKey string) *Client {
+	return &Client{
+		BaseURL:      strings.TrimSuffix(baseURL, "/"),
+		APIKey:       apiKey,
+		HTTPClient:   &http.Client{Timeout: 30 * time.Second},
+		MaxRetries:   3,
+		RetryBackoff: 200 * time.Millisecond,
+	}
+}
+
+// APIError is a non-2xx response from the API.
+type APIError struct {
+	StatusCode int
+	// Code is the machine-readable error code, such as "invitation_expired",
+	// documented with the API's ErrorCode schema.
+	Code    string
+	Message string
+	Details map[string]any
+	// RequestID is the server's X-Request-ID, useful when reporting issues.
+	RequestID string
+
+	retryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("invit-timer: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// HasCode reports whether err is an API error with the given code.
+func HasCode(err error, code string) bool {
+	var e *APIError
+	return errors.As(err, &e) && e.Code == code
+}
+
+// IsNotFound reports whether err is a 404 from the API.
+func IsNotFound(err error) bool {
+	var e *APIError
+	return errors.As(err, &e) && e.StatusCode == http.StatusNotFound
+}
+
+type request struct {
+	method string
+	path   string
+	body   any
+	// idempotencyKey, when set, is sent with every attempt and makes a
+	// POST safe to retry.
+	idempotencyKey string
+	// ifMatch, when set, makes the request conditional on the resource
+	// still having that ETag.
+	ifMatch string
+}
+
+func (c *Client) do(ctx context.Context, req request, out any) error {
+	var body []byte
+	if req.body != nil {
+		var err error
+		if body, err = json.Marshal(req.body); err != nil {
+			return err
+		}
+	}
+	retryable := req.method == http.MethodGet || req.idempotencyKey != ""
+
+	backoff := c.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, req, body)
+		if err == nil && resp.StatusCode < 300 {
+			defer resp.Body.Close()
+			if out == nil {
+				return nil
+			}
+			return json.NewDecoder(resp.Body).Decode(out)
+		}
+		var wait time.Duration
+		if err == nil {
+			apiErr := readError(resp)
+			err, wait = apiErr, apiErr.retryAfter
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !retryable || attempt >= c.MaxRetries || !temporary(err) {
+			return err
+		}
+		if wait < backoff {
+			// Jitter keeps clients that failed together from retrying
+			// together.
+			wait = backoff + mrand.N(backoff/2+1)
+		}
+		backoff *= 2
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (c *Client) send(ctx context.Context, req request, body []byte) (*http.Response, error) {
+	r, err := http.NewRequestWithContext(ctx, req.method, c.BaseURL+req.path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	r.Header.Set("Accept", "application/json")
+	if c.APIKey != "" {
+		r.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+	if req.idempotencyKey != "" {
+		r.Header.Set("Idempotency-Key", req.idempotencyKey)
+	}
+	if req.ifMatch != "" {
+		r.Header.Set("If-Match", req.ifMatch)
+	}
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	return hc.Do(r)
+}
+
+// readError turns a failed response into an APIError, noting how long the
+// server asked the client to wait before retrying.
+func readError(resp *http.Response) *APIError {
+	defer resp.Body.Close()
+	var body struct {
+		Code    string         `json:"code"`
+		Message string         `json:"message"`
+		Detail  string         `json:"detail"` // problem+json
+		Details map[string]any `json:"details"`
+	}
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	msg := strings.TrimSpace(string(b))
+	if json.Unmarshal(b, &body) == nil {
+		if msg = body.Message; msg == "" {
+			msg = body.Detail
+		}
+	}
+	e := &APIError{StatusCode: resp.StatusCode, Code: body.Code, Message: msg, Details: body.Details, RequestID: resp.Header.Get("X-Request-ID")}
+	if n, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		e.retryAfter = time.Duration(n) * time.Second
+	}
+	return e
+}
+
+func temporary(err error) bool {
+	var e *APIError
+	if !errors.As(err, &e) {
+		// Transport errors: the request may not have reached the server.
+		return true
+	}
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	case http.StatusConflict:
+		// Another attempt with the same Idempotency-Key is still running.
+		return strings.Contains(e.Message, "in progress")
+	}
+	return false
+}
+
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
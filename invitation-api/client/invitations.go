@@ -0,0 +1,261 @@
+package invittimer
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Invitation statuses.
+const (
+	StatusPending    = "pending"
+	StatusAccepted   = "accepted"
+	StatusDeclined   = "declined"
+	StatusResponded  = "responded"
+	StatusExpired    = "expired"
+	StatusCancelled  = "cancelled"
+	StatusScheduled  = "scheduled"
+	StatusWaitlisted = "waitlisted"
+)
+
+type Invitation struct {
+	ID               string                    `json:"id"`
+	PhoneNumber      string                    `json:"phone_number"`
+	Email            string                    `json:"email,omitempty"`
+	Channels         []string                  `json:"channels,omitempty"`
+	Message          string                    `json:"message,omitempty"`
+	ExpiresAt        time.Time                 `json:"expires_at"`
+	CreatedAt        time.Time                 `json:"created_at"`
+	SendAt           time.Time                 `json:"send_at,omitempty"`
+	DeferredFrom     time.Time                 `json:"deferred_from,omitempty"`
+	ResponseOptions  []string                  `json:"response_options,omitempty"`
+	Response         string                    `json:"response,omitempty"`
+	Note             string                    `json:"note,omitempty"`
+	GuestCount       int                       `json:"guest_count,omitempty"`
+	MaxGuests        int                       `json:"max_guests,omitempty"`
+	EventAt          time.Time                 `json:"event_at,omitempty"`
+	EventDuration    int                       `json:"event_duration_min,omitempty"`
+	Location         string                    `json:"location,omitempty"`
+	RespondedAt      time.Time                 `json:"responded_at,omitempty"`
+	Status           string                    `json:"status"`
+	CancelledAt      time.Time                 `json:"cancelled_at,omitempty"`
+	Reminders        []Reminder                `json:"reminders,omitempty"`
+	Nudge            *NudgePolicy              `json:"nudge,omitempty"`
+	Nudges           []time.Time               `json:"nudges,omitempty"`
+	Delivery         map[string]DeliveryStatus `json:"delivery,omitempty"`
+	Timezone         string                    `json:"timezone,omitempty"`
+	ResponseToken    string                    `json:"response_token,omitempty"`
+	TemplateID       string                    `json:"template_id,omitempty"`
+	Variables        map[string]string         `json:"variables,omitempty"`
+	BatchID          string                    `json:"batch_id,omitempty"`
+	TenantID         string                    `json:"tenant_id,omitempty"`
+	ContactID        string                    `json:"contact_id,omitempty"`
+	ContactName      string                    `json:"contact_name,omitempty"`
+	ExternalID       string                    `json:"external_id,omitempty"`
+	Metadata         map[string]string         `json:"metadata,omitempty"`
+	SeriesID         string                    `json:"series_id,omitempty"`
+	Occurrence       int                       `json:"occurrence,omitempty"`
+	WaitlistPosition int                       `json:"waitlist_position,omitempty"`
+	// Version counts updates to the invitation; see ETag.
+	Version int `json:"version"`
+}
+
+// ETag is the entity tag the invitation was read with, for making a change
+// conditional on nobody else having changed it since.
+func (inv *Invitation) ETag() string { return `"` + strconv.Itoa(inv.Version) + `"` }
+
+type Reminder struct {
+	BeforeMin int       `json:"before_min"`
+	At        time.Time `json:"at"`
+	SentAt    time.Time `json:"sent_at,omitempty"`
+}
+
+// NudgePolicy texts an invitee who hasn't answered every AfterMin minutes,
+// up to Max times.
+type NudgePolicy struct {
+	AfterMin int `json:"after_min"`
+	Max      int `json:"max"`
+}
+
+// DeliveryStatus is the state of the latest message on one channel:
+// queued, sent, delivered or failed.
+type DeliveryStatus struct {
+	Channel   string    `json:"channel,omitempty"`
+	MessageID string    `json:"message_id,omitempty"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	At        time.Time `json:"at"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+type CreateInvitationRequest struct {
+	PhoneNumber     string            `json:"phone_number,omitempty"`
+	Email           string            `json:"email,omitempty"`
+	Channels        []string          `json:"channels,omitempty"`
+	Message         string            `json:"message,omitempty"`
+	DurationMin     int               `json:"duration_min"`
+	RemindBeforeMin []int             `json:"remind_before_min,omitempty"`
+	ResponseOptions []string          `json:"response_options,omitempty"`
+	Timezone        string            `json:"timezone,omitempty"`
+	TemplateID      string            `json:"template_id,omitempty"`
+	Variables       map[string]string `json:"variables,omitempty"`
+	BatchID         string            `json:"batch_id,omitempty"`
+	// ContactID invites an address book entry, whose phone number and email
+	// are used unless PhoneNumber or Email is set.
+	ContactID string `json:"contact_id,omitempty"`
+	// ExternalID and Metadata are the caller's own, stored as given.
+	// Invitations can be listed by ExternalID.
+	ExternalID string            `json:"external_id,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+	// MaxGuests is how many guests an invitee may bring with a yes.
+	MaxGuests int `json:"max_guests,omitempty"`
+	// EventAt, if set, is offered to accepters as a calendar entry.
+	EventAt          *time.Time `json:"event_at,omitempty"`
+	EventDurationMin int        `json:"event_duration_min,omitempty"`
+	Location         string     `json:"location,omitempty"`
+	// SendAt, if set, holds the invitation back until then. DurationMin
+	// counts from when it is sent.
+	SendAt *time.Time `json:"send_at,omitempty"`
+	// Nudge defaults to the tenant's policy when nil.
+	Nudge *NudgePolicy `json:"nudge,omitempty"`
+
+	// IdempotencyKey lets a create be retried, even across processes,
+	// without sending the invitation twice. One is generated per call
+	// when empty.
+	IdempotencyKey string `json:"-"`
+}
+
+// CreateInvitation creates and sends an invitation.
+func (c *Client) CreateInvitation(ctx context.Context, req CreateInvitationRequest) (*Invitation, error) {
+	key := req.IdempotencyKey
+	if key == "" {
+		key = newIdempotencyKey()
+	}
+	var inv Invitation
+	err := c.do(ctx, request{method: http.MethodPost, path: "/invitations", body: req, idempotencyKey: key}, &inv)
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+func (c *Client) GetInvitation(ctx context.Context, id string) (*Invitation, error) {
+	var inv Invitation
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/invitations/" + url.PathEscape(id)}, &inv); err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+type RespondRequest struct {
+	// Token is the invitation's response token.
+	Token    string `json:"token"`
+	Response string `json:"response"`
+	Note     string `json:"note,omitempty"`
+	// GuestCount is the number of guests coming along with a yes.
+	GuestCount int `json:"guest_count,omitempty"`
+}
+
+// Respond records a response on the invitee's behalf. It needs no API key,
+// only the response token.
+func (c *Client) Respond(ctx context.Context, id string, req RespondRequest) error {
+	return c.do(ctx, request{method: http.MethodPost, path: "/invitations/" + url.PathEscape(id) + "/respond", body: req}, nil)
+}
+
+// ListOptions filters ListInvitations. Zero values are ignored.
+type ListOptions struct {
+	PhoneNumber   string
+	BatchID       string
+	SeriesID      string
+	ExternalID    string
+	Status        string
+	Limit         int
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// Cursor is a previous page's NextCursor.
+	Cursor string
+}
+
+type InvitationPage struct {
+	Invitations []Invitation `json:"invitations"`
+	// NextCursor is empty on the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// ListInvitations returns one page of invitations, oldest first.
+func (c *Client) ListInvitations(ctx context.Context, opts ListOptions) (*InvitationPage, error) {
+	q := url.Values{}
+	set := func(k, v string) {
+		if v != "" {
+			q.Set(k, v)
+		}
+	}
+	set("phone", opts.PhoneNumber)
+	set("batch_id", opts.BatchID)
+	set("series_id", opts.SeriesID)
+	set("external_id", opts.ExternalID)
+	set("status", opts.Status)
+	set("cursor", opts.Cursor)
+	if opts.Limit > 0 {
+		q.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if !opts.CreatedAfter.IsZero() {
+		q.Set("created_after", opts.CreatedAfter.Format(time.RFC3339))
+	}
+	if !opts.CreatedBefore.IsZero() {
+		q.Set("created_before", opts.CreatedBefore.Format(time.RFC3339))
+	}
+	path := "/invitations"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	var page InvitationPage
+	if err := c.do(ctx, request{method: http.MethodGet, path: path}, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// CancelInvitation withdraws a pending or scheduled invitation, texting the
+// invitee when notify is set.
+func (c *Client) CancelInvitation(ctx context.Context, id string, notify bool) (*Invitation, error) {
+	return c.CancelInvitationIfMatch(ctx, id, notify, "")
+}
+
+// CancelInvitationIfMatch is CancelInvitation failing with a 412 unless the
+// invitation still has etag, as returned by Invitation.ETag. An empty etag
+// cancels unconditionally.
+func (c *Client) CancelInvitationIfMatch(ctx context.Context, id string, notify bool, etag string) (*Invitation, error) {
+	path := "/invitations/" + url.PathEscape(id)
+	if notify {
+		path += "?notify=true"
+	}
+	var inv Invitation
+	if err := c.do(ctx, request{method: http.MethodDelete, path: path, ifMatch: etag}, &inv); err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// UpdateInvitationRequest changes a pending invitation. Nil fields are left
+// as they are; ExtendMin pushes the deadline back by that many minutes.
+type UpdateInvitationRequest struct {
+	Message   *string    `json:"message,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	ExtendMin int        `json:"extend_min,omitempty"`
+	// Notify, unless false, texts the invitee about the change.
+	Notify *bool `json:"notify,omitempty"`
+	// IfMatch, when set, makes the change fail with a 412 unless the
+	// invitation still has this ETag.
+	IfMatch string `json:"-"`
+}
+
+func (c *Client) UpdateInvitation(ctx context.Context, id string, req UpdateInvitationRequest) (*Invitation, error) {
+	var inv Invitation
+	if err := c.do(ctx, request{method: http.MethodPatch, path: "/invitations/" + url.PathEscape(id), body: req, ifMatch: req.IfMatch}, &inv); err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	invittimer "invitation-api/client"
+)
+
+// listFlag collects a comma-separated or repeated flag.
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(v string) error {
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*l = append(*l, s)
+		}
+	}
+	return nil
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("invitctl "+name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: invitctl "+usages[name])
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// oneID parses fs and returns its single positional argument.
+func oneID(fs *flag.FlagSet, args []string) (string, error) {
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return "", errors.New("expected one invitation ID")
+	}
+	return fs.Arg(0), nil
+}
+
+func runSend(ctx context.Context, c *invittimer.Client, out printer, args []string) error {
+	fs := newFlagSet("send")
+	var req invittimer.CreateInvitationRequest
+	var channels, options, remind, vars, meta listFlag
+	fs.StringVar(&req.PhoneNumber, "phone", "", "invitee phone number")
+	fs.StringVar(&req.Email, "email", "", "invitee email address")
+	fs.StringVar(&req.ContactID, "contact", "", "contact ID to invite, instead of -phone and -email")
+	fs.Var(&channels, "channels", "channels to send on: sms, email (default sms)")
+	fs.StringVar(&req.Message, "message", "", "invitation message")
+	fs.StringVar(&req.TemplateID, "template", "", "message template ID, instead of -message")
+	fs.Var(&vars, "var", "template variable as name=value; repeatable")
+	fs.StringVar(&req.ExternalID, "external-id", "", "your own reference for the invitation")
+	fs.Var(&meta, "meta", "metadata as key=value; repeatable")
+	fs.IntVar(&req.DurationMin, "duration", 0, "minutes the invitation stays open")
+	fs.Var(&remind, "remind", "minutes before the deadline to send reminders, comma-separated")
+	fs.Var(&options, "options", "response options, comma-separated (default yes,no)")
+	fs.StringVar(&req.Timezone, "timezone", "", "IANA timezone for the deadline shown to the invitee")
+	fs.StringVar(&req.BatchID, "batch", "", "batch ID to add the invitation to")
+	fs.IntVar(&req.MaxGuests, "max-guests", 0, "guests an invitee may bring with a yes")
+	fs.StringVar(&req.IdempotencyKey, "idempotency-key", "", "key that makes re-running the command safe")
+	sendAt := fs.String("send-at", "", "RFC 3339 time to send the invitation at, instead of now")
+	eventAt := fs.String("event-at", "", "RFC 3339 start of the event, offered to accepters as a calendar entry")
+	fs.IntVar(&req.EventDurationMin, "event-duration", 0, "length of the event in minutes (default 60)")
+	fs.StringVar(&req.Location, "location", "", "where the event is")
+	var nudge invittimer.NudgePolicy
+	fs.IntVar(&nudge.AfterMin, "nudge-after", 0, "minutes between nudges to an invitee who hasn't answered")
+	fs.IntVar(&nudge.Max, "nudge-max", 1, "most nudges to send, with -nudge-after")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	if *sendAt != "" {
+		t, err := time.Parse(time.RFC3339, *sendAt)
+		if err != nil {
+			return fmt.Errorf("-send-at: %q is not an RFC 3339 time", *sendAt)
+		}
+		req.SendAt = &t
+	}
+	if *eventAt != "" {
+		t, err := time.Parse(time.RFC3339, *eventAt)
+		if err != nil {
+			return fmt.Errorf("-event-at: %q is not an RFC 3339 time", *eventAt)
+		}
+		req.EventAt = &t
+	}
+	if nudge.AfterMin > 0 {
+		req.Nudge = &nudge
+	}
+	req.Channels = channels
+	req.ResponseOptions = options
+	for _, m := range remind {
+		n, err := strconv.Atoi(m)
+		if err != nil {
+			return fmt.Errorf("-remind: %q is not a number of minutes", m)
+		}
+		req.RemindBeforeMin = append(req.RemindBeforeMin, n)
+	}
+	for _, v := range vars {
+		name, value, ok := strings.Cut(v, "=")
+		if !ok {
+			return fmt.Errorf("-var: %q is not name=value", v)
+		}
+		if req.Variables == nil {
+			req.Variables = map[string]string{}
+		}
+		req.Variables[name] = value
+	}
+	for _, m := range meta {
+		key, value, ok := strings.Cut(m, "=")
+		if !ok {
+			return fmt.Errorf("-meta: %q is not key=value", m)
+		}
+		if req.Metadata == nil {
+			req.Metadata = map[string]string{}
+		}
+		req.Metadata[key] = value
+	}
+
+	inv, err := c.CreateInvitation(ctx, req)
+	if err != nil {
+		return err
+	}
+	return out.invitation(inv)
+}
+
+func runStatus(ctx context.Context, c *invittimer.Client, out printer, args []string) error {
+	id, err := oneID(newFlagSet("status"), args)
+	if err != nil {
+		return err
+	}
+	inv, err := c.GetInvitation(ctx, id)
+	if err != nil {
+		return err
+	}
+	return out.invitation(inv)
+}
+
+func runList(ctx context.Context, c *invittimer.Client, out printer, args []string) error {
+	fs := newFlagSet("list")
+	var opts invittimer.ListOptions
+	fs.StringVar(&opts.Status, "status", "", "only invitations with this status")
+	fs.StringVar(&opts.BatchID, "batch", "", "only invitations in this batch")
+	fs.StringVar(&opts.PhoneNumber, "phone", "", "only invitations to this phone number")
+	fs.StringVar(&opts.ExternalID, "external-id", "", "only invitations with this external ID")
+	fs.IntVar(&opts.Limit, "limit", 0, "page size (server default 50)")
+	fs.StringVar(&opts.Cursor, "cursor", "", "continue from a previous page")
+	all := fs.Bool("all", false, "follow pages to the end")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var invs []invittimer.Invitation
+	for {
+		page, err := c.ListInvitations(ctx, opts)
+		if err != nil {
+			return err
+		}
+		invs = append(invs, page.Invitations...)
+		opts.Cursor = page.NextCursor
+		if !*all || opts.Cursor == "" {
+			break
+		}
+	}
+	return out.invitations(invs, opts.Cursor)
+}
+
+func runCancel(ctx context.Context, c *invittimer.Client, out printer, args []string) error {
+	fs := newFlagSet("cancel")
+	notify := fs.Bool("notify", false, "text the invitee that the invitation was withdrawn")
+	id, err := oneID(fs, args)
+	if err != nil {
+		return err
+	}
+	inv, err := c.CancelInvitation(ctx, id, *notify)
+	if err != nil {
+		return err
+	}
+	return out.invitation(inv)
+}
+
+func runExtend(ctx context.Context, c *invittimer.Client, out printer, args []string) error {
+	fs := newFlagSet("extend")
+	minutes := fs.Int("min", 0, "minutes to push the deadline back by")
+	quiet := fs.Bool("quiet", false, "don't tell the invitee about the new deadline")
+	id, err := oneID(fs, args)
+	if err != nil {
+		return err
+	}
+	if *minutes <= 0 {
+		return errors.New("-min must be a positive number of minutes")
+	}
+	req := invittimer.UpdateInvitationRequest{ExtendMin: *minutes}
+	if *quiet {
+		notify := false
+		req.Notify = &notify
+	}
+	inv, err := c.UpdateInvitation(ctx, id, req)
+	if err != nil {
+		return err
+	}
+	return out.invitation(inv)
+}
@@ -0,0 +1,144 @@
+// Command invitctl manages invitations from the command line.
+//
+//	invitctl send -phone +15551234567 -message "Dinner at 7?" -duration 60
+//	invitctl status <id>
+//	invitctl list -status pending
+//	invitctl cancel <id>
+//	invitctl extend -min 30 <id>
+//
+// The API URL and key are read from ~/.config/invitctl/config.yaml (or the
+// file named by -config or INVITCTL_CONFIG):
+//
+//	url: https://invites.example.com
+//	api_key: ik_...
+//
+// and can be overridden with -url and -api-key, or INVITCTL_URL and
+// INVITCTL_API_KEY.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	invittimer "invitation-api/client"
+)
+
+type config struct {
+	URL    string `yaml:"url"`
+	APIKey string `yaml:"api_key"`
+}
+
+type command func(ctx context.Context, c *invittimer.Client, out printer, args []string) error
+
+var commands = map[string]command{
+	"send":   runSend,
+	"status": runStatus,
+	"list":   runList,
+	"cancel": runCancel,
+	"extend": runExtend,
+}
+
+var usages = map[string]string{
+	"send":   "send -phone NUMBER | -email ADDRESS -message TEXT -duration MIN [flags]",
+	"status": "status ID",
+	"list":   "list [-status STATUS] [-batch ID] [-phone NUMBER] [-limit N] [-all]",
+	"cancel": "cancel [-notify] ID",
+	"extend": "extend -min MIN [-quiet] ID",
+}
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "invitctl:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("invitctl", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: invitctl [-config FILE] [-url URL] [-api-key KEY] [-o table|json] COMMAND ...")
+		fmt.Fprintln(fs.Output(), "\ncommands:")
+		for _, name := range []string{"send", "status", "list", "cancel", "extend"} {
+			fmt.Fprintln(fs.Output(), "  "+usages[name])
+		}
+		fmt.Fprintln(fs.Output(), "\nflags:")
+		fs.PrintDefaults()
+	}
+	path := fs.String("config", os.Getenv("INVITCTL_CONFIG"), "config file (default ~/.config/invitctl/config.yaml)")
+	url := fs.String("url", "", "API base URL")
+	apiKey := fs.String("api-key", "", "API key")
+	output := fs.String("o", "table", "output format: table or json")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("missing command")
+	}
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fs.Usage()
+		return fmt.Errorf("unknown command %q", fs.Arg(0))
+	}
+
+	cfg, err := loadConfig(*path)
+	if err != nil {
+		return err
+	}
+	override(&cfg.URL, os.Getenv("INVITCTL_URL"), *url)
+	override(&cfg.APIKey, os.Getenv("INVITCTL_API_KEY"), *apiKey)
+	if cfg.URL == "" {
+		return errors.New("no API URL: set url in the config file, INVITCTL_URL or -url")
+	}
+	out, err := newPrinter(*output)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return cmd(ctx, invittimer.NewClient(cfg.URL, cfg.APIKey), out, fs.Args()[1:])
+}
+
+// override sets dst to the last of values that isn't empty.
+func override(dst *string, values ...string) {
+	for _, v := range values {
+		if v != "" {
+			*dst = v
+		}
+	}
+}
+
+// loadConfig reads path, or the default config file if it exists.
+func loadConfig(path string) (config, error) {
+	var cfg config
+	explicit := path != ""
+	if !explicit {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return cfg, nil
+		}
+		path = filepath.Join(dir, "invitctl", "config.yaml")
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
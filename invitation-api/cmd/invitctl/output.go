@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	invittimer "invitation-api/client"
+)
+
+type printer interface {
+	invitation(inv *invittimer.Invitation) error
+	invitations(invs []invittimer.Invitation, nextCursor string) error
+}
+
+func newPrinter(format string) (printer, error) {
+	switch format {
+	case "table":
+		return tablePrinter{os.Stdout}, nil
+	case "json":
+		return jsonPrinter{os.Stdout}, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q", format)
+}
+
+type jsonPrinter struct{ w io.Writer }
+
+func (p jsonPrinter) encode(v any) error {
+	enc := json.NewEncoder(p.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (p jsonPrinter) invitation(inv *invittimer.Invitation) error { return p.encode(inv) }
+
+func (p jsonPrinter) invitations(invs []invittimer.Invitation, nextCursor string) error {
+	if invs == nil {
+		invs = []invittimer.Invitation{}
+	}
+	return p.encode(invittimer.InvitationPage{Invitations: invs, NextCursor: nextCursor})
+}
+
+type tablePrinter struct{ w io.Writer }
+
+// invitation prints one invitation as name/value rows.
+func (p tablePrinter) invitation(inv *invittimer.Invitation) error {
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	row := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(tw, "%s:\t%s\n", name, value)
+		}
+	}
+	row("ID", inv.ID)
+	row("Status", inv.Status)
+	row("To", recipient(*inv))
+	row("Message", inv.Message)
+	row("Created", formatTime(inv.CreatedAt))
+	row("Sends", formatTime(inv.SendAt))
+	row("Expires", formatTime(inv.ExpiresAt))
+	row("Response", inv.Response)
+	row("Note", inv.Note)
+	if inv.GuestCount > 0 {
+		row("Guests", strconv.Itoa(inv.GuestCount))
+	}
+	row("Responded", formatTime(inv.RespondedAt))
+	row("Cancelled", formatTime(inv.CancelledAt))
+	row("Batch", inv.BatchID)
+	channels := make([]string, 0, len(inv.Delivery))
+	for ch := range inv.Delivery {
+		channels = append(channels, ch)
+	}
+	sort.Strings(channels)
+	for _, ch := range channels {
+		d := inv.Delivery[ch]
+		status := d.Status
+		if d.Error != "" {
+			status += " (" + d.Error + ")"
+		}
+		row("Delivery "+ch, status)
+	}
+	return tw.Flush()
+}
+
+func (p tablePrinter) invitations(invs []invittimer.Invitation, nextCursor string) error {
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATUS\tTO\tEXPIRES\tRESPONSE")
+	for _, inv := range invs {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", inv.ID, inv.Status, recipient(inv), formatTime(inv.ExpiresAt), inv.Response)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if nextCursor != "" {
+		fmt.Fprintf(p.w, "\nMore results: -cursor %s\n", nextCursor)
+	}
+	return nil
+}
+
+func recipient(inv invittimer.Invitation) string {
+	var to []string
+	for _, s := range []string{inv.PhoneNumber, inv.Email} {
+		if s != "" {
+			to = append(to, s)
+		}
+	}
+	if inv.ContactName != "" {
+		return inv.ContactName + " (" + strings.Join(to, ", ") + ")"
+	}
+	return strings.Join(to, ", ")
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Local().Format("2006-01-02 15:04 MST")
+}
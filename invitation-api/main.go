@@ -1,142 +1,80 @@
+// Command invitation-api serves the invitations engine in pkg/invitations
+// over HTTP and gRPC. It also has the subcommands check-openapi, migrate and
+// bench-store.
 package main
 
 import (
-	"encoding/json"
-	"log"
-	"net/http"
-	"strings"
-	"sync"
-	"time"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"invitation-api/pkg/config"
+	"invitation-api/pkg/invitations"
 )
 
-type Invitation struct {
-	ID          string    `json:"id"`
-	PhoneNumber string    `json:"phone_number"`
-	Message     string    `json:"message,omitempty"`
-	ExpiresAt   time.Time `json:"expires_at"`
-	CreatedAt   time.Time `json:"created_at"`
-	Response    string    `json:"response,omitempty"`
-	RespondedAt time.Time `json:"responded_at,omitempty"`
-}
-
-var (
-	invitations = make(map[string]Invitation)
-	mu          sync.Mutex
-)
-
-type createInvitationRequest struct {
-	PhoneNumber string `json:"phone_number"`
-	Message     string `json:"message"`
-	DurationMin int    `json:"duration_min"`
-}
-
-func writeJSON(w http.ResponseWriter, status int, data any) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(data)
-}
-
-func writeError(w http.ResponseWriter, status int, msg string) {
-	writeJSON(w, status, map[string]string{"error": msg})
-}
+func main() {
+	if len(os.Args) > 1 {
+		commands := map[string]func() error{
+			"check-openapi": invitations.CheckOpenAPI,
+			"migrate":       func() error { return invitations.Migrate(os.Args[2:]) },
+			"bench-store":   func() error { return invitations.BenchStore(os.Args[2:]) },
+		}
+		if cmd, ok := commands[os.Args[1]]; ok {
+			if err := cmd(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
 
-func handleCreateInvitation(w http.ResponseWriter, r *http.Request) {
-	var req createInvitationRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid JSON")
-		return
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		fatal("invalid configuration", "err", err)
 	}
-	if req.PhoneNumber == "" || req.Message == "" || req.DurationMin <= 0 {
-		writeError(w, http.StatusBadRequest, "missing required fields")
-		return
+	slog.SetDefault(invitations.NewLogger(cfg.LogFormat, cfg.LogLevel))
+
+	shutdownTracing, err := invitations.SetupTracing(context.Background(), cfg.OTLPEndpoint)
+	if err != nil {
+		fatal("failed to configure tracing", "err", err)
 	}
 
-	exp := time.Now().Add(time.Duration(req.DurationMin) * time.Minute)
-	inv := Invitation{
-		ID:          generateID(),
-		PhoneNumber: req.PhoneNumber,
-		Message:     req.Message,
-		ExpiresAt:   exp,
-		CreatedAt:   time.Now().UTC(),
+	srv, err := invitations.Open(cfg)
+	if err != nil {
+		fatal("failed to set up the server", "err", err)
 	}
+	defer srv.Close()
 
-	mu.Lock()
-	invitations[inv.ID] = inv
-	mu.Unlock()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	sendSMS(inv.PhoneNumber, inv.Message, inv.ExpiresAt)
-	writeJSON(w, http.StatusCreated, inv)
-}
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Start(ctx) }()
 
-func handleRespondInvitation(w http.ResponseWriter, r *http.Request) {
-	id := strings.TrimPrefix(r.URL.Path, "/invitations/")
-	id = strings.TrimSuffix(id, "/respond")
-	if id == "" {
-		writeError(w, http.StatusBadRequest, "missing invitation ID")
-		return
-	}
-
-	var req struct {
-		Response string `json:"response"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid JSON")
-		return
-	}
-	resp := strings.ToLower(strings.TrimSpace(req.Response))
-	if resp != "yes" && resp != "no" {
-		writeError(w, http.StatusBadRequest, "response must be 'yes' or 'no'")
+	select {
+	case err := <-errc:
+		if err != nil {
+			fatal("server failed", "err", err)
+		}
 		return
+	case <-ctx.Done():
 	}
 
-	mu.Lock()
-	defer mu.Unlock()
-	inv, ok := invitations[id]
-	if !ok {
-		writeError(w, http.StatusNotFound, "invitation not found")
-		return
+	slog.Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("shutdown incomplete", "err", err)
 	}
-	if time.Now().After(inv.ExpiresAt) {
-		writeError(w, http.StatusGone, "invitation has expired")
-		sendSMS(inv.PhoneNumber, "Sorry, your invitation has expired.", time.Time{})
-		return
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("failed to flush traces", "err", err)
 	}
-	if inv.Response != "" {
-		writeError(w, http.StatusConflict, "invitation already responded to")
-		return
-	}
-
-	inv.Response = resp
-	inv.RespondedAt = time.Now().UTC()
-	invitations[id] = inv
-
-	sendSMS(inv.PhoneNumber, "Thanks! Your response has been recorded as: "+strings.Title(resp), time.Time{})
-	writeJSON(w, http.StatusOK, map[string]string{"status": "response recorded"})
 }
 
-func sendSMS(phone, message string, expiresAt time.Time) {
-	fullMessage := strings.TrimSpace(message)
-	if !expiresAt.IsZero() {
-		fullMessage += " This invitation will be open until " + expiresAt.Local().Format("3:04PM") + "."
-	}
-	log.Printf("📲 Sending SMS to %s: %s", phone, fullMessage)
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
 }
-
-func generateID() string {
-	return time.Now().Format("20060102150405.000")
-}
-
-func main() {
-	mux := http.NewServeMux()
-	mux.HandleFunc("POST /invitations", handleCreateInvitation)
-	mux.HandleFunc("POST /invitations/", func(w http.ResponseWriter, r *http.Request) {
-		if strings.HasSuffix(r.URL.Path, "/respond") {
-			handleRespondInvitation(w, r)
-			return
-		}
-		writeError(w, http.StatusNotFound, "not found")
-	})
-
-	log.Println("🚀 API listening on :8080")
-	http.ListenAndServe(":8080", mux)
-}
\ No newline at end of file
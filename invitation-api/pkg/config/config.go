@@ -0,0 +1,649 @@
+// Package config loads the service configuration. Values are layered, each
+// source overriding the previous one: built-in defaults, a YAML or JSON file,
+// environment variables, then command-line flags.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the typed service configuration. Each field's tags name its
+// file key, environment variable, flag and default.
+type Config struct {
+	Addr            string        `yaml:"addr" env:"INVIT_ADDR" flag:"addr" default:":8080" usage:"listen address"`
+	GRPCAddr        string        `yaml:"grpc_addr" env:"INVIT_GRPC_ADDR" flag:"grpc-addr" usage:"gRPC listen address; the gRPC API is off when empty"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"INVIT_SHUTDOWN_TIMEOUT" flag:"shutdown-timeout" default:"30s" usage:"how long to wait for in-flight work on shutdown"`
+	OTLPEndpoint    string        `yaml:"otlp_endpoint" env:"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT" flag:"otlp-endpoint" usage:"OTLP/HTTP traces endpoint URL; tracing is off when empty"`
+	LogFormat       string        `yaml:"log_format" env:"INVIT_LOG_FORMAT" flag:"log-format" default:"text" usage:"log output: text or json"`
+	LogLevel        string        `yaml:"log_level" env:"INVIT_LOG_LEVEL" flag:"log-level" default:"info" usage:"minimum log level: debug, info, warn or error"`
+	Timezone        string        `yaml:"timezone" env:"INVIT_TIMEZONE" flag:"timezone" default:"Local" usage:"IANA timezone for human-facing times"`
+
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"INVIT_READ_HEADER_TIMEOUT" flag:"read-header-timeout" default:"10s" usage:"time allowed to read request headers"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"INVIT_READ_TIMEOUT" flag:"read-timeout" usage:"time allowed to read a whole request, body included; none when 0"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"INVIT_WRITE_TIMEOUT" flag:"write-timeout" usage:"time allowed to handle a request and write its response, except event streams and exports; none when 0"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"INVIT_IDLE_TIMEOUT" flag:"idle-timeout" default:"2m" usage:"how long an idle keep-alive connection is kept open"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes" env:"INVIT_MAX_HEADER_BYTES" flag:"max-header-bytes" default:"1048576" usage:"largest request header block accepted, in bytes"`
+	MaxBodyBytes      int           `yaml:"max_body_bytes" env:"INVIT_MAX_BODY_BYTES" flag:"max-body-bytes" default:"1048576" usage:"largest request body accepted, in bytes"`
+
+	// CORSOrigins lets browser apps on other origins call the API. "*"
+	// allows any, without credentials.
+	CORSOrigins []string `yaml:"cors_origins" env:"INVIT_CORS_ORIGINS" flag:"cors-origins" usage:"comma-separated origins, such as https://app.example.com, that browsers may call the API from, or * for any; none when empty"`
+
+	// TLS is served on Addr with either a certificate and key from files or
+	// certificates obtained from Let's Encrypt for AutocertDomains. Either
+	// way HTTP/2 is negotiated with clients that support it. Autocert
+	// answers TLS-ALPN challenges itself, so Addr must be reachable on port
+	// 443; AutocertHTTPAddr also answers HTTP challenges and redirects
+	// plain HTTP to HTTPS.
+	TLSCertFile      string   `yaml:"tls_cert_file" env:"INVIT_TLS_CERT_FILE" flag:"tls-cert-file" usage:"PEM certificate chain to serve TLS with"`
+	TLSKeyFile       string   `yaml:"tls_key_file" env:"INVIT_TLS_KEY_FILE" flag:"tls-key-file" usage:"PEM private key for tls_cert_file"`
+	AutocertDomains  []string `yaml:"autocert_domains" env:"INVIT_AUTOCERT_DOMAINS" flag:"autocert-domains" usage:"comma-separated domains to obtain Let's Encrypt certificates for"`
+	AutocertEmail    string   `yaml:"autocert_email" env:"INVIT_AUTOCERT_EMAIL" flag:"autocert-email" usage:"contact address given to Let's Encrypt"`
+	AutocertCacheDir string   `yaml:"autocert_cache_dir" env:"INVIT_AUTOCERT_CACHE_DIR" flag:"autocert-cache-dir" default:"autocert" usage:"directory where obtained certificates are kept"`
+	AutocertHTTPAddr string   `yaml:"autocert_http_addr" env:"INVIT_AUTOCERT_HTTP_ADDR" flag:"autocert-http-addr" usage:"address, usually :80, to answer ACME HTTP challenges and redirect to HTTPS on"`
+
+	Store string `yaml:"store" env:"INVIT_STORE" flag:"store" default:"memory" usage:"invitation store: memory, sqlite, postgres or redis"`
+	// AutoMigrate applies pending schema migrations on startup. Without it
+	// the server refuses to start until `invitation-api migrate up` has
+	// brought the schema to its version.
+	AutoMigrate bool   `yaml:"auto_migrate" env:"INVIT_AUTO_MIGRATE" flag:"auto-migrate" default:"true" usage:"apply pending sqlite or postgres schema migrations on startup"`
+	DBDSN       string `yaml:"db_dsn" env:"INVIT_DB_DSN" flag:"db-dsn" usage:"database DSN for the sqlite or postgres store, or redis:// URL, optionally with ?ttl=, for the redis store"`
+
+	// PIIKeyFile or PIIVaultAddr turn on encryption at rest of phone
+	// numbers, emails and notes. They are sealed with data keys that are
+	// replaced every PIIDataKeyTTL and stored wrapped by the master key in
+	// the file, or by the Vault transit key PIIVaultKey, authenticating
+	// with VAULT_TOKEN.
+	PIIKeyFile    string        `yaml:"pii_key_file" env:"INVIT_PII_KEY_FILE" flag:"pii-key-file" usage:"file holding a 32-byte master key, hex or base64, that encrypts personal data at rest"`
+	PIIVaultAddr  string        `yaml:"pii_vault_addr" env:"INVIT_PII_VAULT_ADDR" flag:"pii-vault-addr" usage:"Vault address whose transit engine encrypts personal data keys, instead of pii_key_file"`
+	PIIVaultKey   string        `yaml:"pii_vault_key" env:"INVIT_PII_VAULT_KEY" flag:"pii-vault-key" default:"invit-timer" usage:"name of the Vault transit key"`
+	PIIDataKeyTTL time.Duration `yaml:"pii_data_key_ttl" env:"INVIT_PII_DATA_KEY_TTL" flag:"pii-data-key-ttl" default:"720h" usage:"how long a data key encrypts new personal data before it is replaced"`
+
+	SMSProvider    string `yaml:"sms_provider" env:"SMS_PROVIDER" flag:"sms-provider" default:"log" usage:"SMS provider: log, twilio or sns"`
+	VoiceProvider  string `yaml:"voice_provider" env:"VOICE_PROVIDER" flag:"voice-provider" usage:"provider for the voice channel, which calls invitees and takes keypad answers: log or twilio; unset leaves the channel off"`
+	DefaultCountry string `yaml:"default_country" env:"INVIT_DEFAULT_COUNTRY" flag:"default-country" default:"US" usage:"ISO country code assumed for phone numbers without a country code"`
+
+	// ChaosFile injects failures into the log SMS provider's sends, by
+	// destination prefix, for trying out retries, dead-lettering and
+	// fallback. It is refused with a real provider.
+	ChaosFile string `yaml:"chaos_file" env:"INVIT_CHAOS_FILE" flag:"chaos-file" usage:"YAML file of SMS failure-injection rules, for development with the log provider"`
+
+	// AllowedCountries and BlockedPrefixes refuse invitations to phone
+	// numbers outside them; SMSSenderIDs, each "<country>:<sender>", pick
+	// the number or alphanumeric ID texts to a country come from.
+	AllowedCountries []string `yaml:"allowed_countries" env:"INVIT_ALLOWED_COUNTRIES" flag:"allowed-countries" usage:"comma-separated ISO country codes invitees' phone numbers may be in, with North American numbers counting as US; any when empty"`
+	BlockedPrefixes  []string `yaml:"blocked_prefixes" env:"INVIT_BLOCKED_PREFIXES" flag:"blocked-prefixes" usage:"comma-separated E.164 prefixes, such as +1900, that invitations may not be sent to"`
+	SMSSenderIDs     []string `yaml:"sms_sender_ids" env:"INVIT_SMS_SENDER_IDS" flag:"sms-sender-ids" usage:"comma-separated country:sender pairs, such as GB:InvitTimer, sending texts to the country from that number or alphanumeric ID"`
+
+	MaxDurationMin int `yaml:"max_duration_min" env:"INVIT_MAX_DURATION_MIN" flag:"max-duration-min" default:"10080" usage:"longest allowed invitation duration in minutes"`
+	MaxMessageLen  int `yaml:"max_message_len" env:"INVIT_MAX_MESSAGE_LEN" flag:"max-message-len" default:"1000" usage:"longest allowed invitation message in bytes"`
+
+	// SMSMaxSegments caps the segments a texted invitation, with its reply
+	// hint, deadline and link, may take. SMSSegmentPolicy says what to do
+	// with one over it: truncate the message, shorten the link to
+	// ShortLinkURL first, or reject the invitation.
+	SMSMaxSegments   int    `yaml:"sms_max_segments" env:"INVIT_SMS_MAX_SEGMENTS" flag:"sms-max-segments" usage:"most SMS segments a texted invitation may take; no limit when 0"`
+	SMSSegmentPolicy string `yaml:"sms_segment_policy" env:"INVIT_SMS_SEGMENT_POLICY" flag:"sms-segment-policy" default:"truncate" usage:"what to do with invitations over sms_max_segments: truncate, shorten or reject"`
+	ShortLinkURL     string `yaml:"short_link_url" env:"INVIT_SHORT_LINK_URL" flag:"short-link-url" usage:"short base URL that redirects /r/ links to public_url, used by the shorten policy"`
+
+	// PricesFile lists what messages cost, as YAML entries of channel,
+	// provider, country, per_message and per_segment, ahead of built-in
+	// estimates. Costs are reported in Currency.
+	PricesFile string `yaml:"prices_file" env:"INVIT_PRICES_FILE" flag:"prices-file" usage:"YAML file of message prices used to estimate costs"`
+	Currency   string `yaml:"currency" env:"INVIT_CURRENCY" flag:"currency" default:"USD" usage:"currency of prices_file and usage reports"`
+
+	CompatIDs         bool          `yaml:"compat_ids" env:"INVIT_COMPAT_IDS" flag:"compat-ids" usage:"emit sortable timestamp-prefixed IDs with a random suffix"`
+	IdempotencyWindow time.Duration `yaml:"idempotency_window" env:"INVIT_IDEMPOTENCY_WINDOW" flag:"idempotency-window" default:"24h" usage:"how long an Idempotency-Key replays the original response"`
+	ResponseGrace     time.Duration `yaml:"response_grace" env:"INVIT_RESPONSE_GRACE" flag:"response-grace" default:"2m" usage:"window after responding during which the response can still be changed"`
+	StrictContentType bool          `yaml:"strict_content_type" env:"INVIT_STRICT_CONTENT_TYPE" flag:"strict-content-type" default:"true" usage:"reject JSON endpoint requests without Content-Type: application/json"`
+	RequireIfMatch    bool          `yaml:"require_if_match" env:"INVIT_REQUIRE_IF_MATCH" flag:"require-if-match" usage:"reject invitation edits and cancellations without an If-Match header"`
+	SchedulerInterval time.Duration `yaml:"scheduler_interval" env:"INVIT_SCHEDULER_INTERVAL" flag:"scheduler-interval" default:"15s" usage:"how often to check for scheduled sends, reminders, nudges, fallbacks and digests"`
+	SweepInterval     time.Duration `yaml:"sweep_interval" env:"INVIT_SWEEP_INTERVAL" flag:"sweep-interval" default:"30s" usage:"how often to scan for newly expired invitations"`
+	LeaseTTL          time.Duration `yaml:"lease_ttl" env:"INVIT_LEASE_TTL" flag:"lease-ttl" default:"15s" usage:"how long an instance's claim to run a background job lasts unrenewed, with a shared sqlite, postgres or redis store"`
+	SendWorkers       int           `yaml:"send_workers" env:"INVIT_SEND_WORKERS" flag:"send-workers" default:"4" usage:"number of concurrent outbound message senders"`
+	SendAttempts      int           `yaml:"send_attempts" env:"INVIT_SEND_ATTEMPTS" flag:"send-attempts" default:"5" usage:"attempts per outbound message before it is dead-lettered"`
+	SendRates         []string      `yaml:"send_rates" env:"INVIT_SEND_RATES" flag:"send-rates" usage:"comma-separated provider:n caps of n messages a second, such as twilio:10, shared by the send workers"`
+	ExpirySMS         bool          `yaml:"expiry_sms" env:"INVIT_EXPIRY_SMS" flag:"expiry-sms" usage:"text invitees when their invitation expires without a response"`
+
+	// ResponseChangeUntilExpiry replaces ResponseGrace with the rest of the
+	// invitation's life.
+	ResponseChangeUntilExpiry bool `yaml:"response_change_until_expiry" env:"INVIT_RESPONSE_CHANGE_UNTIL_EXPIRY" flag:"response-change-until-expiry" usage:"let invitees change their response until the invitation expires, not only within response_grace"`
+
+	// MaxForwardDepth is how many times in a row an invitation can be passed
+	// on, so a forward can itself be forwarded only while it is under.
+	MaxForwardDepth int `yaml:"max_forward_depth" env:"INVIT_MAX_FORWARD_DEPTH" flag:"max-forward-depth" default:"1" usage:"how many hops an invitation can be forwarded by invitees; 0 turns forwarding off"`
+
+	// QuietHours, as "21:00-08:00", holds back SMS invitations that would
+	// go out between those times in the invitee's timezone until the window
+	// ends. QuietHoursShiftExpiry moves their deadline back by as much.
+	QuietHours            string `yaml:"quiet_hours" env:"INVIT_QUIET_HOURS" flag:"quiet-hours" usage:"local times, as HH:MM-HH:MM, during which invitations aren't texted; off when empty"`
+	QuietHoursShiftExpiry bool   `yaml:"quiet_hours_shift_expiry" env:"INVIT_QUIET_HOURS_SHIFT_EXPIRY" flag:"quiet-hours-shift-expiry" default:"true" usage:"push back the deadline of an invitation deferred by quiet_hours by the same amount"`
+
+	// RetentionDays, when positive, has a janitor run every
+	// RetentionInterval to purge invitations, or anonymize them with
+	// RetentionMode anonymize, that many days after they expire. Tenants can
+	// override the days and mode.
+	RetentionDays     int           `yaml:"retention_days" env:"INVIT_RETENTION_DAYS" flag:"retention-days" usage:"days after expiry to keep invitations; forever when 0"`
+	RetentionMode     string        `yaml:"retention_mode" env:"INVIT_RETENTION_MODE" flag:"retention-mode" default:"purge" usage:"what happens to invitations past retention_days: purge or anonymize"`
+	RetentionInterval time.Duration `yaml:"retention_interval" env:"INVIT_RETENTION_INTERVAL" flag:"retention-interval" default:"1h" usage:"how often to apply the retention policy"`
+
+	// ArchiveAfterDays, when positive, has the same janitor move resolved
+	// invitations that many days past their deadline out of the store's
+	// invitations into an archive, where lists and stats don't reach them
+	// unless asked to. Their history goes with them, or to ArchiveS3Bucket
+	// as NDJSON when it is set, signed with the AWS_* credentials.
+	ArchiveAfterDays  int    `yaml:"archive_after_days" env:"INVIT_ARCHIVE_AFTER_DAYS" flag:"archive-after-days" usage:"days after expiry to archive resolved invitations; never when 0"`
+	ArchiveS3Bucket   string `yaml:"archive_s3_bucket" env:"INVIT_ARCHIVE_S3_BUCKET" flag:"archive-s3-bucket" usage:"S3 bucket for archived invitations' history; kept in the store when empty"`
+	ArchiveS3Prefix   string `yaml:"archive_s3_prefix" env:"INVIT_ARCHIVE_S3_PREFIX" flag:"archive-s3-prefix" default:"archive/" usage:"key prefix for archive objects"`
+	ArchiveS3Endpoint string `yaml:"archive_s3_endpoint" env:"INVIT_ARCHIVE_S3_ENDPOINT" flag:"archive-s3-endpoint" usage:"URL of an S3-compatible service, addressed path-style; AWS in AWS_REGION when empty"`
+
+	// ReadyMaxOutbox is how many queued outbound messages /readyz tolerates
+	// before reporting the service unready, and ReadyTimeout bounds each of
+	// its checks.
+	ReadyMaxOutbox int           `yaml:"ready_max_outbox" env:"INVIT_READY_MAX_OUTBOX" flag:"ready-max-outbox" default:"1000" usage:"outbox depth above which /readyz fails (0 disables the check)"`
+	ReadyTimeout   time.Duration `yaml:"ready_timeout" env:"INVIT_READY_TIMEOUT" flag:"ready-timeout" default:"2s" usage:"time allowed for each /readyz check"`
+
+	WebhookURLs   []string `yaml:"webhook_urls" env:"INVIT_WEBHOOK_URLS" flag:"webhook-urls" usage:"comma-separated webhook URLs that receive every lifecycle event"`
+	WebhookSecret string   `yaml:"webhook_secret" env:"INVIT_WEBHOOK_SECRET" flag:"webhook-secret" usage:"HMAC secret for webhooks configured with webhook-urls"`
+
+	// EventBus publishes every lifecycle event, as a webhook payload, to
+	// NATS at nats_url or to Kafka through the REST Proxy at kafka_rest_url.
+	// The subject or topic is <event_subject_prefix>.<event>, such as
+	// invitations.responded.
+	EventBus           string `yaml:"event_bus" env:"INVIT_EVENT_BUS" flag:"event-bus" usage:"message bus to publish lifecycle events to: nats or kafka; none when empty"`
+	NATSURL            string `yaml:"nats_url" env:"INVIT_NATS_URL" flag:"nats-url" default:"nats://127.0.0.1:4222" usage:"NATS server for event_bus nats, as nats://[user:password@]host:port, or tls:// for TLS"`
+	KafkaRESTURL       string `yaml:"kafka_rest_url" env:"INVIT_KAFKA_REST_URL" flag:"kafka-rest-url" usage:"Kafka REST Proxy for event_bus kafka, with any basic auth credentials in the URL"`
+	EventSubjectPrefix string `yaml:"event_subject_prefix" env:"INVIT_EVENT_SUBJECT_PREFIX" flag:"event-subject-prefix" default:"invitations" usage:"prefix of the subjects or topics events are published on"`
+
+	PhoneRateLimit  int           `yaml:"phone_rate_limit" env:"INVIT_PHONE_RATE_LIMIT" flag:"phone-rate-limit" default:"10" usage:"invitations allowed per phone number per phone_rate_window (0 disables)"`
+	PhoneRateWindow time.Duration `yaml:"phone_rate_window" env:"INVIT_PHONE_RATE_WINDOW" flag:"phone-rate-window" default:"1h" usage:"refill period for phone_rate_limit"`
+	KeyRateLimit    int           `yaml:"key_rate_limit" env:"INVIT_KEY_RATE_LIMIT" flag:"key-rate-limit" default:"120" usage:"invitations allowed per API key per key_rate_window (0 disables)"`
+	KeyRateWindow   time.Duration `yaml:"key_rate_window" env:"INVIT_KEY_RATE_WINDOW" flag:"key-rate-window" default:"1m" usage:"refill period for key_rate_limit"`
+
+	RequireAPIKey bool          `yaml:"require_api_key" env:"INVIT_REQUIRE_API_KEY" flag:"require-api-key" default:"true" usage:"require a bearer API key on host-side endpoints"`
+	SessionTTL    time.Duration `yaml:"session_ttl" env:"INVIT_SESSION_TTL" flag:"session-ttl" default:"12h" usage:"how long a dashboard login lasts"`
+	AdminToken    string        `yaml:"admin_token" env:"INVIT_ADMIN_TOKEN" flag:"admin-token" usage:"bearer token required on /admin endpoints"`
+	AdminCIDRs    []string      `yaml:"admin_cidrs" env:"INVIT_ADMIN_CIDRS" flag:"admin-cidrs" usage:"comma-separated networks allowed to reach /admin endpoints; any when empty"`
+	PublicURL     string        `yaml:"public_url" env:"INVIT_PUBLIC_URL" flag:"public-url" usage:"externally visible base URL, used to verify provider webhook signatures"`
+
+	// InsecureWebhooks accepts SMS, voice, WhatsApp and Telegram webhooks
+	// whose provider secret (TWILIO_AUTH_TOKEN, WHATSAPP_APP_SECRET or
+	// TELEGRAM_WEBHOOK_SECRET) is unset, unverified. Without it they are
+	// refused, since anyone could otherwise answer or opt out for invitees.
+	InsecureWebhooks bool `yaml:"insecure_webhooks" env:"INVIT_INSECURE_WEBHOOKS" flag:"insecure-webhooks" usage:"accept provider webhooks unverified when their secret is unset; for local development only"`
+
+	// LinkSigningKeys, each "<id>:<secret>", sign the tokens of response
+	// links with the invitation and its deadline, so that forged links are
+	// turned away unlooked-up. The first key signs and all of them verify:
+	// to rotate, put a new key first and drop the old one once
+	// max_duration_min has passed. Links stop working at the invitation's
+	// deadline, including one it was moved to after they were sent, and are
+	// refused unlooked-up once LinkGrace has passed since the deadline they
+	// were sent with.
+	LinkSigningKeys []string      `yaml:"link_signing_keys" env:"INVIT_LINK_SIGNING_KEYS" flag:"link-signing-keys" usage:"comma-separated id:secret keys that sign response links, the first signing; unsigned links when empty"`
+	LinkGrace       time.Duration `yaml:"link_grace" env:"INVIT_LINK_GRACE" flag:"link-grace" default:"24h" usage:"how long past the deadline it was sent with a signed link is still checked against its invitation's, which may have been extended"`
+
+	// OIDCIssuer lets organizers sign in to the dashboard with an OpenID
+	// Connect provider such as Google or Okta, and call the API with its
+	// tokens, besides API keys. An identity maps to the tenant named by its
+	// OIDCTenantClaim, or else to the tenant of the user with its email,
+	// and acts with the role in its OIDCRoleClaim, or else that user's.
+	OIDCIssuer       string   `yaml:"oidc_issuer" env:"INVIT_OIDC_ISSUER" flag:"oidc-issuer" usage:"OpenID Connect issuer URL that organizers can sign in with"`
+	OIDCClientID     string   `yaml:"oidc_client_id" env:"INVIT_OIDC_CLIENT_ID" flag:"oidc-client-id" usage:"client ID registered with the OIDC issuer"`
+	OIDCClientSecret string   `yaml:"oidc_client_secret" env:"INVIT_OIDC_CLIENT_SECRET" flag:"oidc-client-secret" usage:"client secret registered with the OIDC issuer; none for a public client"`
+	OIDCAudiences    []string `yaml:"oidc_audiences" env:"INVIT_OIDC_AUDIENCES" flag:"oidc-audiences" usage:"comma-separated token audiences accepted besides oidc_client_id"`
+	OIDCTenantClaim  string   `yaml:"oidc_tenant_claim" env:"INVIT_OIDC_TENANT_CLAIM" flag:"oidc-tenant-claim" usage:"token claim holding the tenant ID; tenants are found by user email when empty"`
+	OIDCRoleClaim    string   `yaml:"oidc_role_claim" env:"INVIT_OIDC_ROLE_CLAIM" flag:"oidc-role-claim" usage:"token claim holding the role, or a list naming it; users' own roles apply when empty"`
+
+	location   *time.Location
+	adminNets  []netip.Prefix
+	quietStart int
+	quietEnd   int
+}
+
+// Location returns the parsed Timezone. It is only valid after Validate.
+func (c *Config) Location() *time.Location {
+	if c.location == nil {
+		return time.Local
+	}
+	return c.location
+}
+
+// QuietWindow returns the parsed QuietHours as minutes after midnight, and
+// false when there are none. It is only valid after Validate.
+func (c *Config) QuietWindow() (start, end int, ok bool) {
+	return c.quietStart, c.quietEnd, c.QuietHours != ""
+}
+
+// AdminNetworks returns the parsed AdminCIDRs. It is only valid after
+// Validate.
+func (c *Config) AdminNetworks() []netip.Prefix { return c.adminNets }
+
+// Load builds a Config from args (without the program name). The file is
+// named by -config or INVIT_CONFIG.
+func Load(args []string) (*Config, error) {
+	var c, fromFlags Config
+	fields := fieldsOf(&c)
+	// Flags are parsed into a scratch copy first so they can be applied
+	// last, after the file and environment.
+	flagFields := fieldsOf(&fromFlags)
+	for i, f := range fields {
+		if err := f.set(f.tag("default")); err != nil {
+			return nil, fmt.Errorf("default for %s: %w", f.name(), err)
+		}
+		flagFields[i].v.Set(f.v)
+	}
+
+	fs := flag.NewFlagSet("invitation-api", flag.ContinueOnError)
+	path := fs.String("config", os.Getenv("INVIT_CONFIG"), "path to a YAML or JSON config file")
+	for _, f := range flagFields {
+		fs.Var(f, f.tag("flag"), f.tag("usage"))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *path != "" {
+		data, err := os.ReadFile(*path)
+		if err != nil {
+			return nil, err
+		}
+		// JSON is a subset of YAML, so one decoder handles both.
+		if err := yaml.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("%s: %w", *path, err)
+		}
+	}
+
+	for _, f := range fields {
+		if v, ok := os.LookupEnv(f.tag("env")); ok {
+			if err := f.set(v); err != nil {
+				return nil, fmt.Errorf("%s: %w", f.tag("env"), err)
+			}
+		}
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+	for i, f := range flagFields {
+		if set[f.tag("flag")] {
+			fields[i].v.Set(f.v)
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Validate checks c for consistency and resolves derived values.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Addr == "" {
+		errs = append(errs, errors.New("addr must not be empty"))
+	}
+	switch c.Store {
+	case "memory", "sqlite":
+	case "postgres", "redis":
+		if c.DBDSN == "" {
+			errs = append(errs, fmt.Errorf("db_dsn is required for the %s store", c.Store))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown store %q", c.Store))
+	}
+	switch c.SMSProvider {
+	case "log", "twilio", "sns":
+	default:
+		errs = append(errs, fmt.Errorf("unknown sms_provider %q", c.SMSProvider))
+	}
+	if c.ChaosFile != "" && c.SMSProvider != "log" {
+		errs = append(errs, errors.New("chaos_file is only for development, with sms_provider log"))
+	}
+	switch c.VoiceProvider {
+	case "", "log":
+	case "twilio":
+		if c.PublicURL == "" {
+			errs = append(errs, errors.New("voice_provider twilio requires public_url for keypad answers"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown voice_provider %q", c.VoiceProvider))
+	}
+	if len(c.DefaultCountry) != 2 {
+		errs = append(errs, fmt.Errorf("default_country %q must be a two-letter ISO code", c.DefaultCountry))
+	}
+	for _, cc := range c.AllowedCountries {
+		if len(strings.TrimSpace(cc)) != 2 {
+			errs = append(errs, fmt.Errorf("allowed_countries entry %q must be a two-letter ISO code", cc))
+		}
+	}
+	for _, p := range c.BlockedPrefixes {
+		if p = strings.TrimSpace(p); len(p) < 2 || p[0] != '+' || strings.Trim(p[1:], "0123456789") != "" {
+			errs = append(errs, fmt.Errorf("blocked_prefixes entry %q must be + and digits", p))
+		}
+	}
+	for _, e := range c.SMSSenderIDs {
+		cc, sender, _ := strings.Cut(strings.TrimSpace(e), ":")
+		if len(cc) != 2 || !validSender(sender) {
+			errs = append(errs, fmt.Errorf("sms_sender_ids entry %q must be <country>:<sender>, the sender an E.164 number or an ID of up to 11 letters, digits and spaces", e))
+		}
+	}
+	switch c.LogFormat {
+	case "text", "json":
+	default:
+		errs = append(errs, fmt.Errorf("unknown log_format %q", c.LogFormat))
+	}
+	switch strings.ToLower(c.LogLevel) {
+	case "debug", "info", "warn", "error":
+	default:
+		errs = append(errs, fmt.Errorf("unknown log_level %q", c.LogLevel))
+	}
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("timezone: %w", err))
+	}
+	c.location = loc
+	if c.MaxDurationMin <= 0 {
+		errs = append(errs, errors.New("max_duration_min must be positive"))
+	}
+	if c.MaxMessageLen <= 0 {
+		errs = append(errs, errors.New("max_message_len must be positive"))
+	}
+	if c.SMSMaxSegments < 0 {
+		errs = append(errs, errors.New("sms_max_segments must not be negative"))
+	}
+	switch c.SMSSegmentPolicy {
+	case "truncate", "shorten", "reject":
+	default:
+		errs = append(errs, fmt.Errorf("unknown sms_segment_policy %q", c.SMSSegmentPolicy))
+	}
+	if c.ResponseGrace < 0 {
+		errs = append(errs, errors.New("response_grace must not be negative"))
+	}
+	if c.MaxForwardDepth < 0 {
+		errs = append(errs, errors.New("max_forward_depth must not be negative"))
+	}
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("shutdown_timeout must be positive"))
+	}
+	if c.PhoneRateWindow <= 0 || c.KeyRateWindow <= 0 {
+		errs = append(errs, errors.New("rate limit windows must be positive"))
+	}
+	if c.SendWorkers <= 0 || c.SendAttempts <= 0 {
+		errs = append(errs, errors.New("send_workers and send_attempts must be positive"))
+	}
+	for _, r := range c.SendRates {
+		provider, n, _ := strings.Cut(strings.TrimSpace(r), ":")
+		if v, err := strconv.Atoi(n); provider == "" || err != nil || v <= 0 {
+			errs = append(errs, fmt.Errorf("send_rates entry %q must be provider:n with n a positive number of messages a second", r))
+		}
+	}
+	if c.SchedulerInterval <= 0 || c.SweepInterval <= 0 {
+		errs = append(errs, errors.New("scheduler_interval and sweep_interval must be positive"))
+	}
+	if c.SessionTTL <= 0 {
+		errs = append(errs, errors.New("session_ttl must be positive"))
+	}
+	if c.LeaseTTL < time.Second {
+		errs = append(errs, errors.New("lease_ttl must be at least 1s"))
+	}
+	if c.QuietHours != "" {
+		start, end, ok := parseQuietHours(c.QuietHours)
+		if !ok {
+			errs = append(errs, fmt.Errorf("quiet_hours must be HH:MM-HH:MM, not %q", c.QuietHours))
+		}
+		c.quietStart, c.quietEnd = start, end
+	}
+	if c.RetentionDays < 0 {
+		errs = append(errs, errors.New("retention_days must not be negative"))
+	}
+	if c.RetentionMode != "purge" && c.RetentionMode != "anonymize" {
+		errs = append(errs, fmt.Errorf("retention_mode must be purge or anonymize, not %q", c.RetentionMode))
+	}
+	if c.RetentionInterval <= 0 {
+		errs = append(errs, errors.New("retention_interval must be positive"))
+	}
+	if c.ArchiveAfterDays < 0 {
+		errs = append(errs, errors.New("archive_after_days must not be negative"))
+	}
+	if c.ArchiveS3Endpoint != "" {
+		if c.ArchiveS3Bucket == "" {
+			errs = append(errs, errors.New("archive_s3_endpoint requires archive_s3_bucket"))
+		}
+		if u, err := url.Parse(c.ArchiveS3Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("archive_s3_endpoint must be an http or https URL, not %q", c.ArchiveS3Endpoint))
+		}
+	}
+	for _, t := range []struct {
+		name string
+		d    time.Duration
+	}{{"read_header_timeout", c.ReadHeaderTimeout}, {"read_timeout", c.ReadTimeout}, {"write_timeout", c.WriteTimeout}, {"idle_timeout", c.IdleTimeout}} {
+		if t.d < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative", t.name))
+		}
+	}
+	if c.MaxHeaderBytes <= 0 {
+		errs = append(errs, errors.New("max_header_bytes must be positive"))
+	}
+	for _, o := range c.CORSOrigins {
+		if o = strings.TrimSpace(o); o == "*" {
+			continue
+		}
+		if u, err := url.Parse(o); err != nil || u.Scheme == "" || u.Host == "" || strings.TrimSuffix(u.Path, "/") != "" {
+			errs = append(errs, fmt.Errorf("cors_origins entry %q must be * or a scheme and host, such as https://app.example.com", o))
+		}
+	}
+	if c.MaxBodyBytes <= 0 {
+		errs = append(errs, errors.New("max_body_bytes must be positive"))
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		errs = append(errs, errors.New("tls_cert_file and tls_key_file must be set together"))
+	}
+	if c.TLSCertFile != "" && len(c.AutocertDomains) > 0 {
+		errs = append(errs, errors.New("tls_cert_file and autocert_domains are mutually exclusive"))
+	}
+	if c.AutocertHTTPAddr != "" && len(c.AutocertDomains) == 0 {
+		errs = append(errs, errors.New("autocert_http_addr requires autocert_domains"))
+	}
+	if c.ReadyMaxOutbox < 0 {
+		errs = append(errs, errors.New("ready_max_outbox must not be negative"))
+	}
+	if c.ReadyTimeout <= 0 {
+		errs = append(errs, errors.New("ready_timeout must be positive"))
+	}
+	for _, u := range c.WebhookURLs {
+		if p, err := url.Parse(u); err != nil || p.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid webhook URL %q", u))
+		}
+	}
+	switch c.EventBus {
+	case "":
+	case "nats":
+		if p, err := url.Parse(c.NATSURL); err != nil || p.Host == "" || p.Scheme != "nats" && p.Scheme != "tls" {
+			errs = append(errs, fmt.Errorf("invalid nats_url %q", c.NATSURL))
+		}
+	case "kafka":
+		if p, err := url.Parse(c.KafkaRESTURL); err != nil || p.Host == "" || p.Scheme != "http" && p.Scheme != "https" {
+			errs = append(errs, errors.New("event_bus kafka requires an http or https kafka_rest_url"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown event_bus %q", c.EventBus))
+	}
+	if c.EventSubjectPrefix == "" || strings.ContainsAny(c.EventSubjectPrefix, " \t*>") {
+		errs = append(errs, errors.New("event_subject_prefix must be set and can't contain spaces or wildcards"))
+	}
+	if c.PublicURL != "" {
+		if p, err := url.Parse(c.PublicURL); err != nil || p.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid public_url %q", c.PublicURL))
+		}
+	}
+	if c.PIIKeyFile != "" && c.PIIVaultAddr != "" {
+		errs = append(errs, errors.New("pii_key_file and pii_vault_addr can't both be set"))
+	}
+	if c.PIIVaultAddr != "" {
+		if p, err := url.Parse(c.PIIVaultAddr); err != nil || p.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid pii_vault_addr %q", c.PIIVaultAddr))
+		}
+	}
+	if c.PIIDataKeyTTL <= 0 {
+		errs = append(errs, errors.New("pii_data_key_ttl must be positive"))
+	}
+	ids := map[string]bool{}
+	for _, k := range c.LinkSigningKeys {
+		id, secret, _ := strings.Cut(strings.TrimSpace(k), ":")
+		if id == "" || len(id) > 8 || strings.Trim(id, "abcdefghijklmnopqrstuvwxyz0123456789") != "" || len(secret) < 32 {
+			errs = append(errs, errors.New("link_signing_keys entries must be <id>:<secret>, with an id of up to 8 lowercase letters and digits and a secret of at least 32 characters"))
+			break
+		}
+		if ids[id] {
+			errs = append(errs, fmt.Errorf("link_signing_keys has key %q twice", id))
+		}
+		ids[id] = true
+	}
+	if c.OIDCIssuer != "" {
+		if p, err := url.Parse(c.OIDCIssuer); err != nil || p.Host == "" || p.Scheme != "https" && p.Scheme != "http" {
+			errs = append(errs, fmt.Errorf("invalid oidc_issuer %q", c.OIDCIssuer))
+		}
+		if c.OIDCClientID == "" {
+			errs = append(errs, errors.New("oidc_issuer requires oidc_client_id"))
+		}
+		if c.PublicURL == "" {
+			errs = append(errs, errors.New("oidc_issuer requires public_url, for the sign-in redirect"))
+		}
+	}
+	c.adminNets = nil
+	for _, cidr := range c.AdminCIDRs {
+		p, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid admin_cidrs entry %q", cidr))
+			continue
+		}
+		c.adminNets = append(c.adminNets, p.Masked())
+	}
+	return errors.Join(errs...)
+}
+
+// validSender reports whether s can be a text's sender: an E.164 number,
+// or an alphanumeric sender ID of up to 11 characters with a letter.
+func validSender(s string) bool {
+	if strings.HasPrefix(s, "+") {
+		return len(s) > 8 && strings.Trim(s[1:], "0123456789") == ""
+	}
+	letter := strings.ContainsFunc(s, func(r rune) bool { return r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' })
+	return s != "" && len(s) <= 11 && letter && strings.Trim(s, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789 ") == ""
+}
+
+// parseQuietHours parses "HH:MM-HH:MM" into minutes after midnight. The
+// window may wrap past midnight but not be empty.
+func parseQuietHours(v string) (start, end int, ok bool) {
+	from, to, ok := strings.Cut(v, "-")
+	if !ok {
+		return 0, 0, false
+	}
+	minutes := func(s string) (int, bool) {
+		t, err := time.Parse("15:04", strings.TrimSpace(s))
+		if err != nil {
+			return 0, false
+		}
+		return t.Hour()*60 + t.Minute(), true
+	}
+	start, ok1 := minutes(from)
+	end, ok2 := minutes(to)
+	return start, end, ok1 && ok2 && start != end
+}
+
+// field adapts one tagged Config field to flag.Value and string parsing.
+type field struct {
+	v reflect.Value
+	f reflect.StructField
+}
+
+func fieldsOf(c *Config) []field {
+	rv := reflect.ValueOf(c).Elem()
+	rt := rv.Type()
+	var fields []field
+	for i := 0; i < rt.NumField(); i++ {
+		if sf := rt.Field(i); sf.Tag.Get("flag") != "" {
+			fields = append(fields, field{rv.Field(i), sf})
+		}
+	}
+	return fields
+}
+
+func (f field) tag(key string) string { return f.f.Tag.Get(key) }
+func (f field) name() string          { return f.tag("yaml") }
+
+func (f field) String() string {
+	if !f.v.IsValid() {
+		return ""
+	}
+	if d, ok := f.v.Interface().(time.Duration); ok {
+		return d.String()
+	}
+	if ss, ok := f.v.Interface().([]string); ok {
+		return strings.Join(ss, ",")
+	}
+	return fmt.Sprint(f.v.Interface())
+}
+
+func (f field) Set(s string) error { return f.set(s) }
+
+func (f field) IsBoolFlag() bool { return f.v.Kind() == reflect.Bool }
+
+func (f field) set(s string) error {
+	switch f.v.Interface().(type) {
+	case time.Duration:
+		if s == "" {
+			f.v.SetInt(0)
+			return nil
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		f.v.SetInt(int64(d))
+	case string:
+		f.v.SetString(s)
+	case bool:
+		if s == "" {
+			f.v.SetBool(false)
+			return nil
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.v.SetBool(b)
+	case int:
+		if s == "" {
+			f.v.SetInt(0)
+			return nil
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		f.v.SetInt(int64(n))
+	case []string:
+		var list []string
+		for _, p := range strings.Split(s, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				list = append(list, p)
+			}
+		}
+		f.v.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported config type %s", f.v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package invitations
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// handleAdminExpire ends a pending invitation now, as if its deadline had
+// passed, with the usual expiry notifications and webhooks.
+func (s *Server) handleAdminExpire(w http.ResponseWriter, r *http.Request) {
+	t := s.now()
+	inv, err := s.store.Update(r.Context(), r.PathValue("id"), func(inv *Invitation) error {
+		switch inv.withStatus(t).Status {
+		case statusPending, statusViewed:
+		case statusCancelled:
+			return errCancelled
+		case statusScheduled:
+			return errNotSent
+		case statusExpired:
+			return errExpired
+		case statusDelegated:
+			return errForwarded
+		default:
+			return errLocked
+		}
+		inv.Status = statusExpired
+		inv.ExpiresAt = t.UTC()
+		return nil
+	})
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	s.expire(r.Context(), inv)
+	writeJSON(w, http.StatusOK, inv.withStatus(t))
+}
+
+// handleAdminResend queues the invitation to the invitee again, for when
+// the first delivery was lost.
+func (s *Server) handleAdminResend(w http.ResponseWriter, r *http.Request) {
+	inv, err := s.resendInvitation(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, inv)
+}
+
+func (s *Server) resendInvitation(ctx context.Context, id string) (Invitation, error) {
+	inv, err := s.store.Get(ctx, id)
+	if err != nil {
+		return Invitation{}, err
+	}
+	inv = inv.withStatus(s.now())
+	if !isPending(inv.Status) {
+		return Invitation{}, &requestError{status: http.StatusConflict, msg: "only pending invitations can be resent"}
+	}
+	s.sendInvitation(ctx, &inv)
+	s.appendEvent(ctx, inv.ID, InvitationEvent{Type: "resent"})
+	return inv, nil
+}
+
+// handleAdminPurge deletes invitations, with their event logs, that
+// expired before the cutoff, along with dead-lettered messages that failed
+// before it.
+func (s *Server) handleAdminPurge(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		OlderThanDays int `json:"older_than_days"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if req.OlderThanDays <= 0 {
+		writeError(w, r, http.StatusBadRequest, "older_than_days must be positive")
+		return
+	}
+	cutoff := s.now().Add(-time.Duration(req.OlderThanDays) * 24 * time.Hour)
+
+	n, err := s.store.DeleteExpired(r.Context(), cutoff)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	failed, err := listRecords[outboundMessage](r.Context(), s.store, deadLetterKind)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	var purgedFailed int
+	for _, m := range failed {
+		if !m.FailedAt.Before(cutoff) {
+			continue
+		}
+		if err := s.store.DeleteRecord(r.Context(), deadLetterKind, m.ID); err != nil && err != errNotFound {
+			writeResponseError(w, r, err)
+			return
+		}
+		purgedFailed++
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"cutoff":          cutoff.UTC(),
+		"invitations":     n,
+		"failed_messages": purgedFailed,
+	})
+}
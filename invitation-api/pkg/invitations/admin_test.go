@@ -0,0 +1,68 @@
+package invitations
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestAdminRespondRecordsAttribution(t *testing.T) {
+	ts := newTestServer(t, "-admin-token=admin-secret")
+	inv := ts.create(invite("+14155550101"))
+	path := "/invitations/" + inv.ID + "/respond"
+	asAdmin := []string{"Authorization", "Bearer admin-secret"}
+
+	if w := ts.do("POST", "/admin"+path, map[string]any{"response": "yes", "recorded_by": "Front desk"}); w.Code != http.StatusUnauthorized {
+		t.Errorf("without the admin token: got %d, want 401", w.Code)
+	}
+	if w := ts.do("POST", "/admin"+path, map[string]any{"response": "yes", "recorded_by": " "}, asAdmin...); w.Code != http.StatusBadRequest {
+		t.Errorf("without recorded_by: got %d, want 400", w.Code)
+	}
+	// No response token: staff don't have the invitee's link.
+	w := ts.do("POST", "/admin"+path, map[string]any{"response": "yes", "recorded_by": "Front desk"}, asAdmin...)
+	if w.Code != http.StatusOK {
+		t.Fatalf("admin respond: got %d: %s", w.Code, w.Body)
+	}
+	if got := ts.get(inv.ID); got.Status != statusAccepted {
+		t.Errorf("status = %q, want %q", got.Status, statusAccepted)
+	}
+
+	w = ts.do("GET", "/invitations/"+inv.ID+"/history", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("history: got %d: %s", w.Code, w.Body)
+	}
+	var responded []InvitationEvent
+	for _, ev := range decodeBody[[]InvitationEvent](t, w) {
+		if ev.Type == historyResponded {
+			responded = append(responded, ev)
+		}
+	}
+	if len(responded) != 1 {
+		t.Fatalf("history has %d responses, want 1", len(responded))
+	}
+	if ev := responded[0]; ev.RecordedBy != "Front desk" || ev.Actor != "admin:Front desk" || ev.Via != viaAdmin || ev.Response != "yes" {
+		t.Errorf("responded event = %+v, want it recorded by Front desk via admin", ev)
+	}
+}
+
+func TestSelfServiceResponseHasNoAttribution(t *testing.T) {
+	ts := newTestServer(t)
+	inv := ts.create(invite("+14155550101"))
+	path := "/invitations/" + inv.ID + "/respond"
+	w := ts.do("POST", path, map[string]any{"token": inv.ResponseToken, "response": "yes", "recorded_by": "Someone else"})
+	if w.Code != http.StatusUnprocessableEntity || decodeBody[errorBody](t, w).Code != codeUnknownField {
+		t.Errorf("self-service recorded_by: got %d: %s", w.Code, w.Body)
+	}
+	if w := ts.respond(inv, "yes"); w.Code != http.StatusOK {
+		t.Fatalf("respond: got %d: %s", w.Code, w.Body)
+	}
+	events, err := ts.store.Events(context.Background(), inv.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ev := range events {
+		if ev.RecordedBy != "" {
+			t.Errorf("self-service %s event attributed to %q", ev.Type, ev.RecordedBy)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package invitations
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"invitation-api/pkg/config"
+)
+
+const (
+	archiveKind     = "archived_invitation"
+	historyRestored = "restored"
+)
+
+// archivedInvitation is an invitation moved out of the store's invitations
+// by archiveResolved, so lists and stats no longer scan it. Its history
+// comes with it, or is in cold storage under Object.
+type archivedInvitation struct {
+	Invitation Invitation        `json:"invitation"`
+	Events     []InvitationEvent `json:"events,omitempty"`
+	Object     string            `json:"object,omitempty"`
+}
+
+// coldStorage keeps archived history outside the store.
+type coldStorage interface {
+	put(ctx context.Context, key string, body []byte) error
+	get(ctx context.Context, key string) ([]byte, error)
+	remove(ctx context.Context, key string) error
+}
+
+// archiveResolved archives every invitation no longer awaiting an answer
+// whose deadline passed ArchiveAfterDays before t. One restored since is
+// left for as long again.
+func (s *Server) archiveResolved(ctx context.Context, t time.Time) (int, error) {
+	cutoff := t.Add(-retentionAge(s.cfg.ArchiveAfterDays))
+	candidates, err := s.store.List(ctx, ListFilter{ExpiresBefore: cutoff})
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, inv := range candidates {
+		if st := inv.withStatus(t).Status; isPending(st) || st == statusScheduled || inv.RestoredAt.After(cutoff) {
+			continue
+		}
+		if err := s.archiveInvitation(ctx, inv, t); err != nil {
+			return n, fmt.Errorf("invitation %s: %w", inv.ID, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// archiveInvitation writes inv and its history to the archive before
+// deleting it, so a failure part way leaves it in both, to be archived
+// again by the next pass. Its response link is kept for a restore.
+func (s *Server) archiveInvitation(ctx context.Context, inv Invitation, t time.Time) error {
+	events, err := s.store.Events(ctx, inv.ID)
+	if err != nil {
+		return err
+	}
+	inv.ArchivedAt = t.UTC()
+	a := archivedInvitation{Invitation: inv, Events: events}
+	if s.cold != nil {
+		body, err := archiveNDJSON(inv, events)
+		if err != nil {
+			return err
+		}
+		a.Object = inv.ID + ".ndjson"
+		if err := s.cold.put(ctx, a.Object, body); err != nil {
+			return err
+		}
+		a.Events = nil
+	}
+	if err := putRecord(ctx, s.store, archiveKind, inv.ID, a); err != nil {
+		return err
+	}
+	if err := s.store.Delete(ctx, inv.ID); err != nil && err != errNotFound {
+		return err
+	}
+	return nil
+}
+
+// archiveNDJSON is an archive object: the invitation on the first line and
+// then its events, oldest first.
+func archiveNDJSON(inv Invitation, events []InvitationEvent) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if err := enc.Encode(inv); err != nil {
+		return nil, err
+	}
+	for _, ev := range events {
+		if err := enc.Encode(ev); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// getArchived reads archived invitation id, as not found for other
+// tenants.
+func (s *Server) getArchived(ctx context.Context, id string) (archivedInvitation, error) {
+	a, err := getRecord[archivedInvitation](ctx, s.store, archiveKind, id)
+	if err != nil {
+		return a, err
+	}
+	if t, ok := tenantFrom(ctx); ok && a.Invitation.TenantID != t {
+		return archivedInvitation{}, errNotFound
+	}
+	return a, nil
+}
+
+// listArchived returns the archived invitations matching f, which must have
+// AsOf set, with their status as of then.
+func (s *Server) listArchived(ctx context.Context, f ListFilter) ([]Invitation, error) {
+	if t, ok := tenantFrom(ctx); ok {
+		f.TenantID = &t
+	}
+	archived, err := listRecords[archivedInvitation](ctx, s.store, archiveKind)
+	if err != nil {
+		return nil, err
+	}
+	var invs []Invitation
+	for _, a := range archived {
+		if f.Match(a.Invitation) {
+			invs = append(invs, a.Invitation.withStatus(f.AsOf))
+		}
+	}
+	return invs, nil
+}
+
+// archivedEvents returns a's history, from cold storage if it went there.
+func (s *Server) archivedEvents(ctx context.Context, a archivedInvitation) ([]InvitationEvent, error) {
+	if a.Object == "" {
+		return a.Events, nil
+	}
+	if s.cold == nil {
+		return nil, errors.New("the history of invitation " + a.Invitation.ID + " is in cold storage, which isn't configured")
+	}
+	body, err := s.cold.get(ctx, a.Object)
+	if err != nil {
+		return nil, err
+	}
+	sc := bufio.NewScanner(bytes.NewReader(body))
+	sc.Buffer(nil, len(body)+1)
+	events := []InvitationEvent{}
+	for first := true; sc.Scan(); first = false {
+		if first {
+			continue
+		}
+		var ev InvitationEvent
+		if err := json.Unmarshal(sc.Bytes(), &ev); err != nil {
+			return nil, fmt.Errorf("archive object %s: %w", a.Object, err)
+		}
+		events = append(events, ev)
+	}
+	return events, sc.Err()
+}
+
+// invitationEvents returns inv's history, archived or not.
+func (s *Server) invitationEvents(ctx context.Context, inv Invitation) ([]InvitationEvent, error) {
+	if inv.ArchivedAt.IsZero() {
+		return s.store.Events(ctx, inv.ID)
+	}
+	a, err := s.getArchived(ctx, inv.ID)
+	if err != nil {
+		return nil, err
+	}
+	return s.archivedEvents(ctx, a)
+}
+
+// dropArchived deletes a from the archive, cold storage included.
+func (s *Server) dropArchived(ctx context.Context, a archivedInvitation) error {
+	if err := s.store.DeleteRecord(ctx, archiveKind, a.Invitation.ID); err != nil && err != errNotFound {
+		return err
+	}
+	if a.Object != "" && s.cold != nil {
+		if err := s.cold.remove(ctx, a.Object); err != nil {
+			slog.ErrorContext(ctx, "failed to delete archive object", "invitation_id", a.Invitation.ID, "object", a.Object, "err", err)
+		}
+	}
+	return nil
+}
+
+// restoreInvitation moves archived invitation id back among the live ones,
+// history and all.
+func (s *Server) restoreInvitation(ctx context.Context, id string) (Invitation, error) {
+	a, err := s.getArchived(ctx, id)
+	if err != nil {
+		return Invitation{}, err
+	}
+	events, err := s.archivedEvents(ctx, a)
+	if err != nil {
+		return Invitation{}, err
+	}
+	inv := a.Invitation
+	inv.ArchivedAt, inv.RestoredAt = time.Time{}, s.now().UTC()
+	switch err := s.store.Create(ctx, inv); err {
+	case nil:
+		for _, ev := range events {
+			if err := s.store.AppendEvent(ctx, id, ev); err != nil {
+				return Invitation{}, err
+			}
+		}
+	case errDuplicateID:
+		// A pass that failed after archiving left it in place.
+		if inv, err = s.store.Get(ctx, id); err != nil {
+			return Invitation{}, err
+		}
+	default:
+		return Invitation{}, err
+	}
+	s.appendEvent(ctx, id, InvitationEvent{Type: historyRestored})
+	if err := s.dropArchived(ctx, a); err != nil {
+		return Invitation{}, err
+	}
+	return inv.withStatus(s.now()), nil
+}
+
+func (s *Server) handleRestoreInvitation(w http.ResponseWriter, r *http.Request) {
+	inv, err := s.restoreInvitation(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeInvitation(w, http.StatusOK, inv)
+}
+
+// includeArchived reports whether r asks for archived invitations too.
+func includeArchived(r *http.Request) bool {
+	return r.URL.Query().Get("include_archived") == "true"
+}
+
+// s3Bucket keeps archive objects in an S3 bucket under prefix, on AWS or,
+// path-style, at endpoint.
+type s3Bucket struct {
+	creds                    awsCredentials
+	bucket, prefix, endpoint string
+	client                   *http.Client
+}
+
+func newS3Bucket(cfg *config.Config) (*s3Bucket, error) {
+	b := &s3Bucket{
+		creds:    awsCredentialsFromEnv(),
+		bucket:   cfg.ArchiveS3Bucket,
+		prefix:   cfg.ArchiveS3Prefix,
+		endpoint: strings.TrimSuffix(cfg.ArchiveS3Endpoint, "/"),
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+	if b.endpoint != "" && b.creds.region == "" {
+		b.creds.region = "us-east-1"
+	}
+	if !b.creds.complete() {
+		return nil, errors.New("archive_s3_bucket requires AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_REGION")
+	}
+	return b, nil
+}
+
+func (b *s3Bucket) url(key string) string {
+	if b.endpoint != "" {
+		return b.endpoint + "/" + b.bucket + "/" + b.prefix + key
+	}
+	return "https://" + b.bucket + ".s3." + b.creds.region + ".amazonaws.com/" + b.prefix + key
+}
+
+// do makes a signed request for key, returning the response body when it
+// succeeded.
+func (b *s3Bucket) do(ctx context.Context, method, key string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, b.url(key), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	}
+	hash := sha256Hex(string(body))
+	req.Header.Set("X-Amz-Content-Sha256", hash)
+	b.creds.sign(req, "s3", hash, time.Now().UTC())
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, errNotFound
+	case resp.StatusCode >= 300:
+		return nil, fmt.Errorf("s3 %s %s: %s", method, b.prefix+key, resp.Status)
+	}
+	return data, nil
+}
+
+func (b *s3Bucket) put(ctx context.Context, key string, body []byte) error {
+	_, err := b.do(ctx, http.MethodPut, key, body)
+	return err
+}
+
+func (b *s3Bucket) get(ctx context.Context, key string) ([]byte, error) {
+	return b.do(ctx, http.MethodGet, key, nil)
+}
+
+func (b *s3Bucket) remove(ctx context.Context, key string) error {
+	_, err := b.do(ctx, http.MethodDelete, key, nil)
+	if err == errNotFound {
+		return nil
+	}
+	return err
+}
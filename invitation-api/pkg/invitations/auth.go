@@ -0,0 +1,285 @@
+package invitations
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+)
+
+const apiKeyKind = "apikey"
+
+// apiKey is stored with only a hash of its secret. The full key handed to
+// clients is "ik_<id>.<secret>" so lookups don't need to scan.
+type apiKey struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	TenantID   string    `json:"tenant_id,omitempty"`
+	SecretHash string    `json:"secret_hash,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	RevokedAt  time.Time `json:"revoked_at,omitempty"`
+	// TestMode makes every invitation created with the key a test one.
+	TestMode bool `json:"test_mode,omitempty"`
+	// UserID is the tenant user the key was issued to, whose role it acts
+	// with; keys without one act as owners.
+	UserID string `json:"user_id,omitempty"`
+
+	// Set instead for an identity signed in with OIDC, whose key is never
+	// stored; see oidcKey.
+	oidc *oidcIdentity
+	role string
+}
+
+type apiKeyContextKey struct{}
+
+func apiKeyFrom(ctx context.Context) (apiKey, bool) {
+	k, ok := ctx.Value(apiKeyContextKey{}).(apiKey)
+	return k, ok
+}
+
+type actorContextKey struct{}
+
+// withActor names who is acting in ctx for the audit log, for example
+// "api_key:<id>", "admin" or "system".
+func withActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+func actorFrom(ctx context.Context) string {
+	if a, ok := ctx.Value(actorContextKey{}).(string); ok {
+		return a
+	}
+	return "system"
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return strings.TrimSpace(token), ok
+}
+
+func (s *Server) lookupAPIKey(ctx context.Context, token string) (apiKey, bool) {
+	rest, ok := strings.CutPrefix(token, "ik_")
+	if !ok {
+		return apiKey{}, false
+	}
+	id, secret, ok := strings.Cut(rest, ".")
+	if !ok {
+		return apiKey{}, false
+	}
+	k, err := getRecord[apiKey](ctx, s.store, apiKeyKind, id)
+	if err != nil || !k.RevokedAt.IsZero() {
+		return apiKey{}, false
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(k.SecretHash)) != 1 {
+		return apiKey{}, false
+	}
+	return k, true
+}
+
+// requireAPIKey authenticates host-side endpoints. Invitee-facing endpoints
+// such as respond are left unwrapped.
+func (s *Server) requireAPIKey(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.cfg.RequireAPIKey {
+			next(w, r.WithContext(withTenant(withActor(r.Context(), "host"), "")))
+			return
+		}
+		token, ok := bearerToken(r)
+		if !ok {
+			writeError(w, r, http.StatusUnauthorized, "missing bearer API key")
+			return
+		}
+		k, err := s.authenticate(r.Context(), token)
+		if err != nil {
+			writeResponseError(w, r, err)
+			return
+		}
+		s.serveAs(w, r, k, next)
+	}
+}
+
+var errInvalidAPIKey = &requestError{status: http.StatusUnauthorized, msg: "invalid API key"}
+
+// authenticate finds who holds a bearer token: an API key or, when
+// oidc_issuer is set, a token from the identity provider.
+func (s *Server) authenticate(ctx context.Context, token string) (apiKey, error) {
+	if s.oidc != nil && !strings.HasPrefix(token, "ik_") {
+		return s.oidcTokenKey(ctx, token)
+	}
+	k, ok := s.lookupAPIKey(ctx, token)
+	if !ok {
+		return apiKey{}, errInvalidAPIKey
+	}
+	return k, nil
+}
+
+// serveAs serves r as the holder of k, with its user's role. Anything but
+// a read needs at least an organizer.
+func (s *Server) serveAs(w http.ResponseWriter, r *http.Request, k apiKey, next http.HandlerFunc) {
+	ctx, err := s.withAPIKey(r.Context(), k)
+	if err == errNotFound {
+		err = errInvalidAPIKey
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && !roleAtLeast(roleFrom(ctx), roleOrganizer) {
+		writeError(w, r, http.StatusForbidden, "viewers can only read")
+		return
+	}
+	next(w, r.WithContext(ctx))
+}
+
+// withAPIKey scopes ctx to the caller holding k, acting as its user if it
+// has one.
+func (s *Server) withAPIKey(ctx context.Context, k apiKey) (context.Context, error) {
+	role, err := s.keyRole(ctx, k)
+	if err != nil {
+		return ctx, err
+	}
+	ctx = context.WithValue(ctx, apiKeyContextKey{}, k)
+	actor := "api_key:" + k.ID
+	if k.UserID != "" {
+		actor = "user:" + k.UserID
+	} else if k.oidc != nil {
+		actor = "oidc:" + k.oidc.Subject
+	}
+	return withRole(withActor(withTenant(ctx, k.TenantID), actor), role), nil
+}
+
+// isAdmin requires the admin token and, when admin_cidrs is set, a client
+// address inside one of those networks.
+func (s *Server) isAdmin(r *http.Request) bool {
+	if s.cfg.AdminToken == "" {
+		return false
+	}
+	if nets := s.cfg.AdminNetworks(); len(nets) > 0 {
+		addr, err := netip.ParseAddr(remoteHost(r))
+		if err != nil || !slices.ContainsFunc(nets, func(p netip.Prefix) bool { return p.Contains(addr.Unmap()) }) {
+			return false
+		}
+	}
+	token, ok := bearerToken(r)
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.AdminToken)) == 1
+}
+
+func (s *Server) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.isAdmin(r) {
+			writeError(w, r, http.StatusUnauthorized, "admin authorization required")
+			return
+		}
+		slog.InfoContext(r.Context(), "admin request", "method", r.Method, "path", r.URL.Path, "remote", remoteHost(r))
+		next(w, r.WithContext(withActor(r.Context(), "admin")))
+	}
+}
+
+type createAPIKeyRequest struct {
+	Name     string `json:"name"`
+	TenantID string `json:"tenant_id"`
+	UserID   string `json:"user_id"`
+	TestMode bool   `json:"test_mode"`
+}
+
+// handleCreateAPIKey issues a key for any tenant, or for a tenant's owner
+// their own tenant's, which the tenant_id of the body can't change.
+func (s *Server) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req createAPIKeyRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if t, scoped := tenantFrom(r.Context()); scoped {
+		req.TenantID = t
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		writeError(w, r, http.StatusBadRequest, "name is required")
+		return
+	}
+	if req.TenantID != "" {
+		if _, err := s.store.GetRecord(r.Context(), tenantKind, req.TenantID); err == errNotFound {
+			writeError(w, r, http.StatusUnprocessableEntity, "unknown tenant_id")
+			return
+		} else if err != nil {
+			writeResponseError(w, r, err)
+			return
+		}
+	}
+	if req.UserID != "" {
+		if _, err := getRecord[user](withTenant(r.Context(), req.TenantID), s.store, userKind, req.UserID); err == errNotFound {
+			writeError(w, r, http.StatusUnprocessableEntity, "unknown user_id")
+			return
+		} else if err != nil {
+			writeResponseError(w, r, err)
+			return
+		}
+	}
+
+	secret := randomHex(24)
+	k := apiKey{ID: randomHex(8), Name: strings.TrimSpace(req.Name), TenantID: req.TenantID, SecretHash: hashSecret(secret), CreatedAt: s.now().UTC(),
+		TestMode: req.TestMode, UserID: req.UserID}
+	if err := putRecord(r.Context(), s.store, apiKeyKind, k.ID, k); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	k.SecretHash = ""
+	writeJSON(w, http.StatusCreated, struct {
+		apiKey
+		Key string `json:"key"`
+	}{k, "ik_" + k.ID + "." + secret})
+}
+
+// ownsKey reports whether the caller in ctx may manage k.
+func ownsKey(ctx context.Context, k apiKey) bool {
+	t, ok := tenantFrom(ctx)
+	return !ok || k.TenantID == t
+}
+
+func (s *Server) handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	all, err := listRecords[apiKey](r.Context(), s.store, apiKeyKind)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	keys := []apiKey{}
+	for _, k := range all {
+		if ownsKey(r.Context(), k) {
+			k.SecretHash = ""
+			keys = append(keys, k)
+		}
+	}
+	writeJSON(w, http.StatusOK, keys)
+}
+
+func (s *Server) handleRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	k, err := getRecord[apiKey](r.Context(), s.store, apiKeyKind, id)
+	if err == errNotFound || err == nil && !ownsKey(r.Context(), k) {
+		writeError(w, r, http.StatusNotFound, "API key not found")
+		return
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if k.RevokedAt.IsZero() {
+		k.RevokedAt = s.now().UTC()
+		if err := putRecord(r.Context(), s.store, apiKeyKind, k.ID, k); err != nil {
+			writeResponseError(w, r, err)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
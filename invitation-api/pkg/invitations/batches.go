@@ -0,0 +1,297 @@
+package invitations
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const batchKind = "batch"
+
+// batch groups invitations for one occasion so their responses can be
+// tallied. Bulk creation makes one implicitly; hosts can also create a named
+// batch and pass its ID when creating invitations one at a time.
+type batch struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name,omitempty"`
+	Message      string    `json:"message,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	CreatedByKey string    `json:"created_by_key,omitempty"`
+
+	// MinYes is the quorum for the event to be on and MaxYes its capacity;
+	// zero means none. Outcome records which was reached; see settleBatch.
+	// With Waitlist, a yes once the batch is full waits for a place instead
+	// of being refused.
+	MinYes    int       `json:"min_yes,omitempty"`
+	MaxYes    int       `json:"max_yes,omitempty"`
+	Waitlist  bool      `json:"waitlist,omitempty"`
+	Outcome   string    `json:"outcome,omitempty"`
+	OutcomeAt time.Time `json:"outcome_at,omitempty"`
+
+	// Notify is where Digest sends; DigestedAt and DigestMilestones record
+	// what it has sent. See digestPolicy.
+	Notify           *HostNotify   `json:"notify,omitempty"`
+	Digest           *digestPolicy `json:"digest,omitempty"`
+	DigestedAt       time.Time     `json:"digested_at,omitempty"`
+	DigestMilestones []string      `json:"digest_milestones,omitempty"`
+
+	// Tags and Notes are the host's, as on invitations; UpdatedAt is when
+	// they were last changed.
+	Tags      []string  `json:"tags,omitempty"`
+	Notes     string    `json:"notes,omitempty"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+type batchCounts struct {
+	Total   int `json:"total"`
+	Pending int `json:"pending"`
+	// Viewed are the pending invitations whose response page was opened.
+	Viewed     int `json:"viewed"`
+	Accepted   int `json:"accepted"`
+	Declined   int `json:"declined"`
+	Responded  int `json:"responded"`
+	Expired    int `json:"expired"`
+	Cancelled  int `json:"cancelled"`
+	Scheduled  int `json:"scheduled"`
+	Waitlisted int `json:"waitlisted"`
+	Delegated  int `json:"delegated"`
+	// Guests are those brought along by accepted invitees.
+	Guests int `json:"guests"`
+}
+
+// add counts inv, whose Status must already be computed.
+func (c *batchCounts) add(inv Invitation) {
+	c.Total++
+	switch inv.Status {
+	case statusPending:
+		c.Pending++
+	case statusViewed:
+		c.Pending++
+		c.Viewed++
+	case statusAccepted:
+		c.Accepted++
+		c.Guests += inv.GuestCount
+	case statusDeclined:
+		c.Declined++
+	case statusResponded:
+		c.Responded++
+	case statusExpired:
+		c.Expired++
+	case statusCancelled:
+		c.Cancelled++
+	case statusScheduled:
+		c.Scheduled++
+	case statusWaitlisted:
+		c.Waitlisted++
+	case statusDelegated:
+		c.Delegated++
+	}
+}
+
+func (s *Server) handleGetBatch(w http.ResponseWriter, r *http.Request) {
+	b, err := getRecord[batch](r.Context(), s.store, batchKind, r.PathValue("id"))
+	if err == errNotFound {
+		writeError(w, r, http.StatusNotFound, "batch not found")
+		return
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	invs, err := s.store.List(r.Context(), ListFilter{BatchID: b.ID})
+	if err == nil && includeArchived(r) {
+		var archived []Invitation
+		archived, err = s.listArchived(r.Context(), ListFilter{BatchID: b.ID, AsOf: s.now()})
+		invs = append(invs, archived...)
+		sortInvitations(invs)
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	resp := struct {
+		batch
+		Counts batchCounts `json:"counts"`
+		// Answers counts the answers to the invitations' questions, by
+		// question ID and then option.
+		Answers map[string]map[string]int `json:"answers,omitempty"`
+		Roster  []rosterEntry             `json:"roster"`
+	}{batch: b, Answers: map[string]map[string]int{}, Roster: make([]rosterEntry, 0, len(invs))}
+	t := s.now()
+	modified := b.CreatedAt
+	for _, m := range []time.Time{b.OutcomeAt, b.DigestedAt, b.UpdatedAt} {
+		if m.After(modified) {
+			modified = m
+		}
+	}
+	for _, inv := range invs {
+		if m := lastModified(inv, t); m.After(modified) {
+			modified = m
+		}
+		inv = inv.withStatus(t)
+		resp.Counts.add(inv)
+		if inv.Status != statusCancelled {
+			addAnswers(resp.Answers, inv)
+		}
+		resp.Roster = append(resp.Roster, rosterEntry{
+			InvitationID: inv.ID,
+			Name:         inv.ContactName,
+			PhoneNumber:  inv.PhoneNumber,
+			Email:        inv.Email,
+			Status:       inv.Status,
+			GuestCount:   inv.GuestCount,
+			RespondedAt:  inv.RespondedAt,
+			Tags:         inv.Tags,
+			Answers:      inv.Answers,
+		})
+	}
+	// The batch is put together from its invitations, so its ETag is a
+	// digest of the result rather than a version.
+	body, err := json.Marshal(resp)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	tag := `W/"` + sha256Hex(string(body))[:32] + `"`
+	setValidators(w, tag, modified)
+	if notModified(r, tag, modified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(body, '\n'))
+}
+
+type rosterEntry struct {
+	InvitationID string    `json:"invitation_id"`
+	Name         string    `json:"name,omitempty"`
+	PhoneNumber  string    `json:"phone_number,omitempty"`
+	Email        string    `json:"email,omitempty"`
+	Status       string    `json:"status"`
+	GuestCount   int       `json:"guest_count,omitempty"`
+	RespondedAt  time.Time `json:"responded_at,omitempty"`
+	Tags         []string  `json:"tags,omitempty"`
+
+	Answers map[string]string `json:"answers,omitempty"`
+}
+
+func (s *Server) handleCreateBatch(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name     string `json:"name"`
+		MinYes   int    `json:"min_yes"`
+		MaxYes   int    `json:"max_yes"`
+		Waitlist bool   `json:"waitlist"`
+
+		Notify *HostNotify   `json:"notify"`
+		Digest *digestPolicy `json:"digest"`
+
+		Tags  []string `json:"tags"`
+		Notes string   `json:"notes"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		writeError(w, r, http.StatusBadRequest, "name is required")
+		return
+	}
+	tags, err := normalizeTags(req.Tags)
+	if err == nil {
+		err = validateNotes(req.Notes)
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if err := validateThresholds(req.MinYes, req.MaxYes, req.Waitlist); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if err := s.validateDigest(req.Notify, req.Digest); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	b := batch{ID: s.ids.NewID(), Name: strings.TrimSpace(req.Name), CreatedAt: s.now().UTC(), MinYes: req.MinYes, MaxYes: req.MaxYes, Waitlist: req.Waitlist,
+		Notify: req.Notify, Digest: req.Digest, Tags: tags, Notes: req.Notes}
+	if k, ok := apiKeyFrom(r.Context()); ok {
+		b.CreatedByKey = k.ID
+	}
+	if err := putRecord(r.Context(), s.store, batchKind, b.ID, b); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, b)
+}
+
+// handleListBatches lists the batches, or with ?tag= those carrying it.
+func (s *Server) handleListBatches(w http.ResponseWriter, r *http.Request) {
+	batches, err := listRecords[batch](r.Context(), s.store, batchKind)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if tag := normalizeTag(r.URL.Query().Get("tag")); tag != "" {
+		batches = slices.DeleteFunc(batches, func(b batch) bool { return !slices.Contains(b.Tags, tag) })
+	}
+	writeJSON(w, http.StatusOK, batches)
+}
+
+// handleUpdateBatch sets a batch's tags or notes.
+func (s *Server) handleUpdateBatch(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Tags  *[]string `json:"tags"`
+		Notes *string   `json:"notes"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if req.Tags == nil && req.Notes == nil {
+		writeError(w, r, http.StatusBadRequest, "nothing to update")
+		return
+	}
+	var tags []string
+	var err error
+	if req.Tags != nil {
+		tags, err = normalizeTags(*req.Tags)
+	}
+	if err == nil && req.Notes != nil {
+		err = validateNotes(*req.Notes)
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+
+	ctx, id := r.Context(), r.PathValue("id")
+	unlock, err := s.locks.lock(ctx, batchLockKey(id))
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	defer unlock()
+	b, err := getRecord[batch](ctx, s.store, batchKind, id)
+	if err == errNotFound {
+		writeError(w, r, http.StatusNotFound, "batch not found")
+		return
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if req.Tags != nil {
+		b.Tags = tags
+	}
+	if req.Notes != nil {
+		b.Notes = *req.Notes
+	}
+	b.UpdatedAt = s.now().UTC()
+	if err := putRecord(ctx, s.store, batchKind, b.ID, b); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, b)
+}
@@ -0,0 +1,154 @@
+package invitations
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// BenchStore runs "invitation-api bench-store": the in-memory store under
+// concurrent create, read and respond load, with as many shards as it
+// normally has and with one, which is a single lock around everything.
+func BenchStore(args []string) error {
+	fs := flag.NewFlagSet("bench-store", flag.ContinueOnError)
+	seed := fs.Int("seed", 10000, "invitations in the store before each benchmark")
+	parallelism := fs.Int("parallelism", 4, "goroutines per CPU")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	benches := []struct {
+		name string
+		fn   func(*testing.B, *memoryStore, []string)
+	}{
+		{"create", benchCreate},
+		{"get", benchGet},
+		{"respond", benchRespond},
+		{"mixed", benchMixed},
+		{"sweep", benchSweep},
+	}
+	fmt.Printf("%-10s %7s %12s %14s\n", "benchmark", "shards", "ns/op", "ops/s")
+	for _, bench := range benches {
+		for _, shards := range []int{1, memoryShards} {
+			res := testing.Benchmark(func(b *testing.B) {
+				st, ids := seededStore(shards, *seed)
+				b.SetParallelism(*parallelism)
+				b.ResetTimer()
+				bench.fn(b, st, ids)
+			})
+			ops := float64(res.N) / res.T.Seconds()
+			fmt.Printf("%-10s %7d %12d %14.0f\n", bench.name, shards, res.NsPerOp(), ops)
+		}
+	}
+	return nil
+}
+
+func seededStore(shards, n int) (*memoryStore, []string) {
+	st := newShardedMemoryStore(shards)
+	now := time.Now()
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = "seed-" + strconv.Itoa(i)
+		st.Create(context.Background(), Invitation{
+			ID:          ids[i],
+			PhoneNumber: "+1555" + strconv.Itoa(1000000+i%5000),
+			Status:      statusPending,
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(time.Duration(i%600) * time.Minute),
+		})
+	}
+	return st, ids
+}
+
+var benchSeq atomic.Int64
+
+func benchInvitation() Invitation {
+	now := time.Now()
+	n := benchSeq.Add(1)
+	return Invitation{
+		ID:          "bench-" + strconv.FormatInt(n, 10),
+		PhoneNumber: "+1555" + strconv.FormatInt(1000000+n%5000, 10),
+		Status:      statusPending,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(time.Hour),
+	}
+}
+
+func benchCreate(b *testing.B, st *memoryStore, _ []string) {
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := st.Create(context.Background(), benchInvitation()); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
+
+func benchGet(b *testing.B, st *memoryStore, ids []string) {
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := st.Get(context.Background(), ids[rand.IntN(len(ids))]); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
+
+// benchRespond makes the store calls a response does: read the invitation,
+// record the answer and log the event.
+func benchRespond(b *testing.B, st *memoryStore, ids []string) {
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			respondOnce(b, st, ids[rand.IntN(len(ids))])
+		}
+	})
+}
+
+func respondOnce(b *testing.B, st *memoryStore, id string) {
+	ctx := context.Background()
+	if _, err := st.Get(ctx, id); err != nil {
+		b.Error(err)
+		return
+	}
+	_, err := st.Update(ctx, id, func(inv *Invitation) error {
+		inv.Response, inv.RespondedAt = "yes", time.Now()
+		return nil
+	})
+	if err != nil {
+		b.Error(err)
+		return
+	}
+	st.AppendEvent(ctx, id, InvitationEvent{Type: "responded", At: time.Now()})
+}
+
+// benchMixed is one create to two responses to seven reads.
+func benchMixed(b *testing.B, st *memoryStore, ids []string) {
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			switch n := rand.IntN(10); {
+			case n == 0:
+				st.Create(context.Background(), benchInvitation())
+			case n < 3:
+				respondOnce(b, st, ids[rand.IntN(len(ids))])
+			default:
+				st.Get(context.Background(), ids[rand.IntN(len(ids))])
+			}
+		}
+	})
+}
+
+// benchSweep is the sweeper's query for invitations that expired in the
+// last minute.
+func benchSweep(b *testing.B, st *memoryStore, _ []string) {
+	until := time.Now().Add(30 * time.Minute)
+	for i := 0; i < b.N; i++ {
+		if _, err := st.List(context.Background(), ListFilter{ExpiresAfter: until.Add(-time.Minute), ExpiresBefore: until}); err != nil {
+			b.Error(err)
+		}
+	}
+}
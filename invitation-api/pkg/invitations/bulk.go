@@ -0,0 +1,416 @@
+package invitations
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxBulkRecipients = 500
+
+type bulkRecipient struct {
+	PhoneNumber string `json:"phone_number"`
+	Email       string `json:"email"`
+	Timezone    string `json:"timezone"`
+	Locale      string `json:"locale"`
+	ContactID   string `json:"contact_id"`
+	ExternalID  string `json:"external_id"`
+
+	Variables map[string]string `json:"variables"`
+}
+
+type bulkRequest struct {
+	Name            string          `json:"name"`
+	Message         string          `json:"message"`
+	DurationMin     int             `json:"duration_min"`
+	RemindBeforeMin MinuteList      `json:"remind_before_min"`
+	Channels        []string        `json:"channels"`
+	Timezone        string          `json:"timezone"`
+	Locale          string          `json:"locale"`
+	Recipients      []bulkRecipient `json:"recipients"`
+	Tags            []string        `json:"tags"` // contacts with any of these are added to Recipients
+	MinYes          int             `json:"min_yes"`
+	MaxYes          int             `json:"max_yes"`
+	Waitlist        bool            `json:"waitlist"`
+	MaxGuests       int             `json:"max_guests"`
+
+	EventAt          *time.Time `json:"event_at"`
+	EventDurationMin int        `json:"event_duration_min"`
+	Location         string     `json:"location"`
+
+	TemplateID string            `json:"template_id"`
+	Variables  map[string]string `json:"variables"`
+	Metadata   map[string]string `json:"metadata"`
+	Notify     *HostNotify       `json:"notify"`
+	Digest     *digestPolicy     `json:"digest"`
+	Priority   string            `json:"priority"`
+
+	OverrideBudget bool          `json:"override_budget"`
+	AllowDuplicate bool          `json:"allow_duplicate"`
+	TestMode       bool          `json:"test_mode"`
+	TestResponse   *TestResponse `json:"test_response"`
+	// Personas mixes test responses across the recipients by weight, with
+	// any test_response giving their note, guest count and timing.
+	Personas map[string]int `json:"personas"`
+
+	testResponses []*TestResponse // per recipient, in turn, from Personas
+}
+
+type bulkResult struct {
+	Index       int         `json:"index"`
+	Name        string      `json:"name,omitempty"`
+	PhoneNumber string      `json:"phone_number,omitempty"`
+	Email       string      `json:"email,omitempty"`
+	Invitation  *Invitation `json:"invitation,omitempty"`
+	// Merged is set when Invitation is one the recipient already had.
+	Merged bool   `json:"merged,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// handleBulkCreate invites every recipient with the same message and
+// duration. The body is either JSON or CSV with a header row naming
+// phone_number, email or contact_id and optionally timezone and external_id
+// columns, with any other column becoming a template variable; for CSV the
+// shared fields come from the query string. Contacts with any of the given
+// tags are invited too. Recipients succeed or fail independently.
+func (s *Server) handleBulkCreate(w http.ResponseWriter, r *http.Request) {
+	req, err := parseBulkRequest(r)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	shared, err := s.prepareBulk(r.Context(), &req)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if err := validateThresholds(req.MinYes, req.MaxYes, req.Waitlist); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if req.Digest != nil {
+		// prepareBulk has checked notify along with the other shared fields.
+		if err := req.Digest.validate(req.Notify); err != nil {
+			writeResponseError(w, r, err)
+			return
+		}
+	}
+
+	b := batch{ID: s.ids.NewID(), Name: req.Name, Message: shared.Message, CreatedAt: s.now().UTC(), MinYes: req.MinYes, MaxYes: req.MaxYes, Waitlist: req.Waitlist,
+		Notify: req.Notify, Digest: req.Digest}
+	if k, ok := apiKeyFrom(r.Context()); ok {
+		b.CreatedByKey = k.ID
+	}
+	if err := putRecord(r.Context(), s.store, batchKind, b.ID, b); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, struct {
+		BatchID string       `json:"batch_id"`
+		Results []bulkResult `json:"results"`
+	}{b.ID, s.inviteAll(r.Context(), b, req, shared)})
+}
+
+// handleImportBatch adds the recipients of a bulk request, usually a CSV
+// file, to an existing batch. The batch's message is used unless the
+// request gives one.
+func (s *Server) handleImportBatch(w http.ResponseWriter, r *http.Request) {
+	b, err := getRecord[batch](r.Context(), s.store, batchKind, r.PathValue("id"))
+	if err == errNotFound {
+		writeError(w, r, http.StatusNotFound, "batch not found")
+		return
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	req, err := parseBulkRequest(r)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if req.Message == "" && req.TemplateID == "" {
+		req.Message = b.Message
+	}
+	shared, err := s.prepareBulk(r.Context(), &req)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, struct {
+		BatchID string       `json:"batch_id"`
+		Results []bulkResult `json:"results"`
+	}{b.ID, s.inviteAll(r.Context(), b, req, shared)})
+}
+
+// prepareBulk adds tagged contacts to req's recipients and returns the
+// fields every invitation shares, checked once up front so that a bad
+// message fails the whole request rather than every row.
+func (s *Server) prepareBulk(ctx context.Context, req *bulkRequest) (CreateInvitationRequest, error) {
+	if len(req.Tags) > 0 {
+		tagged, err := s.taggedContacts(ctx, req.Tags)
+		if err != nil {
+			return CreateInvitationRequest{}, err
+		}
+		for _, c := range tagged {
+			req.Recipients = append(req.Recipients, bulkRecipient{ContactID: c.ID})
+		}
+	}
+	if len(req.Recipients) == 0 {
+		return CreateInvitationRequest{}, badRequest("recipients must not be empty")
+	}
+	if len(req.Recipients) > maxBulkRecipients {
+		return CreateInvitationRequest{}, badRequest("at most " + strconv.Itoa(maxBulkRecipients) + " recipients are allowed")
+	}
+	if !testMode(ctx, req.TestMode) {
+		if err := s.checkBudget(ctx, req.OverrideBudget); err != nil {
+			return CreateInvitationRequest{}, err
+		}
+	}
+	shared := CreateInvitationRequest{
+		Message:         req.Message,
+		DurationMin:     req.DurationMin,
+		RemindBeforeMin: req.RemindBeforeMin,
+		Channels:        req.Channels,
+		Timezone:        req.Timezone,
+		Locale:          req.Locale,
+		MaxGuests:       req.MaxGuests,
+		TemplateID:      req.TemplateID,
+		Metadata:        req.Metadata,
+		Notify:          req.Notify,
+		Priority:        req.Priority,
+		TestMode:        req.TestMode,
+		TestResponse:    req.TestResponse,
+		AllowDuplicate:  req.AllowDuplicate,
+
+		EventAt:          req.EventAt,
+		EventDurationMin: req.EventDurationMin,
+		Location:         req.Location,
+	}
+	if err := s.resolveTemplate(ctx, &shared); err != nil {
+		return shared, err
+	}
+	if err := s.validateContent(&shared); err != nil {
+		return shared, err
+	}
+	if len(req.Personas) > 0 {
+		if !testMode(ctx, req.TestMode) {
+			return shared, badRequest("personas need test_mode")
+		}
+		cycle, err := personaCycle(req.Personas)
+		if err != nil {
+			return shared, err
+		}
+		byPersona := map[string]*TestResponse{}
+		for _, p := range cycle {
+			tr, ok := byPersona[p]
+			if !ok {
+				tr = &TestResponse{}
+				if shared.TestResponse != nil {
+					*tr = *shared.TestResponse
+				}
+				tr.Persona, tr.Response = p, ""
+				if err := tr.validate(Invitation{ResponseOptions: shared.ResponseOptions}.options(), shared.MaxGuests); err != nil {
+					return shared, err
+				}
+				byPersona[p] = tr
+			}
+			req.testResponses = append(req.testResponses, tr)
+		}
+	}
+	return shared, nil
+}
+
+// inviteAll creates and sends an invitation in b for each recipient of req.
+// Recipients succeed or fail independently.
+func (s *Server) inviteAll(ctx context.Context, b batch, req bulkRequest, shared CreateInvitationRequest) []bulkResult {
+	results := make([]bulkResult, 0, len(req.Recipients))
+	for i, rc := range req.Recipients {
+		res := bulkResult{Index: i, PhoneNumber: rc.PhoneNumber, Email: rc.Email}
+		one := shared
+		one.PhoneNumber, one.Email, one.BatchID, one.ContactID, one.ExternalID = rc.PhoneNumber, rc.Email, b.ID, rc.ContactID, rc.ExternalID
+		if rc.Timezone != "" {
+			one.Timezone = rc.Timezone
+		}
+		if rc.Locale != "" {
+			one.Locale = rc.Locale
+		}
+		if n := len(req.testResponses); n > 0 {
+			tr := *req.testResponses[i%n]
+			one.TestResponse = &tr
+		}
+		one.Variables = make(map[string]string, len(req.Variables)+len(rc.Variables))
+		maps.Copy(one.Variables, req.Variables)
+		maps.Copy(one.Variables, rc.Variables)
+		if len(req.Channels) == 0 {
+			// Left to default per recipient, so email-only contacts get email.
+			one.Channels = nil
+		}
+		err := s.resolveContact(ctx, &one)
+		var inv Invitation
+		if err == nil {
+			res.Name, res.PhoneNumber, res.Email = one.contactName, one.PhoneNumber, one.Email
+			inv, err = s.newInvitation(ctx, one)
+		}
+		if err == errMerged {
+			err, res.Merged = nil, true
+		} else if err == nil {
+			err = s.createAndNotify(ctx, &inv)
+		}
+		if err != nil {
+			var re *requestError
+			if !errors.As(err, &re) {
+				err = errors.New("failed to store invitation")
+			}
+			res.Error = err.Error()
+		} else {
+			inv = inv.withStatus(s.now())
+			res.Invitation = &inv
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+func parseBulkRequest(r *http.Request) (bulkRequest, error) {
+	var req bulkRequest
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mt {
+	case "application/json":
+		if err := decodeJSON(r, &req); err != nil {
+			return req, err
+		}
+		return req, nil
+	case "text/csv":
+	default:
+		return req, &requestError{status: http.StatusUnsupportedMediaType, msg: "Content-Type must be application/json or text/csv"}
+	}
+
+	q := r.URL.Query()
+	req.Name = q.Get("name")
+	req.Message = q.Get("message")
+	req.DurationMin, _ = strconv.Atoi(q.Get("duration_min"))
+	req.MinYes, _ = strconv.Atoi(q.Get("min_yes"))
+	req.MaxYes, _ = strconv.Atoi(q.Get("max_yes"))
+	req.Waitlist, _ = strconv.ParseBool(q.Get("waitlist"))
+	req.OverrideBudget, _ = strconv.ParseBool(q.Get("override_budget"))
+	req.AllowDuplicate, _ = strconv.ParseBool(q.Get("allow_duplicate"))
+	req.TestMode, _ = strconv.ParseBool(q.Get("test_mode"))
+	if v := q.Get("personas"); v != "" {
+		req.Personas = map[string]int{}
+		for _, pw := range strings.Split(v, ",") {
+			p, w, ok := strings.Cut(pw, ":")
+			n, err := strconv.Atoi(w)
+			if !ok || err != nil {
+				return req, badRequest("personas must be a list of persona:weight")
+			}
+			req.Personas[strings.TrimSpace(p)] = n
+		}
+	}
+	req.MaxGuests, _ = strconv.Atoi(q.Get("max_guests"))
+	if v := q.Get("event_at"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return req, badRequest("event_at must be an RFC 3339 time")
+		}
+		req.EventAt = &t
+	}
+	req.EventDurationMin, _ = strconv.Atoi(q.Get("event_duration_min"))
+	req.Location = q.Get("location")
+	req.Timezone = q.Get("timezone")
+	req.Locale = q.Get("locale")
+	req.Priority = q.Get("priority")
+	req.TemplateID = q.Get("template_id")
+	req.Tags = q["tag"]
+	if v := q.Get("channels"); v != "" {
+		req.Channels = strings.Split(v, ",")
+	}
+	for _, v := range q["remind_before_min"] {
+		m, err := strconv.Atoi(v)
+		if err != nil {
+			return req, badRequest("remind_before_min must be a number")
+		}
+		req.RemindBeforeMin = append(req.RemindBeforeMin, m)
+	}
+
+	cr := csv.NewReader(r.Body)
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return req, badRequest("CSV body must start with a header row")
+	}
+	phoneCol, emailCol, tzCol, localeCol, contactCol, externalCol := -1, -1, -1, -1, -1, -1
+	for i, h := range header {
+		switch strings.ToLower(strings.TrimSpace(h)) {
+		case "phone_number", "phone":
+			phoneCol = i
+		case "email":
+			emailCol = i
+		case "timezone":
+			tzCol = i
+		case "locale":
+			localeCol = i
+		case "contact_id":
+			contactCol = i
+		case "external_id":
+			externalCol = i
+		}
+	}
+	if phoneCol < 0 && emailCol < 0 && contactCol < 0 {
+		return req, badRequest("CSV header must include a phone_number, email or contact_id column")
+	}
+	cr.FieldsPerRecord = len(header)
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if err := bodyError(err); err != nil {
+				return req, err
+			}
+			return req, badRequest("invalid CSV: " + err.Error())
+		}
+		var rc bulkRecipient
+		if phoneCol >= 0 {
+			rc.PhoneNumber = strings.TrimSpace(row[phoneCol])
+		}
+		if emailCol >= 0 {
+			rc.Email = strings.TrimSpace(row[emailCol])
+		}
+		if tzCol >= 0 {
+			rc.Timezone = strings.TrimSpace(row[tzCol])
+		}
+		if localeCol >= 0 {
+			rc.Locale = strings.TrimSpace(row[localeCol])
+		}
+		if contactCol >= 0 {
+			rc.ContactID = strings.TrimSpace(row[contactCol])
+		}
+		if externalCol >= 0 {
+			rc.ExternalID = strings.TrimSpace(row[externalCol])
+		}
+		for i, h := range header {
+			if i == phoneCol || i == emailCol || i == tzCol || i == localeCol || i == contactCol || i == externalCol {
+				continue
+			}
+			if rc.Variables == nil {
+				rc.Variables = make(map[string]string)
+			}
+			rc.Variables[strings.TrimSpace(h)] = strings.TrimSpace(row[i])
+		}
+		req.Recipients = append(req.Recipients, rc)
+		if len(req.Recipients) > maxBulkRecipients {
+			break
+		}
+	}
+	return req, nil
+}
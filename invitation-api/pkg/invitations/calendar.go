@@ -0,0 +1,104 @@
+package invitations
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultEventDurationMin = 60
+	maxLocationLen          = 200
+)
+
+// calendarLink is where an invitee can fetch the invitation's event as an
+// iCalendar file, or empty when there is no event time or public URL. The
+// response token in the query stands in for an API key.
+func (s *Server) calendarLink(inv Invitation) string {
+	token := s.responseToken(inv)
+	if s.cfg.PublicURL == "" || inv.EventAt.IsZero() || token == "" {
+		return ""
+	}
+	return strings.TrimRight(s.cfg.PublicURL, "/") + "/invitations/" + url.PathEscape(inv.ID) +
+		"/calendar.ics?token=" + url.QueryEscape(token)
+}
+
+// handleCalendar serves the invitation's event as a single-event iCalendar
+// file (RFC 5545) to anyone holding its response token.
+func (s *Server) handleCalendar(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if s.expiredLink(token) != nil {
+		writeResponseError(w, r, errNotFound)
+		return
+	}
+	inv, err := s.store.Get(r.Context(), r.PathValue("id"))
+	if err == nil && s.checkResponseToken(inv, token) != nil {
+		err = errNotFound
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if inv.EventAt.IsZero() {
+		writeError(w, r, http.StatusNotFound, "invitation has no event time")
+		return
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="invitation.ics"`)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(s.calendar(inv.withStatus(s.now()))))
+}
+
+func (s *Server) calendar(inv Invitation) string {
+	const stamp = "20060102T150405Z"
+	var b strings.Builder
+	line := func(name, value string) {
+		// Lines are folded at 75 octets, continuing with a space, without
+		// splitting a UTF-8 sequence.
+		l := name + ":" + value
+		for len(l) > 75 {
+			n := 75
+			for n > 0 && l[n]&0xC0 == 0x80 {
+				n--
+			}
+			b.WriteString(l[:n] + "\r\n")
+			l = " " + l[n:]
+		}
+		b.WriteString(l + "\r\n")
+	}
+	dur := time.Duration(inv.EventDuration) * time.Minute
+	if dur == 0 {
+		dur = defaultEventDurationMin * time.Minute
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//invit-timer//invitation-api//EN")
+	line("METHOD", "PUBLISH")
+	line("BEGIN", "VEVENT")
+	line("UID", inv.ID+"@invit-timer")
+	line("DTSTAMP", s.now().UTC().Format(stamp))
+	line("DTSTART", inv.EventAt.UTC().Format(stamp))
+	line("DTEND", inv.EventAt.Add(dur).UTC().Format(stamp))
+	line("SUMMARY", icsText(inv.Message))
+	if inv.Location != "" {
+		line("LOCATION", icsText(inv.Location))
+	}
+	if link := s.responseLink(inv); link != "" {
+		line("URL", link)
+	}
+	if inv.Status == statusCancelled {
+		line("STATUS", "CANCELLED")
+	} else {
+		line("STATUS", "CONFIRMED")
+	}
+	line("END", "VEVENT")
+	line("END", "VCALENDAR")
+	return b.String()
+}
+
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// icsText escapes s as an iCalendar TEXT value.
+func icsText(s string) string { return icsEscaper.Replace(s) }
@@ -0,0 +1,135 @@
+package invitations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultChaosReportAfter leaves the outbox time to index a message before
+// its injected status report arrives, which would otherwise be ignored.
+const defaultChaosReportAfter = 2 * time.Second
+
+// chaosRule injects failures into texts to phone numbers starting with
+// Prefix, any when empty. A send fails outright at ErrorRate, fails in a
+// way worth retrying at TransientRate, and is otherwise passed on after
+// Latency and up to Jitter more. Texts that go out are then reported, as
+// by the provider's status callback, ReportAfter later: failed at
+// UndeliveredRate, delivered otherwise.
+type chaosRule struct {
+	Prefix          string        `yaml:"prefix"`
+	ErrorRate       float64       `yaml:"error_rate"`
+	TransientRate   float64       `yaml:"transient_rate"`
+	Latency         time.Duration `yaml:"latency"`
+	Jitter          time.Duration `yaml:"jitter"`
+	UndeliveredRate float64       `yaml:"undelivered_rate"`
+	ReportAfter     time.Duration `yaml:"report_after"`
+}
+
+// loadChaosRules reads a YAML list of chaos rules, with durations such as
+// "2s".
+func loadChaosRules(path string) ([]chaosRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []chaosRule
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+	for i := range rules {
+		r := &rules[i]
+		if r.Prefix != "" && (len(r.Prefix) < 2 || r.Prefix[0] != '+' || strings.Trim(r.Prefix[1:], "0123456789") != "") {
+			return nil, fmt.Errorf("chaos rule %q: prefix must be + and digits, such as +44", r.Prefix)
+		}
+		for _, rate := range []float64{r.ErrorRate, r.TransientRate, r.UndeliveredRate} {
+			if rate < 0 || rate > 1 {
+				return nil, fmt.Errorf("chaos rule %q: rates must be between 0 and 1", r.Prefix)
+			}
+		}
+		if r.ErrorRate+r.TransientRate > 1 {
+			return nil, fmt.Errorf("chaos rule %q: error_rate and transient_rate must not add up to more than 1", r.Prefix)
+		}
+		if r.Latency < 0 || r.Jitter < 0 || r.ReportAfter < 0 {
+			return nil, fmt.Errorf("chaos rule %q: durations must not be negative", r.Prefix)
+		}
+		if r.ReportAfter == 0 {
+			r.ReportAfter = defaultChaosReportAfter
+		}
+	}
+	return rules, nil
+}
+
+// chaosSender passes texts on to next, failing or delaying them by the
+// rule with the longest matching prefix. Status reports go to report,
+// once the server is up to take them.
+type chaosSender struct {
+	next   SMSSender
+	rules  []chaosRule
+	report func(ctx context.Context, msgID, status, reason string) error
+}
+
+func (s *chaosSender) Check(ctx context.Context) error {
+	if c, ok := s.next.(healthChecker); ok {
+		return c.Check(ctx)
+	}
+	return nil
+}
+
+func (s *chaosSender) rule(to string) (chaosRule, bool) {
+	best, ok := chaosRule{}, false
+	for _, r := range s.rules {
+		if strings.HasPrefix(to, r.Prefix) && (!ok || len(r.Prefix) > len(best.Prefix)) {
+			best, ok = r, true
+		}
+	}
+	return best, ok
+}
+
+func (s *chaosSender) Send(ctx context.Context, to, body string) (string, error) {
+	r, ok := s.rule(to)
+	if !ok {
+		return s.next.Send(ctx, to, body)
+	}
+	d := r.Latency
+	if r.Jitter > 0 {
+		d += rand.N(r.Jitter)
+	}
+	if d > 0 {
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return "", transientError{ctx.Err()}
+		}
+	}
+	switch x := rand.Float64(); {
+	case x < r.ErrorRate:
+		return "", errors.New("chaos: injected send failure")
+	case x < r.ErrorRate+r.TransientRate:
+		return "", transientError{errors.New("chaos: injected transient send failure")}
+	}
+
+	id, err := s.next.Send(ctx, to, body)
+	if err != nil || id == "" || s.report == nil {
+		return id, err
+	}
+	status, reason := deliveryDelivered, ""
+	if rand.Float64() < r.UndeliveredRate {
+		status, reason = deliveryFailed, "chaos: injected delivery failure"
+	}
+	time.AfterFunc(r.ReportAfter, func() {
+		if err := s.report(context.Background(), id, status, reason); err != nil {
+			slog.Error("failed to report injected delivery status", "message_id", id, "status", status, "err", err)
+		}
+	})
+	return id, nil
+}
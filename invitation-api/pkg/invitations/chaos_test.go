@@ -0,0 +1,134 @@
+package invitations
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingSender accepts every text, numbering them.
+type recordingSender struct {
+	mu   sync.Mutex
+	sent []string
+}
+
+func (s *recordingSender) Send(_ context.Context, to, _ string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, to)
+	return "msg-" + to, nil
+}
+
+func (s *recordingSender) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sent)
+}
+
+func TestChaosInjectsFailures(t *testing.T) {
+	next := &recordingSender{}
+	s := &chaosSender{next: next, rules: []chaosRule{
+		{Prefix: "+44", ErrorRate: 1},
+		{Prefix: "+447", TransientRate: 1},
+		{Prefix: "+33", ErrorRate: 0, TransientRate: 0},
+	}}
+	ctx := context.Background()
+
+	if _, err := s.Send(ctx, "+442071234567", "hi"); err == nil || isTransient(err) {
+		t.Errorf("error_rate 1: got %v, want a permanent failure", err)
+	}
+	// The longest matching prefix wins.
+	if _, err := s.Send(ctx, "+447700900123", "hi"); !isTransient(err) {
+		t.Errorf("transient_rate 1: got %v, want a transient failure", err)
+	}
+	if next.count() != 0 {
+		t.Fatalf("%d failed texts passed on", next.count())
+	}
+	for _, to := range []string{"+33612345678", "+14155550101"} {
+		if id, err := s.Send(ctx, to, "hi"); err != nil || id != "msg-"+to {
+			t.Errorf("send to %s: %q, %v; want it passed on", to, id, err)
+		}
+	}
+	if next.count() != 2 {
+		t.Errorf("%d texts passed on, want 2", next.count())
+	}
+}
+
+func TestChaosInjectsLatency(t *testing.T) {
+	s := &chaosSender{next: &recordingSender{}, rules: []chaosRule{{Prefix: "+1", Latency: 50 * time.Millisecond}}}
+
+	start := time.Now()
+	if _, err := s.Send(context.Background(), "+14155550101", "hi"); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf("sent after %v, want at least the 50ms latency", d)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if _, err := s.Send(ctx, "+14155550101", "hi"); !isTransient(err) {
+		t.Errorf("send given up during the latency: got %v, want a transient failure", err)
+	}
+}
+
+func TestChaosReportsDelivery(t *testing.T) {
+	type report struct{ id, status string }
+	reports := make(chan report, 2)
+	s := &chaosSender{
+		next: &recordingSender{},
+		rules: []chaosRule{
+			{Prefix: "+44", UndeliveredRate: 1, ReportAfter: time.Millisecond},
+			{Prefix: "+33", ReportAfter: time.Millisecond},
+		},
+		report: func(_ context.Context, msgID, status, _ string) error {
+			reports <- report{msgID, status}
+			return nil
+		},
+	}
+	for to, want := range map[string]string{"+442071234567": deliveryFailed, "+33612345678": deliveryDelivered} {
+		if _, err := s.Send(context.Background(), to, "hi"); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case r := <-reports:
+			if r.id != "msg-"+to || r.status != want {
+				t.Errorf("report for %s = %+v, want %s", to, r, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no status report for %s", to)
+		}
+	}
+}
+
+func TestLoadChaosRules(t *testing.T) {
+	write := func(yaml string) string {
+		path := filepath.Join(t.TempDir(), "chaos.yaml")
+		if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	rules, err := loadChaosRules(write("- prefix: \"+44\"\n  transient_rate: 0.5\n  latency: 2s\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := chaosRule{Prefix: "+44", TransientRate: 0.5, Latency: 2 * time.Second, ReportAfter: defaultChaosReportAfter}
+	if len(rules) != 1 || rules[0] != want {
+		t.Errorf("rules = %+v, want [%+v]", rules, want)
+	}
+
+	for _, bad := range []string{
+		"- prefix: \"44\"\n",
+		"- error_rate: 1.5\n",
+		"- error_rate: 0.6\n  transient_rate: 0.6\n",
+		"- latency: -1s\n",
+	} {
+		if _, err := loadChaosRules(write(bad)); err == nil {
+			t.Errorf("%q: no error", bad)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package invitations
+
+import (
+	"context"
+	"time"
+)
+
+// Clock is where the server gets the time. The background jobs wait on its
+// tickers rather than time's, so a fake clock such as testutil.FakeClock
+// drives expiry, reminders and quiet hours as well as the handlers.
+type Clock interface {
+	Now() time.Time
+	// NewTicker returns a channel that receives the time every d, as
+	// time.NewTicker's C does, and a function that stops it.
+	NewTicker(d time.Duration) (ticks <-chan time.Time, stop func())
+}
+
+// systemClock is the real time.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) NewTicker(d time.Duration) (<-chan time.Time, func()) {
+	t := time.NewTicker(d)
+	return t.C, t.Stop
+}
+
+// clockStore stamps each update's UpdatedAt with the time on the server's
+// clock, so that Last-Modified moves with a fake clock too.
+type clockStore struct {
+	Store
+	now func() time.Time
+}
+
+func (s clockStore) Update(ctx context.Context, id string, fn func(*Invitation) error) (Invitation, error) {
+	return s.Store.Update(ctx, id, func(inv *Invitation) error {
+		if err := fn(inv); err != nil {
+			return err
+		}
+		inv.UpdatedAt = s.now().UTC()
+		return nil
+	})
+}
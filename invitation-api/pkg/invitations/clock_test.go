@@ -0,0 +1,127 @@
+package invitations
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestUpdatesFollowServerClock(t *testing.T) {
+	ts := newTestServer(t)
+	inv := ts.create(invite("+14155550101"))
+
+	ts.clock.Advance(10 * time.Minute)
+	if w := ts.respond(inv, "yes"); w.Code != http.StatusOK {
+		t.Fatalf("respond: got %d: %s", w.Code, w.Body)
+	}
+	want := testStart.Add(10 * time.Minute)
+	if got := ts.get(inv.ID); !got.UpdatedAt.Equal(want) {
+		t.Errorf("updated_at = %v, want %v", got.UpdatedAt, want)
+	}
+	w := ts.do("GET", "/invitations/"+inv.ID, nil)
+	if got := w.Header().Get("Last-Modified"); got != want.Format(http.TimeFormat) {
+		t.Errorf("Last-Modified = %q, want %q", got, want.Format(http.TimeFormat))
+	}
+}
+
+func TestSweeperExpiresAtDeadline(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	var expired []string
+	ts.onExpire(func(_ context.Context, inv Invitation) { expired = append(expired, inv.ID) })
+	inv := ts.create(invite("+14155550101"))
+
+	ts.clock.Advance(59 * time.Minute)
+	if err := ts.sweepExpired(ctx, time.Time{}, ts.now()); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ts.store.Get(ctx, inv.ID); got.Status != "" || len(expired) != 0 {
+		t.Fatalf("swept a minute before the deadline: status %q, callbacks for %v", got.Status, expired)
+	}
+
+	since := ts.now()
+	ts.clock.Advance(2 * time.Minute)
+	if err := ts.sweepExpired(ctx, since, ts.now()); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ts.store.Get(ctx, inv.ID); got.Status != statusExpired {
+		t.Errorf("status after the deadline = %q, want %q", got.Status, statusExpired)
+	}
+	if len(expired) != 1 || expired[0] != inv.ID {
+		t.Errorf("expiry callbacks for %v, want just %s", expired, inv.ID)
+	}
+}
+
+func TestRemindersFireOnTime(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	req := invite("+14155550101")
+	req["remind_before_min"] = 15
+	inv := ts.create(req)
+	ts.drainOutbox()
+	sent := len(ts.sms.messages())
+
+	pass := func(after time.Duration) int {
+		t.Helper()
+		ts.clock.Set(testStart.Add(after))
+		if err := ts.sendDueReminders(ctx, ts.now()); err != nil {
+			t.Fatal(err)
+		}
+		ts.drainOutbox()
+		return len(ts.sms.messages()) - sent
+	}
+	if n := pass(44*time.Minute + 59*time.Second); n != 0 {
+		t.Fatalf("%d reminders before 15 minutes were left", n)
+	}
+	if n := pass(45 * time.Minute); n != 1 {
+		t.Fatalf("%d reminders with 15 minutes left, want 1", n)
+	}
+	if got, want := ts.sms.messages()[sent].Body, reminderMessage(inv.Locale, 15); got != want {
+		t.Errorf("reminder %q, want %q", got, want)
+	}
+	if n := pass(50 * time.Minute); n != 1 {
+		t.Errorf("reminder sent again: %d in all", n)
+	}
+}
+
+func TestQuietHoursDeferSend(t *testing.T) {
+	ts := newTestServer(t, "-quiet-hours=21:00-08:00")
+	ctx := context.Background()
+	night := time.Date(2026, 3, 2, 23, 0, 0, 0, time.UTC)
+	morning := time.Date(2026, 3, 3, 8, 0, 0, 0, time.UTC)
+	ts.clock.Set(night)
+
+	inv := ts.create(invite("+14155550101"))
+	if inv.Status != statusScheduled || !inv.SendAt.Equal(morning) || !inv.DeferredFrom.Equal(night) {
+		t.Fatalf("created %s, send_at %v, deferred_from %v; want scheduled for %v", inv.Status, inv.SendAt, inv.DeferredFrom, morning)
+	}
+	if want := morning.Add(time.Hour); !inv.ExpiresAt.Equal(want) {
+		t.Errorf("expires_at = %v, want %v", inv.ExpiresAt, want)
+	}
+	ts.drainOutbox()
+	if n := len(ts.sms.messages()); n != 0 {
+		t.Fatalf("%d texts sent during quiet hours", n)
+	}
+
+	ts.clock.Set(morning.Add(-time.Minute))
+	if err := ts.sendScheduled(ctx, ts.now()); err != nil {
+		t.Fatal(err)
+	}
+	ts.drainOutbox()
+	if n := len(ts.sms.messages()); n != 0 {
+		t.Fatalf("%d texts sent before quiet hours ended", n)
+	}
+
+	ts.clock.Set(morning)
+	if err := ts.sendScheduled(ctx, ts.now()); err != nil {
+		t.Fatal(err)
+	}
+	ts.drainOutbox()
+	if n := len(ts.sms.messages()); n != 1 {
+		t.Errorf("%d texts sent once quiet hours ended, want 1", n)
+	}
+	if got := ts.get(inv.ID); got.Status != statusPending {
+		t.Errorf("status after sending = %q, want %q", got.Status, statusPending)
+	}
+}
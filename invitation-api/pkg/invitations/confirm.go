@@ -0,0 +1,153 @@
+package invitations
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	historyConfirmationSent = "confirmation_sent"
+	defaultConfirmWithinMin = 10
+	maxConfirmWithinMin     = 60
+	maxConfirmAttempts      = 5
+)
+
+var (
+	errNoPendingResponse = errors.New("no response is awaiting confirmation")
+	errWrongCode         = errors.New("confirmation code is wrong")
+)
+
+// ConfirmPolicy holds a response given through the invitation's link, on
+// the page or over the API, until the invitee echoes back a code texted to
+// their phone, so that someone who merely saw the link can't answer for
+// them. Replies from the invitee's own phone or device need no code.
+type ConfirmPolicy struct {
+	WithinMin int `json:"within_min,omitempty"`
+}
+
+func (p *ConfirmPolicy) validate() error {
+	if p.WithinMin < 0 || p.WithinMin > maxConfirmWithinMin {
+		return badRequest("confirm.within_min must be between 1 and " + strconv.Itoa(maxConfirmWithinMin))
+	}
+	return nil
+}
+
+func (p *ConfirmPolicy) within() time.Duration {
+	if p.WithinMin == 0 {
+		return defaultConfirmWithinMin * time.Minute
+	}
+	return time.Duration(p.WithinMin) * time.Minute
+}
+
+// needsConfirmation reports whether a response to inv given via must wait
+// for a code.
+func needsConfirmation(inv Invitation, via string) bool {
+	return inv.Confirm != nil && (via == viaHTTP || via == viaGRPC || via == viaWeb)
+}
+
+// PendingResponse is a response waiting for its confirmation code. Only a
+// digest of the code is kept.
+type PendingResponse struct {
+	Response   string            `json:"response"`
+	Note       string            `json:"note,omitempty"`
+	GuestCount int               `json:"guest_count,omitempty"`
+	Answers    map[string]string `json:"answers,omitempty"`
+	Via        string            `json:"via"`
+	CodeHash   string            `json:"code_hash"`
+	ExpiresAt  time.Time         `json:"expires_at"`
+	Attempts   int               `json:"attempts,omitempty"`
+}
+
+func newConfirmationCode() string {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		panic(err)
+	}
+	return fmt.Sprintf("%06d", n)
+}
+
+func confirmationHash(id, code string) string { return sha256Hex(id + "\x00" + code) }
+
+// holdResponse sets in aside on inv until it is confirmed, returning the
+// code to text the invitee.
+func (s *Server) holdResponse(inv *Invitation, in responseInput) string {
+	code := newConfirmationCode()
+	inv.PendingResponse = &PendingResponse{
+		Response:   in.Response,
+		Note:       in.Note,
+		GuestCount: in.GuestCount,
+		Answers:    in.Answers,
+		Via:        in.Via,
+		CodeHash:   confirmationHash(inv.ID, code),
+		ExpiresAt:  s.now().Add(inv.Confirm.within()).UTC(),
+	}
+	return code
+}
+
+// sendConfirmationCode texts code to inv's invitee, whatever channels the
+// invitation itself went out on.
+func (s *Server) sendConfirmationCode(ctx context.Context, inv Invitation, code string) {
+	s.appendEvent(ctx, inv.ID, InvitationEvent{Type: historyConfirmationSent, Actor: "invitee", Response: inv.PendingResponse.Response, Via: inv.PendingResponse.Via})
+	inv.Channels = []string{channelSMS}
+	mins := int(inv.Confirm.within() / time.Minute)
+	s.notifyInvitee(ctx, inv, localize(inv.Locale, "confirm_code", code, mins))
+}
+
+// confirmResponse records the response held on invitation id once code
+// matches, whichever way it was given. The token is checked as for
+// responseInput, for a code sent over via. Each wrong code counts against
+// the response, and after maxConfirmAttempts it is dropped, to be given
+// again for a new code.
+func (s *Server) confirmResponse(ctx context.Context, id, token, code, via string) (Invitation, error) {
+	if via == viaHTTP || via == viaGRPC {
+		if err := s.expiredLink(token); err != nil {
+			return Invitation{}, err
+		}
+	}
+	var held PendingResponse
+	wrong := false
+	_, err := s.store.Update(ctx, id, func(inv *Invitation) error {
+		wrong = false
+		p := inv.PendingResponse
+		if p == nil || s.now().After(p.ExpiresAt) {
+			return errNoPendingResponse
+		}
+		if via == viaHTTP || via == viaGRPC {
+			if err := s.checkResponseToken(*inv, token); err != nil {
+				return err
+			}
+		}
+		want := []byte(p.CodeHash)
+		if subtle.ConstantTimeCompare([]byte(confirmationHash(inv.ID, strings.TrimSpace(code))), want) != 1 {
+			wrong = true
+			if p.Attempts+1 >= maxConfirmAttempts {
+				inv.PendingResponse = nil
+				return nil
+			}
+			next := *p
+			next.Attempts++
+			inv.PendingResponse = &next
+			return nil
+		}
+		held = *p
+		inv.PendingResponse = nil
+		return nil
+	})
+	if err != nil {
+		return Invitation{}, err
+	}
+	if wrong {
+		return Invitation{}, errWrongCode
+	}
+	return s.recordResponse(ctx, id, responseInput{
+		Response: held.Response, Note: held.Note, GuestCount: held.GuestCount,
+		Answers: held.Answers, Via: held.Via, Confirmed: true,
+	})
+}
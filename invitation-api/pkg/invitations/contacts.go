@@ -0,0 +1,201 @@
+package invitations
+
+import (
+	"context"
+	"net/http"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+)
+
+const contactKind = "contact"
+
+// contact is a named recipient in the tenant's address book. Invitations
+// can be addressed to one by contact_id, or bulk-sent to every contact with
+// a tag, and then carry the contact's name.
+type contact struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	PhoneNumber  string    `json:"phone_number,omitempty"`
+	Email        string    `json:"email,omitempty"`
+	Tags         []string  `json:"tags,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	CreatedByKey string    `json:"created_by_key,omitempty"`
+}
+
+type contactRequest struct {
+	Name        string   `json:"name"`
+	PhoneNumber string   `json:"phone_number"`
+	Email       string   `json:"email"`
+	Tags        []string `json:"tags"`
+}
+
+// applyContact validates req and sets its fields on c, normalizing the phone
+// number and tags.
+func (s *Server) applyContact(c *contact, req contactRequest) error {
+	c.Name = strings.TrimSpace(req.Name)
+	if c.Name == "" {
+		return badRequest("name is required")
+	}
+	if req.PhoneNumber == "" && req.Email == "" {
+		return badRequest("phone_number or email is required")
+	}
+	c.PhoneNumber = ""
+	if req.PhoneNumber != "" {
+		phone, err := normalizePhone(req.PhoneNumber, s.cfg.DefaultCountry)
+		if err != nil {
+			return phoneError(err)
+		}
+		c.PhoneNumber = phone
+	}
+	c.Email = req.Email
+	if req.Email != "" {
+		if _, err := mail.ParseAddress(req.Email); err != nil {
+			return badRequest("email is not a valid address")
+		}
+	}
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		return err
+	}
+	c.Tags = tags
+	return nil
+}
+
+// resolveContact fills in the recipient of req from req.ContactID. An
+// explicit phone number or email on the request wins over the contact's.
+func (s *Server) resolveContact(ctx context.Context, req *CreateInvitationRequest) error {
+	if req.ContactID == "" {
+		return nil
+	}
+	c, err := getRecord[contact](ctx, s.store, contactKind, req.ContactID)
+	if err == errNotFound {
+		return &requestError{status: http.StatusUnprocessableEntity, msg: "unknown contact_id"}
+	}
+	if err != nil {
+		return err
+	}
+	if req.PhoneNumber == "" {
+		req.PhoneNumber = c.PhoneNumber
+	}
+	if req.Email == "" {
+		req.Email = c.Email
+	}
+	if req.Email != "" && req.PhoneNumber == "" && len(req.Channels) == 0 {
+		req.Channels = []string{channelEmail}
+	}
+	req.contactName = c.Name
+	return nil
+}
+
+// taggedContacts lists the contacts with any of tags.
+func (s *Server) taggedContacts(ctx context.Context, tags []string) ([]contact, error) {
+	all, err := listRecords[contact](ctx, s.store, contactKind)
+	if err != nil {
+		return nil, err
+	}
+	var matched []contact
+	for _, c := range all {
+		if slices.ContainsFunc(tags, func(t string) bool { return slices.Contains(c.Tags, normalizeTag(t)) }) {
+			matched = append(matched, c)
+		}
+	}
+	return matched, nil
+}
+
+func (s *Server) handleCreateContact(w http.ResponseWriter, r *http.Request) {
+	var req contactRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	c := contact{ID: s.ids.NewID(), CreatedAt: s.now().UTC()}
+	if err := s.applyContact(&c, req); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if k, ok := apiKeyFrom(r.Context()); ok {
+		c.CreatedByKey = k.ID
+	}
+	if err := putRecord(r.Context(), s.store, contactKind, c.ID, c); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, c)
+}
+
+func (s *Server) getContact(w http.ResponseWriter, r *http.Request) (contact, bool) {
+	c, err := getRecord[contact](r.Context(), s.store, contactKind, r.PathValue("id"))
+	if err == errNotFound {
+		writeError(w, r, http.StatusNotFound, "contact not found")
+		return c, false
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return c, false
+	}
+	return c, true
+}
+
+func (s *Server) handleGetContact(w http.ResponseWriter, r *http.Request) {
+	if c, ok := s.getContact(w, r); ok {
+		writeJSON(w, http.StatusOK, c)
+	}
+}
+
+// handleListContacts lists the address book, or with ?tag= the contacts
+// carrying that tag.
+func (s *Server) handleListContacts(w http.ResponseWriter, r *http.Request) {
+	var contacts []contact
+	var err error
+	if tag := r.URL.Query().Get("tag"); tag != "" {
+		contacts, err = s.taggedContacts(r.Context(), []string{tag})
+	} else {
+		contacts, err = listRecords[contact](r.Context(), s.store, contactKind)
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if contacts == nil {
+		contacts = []contact{}
+	}
+	writeJSON(w, http.StatusOK, contacts)
+}
+
+// handleUpdateContact replaces a contact's details. Invitations already
+// sent keep the name they were sent with.
+func (s *Server) handleUpdateContact(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.getContact(w, r)
+	if !ok {
+		return
+	}
+	var req contactRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if err := s.applyContact(&c, req); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if err := putRecord(r.Context(), s.store, contactKind, c.ID, c); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+func (s *Server) handleDeleteContact(w http.ResponseWriter, r *http.Request) {
+	err := s.store.DeleteRecord(r.Context(), contactKind, r.PathValue("id"))
+	if err == errNotFound {
+		writeError(w, r, http.StatusNotFound, "contact not found")
+		return
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
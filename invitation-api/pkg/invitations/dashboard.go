@@ -0,0 +1,136 @@
+package invitations
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	socketWriteTimeout = 10 * time.Second
+	socketMaxRead      = 4096
+)
+
+// socketMessage is one JSON text frame sent to a batch dashboard: "counts"
+// carries the batch's tallies, anything else is an invitation event.
+type socketMessage struct {
+	Type       string       `json:"type"`
+	ID         uint64       `json:"id,omitempty"`
+	BatchID    string       `json:"batch_id"`
+	Counts     *batchCounts `json:"counts,omitempty"`
+	Invitation *Invitation  `json:"invitation,omitempty"`
+}
+
+// queryToken lets browser clients, which can't set headers on a WebSocket
+// handshake, pass the API key as ?access_token= instead.
+func queryToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if t := r.URL.Query().Get("access_token"); t != "" && r.Header.Get("Authorization") == "" {
+			r.Header.Set("Authorization", "Bearer "+t)
+		}
+		next(w, r)
+	}
+}
+
+// handleBatchSocket serves a batch dashboard over a WebSocket: the current
+// counts on connect, then every invitation event in the batch followed by
+// the new counts whenever they change.
+func (s *Server) handleBatchSocket(w http.ResponseWriter, r *http.Request) {
+	b, err := getRecord[batch](r.Context(), s.store, batchKind, r.PathValue("id"))
+	if err == errNotFound {
+		writeError(w, r, http.StatusNotFound, "batch not found")
+		return
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	// Subscribe before listing so a change in between isn't lost.
+	tenant, _ := tenantFrom(r.Context())
+	events, cancel := s.live.subscribe(batchTopic(tenant, b.ID))
+	defer cancel()
+	invs, err := s.store.List(r.Context(), ListFilter{BatchID: b.ID})
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+
+	// Clients authenticate with an API key, not cookies, so there is no
+	// cross-site risk in skipping the default Origin check.
+	websocket.Server{Handler: func(conn *websocket.Conn) {
+		// The hijacked connection keeps any WriteTimeout deadline; pings
+		// notice dead clients instead.
+		_ = conn.SetDeadline(time.Time{})
+		s.serveBatchSocket(r.Context(), conn, b.ID, invs, events)
+	}}.ServeHTTP(w, r)
+}
+
+func (s *Server) serveBatchSocket(ctx context.Context, conn *websocket.Conn, batchID string, current []Invitation, events <-chan liveEvent) {
+	conn.MaxPayloadBytes = socketMaxRead
+	send := func(m socketMessage) error {
+		conn.SetWriteDeadline(time.Now().Add(socketWriteTimeout))
+		return websocket.JSON.Send(conn, m)
+	}
+
+	latest := make(map[string]Invitation, len(current))
+	for _, inv := range current {
+		latest[inv.ID] = inv.withStatus(s.now())
+	}
+	tally := func() batchCounts {
+		var c batchCounts
+		for _, inv := range latest {
+			c.add(inv)
+		}
+		return c
+	}
+	counts := tally()
+	if send(socketMessage{Type: "counts", BatchID: batchID, Counts: &counts}) != nil {
+		return
+	}
+
+	// Dashboards only listen, but reading is how a close from the client is
+	// noticed; pings are answered by the library as they are read.
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		var discard string
+		for websocket.Message.Receive(conn, &discard) == nil {
+		}
+	}()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-gone:
+			return
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			inv := e.Data.withStatus(s.now())
+			latest[inv.ID] = inv
+			if send(socketMessage{Type: e.Type, ID: e.ID, BatchID: batchID, Invitation: &inv}) != nil {
+				return
+			}
+			if c := tally(); c != counts {
+				counts = c
+				if send(socketMessage{Type: "counts", BatchID: batchID, Counts: &counts}) != nil {
+					return
+				}
+			}
+		case <-heartbeat.C:
+			// Write sends a frame of conn.PayloadType; messages above go
+			// through JSON.Send, which sets its own.
+			conn.PayloadType = websocket.PingFrame
+			conn.SetWriteDeadline(time.Now().Add(socketWriteTimeout))
+			if _, err := conn.Write(nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,471 @@
+package invitations
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sessionKind   = "session"
+	sessionCookie = "invit_session"
+
+	// dashboardRows caps the open invitations listed; the API has the rest.
+	dashboardRows = 200
+)
+
+// session is a dashboard login with an API key, or with the OIDC identity
+// provider. It is stored under a hash of the cookie's value, and its CSRF
+// token must accompany every form.
+type session struct {
+	KeyID     string        `json:"key_id,omitempty"`
+	OIDC      *oidcIdentity `json:"oidc,omitempty"`
+	CSRF      string        `json:"csrf"`
+	ExpiresAt time.Time     `json:"expires_at"`
+}
+
+type sessionContextKey struct{}
+
+// requireSession authenticates the dashboard by session cookie, or, for
+// scripts, by bearer API key as requireAPIKey does. Browsers without a
+// session are sent to log in.
+func (s *Server) requireSession(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := bearerToken(r); ok || !s.cfg.RequireAPIKey {
+			s.requireAPIKey(next)(w, r)
+			return
+		}
+		sess, k, ok := s.lookupSession(r)
+		if !ok {
+			http.Redirect(w, r, "/dashboard/login", http.StatusSeeOther)
+			return
+		}
+		s.serveAs(w, r.WithContext(context.WithValue(r.Context(), sessionContextKey{}, sess)), k, next)
+	}
+}
+
+func (s *Server) lookupSession(r *http.Request) (session, apiKey, bool) {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return session{}, apiKey{}, false
+	}
+	id := hashSecret(c.Value)
+	sess, err := getRecord[session](r.Context(), s.store, sessionKind, id)
+	if err != nil {
+		return session{}, apiKey{}, false
+	}
+	if !s.now().Before(sess.ExpiresAt) {
+		if err := s.store.DeleteRecord(r.Context(), sessionKind, id); err != nil && err != errNotFound {
+			slog.WarnContext(r.Context(), "failed to delete expired session", "err", err)
+		}
+		return session{}, apiKey{}, false
+	}
+	if sess.OIDC != nil {
+		// Mapped afresh, so that removing the user ends their sessions.
+		k, err := s.oidcKey(r.Context(), *sess.OIDC)
+		return sess, k, err == nil
+	}
+	// A revoked key ends its sessions.
+	k, err := getRecord[apiKey](r.Context(), s.store, apiKeyKind, sess.KeyID)
+	if err != nil || !k.RevokedAt.IsZero() {
+		return session{}, apiKey{}, false
+	}
+	return sess, k, true
+}
+
+// startSession stores sess and sets its cookie, reporting whether it could.
+func (s *Server) startSession(w http.ResponseWriter, r *http.Request, sess session) bool {
+	token := randomHex(24)
+	if err := putRecord(r.Context(), s.store, sessionKind, hashSecret(token), sess); err != nil {
+		slog.ErrorContext(r.Context(), "failed to store session", "err", err)
+		http.Error(w, "Something went wrong. Please try again later.", http.StatusInternalServerError)
+		return false
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name: sessionCookie, Value: token, Path: "/dashboard", Expires: sess.ExpiresAt,
+		HttpOnly: true, Secure: s.secureCookies(r), SameSite: http.SameSiteStrictMode,
+	})
+	return true
+}
+
+// validCSRF reports whether a form post carries its session's token.
+// Callers with a bearer key have no session, and no cookie to be forged.
+func validCSRF(r *http.Request) bool {
+	sess, ok := r.Context().Value(sessionContextKey{}).(session)
+	return !ok || subtle.ConstantTimeCompare([]byte(r.PostFormValue("csrf")), []byte(sess.CSRF)) == 1
+}
+
+func (s *Server) secureCookies(r *http.Request) bool {
+	return r.TLS != nil || strings.HasPrefix(s.cfg.PublicURL, "https://")
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Log in</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 24rem; margin: 4rem auto; padding: 0 1rem; }
+input { width: 100%; box-sizing: border-box; font-size: 1rem; padding: .4rem; }
+button { font-size: 1rem; padding: .5rem 1rem; margin-top: .75rem; }
+.notice { padding: .75rem; background: #f3f3f3; border-radius: .25rem; }
+</style>
+</head>
+<body>
+<h1>Invitations</h1>
+{{if .Notice}}<p class="notice">{{.Notice}}</p>{{end}}
+{{if .SSO}}<p><a href="/dashboard/login/oidc">Sign in with single sign-on</a></p>
+<p>Or use an API key:</p>
+{{end}}<form method="post">
+<p><label for="api_key">API key</label><br>
+<input type="password" id="api_key" name="api_key" autocomplete="current-password" required></p>
+<button type="submit">Log in</button>
+</form>
+</body>
+</html>
+`))
+
+// handleDashboardLogin serves the login form and, on post, swaps a valid
+// API key for a session cookie.
+func (s *Server) handleDashboardLogin(w http.ResponseWriter, r *http.Request) {
+	if !s.cfg.RequireAPIKey {
+		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+		return
+	}
+	status, notice := http.StatusOK, ""
+	if r.Method == http.MethodPost {
+		k, ok := s.lookupAPIKey(r.Context(), strings.TrimSpace(r.PostFormValue("api_key")))
+		if ok {
+			sess := session{KeyID: k.ID, CSRF: randomHex(16), ExpiresAt: s.now().Add(s.cfg.SessionTTL).UTC()}
+			if !s.startSession(w, r, sess) {
+				return
+			}
+			slog.InfoContext(r.Context(), "dashboard login", "api_key_id", k.ID, "remote", remoteHost(r))
+			http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+			return
+		}
+		status, notice = http.StatusUnauthorized, "That API key isn't valid."
+	}
+	s.renderLogin(w, r, status, notice)
+}
+
+func (s *Server) renderLogin(w http.ResponseWriter, r *http.Request, status int, notice string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	data := struct {
+		Notice string
+		SSO    bool
+	}{notice, s.oidc != nil}
+	if err := loginPage.Execute(w, data); err != nil {
+		slog.ErrorContext(r.Context(), "failed to render login page", "err", err)
+	}
+}
+
+// handleDashboardLogout ends the session. It checks the session itself, as
+// requireSession would refuse viewers a post.
+func (s *Server) handleDashboardLogout(w http.ResponseWriter, r *http.Request) {
+	if sess, _, ok := s.lookupSession(r); ok {
+		if subtle.ConstantTimeCompare([]byte(r.PostFormValue("csrf")), []byte(sess.CSRF)) != 1 {
+			http.Error(w, "This form has expired. Reload the page and try again.", http.StatusForbidden)
+			return
+		}
+		c, _ := r.Cookie(sessionCookie)
+		if err := s.store.DeleteRecord(r.Context(), sessionKind, hashSecret(c.Value)); err != nil && err != errNotFound {
+			slog.WarnContext(r.Context(), "failed to delete session", "err", err)
+		}
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/dashboard", MaxAge: -1, HttpOnly: true, Secure: s.secureCookies(r), SameSite: http.SameSiteStrictMode})
+	http.Redirect(w, r, "/dashboard/login", http.StatusSeeOther)
+}
+
+var dashboardPage = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Invitations</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 72rem; margin: 2rem auto; padding: 0 1rem; }
+header { display: flex; justify-content: space-between; align-items: center; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 1.5rem; }
+th, td { text-align: left; padding: .4rem .5rem; border-bottom: 1px solid #ddd; vertical-align: top; }
+td.n { text-align: right; }
+form.inline { display: inline; }
+small { color: #666; }
+.notice { padding: .75rem; background: #f3f3f3; border-radius: .25rem; }
+</style>
+</head>
+<body>
+<header>
+<h1>Invitations</h1>
+{{if .CSRF}}<form method="post" action="/dashboard/logout"><input type="hidden" name="csrf" value="{{.CSRF}}"><button type="submit">Log out</button></form>{{end}}
+</header>
+<div id="live">
+{{if .Notice}}<p class="notice">{{.Notice}}</p>{{end}}
+<h2>Events</h2>
+{{if .Events}}<table>
+<tr><th>Event</th><th>Yes</th><th>No</th><th>Other</th><th>Waitlisted</th><th>Pending</th><th>No response</th><th>Guests</th></tr>
+{{range .Events}}<tr><td>{{.Name}}</td><td class="n">{{.Counts.Accepted}}</td><td class="n">{{.Counts.Declined}}</td><td class="n">{{.Counts.Responded}}</td><td class="n">{{.Counts.Waitlisted}}</td><td class="n">{{.Counts.Pending}}</td><td class="n">{{.Counts.Expired}}</td><td class="n">{{.Counts.Guests}}</td></tr>
+{{end}}</table>
+{{else}}<p>No events have open invitations.</p>
+{{end}}
+<h2>Open invitations</h2>
+<p>{{.Pending}} awaiting a response, {{.Scheduled}} not sent yet.</p>
+{{if .Invitations}}<table>
+<tr><th>Invitee</th><th>Message</th><th>Status</th><th>Deadline</th><th>Delivery</th><th></th></tr>
+{{range .Invitations}}<tr>
+<td>{{.Invitee}}{{if .Test}} <small>test</small>{{end}}</td>
+<td>{{.Message}}</td>
+<td>{{.Status}}</td>
+<td>{{.Deadline}}</td>
+<td>{{range .Delivery}}{{.}}<br>{{end}}</td>
+<td>{{if $.CanChange}}
+{{if or (eq .Status "pending") (eq .Status "viewed")}}<form class="inline" method="post" action="/dashboard/invitations/{{.ID}}/extend">
+<input type="hidden" name="csrf" value="{{$.CSRF}}"><input type="hidden" name="version" value="{{.Version}}">
+<select name="minutes" aria-label="Extend by"><option value="15">15 min</option><option value="60" selected>1 hour</option><option value="1440">1 day</option></select>
+<button type="submit">Extend</button></form>
+<form class="inline" method="post" action="/dashboard/invitations/{{.ID}}/resend">
+<input type="hidden" name="csrf" value="{{$.CSRF}}"><input type="hidden" name="version" value="{{.Version}}">
+<button type="submit">Resend</button></form>
+{{end}}<form class="inline" method="post" action="/dashboard/invitations/{{.ID}}/cancel">
+<input type="hidden" name="csrf" value="{{$.CSRF}}"><input type="hidden" name="version" value="{{.Version}}">
+<label><input type="checkbox" name="notify" value="true"> tell them</label>
+<button type="submit">Cancel</button></form>
+{{end}}</td>
+</tr>
+{{end}}</table>
+{{if .More}}<p>And {{.More}} more, by deadline; the API lists them all.</p>{{end}}
+{{end}}
+</div>
+<script>
+(function () {
+  // Reload the live part of the page whenever an invitation changes.
+  var es = new EventSource("/dashboard/stream"), timer;
+  function refresh() {
+    clearTimeout(timer);
+    timer = setTimeout(function () {
+      fetch("/dashboard", { credentials: "same-origin" }).then(function (r) {
+        if (r.ok && !r.redirected) return r.text();
+      }).then(function (html) {
+        if (!html) return;
+        var doc = new DOMParser().parseFromString(html, "text/html");
+        document.getElementById("live").innerHTML = doc.getElementById("live").innerHTML;
+      });
+    }, 500);
+  }
+  {{range .EventTypes}}es.addEventListener({{.}}, refresh);
+  {{end}}
+}());
+</script>
+</body>
+</html>
+`))
+
+type dashboardData struct {
+	CSRF        string
+	Notice      string
+	Events      []dashboardEvent
+	Invitations []dashboardInvitation
+	More        int
+	CanChange   bool
+	Pending     int
+	Scheduled   int
+	EventTypes  []string
+}
+
+type dashboardEvent struct {
+	Name   string
+	Counts batchCounts
+}
+
+type dashboardInvitation struct {
+	ID, Invitee, Message, Status, Deadline string
+	Version                                string
+	Delivery                               []string
+	Test                                   bool
+}
+
+// dashboardDone are the notices shown after a successful action, by the
+// done parameter it redirects with.
+var dashboardDone = map[string]string{
+	"extend": "The deadline has been extended.",
+	"resend": "The invitation has been sent again.",
+	"cancel": "The invitation has been cancelled.",
+}
+
+// handleDashboard shows the caller's open invitations and the running
+// counts of the events they belong to.
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	s.renderDashboard(w, r, http.StatusOK, dashboardDone[r.URL.Query().Get("done")])
+}
+
+func (s *Server) renderDashboard(w http.ResponseWriter, r *http.Request, status int, notice string) {
+	data, err := s.dashboard(r.Context())
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to load dashboard", "err", err)
+		http.Error(w, "Something went wrong. Please try again later.", http.StatusInternalServerError)
+		return
+	}
+	data.Notice = notice
+	if sess, ok := r.Context().Value(sessionContextKey{}).(session); ok {
+		data.CSRF = sess.CSRF
+	}
+	data.CanChange = roleAtLeast(roleFrom(r.Context()), roleOrganizer)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := dashboardPage.Execute(w, data); err != nil {
+		slog.ErrorContext(r.Context(), "failed to render dashboard", "err", err)
+	}
+}
+
+func (s *Server) dashboard(ctx context.Context) (dashboardData, error) {
+	t := s.now()
+	data := dashboardData{EventTypes: append(slices.Clone(webhookEvents), eventDelivery)}
+	var open []Invitation
+	for _, st := range []string{statusPending, statusScheduled} {
+		invs, err := s.store.List(ctx, ListFilter{Status: st, AsOf: t})
+		if err != nil {
+			return data, err
+		}
+		open = append(open, invs...)
+	}
+	sort.SliceStable(open, func(i, j int) bool { return open[i].ExpiresAt.Before(open[j].ExpiresAt) })
+
+	batches := map[string]bool{}
+	for i, inv := range open {
+		inv = inv.withStatus(t)
+		if isPending(inv.Status) {
+			data.Pending++
+		} else {
+			data.Scheduled++
+		}
+		if inv.BatchID != "" {
+			batches[inv.BatchID] = true
+		}
+		if i >= dashboardRows {
+			data.More++
+			continue
+		}
+		row := dashboardInvitation{
+			ID: inv.ID, Invitee: inviteeName(inv), Message: inv.Message, Status: inv.Status,
+			Deadline: inv.ExpiresAt.In(s.cfg.Location()).Format("Mon Jan 2 15:04 MST"), Version: etag(inv), Test: inv.Test,
+		}
+		channels := make([]string, 0, len(inv.Delivery))
+		for ch := range inv.Delivery {
+			channels = append(channels, ch)
+		}
+		slices.Sort(channels)
+		for _, ch := range channels {
+			d := inv.Delivery[ch]
+			line := ch + " " + d.Status
+			if d.Error != "" {
+				line += ": " + d.Error
+			}
+			row.Delivery = append(row.Delivery, line)
+		}
+		data.Invitations = append(data.Invitations, row)
+	}
+
+	for id := range batches {
+		b, err := getRecord[batch](ctx, s.store, batchKind, id)
+		if err == errNotFound {
+			continue
+		}
+		if err != nil {
+			return data, err
+		}
+		invs, err := s.store.List(ctx, ListFilter{BatchID: id})
+		if err != nil {
+			return data, err
+		}
+		e := dashboardEvent{Name: b.Name}
+		if e.Name == "" {
+			e.Name = b.Message
+		}
+		for _, inv := range invs {
+			e.Counts.add(inv.withStatus(t))
+		}
+		data.Events = append(data.Events, e)
+	}
+	sort.Slice(data.Events, func(i, j int) bool { return data.Events[i].Name < data.Events[j].Name })
+	return data, nil
+}
+
+// handleDashboardAction extends, resends or cancels an invitation from the
+// dashboard, as of the version the page showed, and goes back to it.
+func (s *Server) handleDashboardAction(w http.ResponseWriter, r *http.Request) {
+	if !validCSRF(r) {
+		http.Error(w, "This form has expired. Reload the page and try again.", http.StatusForbidden)
+		return
+	}
+	ctx, id, action := r.Context(), r.PathValue("id"), r.PathValue("action")
+	var match ifMatch
+	if v := r.PostFormValue("version"); v != "" {
+		match = ifMatch{v}
+	}
+	var err error
+	switch action {
+	case "extend":
+		minutes, _ := strconv.Atoi(r.PostFormValue("minutes"))
+		if minutes <= 0 {
+			err = badRequest("choose how long to extend by")
+			break
+		}
+		notify := true
+		_, err = s.updateInvitation(ctx, id, updateInvitationRequest{ExtendMin: minutes, Notify: &notify}, match)
+	case "resend":
+		var inv Invitation
+		if inv, err = s.getInvitation(ctx, id); err == nil {
+			if err = match.check(inv); err == nil {
+				_, err = s.resendInvitation(ctx, id)
+			}
+		}
+	case "cancel":
+		_, err = s.cancelInvitation(ctx, id, r.PostFormValue("notify") == "true", match)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		status, notice := dashboardError(err)
+		if status == http.StatusInternalServerError {
+			slog.ErrorContext(ctx, "dashboard action failed", "action", action, "invitation_id", id, "err", err)
+		}
+		s.renderDashboard(w, r, status, notice)
+		return
+	}
+	http.Redirect(w, r, "/dashboard?done="+action, http.StatusSeeOther)
+}
+
+// dashboardError is the status and notice for a failed action.
+func dashboardError(err error) (int, string) {
+	var re *requestError
+	switch {
+	case errors.As(err, &re):
+		return re.status, strings.ToUpper(re.msg[:1]) + re.msg[1:] + "."
+	case err == errPreconditionFailed:
+		return http.StatusPreconditionFailed, "The invitation changed since the page loaded; here it is as it stands now."
+	case err == errNotFound:
+		return http.StatusNotFound, "That invitation no longer exists."
+	case err == errExpired, err == errCancelled, err == errAlreadyCancelled, err == errLocked, err == errNotSent, err == errForwarded:
+		return http.StatusConflict, "That invitation is no longer open: " + err.Error() + "."
+	}
+	return http.StatusInternalServerError, "Something went wrong. Please try again later."
+}
+
+// handleDashboardStream streams the changes the dashboard refreshes on.
+func (s *Server) handleDashboardStream(w http.ResponseWriter, r *http.Request) {
+	t, _ := tenantFrom(r.Context())
+	s.stream(w, r, tenantTopic(t), nil)
+}
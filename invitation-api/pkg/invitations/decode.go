@@ -0,0 +1,100 @@
+package invitations
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// limitBody caps every request body at MaxBodyBytes. Reads past the limit
+// fail with *http.MaxBytesError, which bodyError turns into a 413.
+func (s *Server) limitBody(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, int64(s.cfg.MaxBodyBytes))
+		}
+		next(w, r)
+	}
+}
+
+// decodeJSON decodes a request body holding a single JSON value into v,
+// rejecting fields v doesn't have. Its errors are requestErrors ready for
+// writeResponseError.
+func decodeJSON(r *http.Request, v any) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return jsonError(err)
+	}
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		if err := bodyError(err); err != nil {
+			return err
+		}
+		return badRequest("request body must hold a single JSON value")
+	}
+	return nil
+}
+
+// jsonError describes a decoding failure: 422 naming the field for unknown
+// fields and values of the wrong type, and 400 for anything that isn't
+// JSON at all.
+func jsonError(err error) error {
+	if err := bodyError(err); err != nil {
+		return err
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return fieldError(codeInvalidType, typeErr.Field, typeErr.Field+" must be "+jsonKind(typeErr.Type))
+	}
+	if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		if n, err := strconv.Unquote(name); err == nil {
+			name = n
+		}
+		return fieldError(codeUnknownField, name, "unknown field "+strconv.Quote(name))
+	}
+	if err == io.EOF {
+		return badRequest("request body is required")
+	}
+	return &requestError{status: http.StatusBadRequest, code: codeInvalidJSON, msg: "invalid JSON"}
+}
+
+// bodyError reports a body that couldn't be read because it is over the
+// size limit, and is nil for any other error.
+func bodyError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return &requestError{status: http.StatusRequestEntityTooLarge, msg: fmt.Sprintf("request body must be at most %d bytes", tooLarge.Limit),
+			details: map[string]any{"limit_bytes": tooLarge.Limit}}
+	}
+	return nil
+}
+
+func fieldError(code, field, msg string) error {
+	return &requestError{status: http.StatusUnprocessableEntity, code: code, msg: msg, details: map[string]any{"field": field}}
+}
+
+func jsonKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	case reflect.Pointer:
+		return jsonKind(t.Elem())
+	}
+	return "a " + t.String()
+}
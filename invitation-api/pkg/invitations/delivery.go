@@ -0,0 +1,118 @@
+package invitations
+
+import (
+	"context"
+	"net/http"
+)
+
+const messageKind = "message"
+
+// messageRecord maps a provider message ID to the invitation it was sent
+// for, so status callbacks can find it.
+type messageRecord struct {
+	InvitationID string `json:"invitation_id"`
+}
+
+// deliveryRank orders statuses so that callbacks arriving out of order
+// never move a message backwards.
+func deliveryRank(status string) int {
+	switch status {
+	case deliveryQueued:
+		return 0
+	case deliverySent:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// twilioStatuses maps Twilio's MessageStatus values onto ours. Statuses
+// not listed, such as "read", don't change anything.
+var twilioStatuses = map[string]string{
+	"accepted":    deliveryQueued,
+	"scheduled":   deliveryQueued,
+	"queued":      deliveryQueued,
+	"sending":     deliverySent,
+	"sent":        deliverySent,
+	"delivered":   deliveryDelivered,
+	"undelivered": deliveryFailed,
+	"failed":      deliveryFailed,
+}
+
+// handleSMSStatus accepts Twilio's delivery status callbacks and updates
+// the message they describe.
+func (s *Server) handleSMSStatus(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid form body")
+		return
+	}
+	if !s.verifyTwilio(w, r) {
+		return
+	}
+	msgID := r.PostForm.Get("MessageSid")
+	status, ok := twilioStatuses[r.PostForm.Get("MessageStatus")]
+	if msgID == "" || !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	var reason string
+	if status == deliveryFailed {
+		reason = "provider reported " + r.PostForm.Get("MessageStatus")
+		if code := r.PostForm.Get("ErrorCode"); code != "" {
+			reason += " (error " + code + ")"
+		}
+	}
+
+	if err := s.advanceDelivery(r.Context(), msgID, status, reason); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// advanceDelivery applies a provider's status report for its message msgID
+// to whichever invitation the message was sent for. Reports for messages
+// that aren't ours are ignored.
+func (s *Server) advanceDelivery(ctx context.Context, msgID, status, reason string) error {
+	rec, err := getRecord[messageRecord](ctx, s.store, messageKind, msgID)
+	if err == errNotFound {
+		// Not one of ours, or sent before tracking began.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var advanced []DeliveryStatus
+	inv, err := s.store.Update(ctx, rec.InvitationID, func(inv *Invitation) error {
+		advanced = nil
+		advance := func(m *DeliveryStatus) bool {
+			if m.MessageID != msgID || deliveryRank(status) <= deliveryRank(m.Status) {
+				return false
+			}
+			m.Status, m.Error, m.UpdatedAt = status, reason, s.now().UTC()
+			return true
+		}
+		for i := range inv.Messages {
+			if advance(&inv.Messages[i]) {
+				advanced = append(advanced, inv.Messages[i])
+			}
+		}
+		// Older invitations record the invite only in Delivery.
+		for ch, m := range inv.Delivery {
+			if advance(&m) {
+				advanced = append(advanced, m)
+			}
+			inv.Delivery[ch] = m
+		}
+		if len(advanced) == 0 {
+			return errSkip
+		}
+		return nil
+	})
+	if err == nil {
+		s.record(ctx, inv, deliveryEvent(advanced...))
+	} else if err != errSkip && err != errNotFound {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package invitations
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// checkDestination refuses phone, in E.164, when it is outside the
+// allowed_countries or starts with one of the blocked_prefixes.
+func (s *Server) checkDestination(phone string) error {
+	for _, p := range s.cfg.BlockedPrefixes {
+		if p = strings.TrimSpace(p); strings.HasPrefix(phone, p) {
+			return &requestError{status: http.StatusForbidden, code: codeDestinationBlocked, msg: "phone_number starts with the blocked prefix " + p,
+				details: map[string]any{"field": "phone_number", "prefix": p}}
+		}
+	}
+	if len(s.cfg.AllowedCountries) == 0 {
+		return nil
+	}
+	country := phoneCountry(phone)
+	if !slices.ContainsFunc(s.cfg.AllowedCountries, func(c string) bool { return strings.EqualFold(strings.TrimSpace(c), country) }) {
+		e := &requestError{status: http.StatusForbidden, code: codeDestinationBlocked, msg: "phone_number is in a country invitations may not be sent to",
+			details: map[string]any{"field": "phone_number"}}
+		if country != "" {
+			e.msg = "phone_number is in " + country + ", which invitations may not be sent to"
+			e.details["country"] = country
+		}
+		return e
+	}
+	return nil
+}
+
+// senderIDs maps the countries of sms_sender_ids entries, each
+// "<country>:<sender>", to the number or alphanumeric ID texts to that
+// country are sent from.
+func senderIDs(entries []string) map[string]string {
+	m := make(map[string]string, len(entries))
+	for _, e := range entries {
+		country, sender, _ := strings.Cut(strings.TrimSpace(e), ":")
+		m[strings.ToUpper(country)] = sender
+	}
+	return m
+}
@@ -0,0 +1,287 @@
+package invitations
+
+import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const deviceKind = "device"
+
+// device is an install of the companion app. Invitee devices can be sent
+// invitations on the push channel and answer them through the /app
+// endpoints; host devices are pushed each response to invitations created
+// with the API key that registered them. Like API keys, devices are stored
+// with only a hash of their secret, and the app authenticates with
+// "dk_<id>.<secret>".
+type device struct {
+	ID           string    `json:"id"`
+	Platform     string    `json:"platform"`
+	Token        string    `json:"token"`
+	Host         bool      `json:"host,omitempty"`
+	Name         string    `json:"name,omitempty"`
+	SecretHash   string    `json:"secret_hash,omitempty"`
+	CreatedByKey string    `json:"created_by_key,omitempty"`
+	TenantID     string    `json:"tenant_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at,omitempty"`
+}
+
+type deviceContextKey struct{}
+
+func deviceFrom(ctx context.Context) device {
+	d, _ := ctx.Value(deviceContextKey{}).(device)
+	return d
+}
+
+// ownsDevice reports whether the caller in ctx may manage d.
+func ownsDevice(ctx context.Context, d device) bool {
+	t, ok := tenantFrom(ctx)
+	return !ok || d.TenantID == t
+}
+
+func (s *Server) lookupDevice(ctx context.Context, token string) (device, bool) {
+	rest, ok := strings.CutPrefix(token, "dk_")
+	if !ok {
+		return device{}, false
+	}
+	id, secret, ok := strings.Cut(rest, ".")
+	if !ok {
+		return device{}, false
+	}
+	d, err := getRecord[device](ctx, s.store, deviceKind, id)
+	if err != nil {
+		return device{}, false
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(d.SecretHash)) != 1 {
+		return device{}, false
+	}
+	return d, true
+}
+
+// requireDevice authenticates the companion app's endpoints by device key.
+func (s *Server) requireDevice(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r)
+		if !ok {
+			writeError(w, r, http.StatusUnauthorized, "missing bearer device key")
+			return
+		}
+		d, ok := s.lookupDevice(r.Context(), token)
+		if !ok {
+			writeError(w, r, http.StatusUnauthorized, "invalid device key")
+			return
+		}
+		ctx := context.WithValue(r.Context(), deviceContextKey{}, d)
+		next(w, r.WithContext(withActor(ctx, "device:"+d.ID)))
+	}
+}
+
+// checkInviteeDevice checks that id names an invitee device of the caller's
+// tenant, for an invitation on the push channel.
+func (s *Server) checkInviteeDevice(ctx context.Context, id string) error {
+	if id == "" {
+		return badRequest("device_id is required for the push channel")
+	}
+	d, err := getRecord[device](ctx, s.store, deviceKind, id)
+	if err == errNotFound || err == nil && (!ownsDevice(ctx, d) || d.Host) {
+		return &requestError{status: http.StatusUnprocessableEntity, msg: "unknown device_id"}
+	}
+	return err
+}
+
+func validPlatform(p string) bool { return p == platformFCM || p == platformAPNs }
+
+func (s *Server) handleRegisterDevice(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Platform string `json:"platform"`
+		Token    string `json:"token"`
+		Host     bool   `json:"host"`
+		Name     string `json:"name"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if !validPlatform(req.Platform) {
+		writeError(w, r, http.StatusBadRequest, "platform must be fcm or apns")
+		return
+	}
+	if strings.TrimSpace(req.Token) == "" {
+		writeError(w, r, http.StatusBadRequest, "token is required")
+		return
+	}
+
+	secret := randomHex(24)
+	d := device{
+		ID: randomHex(8), Platform: req.Platform, Token: strings.TrimSpace(req.Token), Host: req.Host,
+		Name: strings.TrimSpace(req.Name), SecretHash: hashSecret(secret), CreatedAt: s.now().UTC(),
+	}
+	if k, ok := apiKeyFrom(r.Context()); ok {
+		d.CreatedByKey = k.ID
+	}
+	d.TenantID, _ = tenantFrom(r.Context())
+	if err := putRecord(r.Context(), s.store, deviceKind, d.ID, d); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	d.SecretHash = ""
+	writeJSON(w, http.StatusCreated, struct {
+		device
+		Key string `json:"key"`
+	}{d, "dk_" + d.ID + "." + secret})
+}
+
+func (s *Server) handleListDevices(w http.ResponseWriter, r *http.Request) {
+	all, err := listRecords[device](r.Context(), s.store, deviceKind)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	devices := []device{}
+	for _, d := range all {
+		if ownsDevice(r.Context(), d) {
+			d.SecretHash = ""
+			devices = append(devices, d)
+		}
+	}
+	writeJSON(w, http.StatusOK, devices)
+}
+
+func (s *Server) handleDeleteDevice(w http.ResponseWriter, r *http.Request) {
+	d, err := getRecord[device](r.Context(), s.store, deviceKind, r.PathValue("id"))
+	if err == errNotFound || err == nil && !ownsDevice(r.Context(), d) {
+		writeError(w, r, http.StatusNotFound, "device not found")
+		return
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if err := s.store.DeleteRecord(r.Context(), deviceKind, d.ID); err != nil && err != errNotFound {
+		writeResponseError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleUpdateAppDevice lets the app replace its push token, which the
+// platforms rotate from time to time.
+func (s *Server) handleUpdateAppDevice(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if strings.TrimSpace(req.Token) == "" {
+		writeError(w, r, http.StatusBadRequest, "token is required")
+		return
+	}
+	d := deviceFrom(r.Context())
+	d.Token, d.UpdatedAt = strings.TrimSpace(req.Token), s.now().UTC()
+	if err := putRecord(r.Context(), s.store, deviceKind, d.ID, d); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	d.SecretHash = ""
+	writeJSON(w, http.StatusOK, d)
+}
+
+// appInvitation loads invitation id for the device in ctx: one sent to it,
+// or, for a host device, one created with the key that registered it.
+// Anything else reads as not found.
+func (s *Server) appInvitation(ctx context.Context, id string) (Invitation, error) {
+	d := deviceFrom(ctx)
+	inv, err := s.getInvitation(ctx, id)
+	if err != nil {
+		return Invitation{}, err
+	}
+	if inv.TenantID != d.TenantID {
+		return Invitation{}, errNotFound
+	}
+	if d.Host && inv.CreatedByKey != d.CreatedByKey || !d.Host && inv.DeviceID != d.ID {
+		return Invitation{}, errNotFound
+	}
+	return inv, nil
+}
+
+func (s *Server) handleAppGetInvitation(w http.ResponseWriter, r *http.Request) {
+	inv, err := s.appInvitation(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if !deviceFrom(r.Context()).Host {
+		inv.Tags, inv.Notes = nil, ""
+	}
+	writeJSON(w, http.StatusOK, inv)
+}
+
+func (s *Server) handleAppRespond(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Response   string            `json:"response"`
+		Note       string            `json:"note"`
+		GuestCount int               `json:"guest_count"`
+		Answers    map[string]string `json:"answers"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	inv, err := s.appInvitation(r.Context(), r.PathValue("id"))
+	if err == nil && deviceFrom(r.Context()).Host {
+		err = errNotFound
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	in := responseInput{Response: req.Response, Note: req.Note, GuestCount: req.GuestCount, Answers: req.Answers, Via: viaApp}
+	if inv, err = s.respondToInvitation(r.Context(), inv.ID, in); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Invitation
+		Confirmation string `json:"confirmation"`
+	}{inv.withStatus(s.now()), s.confirmationMessage(inv)})
+}
+
+// pushHosts tells the host devices behind inv's API key about its new
+// response. Pushes go out in the background, tracked with webhook
+// deliveries so shutdown waits for them too.
+func (s *Server) pushHosts(ctx context.Context, inv Invitation) {
+	p, ok := s.notifiers[channelPush].(pushNotifier)
+	if !ok || inv.Test {
+		return
+	}
+	all, err := listRecords[device](ctx, s.store, deviceKind)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to load host devices", "invitation_id", inv.ID, "err", err)
+		return
+	}
+	locale := s.hostLocale(ctx, inv)
+	n := pushNotification{
+		Title: localize(locale, "push_title"),
+		Body:  localize(locale, "host_responded", inviteeName(inv), responseLabel(locale, inv.Response), inv.Message),
+		Data:  map[string]string{"invitation_id": inv.ID, "status": inv.withStatus(s.now()).Status},
+	}
+	ctx = context.WithoutCancel(ctx)
+	for _, d := range all {
+		if !d.Host || d.CreatedByKey != inv.CreatedByKey || d.TenantID != inv.TenantID {
+			continue
+		}
+		s.webhookWG.Add(1)
+		go func(d device) {
+			defer s.webhookWG.Done()
+			if _, err := p.senders[d.Platform].push(ctx, d.Token, n); err != nil {
+				slog.WarnContext(ctx, "failed to push response to host", "invitation_id", inv.ID, "device_id", d.ID, "err", err)
+			}
+		}(d)
+	}
+}
@@ -0,0 +1,215 @@
+package invitations
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	eventDigest   = "batch.digest"
+	digestWebhook = "webhook"
+)
+
+// digestPolicy sends the host of a batch a tally of its responses while any
+// of its invitations is pending: every EveryMin minutes, BeforeDeadlineMin
+// minutes before the last pending one expires, and as the share answered
+// reaches each of AtResponsePct. Digests go to the one address of the
+// batch's notify settings that Channel names, by default the first of
+// phone, email and webhook_url it has.
+type digestPolicy struct {
+	EveryMin          int    `json:"every_min,omitempty"`
+	BeforeDeadlineMin []int  `json:"before_deadline_min,omitempty"`
+	AtResponsePct     []int  `json:"at_response_pct,omitempty"`
+	Channel           string `json:"channel,omitempty"`
+}
+
+func (p *digestPolicy) validate(n *HostNotify) error {
+	if p.EveryMin == 0 && len(p.BeforeDeadlineMin) == 0 && len(p.AtResponsePct) == 0 {
+		return badRequest("digest needs every_min, before_deadline_min or at_response_pct")
+	}
+	if p.EveryMin < 0 {
+		return badRequest("digest.every_min must be a positive number of minutes")
+	}
+	for _, m := range p.BeforeDeadlineMin {
+		if m <= 0 {
+			return badRequest("digest.before_deadline_min must be positive numbers of minutes")
+		}
+	}
+	for _, pct := range p.AtResponsePct {
+		if pct < 1 || pct > 100 {
+			return badRequest("digest.at_response_pct must be between 1 and 100")
+		}
+	}
+	if n == nil {
+		return badRequest("digest needs notify to say where to send it")
+	}
+	switch p.Channel {
+	case "", channelSMS, channelEmail, digestWebhook:
+	default:
+		return badRequest("digest.channel must be sms, email or webhook")
+	}
+	if to := p.to(*n); to.Phone == "" && to.Email == "" && to.WebhookURL == "" {
+		return badRequest("digest.channel needs the matching notify address")
+	}
+	return nil
+}
+
+// validateDigest checks a batch's digest settings, normalizing notify.
+func (s *Server) validateDigest(notify *HostNotify, digest *digestPolicy) error {
+	if notify != nil {
+		if err := notify.validate(s.cfg.DefaultCountry); err != nil {
+			return err
+		}
+	}
+	if digest != nil {
+		return digest.validate(notify)
+	}
+	return nil
+}
+
+// to narrows n to the address digests go to.
+func (p *digestPolicy) to(n HostNotify) HostNotify {
+	ch := p.Channel
+	if ch == "" {
+		switch {
+		case n.Phone != "":
+			ch = channelSMS
+		case n.Email != "":
+			ch = channelEmail
+		default:
+			ch = digestWebhook
+		}
+	}
+	switch ch {
+	case channelSMS:
+		return HostNotify{Phone: n.Phone}
+	case channelEmail:
+		return HostNotify{Email: n.Email}
+	}
+	return HostNotify{WebhookURL: n.WebhookURL}
+}
+
+// due returns the milestones of b reached by t and not yet sent, and
+// whether the interval has also come round.
+func (p *digestPolicy) due(b batch, c batchCounts, deadline, t time.Time) (reached []string, interval bool) {
+	last := b.CreatedAt
+	if !b.DigestedAt.IsZero() {
+		last = b.DigestedAt
+	}
+	interval = p.EveryMin > 0 && !t.Before(last.Add(time.Duration(p.EveryMin)*time.Minute))
+	for _, m := range p.BeforeDeadlineMin {
+		key := "before:" + strconv.Itoa(m)
+		if !slices.Contains(b.DigestMilestones, key) && !t.Before(deadline.Add(-time.Duration(m)*time.Minute)) {
+			reached = append(reached, key)
+		}
+	}
+	answered := c.Total - c.Pending - c.Scheduled
+	for _, pct := range p.AtResponsePct {
+		key := "pct:" + strconv.Itoa(pct)
+		if !slices.Contains(b.DigestMilestones, key) && answered*100 >= pct*c.Total {
+			reached = append(reached, key)
+		}
+	}
+	return reached, interval
+}
+
+// sendDueDigests sends the digests due by t for batches with pending
+// invitations.
+func (s *Server) sendDueDigests(ctx context.Context, t time.Time) error {
+	pending, err := s.store.List(ctx, ListFilter{Status: statusPending, AsOf: t, ExpiresAfter: t})
+	if err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for _, inv := range pending {
+		key := inv.TenantID + "|" + inv.BatchID
+		if inv.BatchID == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		if err := s.sendDigest(ctx, inv, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendDigest sends the batch of inv its digest if one is due. The batch is
+// locked as settleBatch locks it, since both write the batch record.
+func (s *Server) sendDigest(ctx context.Context, inv Invitation, t time.Time) error {
+	ctx = withTenant(ctx, inv.TenantID)
+	unlock, err := s.locks.lock(ctx, batchLockKey(inv.BatchID))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	b, err := getRecord[batch](ctx, s.store, batchKind, inv.BatchID)
+	if err == errNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if b.Digest == nil || b.Notify == nil {
+		return nil
+	}
+	invs, err := s.store.List(ctx, ListFilter{BatchID: b.ID})
+	if err != nil {
+		return err
+	}
+	var counts batchCounts
+	var deadline time.Time
+	for _, other := range invs {
+		other = other.withStatus(t)
+		counts.add(other)
+		if isPending(other.Status) && other.ExpiresAt.After(deadline) {
+			deadline = other.ExpiresAt
+		}
+	}
+	reached, interval := b.Digest.due(b, counts, deadline, t)
+	if len(reached) == 0 && !interval {
+		return nil
+	}
+	b.DigestedAt = t.UTC()
+	b.DigestMilestones = append(b.DigestMilestones, reached...)
+	if err := putRecord(ctx, s.store, batchKind, b.ID, b); err != nil {
+		return err
+	}
+
+	locale := s.hostLocale(ctx, inv)
+	name := b.Name
+	if name == "" {
+		name = localize(locale, "digest_name")
+	}
+	text := localize(locale, "digest", name, tallyText(locale, counts), untilText(locale, deadline.Sub(t)))
+	payload := webhookPayload{ID: randomHex(16), Type: eventDigest, CreatedAt: t.UTC(), Data: Invitation{TenantID: inv.TenantID}}
+	body, err := json.Marshal(struct {
+		ID        string    `json:"id"`
+		Type      string    `json:"type"`
+		CreatedAt time.Time `json:"created_at"`
+		Data      any       `json:"data"`
+	}{payload.ID, payload.Type, payload.CreatedAt, map[string]any{
+		"batch_id": b.ID, "name": b.Name, "counts": counts, "deadline": deadline.UTC(),
+	}})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to encode digest payload", "batch_id", b.ID, "err", err)
+		return nil
+	}
+	s.sendHost(ctx, b.Digest.to(*b.Notify), inv.ID, text, payload, body)
+	return nil
+}
+
+func untilText(locale string, d time.Duration) string {
+	switch m := int(d.Round(time.Minute) / time.Minute); {
+	case m < 90:
+		return countText(locale, "minutes", m)
+	case m < 48*60:
+		return countText(locale, "hours", (m+30)/60)
+	default:
+		return countText(locale, "days", (m+12*60)/(24*60))
+	}
+}
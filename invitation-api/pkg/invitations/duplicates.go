@@ -0,0 +1,62 @@
+package invitations
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// A tenant's Duplicates policy decides what happens to an invitation for a
+// phone number that already has an active invitation in the same batch.
+// The default allows it.
+const (
+	duplicatesAllow  = "allow"
+	duplicatesReject = "reject"
+	duplicatesMerge  = "merge"
+)
+
+// errMerged is returned, along with the existing invitation, by
+// newInvitation when the tenant merges duplicates and there was one.
+var errMerged = errors.New("merged into an existing invitation")
+
+func validateDuplicates(policy string) error {
+	switch policy {
+	case "", duplicatesAllow, duplicatesReject, duplicatesMerge:
+		return nil
+	}
+	return badRequest("duplicates must be allow, reject or merge")
+}
+
+// checkDuplicate looks for an active invitation to phone, which must be
+// normalized, in batchID, and rejects or returns it as the tenant's policy
+// says. allow skips the check.
+func (s *Server) checkDuplicate(ctx context.Context, phone, batchID string, allow bool) (Invitation, error) {
+	tenantID, _ := tenantFrom(ctx)
+	if allow || phone == "" || batchID == "" || tenantID == "" {
+		return Invitation{}, nil
+	}
+	t, err := getRecord[tenant](ctx, s.store, tenantKind, tenantID)
+	if err == errNotFound || (err == nil && (t.Duplicates == "" || t.Duplicates == duplicatesAllow)) {
+		return Invitation{}, nil
+	}
+	if err != nil {
+		return Invitation{}, err
+	}
+	invs, err := s.store.List(ctx, ListFilter{BatchID: batchID, PhoneNumber: phone})
+	if err != nil {
+		return Invitation{}, err
+	}
+	for _, inv := range invs {
+		switch inv.withStatus(s.now()).Status {
+		case statusExpired, statusCancelled:
+			continue
+		}
+		if t.Duplicates == duplicatesMerge {
+			return inv, errMerged
+		}
+		return Invitation{}, &requestError{status: http.StatusConflict, code: codeDuplicateInvitation,
+			msg:     "phone_number already has invitation " + inv.ID + " in this batch; set allow_duplicate to send another",
+			details: map[string]any{"invitation_id": inv.ID}}
+	}
+	return Invitation{}, nil
+}
@@ -0,0 +1,99 @@
+package invitations
+
+import (
+	"context"
+	"net/http"
+)
+
+// Channels an invitation can go out on, which key NewServer's notifiers.
+const (
+	ChannelSMS      = channelSMS
+	ChannelEmail    = channelEmail
+	ChannelVoice    = channelVoice
+	ChannelWhatsApp = channelWhatsApp
+	ChannelTelegram = channelTelegram
+	ChannelPush     = channelPush
+)
+
+// viaEmbedded marks responses recorded through Respond.
+const viaEmbedded = "embedded"
+
+// Errors callers may want to tell apart; others describe what was wrong
+// with the request.
+var (
+	ErrNotFound         = errNotFound
+	ErrExpired          = errExpired
+	ErrAlreadyCancelled = errAlreadyCancelled
+	// ErrMerged comes with the existing invitation Create returned in
+	// place of a duplicate.
+	ErrMerged = errMerged
+	// ErrDuplicateID is what a Store's Create returns for an ID it already
+	// has; the server retries with another.
+	ErrDuplicateID = errDuplicateID
+)
+
+// NewMemoryStore returns an empty store that lives in memory, for tests and
+// programs that don't need invitations to outlive them.
+func NewMemoryStore() Store { return newMemoryStore() }
+
+// WithTenant scopes calls made with ctx to tenant id, as that tenant's API
+// keys are. Unscoped calls see every tenant.
+func WithTenant(ctx context.Context, id string) context.Context { return withTenant(ctx, id) }
+
+// Create makes the invitation req describes, as POST /invitations does, and
+// queues it for the invitee unless it is scheduled.
+func (s *Server) Create(ctx context.Context, req CreateInvitationRequest) (Invitation, error) {
+	return s.createFromRequest(ctx, req)
+}
+
+// Get returns invitation id with its current status.
+func (s *Server) Get(ctx context.Context, id string) (Invitation, error) {
+	inv, err := s.store.Get(ctx, id)
+	if err != nil {
+		return Invitation{}, err
+	}
+	return inv.withStatus(s.now()), nil
+}
+
+// List returns up to f.Limit invitations matching f, 50 when it is zero,
+// oldest first, with their current status.
+func (s *Server) List(ctx context.Context, f ListFilter) ([]Invitation, error) {
+	page, err := s.listInvitations(ctx, f, false)
+	return page.Invitations, err
+}
+
+// Cancel withdraws invitation id, texting the invitee when notify is set and
+// it had been sent.
+func (s *Server) Cancel(ctx context.Context, id string, notify bool) (Invitation, error) {
+	return s.cancelInvitation(ctx, id, notify, nil)
+}
+
+// Respond records response, one of the invitation's options, and note as
+// the invitee's answer to invitation id, which the embedding program is
+// trusted to have had from them.
+func (s *Server) Respond(ctx context.Context, id, response, note string) (Invitation, error) {
+	inv, err := s.recordResponse(ctx, id, responseInput{Response: response, Note: note, Via: viaEmbedded})
+	if err != nil {
+		return Invitation{}, err
+	}
+	return inv.withStatus(s.now()), nil
+}
+
+// OnExpire registers fn to be called for each invitation that expires
+// unanswered, once Start or Run is running the workers.
+func (s *Server) OnExpire(fn func(context.Context, Invitation)) { s.onExpire(fn) }
+
+// Handler is the HTTP API, for mounting in the embedding program's own
+// server in place of Start's.
+func (s *Server) Handler() http.Handler { return s.http.Handler }
+
+// Run runs the background workers, which send, remind, nudge and expire,
+// without serving the APIs. It returns once ctx is done and the workers have
+// stopped.
+func (s *Server) Run(ctx context.Context) {
+	s.startWorkers(ctx)
+	<-ctx.Done()
+	s.stopWorker()
+	s.workers.Wait()
+	s.webhookWG.Wait()
+}
@@ -0,0 +1,116 @@
+package invitations_test
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"invitation-api/pkg/config"
+	"invitation-api/pkg/invitations"
+	"invitation-api/testutil"
+)
+
+// auditStore is a Store written outside the package, as embedding programs
+// can: it keeps every event it is asked to append, on top of another store.
+type auditStore struct {
+	invitations.Store
+	mu     sync.Mutex
+	events []invitations.InvitationEvent
+}
+
+func (s *auditStore) AppendEvent(ctx context.Context, id string, ev invitations.InvitationEvent) error {
+	s.mu.Lock()
+	s.events = append(s.events, ev)
+	s.mu.Unlock()
+	return s.Store.AppendEvent(ctx, id, ev)
+}
+
+func (s *auditStore) Events(ctx context.Context, id string) ([]invitations.InvitationEvent, error) {
+	return s.Store.Events(ctx, id)
+}
+
+func (s *auditStore) Stats(ctx context.Context, f invitations.StatsFilter) (invitations.InvitationStats, error) {
+	return s.Store.Stats(ctx, f)
+}
+
+type discard struct{}
+
+func (discard) Notify(context.Context, invitations.Invitation, string) (string, error) {
+	return "", nil
+}
+
+func TestEmbedWithOwnStore(t *testing.T) {
+	cfg, err := config.Load([]string{"-require-api-key=false"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &auditStore{Store: invitations.NewMemoryStore()}
+	clock := testutil.NewFakeClock(time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC))
+	srv := invitations.NewServer(cfg, store, map[string]invitations.Notifier{invitations.ChannelSMS: discard{}}, nil, clock)
+
+	ctx := context.Background()
+	inv, err := srv.Create(ctx, invitations.CreateInvitationRequest{
+		PhoneNumber:     "+14155550101",
+		Message:         "Dinner at 8?",
+		DurationMin:     120,
+		RemindBeforeMin: invitations.MinuteList{30},
+		Questions:       []invitations.Question{{ID: "day", Text: "Which day?", Options: []string{"Sat", "Sun"}}},
+		Nudge:           &invitations.NudgePolicy{AfterMin: 20, Max: 1},
+		Fallback:        &invitations.FallbackPolicy{Channels: []string{invitations.ChannelEmail}, AfterMin: 10},
+		Notify:          &invitations.HostNotify{WebhookURL: "https://host.example.com/hook"},
+		OnExpire:        &invitations.ExpiryPolicy{Action: "auto_decline"},
+		Confirm:         &invitations.ConfirmPolicy{WithinMin: 5},
+		FollowUps:       []invitations.FollowUp{{On: "yes", Action: "notify", Message: "They're in", PhoneNumber: "+14155550199"}},
+		Email:           "guest@example.com",
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if inv.Nudge == nil || inv.OnExpire == nil || len(inv.Reminders) != 1 {
+		t.Errorf("created %+v without its policies", inv)
+	}
+
+	if _, err := srv.Respond(ctx, inv.ID, "yes", ""); err != nil {
+		t.Fatalf("respond: %v", err)
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	var types []string
+	for _, ev := range store.events {
+		types = append(types, ev.Type)
+	}
+	if len(types) < 2 || types[0] != "created" || !slices.Contains(types, "responded") {
+		t.Errorf("appended events %v, want created and later responded", types)
+	}
+
+	page, err := srv.List(ctx, invitations.ListFilter{After: &invitations.ListCursor{CreatedAt: inv.CreatedAt}})
+	if err != nil || len(page) != 1 || page[0].Status != "accepted" {
+		t.Errorf("listed %+v, %v; want the accepted invitation", page, err)
+	}
+}
+
+// Every field of an Invitation can be built outside the package, as a Store
+// written there has to.
+func TestEmbedBuildsInvitationFields(t *testing.T) {
+	due := time.Date(2026, 3, 2, 12, 30, 0, 0, time.UTC)
+	inv := invitations.Invitation{
+		ID:              "inv-1",
+		Reminders:       []invitations.Reminder{{BeforeMin: 30, At: due}},
+		SMSEstimate:     &invitations.SMSEstimate{Segments: 1, Encoding: "GSM-7", Length: 12},
+		PendingResponse: &invitations.PendingResponse{Response: "yes", Via: "http", ExpiresAt: due},
+	}
+	store := invitations.NewMemoryStore()
+	ctx := context.Background()
+	if err := store.Create(ctx, inv); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Get(ctx, inv.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Reminders[0].BeforeMin != 30 || got.SMSEstimate.Segments != 1 || got.PendingResponse.Response != "yes" {
+		t.Errorf("stored %+v", got)
+	}
+}
@@ -0,0 +1,154 @@
+package invitations
+
+import "net/http"
+
+// Error codes are the stable part of an error response: clients branch on
+// them, while messages are for people and may be reworded. Every code is
+// listed in errorCodes and documented in openapi.yaml.
+const (
+	codeInvalidRequest       = "invalid_request"
+	codeInvalidJSON          = "invalid_json"
+	codeUnknownField         = "unknown_field"
+	codeInvalidType          = "invalid_type"
+	codeValidationFailed     = "validation_failed"
+	codeInvalidPhoneNumber   = "invalid_phone_number"
+	codeUnauthorized         = "unauthorized"
+	codeForbidden            = "forbidden"
+	codeInvalidToken         = "invalid_token"
+	codeOptedOut             = "opted_out"
+	codeDestinationBlocked   = "destination_blocked"
+	codeNotFound             = "not_found"
+	codeMethodNotAllowed     = "method_not_allowed"
+	codeConflict             = "conflict"
+	codePreconditionFailed   = "precondition_failed"
+	codePreconditionRequired = "precondition_required"
+	codeAlreadyResponded     = "already_responded"
+	codeAlreadyCancelled     = "already_cancelled"
+	codeNotSent              = "not_sent"
+	codeEventFull            = "event_full"
+	codeDuplicateExternalID  = "duplicate_external_id"
+	codeDuplicateInvitation  = "duplicate_invitation"
+	codeInvitationExpired    = "invitation_expired"
+	codeInvitationCancelled  = "invitation_cancelled"
+	codeInvitationForwarded  = "invitation_forwarded"
+	codeNoPendingResponse    = "no_pending_response"
+	codeInvalidCode          = "invalid_confirmation_code"
+	codeGone                 = "gone"
+	codePayloadTooLarge      = "payload_too_large"
+	codeUnsupportedMediaType = "unsupported_media_type"
+	codeQuietHours           = "quiet_hours"
+	codeMessageTooLong       = "message_too_long"
+	codeBudgetExceeded       = "budget_exceeded"
+	codeRateLimited          = "rate_limited"
+	codeInternal             = "internal_error"
+	codeUnavailable          = "unavailable"
+)
+
+var errorCodes = []string{
+	codeInvalidRequest, codeInvalidJSON, codeUnknownField, codeInvalidType, codeValidationFailed,
+	codeInvalidPhoneNumber, codeUnauthorized, codeForbidden, codeInvalidToken, codeOptedOut,
+	codeDestinationBlocked, codeNotFound, codeMethodNotAllowed, codeConflict, codePreconditionFailed,
+	codePreconditionRequired, codeAlreadyResponded, codeAlreadyCancelled, codeNotSent, codeEventFull,
+	codeDuplicateExternalID, codeDuplicateInvitation, codeInvitationExpired, codeInvitationCancelled, codeInvitationForwarded,
+	codeNoPendingResponse, codeInvalidCode, codeGone, codePayloadTooLarge, codeUnsupportedMediaType,
+	codeQuietHours, codeMessageTooLong, codeBudgetExceeded, codeRateLimited, codeInternal, codeUnavailable,
+}
+
+// problemTitles is the title of the problem type for each code, whose
+// slug is the code with hyphens. Problems with any other code are
+// about:blank, titled by their status.
+var problemTitles = map[string]string{
+	codeInvalidRequest:       "Invalid request",
+	codeInvalidJSON:          "Body is not JSON",
+	codeUnknownField:         "Unknown field",
+	codeInvalidType:          "Wrong type",
+	codeValidationFailed:     "Validation failed",
+	codeInvalidPhoneNumber:   "Invalid phone number",
+	codeUnauthorized:         "Unauthorized",
+	codeForbidden:            "Forbidden",
+	codeInvalidToken:         "Invalid response token",
+	codeOptedOut:             "Phone number has opted out",
+	codeDestinationBlocked:   "Destination not allowed",
+	codeNotFound:             "Not found",
+	codeMethodNotAllowed:     "Method not allowed",
+	codeConflict:             "Conflict",
+	codePreconditionFailed:   "Precondition failed",
+	codePreconditionRequired: "Precondition required",
+	codeAlreadyResponded:     "Invitation already responded to",
+	codeAlreadyCancelled:     "Invitation already cancelled",
+	codeNotSent:              "Invitation not sent yet",
+	codeEventFull:            "Event is full",
+	codeDuplicateExternalID:  "Duplicate external ID",
+	codeDuplicateInvitation:  "Duplicate invitation",
+	codeInvitationExpired:    "Invitation has expired",
+	codeInvitationCancelled:  "Invitation has been cancelled",
+	codeInvitationForwarded:  "Invitation has been forwarded",
+	codeNoPendingResponse:    "No response awaiting confirmation",
+	codeInvalidCode:          "Invalid confirmation code",
+	codeGone:                 "Gone",
+	codePayloadTooLarge:      "Request body too large",
+	codeUnsupportedMediaType: "Unsupported media type",
+	codeQuietHours:           "Within quiet hours",
+	codeMessageTooLong:       "Message too long",
+	codeBudgetExceeded:       "Budget exceeded",
+	codeRateLimited:          "Too many requests",
+	codeInternal:             "Internal server error",
+	codeUnavailable:          "Service unavailable",
+}
+
+// statusCodes is the code for an error that has nothing more specific.
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            codeInvalidRequest,
+	http.StatusUnauthorized:          codeUnauthorized,
+	http.StatusForbidden:             codeForbidden,
+	http.StatusNotFound:              codeNotFound,
+	http.StatusMethodNotAllowed:      codeMethodNotAllowed,
+	http.StatusConflict:              codeConflict,
+	http.StatusGone:                  codeGone,
+	http.StatusPreconditionFailed:    codePreconditionFailed,
+	http.StatusPreconditionRequired:  codePreconditionRequired,
+	http.StatusRequestEntityTooLarge: codePayloadTooLarge,
+	http.StatusUnsupportedMediaType:  codeUnsupportedMediaType,
+	http.StatusUnprocessableEntity:   codeValidationFailed,
+	http.StatusTooManyRequests:       codeRateLimited,
+	http.StatusServiceUnavailable:    codeUnavailable,
+}
+
+// sentinelCodes is the code for each of the errors handlers share.
+var sentinelCodes = map[error]string{
+	errNotFound:           codeNotFound,
+	errExpired:            codeInvitationExpired,
+	errLocked:             codeAlreadyResponded,
+	errCancelled:          codeInvitationCancelled,
+	errAlreadyCancelled:   codeAlreadyCancelled,
+	errNotSent:            codeNotSent,
+	errFull:               codeEventFull,
+	errForwarded:          codeInvitationForwarded,
+	errNoPendingResponse:  codeNoPendingResponse,
+	errWrongCode:          codeInvalidCode,
+	errBadToken:           codeInvalidToken,
+	errOptedOut:           codeOptedOut,
+	errPreconditionFailed: codePreconditionFailed,
+}
+
+// errorCode returns the code for err, falling back on status.
+func errorCode(status int, err error) string {
+	if code, ok := sentinelCodes[err]; ok {
+		return code
+	}
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	if status >= 500 {
+		return codeInternal
+	}
+	return codeInvalidRequest
+}
+
+// errorBody is the JSON body of every error response.
+type errorBody struct {
+	Code      string         `json:"code"`
+	Message   string         `json:"message"`
+	Details   map[string]any `json:"details,omitempty"`
+	RequestID string         `json:"request_id,omitempty"`
+}
@@ -0,0 +1,107 @@
+package invitations
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errPreconditionFailed = errors.New("invitation has changed since it was read")
+
+// etag is the entity tag of an invitation as it stands.
+func etag(inv Invitation) string { return `"` + strconv.Itoa(inv.Version) + `"` }
+
+// ifMatch holds the entity tags a mutation's If-Match accepts. Nil accepts
+// any version.
+type ifMatch []string
+
+func (m ifMatch) check(inv Invitation) error {
+	if m == nil || slices.Contains(m, etag(inv)) {
+		return nil
+	}
+	return errPreconditionFailed
+}
+
+// readIfMatch parses the If-Match header of a mutation. Without one the
+// change is made to whatever version is current, unless RequireIfMatch is
+// set. Tags are compared strongly, so weak ones never match.
+func (s *Server) readIfMatch(r *http.Request) (ifMatch, error) {
+	h := strings.TrimSpace(r.Header.Get("If-Match"))
+	switch h {
+	case "":
+		if s.cfg.RequireIfMatch {
+			return nil, &requestError{status: http.StatusPreconditionRequired, msg: "If-Match is required; send the ETag the invitation was read with"}
+		}
+		return nil, nil
+	case "*":
+		return nil, nil
+	}
+	m := ifMatch{}
+	for _, tag := range strings.Split(h, ",") {
+		m = append(m, strings.TrimSpace(tag))
+	}
+	return m, nil
+}
+
+// lastModified is when inv, as stored, last changed as shown at t: its last
+// update, or its deadline if it has since lapsed unanswered and the sweeper
+// hasn't yet marked it expired.
+func lastModified(inv Invitation, t time.Time) time.Time {
+	m := inv.CreatedAt
+	if inv.UpdatedAt.After(m) {
+		m = inv.UpdatedAt
+	}
+	if lapsedUnswept(inv, t) && inv.ExpiresAt.After(m) {
+		m = inv.ExpiresAt
+	}
+	return m
+}
+
+// lapsedUnswept reports whether inv, as stored, shows as expired at t only
+// because its deadline has passed. Its version, and so its ETag, is then
+// the same as while it was pending.
+func lapsedUnswept(inv Invitation, t time.Time) bool {
+	return inv.Status != statusExpired && inv.withStatus(t).Status == statusExpired
+}
+
+// setValidators gives a GET response its ETag and Last-Modified, and asks
+// caches to check them before reusing it.
+func setValidators(w http.ResponseWriter, tag string, modified time.Time) {
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("ETag", tag)
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// notModified reports whether the conditional headers of r show the client
+// already has the representation with ETag tag, last changed at modified.
+// If-None-Match is compared weakly and, when given, If-Modified-Since is
+// ignored. An empty tag matches no If-None-Match.
+func notModified(r *http.Request, tag string, modified time.Time) bool {
+	if h := strings.TrimSpace(r.Header.Get("If-None-Match")); h != "" {
+		if tag == "" {
+			return false
+		}
+		if h == "*" {
+			return true
+		}
+		for _, t := range strings.Split(h, ",") {
+			if strings.TrimPrefix(strings.TrimSpace(t), "W/") == strings.TrimPrefix(tag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !modified.IsZero() && !modified.Truncate(time.Second).After(since)
+}
+
+// writeInvitation writes inv along with its ETag.
+func writeInvitation(w http.ResponseWriter, status int, inv Invitation) {
+	w.Header().Set("ETag", etag(inv))
+	writeJSON(w, status, inv)
+}
@@ -0,0 +1,178 @@
+package invitations
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"invitation-api/pkg/config"
+)
+
+const busKind = "bus_outbox"
+
+// eventBus publishes to a message bus, returning once the bus has accepted
+// the message.
+type eventBus interface {
+	publish(ctx context.Context, m busMessage) error
+}
+
+// busMessage is a lifecycle event waiting to be published. Like outbound
+// messages it stays in the store until the bus accepts it, so every event
+// is published at least once; consumers can drop repeats by ID.
+type busMessage struct {
+	ID           string          `json:"id"`
+	Subject      string          `json:"subject"`
+	InvitationID string          `json:"invitation_id"`
+	Payload      json.RawMessage `json:"payload"`
+	Attempts     int             `json:"attempts,omitempty"`
+	NextAt       time.Time       `json:"next_at"`
+	LastError    string          `json:"last_error,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+func newEventBus(cfg *config.Config) (eventBus, error) {
+	switch cfg.EventBus {
+	case "nats":
+		c, err := newNATSClient(cfg.NATSURL)
+		if err != nil {
+			return nil, err
+		}
+		return natsBus{c}, nil
+	case "kafka":
+		return kafkaBus{url: strings.TrimSuffix(cfg.KafkaRESTURL, "/")}, nil
+	}
+	return nil, fmt.Errorf("unknown event bus %q", cfg.EventBus)
+}
+
+type natsBus struct{ c *natsClient }
+
+func (b natsBus) publish(ctx context.Context, m busMessage) error {
+	return b.c.publish(ctx, m.Subject, m.ID, m.Payload)
+}
+
+// kafkaBus produces to Kafka through the Confluent REST Proxy, one topic
+// per subject, keyed by invitation so an invitation's events share a
+// partition and stay in order.
+type kafkaBus struct{ url string }
+
+var kafkaClient = &http.Client{Timeout: 10 * time.Second}
+
+func (b kafkaBus) publish(ctx context.Context, m busMessage) error {
+	body, err := json.Marshal(map[string]any{"records": []map[string]any{{"key": m.InvitationID, "value": m.Payload}}})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.url+"/topics/"+url.PathEscape(m.Subject), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	resp, err := kafkaClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("kafka rest proxy: %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	var res struct {
+		Offsets []struct {
+			Error string `json:"error"`
+		} `json:"offsets"`
+	}
+	if err := json.Unmarshal(data, &res); err != nil {
+		return fmt.Errorf("kafka rest proxy: %w", err)
+	}
+	for _, o := range res.Offsets {
+		if o.Error != "" {
+			return fmt.Errorf("kafka rest proxy: %s", o.Error)
+		}
+	}
+	return nil
+}
+
+// projectBus queues lifecycle events for the bus, on
+// <event_subject_prefix>.<event> subjects such as invitations.responded.
+func (s *Server) projectBus(ctx context.Context, inv Invitation, ev InvitationEvent) {
+	name, ok := publishedAs[ev.Type]
+	if s.bus == nil || !ok || name == eventDelivery {
+		return
+	}
+	t := s.now().UTC()
+	m := busMessage{ID: s.ids.NewID(), InvitationID: inv.ID, NextAt: t, CreatedAt: t,
+		Subject: s.cfg.EventSubjectPrefix + "." + strings.TrimPrefix(name, "invitation.")}
+	payload, err := json.Marshal(webhookPayload{ID: m.ID, Type: name, CreatedAt: t, Data: webhookData(inv, t)})
+	if err == nil {
+		m.Payload = payload
+		err = putRecord(ctx, s.store, busKind, m.ID, m)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to queue event for the bus", "event", name, "invitation_id", inv.ID, "err", err)
+		return
+	}
+	select {
+	case s.busWake <- struct{}{}:
+	default:
+	}
+}
+
+// runBus publishes queued events oldest first. A failure holds back the
+// events after it until a retry succeeds, so they reach the bus in order.
+func (s *Server) runBus(ctx context.Context) {
+	ticks, stop := s.clock.NewTicker(outboxPollInterval)
+	defer stop()
+	for {
+		msgs, err := listRecords[busMessage](ctx, s.store, busKind)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to load the event bus outbox", "err", err)
+		}
+		slices.SortFunc(msgs, func(a, b busMessage) int {
+			if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+				return c
+			}
+			return strings.Compare(a.ID, b.ID)
+		})
+		for _, m := range msgs {
+			if m.NextAt.After(s.now()) || !s.publishBus(ctx, m) {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticks:
+		case <-s.busWake:
+		}
+	}
+}
+
+// publishBus makes one attempt at m, reporting whether it went out.
+func (s *Server) publishBus(ctx context.Context, m busMessage) bool {
+	pctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	err := s.bus.publish(pctx, m)
+	cancel()
+	if err == nil {
+		if err := s.store.DeleteRecord(ctx, busKind, m.ID); err != nil && err != errNotFound {
+			slog.ErrorContext(ctx, "failed to remove published event", "id", m.ID, "err", err)
+		}
+		return true
+	}
+	m.Attempts++
+	m.LastError = err.Error()
+	m.NextAt = s.now().Add(min(sendBackoffBase<<min(m.Attempts-1, 10), sendBackoffMax))
+	slog.WarnContext(ctx, "failed to publish event", "subject", m.Subject, "invitation_id", m.InvitationID, "attempts", m.Attempts, "err", err)
+	if err := putRecord(ctx, s.store, busKind, m.ID, m); err != nil {
+		slog.ErrorContext(ctx, "failed to reschedule event", "id", m.ID, "err", err)
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package invitations
+
+import "context"
+
+// An invitation's history is an append-only log of events; live streams and
+// webhooks are projections of it. record appends a lifecycle event and then
+// hands it to each projection, so what they report can't drift from the
+// history. Events no projection cares about, such as reminders, are only
+// appended.
+const (
+	historyCreated         = "created"
+	historySent            = "sent"
+	historyDelivered       = "delivered"
+	historyDeliveryUpdated = "delivery_updated"
+	historyResponded       = "responded"
+	historyResponseChanged = "response_changed"
+	historyExtended        = "extended"
+	historyUpdated         = "updated"
+	historyPromoted        = "promoted"
+	historyExpired         = "expired"
+	historyCancelled       = "cancelled"
+	historyNotified        = "notified"
+	historyViewed          = "viewed"
+)
+
+// publishedAs is the live and webhook event each projected history event
+// is published as. Delivery events are only streamed live.
+var publishedAs = map[string]string{
+	historyCreated:         eventCreated,
+	historySent:            eventUpdated,
+	historyNotified:        eventDelivery,
+	historyDelivered:       eventDelivery,
+	historyDeliveryUpdated: eventDelivery,
+	historyResponded:       eventResponded,
+	historyResponseChanged: eventResponded,
+	historyExtended:        eventUpdated,
+	historyUpdated:         eventUpdated,
+	historyPromoted:        eventUpdated,
+	historyForwarded:       eventUpdated,
+	historyViewed:          eventUpdated,
+	historyExpired:         eventExpired,
+	historyCancelled:       eventCancelled,
+}
+
+// projection is told of every event record appends, with the invitation
+// as the event left it.
+type projection func(ctx context.Context, inv Invitation, ev InvitationEvent)
+
+// record appends ev to inv's history and projects it.
+func (s *Server) record(ctx context.Context, inv Invitation, ev InvitationEvent) {
+	s.appendEvent(ctx, inv.ID, ev)
+	for _, p := range s.projections {
+		p(ctx, inv, ev)
+	}
+}
+
+func (s *Server) projectLive(_ context.Context, inv Invitation, ev InvitationEvent) {
+	if name, ok := publishedAs[ev.Type]; ok {
+		s.live.publish(name, inv)
+	}
+}
+
+func (s *Server) projectWebhooks(ctx context.Context, inv Invitation, ev InvitationEvent) {
+	if name, ok := publishedAs[ev.Type]; ok && name != eventDelivery {
+		s.sendWebhooks(ctx, name, inv)
+	}
+}
+
+// deliveryEvent records messages' new delivery statuses, keyed by channel.
+// A message listed twice, as invitations keep the invite in both Messages
+// and Delivery, appears once.
+func deliveryEvent(msgs ...DeliveryStatus) InvitationEvent {
+	ev := InvitationEvent{Type: historyDelivered, Actor: "system", Delivery: make(map[string]DeliveryStatus, len(msgs))}
+	for _, m := range msgs {
+		if m.Status != deliveryDelivered {
+			ev.Type = historyDeliveryUpdated
+		}
+		ev.Delivery[m.Channel] = m
+	}
+	return ev
+}
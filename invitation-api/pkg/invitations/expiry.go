@@ -0,0 +1,56 @@
+package invitations
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// What the sweeper does with an invitation whose deadline passes without an
+// answer, by its on_expire policy.
+const (
+	expireClose       = "close"        // marks it expired, as without a policy
+	expireAutoDecline = "auto_decline" // records a no for the invitee
+	expireExtendOnce  = "extend_once"  // moves the deadline once, then closes
+)
+
+var expiryActions = []string{expireClose, expireAutoDecline, expireExtendOnce}
+
+// ExpiryPolicy is an invitation's on_expire. ExtendedAt is set once an
+// extend_once has been used.
+type ExpiryPolicy struct {
+	Action     string    `json:"action"`
+	ExtendMin  int       `json:"extend_min,omitempty"`
+	ExtendedAt time.Time `json:"extended_at,omitempty"`
+}
+
+func (p *ExpiryPolicy) validate(opts []string, maxDurationMin int) error {
+	p.ExtendedAt = time.Time{}
+	switch p.Action {
+	case expireClose:
+	case expireAutoDecline:
+		if _, ok := matchResponse(Invitation{ResponseOptions: opts}.options(), "no"); !ok {
+			return badRequest("on_expire auto_decline needs no among the response options")
+		}
+	case expireExtendOnce:
+		if p.ExtendMin <= 0 || p.ExtendMin > maxDurationMin {
+			return badRequest("on_expire.extend_min must be between 1 and " + strconv.Itoa(maxDurationMin))
+		}
+		return nil
+	default:
+		return badRequest("on_expire.action must be one of " + strings.Join(expiryActions, ", "))
+	}
+	if p.ExtendMin != 0 {
+		return badRequest("on_expire.extend_min is only for extend_once")
+	}
+	return nil
+}
+
+// firing is the action p takes at the deadline: an extend_once that has
+// been used closes.
+func (p *ExpiryPolicy) firing() string {
+	if p == nil || p.Action == expireExtendOnce && !p.ExtendedAt.IsZero() {
+		return expireClose
+	}
+	return p.Action
+}
@@ -0,0 +1,101 @@
+package invitations
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// FallbackPolicy tries further channels, one at a time and in order, while
+// an invitation goes undelivered: AfterMin minutes after it was sent, and
+// after each fallback, the next channel gets the invitation unless some
+// channel has reported it delivered. Channels without delivery receipts,
+// such as email, never do.
+type FallbackPolicy struct {
+	Channels []string `json:"channels"`
+	AfterMin int      `json:"after_min"`
+}
+
+func (p *FallbackPolicy) validate(primary []string, durationMin int) error {
+	if len(p.Channels) == 0 {
+		return badRequest("fallback.channels must not be empty")
+	}
+	if err := validChannels(p.Channels); err != nil {
+		return badRequest("fallback." + err.Error())
+	}
+	for i, ch := range p.Channels {
+		if slices.Contains(primary, ch) || slices.Contains(p.Channels[:i], ch) {
+			return badRequest("fallback.channels must not repeat a channel")
+		}
+	}
+	if p.AfterMin <= 0 || p.AfterMin >= durationMin {
+		return badRequest("fallback.after_min must be between 1 and duration_min-1")
+	}
+	return nil
+}
+
+// nextFallback returns the channel inv falls back to next and when, or
+// false if it has tried them all.
+func nextFallback(inv Invitation) (string, time.Time, bool) {
+	if inv.Fallback == nil || len(inv.Fallbacks) >= len(inv.Fallback.Channels) {
+		return "", time.Time{}, false
+	}
+	last := inv.CreatedAt
+	if !inv.SendAt.IsZero() {
+		last = inv.SendAt
+	}
+	if n := len(inv.Fallbacks); n > 0 {
+		last = inv.Fallbacks[n-1]
+	}
+	return inv.Fallback.Channels[len(inv.Fallbacks)], last.Add(time.Duration(inv.Fallback.AfterMin) * time.Minute), true
+}
+
+func delivered(inv Invitation) bool {
+	for _, d := range inv.Delivery {
+		if d.Status == deliveryDelivered {
+			return true
+		}
+	}
+	return false
+}
+
+// sendDueFallbacks sends undelivered invitations on their next fallback
+// channel, which from then on also gets reminders and confirmations.
+func (s *Server) sendDueFallbacks(ctx context.Context, t time.Time) error {
+	candidates, err := s.store.List(ctx, ListFilter{Status: statusPending, AsOf: t, ExpiresAfter: t})
+	if err != nil {
+		return err
+	}
+	for _, c := range candidates {
+		if _, at, ok := nextFallback(c); !ok || at.After(t) || delivered(c) {
+			continue
+		}
+		var ch string
+		inv, err := s.store.Update(ctx, c.ID, func(inv *Invitation) error {
+			var at time.Time
+			var ok bool
+			if ch, at, ok = nextFallback(*inv); !ok || at.After(t) || delivered(*inv) {
+				return errSkip
+			}
+			if !isPending(inv.withStatus(t).Status) {
+				return errSkip
+			}
+			inv.Fallbacks = append(inv.Fallbacks, t.UTC())
+			if !slices.Contains(inv.Channels, ch) {
+				inv.Channels = append(inv.Channels, ch)
+			}
+			return nil
+		})
+		if err == errSkip {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		s.appendEvent(ctx, inv.ID, InvitationEvent{Type: "fell_back", Via: ch})
+		one := inv
+		one.Channels = []string{ch}
+		s.notify(ctx, one, s.inviteText(inv), true)
+	}
+	return nil
+}
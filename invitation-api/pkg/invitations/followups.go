@@ -0,0 +1,218 @@
+package invitations
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/mail"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Follow-up actions, run when an invitation gets the response, or expiry,
+// they are attached to.
+const (
+	followUpMessage = "message" // texts the invitee, say with directions
+	followUpInvite  = "invite"  // sends a new invitation
+	followUpNotify  = "notify"  // tells someone else, such as a stand-in
+
+	followUpOnExpired = "expired"
+	historyFollowUp   = "follow_up"
+	maxFollowUps      = 5
+)
+
+var followUpActions = []string{followUpMessage, followUpInvite, followUpNotify}
+
+var errNoFollowUpsDue = errors.New("no follow-ups due")
+
+// FollowUp is one "if yes, then…" step. On is a response option, matched
+// without regard to case, or "expired". An invite goes to the invitee
+// unless it gives a phone_number or email of its own; a notify needs one.
+// Each follow-up runs at most once, even if the response changes back.
+type FollowUp struct {
+	On              string   `json:"on"`
+	Action          string   `json:"action"`
+	Message         string   `json:"message"`
+	PhoneNumber     string   `json:"phone_number,omitempty"`
+	Email           string   `json:"email,omitempty"`
+	DurationMin     int      `json:"duration_min,omitempty"`
+	ResponseOptions []string `json:"response_options,omitempty"`
+
+	DoneAt       time.Time `json:"done_at,omitempty"`
+	InvitationID string    `json:"invitation_id,omitempty"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// validateFollowUps checks the follow_ups of a create request against its
+// response options, normalizing their phone numbers.
+func (s *Server) validateFollowUps(fs []FollowUp, opts []string) error {
+	if len(fs) > maxFollowUps {
+		return badRequest("follow_ups may have at most " + strconv.Itoa(maxFollowUps) + " entries")
+	}
+	options := Invitation{ResponseOptions: opts}.options()
+	for i := range fs {
+		f := &fs[i]
+		field := "follow_ups[" + strconv.Itoa(i) + "]"
+		f.DoneAt, f.InvitationID, f.Error = time.Time{}, "", ""
+		f.On = strings.TrimSpace(f.On)
+		if !strings.EqualFold(f.On, followUpOnExpired) && !slices.ContainsFunc(options, func(o string) bool { return strings.EqualFold(o, f.On) }) {
+			return badRequest(field + ".on must be one of the response options or expired")
+		}
+		if !slices.Contains(followUpActions, f.Action) {
+			return badRequest(field + ".action must be one of " + strings.Join(followUpActions, ", "))
+		}
+		if f.Message == "" || len(f.Message) > s.cfg.MaxMessageLen {
+			return badRequest(field + ".message must be between 1 and " + strconv.Itoa(s.cfg.MaxMessageLen) + " bytes")
+		}
+		if f.PhoneNumber != "" {
+			phone, err := normalizePhone(f.PhoneNumber, s.cfg.DefaultCountry)
+			if err != nil {
+				return badRequest(field + ".phone_number: " + err.Error())
+			}
+			f.PhoneNumber = phone
+		}
+		if f.Email != "" {
+			if _, err := mail.ParseAddress(f.Email); err != nil {
+				return badRequest(field + ".email must be a valid email address")
+			}
+		}
+		switch f.Action {
+		case followUpInvite:
+			if f.DurationMin <= 0 || f.DurationMin > s.cfg.MaxDurationMin {
+				return badRequest(field + ".duration_min must be between 1 and " + strconv.Itoa(s.cfg.MaxDurationMin))
+			}
+			o, err := validateOptions(f.ResponseOptions)
+			if err != nil {
+				return badRequest(field + "." + err.Error())
+			}
+			f.ResponseOptions = o
+		case followUpNotify:
+			if f.PhoneNumber == "" && f.Email == "" {
+				return badRequest(field + " needs a phone_number or email to notify")
+			}
+		}
+		if f.Action != followUpInvite && (f.DurationMin != 0 || len(f.ResponseOptions) > 0) {
+			return badRequest(field + ": duration_min and response_options are only for invite")
+		}
+	}
+	return nil
+}
+
+// projectFollowUps runs the follow-ups of inv due after ev. A yes held on
+// a batch's waitlist counts only once it is promoted.
+func (s *Server) projectFollowUps(ctx context.Context, inv Invitation, ev InvitationEvent) {
+	if len(inv.FollowUps) == 0 {
+		return
+	}
+	var on string
+	switch ev.Type {
+	case historyResponded, historyResponseChanged, historyPromoted:
+		if inv.WaitlistPosition > 0 {
+			return
+		}
+		on = inv.Response
+	case historyExpired:
+		on = followUpOnExpired
+	default:
+		return
+	}
+	ctx = withTenant(context.WithoutCancel(ctx), inv.TenantID)
+
+	// Claiming the follow-ups before running them keeps two triggers
+	// racing, on different instances, from both sending.
+	var due []int
+	claimed, err := s.store.Update(ctx, inv.ID, func(cur *Invitation) error {
+		due = due[:0]
+		cur.FollowUps = slices.Clone(cur.FollowUps)
+		for i, f := range cur.FollowUps {
+			if f.DoneAt.IsZero() && strings.EqualFold(f.On, on) {
+				cur.FollowUps[i].DoneAt = s.now().UTC()
+				due = append(due, i)
+			}
+		}
+		if len(due) == 0 {
+			return errNoFollowUpsDue
+		}
+		return nil
+	})
+	if err == errNoFollowUpsDue {
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to claim follow-ups", "invitation_id", inv.ID, "err", err)
+		return
+	}
+
+	results := make(map[int]FollowUp, len(due))
+	for _, i := range due {
+		f := claimed.FollowUps[i]
+		switch f.Action {
+		case followUpMessage:
+			s.notifyInvitee(ctx, claimed, f.Message)
+		case followUpNotify:
+			s.sendHost(ctx, HostNotify{Phone: f.PhoneNumber, Email: f.Email}, claimed.ID, f.Message, webhookPayload{}, nil)
+		case followUpInvite:
+			next, err := s.createFromRequest(ctx, followUpRequest(claimed, f))
+			if err != nil {
+				f.Error = err.Error()
+				slog.WarnContext(ctx, "failed to send follow-up invitation", "invitation_id", claimed.ID, "err", err)
+			} else {
+				f.InvitationID = next.ID
+			}
+			results[i] = f
+		}
+		note := f.Action + " on " + f.On
+		switch {
+		case f.InvitationID != "":
+			note += ": invitation " + f.InvitationID
+		case f.Error != "":
+			note += " failed: " + f.Error
+		}
+		s.appendEvent(ctx, claimed.ID, InvitationEvent{Type: historyFollowUp, Actor: "system", Note: note, Message: f.Message})
+	}
+	if len(results) == 0 {
+		return
+	}
+	if _, err := s.store.Update(ctx, claimed.ID, func(cur *Invitation) error {
+		for i, f := range results {
+			if i < len(cur.FollowUps) {
+				cur.FollowUps[i].InvitationID, cur.FollowUps[i].Error = f.InvitationID, f.Error
+			}
+		}
+		return nil
+	}); err != nil {
+		slog.ErrorContext(ctx, "failed to record follow-up results", "invitation_id", claimed.ID, "err", err)
+	}
+}
+
+// followUpRequest is the invitation f sends after inv. Without an address
+// of its own it goes to inv's invitee on inv's channels.
+func followUpRequest(inv Invitation, f FollowUp) CreateInvitationRequest {
+	req := CreateInvitationRequest{
+		Message:         f.Message,
+		DurationMin:     f.DurationMin,
+		ResponseOptions: f.ResponseOptions,
+		Timezone:        inv.Timezone,
+		Locale:          inv.Locale,
+		Priority:        inv.Priority,
+		TestMode:        inv.Test,
+		followUpOf:      inv.ID,
+	}
+	if f.PhoneNumber == "" && f.Email == "" {
+		req.PhoneNumber, req.Email = inv.PhoneNumber, inv.Email
+		req.Channels = inv.Channels
+		req.TelegramChatID, req.DeviceID = inv.TelegramChatID, inv.DeviceID
+		req.contactName = inv.ContactName
+		return req
+	}
+	req.PhoneNumber, req.Email = f.PhoneNumber, f.Email
+	if f.PhoneNumber != "" {
+		req.Channels = append(req.Channels, channelSMS)
+	}
+	if f.Email != "" {
+		req.Channels = append(req.Channels, channelEmail)
+	}
+	return req
+}
@@ -0,0 +1,203 @@
+package invitations
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	historyForwarded   = "forwarded"
+	maxForwardNameLen  = 100
+	forwardPhoneDigits = "+0123456789 -()."
+)
+
+// forwardWords start an SMS reply that passes the invitation on, as in
+// "forward +14155550123 Sam".
+var forwardWords = []string{"forward", "fwd"}
+
+// forwardInput passes an invitation on to someone else, as in "can't make
+// it, but Sam can". Token is checked as for responseInput.
+type forwardInput struct {
+	Token       string
+	PhoneNumber string
+	Name        string
+	Via         string
+}
+
+// forwardTarget is the forward_to of a respond request.
+type forwardTarget struct {
+	PhoneNumber string `json:"phone_number"`
+	Name        string `json:"name"`
+}
+
+// checkForwardable reports why inv can't be forwarded to phone at t, if it
+// can't. An answer can be given up for a forward while it could be changed.
+func (s *Server) checkForwardable(inv Invitation, phone string, t time.Time) error {
+	switch {
+	case inv.Status == statusCancelled:
+		return errCancelled
+	case inv.Status == statusScheduled:
+		return errNotSent
+	case !inv.ForwardedAt.IsZero():
+		return errForwarded
+	case t.After(inv.ExpiresAt):
+		return errExpired
+	case inv.ExpiresAt.Sub(t) < time.Minute:
+		return &requestError{status: http.StatusConflict, msg: "too little time is left to forward this invitation"}
+	case inv.Response != "" && !s.responseChangeable(inv, t):
+		return errLocked
+	case s.cfg.MaxForwardDepth == 0:
+		return &requestError{status: http.StatusForbidden, msg: "invitations can't be forwarded"}
+	case inv.ForwardDepth >= s.cfg.MaxForwardDepth:
+		return &requestError{status: http.StatusConflict, msg: "this invitation can't be forwarded any further"}
+	case phone == inv.PhoneNumber:
+		return badRequest("an invitation can't be forwarded to its own invitee")
+	}
+	return nil
+}
+
+// forwardInvitation sends a copy of invitation id, due by the same deadline,
+// to the phone number in in, and marks the original delegated. It returns
+// both.
+func (s *Server) forwardInvitation(ctx context.Context, id string, in forwardInput) (Invitation, Invitation, error) {
+	phone, err := normalizePhone(in.PhoneNumber, s.cfg.DefaultCountry)
+	if err != nil {
+		return Invitation{}, Invitation{}, phoneError(err)
+	}
+	name := strings.TrimSpace(in.Name)
+	if len(name) > maxForwardNameLen {
+		return Invitation{}, Invitation{}, badRequest("forward_to.name must be at most " + strconv.Itoa(maxForwardNameLen) + " bytes")
+	}
+
+	if in.Via == viaHTTP || in.Via == viaGRPC {
+		if err := s.expiredLink(in.Token); err != nil {
+			return Invitation{}, Invitation{}, err
+		}
+	}
+
+	// Claiming the invitation first stops it being answered, or forwarded
+	// twice, while the new one is sent.
+	var current Invitation
+	claimed, err := s.store.Update(ctx, id, func(inv *Invitation) error {
+		current = *inv
+		if in.Via == viaHTTP || in.Via == viaGRPC {
+			if err := s.checkResponseToken(*inv, in.Token); err != nil {
+				return err
+			}
+		}
+		if err := s.checkForwardable(*inv, phone, s.now()); err != nil {
+			return err
+		}
+		inv.ForwardedAt = s.now().UTC()
+		return nil
+	})
+	if err != nil {
+		return Invitation{}, Invitation{}, err
+	}
+
+	child, err := s.createFromRequest(withTenant(ctx, claimed.TenantID), forwardRequest(claimed, phone, name, s.now()))
+	if err == errMerged {
+		err = &requestError{status: http.StatusConflict, code: codeDuplicateInvitation, msg: "that phone number already has an invitation in this batch"}
+	}
+	if err != nil {
+		// Hand the invitation back, to be answered or forwarded elsewhere.
+		if _, uerr := s.store.Update(ctx, id, func(inv *Invitation) error {
+			inv.ForwardedAt = time.Time{}
+			return nil
+		}); uerr != nil {
+			slog.ErrorContext(ctx, "failed to release forwarded invitation", "invitation_id", id, "err", uerr)
+		}
+		return Invitation{}, Invitation{}, err
+	}
+
+	inv, err := s.store.Update(ctx, id, func(inv *Invitation) error {
+		inv.ForwardedTo = child.ID
+		inv.Response, inv.Note, inv.GuestCount, inv.Answers = "", "", 0, nil
+		inv.RespondedAt, inv.WaitlistPosition = time.Time{}, 0
+		return nil
+	})
+	if err != nil {
+		return Invitation{}, Invitation{}, err
+	}
+	ev := InvitationEvent{
+		Type:  historyForwarded,
+		Actor: "invitee",
+		From:  current.withStatus(s.now()).Status,
+		To:    statusDelegated,
+		Note:  "forwarded to invitation " + child.ID,
+		Via:   in.Via,
+	}
+	if current.Response != "" {
+		ev.Changes = []Change{{Field: "response", Old: current.Response, New: ""}}
+	}
+	s.record(ctx, inv, ev)
+	if inv.BatchID != "" {
+		// A yes given up frees its place.
+		s.settleBatch(ctx, inv)
+	}
+	s.notifyHost(ctx, inv, hostOnResponse, eventUpdated, localize(s.hostLocale(ctx, inv), "host_forwarded", inviteeName(inv), inviteeName(child), inv.Message))
+	if !repliesInBand(in.Via) {
+		s.notifyInvitee(ctx, inv, localize(inv.Locale, "forward_sent", inviteeName(child)))
+	}
+	return inv, child, nil
+}
+
+// forwardRequest is the invitation inv is forwarded as: the same message,
+// options and questions, due within a minute of the same deadline but never
+// after it, texted to phone.
+func forwardRequest(inv Invitation, phone, name string, t time.Time) CreateInvitationRequest {
+	req := CreateInvitationRequest{
+		PhoneNumber:     phone,
+		Channels:        []string{channelSMS},
+		Message:         inv.Message,
+		DurationMin:     int(inv.ExpiresAt.Sub(t) / time.Minute),
+		ResponseOptions: inv.ResponseOptions,
+		Questions:       inv.Questions,
+		Timezone:        inv.Timezone,
+		Locale:          inv.Locale,
+		MaxGuests:       inv.MaxGuests,
+		Notify:          inv.Notify,
+		Priority:        inv.Priority,
+		BatchID:         inv.BatchID,
+		FollowUps:       inv.FollowUps,
+		Metadata:        inv.Metadata,
+		Tags:            inv.Tags,
+		Notes:           inv.Notes,
+		TestMode:        inv.Test,
+		contactName:     name,
+		forwardedFrom:   inv.ID,
+		forwardDepth:    inv.ForwardDepth + 1,
+	}
+	if inv.OnExpire != nil {
+		p := *inv.OnExpire
+		req.OnExpire = &p
+	}
+	if inv.Confirm != nil {
+		p := *inv.Confirm
+		req.Confirm = &p
+	}
+	if inv.EventAt.After(t) {
+		at := inv.EventAt
+		req.EventAt, req.EventDurationMin, req.Location = &at, inv.EventDuration, inv.Location
+	}
+	return req
+}
+
+// parseSMSForward reads a forward reply: one of forwardWords, a phone
+// number and optionally the name of whoever it belongs to.
+func parseSMSForward(body string) (phone, name string, ok bool) {
+	word, rest, _ := strings.Cut(strings.TrimSpace(body), " ")
+	if !isKeyword(forwardWords, word) {
+		return "", "", false
+	}
+	rest = strings.TrimSpace(rest)
+	i := 0
+	for i < len(rest) && strings.IndexByte(forwardPhoneDigits, rest[i]) >= 0 {
+		i++
+	}
+	return strings.TrimSpace(rest[:i]), strings.TrimSpace(rest[i:]), true
+}
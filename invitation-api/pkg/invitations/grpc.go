@@ -0,0 +1,273 @@
+package invitations
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	pb "invitation-api/proto/invittimer/v1"
+)
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative proto/invittimer/v1/invitations.proto
+
+// grpcService adapts the service layer shared with the HTTP handlers to the
+// generated InvitationService interface.
+type grpcService struct {
+	pb.UnimplementedInvitationServiceServer
+	s *Server
+}
+
+func (s *Server) newGRPCServer() *grpc.Server {
+	g := grpc.NewServer(grpc.UnaryInterceptor(s.grpcIntercept))
+	pb.RegisterInvitationServiceServer(g, grpcService{s: s})
+	return g
+}
+
+// grpcPublicMethods are called on the invitee's behalf and authorize
+// themselves, like the public HTTP respond endpoint.
+var grpcPublicMethods = map[string]bool{
+	pb.InvitationService_RespondInvitation_FullMethodName: true,
+}
+
+// grpcReadMethods are those viewers may call.
+var grpcReadMethods = map[string]bool{
+	pb.InvitationService_GetInvitation_FullMethodName:   true,
+	pb.InvitationService_ListInvitations_FullMethodName: true,
+}
+
+// grpcIntercept does for RPCs what instrument and requireAPIKey do for HTTP
+// requests: request IDs, tracing, logging and API key authentication.
+func (s *Server) grpcIntercept(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	md, _ := metadata.FromIncomingContext(ctx)
+	id := randomHex(8)
+	if v := md.Get("x-request-id"); len(v) > 0 && validRequestID.MatchString(v[0]) {
+		id = v[0]
+	}
+	grpc.SetHeader(ctx, metadata.Pairs("x-request-id", id))
+	ctx, span := tracer.Start(ctx, info.FullMethod, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+		attribute.String("rpc.system", "grpc"),
+		attribute.String("rpc.method", info.FullMethod),
+		attribute.String("request.id", id),
+	))
+	defer span.End()
+	ctx = withRequestID(ctx, id)
+
+	resp, err := func() (any, error) {
+		if grpcPublicMethods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+		ctx, err := s.grpcAuthenticate(ctx, md)
+		if err != nil {
+			return nil, err
+		}
+		if !grpcReadMethods[info.FullMethod] && !roleAtLeast(roleFrom(ctx), roleOrganizer) {
+			return nil, status.Error(codes.PermissionDenied, "viewers can only read")
+		}
+		return handler(ctx, req)
+	}()
+	code := status.Code(err)
+	endSpan(span, err)
+	slog.InfoContext(ctx, "rpc", "method", info.FullMethod, "code", code.String(), "latency_ms", float64(time.Since(start).Microseconds())/1000)
+	return resp, err
+}
+
+func (s *Server) grpcAuthenticate(ctx context.Context, md metadata.MD) (context.Context, error) {
+	if !s.cfg.RequireAPIKey {
+		return withTenant(withActor(ctx, "host"), ""), nil
+	}
+	auth := md.Get("authorization")
+	if len(auth) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer API key")
+	}
+	token, ok := strings.CutPrefix(auth[0], "Bearer ")
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer API key")
+	}
+	k, err := s.authenticate(ctx, strings.TrimSpace(token))
+	if err == nil {
+		ctx, err = s.withAPIKey(ctx, k)
+	}
+	if err == errNotFound {
+		return nil, status.Error(codes.Unauthenticated, "invalid API key")
+	}
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return ctx, nil
+}
+
+// grpcError is writeResponseError for RPCs.
+func grpcError(ctx context.Context, err error) error {
+	var re *requestError
+	if errors.As(err, &re) {
+		code := codes.InvalidArgument
+		switch re.status {
+		case http.StatusNotFound:
+			code = codes.NotFound
+		case http.StatusConflict, http.StatusGone:
+			code = codes.FailedPrecondition
+		case http.StatusTooManyRequests:
+			code = codes.ResourceExhausted
+		case http.StatusUnauthorized:
+			code = codes.Unauthenticated
+		case http.StatusForbidden:
+			code = codes.PermissionDenied
+		case http.StatusServiceUnavailable:
+			code = codes.Unavailable
+		}
+		return status.Error(code, re.msg)
+	}
+	switch err {
+	case errNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	case errExpired, errLocked, errAlreadyCancelled, errCancelled, errNotSent, errFull, errForwarded:
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errBadToken:
+		return status.Error(codes.PermissionDenied, err.Error())
+	default:
+		slog.ErrorContext(ctx, "rpc failed", "err", err)
+		return status.Error(codes.Internal, "internal error")
+	}
+}
+
+func (g grpcService) CreateInvitation(ctx context.Context, req *pb.CreateInvitationRequest) (*pb.Invitation, error) {
+	key := ""
+	if k, ok := apiKeyFrom(ctx); ok {
+		key = "key:" + k.ID
+	} else if p, ok := peer.FromContext(ctx); ok {
+		host, _, _ := net.SplitHostPort(p.Addr.String())
+		key = "addr:" + host
+	}
+	if ok, _ := g.s.callerLimit.allow(key, g.s.now()); !ok {
+		return nil, status.Error(codes.ResourceExhausted, "too many requests for this API key")
+	}
+
+	in := CreateInvitationRequest{
+		PhoneNumber:     req.PhoneNumber,
+		Email:           req.Email,
+		Channels:        req.Channels,
+		Message:         req.Message,
+		DurationMin:     int(req.DurationMin),
+		ResponseOptions: req.ResponseOptions,
+		Timezone:        req.Timezone,
+		TemplateID:      req.TemplateId,
+		Variables:       req.Variables,
+		BatchID:         req.BatchId,
+	}
+	for _, m := range req.RemindBeforeMin {
+		in.RemindBeforeMin = append(in.RemindBeforeMin, int(m))
+	}
+	inv, err := g.s.createFromRequest(ctx, in)
+	if err != nil && err != errMerged {
+		return nil, grpcError(ctx, err)
+	}
+	return invitationProto(inv), nil
+}
+
+func (g grpcService) GetInvitation(ctx context.Context, req *pb.GetInvitationRequest) (*pb.Invitation, error) {
+	inv, err := g.s.getInvitation(ctx, req.Id)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return invitationProto(inv), nil
+}
+
+func (g grpcService) RespondInvitation(ctx context.Context, req *pb.RespondInvitationRequest) (*pb.RespondInvitationResponse, error) {
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing invitation ID")
+	}
+	in := responseInput{Token: req.Token, Response: req.Response, Note: req.Note, Via: viaGRPC}
+	inv, err := g.s.respondToInvitation(ctx, req.Id, in)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	if inv.PendingResponse != nil {
+		// The code is confirmed over HTTP or on the response page.
+		return &pb.RespondInvitationResponse{Response: inv.PendingResponse.Response, Status: "awaiting_confirmation"}, nil
+	}
+	return &pb.RespondInvitationResponse{Response: inv.Response, Status: inv.withStatus(g.s.now()).Status}, nil
+}
+
+func (g grpcService) ListInvitations(ctx context.Context, req *pb.ListInvitationsRequest) (*pb.ListInvitationsResponse, error) {
+	f := ListFilter{
+		PhoneNumber: g.s.lookupPhone(req.PhoneNumber),
+		BatchID:     req.BatchId,
+		Status:      req.Status,
+		Limit:       int(req.Limit),
+	}
+	if req.CreatedAfter != nil {
+		f.CreatedAfter = req.CreatedAfter.AsTime()
+	}
+	if req.CreatedBefore != nil {
+		f.CreatedBefore = req.CreatedBefore.AsTime()
+	}
+	if req.Cursor != "" {
+		c, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		f.After = c
+	}
+	page, err := g.s.listInvitations(ctx, f, false)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	resp := &pb.ListInvitationsResponse{NextCursor: page.NextCursor}
+	for _, inv := range page.Invitations {
+		resp.Invitations = append(resp.Invitations, invitationProto(inv))
+	}
+	return resp, nil
+}
+
+func (g grpcService) CancelInvitation(ctx context.Context, req *pb.CancelInvitationRequest) (*pb.Invitation, error) {
+	inv, err := g.s.cancelInvitation(ctx, req.Id, req.Notify, nil)
+	if err != nil {
+		return nil, grpcError(ctx, err)
+	}
+	return invitationProto(inv), nil
+}
+
+func invitationProto(inv Invitation) *pb.Invitation {
+	return &pb.Invitation{
+		Id:              inv.ID,
+		PhoneNumber:     inv.PhoneNumber,
+		Email:           inv.Email,
+		Channels:        inv.Channels,
+		Message:         inv.Message,
+		ExpiresAt:       timestampProto(inv.ExpiresAt),
+		CreatedAt:       timestampProto(inv.CreatedAt),
+		ResponseOptions: inv.ResponseOptions,
+		Response:        inv.Response,
+		Note:            inv.Note,
+		RespondedAt:     timestampProto(inv.RespondedAt),
+		Status:          inv.Status,
+		CancelledAt:     timestampProto(inv.CancelledAt),
+		Timezone:        inv.Timezone,
+		ResponseToken:   inv.ResponseToken,
+		TemplateId:      inv.TemplateID,
+		Variables:       inv.Variables,
+		BatchId:         inv.BatchID,
+		TenantId:        inv.TenantID,
+	}
+}
+
+func timestampProto(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
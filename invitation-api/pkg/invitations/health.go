@@ -0,0 +1,125 @@
+package invitations
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// providerCheckTTL is how long a provider check's result is reused, so
+// frequent probes from every replica don't add up to a load on the SMS
+// provider's API.
+const providerCheckTTL = 30 * time.Second
+
+type readyCheck struct {
+	Status     string  `json:"status"` // ok or fail
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+	Depth      *int    `json:"depth,omitempty"`
+	Limit      int     `json:"limit,omitempty"`
+}
+
+type readyReport struct {
+	Status string                `json:"status"`
+	Checks map[string]readyCheck `json:"checks"`
+}
+
+// providerChecks caches the last result of each notifier's health check,
+// keyed by channel.
+type providerChecks struct {
+	mu      sync.Mutex
+	results map[string]providerResult
+}
+
+type providerResult struct {
+	at  time.Time
+	err error
+}
+
+// handleHealthz reports that the process is up and serving. It checks
+// nothing else, so a dependency outage doesn't get the service restarted.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadyz reports whether the service can do useful work: the store
+// answers, the message providers are reachable and the outbox isn't backed
+// up past ReadyMaxOutbox. Any failing check makes it a 503.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.cfg.ReadyTimeout)
+	defer cancel()
+
+	rep := readyReport{Status: "ok", Checks: map[string]readyCheck{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	run := func(name string, fn func(context.Context, *readyCheck) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			c := readyCheck{Status: "ok"}
+			if err := fn(ctx, &c); err != nil {
+				c.Status, c.Error = "fail", err.Error()
+			}
+			c.DurationMS = float64(time.Since(start).Microseconds()) / 1000
+			mu.Lock()
+			rep.Checks[name] = c
+			mu.Unlock()
+		}()
+	}
+
+	run("store", func(ctx context.Context, _ *readyCheck) error { return s.store.Ping(ctx) })
+	if s.cfg.ReadyMaxOutbox > 0 {
+		run("outbox", func(ctx context.Context, c *readyCheck) error {
+			msgs, err := s.store.ListRecords(ctx, outboxKind)
+			if err != nil {
+				return err
+			}
+			depth := len(msgs)
+			c.Depth, c.Limit = &depth, s.cfg.ReadyMaxOutbox
+			if depth > s.cfg.ReadyMaxOutbox {
+				return fmt.Errorf("%d messages queued, more than %d", depth, s.cfg.ReadyMaxOutbox)
+			}
+			return nil
+		})
+	}
+	for ch, n := range s.notifiers {
+		if hc, ok := n.(healthChecker); ok {
+			run(ch, func(ctx context.Context, _ *readyCheck) error { return s.checkProvider(ctx, ch, hc) })
+		}
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	for _, c := range rep.Checks {
+		if c.Status != "ok" {
+			rep.Status, status = "fail", http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, rep)
+}
+
+// checkProvider runs the channel's provider check, reusing a result younger
+// than providerCheckTTL.
+func (s *Server) checkProvider(ctx context.Context, ch string, hc healthChecker) error {
+	p := &s.providers
+	p.mu.Lock()
+	last, ok := p.results[ch]
+	p.mu.Unlock()
+	now := s.now()
+	if ok && now.Sub(last.at) < providerCheckTTL {
+		return last.err
+	}
+	err := hc.Check(ctx)
+	p.mu.Lock()
+	if p.results == nil {
+		p.results = map[string]providerResult{}
+	}
+	p.results[ch] = providerResult{now, err}
+	p.mu.Unlock()
+	return err
+}
@@ -0,0 +1,218 @@
+package invitations
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/mail"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Host notification events, chosen per invitation in notify.events.
+const (
+	hostOnResponse = "response" // each response, including changes
+	hostOnResolved = "resolved" // the last pending invitation of the batch resolves
+	hostOnExpired  = "expired"  // the invitation expires unanswered
+
+	// eventResolved is only sent to notify.webhook_url; registered webhooks
+	// can work it out from the other events.
+	eventResolved = "invitation.resolved"
+
+	hostNoticeKind = "host_notice"
+)
+
+var hostEvents = []string{hostOnResponse, hostOnResolved, hostOnExpired}
+
+// HostNotify tells the organizer about an invitation as it progresses, by
+// text, email and webhook, whichever are given. An invitation outside a
+// batch resolves with its response or expiry, so it is only sent
+// "resolved" when that event isn't wanted itself.
+type HostNotify struct {
+	Phone      string   `json:"phone,omitempty"`
+	Email      string   `json:"email,omitempty"`
+	WebhookURL string   `json:"webhook_url,omitempty"`
+	Events     []string `json:"events,omitempty"`
+}
+
+// validate checks p and normalizes its phone number.
+func (p *HostNotify) validate(country string) error {
+	if p.Phone == "" && p.Email == "" && p.WebhookURL == "" {
+		return badRequest("notify needs a phone, email or webhook_url")
+	}
+	if p.Phone != "" {
+		phone, err := normalizePhone(p.Phone, country)
+		if err != nil {
+			return badRequest("notify.phone: " + err.Error())
+		}
+		p.Phone = phone
+	}
+	if p.Email != "" {
+		if _, err := mail.ParseAddress(p.Email); err != nil {
+			return badRequest("notify.email must be a valid email address")
+		}
+	}
+	if p.WebhookURL != "" {
+		if u, err := url.Parse(p.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return badRequest("notify.webhook_url must be an absolute http(s) URL")
+		}
+	}
+	for _, e := range p.Events {
+		if !slices.Contains(hostEvents, e) {
+			return badRequest("notify.events must be among " + strings.Join(hostEvents, ", "))
+		}
+	}
+	return nil
+}
+
+func (p *HostNotify) wants(event string) bool {
+	return p != nil && (len(p.Events) == 0 || slices.Contains(p.Events, event))
+}
+
+// inviteeName is how messages to the host refer to the invitee of inv.
+func inviteeName(inv Invitation) string {
+	switch {
+	case inv.ContactName != "":
+		return inv.ContactName
+	case inv.PhoneNumber != "":
+		return maskPhone(inv.PhoneNumber)
+	case inv.Email != "":
+		return inv.Email
+	}
+	return "An invitee"
+}
+
+// notifyHost sends text to the host of inv for event, and posts inv to the
+// host's webhook as webhookEvent.
+func (s *Server) notifyHost(ctx context.Context, inv Invitation, event, webhookEvent, text string) {
+	if !inv.Notify.wants(event) {
+		return
+	}
+	payload := webhookPayload{ID: randomHex(16), Type: webhookEvent, CreatedAt: s.now().UTC(), Data: webhookData(inv, s.now())}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to encode host webhook payload", "event", webhookEvent, "err", err)
+		return
+	}
+	s.sendHost(ctx, *inv.Notify, inv.ID, text, payload, body)
+}
+
+// sendHost queues text to n's phone and email and posts body to its
+// webhook; payload describes body for the delivery log. Texts and emails go
+// through the outbox as messages of invitation invID addressed to the host,
+// so they are retried like the invitee's.
+func (s *Server) sendHost(ctx context.Context, n HostNotify, invID, text string, payload webhookPayload, body []byte) {
+	ctx = context.WithoutCancel(ctx)
+	var queued []outboundMessage
+	for ch, to := range map[string]string{channelSMS: n.Phone, channelEmail: n.Email} {
+		if to == "" {
+			continue
+		}
+		if _, ok := s.notifiers[ch]; !ok {
+			continue
+		}
+		at := s.now().UTC()
+		queued = append(queued, outboundMessage{
+			ID: randomHex(8), InvitationID: invID, Channel: ch, Body: text, To: to,
+			NextAt: at, CreatedAt: at, RequestID: requestIDFrom(ctx),
+		})
+	}
+	s.enqueue(ctx, queued)
+
+	if n.WebhookURL == "" {
+		return
+	}
+	s.webhookWG.Add(1)
+	go func() {
+		defer s.webhookWG.Done()
+		s.deliverWebhook(ctx, webhook{ID: "notify", URL: n.WebhookURL}, payload, body)
+	}()
+}
+
+func (s *Server) notifyHostResponse(ctx context.Context, inv Invitation) {
+	locale := s.hostLocale(ctx, inv)
+	text := localize(locale, "host_responded", inviteeName(inv), responseLabel(locale, inv.Response), inv.Message)
+	s.notifyHost(ctx, inv, hostOnResponse, eventResponded, text)
+	s.notifyHostResolved(ctx, inv, hostOnResponse)
+}
+
+func (s *Server) notifyHostExpired(ctx context.Context, inv Invitation) {
+	if inv.Response != "" {
+		return
+	}
+	text := localize(s.hostLocale(ctx, inv), "host_expired", inviteeName(inv), inv.Message)
+	s.notifyHost(ctx, inv, hostOnExpired, eventExpired, text)
+	s.notifyHostResolved(ctx, inv, hostOnExpired)
+}
+
+// notifyHostResolved tells the host once the batch of inv has no pending
+// invitations left; trigger is the event that resolved inv, or "" for a
+// cancellation. It is called after settleBatch, whose own closures are then
+// already counted.
+func (s *Server) notifyHostResolved(ctx context.Context, inv Invitation, trigger string) {
+	if !inv.Notify.wants(hostOnResolved) {
+		return
+	}
+	if inv.BatchID == "" {
+		// The host cancelled it, or has just been told.
+		if trigger == "" || inv.Notify.wants(trigger) {
+			return
+		}
+		locale := s.hostLocale(ctx, inv)
+		text := localize(locale, "host_resolved", inviteeName(inv), statusLabel(locale, inv.withStatus(s.now()).Status), inv.Message)
+		s.notifyHost(ctx, inv, hostOnResolved, eventResolved, text)
+		return
+	}
+
+	ctx = withTenant(context.WithoutCancel(ctx), inv.TenantID)
+	unlock, err := s.locks.lock(ctx, batchLockKey(inv.BatchID))
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to lock batch", "batch_id", inv.BatchID, "err", err)
+		return
+	}
+	defer unlock()
+	if _, err := s.store.GetRecord(ctx, hostNoticeKind, inv.BatchID); err != errNotFound {
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to load host notice", "batch_id", inv.BatchID, "err", err)
+		}
+		return
+	}
+	invs, err := s.store.List(ctx, ListFilter{BatchID: inv.BatchID})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to list batch", "batch_id", inv.BatchID, "err", err)
+		return
+	}
+	var counts batchCounts
+	for _, other := range invs {
+		counts.add(other.withStatus(s.now()))
+	}
+	if counts.Pending > 0 || counts.Scheduled > 0 {
+		return
+	}
+	if err := s.store.PutRecord(ctx, hostNoticeKind, inv.BatchID, []byte("{}")); err != nil {
+		slog.ErrorContext(ctx, "failed to record host notice", "batch_id", inv.BatchID, "err", err)
+		return
+	}
+	locale := s.hostLocale(ctx, inv)
+	text := localize(locale, "host_batch_resolved", counts.Total, tallyText(locale, counts))
+	s.notifyHost(ctx, inv, hostOnResolved, eventResolved, text)
+}
+
+// tallyText puts c as "3 yes, 2 no, 4 pending" in the language of locale,
+// leaving out what is zero.
+func tallyText(locale string, c batchCounts) string {
+	var parts []string
+	for _, p := range []struct {
+		n   int
+		key string
+	}{
+		{c.Accepted + c.Waitlisted, "tally_yes"}, {c.Declined, "tally_no"}, {c.Responded, "tally_other"},
+		{c.Pending, "tally_pending"}, {c.Scheduled, "tally_scheduled"}, {c.Expired, "tally_expired"}, {c.Cancelled, "tally_cancelled"},
+	} {
+		if p.n > 0 {
+			parts = append(parts, localize(locale, p.key, p.n))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
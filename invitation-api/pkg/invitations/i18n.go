@@ -0,0 +1,542 @@
+package invitations
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// catalogLanguages are the languages system messages are written in, the
+// first being the fallback. Locales are matched to the closest of them, so
+// "pt-BR" gets Portuguese and "en-GB" English.
+var catalogLanguages = []language.Tag{language.English, language.Spanish, language.French, language.German, language.Portuguese}
+
+var localeMatcher = language.NewMatcher(catalogLanguages)
+
+// catalog holds the system messages invitees and hosts get, by key and then
+// by base language. Entries are fmt formats. Times and dates are layouts for
+// formatDeadline.
+var catalog = map[string]map[string]string{
+	"open_until": {
+		"en": " This invitation will be open until %s.",
+		"es": " Esta invitación estará abierta hasta las %s.",
+		"fr": " Cette invitation reste ouverte jusqu'à %s.",
+		"de": " Diese Einladung ist bis %s offen.",
+		"pt": " Este convite fica aberto até às %s.",
+	},
+	"voice_open_until": {
+		"en": " This invitation is open until %s.",
+		"es": " Esta invitación está abierta hasta las %s.",
+		"fr": " Cette invitation est ouverte jusqu'à %s.",
+		"de": " Diese Einladung ist bis %s offen.",
+		"pt": " Este convite está aberto até às %s.",
+	},
+	"time_today": {
+		"en": "3:04PM MST", "es": "15:04 MST", "fr": "15:04 MST", "de": "15:04 MST", "pt": "15:04 MST",
+	},
+	"time_other_day": {
+		"en": "3:04PM MST on Mon, Jan 2",
+		"es": "15:04 MST del 2/1",
+		"fr": "15:04 MST le 2/1",
+		"de": "15:04 MST am 2.1.",
+		"pt": "15:04 MST de 2/1",
+	},
+	"respond_link": {
+		"en": " Respond: %s", "es": " Responder: %s", "fr": " Répondre : %s", "de": " Antworten: %s", "pt": " Responder: %s",
+	},
+	"reply_with": {
+		"en": " Reply with %s.",
+		"es": " Responde con %s.",
+		"fr": " Répondez par %s.",
+		"de": " Antworten Sie mit %s.",
+		"pt": " Responda com %s.",
+	},
+	"reply_questions": {
+		"en": " After your answer, add one for each question: %s.",
+		"es": " Tras tu respuesta, añade una para cada pregunta: %s.",
+		"fr": " Après votre réponse, ajoutez-en une pour chaque question : %s.",
+		"de": " Fügen Sie nach Ihrer Antwort eine für jede Frage hinzu: %s.",
+		"pt": " Após a sua resposta, acrescente uma para cada pergunta: %s.",
+	},
+	"yes": {"en": "Yes", "es": "Sí", "fr": "Oui", "de": "Ja", "pt": "Sim"},
+	"no":  {"en": "No", "es": "No", "fr": "Non", "de": "Nein", "pt": "Não"},
+	"confirmed": {
+		"en": "Thanks! Your response has been recorded as: %s",
+		"es": "¡Gracias! Hemos registrado tu respuesta: %s",
+		"fr": "Merci ! Votre réponse a été enregistrée : %s",
+		"de": "Danke! Ihre Antwort wurde gespeichert: %s",
+		"pt": "Obrigado! A sua resposta foi registada: %s",
+	},
+	"add_to_calendar": {
+		"en": ". Add it to your calendar: %s",
+		"es": ". Añádelo a tu calendario: %s",
+		"fr": ". Ajoutez-le à votre agenda : %s",
+		"de": ". Zum Kalender hinzufügen: %s",
+		"pt": ". Adicione-o ao seu calendário: %s",
+	},
+	"waitlisted": {
+		"en": "The event is full, so you're number %d on the waitlist. We'll text you if a place opens up.",
+		"es": "El evento está completo, así que eres el número %d de la lista de espera. Te avisaremos si se libera una plaza.",
+		"fr": "L'événement est complet : vous êtes numéro %d sur la liste d'attente. Nous vous préviendrons si une place se libère.",
+		"de": "Die Veranstaltung ist voll, Sie sind Nummer %d auf der Warteliste. Wir melden uns, wenn ein Platz frei wird.",
+		"pt": "O evento está lotado, por isso é o número %d na lista de espera. Avisamos se abrir uma vaga.",
+	},
+	"reminder_one": {
+		"en": "Reminder: you have %d minute left to respond to your invitation.",
+		"es": "Recordatorio: te queda %d minuto para responder a tu invitación.",
+		"fr": "Rappel : il vous reste %d minute pour répondre à votre invitation.",
+		"de": "Erinnerung: Sie haben noch %d Minute, um auf Ihre Einladung zu antworten.",
+		"pt": "Lembrete: tem %d minuto para responder ao seu convite.",
+	},
+	"reminder_other": {
+		"en": "Reminder: you have %d minutes left to respond to your invitation.",
+		"es": "Recordatorio: te quedan %d minutos para responder a tu invitación.",
+		"fr": "Rappel : il vous reste %d minutes pour répondre à votre invitation.",
+		"de": "Erinnerung: Sie haben noch %d Minuten, um auf Ihre Einladung zu antworten.",
+		"pt": "Lembrete: tem %d minutos para responder ao seu convite.",
+	},
+	"nudge": {
+		"en": "Reminder: we haven't had your answer yet. %s",
+		"es": "Recordatorio: aún no hemos recibido tu respuesta. %s",
+		"fr": "Rappel : nous n'avons pas encore reçu votre réponse. %s",
+		"de": "Erinnerung: Wir haben Ihre Antwort noch nicht erhalten. %s",
+		"pt": "Lembrete: ainda não recebemos a sua resposta. %s",
+	},
+	"update": {
+		"en": "Update: %s", "es": "Actualización: %s", "fr": "Mise à jour : %s", "de": "Aktualisierung: %s", "pt": "Atualização: %s",
+	},
+	"withdrawn_by_host": {
+		"en": "Your invitation has been withdrawn by the host.",
+		"es": "El anfitrión ha retirado tu invitación.",
+		"fr": "Votre invitation a été retirée par l'organisateur.",
+		"de": "Ihre Einladung wurde vom Gastgeber zurückgezogen.",
+		"pt": "O seu convite foi retirado pelo anfitrião.",
+	},
+	"expired_notice": {
+		"en": "Your invitation has expired.",
+		"es": "Tu invitación ha caducado.",
+		"fr": "Votre invitation a expiré.",
+		"de": "Ihre Einladung ist abgelaufen.",
+		"pt": "O seu convite expirou.",
+	},
+	"expired": {
+		"en": "Sorry, your invitation has expired.",
+		"es": "Lo sentimos, tu invitación ha caducado.",
+		"fr": "Désolé, votre invitation a expiré.",
+		"de": "Leider ist Ihre Einladung abgelaufen.",
+		"pt": "Lamentamos, o seu convite expirou.",
+	},
+	"already_responded": {
+		"en": "You've already responded to this invitation.",
+		"es": "Ya has respondido a esta invitación.",
+		"fr": "Vous avez déjà répondu à cette invitation.",
+		"de": "Sie haben auf diese Einladung bereits geantwortet.",
+		"pt": "Já respondeu a este convite.",
+	},
+	"withdrawn": {
+		"en": "This invitation has been withdrawn.",
+		"es": "Esta invitación ha sido retirada.",
+		"fr": "Cette invitation a été retirée.",
+		"de": "Diese Einladung wurde zurückgezogen.",
+		"pt": "Este convite foi retirado.",
+	},
+	"forwarded": {
+		"en": "You passed this invitation on to someone else.",
+		"es": "Pasaste esta invitación a otra persona.",
+		"fr": "Vous avez transmis cette invitation à quelqu'un d'autre.",
+		"de": "Sie haben diese Einladung an jemand anderen weitergegeben.",
+		"pt": "Passou este convite a outra pessoa.",
+	},
+	"forward_hint": {
+		"en": "To pass the invitation on, reply FORWARD and their phone number.",
+		"es": "Para pasar la invitación, responde FORWARD y su número de teléfono.",
+		"fr": "Pour transmettre l'invitation, répondez FORWARD suivi de son numéro de téléphone.",
+		"de": "Um die Einladung weiterzugeben, antworten Sie mit FORWARD und der Telefonnummer.",
+		"pt": "Para passar o convite, responda FORWARD e o número de telefone.",
+	},
+	"forward_sent": {
+		"en": "Thanks! We've passed the invitation on to %s.",
+		"es": "¡Gracias! Hemos pasado la invitación a %s.",
+		"fr": "Merci ! Nous avons transmis l'invitation à %s.",
+		"de": "Danke! Wir haben die Einladung an %s weitergegeben.",
+		"pt": "Obrigado! Passámos o convite a %s.",
+	},
+	"already_full": {
+		"en": "Sorry, the event is already full.",
+		"es": "Lo sentimos, el evento ya está completo.",
+		"fr": "Désolé, l'événement est déjà complet.",
+		"de": "Leider ist die Veranstaltung schon voll.",
+		"pt": "Lamentamos, o evento já está lotado.",
+	},
+	"reply_yes_no": {
+		"en": "Please reply YES or NO.",
+		"es": "Responde SÍ o NO.",
+		"fr": "Répondez OUI ou NON.",
+		"de": "Bitte antworten Sie JA oder NEIN.",
+		"pt": "Responda SIM ou NÃO.",
+	},
+	"just_for_you": {
+		"en": "Sorry, this invitation is just for you.",
+		"es": "Lo sentimos, esta invitación es solo para ti.",
+		"fr": "Désolé, cette invitation est uniquement pour vous.",
+		"de": "Leider gilt diese Einladung nur für Sie.",
+		"pt": "Lamentamos, este convite é só para si.",
+	},
+	"max_guests": {
+		"en": "Sorry, you can bring up to %d guests.",
+		"es": "Lo sentimos, puedes traer hasta %d invitados.",
+		"fr": "Désolé, vous pouvez venir avec %d invités au plus.",
+		"de": "Leider können Sie höchstens %d Gäste mitbringen.",
+		"pt": "Lamentamos, pode trazer até %d convidados.",
+	},
+	"not_a_choice": {
+		"en": "Sorry, that isn't one of the choices.",
+		"es": "Lo sentimos, esa no es una de las opciones.",
+		"fr": "Désolé, ce n'est pas l'un des choix proposés.",
+		"de": "Leider ist das keine der Möglichkeiten.",
+		"pt": "Lamentamos, essa não é uma das opções.",
+	},
+	"its_on": {
+		"en": "It's on: %d said yes.",
+		"es": "Sigue adelante: %d han dicho que sí.",
+		"fr": "C'est confirmé : %d ont dit oui.",
+		"de": "Es findet statt: %d haben zugesagt.",
+		"pt": "Vai acontecer: %d disseram que sim.",
+	},
+	"its_off": {
+		"en": "It's off: not enough people could make it.",
+		"es": "Se cancela: no pueden venir suficientes personas.",
+		"fr": "C'est annulé : pas assez de personnes sont disponibles.",
+		"de": "Es fällt aus: Zu wenige können kommen.",
+		"pt": "Foi cancelado: não há pessoas suficientes.",
+	},
+	"now_full_waitlist": {
+		"en": "The event is now full, but you can still say yes to join the waitlist.",
+		"es": "El evento ya está completo, pero aún puedes decir que sí para entrar en la lista de espera.",
+		"fr": "L'événement est maintenant complet, mais vous pouvez encore dire oui pour rejoindre la liste d'attente.",
+		"de": "Die Veranstaltung ist jetzt voll, aber Sie können noch zusagen, um auf die Warteliste zu kommen.",
+		"pt": "O evento está agora lotado, mas ainda pode dizer que sim para entrar na lista de espera.",
+	},
+	"now_full": {
+		"en": "Sorry, the event is now full.",
+		"es": "Lo sentimos, el evento ya está completo.",
+		"fr": "Désolé, l'événement est maintenant complet.",
+		"de": "Leider ist die Veranstaltung jetzt voll.",
+		"pt": "Lamentamos, o evento está agora lotado.",
+	},
+	"promoted": {
+		"en": "Good news: a place has opened up, so you're in.",
+		"es": "Buenas noticias: se ha liberado una plaza, así que estás dentro.",
+		"fr": "Bonne nouvelle : une place s'est libérée, vous êtes inscrit.",
+		"de": "Gute Nachricht: Ein Platz ist frei geworden, Sie sind dabei.",
+		"pt": "Boas notícias: abriu uma vaga, por isso está dentro.",
+	},
+	"press_for": {
+		"en": "Press %d for %s.", "es": "Pulse %d para %s.", "fr": "Appuyez sur %d pour %s.", "de": "Drücken Sie %d für %s.", "pt": "Prima %d para %s.",
+	},
+	"no_answer_goodbye": {
+		"en": "We didn't get an answer. Goodbye.",
+		"es": "No hemos recibido respuesta. Adiós.",
+		"fr": "Nous n'avons pas reçu de réponse. Au revoir.",
+		"de": "Wir haben keine Antwort erhalten. Auf Wiederhören.",
+		"pt": "Não recebemos resposta. Adeus.",
+	},
+	"unsubscribed": {
+		"en": "You've been unsubscribed and won't get more invitations by text. Reply START to resubscribe.",
+		"es": "Te has dado de baja y no recibirás más invitaciones por SMS. Responde START para volver a suscribirte.",
+		"fr": "Vous êtes désinscrit et ne recevrez plus d'invitations par SMS. Répondez START pour vous réinscrire.",
+		"de": "Sie sind abgemeldet und erhalten keine Einladungen mehr per SMS. Antworten Sie START, um sich wieder anzumelden.",
+		"pt": "Cancelou a subscrição e não vai receber mais convites por SMS. Responda START para voltar a subscrever.",
+	},
+	"resubscribed": {
+		"en": "You've been resubscribed and can get invitations by text again. Reply STOP to unsubscribe.",
+		"es": "Te has vuelto a suscribir y puedes recibir invitaciones por SMS de nuevo. Responde STOP para darte de baja.",
+		"fr": "Vous êtes réinscrit et pouvez de nouveau recevoir des invitations par SMS. Répondez STOP pour vous désinscrire.",
+		"de": "Sie sind wieder angemeldet und können erneut Einladungen per SMS erhalten. Antworten Sie STOP, um sich abzumelden.",
+		"pt": "Voltou a subscrever e pode receber convites por SMS de novo. Responda STOP para cancelar a subscrição.",
+	},
+	"no_open_invitation": {
+		"en": "We couldn't find an open invitation for this number.",
+		"es": "No hemos encontrado ninguna invitación abierta para este número.",
+		"fr": "Nous n'avons trouvé aucune invitation ouverte pour ce numéro.",
+		"de": "Wir haben keine offene Einladung für diese Nummer gefunden.",
+		"pt": "Não encontrámos nenhum convite aberto para este número.",
+	},
+
+	// What hosts are told, by text, email and push.
+	"host_responded": {
+		"en": "%s responded %s: %s",
+		"es": "%s ha respondido %s: %s",
+		"fr": "%s a répondu %s : %s",
+		"de": "%s hat mit %s geantwortet: %s",
+		"pt": "%s respondeu %s: %s",
+	},
+	"host_expired": {
+		"en": "%s didn't respond before the invitation expired: %s",
+		"es": "%s no respondió antes de que caducara la invitación: %s",
+		"fr": "%s n'a pas répondu avant l'expiration de l'invitation : %s",
+		"de": "%s hat nicht geantwortet, bevor die Einladung abgelaufen ist: %s",
+		"pt": "%s não respondeu antes de o convite expirar: %s",
+	},
+	"host_forwarded": {
+		"en": "%s passed the invitation on to %s: %s",
+		"es": "%s ha pasado la invitación a %s: %s",
+		"fr": "%s a transmis l'invitation à %s : %s",
+		"de": "%s hat die Einladung an %s weitergegeben: %s",
+		"pt": "%s passou o convite a %s: %s",
+	},
+	"host_resolved": {
+		"en": "Your invitation to %s is %s: %s",
+		"es": "Tu invitación a %s está %s: %s",
+		"fr": "Votre invitation à %s est %s : %s",
+		"de": "Ihre Einladung an %s ist %s: %s",
+		"pt": "O seu convite a %s está %s: %s",
+	},
+	"host_batch_resolved": {
+		"en": "All %d invitations have resolved: %s.",
+		"es": "Las %d invitaciones se han resuelto: %s.",
+		"fr": "Les %d invitations sont résolues : %s.",
+		"de": "Alle %d Einladungen sind entschieden: %s.",
+		"pt": "Os %d convites foram resolvidos: %s.",
+	},
+	"push_title": {"en": "New response", "es": "Nueva respuesta", "fr": "Nouvelle réponse", "de": "Neue Antwort", "pt": "Nova resposta"},
+	"digest": {
+		"en": "%s: %s; deadline in %s.",
+		"es": "%s: %s; plazo en %s.",
+		"fr": "%s : %s ; échéance dans %s.",
+		"de": "%s: %s; Frist in %s.",
+		"pt": "%s: %s; prazo em %s.",
+	},
+	"digest_name":   {"en": "Your invitations", "es": "Tus invitaciones", "fr": "Vos invitations", "de": "Ihre Einladungen", "pt": "Os seus convites"},
+	"minutes_one":   {"en": "%d minute", "es": "%d minuto", "fr": "%d minute", "de": "%d Minute", "pt": "%d minuto"},
+	"minutes_other": {"en": "%d minutes", "es": "%d minutos", "fr": "%d minutes", "de": "%d Minuten", "pt": "%d minutos"},
+	"hours_one":     {"en": "%d hour", "es": "%d hora", "fr": "%d heure", "de": "%d Stunde", "pt": "%d hora"},
+	"hours_other":   {"en": "%d hours", "es": "%d horas", "fr": "%d heures", "de": "%d Stunden", "pt": "%d horas"},
+	"days_one":      {"en": "%d day", "es": "%d día", "fr": "%d jour", "de": "%d Tag", "pt": "%d dia"},
+	"days_other":    {"en": "%d days", "es": "%d días", "fr": "%d jours", "de": "%d Tagen", "pt": "%d dias"},
+	"tally_yes":     {"en": "%d yes", "es": "%d sí", "fr": "%d oui", "de": "%d ja", "pt": "%d sim"},
+	"tally_no":      {"en": "%d no", "es": "%d no", "fr": "%d non", "de": "%d nein", "pt": "%d não"},
+	"tally_other": {
+		"en": "%d other answers", "es": "%d otras respuestas", "fr": "%d autres réponses", "de": "%d andere Antworten", "pt": "%d outras respostas",
+	},
+	"tally_pending": {"en": "%d pending", "es": "%d pendientes", "fr": "%d en attente", "de": "%d offen", "pt": "%d pendentes"},
+	"tally_scheduled": {
+		"en": "%d not sent yet", "es": "%d sin enviar", "fr": "%d pas encore envoyées", "de": "%d noch nicht verschickt", "pt": "%d por enviar",
+	},
+	"tally_expired":   {"en": "%d no response", "es": "%d sin respuesta", "fr": "%d sans réponse", "de": "%d ohne Antwort", "pt": "%d sem resposta"},
+	"tally_cancelled": {"en": "%d cancelled", "es": "%d canceladas", "fr": "%d annulées", "de": "%d abgesagt", "pt": "%d cancelados"},
+	// Statuses as they read in host_resolved.
+	"status_accepted":   {"en": "accepted", "es": "aceptada", "fr": "acceptée", "de": "angenommen", "pt": "aceite"},
+	"status_declined":   {"en": "declined", "es": "rechazada", "fr": "refusée", "de": "abgelehnt", "pt": "recusado"},
+	"status_responded":  {"en": "responded", "es": "respondida", "fr": "répondue", "de": "beantwortet", "pt": "respondido"},
+	"status_waitlisted": {"en": "waitlisted", "es": "en lista de espera", "fr": "sur liste d'attente", "de": "auf der Warteliste", "pt": "em lista de espera"},
+	"status_delegated":  {"en": "delegated", "es": "reenviada", "fr": "transmise", "de": "weitergegeben", "pt": "reencaminhado"},
+	"status_expired":    {"en": "expired", "es": "caducada", "fr": "expirée", "de": "abgelaufen", "pt": "expirado"},
+	"status_cancelled":  {"en": "cancelled", "es": "cancelada", "fr": "annulée", "de": "abgesagt", "pt": "cancelado"},
+
+	// The response page.
+	"page_title": {"en": "Invitation", "es": "Invitación", "fr": "Invitation", "de": "Einladung", "pt": "Convite"},
+	"page_respond_by": {
+		"en": "Please respond by %s.",
+		"es": "Responde antes de las %s.",
+		"fr": "Merci de répondre avant %s.",
+		"de": "Bitte antworten Sie bis %s.",
+		"pt": "Responda até às %s.",
+	},
+	"page_note": {"en": "Note (optional)", "es": "Nota (opcional)", "fr": "Note (facultative)", "de": "Notiz (optional)", "pt": "Nota (opcional)"},
+	"page_guests": {
+		"en": "Guests you're bringing (up to %d)",
+		"es": "Invitados que traes (hasta %d)",
+		"fr": "Invités qui vous accompagnent (%d au plus)",
+		"de": "Gäste, die Sie mitbringen (bis zu %d)",
+		"pt": "Convidados que traz (até %d)",
+	},
+	"page_forward": {
+		"en": "Can't make it? Pass the invitation on to (phone number)",
+		"es": "¿No puedes ir? Pasa la invitación a (número de teléfono)",
+		"fr": "Vous ne pouvez pas venir ? Transmettez l'invitation à (numéro de téléphone)",
+		"de": "Sie können nicht? Geben Sie die Einladung weiter an (Telefonnummer)",
+		"pt": "Não pode ir? Passe o convite a (número de telefone)",
+	},
+	"page_forward_button": {"en": "Forward", "es": "Reenviar", "fr": "Transmettre", "de": "Weitergeben", "pt": "Reencaminhar"},
+	"confirm_code": {
+		"en": "Your code is %s. Enter it within %d minutes to confirm your answer.",
+		"es": "Tu código es %s. Introdúcelo en %d minutos para confirmar tu respuesta.",
+		"fr": "Votre code est %s. Saisissez-le dans les %d minutes pour confirmer votre réponse.",
+		"de": "Ihr Code lautet %s. Geben Sie ihn innerhalb von %d Minuten ein, um Ihre Antwort zu bestätigen.",
+		"pt": "O seu código é %s. Introduza-o em %d minutos para confirmar a sua resposta.",
+	},
+	"page_confirm": {
+		"en": "We've texted you a code. Enter it to confirm your answer.",
+		"es": "Te hemos enviado un código por SMS. Introdúcelo para confirmar tu respuesta.",
+		"fr": "Nous vous avons envoyé un code par SMS. Saisissez-le pour confirmer votre réponse.",
+		"de": "Wir haben Ihnen einen Code per SMS geschickt. Geben Sie ihn ein, um Ihre Antwort zu bestätigen.",
+		"pt": "Enviámos-lhe um código por SMS. Introduza-o para confirmar a sua resposta.",
+	},
+	"page_confirm_button": {"en": "Confirm", "es": "Confirmar", "fr": "Confirmer", "de": "Bestätigen", "pt": "Confirmar"},
+	"page_wrong_code": {
+		"en": "That code isn't right. Please try again.",
+		"es": "Ese código no es correcto. Inténtalo de nuevo.",
+		"fr": "Ce code n'est pas le bon. Veuillez réessayer.",
+		"de": "Dieser Code stimmt nicht. Bitte versuchen Sie es erneut.",
+		"pt": "Esse código não está correto. Tente novamente.",
+	},
+	"page_code_lapsed": {
+		"en": "That code is no longer valid. Please answer again for a new one.",
+		"es": "Ese código ya no es válido. Responde de nuevo para recibir otro.",
+		"fr": "Ce code n'est plus valable. Répondez à nouveau pour en recevoir un autre.",
+		"de": "Dieser Code ist nicht mehr gültig. Bitte antworten Sie erneut, um einen neuen zu erhalten.",
+		"pt": "Esse código já não é válido. Responda novamente para receber outro.",
+	},
+	"page_expired": {
+		"en": "This invitation has expired.",
+		"es": "Esta invitación ha caducado.",
+		"fr": "Cette invitation a expiré.",
+		"de": "Diese Einladung ist abgelaufen.",
+		"pt": "Este convite expirou.",
+	},
+	"page_not_sent": {
+		"en": "This invitation hasn't been sent yet.",
+		"es": "Esta invitación aún no se ha enviado.",
+		"fr": "Cette invitation n'a pas encore été envoyée.",
+		"de": "Diese Einladung wurde noch nicht verschickt.",
+		"pt": "Este convite ainda não foi enviado.",
+	},
+	"page_recorded_as": {
+		"en": "Your response has been recorded as: %s",
+		"es": "Tu respuesta se ha registrado como: %s",
+		"fr": "Votre réponse a été enregistrée : %s",
+		"de": "Ihre Antwort wurde gespeichert: %s",
+		"pt": "A sua resposta foi registada como: %s",
+	},
+	"page_already_recorded": {
+		"en": "A response has already been recorded.",
+		"es": "Ya se ha registrado una respuesta.",
+		"fr": "Une réponse a déjà été enregistrée.",
+		"de": "Es wurde bereits eine Antwort gespeichert.",
+		"pt": "Já foi registada uma resposta.",
+	},
+	"page_went_wrong": {
+		"en": "Something went wrong. Please try again later.",
+		"es": "Algo ha ido mal. Inténtalo de nuevo más tarde.",
+		"fr": "Une erreur s'est produite. Veuillez réessayer plus tard.",
+		"de": "Etwas ist schiefgelaufen. Bitte versuchen Sie es später erneut.",
+		"pt": "Ocorreu um erro. Tente novamente mais tarde.",
+	},
+}
+
+// answerWords are the words for yes and no invitees may reply with in
+// their own language, besides the English ones.
+var answerWords = map[string]map[string]string{
+	"es": {"sí": "yes", "si": "yes"},
+	"fr": {"oui": "yes", "non": "no"},
+	"de": {"ja": "yes", "nein": "no"},
+	"pt": {"sim": "yes", "não": "no", "nao": "no"},
+}
+
+// localeLanguage returns the catalog language closest to locale, English
+// when it is empty or unknown.
+func localeLanguage(locale string) language.Tag {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return catalogLanguages[0]
+	}
+	_, i, conf := localeMatcher.Match(tag)
+	if conf == language.No {
+		return catalogLanguages[0]
+	}
+	return catalogLanguages[i]
+}
+
+// localize formats the catalog message key in the language of locale.
+func localize(locale, key string, args ...any) string {
+	base, _ := localeLanguage(locale).Base()
+	format, ok := catalog[key][base.String()]
+	if !ok {
+		format = catalog[key]["en"]
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+func validateLocale(locale string) error {
+	if locale == "" {
+		return nil
+	}
+	if _, err := language.Parse(locale); err != nil {
+		return badRequest("locale must be a BCP 47 language tag such as en or pt-BR")
+	}
+	return nil
+}
+
+// titleCase capitalizes s by the rules of locale's language.
+func titleCase(locale, s string) string {
+	return cases.Title(localeLanguage(locale)).String(s)
+}
+
+// responseLabel is how a response is shown back to the invitee: yes and no
+// in their language, anything else title-cased.
+func responseLabel(locale, resp string) string {
+	switch strings.ToLower(resp) {
+	case "yes", "no":
+		return localize(locale, strings.ToLower(resp))
+	}
+	return titleCase(locale, resp)
+}
+
+// statusLabel is how status reads to a host, as it is when the catalog
+// has no word for it.
+func statusLabel(locale, status string) string {
+	if _, ok := catalog["status_"+status]; !ok {
+		return status
+	}
+	return localize(locale, "status_"+status)
+}
+
+// countText puts n of what key counts, choosing between its _one and
+// _other forms.
+func countText(locale, key string, n int) string {
+	if n == 1 {
+		return localize(locale, key+"_one", n)
+	}
+	return localize(locale, key+"_other", n)
+}
+
+// localAnswer replaces a leading yes or no in the language of locale with
+// the English word the default options use.
+func localAnswer(locale, body string) string {
+	base, _ := localeLanguage(locale).Base()
+	words := answerWords[base.String()]
+	first, rest, _ := strings.Cut(strings.TrimSpace(body), " ")
+	if en, ok := words[cases.Lower(language.Und).String(strings.Trim(first, ".!,"))]; ok {
+		return strings.TrimSpace(en + " " + rest)
+	}
+	return body
+}
+
+// tenantLocale is the default locale for invitations of the tenant in ctx.
+func (s *Server) tenantLocale(ctx context.Context) (string, error) {
+	id, _ := tenantFrom(ctx)
+	if id == "" {
+		return "", nil
+	}
+	t, err := getRecord[tenant](ctx, s.store, tenantKind, id)
+	if err == errNotFound {
+		return "", nil
+	}
+	return t.Locale, err
+}
+
+// hostLocale is the locale hosts are written to in about inv: their
+// tenant's, or failing that the invitation's.
+func (s *Server) hostLocale(ctx context.Context, inv Invitation) string {
+	if l, err := s.tenantLocale(withTenant(ctx, inv.TenantID)); err == nil && l != "" {
+		return l
+	}
+	return inv.Locale
+}
@@ -0,0 +1,134 @@
+package invitations
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCatalogComplete(t *testing.T) {
+	for key, byLang := range catalog {
+		for _, tag := range catalogLanguages {
+			base, _ := tag.Base()
+			if byLang[base.String()] == "" {
+				t.Errorf("%s has no %s", key, base)
+			}
+		}
+	}
+}
+
+// hostTexts returns what went to the host's phone.
+func (ts *testServer) hostTexts(phone string) []string {
+	ts.t.Helper()
+	ts.drainOutbox()
+	var texts []string
+	for _, m := range ts.sms.messages() {
+		if m.To == phone {
+			texts = append(texts, m.Body)
+		}
+	}
+	return texts
+}
+
+func TestHostNotificationsLocalized(t *testing.T) {
+	const host = "+14155550199"
+	ts := newTestServer(t)
+	req := invite("+14155550101")
+	req["locale"] = "es"
+	req["notify"] = map[string]any{"phone": host}
+	inv := ts.create(req)
+	if w := ts.respond(inv, "yes"); w.Code != http.StatusOK {
+		t.Fatalf("respond: got %d: %s", w.Code, w.Body)
+	}
+	if got := ts.hostTexts(host); len(got) != 1 || !strings.HasSuffix(got[0], " ha respondido Sí: Dinner at 8?") {
+		t.Errorf("host got %q, want the response in Spanish", got)
+	}
+
+	req = invite("+14155550102")
+	req["notify"] = map[string]any{"phone": host}
+	ts.create(req)
+	ts.clock.Advance(time.Hour + time.Minute)
+	if err := ts.sweepExpired(context.Background(), time.Time{}, ts.now()); err != nil {
+		t.Fatal(err)
+	}
+	got := ts.hostTexts(host)
+	if len(got) != 2 || !strings.HasSuffix(got[1], " didn't respond before the invitation expired: Dinner at 8?") {
+		t.Errorf("host got %q, want the English expiry notice last", got)
+	}
+}
+
+func TestHostLocalePrefersTenant(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	if err := putRecord(ctx, ts.store, tenantKind, "acme", tenant{ID: "acme", Locale: "de"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		inv  Invitation
+		want string
+	}{
+		{Invitation{TenantID: "acme", Locale: "es"}, "de"},
+		{Invitation{TenantID: "other", Locale: "es"}, "es"},
+		{Invitation{Locale: "fr"}, "fr"},
+	} {
+		if got := ts.hostLocale(ctx, tc.inv); got != tc.want {
+			t.Errorf("hostLocale(%+v) = %q, want %q", tc.inv, got, tc.want)
+		}
+	}
+}
+
+func TestKeywordRepliesLocalized(t *testing.T) {
+	ts := newTestServer(t, "-insecure-webhooks")
+	req := invite("+14155550101")
+	req["locale"] = "fr"
+	ts.create(req)
+
+	reply := func(from, body string) string {
+		t.Helper()
+		w := ts.postForm("/sms/inbound", url.Values{"From": {from}, "Body": {body}}, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got %d: %s", body, w.Code, w.Body)
+		}
+		var twiml struct{ Message string }
+		if err := xml.Unmarshal(w.Body.Bytes(), &twiml); err != nil {
+			t.Fatalf("%s: reply %s: %v", body, w.Body, err)
+		}
+		return twiml.Message
+	}
+	for body, key := range map[string]string{"STOP": "unsubscribed", "START": "resubscribed"} {
+		if got, want := reply("+14155550101", body), localize("fr", key); got != want {
+			t.Errorf("%s: reply %q, want %q", body, got, want)
+		}
+	}
+
+	ts.clock.Advance(2 * time.Hour)
+	if got, want := reply("+14155550101", "yes"), localize("fr", "no_open_invitation"); got != want {
+		t.Errorf("after expiry: reply %q, want %q", got, want)
+	}
+	if got, want := reply("+14155550102", "yes"), localize("", "no_open_invitation"); got != want {
+		t.Errorf("unknown number: reply %q, want %q", got, want)
+	}
+}
+
+func TestTallyAndUntilText(t *testing.T) {
+	c := batchCounts{Accepted: 2, Declined: 1, Pending: 1}
+	for _, tc := range []struct{ locale, tally, until string }{
+		{"", "2 yes, 1 no, 1 pending", "1 minute"},
+		{"fr", "2 oui, 1 non, 1 en attente", "1 minute"},
+		{"de-AT", "2 ja, 1 nein, 1 offen", "1 Minute"},
+	} {
+		if got := tallyText(tc.locale, c); got != tc.tally {
+			t.Errorf("tallyText(%q) = %q, want %q", tc.locale, got, tc.tally)
+		}
+		if got := untilText(tc.locale, time.Minute); got != tc.until {
+			t.Errorf("untilText(%q) = %q, want %q", tc.locale, got, tc.until)
+		}
+	}
+	if got := untilText("es", 3*time.Hour); got != "3 horas" {
+		t.Errorf("untilText(es, 3h) = %q", got)
+	}
+}
@@ -0,0 +1,152 @@
+package invitations
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const idempotencyKind = "idempotency"
+
+// idempotentResponse is what a replayed request gets back. RequestHash lets
+// a reused key with a different body be told apart from a genuine retry.
+type idempotentResponse struct {
+	ID          string          `json:"id"`
+	RequestHash string          `json:"request_hash"`
+	Status      int             `json:"status"`
+	Body        json.RawMessage `json:"body"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+// idempotent replays the stored response for a repeated Idempotency-Key
+// instead of running next again. Keys are scoped to the calling API key and
+// remembered for cfg.IdempotencyWindow; only successful responses are kept
+// so a failed attempt can be retried with the same key.
+func (s *Server) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > 255 {
+			writeError(w, r, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			if err := bodyError(err); err != nil {
+				writeResponseError(w, r, err)
+				return
+			}
+			writeError(w, r, http.StatusBadRequest, "failed to read request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		owner := ""
+		if k, ok := apiKeyFrom(r.Context()); ok {
+			owner = k.ID
+		}
+		id := sha256Hex(owner + "\x00" + key)
+		hash := sha256Hex(string(body))
+
+		if !s.idemInFlight.claim(id) {
+			writeError(w, r, http.StatusConflict, "a request with this Idempotency-Key is already in progress")
+			return
+		}
+		defer s.idemInFlight.release(id)
+
+		prev, err := getRecord[idempotentResponse](r.Context(), s.store, idempotencyKind, id)
+		if err == nil && s.now().Sub(prev.CreatedAt) < s.cfg.IdempotencyWindow {
+			if prev.RequestHash != hash {
+				writeError(w, r, http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request body")
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(prev.Status)
+			w.Write(prev.Body)
+			return
+		}
+		if err != nil && err != errNotFound {
+			writeResponseError(w, r, err)
+			return
+		}
+
+		rec := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+		if rec.status < 200 || rec.status >= 300 {
+			return
+		}
+		resp := idempotentResponse{ID: id, RequestHash: hash, Status: rec.status, Body: rec.body.Bytes(), CreatedAt: s.now().UTC()}
+		if err := putRecord(r.Context(), s.store, idempotencyKind, id, resp); err != nil {
+			slog.ErrorContext(r.Context(), "failed to store idempotent response", "err", err)
+		}
+	}
+}
+
+// purgeIdempotency deletes the stored responses whose window has passed as
+// of t. Ones stored before they carried their ID are left alone.
+func (s *Server) purgeIdempotency(ctx context.Context, t time.Time) error {
+	recs, err := listRecords[idempotentResponse](ctx, s.store, idempotencyKind)
+	if err != nil {
+		return err
+	}
+	for _, rec := range recs {
+		if rec.ID == "" || t.Sub(rec.CreatedAt) < s.cfg.IdempotencyWindow {
+			continue
+		}
+		if err := s.store.DeleteRecord(ctx, idempotencyKind, rec.ID); err != nil && err != errNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordingWriter copies the status and body written through it.
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// keySet tracks idempotency keys with a request currently running.
+type keySet struct {
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+func (k *keySet) claim(key string) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.keys[key] {
+		return false
+	}
+	if k.keys == nil {
+		k.keys = make(map[string]bool)
+	}
+	k.keys[key] = true
+	return true
+}
+
+func (k *keySet) release(key string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	delete(k.keys, key)
+}
@@ -0,0 +1,44 @@
+package invitations
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestIdempotencyRecordsPurgedAfterWindow(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	create := func(key, phone string) *http.Response {
+		t.Helper()
+		w := ts.do("POST", "/invitations", invite(phone), "Idempotency-Key", key)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create with key %s: got %d: %s", key, w.Code, w.Body)
+		}
+		return w.Result()
+	}
+	stored := func(key string) bool {
+		_, err := ts.store.GetRecord(ctx, idempotencyKind, sha256Hex("\x00"+key))
+		if err != nil && err != errNotFound {
+			t.Fatal(err)
+		}
+		return err == nil
+	}
+
+	create("old", "+14155550101")
+	if got := create("old", "+14155550101"); got.Header.Get("Idempotent-Replayed") != "true" {
+		t.Fatal("retry with the same key wasn't replayed")
+	}
+	ts.clock.Advance(ts.cfg.IdempotencyWindow)
+	create("new", "+14155550102")
+
+	if _, err := ts.applyRetention(ctx, ts.now()); err != nil {
+		t.Fatal(err)
+	}
+	if stored("old") {
+		t.Error("record older than the window kept")
+	}
+	if !stored("new") {
+		t.Error("record within the window purged")
+	}
+}
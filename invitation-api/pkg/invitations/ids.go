@@ -0,0 +1,64 @@
+package invitations
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+)
+
+// IDGenerator produces invitation IDs. Implementations must be safe for
+// concurrent use.
+type IDGenerator interface {
+	NewID() string
+}
+
+// uuidV7Generator emits RFC 9562 version 7 UUIDs: a millisecond timestamp
+// from the clock followed by random bits, so IDs sort roughly by creation
+// time.
+type uuidV7Generator struct {
+	clock Clock
+}
+
+func (g uuidV7Generator) NewID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic("crypto/rand: " + err.Error())
+	}
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(g.clock.Now().UnixMilli()))
+	copy(b[:6], ms[2:])
+	b[6] = b[6]&0x0f | 0x70
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// compatIDGenerator keeps the original timestamp format for clients that
+// parse it, with a random suffix to avoid collisions. The time is the
+// clock's in UTC, so IDs keep sorting across DST and timezone changes.
+type compatIDGenerator struct {
+	clock Clock
+}
+
+func (g compatIDGenerator) NewID() string {
+	return g.clock.Now().UTC().Format("20060102150405.000") + "-" + randomHex(2)
+}
+
+// newResponseToken returns the secret that identifies an invitation in its
+// short response link: 72 random bits in 12 URL-safe characters.
+func newResponseToken() string {
+	b := make([]byte, 9)
+	if _, err := rand.Read(b); err != nil {
+		panic("crypto/rand: " + err.Error())
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic("crypto/rand: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,166 @@
+package invitations
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"invitation-api/testutil"
+)
+
+var compatIDPattern = regexp.MustCompile(`^\d{14}\.\d{3}-[0-9a-f]{4}$`)
+
+func TestCompatIDsSortAcrossDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no tzdata:", err)
+	}
+	// 01:30 happens twice in New York that night; IDs in local time would
+	// go backwards an hour after the second.
+	clock := testutil.NewFakeClock(time.Date(2026, 11, 1, 0, 59, 0, 0, ny))
+	gen := compatIDGenerator{clock}
+
+	var ids []string
+	for i := 0; i < 200; i++ {
+		id := gen.NewID()
+		if !compatIDPattern.MatchString(id) {
+			t.Fatalf("ID %q isn't <timestamp>-<4 hex>", id)
+		}
+		if want := clock.Now().UTC().Format("20060102150405.000"); !strings.HasPrefix(id, want) {
+			t.Fatalf("ID %q at %v doesn't start with its UTC time %s", id, clock.Now(), want)
+		}
+		ids = append(ids, id)
+		clock.Advance(time.Minute + 7*time.Millisecond)
+	}
+	if !slices.IsSorted(ids) {
+		t.Error("IDs made one after another don't sort in the order they were made")
+	}
+}
+
+func TestCompatIDsUnique(t *testing.T) {
+	ts := newTestServer(t, "-compat-ids", "-phone-rate-limit=0")
+	ctx := context.Background()
+
+	// All at the same millisecond, so only the suffix and the collision
+	// retry keep them apart.
+	seen := map[string]bool{}
+	for i := 0; i < 300; i++ {
+		inv, err := ts.Create(ctx, CreateInvitationRequest{PhoneNumber: fmt.Sprintf("+1415555%04d", i), Message: "hi", DurationMin: 10})
+		if err != nil {
+			t.Fatalf("create %d: %v", i, err)
+		}
+		if !compatIDPattern.MatchString(inv.ID) {
+			t.Fatalf("ID %q isn't a compat ID", inv.ID)
+		}
+		if seen[inv.ID] {
+			t.Fatalf("ID %s handed out twice", inv.ID)
+		}
+		seen[inv.ID] = true
+	}
+	invs, err := ts.store.List(ctx, ListFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(invs) != len(seen) {
+		t.Errorf("stored %d invitations, want %d", len(invs), len(seen))
+	}
+}
+
+// sequenceIDs hands out its IDs in order, then numbered ones.
+type sequenceIDs struct {
+	mu  sync.Mutex
+	ids []string
+	n   int
+}
+
+func (g *sequenceIDs) NewID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.n++
+	if g.n <= len(g.ids) {
+		return g.ids[g.n-1]
+	}
+	return fmt.Sprintf("gen-%d", g.n)
+}
+
+func TestCreateRetriesIDCollision(t *testing.T) {
+	ts := newTestServer(t)
+	ts.ids = &sequenceIDs{ids: []string{"inv-a", "inv-a", "inv-b"}}
+	first := ts.create(invite("+14155550101"))
+	req := invite("+14155550102")
+	req["message"] = "Lunch at 1?"
+	second := ts.create(req)
+	if first.ID != "inv-a" || second.ID != "inv-b" {
+		t.Fatalf("created %s and %s, want inv-a and inv-b", first.ID, second.ID)
+	}
+	if got := ts.get("inv-a"); got.PhoneNumber != "+14155550101" || got.Message != first.Message {
+		t.Errorf("inv-a overwritten by the colliding create: %+v", got)
+	}
+	if w := ts.respond(first, "yes"); w.Code != http.StatusOK {
+		t.Errorf("respond to inv-a with its own token: got %d: %s", w.Code, w.Body)
+	}
+	if w := ts.respond(second, "no"); w.Code != http.StatusOK {
+		t.Errorf("respond to inv-b with its own token: got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestCreateGivesUpAfterRepeatedCollisions(t *testing.T) {
+	ts := newTestServer(t)
+	taken := &sequenceIDs{}
+	for i := 0; i <= createAttempts; i++ {
+		taken.ids = append(taken.ids, "inv-a")
+	}
+	ts.ids = taken
+	first := ts.create(invite("+14155550101"))
+
+	w := ts.do("POST", "/invitations", invite("+14155550102"))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("create with every ID taken: got %d, want 500: %s", w.Code, w.Body)
+	}
+	invs, err := ts.store.List(context.Background(), ListFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(invs) != 1 || invs[0].ID != first.ID || invs[0].PhoneNumber != first.PhoneNumber {
+		t.Errorf("stored %+v, want just the first invitation", invs)
+	}
+}
+
+func TestUUIDv7FollowsClock(t *testing.T) {
+	clock := testutil.NewFakeClock(testStart)
+	gen := uuidV7Generator{clock}
+	var ids []string
+	for i := 0; i < 100; i++ {
+		ids = append(ids, gen.NewID())
+		clock.Advance(time.Millisecond)
+	}
+	if !slices.IsSorted(ids) {
+		t.Error("IDs made a millisecond apart on the clock don't sort in the order they were made")
+	}
+	want := fmt.Sprintf("%012x", testStart.UnixMilli())
+	if got := strings.ReplaceAll(ids[0], "-", "")[:12]; got != want {
+		t.Errorf("timestamp %s, want the clock's %s", got, want)
+	}
+}
+
+var uuidV7Pattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestUUIDv7Unique(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 10000; i++ {
+		id := uuidV7Generator{systemClock{}}.NewID()
+		if !uuidV7Pattern.MatchString(id) {
+			t.Fatalf("ID %q isn't a version 7 UUID", id)
+		}
+		if seen[id] {
+			t.Fatalf("ID %s generated twice", id)
+		}
+		seen[id] = true
+	}
+}
@@ -0,0 +1,259 @@
+package invitations
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// handleInboundSMS accepts Twilio's messaging webhook, matches the sender to
+// their most recent invitation still open to an answer and replies with
+// TwiML.
+func (s *Server) handleInboundSMS(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid form body")
+		return
+	}
+	if !s.verifyTwilio(w, r) {
+		return
+	}
+
+	from := s.lookupPhone(r.PostForm.Get("From"))
+	switch body := r.PostForm.Get("Body"); {
+	case isKeyword(stopWords, body):
+		if _, err := s.suppress(r.Context(), from, "sms", ""); err != nil {
+			writeResponseError(w, r, err)
+			return
+		}
+		writeTwiML(w, localize(s.phoneLocale(r.Context(), from), "unsubscribed"))
+		return
+	case isKeyword(startWords, body):
+		if err := s.unsuppress(r.Context(), from); err != nil && err != errNotFound {
+			writeResponseError(w, r, err)
+			return
+		}
+		writeTwiML(w, localize(s.phoneLocale(r.Context(), from), "resubscribed"))
+		return
+	}
+	reply, err := s.replyFromPhone(r.Context(), from, r.PostForm.Get("Body"), viaSMS)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeTwiML(w, reply)
+}
+
+// replyFromPhone matches a text message from phone to the sender's most
+// recent invitation still open to an answer and returns what to reply.
+func (s *Server) replyFromPhone(ctx context.Context, phone, body, via string) (string, error) {
+	invs, err := s.store.List(ctx, ListFilter{PhoneNumber: phone, ExpiresAfter: s.now()})
+	if err != nil {
+		return "", err
+	}
+	// An answer can still be changed by text while it is changeable at all.
+	var open []Invitation
+	for _, inv := range invs {
+		switch inv.withStatus(s.now()).Status {
+		case statusCancelled, statusScheduled, statusExpired, statusDelegated:
+		case statusPending, statusViewed:
+			open = append(open, inv)
+		default:
+			if s.responseChangeable(inv, s.now()) {
+				open = append(open, inv)
+			}
+		}
+	}
+	if len(open) == 0 {
+		return localize(s.phoneLocale(ctx, phone), "no_open_invitation"), nil
+	}
+	// List is ordered oldest first.
+	return s.replyTo(ctx, open[len(open)-1], body, via)
+}
+
+// phoneLocale is the locale of the latest invitation to phone, for replies
+// that aren't about one that is open.
+func (s *Server) phoneLocale(ctx context.Context, phone string) string {
+	invs, err := s.store.List(ctx, ListFilter{PhoneNumber: phone})
+	if err != nil || len(invs) == 0 {
+		return ""
+	}
+	return invs[len(invs)-1].Locale
+}
+
+// replyTo records a text reply to inv and returns what to reply. Only
+// unexpected errors are returned; the invitee is told about the rest.
+func (s *Server) replyTo(ctx context.Context, latest Invitation, body, via string) (string, error) {
+	if phone, name, ok := parseSMSForward(body); ok {
+		name = truncateUTF8(name, maxForwardNameLen)
+		_, child, err := s.forwardInvitation(ctx, latest.ID, forwardInput{PhoneNumber: phone, Name: name, Via: via})
+		var re *requestError
+		if errors.As(err, &re) && re.code == codeInvalidPhoneNumber {
+			return localize(latest.Locale, "forward_hint"), nil
+		}
+		if errors.As(err, &re) {
+			return strings.ToUpper(re.msg[:1]) + re.msg[1:] + ".", nil
+		}
+		if err != nil {
+			return responseRefusal(latest.Locale, err)
+		}
+		return localize(latest.Locale, "forward_sent", inviteeName(child)), nil
+	}
+	if len(latest.ResponseOptions) == 0 {
+		body = localAnswer(latest.Locale, body)
+	}
+	resp, note, guests, ok := parseSMSReply(latest.options(), body)
+	if !ok {
+		if len(latest.ResponseOptions) == 0 {
+			return localize(latest.Locale, "reply_yes_no"), nil
+		}
+		return strings.TrimSpace(replyHint(latest.Locale, latest.ResponseOptions)), nil
+	}
+
+	if !strings.EqualFold(resp, "yes") {
+		guests = 0
+	}
+	if guests > latest.MaxGuests {
+		if latest.MaxGuests == 0 {
+			return localize(latest.Locale, "just_for_you"), nil
+		}
+		return localize(latest.Locale, "max_guests", latest.MaxGuests), nil
+	}
+
+	var answers map[string]string
+	if len(latest.Questions) > 0 {
+		answers, note, _ = parseSMSAnswers(latest.Questions, note)
+	}
+	inv, err := s.recordResponse(ctx, latest.ID, responseInput{Response: resp, Note: note, GuestCount: guests, Answers: answers, Via: via})
+	if err != nil {
+		return responseRefusal(latest.Locale, err)
+	}
+	return s.confirmationMessage(inv), nil
+}
+
+// responseRefusal is what to tell an invitee whose response recordResponse
+// refused with err, in the language of locale, or err itself when it isn't
+// the invitee's doing.
+func responseRefusal(locale string, err error) (string, error) {
+	switch err {
+	case errExpired:
+		return localize(locale, "expired"), nil
+	case errLocked:
+		return localize(locale, "already_responded"), nil
+	case errCancelled:
+		return localize(locale, "withdrawn"), nil
+	case errFull:
+		return localize(locale, "already_full"), nil
+	case errForwarded:
+		return localize(locale, "forwarded"), nil
+	}
+	return "", err
+}
+
+// parseSMSReply matches the whole body against opts, or failing that its
+// first word, keeping the rest as a note: "yes running late" records yes
+// with the note "running late". A party size can follow the answer, as in
+// "yes +2" or "yes+2".
+func parseSMSReply(opts []string, body string) (resp, note string, guests int, ok bool) {
+	if resp, ok := matchResponse(opts, body); ok {
+		return resp, "", 0, true
+	}
+	first, rest, _ := strings.Cut(strings.TrimSpace(body), " ")
+	if i := strings.Index(first, "+"); i > 0 {
+		first, rest = first[:i], first[i:]+" "+rest
+	}
+	if resp, ok := matchResponse(opts, strings.TrimSuffix(first, ",")); ok {
+		note := strings.TrimSpace(rest)
+		if word, after, _ := strings.Cut(note, " "); strings.HasPrefix(word, "+") {
+			if n, err := strconv.Atoi(word[1:]); err == nil && n >= 0 {
+				guests, note = n, strings.TrimSpace(after)
+			}
+		}
+		return resp, truncateUTF8(note, maxNoteLen), guests, true
+	}
+	return "", "", 0, false
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func writeTwiML(w http.ResponseWriter, msg string) {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(msg))
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header + "<Response><Message>" + b.String() + "</Message></Response>"))
+}
+
+// validTwilioSignature checks X-Twilio-Signature: base64 HMAC-SHA1 over the
+// full request URL followed by the sorted POST parameters.
+func (s *Server) validTwilioSignature(r *http.Request, authToken string) bool {
+	base := strings.TrimSuffix(s.cfg.PublicURL, "/")
+	if base == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		base = scheme + "://" + r.Host
+	}
+	data := base + r.URL.RequestURI()
+
+	keys := make([]string, 0, len(r.PostForm))
+	for k := range r.PostForm {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range r.PostForm[k] {
+			data += k + v
+		}
+	}
+
+	m := hmac.New(sha1.New, []byte(authToken))
+	m.Write([]byte(data))
+	want := base64.StdEncoding.EncodeToString(m.Sum(nil))
+	return hmac.Equal([]byte(want), []byte(r.Header.Get("X-Twilio-Signature")))
+}
+
+// verifyTwilio checks a Twilio webhook against TWILIO_AUTH_TOKEN; see
+// verifyWebhook.
+func (s *Server) verifyTwilio(w http.ResponseWriter, r *http.Request) bool {
+	valid := func(token string) bool { return s.validTwilioSignature(r, token) }
+	return s.verifyWebhook(w, r, "TWILIO_AUTH_TOKEN", valid, "invalid Twilio signature")
+}
+
+// verifyWebhook checks a provider webhook with valid against the secret in
+// the environment variable env, writing msg when it fails. Without the
+// secret a webhook can't be told from a forgery, which could answer or
+// unsubscribe for anyone, so it is refused unless insecure_webhooks lets it
+// through for development.
+func (s *Server) verifyWebhook(w http.ResponseWriter, r *http.Request, env string, valid func(secret string) bool, msg string) bool {
+	secret := os.Getenv(env)
+	switch {
+	case secret == "" && s.cfg.InsecureWebhooks:
+		return true
+	case secret == "":
+		writeError(w, r, http.StatusForbidden, "webhook verification is not configured")
+		return false
+	case !valid(secret):
+		writeError(w, r, http.StatusForbidden, msg)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+package invitations
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// postForm sends a Twilio-style form webhook, signed with token unless it
+// is empty.
+func (ts *testServer) postForm(path string, form url.Values, token string) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	r := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if token != "" {
+		data := "http://" + r.Host + path
+		for _, k := range []string{"Body", "From"} {
+			data += k + form.Get(k)
+		}
+		m := hmac.New(sha1.New, []byte(token))
+		m.Write([]byte(data))
+		r.Header.Set("X-Twilio-Signature", base64.StdEncoding.EncodeToString(m.Sum(nil)))
+	}
+	w := httptest.NewRecorder()
+	ts.handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestInboundSMSRequiresVerification(t *testing.T) {
+	reply := url.Values{"From": {"+14155550101"}, "Body": {"yes"}}
+
+	t.Run("no secret", func(t *testing.T) {
+		t.Setenv("TWILIO_AUTH_TOKEN", "")
+		ts := newTestServer(t)
+		inv := ts.create(invite("+14155550101"))
+		if w := ts.postForm("/sms/inbound", reply, ""); w.Code != http.StatusForbidden {
+			t.Errorf("got %d, want 403: %s", w.Code, w.Body)
+		}
+		if w := ts.postForm("/sms/status", url.Values{"MessageSid": {"SM1"}, "MessageStatus": {"delivered"}}, ""); w.Code != http.StatusForbidden {
+			t.Errorf("status callback: got %d, want 403", w.Code)
+		}
+		if got := ts.get(inv.ID); got.Response != "" {
+			t.Errorf("response = %q, want none", got.Response)
+		}
+	})
+
+	t.Run("insecure", func(t *testing.T) {
+		t.Setenv("TWILIO_AUTH_TOKEN", "")
+		ts := newTestServer(t, "-insecure-webhooks")
+		inv := ts.create(invite("+14155550101"))
+		if w := ts.postForm("/sms/inbound", reply, ""); w.Code != http.StatusOK {
+			t.Fatalf("got %d, want 200: %s", w.Code, w.Body)
+		}
+		if got := ts.get(inv.ID); got.Response != "yes" {
+			t.Errorf("response = %q, want yes", got.Response)
+		}
+	})
+
+	t.Run("signed", func(t *testing.T) {
+		t.Setenv("TWILIO_AUTH_TOKEN", "twilio-secret")
+		ts := newTestServer(t, "-insecure-webhooks")
+		inv := ts.create(invite("+14155550101"))
+		if w := ts.postForm("/sms/inbound", reply, "wrong-secret"); w.Code != http.StatusForbidden {
+			t.Errorf("bad signature: got %d, want 403", w.Code)
+		}
+		if w := ts.postForm("/sms/inbound", reply, "twilio-secret"); w.Code != http.StatusOK {
+			t.Fatalf("got %d, want 200: %s", w.Code, w.Body)
+		}
+		if got := ts.get(inv.ID); got.Response != "yes" {
+			t.Errorf("response = %q, want yes", got.Response)
+		}
+	})
+}
+
+func TestChatWebhooksRequireVerification(t *testing.T) {
+	t.Setenv("WHATSAPP_APP_SECRET", "")
+	t.Setenv("TELEGRAM_WEBHOOK_SECRET", "")
+	ts := newTestServer(t)
+	for _, path := range []string{"/whatsapp/webhook", "/telegram/webhook"} {
+		if w := ts.do("POST", path, `{}`); w.Code != http.StatusForbidden {
+			t.Errorf("%s: got %d, want 403: %s", path, w.Code, w.Body)
+		}
+	}
+}
+
+func TestSMSReplyTruncatesAtCharacter(t *testing.T) {
+	t.Setenv("TWILIO_AUTH_TOKEN", "")
+	ts := newTestServer(t, "-insecure-webhooks")
+	// Each é is two bytes, so after the a the limit falls inside one.
+	long := func(n int) string { return "a" + strings.Repeat("é", n) }
+
+	inv := ts.create(invite("+14155550101"))
+	reply := url.Values{"From": {"+14155550101"}, "Body": {"yes " + long(maxNoteLen)}}
+	if w := ts.postForm("/sms/inbound", reply, ""); w.Code != http.StatusOK {
+		t.Fatalf("reply: got %d: %s", w.Code, w.Body)
+	}
+	got := ts.get(inv.ID)
+	if !utf8.ValidString(got.Note) || len(got.Note) != maxNoteLen-1 || !strings.HasPrefix(long(maxNoteLen), got.Note) {
+		t.Errorf("note of %d bytes, valid UTF-8 %v; want the first %d bytes' whole characters", len(got.Note), utf8.ValidString(got.Note), maxNoteLen)
+	}
+
+	inv = ts.create(invite("+14155550103"))
+	reply = url.Values{"From": {"+14155550103"}, "Body": {"fwd +14155550104 " + long(maxForwardNameLen)}}
+	if w := ts.postForm("/sms/inbound", reply, ""); w.Code != http.StatusOK {
+		t.Fatalf("forward: got %d: %s", w.Code, w.Body)
+	}
+	child := ts.get(ts.get(inv.ID).ForwardedTo)
+	if !utf8.ValidString(child.ContactName) || len(child.ContactName) != maxForwardNameLen-1 {
+		t.Errorf("forwarded to %q, valid UTF-8 %v; want it cut at a character", child.ContactName, utf8.ValidString(child.ContactName))
+	}
+}
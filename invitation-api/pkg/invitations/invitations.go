@@ -0,0 +1,1419 @@
+// Package invitations is the invit-timer engine: invitations with a
+// deadline, sent over SMS and other channels, then reminded, nudged and
+// expired by background workers. The invitation-api command serves it over
+// HTTP and gRPC; other Go programs can embed it instead.
+//
+//	cfg, err := config.Load(nil)
+//	srv, err := invitations.Open(cfg)
+//	defer srv.Close()
+//	go srv.Run(ctx)
+//	inv, err := srv.Create(ctx, invitations.CreateInvitationRequest{
+//		PhoneNumber: "+15551234567",
+//		Message:     "Dinner at 7?",
+//		DurationMin: 60,
+//	})
+//
+// Handler serves the HTTP API from the embedding program's own server, and
+// NewServer takes whichever store, notifiers and clock the caller likes.
+package invitations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/mail"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Invitation struct {
+	ID              string    `json:"id"`
+	PhoneNumber     string    `json:"phone_number"`
+	PhoneRaw        string    `json:"phone_number_raw,omitempty"`
+	SealedPhone     string    `json:"sealed_phone_number,omitempty" openapi:"-"`
+	Email           string    `json:"email,omitempty"`
+	Channels        []string  `json:"channels,omitempty"`
+	Message         string    `json:"message,omitempty"`
+	ExpiresAt       time.Time `json:"expires_at"`
+	CreatedAt       time.Time `json:"created_at"`
+	SendAt          time.Time `json:"send_at,omitempty"`
+	DeferredFrom    time.Time `json:"deferred_from,omitempty"`
+	ResponseOptions []string  `json:"response_options,omitempty"`
+	Response        string    `json:"response,omitempty"`
+	// Questions are asked along with the response; Answers holds the
+	// option chosen for each, by question ID.
+	Questions      []Question                `json:"questions,omitempty"`
+	Answers        map[string]string         `json:"answers,omitempty"`
+	Note           string                    `json:"note,omitempty"`
+	GuestCount     int                       `json:"guest_count,omitempty"`
+	MaxGuests      int                       `json:"max_guests,omitempty"`
+	EventAt        time.Time                 `json:"event_at,omitempty"`
+	EventDuration  int                       `json:"event_duration_min,omitempty"`
+	Location       string                    `json:"location,omitempty"`
+	RespondedAt    time.Time                 `json:"responded_at,omitempty"`
+	ViewedAt       time.Time                 `json:"viewed_at,omitempty"`
+	Status         string                    `json:"status"`
+	CancelledAt    time.Time                 `json:"cancelled_at,omitempty"`
+	AnonymizedAt   time.Time                 `json:"anonymized_at,omitempty"`
+	ArchivedAt     time.Time                 `json:"archived_at,omitempty"` // set only on copies read from the archive
+	RestoredAt     time.Time                 `json:"restored_at,omitempty"`
+	Reminders      []Reminder                `json:"reminders,omitempty"`
+	Nudge          *NudgePolicy              `json:"nudge,omitempty"`
+	Nudges         []time.Time               `json:"nudges,omitempty"`
+	Delivery       map[string]DeliveryStatus `json:"delivery,omitempty"`
+	Timezone       string                    `json:"timezone,omitempty"`
+	Locale         string                    `json:"locale,omitempty"`
+	SMSEstimate    *SMSEstimate              `json:"sms_estimate,omitempty"`
+	ResponseToken  string                    `json:"response_token,omitempty"`
+	Messages       []DeliveryStatus          `json:"messages,omitempty"`
+	TelegramChatID string                    `json:"telegram_chat_id,omitempty"`
+	DeviceID       string                    `json:"device_id,omitempty"`
+
+	// ChannelMessages replace the invitation text on the channels they
+	// name; see channelText.
+	ChannelMessages map[string]string `json:"channel_messages,omitempty"`
+	Fallback        *FallbackPolicy   `json:"fallback,omitempty"`
+	Fallbacks       []time.Time       `json:"fallbacks,omitempty"`
+	OnExpire        *ExpiryPolicy     `json:"on_expire,omitempty"`
+	Notify          *HostNotify       `json:"notify,omitempty"`
+	FollowUps       []FollowUp        `json:"follow_ups,omitempty"`
+	// Confirm holds responses given through the link until the invitee
+	// echoes a texted code; PendingResponse is one waiting.
+	Confirm         *ConfirmPolicy   `json:"confirm,omitempty"`
+	PendingResponse *PendingResponse `json:"pending_response,omitempty"`
+	// FollowUpOf is the invitation whose follow-up sent this one.
+	FollowUpOf string `json:"follow_up_of,omitempty"`
+	// ForwardedTo is the invitation the invitee passed theirs on to, if they
+	// did, and ForwardedFrom the one this was passed on from. ForwardDepth
+	// counts the hops from the original.
+	ForwardedTo   string    `json:"forwarded_to,omitempty"`
+	ForwardedAt   time.Time `json:"forwarded_at,omitempty"`
+	ForwardedFrom string    `json:"forwarded_from,omitempty"`
+	ForwardDepth  int       `json:"forward_depth,omitempty"`
+	// Priority orders the invitation's messages in the outbox.
+	Priority string `json:"priority,omitempty"`
+
+	// Template is the unrendered message when it has placeholders; Message
+	// is re-rendered from it whenever the deadline changes.
+	TemplateID string            `json:"template_id,omitempty"`
+	Template   string            `json:"template,omitempty"`
+	Variables  map[string]string `json:"variables,omitempty"`
+
+	// Test invitations go through their whole lifecycle without reaching
+	// a provider, and are left out of usage and metrics; see testNotifier.
+	Test         bool          `json:"test,omitempty"`
+	TestResponse *TestResponse `json:"test_response,omitempty"`
+
+	CreatedByKey string `json:"created_by_key,omitempty"`
+	BatchID      string `json:"batch_id,omitempty"`
+	TenantID     string `json:"tenant_id,omitempty"`
+	ContactID    string `json:"contact_id,omitempty"`
+	ContactName  string `json:"contact_name,omitempty"`
+
+	// ExternalID and Metadata belong to the caller, for matching the
+	// invitation to records in its own systems.
+	ExternalID string            `json:"external_id,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+
+	// Tags and Notes are the host's, for sorting its invitations; invitees
+	// never see them. See normalizeTags.
+	Tags  []string `json:"tags,omitempty"`
+	Notes string   `json:"notes,omitempty"`
+
+	// WaitlistPosition is set, from 1, while a yes waits for a place in a
+	// full batch.
+	WaitlistPosition int `json:"waitlist_position,omitempty"`
+
+	// SeriesID links an occurrence of a recurring invitation to its series;
+	// Occurrence counts from 1.
+	SeriesID   string `json:"series_id,omitempty"`
+	Occurrence int    `json:"occurrence,omitempty"`
+
+	// Version counts the updates made to the invitation, by anyone, and is
+	// its ETag. UpdatedAt is when the last was made.
+	Version   int       `json:"version"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+const (
+	statusPending    = "pending"
+	statusAccepted   = "accepted"
+	statusDeclined   = "declined"
+	statusResponded  = "responded"
+	statusExpired    = "expired"
+	statusCancelled  = "cancelled"
+	statusScheduled  = "scheduled"
+	statusWaitlisted = "waitlisted"
+	statusDelegated  = "delegated"
+	statusViewed     = "viewed"
+)
+
+// withStatus returns inv with Status computed as of t. A cancellation, a
+// send that is still scheduled, or an expiry already recorded by the sweeper
+// is kept as is. An invitation passed on to someone else is delegated, and a
+// yes waiting for a place waitlisted. Answers other than yes and no count as
+// responded. An unanswered invitation whose response page has been opened is
+// viewed rather than pending.
+func (inv Invitation) withStatus(t time.Time) Invitation {
+	switch {
+	case inv.Status == statusCancelled, inv.Status == statusScheduled:
+	case !inv.ForwardedAt.IsZero():
+		inv.Status = statusDelegated
+	case inv.WaitlistPosition > 0:
+		inv.Status = statusWaitlisted
+	case strings.EqualFold(inv.Response, "yes"):
+		inv.Status = statusAccepted
+	case strings.EqualFold(inv.Response, "no"):
+		inv.Status = statusDeclined
+	case inv.Response != "":
+		inv.Status = statusResponded
+	case inv.Status == statusExpired || t.After(inv.ExpiresAt):
+		inv.Status = statusExpired
+	case !inv.ViewedAt.IsZero():
+		inv.Status = statusViewed
+	default:
+		inv.Status = statusPending
+	}
+	return inv
+}
+
+// isPending reports whether status is still waiting for an answer: pending,
+// or viewed.
+func isPending(status string) bool {
+	return status == statusPending || status == statusViewed
+}
+
+type CreateInvitationRequest struct {
+	PhoneNumber     string     `json:"phone_number"`
+	Email           string     `json:"email"`
+	Channels        []string   `json:"channels"`
+	Message         string     `json:"message"`
+	DurationMin     int        `json:"duration_min"`
+	RemindBeforeMin MinuteList `json:"remind_before_min"`
+	ResponseOptions []string   `json:"response_options"`
+	Questions       []Question `json:"questions"`
+	Timezone        string     `json:"timezone"`
+	// Locale picks the language of system messages; it defaults to the
+	// tenant's.
+	Locale string `json:"locale"`
+	// MaxGuests is how many people an invitee may bring along with a yes.
+	MaxGuests int `json:"max_guests"`
+	// EventAt, when set, is offered to accepters as a calendar entry
+	// lasting EventDurationMin, an hour by default.
+	EventAt          *time.Time `json:"event_at"`
+	EventDurationMin int        `json:"event_duration_min"`
+	Location         string     `json:"location"`
+	// SendAt delays the invitation until then; the duration counts from
+	// when it is actually sent.
+	SendAt *time.Time `json:"send_at"`
+	// Nudge defaults to the tenant's policy.
+	Nudge *NudgePolicy `json:"nudge"`
+
+	TelegramChatID  string            `json:"telegram_chat_id"`
+	DeviceID        string            `json:"device_id"`
+	ChannelMessages map[string]string `json:"channel_messages"`
+	Fallback        *FallbackPolicy   `json:"fallback"`
+	Notify          *HostNotify       `json:"notify"`
+	OnExpire        *ExpiryPolicy     `json:"on_expire"`
+	Confirm         *ConfirmPolicy    `json:"confirm"`
+	Priority        string            `json:"priority"`
+
+	TemplateID string            `json:"template_id"`
+	Variables  map[string]string `json:"variables"`
+
+	BatchID string `json:"batch_id"`
+	// AllowDuplicate creates the invitation even if the phone number has an
+	// active one in the batch and the tenant rejects or merges duplicates.
+	AllowDuplicate bool `json:"allow_duplicate"`
+
+	// ContactID addresses the invitation to an address book entry instead
+	// of, or as well as, PhoneNumber and Email; see resolveContact.
+	ContactID   string `json:"contact_id"`
+	contactName string
+
+	// FollowUps run once the invitation is answered or expires.
+	FollowUps  []FollowUp `json:"follow_ups"`
+	followUpOf string
+
+	forwardedFrom string
+	forwardDepth  int
+	// preview builds the invitation for previewInvitation, which neither
+	// counts it against rate limits nor looks for duplicates.
+	preview bool
+
+	ExternalID string            `json:"external_id"`
+	Metadata   map[string]string `json:"metadata"`
+	Tags       []string          `json:"tags"`
+	Notes      string            `json:"notes"`
+
+	// OverrideBudget creates the invitation even though the tenant has
+	// spent its monthly budget.
+	OverrideBudget bool `json:"override_budget"`
+	// TestMode makes a test invitation, as do keys created with test_mode;
+	// TestResponse is how the simulated invitee answers it.
+	TestMode     bool          `json:"test_mode"`
+	TestResponse *TestResponse `json:"test_response"`
+}
+
+// requireJSON rejects requests whose body is not declared as JSON. Endpoints
+// that accept other encodings, such as provider form posts, are not wrapped.
+func (s *Server) requireJSON(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.cfg.StrictContentType {
+			mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || mt != "application/json" {
+				writeError(w, r, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+// problem is an RFC 9457 problem details body, extended with the fields of
+// errorBody so either form carries the same information.
+type problem struct {
+	Type      string         `json:"type"`
+	Title     string         `json:"title"`
+	Status    int            `json:"status"`
+	Detail    string         `json:"detail,omitempty"`
+	Instance  string         `json:"instance,omitempty"`
+	Code      string         `json:"code"`
+	Details   map[string]any `json:"details,omitempty"`
+	RequestID string         `json:"request_id,omitempty"`
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	writeErrorFor(w, r, status, nil, msg)
+}
+
+// writeErrorFor writes msg with the code registered for err, or for status
+// when err is nil or has none.
+func writeErrorFor(w http.ResponseWriter, r *http.Request, status int, err error, msg string) {
+	writeErrorBody(w, r, status, errorBody{Code: errorCode(status, err), Message: msg})
+}
+
+func writeErrorBody(w http.ResponseWriter, r *http.Request, status int, body errorBody) {
+	body.RequestID = requestIDFrom(r.Context())
+	if !acceptsProblemJSON(r) {
+		writeJSON(w, status, body)
+		return
+	}
+
+	p := problem{
+		Type: "about:blank", Title: http.StatusText(status), Status: status, Detail: body.Message, Instance: r.URL.Path,
+		Code: body.Code, Details: body.Details, RequestID: body.RequestID,
+	}
+	if title, ok := problemTitles[body.Code]; ok {
+		p.Type = "/problems/" + strings.ReplaceAll(body.Code, "_", "-")
+		p.Title = title
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(p)
+}
+
+func acceptsProblemJSON(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, _, _ := strings.Cut(part, ";")
+		if strings.EqualFold(strings.TrimSpace(mt), "application/problem+json") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) handleCreateInvitation(w http.ResponseWriter, r *http.Request) {
+	var req CreateInvitationRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	inv, err := s.createFromRequest(r.Context(), req)
+	if err == errMerged {
+		writeJSON(w, http.StatusOK, inv)
+		return
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, inv)
+}
+
+// createFromRequest is the create operation shared by the HTTP and gRPC
+// APIs. It returns the stored invitation with its current status, or the
+// existing one and errMerged if the request was a duplicate.
+func (s *Server) createFromRequest(ctx context.Context, req CreateInvitationRequest) (Invitation, error) {
+	if !testMode(ctx, req.TestMode) {
+		if err := s.checkBudget(ctx, req.OverrideBudget); err != nil {
+			return Invitation{}, err
+		}
+	}
+	if err := s.resolveContact(ctx, &req); err != nil {
+		return Invitation{}, err
+	}
+	if err := s.resolveTemplate(ctx, &req); err != nil {
+		return Invitation{}, err
+	}
+	if req.BatchID != "" {
+		if _, err := s.store.GetRecord(ctx, batchKind, req.BatchID); err == errNotFound {
+			return Invitation{}, &requestError{status: http.StatusUnprocessableEntity, msg: "unknown batch_id"}
+		} else if err != nil {
+			return Invitation{}, err
+		}
+	}
+	inv, err := s.newInvitation(ctx, req)
+	if err == errMerged {
+		return inv.withStatus(s.now()), err
+	}
+	if err != nil {
+		return Invitation{}, err
+	}
+	if err := s.createAndNotify(ctx, &inv); err != nil {
+		return Invitation{}, err
+	}
+	return inv.withStatus(s.now()), nil
+}
+
+// requestError is a client mistake reported back with its own status.
+type requestError struct {
+	status     int
+	code       string // errorCode(status, nil) when empty
+	msg        string
+	details    map[string]any
+	retryAfter time.Duration
+}
+
+func (e *requestError) Error() string { return e.msg }
+
+func badRequest(msg string) error { return &requestError{status: http.StatusBadRequest, msg: msg} }
+
+// phoneError is the response to a phone number normalizePhone rejected.
+func phoneError(err error) error {
+	return &requestError{status: http.StatusUnprocessableEntity, code: codeInvalidPhoneNumber, msg: err.Error(), details: map[string]any{"field": "phone_number"}}
+}
+
+// validateContent checks the fields that don't depend on the recipient and
+// fills in the default channel.
+func (s *Server) validateContent(req *CreateInvitationRequest) error {
+	if req.Message == "" || req.DurationMin <= 0 {
+		return badRequest("missing required fields")
+	}
+	if req.DurationMin > s.cfg.MaxDurationMin {
+		return badRequest("duration_min must be at most " + strconv.Itoa(s.cfg.MaxDurationMin))
+	}
+	if len(req.Message) > s.cfg.MaxMessageLen {
+		return badRequest("message must be at most " + strconv.Itoa(s.cfg.MaxMessageLen) + " bytes")
+	}
+	if len(req.Channels) == 0 {
+		req.Channels = []string{channelSMS}
+	}
+	if isTemplate(req.Message) {
+		if _, err := parseTemplate(req.Message); err != nil {
+			return err
+		}
+	}
+	if err := validChannels(req.Channels); err != nil {
+		return badRequest(err.Error())
+	}
+	if err := s.validateChannelMessages(req.ChannelMessages); err != nil {
+		return err
+	}
+	if req.Fallback != nil {
+		if err := req.Fallback.validate(req.Channels, req.DurationMin); err != nil {
+			return err
+		}
+	}
+	if req.Notify != nil {
+		if err := req.Notify.validate(s.cfg.DefaultCountry); err != nil {
+			return err
+		}
+	}
+	if err := s.validateFollowUps(req.FollowUps, req.ResponseOptions); err != nil {
+		return err
+	}
+	if req.OnExpire != nil {
+		if err := req.OnExpire.validate(req.ResponseOptions, s.cfg.MaxDurationMin); err != nil {
+			return err
+		}
+	}
+	if req.Confirm != nil {
+		if err := req.Confirm.validate(); err != nil {
+			return err
+		}
+	}
+	if _, err := buildReminders(req.RemindBeforeMin, req.DurationMin, time.Time{}); err != nil {
+		return badRequest(err.Error())
+	}
+	opts, err := validateOptions(req.ResponseOptions)
+	if err != nil {
+		return err
+	}
+	req.ResponseOptions = opts
+	if req.Questions, err = validateQuestions(req.Questions); err != nil {
+		return err
+	}
+	if req.Timezone != "" {
+		if _, err := loadTimezone(req.Timezone); err != nil {
+			return err
+		}
+	}
+	if err := validateLocale(req.Locale); err != nil {
+		return err
+	}
+	if err := validatePriority(req.Priority); err != nil {
+		return err
+	}
+	if req.TestResponse != nil {
+		if err := req.TestResponse.validate(Invitation{ResponseOptions: opts}.options(), req.MaxGuests); err != nil {
+			return err
+		}
+	}
+	if req.MaxGuests < 0 || req.MaxGuests > maxGuests {
+		return badRequest("max_guests must be between 0 and " + strconv.Itoa(maxGuests))
+	}
+	if req.EventAt == nil && (req.EventDurationMin != 0 || req.Location != "") {
+		return badRequest("event_duration_min and location need event_at")
+	}
+	if req.EventAt != nil && !req.EventAt.After(s.now()) {
+		return badRequest("event_at must be in the future")
+	}
+	if req.EventDurationMin < 0 || req.EventDurationMin > s.cfg.MaxDurationMin {
+		return badRequest("event_duration_min must be between 0 and " + strconv.Itoa(s.cfg.MaxDurationMin))
+	}
+	if len(req.Location) > maxLocationLen {
+		return badRequest("location must be at most " + strconv.Itoa(maxLocationLen) + " bytes")
+	}
+	if err := validateMetadata(req.ExternalID, req.Metadata); err != nil {
+		return err
+	}
+	tags, err := normalizeTags(req.Tags)
+	if err != nil {
+		return err
+	}
+	req.Tags = tags
+	if err := validateNotes(req.Notes); err != nil {
+		return err
+	}
+	if req.Nudge != nil {
+		if err := req.Nudge.validate(); err != nil {
+			return err
+		}
+		if req.Nudge.AfterMin >= req.DurationMin {
+			return badRequest("nudge.after_min must be less than duration_min")
+		}
+	}
+	if req.SendAt != nil {
+		if !req.SendAt.After(s.now()) {
+			return badRequest("send_at must be in the future")
+		}
+		if req.SendAt.Sub(s.now()) > maxScheduleAhead {
+			return badRequest("send_at must be within a year")
+		}
+	}
+	return nil
+}
+
+const (
+	maxScheduleAhead = 365 * 24 * time.Hour
+	maxGuests        = 20
+)
+
+// newInvitation validates req and builds the invitation it describes,
+// without storing it.
+func (s *Server) newInvitation(ctx context.Context, req CreateInvitationRequest) (Invitation, error) {
+	if err := s.validateContent(&req); err != nil {
+		return Invitation{}, err
+	}
+	channels := req.Channels
+	if req.Fallback != nil {
+		channels = append(slices.Clone(channels), req.Fallback.Channels...)
+	}
+	for _, ch := range []string{channelSMS, channelVoice, channelWhatsApp} {
+		if slices.Contains(channels, ch) && req.PhoneNumber == "" {
+			return Invitation{}, badRequest("phone_number is required for the " + ch + " channel")
+		}
+	}
+	if slices.Contains(channels, channelEmail) {
+		if _, err := mail.ParseAddress(req.Email); err != nil {
+			return Invitation{}, badRequest("a valid email is required for the email channel")
+		}
+	}
+	if slices.Contains(channels, channelTelegram) {
+		if _, err := strconv.ParseInt(req.TelegramChatID, 10, 64); err != nil {
+			return Invitation{}, badRequest("a numeric telegram_chat_id is required for the telegram channel")
+		}
+	}
+	if slices.Contains(channels, channelPush) {
+		if err := s.checkInviteeDevice(ctx, req.DeviceID); err != nil {
+			return Invitation{}, err
+		}
+	}
+	if err := s.checkExternalID(ctx, req.ExternalID); err != nil {
+		return Invitation{}, err
+	}
+	if req.TestResponse != nil && !testMode(ctx, req.TestMode) {
+		return Invitation{}, badRequest("test_response needs test_mode")
+	}
+	if req.Confirm != nil && req.PhoneNumber == "" {
+		return Invitation{}, badRequest("confirm needs a phone_number to text the code to")
+	}
+	var phone string
+	if req.PhoneNumber != "" {
+		var err error
+		if phone, err = normalizePhone(req.PhoneNumber, s.cfg.DefaultCountry); err != nil {
+			return Invitation{}, phoneError(err)
+		}
+		if err := s.checkDestination(phone); err != nil {
+			return Invitation{}, err
+		}
+		if dup, err := s.checkDuplicate(ctx, phone, req.BatchID, req.AllowDuplicate || req.preview); err != nil {
+			return dup, err
+		}
+		if slices.Contains(channels, channelSMS) {
+			if optedOut, err := s.suppressed(ctx, phone); err != nil {
+				return Invitation{}, err
+			} else if optedOut {
+				return Invitation{}, &requestError{status: http.StatusForbidden, code: codeOptedOut, msg: "phone_number has opted out of SMS; the invitee can text START to opt back in"}
+			}
+		}
+		tenantID, _ := tenantFrom(ctx)
+		if !req.preview {
+			if ok, retry := s.phoneLimit.allow(tenantID+"|"+phone, s.now()); !ok {
+				return Invitation{}, &requestError{status: http.StatusTooManyRequests, msg: "too many invitations sent to this phone number", retryAfter: retry}
+			}
+		}
+	}
+
+	start := s.now()
+	if req.SendAt != nil {
+		start = *req.SendAt
+	}
+	exp := start.Add(time.Duration(req.DurationMin) * time.Minute)
+	reminders, err := buildReminders(req.RemindBeforeMin, req.DurationMin, exp)
+	if err != nil {
+		return Invitation{}, badRequest(err.Error())
+	}
+	inv := Invitation{
+		PhoneNumber: phone,
+		PhoneRaw:    req.PhoneNumber,
+		Email:       req.Email,
+		Channels:    req.Channels,
+		Message:     req.Message,
+		ExpiresAt:   exp,
+		CreatedAt:   s.now().UTC(),
+		Reminders:   reminders,
+		Nudge:       req.Nudge,
+		Fallback:    req.Fallback,
+		OnExpire:    req.OnExpire,
+		Confirm:     req.Confirm,
+		Notify:      req.Notify,
+		Priority:    req.Priority,
+		BatchID:     req.BatchID,
+		ContactID:   req.ContactID,
+		ContactName: req.contactName,
+		FollowUps:   req.FollowUps,
+		FollowUpOf:  req.followUpOf,
+
+		ForwardedFrom: req.forwardedFrom,
+		ForwardDepth:  req.forwardDepth,
+		Timezone:      req.Timezone,
+		Locale:        req.Locale,
+		TemplateID:    req.TemplateID,
+		Variables:     req.Variables,
+		ExternalID:    req.ExternalID,
+		Metadata:      req.Metadata,
+		Tags:          req.Tags,
+		Notes:         req.Notes,
+
+		Test:         testMode(ctx, req.TestMode),
+		TestResponse: req.TestResponse,
+
+		ResponseToken:   newResponseToken(),
+		TelegramChatID:  req.TelegramChatID,
+		DeviceID:        req.DeviceID,
+		ChannelMessages: req.ChannelMessages,
+
+		ResponseOptions: req.ResponseOptions,
+		Questions:       req.Questions,
+		MaxGuests:       req.MaxGuests,
+		EventDuration:   req.EventDurationMin,
+		Location:        strings.TrimSpace(req.Location),
+	}
+	if req.EventAt != nil {
+		inv.EventAt = req.EventAt.UTC()
+	}
+	if inv.Nudge == nil {
+		if inv.Nudge, err = s.tenantNudgePolicy(ctx); err != nil {
+			return Invitation{}, err
+		}
+	}
+	if inv.Locale == "" {
+		if inv.Locale, err = s.tenantLocale(ctx); err != nil {
+			return Invitation{}, err
+		}
+	}
+	if req.SendAt != nil {
+		inv.SendAt = req.SendAt.UTC()
+		inv.Status = statusScheduled
+	}
+	if err := s.deferForQuietHours(&inv, start); err != nil {
+		return Invitation{}, err
+	}
+	if isTemplate(req.Message) {
+		// Rendered now to catch missing variables; createInvitation renders
+		// again once the ID, and so the response link, is known.
+		inv.Template = req.Message
+		if err := s.renderMessage(&inv); err != nil {
+			return Invitation{}, err
+		}
+		if len(inv.Message) > s.cfg.MaxMessageLen {
+			return Invitation{}, badRequest("rendered message must be at most " + strconv.Itoa(s.cfg.MaxMessageLen) + " bytes")
+		}
+	}
+	if err := s.checkSMSLength(&inv); err != nil {
+		return Invitation{}, err
+	}
+	if k, ok := apiKeyFrom(ctx); ok {
+		inv.CreatedByKey = k.ID
+	}
+	inv.TenantID, _ = tenantFrom(ctx)
+	return inv, nil
+}
+
+// createAndNotify stores inv under a fresh ID, announces it and queues it
+// for the invitee, recording the delivery state on inv. Scheduled
+// invitations are left for the scheduler to send.
+func (s *Server) createAndNotify(ctx context.Context, inv *Invitation) error {
+	if err := s.createInvitation(ctx, inv); err != nil {
+		return err
+	}
+	if !inv.Test {
+		invitationsCreated.inc()
+	}
+	if inv.Status == statusScheduled {
+		slog.InfoContext(ctx, "invitation scheduled", "invitation_id", inv.ID, "phone", maskPhone(inv.PhoneNumber), "send_at", inv.SendAt)
+		s.record(ctx, *inv, InvitationEvent{Type: historyCreated, To: statusScheduled})
+		return nil
+	}
+	slog.InfoContext(ctx, "invitation created", "invitation_id", inv.ID, "phone", maskPhone(inv.PhoneNumber))
+	s.record(ctx, *inv, InvitationEvent{Type: historyCreated, To: statusPending})
+
+	s.sendInvitation(ctx, inv)
+	return nil
+}
+
+const createAttempts = 3
+
+// createInvitation assigns inv a fresh ID and stores it, retrying with a new
+// ID if the store reports a collision.
+func (s *Server) createInvitation(ctx context.Context, inv *Invitation) error {
+	var err error
+	for i := 0; i < createAttempts; i++ {
+		inv.ID = s.ids.NewID()
+		if err = s.renderMessage(inv); err != nil {
+			return err
+		}
+		if inv.ResponseToken != "" {
+			if err = putRecord(ctx, s.store, responseTokenKind, inv.ResponseToken, responseTokenRecord{InvitationID: inv.ID}); err != nil {
+				return err
+			}
+		}
+		if err = s.store.Create(ctx, *inv); err != errDuplicateID {
+			return err
+		}
+		slog.WarnContext(ctx, "invitation ID collision, retrying", "invitation_id", inv.ID)
+	}
+	return err
+}
+
+func (s *Server) handleCancelInvitation(w http.ResponseWriter, r *http.Request) {
+	match, err := s.readIfMatch(r)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	inv, err := s.cancelInvitation(r.Context(), r.PathValue("id"), r.URL.Query().Get("notify") == "true", match)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeInvitation(w, http.StatusOK, inv)
+}
+
+// cancelInvitation withdraws a pending or scheduled invitation, texting the
+// invitee when notify is set and they were sent it.
+func (s *Server) cancelInvitation(ctx context.Context, id string, notify bool, match ifMatch) (Invitation, error) {
+	var from string
+	inv, err := s.store.Update(ctx, id, func(inv *Invitation) error {
+		if err := match.check(*inv); err != nil {
+			return err
+		}
+		from = inv.withStatus(s.now()).Status
+		if inv.Status == statusCancelled {
+			return errAlreadyCancelled
+		}
+		if inv.withStatus(s.now()).Status == statusExpired {
+			return errExpired
+		}
+		inv.Status = statusCancelled
+		inv.CancelledAt = s.now().UTC()
+		return nil
+	})
+	if err != nil {
+		return Invitation{}, err
+	}
+	s.record(ctx, inv, InvitationEvent{Type: historyCancelled, From: from, To: statusCancelled})
+	if inv.BatchID != "" {
+		s.settleBatch(ctx, inv)
+	}
+	s.notifyHostResolved(ctx, inv, "")
+	if from == statusScheduled && inv.SeriesID != "" {
+		// Skipping one occurrence doesn't end the series.
+		if err := s.scheduleNextOccurrence(ctx, inv); err != nil {
+			slog.ErrorContext(ctx, "failed to schedule next occurrence", "invitation_id", inv.ID, "series_id", inv.SeriesID, "err", err)
+		}
+	}
+
+	if notify && from != statusScheduled {
+		s.notifyInvitee(ctx, inv, localize(inv.Locale, "withdrawn_by_host"))
+		// Recording the message made a new version.
+		if latest, err := s.store.Get(ctx, inv.ID); err == nil {
+			inv = latest
+		}
+	}
+	return inv.withStatus(s.now()), nil
+}
+
+func (s *Server) handleGetInvitation(w http.ResponseWriter, r *http.Request) {
+	if v := r.URL.Query().Get("wait"); v != "" {
+		s.waitForInvitation(w, r, v)
+		return
+	}
+	stored, err := s.store.Get(r.Context(), r.PathValue("id"))
+	if err == errNotFound && includeArchived(r) {
+		var a archivedInvitation
+		if a, err = s.getArchived(r.Context(), r.PathValue("id")); err == nil {
+			stored = a.Invitation
+		}
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	t := s.now()
+	inv, modified := stored.withStatus(t), lastModified(stored, t)
+	setValidators(w, etag(inv), modified)
+	match := etag(inv)
+	if lapsedUnswept(stored, t) {
+		// The client's copy may be from before the deadline.
+		match = ""
+	}
+	if notModified(r, match, modified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeInvitation(w, http.StatusOK, inv)
+}
+
+func (s *Server) getInvitation(ctx context.Context, id string) (Invitation, error) {
+	inv, err := s.store.Get(ctx, id)
+	if err != nil {
+		return Invitation{}, err
+	}
+	return inv.withStatus(s.now()), nil
+}
+
+func (s *Server) handleRespondInvitation(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/invitations/")
+	id = strings.TrimSuffix(id, "/respond")
+	if id == "" {
+		writeError(w, r, http.StatusBadRequest, "missing invitation ID")
+		return
+	}
+
+	var req struct {
+		Token      string            `json:"token"`
+		Response   string            `json:"response"`
+		Note       string            `json:"note"`
+		GuestCount int               `json:"guest_count"`
+		Answers    map[string]string `json:"answers"`
+		ForwardTo  *forwardTarget    `json:"forward_to"`
+		// ConfirmationCode confirms a response held by the invitation's
+		// confirm policy.
+		ConfirmationCode string `json:"confirmation_code"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if req.ConfirmationCode != "" {
+		if req.Response != "" || req.ForwardTo != nil {
+			writeError(w, r, http.StatusBadRequest, "confirmation_code can't be given with a response")
+			return
+		}
+		if _, err := s.confirmResponse(r.Context(), id, req.Token, req.ConfirmationCode, viaHTTP); err != nil {
+			writeResponseError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "response recorded"})
+		return
+	}
+	if req.ForwardTo != nil {
+		if req.Response != "" || req.GuestCount != 0 || len(req.Answers) > 0 {
+			writeError(w, r, http.StatusBadRequest, "forward_to can't be given with a response")
+			return
+		}
+		in := forwardInput{Token: req.Token, PhoneNumber: req.ForwardTo.PhoneNumber, Name: req.ForwardTo.Name, Via: viaHTTP}
+		if _, _, err := s.forwardInvitation(r.Context(), id, in); err != nil {
+			writeResponseError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "invitation forwarded"})
+		return
+	}
+	in := responseInput{Token: req.Token, Response: req.Response, Note: req.Note, GuestCount: req.GuestCount, Answers: req.Answers, Via: viaHTTP}
+	inv, err := s.respondToInvitation(r.Context(), id, in)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if inv.PendingResponse != nil {
+		writeJSON(w, http.StatusAccepted, map[string]string{"status": "confirmation code sent"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "response recorded"})
+}
+
+// respondToInvitation records an invitee's response given over an API, where
+// the note is checked and the response token is required.
+func (s *Server) respondToInvitation(ctx context.Context, id string, in responseInput) (Invitation, error) {
+	note, err := validateNote(in.Note)
+	if err != nil {
+		return Invitation{}, err
+	}
+	in.Note = note
+	return s.recordResponse(ctx, id, in)
+}
+
+func (s *Server) handleAdminRespond(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Response   string            `json:"response"`
+		Note       string            `json:"note"`
+		GuestCount int               `json:"guest_count"`
+		Answers    map[string]string `json:"answers"`
+		RecordedBy string            `json:"recorded_by"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	note, err := validateNote(req.Note)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	recordedBy := strings.TrimSpace(req.RecordedBy)
+	if recordedBy == "" {
+		writeError(w, r, http.StatusBadRequest, "recorded_by is required")
+		return
+	}
+
+	in := responseInput{Response: req.Response, Note: note, GuestCount: req.GuestCount, Answers: req.Answers, RecordedBy: recordedBy, Via: viaAdmin}
+	if _, err := s.recordResponse(r.Context(), r.PathValue("id"), in); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "response recorded"})
+}
+
+var (
+	errNotFound = errors.New("invitation not found")
+	errExpired  = errors.New("invitation has expired")
+	errLocked   = errors.New("invitation already responded to")
+
+	errCancelled        = errors.New("invitation has been cancelled")
+	errBadToken         = errors.New("invalid response token")
+	errWrongTenant      = errors.New("invitation belongs to another tenant")
+	errAlreadyCancelled = errors.New("invitation already cancelled")
+	errNotSent          = errors.New("invitation has not been sent yet")
+	errForwarded        = errors.New("invitation has been forwarded")
+
+	errDuplicateID = errors.New("duplicate invitation ID")
+)
+
+func writeResponseError(w http.ResponseWriter, r *http.Request, err error) {
+	var re *requestError
+	if errors.As(err, &re) {
+		if re.retryAfter > 0 {
+			writeRateLimited(w, r, re.retryAfter, re.msg)
+			return
+		}
+		code := re.code
+		if code == "" {
+			code = errorCode(re.status, nil)
+		}
+		writeErrorBody(w, r, re.status, errorBody{Code: code, Message: re.msg, Details: re.details})
+		return
+	}
+	switch err {
+	case errNotFound:
+		writeErrorFor(w, r, http.StatusNotFound, err, err.Error())
+	case errExpired, errCancelled:
+		writeErrorFor(w, r, http.StatusGone, err, err.Error())
+	case errLocked, errAlreadyCancelled, errNotSent, errFull, errForwarded, errNoPendingResponse:
+		writeErrorFor(w, r, http.StatusConflict, err, err.Error())
+	case errWrongCode:
+		writeErrorFor(w, r, http.StatusUnprocessableEntity, err, err.Error())
+	case errBadToken:
+		writeErrorFor(w, r, http.StatusForbidden, err, err.Error())
+	case errPreconditionFailed:
+		writeErrorFor(w, r, http.StatusPreconditionFailed, err, err.Error())
+	default:
+		slog.ErrorContext(r.Context(), "request failed", "method", r.Method, "path", r.URL.Path, "err", err)
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+	}
+}
+
+const (
+	viaHTTP     = "http"
+	viaSMS      = "sms"
+	viaAdmin    = "admin"
+	viaWeb      = "web"
+	viaGRPC     = "grpc"
+	viaVoice    = "voice"
+	viaWhatsApp = "whatsapp"
+	viaTelegram = "telegram"
+	viaApp      = "app"
+)
+
+// repliesInBand reports whether responses over via are answered in the same
+// conversation or call rather than with a separate message.
+func repliesInBand(via string) bool {
+	switch via {
+	case viaSMS, viaVoice, viaWhatsApp, viaTelegram, viaApp:
+		return true
+	}
+	return false
+}
+
+// responseInput describes a response from any channel. Response is the
+// answer as given and is matched against the invitation's options, and
+// Answers, by question ID, against its questions'.
+// RecordedBy is set when staff record a response on the invitee's behalf.
+// Token must match the invitation's response token for responses over the
+// public HTTP and gRPC endpoints, where the invitation ID alone is not proof
+// enough.
+type responseInput struct {
+	Token      string
+	Response   string
+	Note       string
+	GuestCount int
+	Answers    map[string]string
+	RecordedBy string
+	Via        string
+	// Confirmed is set once a held response's code has been checked, in
+	// place of the token.
+	Confirmed bool
+}
+
+// recordResponse applies in to the invitation and appends it to the event
+// log. Invitees are sent a confirmation unless they replied by message or
+// on a call, in which case the caller answers in-band.
+func (s *Server) recordResponse(ctx context.Context, id string, in responseInput) (Invitation, error) {
+	if (in.Via == viaHTTP || in.Via == viaGRPC) && !in.Confirmed {
+		if err := s.expiredLink(in.Token); err != nil {
+			return Invitation{}, err
+		}
+	}
+	// Answers in a batch with a capacity are taken one at a time, so a yes
+	// is checked against a count that can't change underneath it.
+	var b batch
+	var others batchCounts
+	full, unlock := false, func() {}
+	if cur, err := s.store.Get(ctx, id); err == nil {
+		var ok bool
+		b, ok, err = s.thresholdBatch(ctx, cur)
+		if err != nil {
+			return Invitation{}, err
+		}
+		if ok && b.MaxYes > 0 {
+			if unlock, err = s.locks.lock(ctx, batchLockKey(b.ID)); err != nil {
+				return Invitation{}, err
+			}
+			others, err = s.countOthers(ctx, b, id)
+			if err != nil {
+				unlock()
+				return Invitation{}, err
+			}
+			full = others.Accepted >= b.MaxYes
+		}
+	}
+
+	var current Invitation
+	var answers map[string]string
+	var answerChanges []Change
+	var code string
+	inv, err := s.store.Update(ctx, id, func(inv *Invitation) error {
+		current = *inv
+		if (in.Via == viaHTTP || in.Via == viaGRPC) && !in.Confirmed {
+			if err := s.checkResponseToken(*inv, in.Token); err != nil {
+				return err
+			}
+		}
+		if inv.Status == statusCancelled {
+			return errCancelled
+		}
+		if inv.Status == statusScheduled {
+			return errNotSent
+		}
+		if !inv.ForwardedAt.IsZero() {
+			return errForwarded
+		}
+		if s.now().After(inv.ExpiresAt) {
+			return errExpired
+		}
+		if inv.Response != "" && !s.responseChangeable(*inv, s.now()) {
+			return errLocked
+		}
+		resp, ok := matchResponse(inv.options(), in.Response)
+		if !ok {
+			return invalidResponse(inv.options())
+		}
+		if err := checkGuests(*inv, resp, in.GuestCount); err != nil {
+			return err
+		}
+		var err error
+		if answers, err = matchAnswers(inv.Questions, in.Answers); err != nil {
+			return err
+		}
+		if !in.Confirmed && needsConfirmation(*inv, in.Via) {
+			held := in
+			held.Response, held.Answers = resp, answers
+			code = s.holdResponse(inv, held)
+			return nil
+		}
+		code, inv.PendingResponse = "", nil
+		if !strings.EqualFold(resp, "yes") {
+			inv.WaitlistPosition = 0
+		} else if full && !strings.EqualFold(inv.Response, "yes") {
+			if !b.Waitlist {
+				return errFull
+			}
+			inv.WaitlistPosition = others.Waitlisted + 1
+		}
+		inv.Response = resp
+		inv.Note = in.Note
+		inv.GuestCount = in.GuestCount
+		inv.RespondedAt = s.now().UTC()
+		answerChanges = applyAnswers(inv, answers)
+		return nil
+	})
+	unlock()
+	if err == errExpired && !repliesInBand(in.Via) {
+		s.notifyInvitee(ctx, current, localize(current.Locale, "expired"))
+	}
+	if err != nil {
+		return Invitation{}, err
+	}
+	if code != "" {
+		s.sendConfirmationCode(ctx, inv, code)
+		return inv, nil
+	}
+	if !inv.Test {
+		invitationsResponded.inc(inv.withStatus(s.now()).Status, in.Via)
+	}
+	ev := InvitationEvent{
+		Type:       "responded",
+		Actor:      "invitee",
+		From:       current.withStatus(s.now()).Status,
+		To:         inv.withStatus(s.now()).Status,
+		Response:   inv.Response,
+		Note:       inv.Note,
+		GuestCount: inv.GuestCount,
+		Answers:    answers,
+		RecordedBy: in.RecordedBy,
+		Via:        in.Via,
+	}
+	if in.RecordedBy != "" {
+		ev.Actor = "admin:" + in.RecordedBy
+	}
+	if current.Response != "" {
+		ev.Type = historyResponseChanged
+		ev.Changes = []Change{{Field: "response", Old: current.Response, New: inv.Response}}
+		if current.GuestCount != inv.GuestCount {
+			ev.Changes = append(ev.Changes, Change{Field: "guest_count", Old: strconv.Itoa(current.GuestCount), New: strconv.Itoa(inv.GuestCount)})
+		}
+		ev.Changes = append(ev.Changes, answerChanges...)
+	}
+	s.record(ctx, inv, ev)
+	s.pushHosts(ctx, inv)
+	if inv.BatchID != "" {
+		s.settleBatch(ctx, inv)
+	}
+	s.notifyHostResponse(ctx, inv)
+
+	if !repliesInBand(in.Via) {
+		s.notifyInvitee(ctx, inv, s.confirmationMessage(inv))
+	}
+	return inv, nil
+}
+
+// responseChangeable reports whether the response already on inv can still
+// be changed at t: within the grace period after it was given or, if so
+// configured, until the invitation expires.
+func (s *Server) responseChangeable(inv Invitation, t time.Time) bool {
+	if s.cfg.ResponseChangeUntilExpiry {
+		return !t.After(inv.ExpiresAt)
+	}
+	return t.Sub(inv.RespondedAt) <= s.cfg.ResponseGrace
+}
+
+func (s *Server) confirmationMessage(inv Invitation) string {
+	if inv.WaitlistPosition > 0 {
+		return waitlistMessage(inv.Locale, inv.WaitlistPosition)
+	}
+	msg := localize(inv.Locale, "confirmed", responseLabel(inv.Locale, inv.Response))
+	if inv.GuestCount > 0 {
+		msg += " +" + strconv.Itoa(inv.GuestCount)
+	}
+	if link := s.calendarLink(inv); link != "" && strings.EqualFold(inv.Response, "yes") {
+		msg += localize(inv.Locale, "add_to_calendar", link)
+	}
+	return msg
+}
+
+// checkGuests validates a party size given with resp.
+func checkGuests(inv Invitation, resp string, guests int) error {
+	switch {
+	case guests == 0:
+		return nil
+	case guests < 0:
+		return badRequest("guest_count must not be negative")
+	case !strings.EqualFold(resp, "yes"):
+		return badRequest("guest_count can only be given with a yes")
+	case inv.MaxGuests == 0:
+		return badRequest("this invitation doesn't allow guests")
+	case guests > inv.MaxGuests:
+		return badRequest("guest_count must be at most " + strconv.Itoa(inv.MaxGuests))
+	}
+	return nil
+}
+
+// InvitationEvent is one entry in an invitation's append-only audit log.
+// Actor says who caused it, From and To any status change.
+type InvitationEvent struct {
+	Type       string                    `json:"type"`
+	At         time.Time                 `json:"at"`
+	Actor      string                    `json:"actor"`
+	From       string                    `json:"from_status,omitempty"`
+	To         string                    `json:"to_status,omitempty"`
+	Response   string                    `json:"response,omitempty"`
+	Note       string                    `json:"note,omitempty"`
+	GuestCount int                       `json:"guest_count,omitempty"`
+	Changes    []Change                  `json:"changes,omitempty"`
+	Message    string                    `json:"message,omitempty"`
+	Delivery   map[string]DeliveryStatus `json:"delivery,omitempty"`
+	Answers    map[string]string         `json:"answers,omitempty"`
+	OnExpire   string                    `json:"on_expire,omitempty"`
+	RecordedBy string                    `json:"recorded_by,omitempty"`
+	Via        string                    `json:"via,omitempty"`
+}
+
+func (s *Server) appendEvent(ctx context.Context, id string, ev InvitationEvent) {
+	ev.At = s.now().UTC()
+	if ev.Actor == "" {
+		ev.Actor = actorFrom(ctx)
+	}
+	if err := s.store.AppendEvent(ctx, id, ev); err != nil {
+		slog.ErrorContext(ctx, "failed to record event", "event", ev.Type, "invitation_id", id, "err", err)
+	}
+}
+
+func (s *Server) handleInvitationHistory(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	_, err := s.store.Get(r.Context(), id)
+	if err == errNotFound && includeArchived(r) {
+		var a archivedInvitation
+		if a, err = s.getArchived(r.Context(), id); err == nil {
+			history, err := s.archivedEvents(r.Context(), a)
+			if err != nil {
+				writeResponseError(w, r, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, history)
+			return
+		}
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	history, err := s.store.Events(r.Context(), id)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, history)
+}
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+)
+
+func (s *Server) handleListInvitations(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := ListFilter{
+		PhoneNumber: s.lookupPhone(q.Get("phone")),
+		BatchID:     q.Get("batch_id"),
+		SeriesID:    q.Get("series_id"),
+		ExternalID:  q.Get("external_id"),
+		Tag:         normalizeTag(q.Get("tag")),
+		Status:      q.Get("status"),
+	}
+	if _, scoped := tenantFrom(r.Context()); !scoped && q.Has("tenant_id") {
+		// Only admins list across tenants, and may narrow to one.
+		t := q.Get("tenant_id")
+		f.TenantID = &t
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, r, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxListLimit))
+			return
+		}
+		f.Limit = n
+	}
+	for param, dst := range map[string]*time.Time{"created_after": &f.CreatedAfter, "created_before": &f.CreatedBefore} {
+		v := q.Get(param)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, param+" must be an RFC 3339 timestamp")
+			return
+		}
+		*dst = t
+	}
+	if v := q.Get("cursor"); v != "" {
+		c, err := decodeCursor(v)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		f.After = c
+	}
+
+	page, err := s.listInvitations(r.Context(), f, includeArchived(r))
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+type invitationPage struct {
+	Invitations []Invitation `json:"invitations"`
+	NextCursor  string       `json:"next_cursor,omitempty"`
+}
+
+// listInvitations checks the status and limit of f, defaulting a zero
+// limit, and returns one page of matches as of now, archived ones among
+// them if archived is set.
+func (s *Server) listInvitations(ctx context.Context, f ListFilter, archived bool) (invitationPage, error) {
+	switch f.Status {
+	case "", statusPending, statusAccepted, statusDeclined, statusResponded, statusExpired, statusCancelled, statusScheduled, statusWaitlisted, statusDelegated, statusViewed:
+	default:
+		return invitationPage{}, badRequest("unknown status " + strconv.Quote(f.Status))
+	}
+	if f.Limit == 0 {
+		f.Limit = defaultListLimit
+	}
+	if f.Limit < 0 || f.Limit > maxListLimit {
+		return invitationPage{}, badRequest("limit must be between 1 and " + strconv.Itoa(maxListLimit))
+	}
+	f.AsOf = s.now()
+
+	invs, err := s.store.List(ctx, f)
+	if err != nil {
+		return invitationPage{}, err
+	}
+	if archived {
+		more, err := s.listArchived(ctx, f)
+		if err != nil {
+			return invitationPage{}, err
+		}
+		invs = append(invs, more...)
+		sortInvitations(invs)
+		if len(invs) > f.Limit {
+			invs = invs[:f.Limit]
+		}
+	}
+	page := invitationPage{Invitations: make([]Invitation, 0, len(invs))}
+	for _, inv := range invs {
+		page.Invitations = append(page.Invitations, inv.withStatus(f.AsOf))
+	}
+	if len(invs) == f.Limit {
+		last := invs[len(invs)-1]
+		page.NextCursor = ListCursor{CreatedAt: last.CreatedAt, ID: last.ID}.encode()
+	}
+	return page, nil
+}
+
+const (
+	maxExpiringSoon      = 100
+	maxExpiringWithinMin = 7 * 24 * 60
+)
+
+func (s *Server) handleExpiringSoon(w http.ResponseWriter, r *http.Request) {
+	within := 15
+	if v := r.URL.Query().Get("within_min"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxExpiringWithinMin {
+			writeError(w, r, http.StatusBadRequest, "within_min must be an integer from 1 to "+strconv.Itoa(maxExpiringWithinMin))
+			return
+		}
+		within = n
+	}
+
+	t := s.now()
+	cutoff := t.Add(time.Duration(within) * time.Minute)
+
+	// Cancelled, scheduled and delegated invitations aren't waiting on
+	// anyone, however close their deadline. One expiring at the cutoff is
+	// within the window.
+	candidates, err := s.store.List(r.Context(), ListFilter{ExpiresAfter: t, ExpiresBefore: cutoff.Add(time.Nanosecond)})
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	result := []Invitation{}
+	for _, inv := range candidates {
+		if inv = inv.withStatus(t); isPending(inv.Status) {
+			result = append(result, inv)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ExpiresAt.Before(result[j].ExpiresAt)
+	})
+	if len(result) > maxExpiringSoon {
+		result = result[:maxExpiringSoon]
+	}
+	writeJSON(w, http.StatusOK, result)
+}
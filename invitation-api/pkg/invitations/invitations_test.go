@@ -0,0 +1,236 @@
+package invitations
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestExpiringSoon(t *testing.T) {
+	ts := newTestServer(t)
+	withDuration := func(phone string, min int) map[string]any {
+		req := invite(phone)
+		req["duration_min"] = min
+		return req
+	}
+	in30 := ts.create(withDuration("+14155550101", 30))
+	in10 := ts.create(withDuration("+14155550102", 10))
+	in1 := ts.create(withDuration("+14155550103", 1))
+	in14 := ts.create(withDuration("+14155550104", 14))
+	answered := ts.create(withDuration("+14155550105", 8))
+	cancelled := ts.create(withDuration("+14155550106", 9))
+	scheduled := withDuration("+14155550107", 5)
+	scheduled["send_at"] = testStart.Add(time.Minute)
+	ts.create(scheduled)
+
+	if w := ts.respond(answered, "yes"); w.Code != http.StatusOK {
+		t.Fatalf("respond: got %d: %s", w.Code, w.Body)
+	}
+	if w := ts.do("DELETE", "/invitations/"+cancelled.ID, nil); w.Code != http.StatusOK {
+		t.Fatalf("cancel: got %d: %s", w.Code, w.Body)
+	}
+	// in1 lapses; the rest are 8 to 28 minutes out.
+	ts.clock.Advance(2 * time.Minute)
+
+	expiring := func(query string) []string {
+		t.Helper()
+		w := ts.do("GET", "/invitations/expiring-soon"+query, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("got %d: %s", w.Code, w.Body)
+		}
+		var ids []string
+		for _, inv := range decodeBody[[]Invitation](t, w) {
+			if inv.Status != statusPending {
+				t.Errorf("%s has status %q, want pending", inv.ID, inv.Status)
+			}
+			ids = append(ids, inv.ID)
+		}
+		return ids
+	}
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{in10.ID, in14.ID}},
+		{"?within_min=5", nil},
+		{"?within_min=8", []string{in10.ID}},
+		{"?within_min=60", []string{in10.ID, in14.ID, in30.ID}},
+	} {
+		if got := expiring(tc.query); !slices.Equal(got, tc.want) {
+			t.Errorf("expiring-soon%s = %v, want %v", tc.query, got, tc.want)
+		}
+	}
+	if got := expiring("?within_min=60"); slices.Contains(got, in1.ID) {
+		t.Errorf("lapsed invitation %s listed", in1.ID)
+	}
+
+	for _, within := range []string{"0", "10081", "9223372036854775807"} {
+		if w := ts.do("GET", "/invitations/expiring-soon?within_min="+within, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("within_min=%s: got %d, want 400", within, w.Code)
+		}
+	}
+}
+
+func TestChangeResponseWithinGrace(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		flags []string
+		after time.Duration
+		ok    bool
+	}{
+		{"within default grace", nil, 2 * time.Minute, true},
+		{"after default grace", nil, 2*time.Minute + time.Second, false},
+		{"within configured grace", []string{"-response-grace=10m"}, 9 * time.Minute, true},
+		{"after configured grace", []string{"-response-grace=10m"}, 11 * time.Minute, false},
+		{"no grace", []string{"-response-grace=0"}, time.Second, false},
+		{"until expiry", []string{"-response-change-until-expiry"}, 50 * time.Minute, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := newTestServer(t, tc.flags...)
+			inv := ts.create(invite("+14155550101"))
+			if w := ts.respond(inv, "yes"); w.Code != http.StatusOK {
+				t.Fatalf("respond: got %d: %s", w.Code, w.Body)
+			}
+
+			ts.clock.Advance(tc.after)
+			w := ts.respond(inv, "no")
+			want, status := http.StatusConflict, statusAccepted
+			if tc.ok {
+				want, status = http.StatusOK, statusDeclined
+			}
+			if w.Code != want {
+				t.Fatalf("change after %v: got %d, want %d: %s", tc.after, w.Code, want, w.Body)
+			}
+			if got := ts.get(inv.ID); got.Status != status {
+				t.Errorf("status = %q, want %q", got.Status, status)
+			}
+		})
+	}
+}
+
+func TestExpiredErrorRenderings(t *testing.T) {
+	ts := newTestServer(t)
+	inv := ts.create(invite("+14155550101"))
+	ts.clock.Advance(time.Hour + time.Second)
+	path := "/invitations/" + inv.ID + "/respond"
+	body := map[string]any{"token": inv.ResponseToken, "response": "yes"}
+
+	w := ts.do("POST", path, body)
+	if w.Code != http.StatusGone || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("default: got %d, %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if got := decodeBody[errorBody](t, w); got.Code != codeInvitationExpired || got.Message == "" {
+		t.Errorf("default body = %+v, want code %s and a message", got, codeInvitationExpired)
+	}
+
+	for _, accept := range []string{"application/problem+json", "application/json;q=0.5, Application/Problem+JSON; q=1"} {
+		w := ts.do("POST", path, body, "Accept", accept)
+		if w.Code != http.StatusGone || w.Header().Get("Content-Type") != "application/problem+json" {
+			t.Fatalf("Accept %q: got %d, %s", accept, w.Code, w.Header().Get("Content-Type"))
+		}
+		got := decodeBody[problem](t, w)
+		if got.Type != "/problems/invitation-expired" || got.Title != "Invitation has expired" || got.Status != http.StatusGone ||
+			got.Detail == "" || got.Instance != path || got.Code != codeInvitationExpired {
+			t.Errorf("Accept %q: problem = %+v", accept, got)
+		}
+	}
+}
+
+func TestProblemTypesFollowCode(t *testing.T) {
+	ts := newTestServer(t)
+	problemJSON := []string{"Accept", "application/problem+json"}
+
+	w := ts.do("DELETE", "/webhooks/nope", nil, problemJSON...)
+	if got := decodeBody[problem](t, w); w.Code != http.StatusNotFound || got.Type != "/problems/not-found" || got.Title != "Not found" {
+		t.Errorf("missing webhook: got %d, problem %+v", w.Code, got)
+	}
+
+	w = ts.do("POST", "/batches", map[string]any{"name": "Dinner", "max_yes": 1})
+	b := decodeBody[batch](t, w)
+	var invs []Invitation
+	for _, phone := range []string{"+14155550101", "+14155550102"} {
+		req := invite(phone)
+		req["batch_id"] = b.ID
+		invs = append(invs, ts.create(req))
+	}
+	// A no is still open to change once the only place has gone.
+	if w := ts.respond(invs[1], "no"); w.Code != http.StatusOK {
+		t.Fatalf("no: got %d: %s", w.Code, w.Body)
+	}
+	if w := ts.respond(invs[0], "yes"); w.Code != http.StatusOK {
+		t.Fatalf("yes: got %d: %s", w.Code, w.Body)
+	}
+	w = ts.do("POST", "/invitations/"+invs[1].ID+"/respond", map[string]any{"token": invs[1].ResponseToken, "response": "yes"}, problemJSON...)
+	if got := decodeBody[problem](t, w); w.Code != http.StatusConflict || got.Code != codeEventFull ||
+		got.Type != "/problems/event-full" || got.Title != "Event is full" {
+		t.Errorf("yes to a full event: got %d, problem %+v", w.Code, got)
+	}
+
+	// A code with no problem type of its own is about:blank.
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "application/problem+json")
+	rec := httptest.NewRecorder()
+	writeErrorBody(rec, r, http.StatusTeapot, errorBody{Code: "teapot", Message: "short and stout"})
+	if got := decodeBody[problem](t, rec); got.Type != "about:blank" || got.Title != http.StatusText(http.StatusTeapot) {
+		t.Errorf("unregistered code: problem %+v", got)
+	}
+}
+
+func TestEveryCodeHasProblemTitle(t *testing.T) {
+	for _, code := range errorCodes {
+		if problemTitles[code] == "" {
+			t.Errorf("no problem title for %s", code)
+		}
+	}
+}
+
+func TestCreateRequiresJSONContentType(t *testing.T) {
+	body := `{"phone_number": "+14155550101", "message": "Dinner at 8?", "duration_min": 60}`
+	for _, tc := range []struct {
+		name        string
+		flags       []string
+		contentType string
+		want        int
+	}{
+		{"json", nil, "application/json", http.StatusCreated},
+		{"json with charset", nil, "Application/JSON; charset=utf-8", http.StatusCreated},
+		{"missing", nil, "", http.StatusUnsupportedMediaType},
+		{"wrong", nil, "text/plain", http.StatusUnsupportedMediaType},
+		{"form", nil, "application/x-www-form-urlencoded", http.StatusUnsupportedMediaType},
+		{"malformed", nil, "application/", http.StatusUnsupportedMediaType},
+		{"lenient, missing", []string{"-strict-content-type=false"}, "", http.StatusCreated},
+		{"lenient, wrong", []string{"-strict-content-type=false"}, "text/plain", http.StatusCreated},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := newTestServer(t, tc.flags...)
+			w := ts.do("POST", "/invitations", body, "Content-Type", tc.contentType)
+			if w.Code != tc.want {
+				t.Fatalf("got %d, want %d: %s", w.Code, tc.want, w.Body)
+			}
+			if tc.want == http.StatusUnsupportedMediaType {
+				if got := decodeBody[errorBody](t, w); got.Code != codeUnsupportedMediaType {
+					t.Errorf("code = %q, want %q", got.Code, codeUnsupportedMediaType)
+				}
+				if invs, _ := ts.store.List(context.Background(), ListFilter{}); len(invs) != 0 {
+					t.Errorf("created %d invitations from a refused request", len(invs))
+				}
+			}
+		})
+	}
+}
+
+func TestInboundSMSExemptFromJSONContentType(t *testing.T) {
+	ts := newTestServer(t, "-insecure-webhooks")
+	inv := ts.create(invite("+14155550101"))
+	w := ts.postForm("/sms/inbound", url.Values{"From": {inv.PhoneNumber}, "Body": {"yes"}}, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("form post: got %d: %s", w.Code, w.Body)
+	}
+	if got := ts.get(inv.ID); got.Status != statusAccepted {
+		t.Errorf("status = %q, want %q", got.Status, statusAccepted)
+	}
+}
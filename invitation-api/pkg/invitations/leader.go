@@ -0,0 +1,99 @@
+package invitations
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// leaser grants named, expiring leases so that of the instances sharing a
+// store only one runs each background job. acquireLease takes the lease
+// for holder, or extends it if holder already has it, until now+ttl, and
+// reports whether holder has it.
+type leaser interface {
+	acquireLease(ctx context.Context, name, holder string, now time.Time, ttl time.Duration) (bool, error)
+	releaseLease(ctx context.Context, name, holder string) error
+}
+
+// Background jobs that must not run on several instances at once.
+const (
+	jobSweeper   = "sweeper"
+	jobScheduler = "scheduler"
+	jobOutbox    = "outbox"
+	jobRetention = "retention"
+	jobBus       = "event_bus"
+)
+
+// newInstanceID names this process as a lease holder.
+func newInstanceID() string {
+	host, _ := os.Hostname()
+	b := make([]byte, 4)
+	rand.Read(b)
+	return host + "-" + hex.EncodeToString(b)
+}
+
+// runAsLeader runs job while this instance holds the lease on name, and
+// keeps trying to take it over otherwise, so another instance picks the job
+// up within LeaseTTL of the holder dying. Without a leaser, job just runs.
+// A job that loses its lease has its context cancelled and is waited for.
+func (s *Server) runAsLeader(ctx context.Context, name string, job func(context.Context)) {
+	if s.leases == nil {
+		job(ctx)
+		return
+	}
+	ttl := s.cfg.LeaseTTL
+	renew, stopRenew := s.clock.NewTicker(ttl / 3)
+	defer stopRenew()
+
+	var stop context.CancelFunc
+	var done chan struct{}
+	var heldUntil time.Time
+	for {
+		now := s.now()
+		held, err := s.leases.acquireLease(ctx, name, s.instance, now, ttl)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.WarnContext(ctx, "failed to renew job lease", "job", name, "err", err)
+			}
+			// The lease is still ours until it runs out.
+			held = stop != nil && s.now().Before(heldUntil)
+		} else if held {
+			heldUntil = now.Add(ttl)
+		}
+		switch {
+		case held && stop == nil:
+			slog.InfoContext(ctx, "running job as leader", "job", name, "instance", s.instance)
+			var jobCtx context.Context
+			jobCtx, stop = context.WithCancel(ctx)
+			done = make(chan struct{})
+			go func() {
+				defer close(done)
+				job(jobCtx)
+			}()
+		case !held && stop != nil:
+			slog.WarnContext(ctx, "lost job lease", "job", name, "instance", s.instance)
+			stop()
+			<-done
+			stop = nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if stop != nil {
+				stop()
+				<-done
+				// Let another instance take over now rather than at expiry.
+				rctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Second)
+				if err := s.leases.releaseLease(rctx, name, s.instance); err != nil {
+					slog.WarnContext(ctx, "failed to release job lease", "job", name, "err", err)
+				}
+				cancel()
+			}
+			return
+		case <-renew:
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package invitations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// eventDelivery is only streamed live; webhooks get the lifecycle events.
+const eventDelivery = "invitation.delivery_updated"
+
+type liveEvent struct {
+	ID   uint64
+	Type string
+	Data Invitation
+}
+
+// liveHub fans invitation changes out to the streams watching the
+// invitation, its batch or its tenant's dashboard. Without a relay it is in-process, so with
+// several API instances a stream only sees changes made through the
+// instance serving it; with one, every change goes through the relay and
+// comes back to each instance's streams.
+type liveHub struct {
+	mu     sync.Mutex
+	seq    uint64
+	subs   map[string]map[chan liveEvent]struct{}
+	closed bool
+	relay  liveRelay
+}
+
+// liveRelay carries live events between API instances. subscribeLive calls
+// fn with every event published by any instance, until ctx is done or the
+// subscription fails.
+type liveRelay interface {
+	publishLive(ctx context.Context, data []byte) error
+	subscribeLive(ctx context.Context, fn func([]byte)) error
+}
+
+type relayedEvent struct {
+	Type string     `json:"type"`
+	Data Invitation `json:"data"`
+}
+
+const liveBuffer = 32
+
+func invitationTopic(id string) string { return "invitation:" + id }
+
+// batchTopic includes the tenant so one tenant's subscribers can never see
+// another's events, whatever the batch IDs.
+func batchTopic(tenant, id string) string { return "batch:" + tenant + ":" + id }
+
+func tenantTopic(tenant string) string { return "tenant:" + tenant }
+
+// subscribe returns a channel of events on topic, closed by cancel or when
+// the hub shuts down.
+func (h *liveHub) subscribe(topic string) (<-chan liveEvent, func()) {
+	ch := make(chan liveEvent, liveBuffer)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	if h.subs == nil {
+		h.subs = make(map[string]map[chan liveEvent]struct{})
+	}
+	if h.subs[topic] == nil {
+		h.subs[topic] = make(map[chan liveEvent]struct{})
+	}
+	h.subs[topic][ch] = struct{}{}
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.subs[topic][ch]; ok {
+			delete(h.subs[topic], ch)
+			if len(h.subs[topic]) == 0 {
+				delete(h.subs, topic)
+			}
+			close(ch)
+		}
+	}
+}
+
+// publish never blocks: a subscriber too slow to keep up misses events
+// rather than holding up the request that caused them. If the relay can't
+// be reached, the event is at least delivered to this instance's streams.
+func (h *liveHub) publish(event string, inv Invitation) {
+	if h.relay != nil {
+		data, err := json.Marshal(relayedEvent{Type: event, Data: inv})
+		if err == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			err = h.relay.publishLive(ctx, data)
+			cancel()
+		}
+		if err == nil {
+			return
+		}
+		slog.Warn("failed to relay live event", "invitation_id", inv.ID, "err", err)
+	}
+	h.deliver(event, inv)
+}
+
+// runRelay delivers events from the relay until ctx is done, resubscribing
+// when the subscription drops. Events published meanwhile are missed.
+func (h *liveHub) runRelay(ctx context.Context) {
+	for {
+		err := h.relay.subscribeLive(ctx, func(data []byte) {
+			var e relayedEvent
+			if err := json.Unmarshal(data, &e); err != nil {
+				slog.Warn("discarding malformed live event", "err", err)
+				return
+			}
+			h.deliver(e.Type, e.Data)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("live event relay disconnected", "err", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (h *liveHub) deliver(event string, inv Invitation) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	e := liveEvent{ID: h.seq, Type: event, Data: inv}
+	topics := []string{invitationTopic(inv.ID)}
+	if inv.BatchID != "" {
+		topics = append(topics, batchTopic(inv.TenantID, inv.BatchID))
+	}
+	topics = append(topics, tenantTopic(inv.TenantID))
+	for _, t := range topics {
+		for ch := range h.subs[t] {
+			select {
+			case ch <- e:
+			default:
+			}
+		}
+	}
+}
+
+// close ends every stream so Shutdown isn't held up by open connections.
+func (h *liveHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for _, chs := range h.subs {
+		for ch := range chs {
+			close(ch)
+		}
+	}
+	h.subs = nil
+}
+
+func (s *Server) handleInvitationStream(w http.ResponseWriter, r *http.Request) {
+	inv, err := s.store.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	s.stream(w, r, invitationTopic(inv.ID), []Invitation{inv})
+}
+
+func (s *Server) handleBatchStream(w http.ResponseWriter, r *http.Request) {
+	b, err := getRecord[batch](r.Context(), s.store, batchKind, r.PathValue("id"))
+	if err == errNotFound {
+		writeError(w, r, http.StatusNotFound, "batch not found")
+		return
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	invs, err := s.store.List(r.Context(), ListFilter{BatchID: b.ID})
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	tenant, _ := tenantFrom(r.Context())
+	s.stream(w, r, batchTopic(tenant, b.ID), invs)
+}
+
+const streamHeartbeat = 15 * time.Second
+
+// stream serves topic as Server-Sent Events, starting with a snapshot event
+// for each of current so clients needn't fetch them separately.
+func (s *Server) stream(w http.ResponseWriter, r *http.Request, topic string, current []Invitation) {
+	events, cancel := s.live.subscribe(topic)
+	defer cancel()
+
+	rc := http.NewResponseController(w)
+	// Streams outlive any WriteTimeout; the heartbeat notices dead clients.
+	_ = rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	for _, inv := range current {
+		if err := writeSSE(w, liveEvent{Type: "snapshot", Data: inv.withStatus(s.now())}); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		slog.WarnContext(r.Context(), "streaming not supported", "err", err)
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			e.Data = e.Data.withStatus(s.now())
+			if writeSSE(w, e) != nil {
+				return
+			}
+		case <-heartbeat.C:
+			// Keeps proxies from closing an idle connection.
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		}
+		if rc.Flush() != nil {
+			return
+		}
+	}
+}
+
+func writeSSE(w http.ResponseWriter, e liveEvent) error {
+	data, err := json.Marshal(e.Data)
+	if err != nil {
+		return err
+	}
+	if e.ID != 0 {
+		if _, err := fmt.Fprint(w, "id: "+strconv.FormatUint(e.ID, 10)+"\n"); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+	return err
+}
+
+const maxWait = time.Minute
+
+// waitForInvitation serves GET /invitations/{id}?wait=, holding the request
+// until the invitation's status changes or the wait elapses. A client whose
+// If-None-Match is already stale gets the invitation straight away, so one
+// that passes the ETag it last saw can't miss a change between requests.
+func (s *Server) waitForInvitation(w http.ResponseWriter, r *http.Request, v string) {
+	wait, err := time.ParseDuration(v)
+	if err != nil || wait <= 0 || wait > maxWait {
+		writeResponseError(w, r, badRequest("wait must be a duration such as 30s, at most "+maxWait.String()))
+		return
+	}
+	id := r.PathValue("id")
+	// Subscribing first means a change made while the invitation is
+	// fetched is still seen.
+	events, cancel := s.live.subscribe(invitationTopic(id))
+	defer cancel()
+	inv, err := s.getInvitation(r.Context(), id)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if m := r.Header.Get("If-None-Match"); m != "" && m != etag(inv) {
+		writeInvitation(w, http.StatusOK, inv)
+		return
+	}
+	if s.cfg.WriteTimeout > 0 {
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(wait + s.cfg.WriteTimeout))
+	}
+
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+	// Expiry changes the status without an event.
+	var expiry <-chan time.Time
+	if isPending(inv.Status) {
+		if d := inv.ExpiresAt.Sub(s.now()); d < wait {
+			t := time.NewTimer(max(d, 0) + time.Millisecond)
+			defer t.Stop()
+			expiry = t.C
+		}
+	}
+	latest := inv
+	for {
+		// The events channel closes when the server shuts down, which
+		// ends the wait early.
+		timedOut := false
+		select {
+		case <-r.Context().Done():
+			return
+		case _, ok := <-events:
+			if !ok {
+				timedOut = true
+			}
+		case <-expiry:
+		case <-timeout.C:
+			timedOut = true
+		}
+		if timedOut {
+			w.Header().Set("ETag", etag(latest))
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if latest, err = s.getInvitation(r.Context(), id); err != nil {
+			writeResponseError(w, r, err)
+			return
+		}
+		if latest.Status != inv.Status {
+			writeInvitation(w, http.StatusOK, latest)
+			return
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package invitations
+
+import (
+	"context"
+	"sync"
+)
+
+// locker serializes work on a key across everything sharing it. The
+// default is in-process; a redis store provides locks that hold across
+// API instances.
+type locker interface {
+	lock(ctx context.Context, key string) (unlock func(), err error)
+}
+
+func batchLockKey(id string) string { return "batch:" + id }
+
+// localLocks is a lock per key, forgotten once nobody holds or waits on it.
+type localLocks struct {
+	mu    sync.Mutex
+	locks map[string]*localLock
+}
+
+type localLock struct {
+	held chan struct{}
+	refs int
+}
+
+func (l *localLocks) lock(ctx context.Context, key string) (func(), error) {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*localLock)
+	}
+	k, ok := l.locks[key]
+	if !ok {
+		k = &localLock{held: make(chan struct{}, 1)}
+		l.locks[key] = k
+	}
+	k.refs++
+	l.mu.Unlock()
+
+	select {
+	case k.held <- struct{}{}:
+		return func() {
+			<-k.held
+			l.release(key, k)
+		}, nil
+	case <-ctx.Done():
+		l.release(key, k)
+		return nil, ctx.Err()
+	}
+}
+
+func (l *localLocks) release(key string, k *localLock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if k.refs--; k.refs == 0 {
+		delete(l.locks, key)
+	}
+}
@@ -0,0 +1,82 @@
+package invitations
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+type requestIDContextKey struct{}
+
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// withJobID tags a background pass so everything it logs and sends can be
+// correlated, the same way request IDs are for HTTP requests.
+func withJobID(ctx context.Context, job string) context.Context {
+	return withRequestID(ctx, job+"-"+randomHex(6))
+}
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// requestID reuses a well-formed X-Request-ID from the caller or assigns a
+// new one, and echoes it on the response.
+func requestID(r *http.Request) string {
+	if id := r.Header.Get("X-Request-ID"); validRequestID.MatchString(id) {
+		return id
+	}
+	return randomHex(8)
+}
+
+// contextHandler adds the request ID carried by the context to each record.
+type contextHandler struct{ slog.Handler }
+
+func (h contextHandler) Handle(ctx context.Context, rec slog.Record) error {
+	if id := requestIDFrom(ctx); id != "" {
+		rec.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, rec)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// NewLogger logs to stderr at level, as text or, when format is "json",
+// JSON, with each record carrying its request's ID.
+func NewLogger(format, level string) *slog.Logger {
+	var lvl slog.Level
+	lvl.UnmarshalText([]byte(level))
+	opts := &slog.HandlerOptions{Level: lvl}
+	var h slog.Handler = slog.NewTextHandler(os.Stderr, opts)
+	if format == "json" {
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	}
+	return slog.New(contextHandler{h})
+}
+
+// maskPhone keeps the country code and last four digits so logs stay useful
+// for support without recording full numbers.
+func maskPhone(p string) string {
+	if len(p) <= 6 {
+		return strings.Repeat("*", len(p))
+	}
+	head := 2
+	if !strings.HasPrefix(p, "+") {
+		head = 0
+	}
+	return p[:head] + strings.Repeat("*", len(p)-head-4) + p[len(p)-4:]
+}
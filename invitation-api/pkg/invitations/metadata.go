@@ -0,0 +1,57 @@
+package invitations
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+const (
+	maxExternalIDLen    = 200
+	maxMetadataKeys     = 50
+	maxMetadataKeyLen   = 40
+	maxMetadataValueLen = 500
+)
+
+func validateMetadata(externalID string, metadata map[string]string) error {
+	if len(externalID) > maxExternalIDLen {
+		return badRequest("external_id must be at most " + strconv.Itoa(maxExternalIDLen) + " bytes")
+	}
+	if len(metadata) > maxMetadataKeys {
+		return badRequest("metadata must have at most " + strconv.Itoa(maxMetadataKeys) + " keys")
+	}
+	for k, v := range metadata {
+		if k == "" || len(k) > maxMetadataKeyLen {
+			return badRequest("metadata keys must be 1 to " + strconv.Itoa(maxMetadataKeyLen) + " bytes")
+		}
+		if len(v) > maxMetadataValueLen {
+			return badRequest("metadata values must be at most " + strconv.Itoa(maxMetadataValueLen) + " bytes")
+		}
+	}
+	return nil
+}
+
+// checkExternalID rejects id when the tenant requires external IDs to be
+// unique and one of its invitations already has it.
+func (s *Server) checkExternalID(ctx context.Context, id string) error {
+	tenantID, _ := tenantFrom(ctx)
+	if id == "" || tenantID == "" {
+		return nil
+	}
+	t, err := getRecord[tenant](ctx, s.store, tenantKind, tenantID)
+	if err == errNotFound || (err == nil && !t.UniqueExternalIDs) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	invs, err := s.store.List(ctx, ListFilter{ExternalID: id, Limit: 1})
+	if err != nil {
+		return err
+	}
+	if len(invs) > 0 {
+		return &requestError{status: http.StatusConflict, code: codeDuplicateExternalID, msg: "external_id is already used by invitation " + invs[0].ID,
+			details: map[string]any{"invitation_id": invs[0].ID}}
+	}
+	return nil
+}
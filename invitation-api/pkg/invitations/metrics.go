@@ -0,0 +1,288 @@
+package invitations
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Metrics are process-wide, as with a Prometheus default registry, and are
+// served in the text exposition format at /metrics.
+var (
+	invitationsCreated   = newCounter("invitations_created_total", "Invitations created.")
+	invitationsResponded = newCounter("invitations_responded_total", "Responses recorded.", "status", "via")
+	invitationsExpired   = newCounter("invitations_expired_total", "Invitations expired without a response.")
+
+	smsAttempts = newCounter("sms_send_attempts_total", "SMS send attempts, including retries.", "provider")
+	smsFailures = newCounter("sms_send_failures_total", "SMS send attempts that failed.", "provider")
+
+	notifications = newCounter("notifications_total", "Invitee notifications by channel and outcome.", "channel", "status")
+
+	rateLimited = newCounter("rate_limit_rejections_total", "Requests rejected by a rate limiter.", "limiter")
+
+	httpDuration = newHistogram("http_request_duration_seconds", "HTTP request latency.",
+		[]float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}, "route", "method", "status")
+)
+
+type collector interface {
+	write(w io.Writer)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []collector
+)
+
+func register(c collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, c)
+}
+
+type series struct {
+	labels []string
+	value  float64
+	counts []uint64
+}
+
+// vec holds one series per distinct combination of label values.
+type vec struct {
+	name, help string
+	labelNames []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+func (v *vec) get(vals []string) *series {
+	if len(vals) != len(v.labelNames) {
+		panic(fmt.Sprintf("%s: got %d label values, want %d", v.name, len(vals), len(v.labelNames)))
+	}
+	key := strings.Join(vals, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labels: vals}
+		v.series[key] = s
+	}
+	return s
+}
+
+func (v *vec) sorted() []*series {
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	result := make([]*series, len(keys))
+	for i, k := range keys {
+		result[i] = v.series[k]
+	}
+	return result
+}
+
+func (v *vec) labelString(vals []string, extra ...string) string {
+	var parts []string
+	for i, name := range v.labelNames {
+		parts = append(parts, name+"="+strconv.Quote(vals[i]))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		parts = append(parts, extra[i]+"="+strconv.Quote(extra[i+1]))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+type counter struct{ vec }
+
+func newCounter(name, help string, labels ...string) *counter {
+	c := &counter{vec{name: name, help: help, labelNames: labels, series: make(map[string]*series)}}
+	register(c)
+	return c
+}
+
+func (c *counter) inc(vals ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.get(vals).value++
+}
+
+func (c *counter) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	if len(c.labelNames) == 0 && len(c.series) == 0 {
+		fmt.Fprintf(w, "%s 0\n", c.name)
+	}
+	for _, s := range c.sorted() {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.labelString(s.labels), formatFloat(s.value))
+	}
+}
+
+type histogram struct {
+	vec
+	buckets []float64
+}
+
+func newHistogram(name, help string, buckets []float64, labels ...string) *histogram {
+	h := &histogram{vec{name: name, help: help, labelNames: labels, series: make(map[string]*series)}, buckets}
+	register(h)
+	return h
+}
+
+func (h *histogram) observe(v float64, vals ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.get(vals)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(h.buckets)+1)
+	}
+	for i, b := range h.buckets {
+		if v <= b {
+			s.counts[i]++
+		}
+	}
+	s.counts[len(h.buckets)]++
+	s.value += v
+}
+
+func (h *histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for _, s := range h.sorted() {
+		for i, b := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(s.labels, "le", formatFloat(b)), s.counts[i])
+		}
+		total := s.counts[len(h.buckets)]
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(s.labels, "le", "+Inf"), total)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelString(s.labels), formatFloat(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelString(s.labels), total)
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	for _, c := range registry {
+		c.write(w)
+	}
+}
+
+// instrument gives each request an ID and a server span, logs it, and
+// records the latency of h under the path of the pattern it was registered
+// with, so IDs in paths don't create new series.
+func instrument(pattern string, h http.HandlerFunc) http.HandlerFunc {
+	route := pattern
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		route = path
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := requestID(r)
+		w.Header().Set("X-Request-ID", id)
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, pattern, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("http.route", route),
+			attribute.String("request.id", id),
+		))
+		defer span.End()
+		r = r.WithContext(withRequestID(ctx, id))
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		h(sw, r)
+		elapsed := time.Since(start)
+		span.SetAttributes(attribute.Int("http.response.status_code", sw.status))
+		if sw.status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(sw.status))
+		}
+		httpDuration.observe(elapsed.Seconds(), route, r.Method, strconv.Itoa(sw.status))
+		attrs := []any{"method", r.Method, "route", route, "status", sw.status, "latency_ms", float64(elapsed.Microseconds()) / 1000}
+		if id := r.PathValue("id"); id != "" && strings.Contains(route, "/invitations/") {
+			attrs = append(attrs, "invitation_id", id)
+		}
+		slog.InfoContext(r.Context(), "request", attrs...)
+	}
+}
+
+// statusWriter records the status of a response, and whether it has begun.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	wrote  bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	if status >= 200 || status == http.StatusSwitchingProtocols {
+		w.wrote = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wrote = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, for
+// flushing event streams.
+func (w *statusWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// Hijack is needed by the WebSocket handshake, which asserts http.Hijacker
+// rather than going through a ResponseController.
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.status, w.wrote = http.StatusSwitchingProtocols, true
+	}
+	return conn, rw, err
+}
+
+// instrumentedSender counts and traces each send attempt made through it.
+// Retries are made by the outbox, so each one is recorded individually.
+type instrumentedSender struct {
+	next     SMSSender
+	provider string
+}
+
+func (s instrumentedSender) Check(ctx context.Context) error {
+	if c, ok := s.next.(healthChecker); ok {
+		return c.Check(ctx)
+	}
+	return nil
+}
+
+func (s instrumentedSender) Send(ctx context.Context, to, body string) (string, error) {
+	ctx, span := tracer.Start(ctx, "sms.send", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("sms.provider", s.provider)))
+	smsAttempts.inc(s.provider)
+	id, err := s.next.Send(ctx, to, body)
+	if err != nil {
+		smsFailures.inc(s.provider)
+	}
+	endSpan(span, err)
+	return id, err
+}
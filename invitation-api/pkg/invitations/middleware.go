@@ -0,0 +1,100 @@
+package invitations
+
+import (
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+)
+
+// middleware wraps a handler in behavior shared between routes, such as
+// authentication or rate limiting.
+type middleware func(http.HandlerFunc) http.HandlerFunc
+
+// chain applies mws to h, the first outermost.
+func chain(h http.HandlerFunc, mws ...middleware) http.HandlerFunc {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+var handlerPanics = newCounter("http_handler_panics_total", "Requests whose handler panicked.")
+
+// recoverPanics turns a panicking handler into a logged 500 with its stack
+// trace, rather than a dropped connection and nothing in the log. If the
+// response had already begun, the connection is still dropped, since the
+// client can't be told any other way.
+func recoverPanics(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			handlerPanics.inc()
+			slog.ErrorContext(r.Context(), "handler panicked", "method", r.Method, "path", r.URL.Path,
+				"panic", v, "stack", string(debug.Stack()))
+			if sw.wrote {
+				panic(http.ErrAbortHandler)
+			}
+			writeError(w, r, http.StatusInternalServerError, "internal error")
+		}()
+		next(sw, r)
+	}
+}
+
+// corsHeaders are the request headers browsers may send cross-origin, and
+// corsExposed the response headers scripts may read.
+var (
+	corsHeaders = "Authorization, Content-Type, Idempotency-Key, If-Match, If-None-Match, If-Modified-Since, X-Request-ID"
+	corsExposed = "ETag, Last-Modified, Retry-After, X-Request-ID"
+)
+
+// cors lets browsers on CORSOrigins call the API, answering their preflight
+// requests itself. Requests from other origins are served as usual, without
+// the headers, so browsers refuse them.
+func (s *Server) cors(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		allow := s.corsOrigin(r.Header.Get("Origin"))
+		if allow == "" {
+			next(w, r)
+			return
+		}
+		h := w.Header()
+		h.Set("Access-Control-Allow-Origin", allow)
+		if allow != "*" {
+			h.Add("Vary", "Origin")
+		}
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE")
+			h.Set("Access-Control-Allow-Headers", corsHeaders)
+			h.Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.Set("Access-Control-Expose-Headers", corsExposed)
+		next(w, r)
+	}
+}
+
+// corsOrigin is the Access-Control-Allow-Origin for a request from origin,
+// or empty if it isn't allowed.
+func (s *Server) corsOrigin(origin string) string {
+	if origin == "" {
+		return ""
+	}
+	for _, o := range s.cfg.CORSOrigins {
+		switch o = strings.TrimSuffix(strings.TrimSpace(o), "/"); {
+		case o == "*":
+			return "*"
+		case strings.EqualFold(o, origin):
+			return origin
+		}
+	}
+	return ""
+}
@@ -0,0 +1,338 @@
+package invitations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"invitation-api/pkg/config"
+)
+
+// migration is one versioned change to the SQL schema. Versions are applied
+// in order, each in its own transaction with its row in schema_migrations,
+// and down undoes up.
+type migration struct {
+	version  int
+	name     string
+	up, down func(ctx context.Context, s *sqlStore, q sqlQuerier) error
+}
+
+// sqlQuerier is a *sql.Conn or *sql.Tx; the SQLite store has a single
+// connection, so migrations must not go back to the pool.
+type sqlQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// migrationLockID keys the Postgres advisory lock that stops instances
+// starting together from migrating at once.
+const migrationLockID = 7294301
+
+func execAll(stmts ...string) func(context.Context, *sqlStore, sqlQuerier) error {
+	return func(ctx context.Context, _ *sqlStore, q sqlQuerier) error {
+		for _, stmt := range stmts {
+			if _, err := q.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// indexedColumns are the invitation fields queries filter on besides the
+// original columns.
+var indexedColumns = []string{"batch_id", "tenant_id", "series_id", "external_id"}
+
+// migrations must only ever be appended to, numbered from 1 without gaps.
+// The first three are written to be safe on a database created before
+// versioning, which has some or all of their tables and columns already.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "create_tables",
+		up: func(ctx context.Context, s *sqlStore, q sqlQuerier) error {
+			eventID := "id INTEGER PRIMARY KEY AUTOINCREMENT"
+			if s.dialect == "postgres" {
+				eventID = "id BIGSERIAL PRIMARY KEY"
+			}
+			return execAll(
+				`CREATE TABLE IF NOT EXISTS invitations (
+					id TEXT PRIMARY KEY,
+					phone_number TEXT NOT NULL,
+					created_at BIGINT NOT NULL,
+					expires_at BIGINT NOT NULL,
+					data TEXT NOT NULL
+				)`,
+				`CREATE INDEX IF NOT EXISTS invitations_phone_idx ON invitations (phone_number)`,
+				`CREATE INDEX IF NOT EXISTS invitations_expires_idx ON invitations (expires_at)`,
+				`CREATE TABLE IF NOT EXISTS invitation_events (
+					`+eventID+`,
+					invitation_id TEXT NOT NULL,
+					data TEXT NOT NULL
+				)`,
+				`CREATE INDEX IF NOT EXISTS invitation_events_inv_idx ON invitation_events (invitation_id)`,
+				`CREATE TABLE IF NOT EXISTS records (
+					kind TEXT NOT NULL,
+					id TEXT NOT NULL,
+					data TEXT NOT NULL,
+					PRIMARY KEY (kind, id)
+				)`,
+				`CREATE TABLE IF NOT EXISTS leases (
+					name TEXT PRIMARY KEY,
+					holder TEXT NOT NULL,
+					expires_at BIGINT NOT NULL
+				)`,
+			)(ctx, s, q)
+		},
+		down: execAll(
+			`DROP TABLE leases`,
+			`DROP TABLE records`,
+			`DROP TABLE invitation_events`,
+			`DROP TABLE invitations`,
+		),
+	},
+	{
+		version: 2,
+		name:    "add_filter_columns",
+		up: func(ctx context.Context, s *sqlStore, q sqlQuerier) error {
+			for _, col := range indexedColumns {
+				if err := s.addColumn(ctx, q, "invitations", col, "TEXT NOT NULL DEFAULT ''"); err != nil {
+					return err
+				}
+				if _, err := q.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS invitations_`+col+`_idx ON invitations (`+col+`)`); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		down: func(ctx context.Context, _ *sqlStore, q sqlQuerier) error {
+			// The values stay in data, so nothing is lost.
+			for _, col := range indexedColumns {
+				if _, err := q.ExecContext(ctx, `DROP INDEX invitations_`+col+`_idx`); err != nil {
+					return err
+				}
+				if _, err := q.ExecContext(ctx, `ALTER TABLE invitations DROP COLUMN `+col); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		version: 3,
+		name:    "add_stats_indexes",
+		// For Stats, which reads a tenant's invitations, or everyone's,
+		// made in a period.
+		up: execAll(
+			`CREATE INDEX IF NOT EXISTS invitations_tenant_created_idx ON invitations (tenant_id, created_at)`,
+			`CREATE INDEX IF NOT EXISTS invitations_created_idx ON invitations (created_at)`,
+		),
+		down: execAll(
+			`DROP INDEX invitations_created_idx`,
+			`DROP INDEX invitations_tenant_created_idx`,
+		),
+	},
+}
+
+func latestSchemaVersion() int { return migrations[len(migrations)-1].version }
+
+// schemaVersion returns the last migration applied, 0 for a database that
+// predates versioning or is empty.
+func (s *sqlStore) schemaVersion(ctx context.Context, q sqlQuerier) (int, error) {
+	if _, err := q.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at BIGINT NOT NULL
+	)`); err != nil {
+		return 0, err
+	}
+	var v int
+	err := q.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&v)
+	return v, err
+}
+
+// checkSchema refuses a database whose schema isn't the one this build
+// was written for.
+func (s *sqlStore) checkSchema(ctx context.Context) error {
+	v, err := s.schemaVersion(ctx, s.db)
+	if err != nil {
+		return err
+	}
+	switch latest := latestSchemaVersion(); {
+	case v < latest:
+		return fmt.Errorf("database schema is at version %d but this build needs %d; run `invitation-api migrate up` or enable auto_migrate", v, latest)
+	case v > latest:
+		return newerSchemaError(v)
+	}
+	return nil
+}
+
+func newerSchemaError(v int) error {
+	latest := latestSchemaVersion()
+	return fmt.Errorf("database schema is at version %d, newer than this build's %d; upgrade, or run `invitation-api migrate to %d` with the newer build", v, latest, latest)
+}
+
+// migrateTo applies or rolls back migrations until the schema is at
+// version target, returning the migrations it ran.
+func (s *sqlStore) migrateTo(ctx context.Context, target int) ([]migration, error) {
+	if target < 0 || target > latestSchemaVersion() {
+		return nil, fmt.Errorf("no schema version %d; the latest is %d", target, latestSchemaVersion())
+	}
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if s.dialect == "postgres" {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+			return nil, err
+		}
+		defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+	}
+	v, err := s.schemaVersion(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	if v > latestSchemaVersion() {
+		return nil, newerSchemaError(v)
+	}
+
+	var ran []migration
+	for v != target {
+		var m migration
+		if v < target {
+			m = migrations[v]
+		} else {
+			m = migrations[v-1]
+		}
+		if err := s.runMigration(ctx, conn, m, v < target); err != nil {
+			return ran, fmt.Errorf("migration %d %s: %w", m.version, m.name, err)
+		}
+		ran = append(ran, m)
+		if v < target {
+			v = m.version
+		} else {
+			v = m.version - 1
+		}
+	}
+	return ran, nil
+}
+
+func (s *sqlStore) runMigration(ctx context.Context, conn *sql.Conn, m migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if up {
+		err = m.up(ctx, s, tx)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, s.rebind(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`), m.version, m.name, time.Now().UnixMilli())
+		}
+	} else {
+		err = m.down(ctx, s, tx)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, s.rebind(`DELETE FROM schema_migrations WHERE version = ?`), m.version)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// prepareSchema brings the schema up to date on startup when migrate is
+// set, and otherwise only checks it.
+func (s *sqlStore) prepareSchema(ctx context.Context, migrate bool) error {
+	if migrate {
+		ran, err := s.migrateTo(ctx, latestSchemaVersion())
+		for _, m := range ran {
+			slog.Info("applied database migration", "version", m.version, "name", m.name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return s.checkSchema(ctx)
+}
+
+// Migrate is the migrate subcommand:
+//
+//	invitation-api migrate [status|up|down|to <version>] [flags]
+//
+// down rolls back one migration. The flags are the server's, for finding
+// the database.
+func Migrate(args []string) error {
+	action := "status"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		action, args = args[0], args[1:]
+	}
+	target := -1
+	if action == "to" {
+		if len(args) == 0 {
+			return errors.New("usage: invitation-api migrate to <version>")
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[0])
+		}
+		target, args = n, args[1:]
+	}
+	cfg, err := config.Load(args)
+	if err != nil {
+		return err
+	}
+	if cfg.Store != "sqlite" && cfg.Store != "postgres" {
+		return fmt.Errorf("the %s store has no schema to migrate", cfg.Store)
+	}
+	s, err := openSQLDatabase(cfg.Store, cfg.DBDSN)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	ctx := context.Background()
+
+	v, err := s.schemaVersion(ctx, s.db)
+	if err != nil {
+		return err
+	}
+	switch action {
+	case "status":
+		for _, m := range migrations {
+			state := "pending"
+			if m.version <= v {
+				state = "applied"
+			}
+			fmt.Printf("%4d  %-24s %s\n", m.version, m.name, state)
+		}
+		fmt.Printf("schema version %d of %d\n", v, latestSchemaVersion())
+		return nil
+	case "up":
+		target = latestSchemaVersion()
+	case "down":
+		if v == 0 {
+			return errors.New("no migrations to roll back")
+		}
+		target = v - 1
+	case "to":
+	default:
+		return fmt.Errorf("unknown migrate action %q; use status, up, down or to", action)
+	}
+	ran, err := s.migrateTo(ctx, target)
+	for _, m := range ran {
+		verb := "applied"
+		if m.version > target {
+			verb = "rolled back"
+		}
+		fmt.Printf("%s %d %s\n", verb, m.version, m.name)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("schema version %d\n", target)
+	return nil
+}
@@ -0,0 +1,166 @@
+package invitations
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// natsClient speaks just enough of the NATS client protocol to publish:
+// CONNECT, HPUB, and PING to learn the server has processed what came
+// before it. One connection is kept, and redialled after a failure.
+type natsClient struct {
+	addr  string
+	tls   *tls.Config
+	user  string
+	pass  string
+	token string
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+const natsTimeout = 5 * time.Second
+
+// newNATSClient parses a nats:// or tls:// URL of the form
+// nats://[user:password@]host[:port]; a user alone is a token.
+func newNATSClient(rawURL string) (*natsClient, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NATS URL: %w", err)
+	}
+	c := &natsClient{addr: u.Host}
+	switch u.Scheme {
+	case "nats":
+	case "tls":
+		c.tls = &tls.Config{ServerName: u.Hostname()}
+	default:
+		return nil, fmt.Errorf("NATS URL must start with nats:// or tls://, not %q", u.Scheme+"://")
+	}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			c.user, c.pass = u.User.Username(), pass
+		} else {
+			c.token = u.User.Username()
+		}
+	}
+	return c, nil
+}
+
+// dial connects and logs in. The server speaks first, with INFO, and
+// connections are upgraded to TLS only after it.
+func (c *natsClient) dial(ctx context.Context) error {
+	conn, err := (&net.Dialer{Timeout: natsTimeout}).DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(natsTimeout))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return fmt.Errorf("nats: unexpected greeting %q", strings.TrimSpace(line))
+	}
+	if c.tls != nil {
+		tc := tls.Client(conn, c.tls)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return err
+		}
+		conn = tc
+	}
+	login := map[string]any{"verbose": false, "pedantic": false, "headers": true, "name": "invitation-api", "lang": "go", "version": "1", "protocol": 1}
+	if c.token != "" {
+		login["auth_token"] = c.token
+	} else if c.user != "" {
+		login["user"], login["pass"] = c.user, c.pass
+	}
+	opts, _ := json.Marshal(login)
+	c.conn, c.r = conn, bufio.NewReader(conn)
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\n", opts); err != nil {
+		c.close()
+		return err
+	}
+	if err := c.ping(); err != nil {
+		c.close()
+		return err
+	}
+	return nil
+}
+
+// ping waits for the server to answer a PING, which it does only after
+// handling everything sent before. Errors it reports meanwhile, such as
+// a failed login or a refused publish, are returned instead.
+func (c *natsClient) ping() error {
+	if _, err := c.conn.Write([]byte("PING\r\n")); err != nil {
+		return err
+	}
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := c.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New("nats: " + strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")), "'"))
+		}
+	}
+}
+
+func (c *natsClient) close() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn, c.r = nil, nil
+	}
+}
+
+// publish sends data on subject with a Nats-Msg-Id header, which JetStream
+// streams use to drop repeats, and returns once the server has it.
+func (c *natsClient) publish(ctx context.Context, subject, id string, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		if err := c.dial(ctx); err != nil {
+			return err
+		}
+	}
+	deadline := time.Now().Add(natsTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.conn.SetDeadline(deadline)
+	hdr := "NATS/1.0\r\nNats-Msg-Id: " + id + "\r\n\r\n"
+	msg := "HPUB " + subject + " " + strconv.Itoa(len(hdr)) + " " + strconv.Itoa(len(hdr)+len(data)) + "\r\n" + hdr + string(data) + "\r\n"
+	_, err := c.conn.Write([]byte(msg))
+	if err == nil {
+		err = c.ping()
+	}
+	if err != nil {
+		// Replies may be out of step with what was sent.
+		c.close()
+	}
+	return err
+}
@@ -0,0 +1,199 @@
+package invitations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	channelSMS      = "sms"
+	channelEmail    = "email"
+	channelVoice    = "voice"
+	channelWhatsApp = "whatsapp"
+	channelTelegram = "telegram"
+	channelPush     = "push"
+)
+
+var knownChannels = []string{channelSMS, channelEmail, channelVoice, channelWhatsApp, channelTelegram, channelPush}
+
+// Notifier delivers a message to an invitee over one channel, returning
+// the provider's message ID when there is one.
+type Notifier interface {
+	Notify(ctx context.Context, inv Invitation, message string) (id string, err error)
+}
+
+// DeliveryStatus is the state of one outbound message. Status starts as
+// queued, becomes sent or failed once the outbox gets to it, and is then
+// advanced by provider callbacks when MessageID is known.
+type DeliveryStatus struct {
+	ID        string    `json:"id,omitempty"`
+	Channel   string    `json:"channel,omitempty"`
+	MessageID string    `json:"message_id,omitempty"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	At        time.Time `json:"at"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+const (
+	deliveryQueued    = "queued"
+	deliverySent      = "sent"
+	deliveryDelivered = "delivered"
+	deliveryFailed    = "failed"
+)
+
+func channelsFor(inv Invitation) []string {
+	if len(inv.Channels) == 0 {
+		return []string{channelSMS}
+	}
+	return inv.Channels
+}
+
+var errChannelNotConfigured = errors.New("channel not configured")
+
+// notifyInvitee queues message on every channel of inv and records each
+// message on the invitation.
+func (s *Server) notifyInvitee(ctx context.Context, inv Invitation, message string) {
+	s.notify(ctx, inv, message, false)
+}
+
+// sendInvitation queues the invitation itself, which is also tracked as
+// inv.Delivery.
+func (s *Server) sendInvitation(ctx context.Context, inv *Invitation) {
+	inv.Delivery = s.notify(ctx, *inv, s.inviteText(*inv), true)
+}
+
+func (s *Server) notify(ctx context.Context, inv Invitation, message string, invite bool) map[string]DeliveryStatus {
+	full := strings.TrimSpace(message)
+	ctx = context.WithoutCancel(ctx)
+
+	result := make(map[string]DeliveryStatus)
+	var queued []outboundMessage
+	channels := channelsFor(inv)
+	for _, ch := range channels {
+		body := full
+		if invite {
+			body = s.channelText(inv, ch, full)
+		}
+		st := DeliveryStatus{ID: randomHex(8), Channel: ch, Status: deliveryQueued, At: s.now().UTC()}
+		if _, ok := s.notifiers[ch]; !ok && !inv.Test {
+			st.Status, st.Error = deliveryFailed, errChannelNotConfigured.Error()
+			notifications.inc(ch, deliveryFailed)
+		} else {
+			queued = append(queued, outboundMessage{
+				ID: st.ID, InvitationID: inv.ID, Channel: ch, Body: body,
+				NextAt: st.At, CreatedAt: st.At, RequestID: requestIDFrom(ctx), Priority: priorityRanks[inv.Priority],
+			})
+		}
+		result[ch] = st
+	}
+	// Recorded so hosts can settle "I never got the invite".
+	ev := InvitationEvent{Type: historyNotified, Message: full, Delivery: result}
+
+	// The invitation's record of the messages is written before they are
+	// queued, so a fast worker always finds an entry to update.
+	stored, err := s.store.Update(ctx, inv.ID, func(stored *Invitation) error {
+		for _, ch := range channels {
+			stored.Messages = append(stored.Messages, result[ch])
+		}
+		if invite {
+			if stored.Delivery == nil {
+				stored.Delivery = make(map[string]DeliveryStatus, len(result))
+			}
+			for ch, st := range result {
+				stored.Delivery[ch] = st
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to record messages", "invitation_id", inv.ID, "err", err)
+		s.appendEvent(ctx, inv.ID, ev)
+	} else {
+		s.record(ctx, stored, ev)
+	}
+	s.enqueue(ctx, queued)
+	return result
+}
+
+type smsNotifier struct{ sender SMSSender }
+
+func (n smsNotifier) Notify(ctx context.Context, inv Invitation, message string) (string, error) {
+	return n.sender.Send(ctx, inv.PhoneNumber, message)
+}
+
+func (n smsNotifier) Check(ctx context.Context) error {
+	if c, ok := n.sender.(healthChecker); ok {
+		return c.Check(ctx)
+	}
+	return nil
+}
+
+// newEmailNotifier sends through SMTP_HOST when set and otherwise only logs,
+// mirroring the log-only SMS sender used in development.
+func newEmailNotifier() (Notifier, error) {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return logEmailNotifier{}, nil
+	}
+	n := &smtpNotifier{
+		addr: host + ":" + envOr("SMTP_PORT", "587"),
+		from: os.Getenv("SMTP_FROM"),
+	}
+	if n.from == "" {
+		return nil, errors.New("SMTP_FROM is required when SMTP_HOST is set")
+	}
+	if user := os.Getenv("SMTP_USERNAME"); user != "" {
+		n.auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	return n, nil
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+type logEmailNotifier struct{}
+
+func (logEmailNotifier) Notify(ctx context.Context, inv Invitation, message string) (string, error) {
+	slog.InfoContext(ctx, "sending email", "invitation_id", inv.ID, "to", inv.Email, "body", message)
+	return "", nil
+}
+
+type smtpNotifier struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func (n *smtpNotifier) Notify(_ context.Context, inv Invitation, message string) (string, error) {
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: You're invited\r\nMIME-Version: 1.0\r\n"+
+		"Content-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n", n.from, inv.Email, message)
+	err := smtp.SendMail(n.addr, n.auth, n.from, []string{inv.Email}, []byte(msg))
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		// Connection trouble rather than a rejected message.
+		return "", transientError{err}
+	}
+	return "", err
+}
+
+func validChannels(chs []string) error {
+	for _, ch := range chs {
+		if !slices.Contains(knownChannels, ch) {
+			return fmt.Errorf("unknown channel %q", ch)
+		}
+	}
+	return nil
+}
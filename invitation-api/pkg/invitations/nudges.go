@@ -0,0 +1,202 @@
+package invitations
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const maxNudges = 5
+
+// NudgePolicy follows up with invitees who haven't answered: a text every
+// AfterMin minutes without a response, up to Max of them. Nudges stop once
+// the invitation is answered, cancelled or expired, or with UnviewedOnly
+// once its response page has been opened.
+type NudgePolicy struct {
+	AfterMin     int  `json:"after_min"`
+	Max          int  `json:"max"`
+	UnviewedOnly bool `json:"unviewed_only,omitempty"`
+}
+
+func (p *NudgePolicy) validate() error {
+	if p.AfterMin <= 0 {
+		return badRequest("nudge.after_min must be a positive number of minutes")
+	}
+	if p.Max <= 0 || p.Max > maxNudges {
+		return badRequest("nudge.max must be between 1 and " + strconv.Itoa(maxNudges))
+	}
+	return nil
+}
+
+// nextNudge returns when inv is due its next nudge, or false if it has had
+// them all or is only nudged until viewed. The clock starts when the
+// invitation was sent.
+func nextNudge(inv Invitation) (time.Time, bool) {
+	if inv.Nudge == nil || len(inv.Nudges) >= inv.Nudge.Max {
+		return time.Time{}, false
+	}
+	if inv.Nudge.UnviewedOnly && !inv.ViewedAt.IsZero() {
+		return time.Time{}, false
+	}
+	start := inv.CreatedAt
+	if !inv.SendAt.IsZero() {
+		start = inv.SendAt
+	}
+	return start.Add(time.Duration(inv.Nudge.AfterMin*(len(inv.Nudges)+1)) * time.Minute), true
+}
+
+// tenantNudgePolicy is the default for invitations of the tenant in ctx
+// that don't set their own.
+func (s *Server) tenantNudgePolicy(ctx context.Context) (*NudgePolicy, error) {
+	id, _ := tenantFrom(ctx)
+	if id == "" {
+		return nil, nil
+	}
+	t, err := getRecord[tenant](ctx, s.store, tenantKind, id)
+	if err == errNotFound {
+		return nil, nil
+	}
+	return t.Nudge, err
+}
+
+func nudgeMessage(locale, text string) string {
+	return localize(locale, "nudge", text)
+}
+
+func (s *Server) sendDueNudges(ctx context.Context, t time.Time) error {
+	candidates, err := s.store.List(ctx, ListFilter{Status: statusPending, AsOf: t, ExpiresAfter: t})
+	if err != nil {
+		return err
+	}
+	for _, c := range candidates {
+		if at, ok := nextNudge(c); !ok || at.After(t) {
+			continue
+		}
+		inv, err := s.store.Update(ctx, c.ID, func(inv *Invitation) error {
+			if !isPending(inv.withStatus(t).Status) {
+				return errSkip
+			}
+			if at, ok := nextNudge(*inv); !ok || at.After(t) {
+				return errSkip
+			}
+			inv.Nudges = append(inv.Nudges, t.UTC())
+			return nil
+		})
+		if err == errSkip {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		s.notifyInvitee(ctx, inv, nudgeMessage(inv.Locale, s.inviteText(inv)))
+		s.appendEvent(ctx, inv.ID, InvitationEvent{Type: "nudged"})
+	}
+	return nil
+}
+
+// handleUpdateTenant sets or, with "nudge": null, clears a tenant's default
+// nudge policy.
+func (s *Server) handleUpdateTenant(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Nudge             *NudgePolicy `json:"nudge"`
+		UniqueExternalIDs *bool        `json:"unique_external_ids"`
+		Duplicates        *string      `json:"duplicates"`
+		Locale            *string      `json:"locale"`
+		SenderPool        *[]string    `json:"sender_pool"`
+		// Retention and Budget are left alone when omitted and cleared by
+		// null.
+		Retention json.RawMessage `json:"retention"`
+		Budget    json.RawMessage `json:"budget"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if req.Nudge != nil {
+		if err := req.Nudge.validate(); err != nil {
+			writeResponseError(w, r, err)
+			return
+		}
+	}
+	if req.Locale != nil {
+		if err := validateLocale(*req.Locale); err != nil {
+			writeResponseError(w, r, err)
+			return
+		}
+	}
+	if req.Duplicates != nil {
+		if err := validateDuplicates(*req.Duplicates); err != nil {
+			writeResponseError(w, r, err)
+			return
+		}
+	}
+	var pool []string
+	if req.SenderPool != nil {
+		var err error
+		if pool, err = normalizeSenderPool(*req.SenderPool); err != nil {
+			writeResponseError(w, r, err)
+			return
+		}
+	}
+	var retention *retentionPolicy
+	if len(req.Retention) > 0 {
+		if err := json.Unmarshal(req.Retention, &retention); err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid retention")
+			return
+		}
+		if retention != nil {
+			if err := retention.validate(); err != nil {
+				writeResponseError(w, r, err)
+				return
+			}
+		}
+	}
+	var bud *budget
+	if len(req.Budget) > 0 {
+		if err := json.Unmarshal(req.Budget, &bud); err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid budget")
+			return
+		}
+		if bud != nil {
+			if err := bud.validate(); err != nil {
+				writeResponseError(w, r, err)
+				return
+			}
+		}
+	}
+	t, err := getRecord[tenant](r.Context(), s.store, tenantKind, r.PathValue("id"))
+	if err == errNotFound {
+		writeError(w, r, http.StatusNotFound, "tenant not found")
+		return
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	t.Nudge = req.Nudge
+	if req.UniqueExternalIDs != nil {
+		t.UniqueExternalIDs = *req.UniqueExternalIDs
+	}
+	if req.Duplicates != nil {
+		t.Duplicates = *req.Duplicates
+	}
+	if req.Locale != nil {
+		t.Locale = *req.Locale
+	}
+	if req.SenderPool != nil {
+		t.SenderPool = pool
+	}
+	if len(req.Retention) > 0 {
+		t.Retention = retention
+	}
+	if len(req.Budget) > 0 {
+		t.Budget = bud
+	}
+	if err := putRecord(r.Context(), s.store, tenantKind, t.ID, t); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
@@ -0,0 +1,520 @@
+package invitations
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"invitation-api/pkg/config"
+)
+
+const (
+	oidcLoginKind   = "oidc_login"
+	oidcStateCookie = "invit_oidc_state"
+
+	// oidcLeeway allows for clock skew between us and the issuer.
+	oidcLeeway = time.Minute
+)
+
+// oidcProvider verifies tokens of the OpenID Connect issuer in oidc_issuer
+// and runs the dashboard's sign-in with it. Its discovery document and keys
+// are fetched when first needed, and the keys again when a token is signed
+// with one they don't have, as happens when the issuer rotates them.
+type oidcProvider struct {
+	issuer, clientID, clientSecret string
+	audiences                      []string
+	client                         *http.Client
+
+	mu        sync.Mutex
+	meta      oidcMetadata
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+func newOIDCProvider(cfg *config.Config) *oidcProvider {
+	return &oidcProvider{
+		issuer: strings.TrimSuffix(cfg.OIDCIssuer, "/"), clientID: cfg.OIDCClientID, clientSecret: cfg.OIDCClientSecret,
+		audiences: append([]string{cfg.OIDCClientID}, cfg.OIDCAudiences...),
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+var errOIDCUnavailable = &requestError{status: http.StatusServiceUnavailable, msg: "the identity provider can't be reached; try again later"}
+
+func (p *oidcProvider) getJSON(ctx context.Context, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (p *oidcProvider) metadata(ctx context.Context) (oidcMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta.Issuer != "" {
+		return p.meta, nil
+	}
+	var m oidcMetadata
+	if err := p.getJSON(ctx, p.issuer+"/.well-known/openid-configuration", &m); err != nil {
+		slog.WarnContext(ctx, "failed to fetch OIDC discovery document", "issuer", p.issuer, "err", err)
+		return m, errOIDCUnavailable
+	}
+	if strings.TrimSuffix(m.Issuer, "/") != p.issuer || m.JWKSURI == "" {
+		slog.ErrorContext(ctx, "OIDC discovery document doesn't match oidc_issuer", "issuer", p.issuer, "got", m.Issuer)
+		return m, errOIDCUnavailable
+	}
+	p.meta = m
+	return m, nil
+}
+
+// key returns the issuer's signing key kid, refetching the key set at most
+// once a minute for kids it doesn't know.
+func (p *oidcProvider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	m, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if k, ok := p.keys[kid]; ok {
+		return k, nil
+	}
+	if time.Since(p.fetchedAt) < time.Minute {
+		return nil, errors.New("unknown signing key " + kid)
+	}
+	var set struct {
+		Keys []struct {
+			Kty, Kid, Use, Crv, N, E, X, Y string
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, m.JWKSURI, &set); err != nil {
+		slog.WarnContext(ctx, "failed to fetch OIDC keys", "issuer", p.issuer, "err", err)
+		return nil, errOIDCUnavailable
+	}
+	p.keys, p.fetchedAt = map[string]crypto.PublicKey{}, time.Now()
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		switch jwk.Kty {
+		case "RSA":
+			n, err1 := base64.RawURLEncoding.DecodeString(jwk.N)
+			e, err2 := base64.RawURLEncoding.DecodeString(jwk.E)
+			if err1 != nil || err2 != nil || len(e) > 4 {
+				continue
+			}
+			p.keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			curve := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384()}[jwk.Crv]
+			x, err1 := base64.RawURLEncoding.DecodeString(jwk.X)
+			y, err2 := base64.RawURLEncoding.DecodeString(jwk.Y)
+			if curve == nil || err1 != nil || err2 != nil {
+				continue
+			}
+			p.keys[jwk.Kid] = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+	if k, ok := p.keys[kid]; ok {
+		return k, nil
+	}
+	return nil, errors.New("unknown signing key " + kid)
+}
+
+var jwtHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384,
+}
+
+// verify checks the signature, issuer, audience and lifetime of the JWT
+// token and returns its claims.
+func (p *oidcProvider) verify(ctx context.Context, token string, now time.Time) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("not a JWT")
+	}
+	var header struct{ Alg, Kid string }
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	h, ok := jwtHashes[header.Alg]
+	if !ok {
+		return nil, errors.New("unsupported alg " + header.Alg)
+	}
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	d := h.New()
+	d.Write([]byte(parts[0] + "." + parts[1]))
+	sum := d.Sum(nil)
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(header.Alg, "RS") || rsa.VerifyPKCS1v15(k, h, sum, sig) != nil {
+			return nil, errors.New("bad signature")
+		}
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(header.Alg, "ES") || len(sig) != 2*size ||
+			!ecdsa.Verify(k, sum, new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])) {
+			return nil, errors.New("bad signature")
+		}
+	}
+
+	var claims map[string]any
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != p.issuer {
+		return nil, errors.New("wrong issuer " + iss)
+	}
+	var aud []string
+	switch a := claims["aud"].(type) {
+	case string:
+		aud = []string{a}
+	case []any:
+		for _, v := range a {
+			if s, ok := v.(string); ok {
+				aud = append(aud, s)
+			}
+		}
+	}
+	if !slices.ContainsFunc(aud, func(a string) bool { return slices.Contains(p.audiences, a) }) {
+		return nil, errors.New("wrong audience")
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || !now.Before(time.Unix(int64(exp), 0).Add(oidcLeeway)) {
+		return nil, errors.New("expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(oidcLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("not valid yet")
+	}
+	return claims, nil
+}
+
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// oidcIdentity is who a verified token names, with what its claims say
+// about their tenant and role. Dashboard sessions keep it, and map it to a
+// tenant and role again on each request.
+type oidcIdentity struct {
+	Subject  string `json:"sub"`
+	Email    string `json:"email,omitempty"`
+	TenantID string `json:"tenant_id,omitempty"`
+	Role     string `json:"role,omitempty"`
+}
+
+func (s *Server) oidcIdentity(claims map[string]any) (oidcIdentity, error) {
+	id := oidcIdentity{}
+	id.Subject, _ = claims["sub"].(string)
+	if id.Subject == "" {
+		return id, errors.New("no sub claim")
+	}
+	// An email the provider hasn't verified could be anyone's.
+	if v, ok := claims["email_verified"].(bool); !ok || v {
+		email, _ := claims["email"].(string)
+		id.Email = strings.ToLower(strings.TrimSpace(email))
+	}
+	if c := s.cfg.OIDCTenantClaim; c != "" {
+		id.TenantID, _ = claims[c].(string)
+	}
+	if c := s.cfg.OIDCRoleClaim; c != "" {
+		// A list, such as a groups claim, grants the highest role it names.
+		var names []any
+		switch v := claims[c].(type) {
+		case string:
+			names = []any{v}
+		case []any:
+			names = v
+		}
+		for _, n := range names {
+			if r, ok := n.(string); ok && slices.Contains(roles, r) && (id.Role == "" || roleAtLeast(r, id.Role)) {
+				id.Role = r
+			}
+		}
+	}
+	return id, nil
+}
+
+var errNoOIDCAccount = &requestError{status: http.StatusForbidden, msg: "this identity doesn't belong to any tenant"}
+
+// oidcKey maps id to its tenant, user and role, as an API key that exists
+// only for the request. Without a tenant claim the user with id's email
+// decides the tenant, and must be the only one with it; without a role
+// claim the user's role applies, and a tenant's other identities are
+// viewers.
+func (s *Server) oidcKey(ctx context.Context, id oidcIdentity) (apiKey, error) {
+	k := apiKey{
+		ID: "oidc_" + hashSecret(s.cfg.OIDCIssuer + " " + id.Subject)[:16], Name: id.Email,
+		TenantID: id.TenantID, role: id.Role, oidc: &id,
+	}
+	tenants := []string{id.TenantID}
+	if id.TenantID != "" {
+		if _, err := s.store.GetRecord(ctx, tenantKind, id.TenantID); err == errNotFound {
+			return k, errNoOIDCAccount
+		} else if err != nil {
+			return k, err
+		}
+	} else {
+		all, err := listRecords[tenant](ctx, s.store, tenantKind)
+		if err != nil {
+			return k, err
+		}
+		tenants = tenants[:0]
+		for _, t := range all {
+			tenants = append(tenants, t.ID)
+		}
+	}
+	var found []user
+	for _, t := range tenants {
+		if id.Email == "" {
+			break
+		}
+		users, err := listRecords[user](withTenant(ctx, t), s.store, userKind)
+		if err != nil {
+			return k, err
+		}
+		for _, u := range users {
+			if strings.EqualFold(u.Email, id.Email) {
+				found = append(found, u)
+			}
+		}
+	}
+	switch {
+	case len(found) > 1:
+		return k, &requestError{status: http.StatusForbidden, msg: "users of several tenants have this email; set oidc_tenant_claim to choose"}
+	case len(found) == 1:
+		k.TenantID, k.UserID = found[0].TenantID, found[0].ID
+		if k.role == "" {
+			k.role = found[0].Role
+		}
+	case id.TenantID == "":
+		return k, errNoOIDCAccount
+	case k.role == "":
+		k.role = roleViewer
+	}
+	return k, nil
+}
+
+// oidcTokenKey authenticates a bearer token from the identity provider.
+func (s *Server) oidcTokenKey(ctx context.Context, token string) (apiKey, error) {
+	claims, err := s.oidc.verify(ctx, token, s.now())
+	if err == nil {
+		var id oidcIdentity
+		if id, err = s.oidcIdentity(claims); err == nil {
+			return s.oidcKey(ctx, id)
+		}
+	}
+	var re *requestError
+	if errors.As(err, &re) {
+		return apiKey{}, err
+	}
+	slog.InfoContext(ctx, "rejected OIDC token", "err", err)
+	return apiKey{}, &requestError{status: http.StatusUnauthorized, msg: "invalid or expired token"}
+}
+
+// oidcLogin is a sign-in in progress, stored under a hash of its state
+// parameter until the provider sends the browser back.
+type oidcLogin struct {
+	Nonce     string    `json:"nonce"`
+	Verifier  string    `json:"verifier"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (s *Server) oidcRedirectURI() string {
+	return strings.TrimSuffix(s.cfg.PublicURL, "/") + "/dashboard/login/callback"
+}
+
+// handleOIDCLogin sends the browser to the provider to sign in, with PKCE,
+// a nonce for the ID token and a state cookie tying the callback to it.
+func (s *Server) handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if s.oidc == nil {
+		http.NotFound(w, r)
+		return
+	}
+	m, err := s.oidc.metadata(r.Context())
+	if err != nil {
+		s.renderLogin(w, r, http.StatusServiceUnavailable, "Single sign-on isn't available right now. Please try again later.")
+		return
+	}
+	state := randomHex(16)
+	login := oidcLogin{Nonce: randomHex(16), Verifier: randomHex(32), ExpiresAt: s.now().Add(10 * time.Minute).UTC()}
+	if err := putRecord(r.Context(), s.store, oidcLoginKind, hashSecret(state), login); err != nil {
+		slog.ErrorContext(r.Context(), "failed to store sign-in", "err", err)
+		http.Error(w, "Something went wrong. Please try again later.", http.StatusInternalServerError)
+		return
+	}
+	// Lax, not Strict: the cookie must come back with the provider's
+	// redirect to the callback.
+	http.SetCookie(w, &http.Cookie{
+		Name: oidcStateCookie, Value: state, Path: "/dashboard/login", MaxAge: 600,
+		HttpOnly: true, Secure: s.secureCookies(r), SameSite: http.SameSiteLaxMode,
+	})
+	challenge := sha256.Sum256([]byte(login.Verifier))
+	q := url.Values{
+		"response_type": {"code"}, "client_id": {s.cfg.OIDCClientID}, "redirect_uri": {s.oidcRedirectURI()},
+		"scope": {"openid email profile"}, "state": {state}, "nonce": {login.Nonce},
+		"code_challenge": {base64.RawURLEncoding.EncodeToString(challenge[:])}, "code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(m.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, m.AuthorizationEndpoint+sep+q.Encode(), http.StatusSeeOther)
+}
+
+var oidcDonePage = template.Must(template.New("oidc_done").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="0;url=/dashboard">
+<title>Signed in</title>
+</head>
+<body><p><a href="/dashboard">Continue to the dashboard</a></p></body>
+</html>
+`))
+
+// handleOIDCCallback finishes a sign-in: it swaps the code for an ID token,
+// checks it, and opens a session for its identity.
+func (s *Server) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if s.oidc == nil {
+		http.NotFound(w, r)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/dashboard/login", MaxAge: -1, HttpOnly: true, Secure: s.secureCookies(r), SameSite: http.SameSiteLaxMode})
+	q := r.URL.Query()
+	if q.Get("error") != "" {
+		slog.InfoContext(r.Context(), "OIDC sign-in refused", "error", q.Get("error"), "description", q.Get("error_description"))
+		s.renderLogin(w, r, http.StatusUnauthorized, "Sign-in was cancelled or refused.")
+		return
+	}
+	c, err := r.Cookie(oidcStateCookie)
+	state := q.Get("state")
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(c.Value), []byte(state)) != 1 {
+		s.renderLogin(w, r, http.StatusBadRequest, "That sign-in has expired. Please try again.")
+		return
+	}
+	login, err := getRecord[oidcLogin](r.Context(), s.store, oidcLoginKind, hashSecret(state))
+	if err == nil {
+		err = s.store.DeleteRecord(r.Context(), oidcLoginKind, hashSecret(state))
+	}
+	if err != nil || !s.now().Before(login.ExpiresAt) {
+		s.renderLogin(w, r, http.StatusBadRequest, "That sign-in has expired. Please try again.")
+		return
+	}
+
+	k, err := s.oidcExchange(r.Context(), q.Get("code"), login)
+	if err != nil {
+		var re *requestError
+		notice := "Sign-in failed. Please try again."
+		if errors.As(err, &re) && re.status == http.StatusForbidden {
+			notice = "Your account isn't set up for this service. Ask an owner of your team to add you."
+		} else if !errors.As(err, &re) {
+			slog.WarnContext(r.Context(), "OIDC sign-in failed", "err", err)
+		}
+		s.renderLogin(w, r, http.StatusUnauthorized, notice)
+		return
+	}
+	sess := session{OIDC: k.oidc, CSRF: randomHex(16), ExpiresAt: s.now().Add(s.cfg.SessionTTL).UTC()}
+	if !s.startSession(w, r, sess) {
+		return
+	}
+	slog.InfoContext(r.Context(), "dashboard login", "oidc_subject", k.oidc.Subject, "tenant_id", k.TenantID, "remote", remoteHost(r))
+	// A page rather than a redirect, so that the browser sends the Strict
+	// session cookie: it wouldn't, continuing a navigation the provider
+	// started.
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := oidcDonePage.Execute(w, nil); err != nil {
+		slog.ErrorContext(r.Context(), "failed to render sign-in page", "err", err)
+	}
+}
+
+// oidcExchange redeems an authorization code at the token endpoint and
+// maps the identity of the ID token it returns.
+func (s *Server) oidcExchange(ctx context.Context, code string, login oidcLogin) (apiKey, error) {
+	m, err := s.oidc.metadata(ctx)
+	if err != nil {
+		return apiKey{}, err
+	}
+	form := url.Values{
+		"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {s.oidcRedirectURI()},
+		"client_id": {s.cfg.OIDCClientID}, "code_verifier": {login.Verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return apiKey{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if s.cfg.OIDCClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(s.cfg.OIDCClientID), url.QueryEscape(s.cfg.OIDCClientSecret))
+	}
+	resp, err := s.oidc.client.Do(req)
+	if err != nil {
+		return apiKey{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return apiKey{}, fmt.Errorf("token endpoint: %s", resp.Status)
+	}
+	var tok struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return apiKey{}, err
+	}
+	claims, err := s.oidc.verify(ctx, tok.IDToken, s.now())
+	if err != nil {
+		return apiKey{}, err
+	}
+	if nonce, _ := claims["nonce"].(string); subtle.ConstantTimeCompare([]byte(nonce), []byte(login.Nonce)) != 1 {
+		return apiKey{}, errors.New("ID token nonce doesn't match")
+	}
+	id, err := s.oidcIdentity(claims)
+	if err != nil {
+		return apiKey{}, err
+	}
+	return s.oidcKey(ctx, id)
+}
@@ -0,0 +1,121 @@
+package invitations
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"invitation-api/pkg/config"
+)
+
+// Open builds the server cfg describes: its store, encrypted at rest when
+// configured, and a notifier for each channel with credentials from the
+// environment. It does not start it; call Start to serve the APIs too, or
+// Run for the workers alone, and Close when done.
+func Open(cfg *config.Config) (*Server, error) {
+	if _, ok := callingCodes[strings.ToUpper(cfg.DefaultCountry)]; !ok {
+		return nil, fmt.Errorf("unsupported default_country %q", cfg.DefaultCountry)
+	}
+	db, err := OpenStore(cfg.Store, cfg.DBDSN, cfg.AutoMigrate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the %s store: %w", cfg.Store, err)
+	}
+	srv, err := open(cfg, db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return srv, nil
+}
+
+func open(cfg *config.Config, db Store) (*Server, error) {
+	var store Store = tracedStore{db}
+	if cfg.PIIKeyFile != "" || cfg.PIIVaultAddr != "" {
+		c, err := newPIICipher(context.Background(), cfg, store)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up encryption at rest: %w", err)
+		}
+		sealed := sealedStore{next: store, c: c}
+		if err := sealed.sealLegacy(context.Background()); err != nil {
+			return nil, fmt.Errorf("failed to encrypt existing personal data: %w", err)
+		}
+		store = sealed
+	}
+
+	if cfg.InsecureWebhooks {
+		slog.Warn("accepting provider webhooks without a secret unverified; don't use this in production")
+	}
+
+	var statusCallback string
+	if cfg.PublicURL != "" {
+		statusCallback = strings.TrimSuffix(cfg.PublicURL, "/") + "/sms/status"
+	}
+	sms, err := newSMSSender(cfg.SMSProvider, statusCallback, senderIDs(cfg.SMSSenderIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure the SMS provider: %w", err)
+	}
+	var chaos *chaosSender
+	if cfg.ChaosFile != "" {
+		rules, err := loadChaosRules(cfg.ChaosFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load chaos rules: %w", err)
+		}
+		slog.Warn("injecting SMS failures; don't use this in production", "file", cfg.ChaosFile, "rules", len(rules))
+		chaos = &chaosSender{next: sms, rules: rules}
+		sms = chaos
+	}
+	email, err := newEmailNotifier()
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure email: %w", err)
+	}
+	notifiers := map[string]Notifier{channelSMS: smsNotifier{sms}, channelEmail: email}
+	voice, err := newVoiceNotifier(cfg.VoiceProvider, cfg.PublicURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure the voice provider: %w", err)
+	}
+	if voice != nil {
+		notifiers[channelVoice] = voice
+	}
+	if notifiers[channelWhatsApp], err = newWhatsAppNotifier(); err != nil {
+		return nil, fmt.Errorf("failed to configure WhatsApp: %w", err)
+	}
+	notifiers[channelTelegram] = newTelegramNotifier()
+	pushSenders, err := newPushSenders()
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure push: %w", err)
+	}
+	notifiers[channelPush] = pushNotifier{store: store, senders: pushSenders}
+
+	srv := NewServer(cfg, store, notifiers, nil, systemClock{})
+	if chaos != nil {
+		chaos.report = srv.advanceDelivery
+	}
+	if cfg.PricesFile != "" {
+		if srv.prices, err = loadPrices(cfg.PricesFile); err != nil {
+			return nil, fmt.Errorf("failed to load prices: %w", err)
+		}
+	}
+	if cfg.EventBus != "" {
+		if srv.bus, err = newEventBus(cfg); err != nil {
+			return nil, fmt.Errorf("failed to set up the event bus: %w", err)
+		}
+	}
+	if cfg.ArchiveS3Bucket != "" {
+		b, err := newS3Bucket(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up the archive bucket: %w", err)
+		}
+		srv.cold = b
+	}
+	if rs, ok := db.(*redisStore); ok {
+		srv.useRedis(rs)
+	}
+	if l, ok := db.(leaser); ok {
+		srv.leases = l
+	}
+	return srv, nil
+}
+
+// Close closes the server's store. Shut the server down first.
+func (s *Server) Close() error { return s.store.Close() }
@@ -0,0 +1,188 @@
+package invitations
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"invitation-api/pkg/config"
+)
+
+//go:embed openapi.yaml
+var openAPIYAML []byte
+
+// openAPIJSON is openapi.yaml as served at /openapi.json.
+var openAPIJSON = func() []byte {
+	var doc map[string]any
+	if err := yaml.Unmarshal(openAPIYAML, &doc); err != nil {
+		panic("openapi.yaml: " + err.Error())
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		panic("openapi.yaml: " + err.Error())
+	}
+	return b
+}()
+
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIJSON)
+}
+
+const docsPage = `<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>invit-timer API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`
+
+func handleDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(docsPage))
+}
+
+// openAPISchemas pairs spec schemas with the types the handlers encode and
+// decode, so checkOpenAPI catches a field added to only one of them.
+var openAPISchemas = map[string]any{
+	"Invitation":              Invitation{},
+	"InvitationPage":          invitationPage{},
+	"CreateInvitationRequest": CreateInvitationRequest{},
+	"UpdateInvitationRequest": updateInvitationRequest{},
+	"Reminder":                Reminder{},
+	"DeliveryStatus":          DeliveryStatus{},
+	"InvitationEvent":         InvitationEvent{},
+	"Change":                  Change{},
+	"Template":                messageTemplate{},
+	"Contact":                 contact{},
+	"ContactRequest":          contactRequest{},
+	"PrivacyExport":           privacyExport{},
+	"PrivacyRequest":          privacyRequest{},
+	"Batch":                   batch{},
+	"BatchCounts":             batchCounts{},
+	"BatchSocketMessage":      socketMessage{},
+	"RosterEntry":             rosterEntry{},
+	"Series":                  invitationSeries{},
+	"Occurrence":              occurrence{},
+	"BulkRequest":             bulkRequest{},
+	"BulkRecipient":           bulkRecipient{},
+	"BulkResult":              bulkResult{},
+	"Webhook":                 webhook{},
+	"WebhookDelivery":         delivery{},
+	"OutboundMessage":         outboundMessage{},
+	"Tenant":                  tenant{},
+	"NudgePolicy":             NudgePolicy{},
+	"RetentionPolicy":         retentionPolicy{},
+	"Suppression":             suppression{},
+	"Readiness":               readyReport{},
+	"ReadinessCheck":          readyCheck{},
+	"Error":                   errorBody{},
+	"Problem":                 problem{},
+}
+
+// CheckOpenAPI checks openapi.yaml against the routes and types of a
+// server with the default configuration; see checkOpenAPI.
+func CheckOpenAPI() error {
+	return NewServer(&config.Config{}, newMemoryStore(), nil, nil, nil).checkOpenAPI()
+}
+
+// checkOpenAPI reports routes missing from openapi.yaml, documented
+// operations that aren't routed, and schemas whose properties differ from
+// their Go types. CI runs it as "invitation-api check-openapi".
+func (s *Server) checkOpenAPI() error {
+	var spec struct {
+		Paths      map[string]map[string]any `yaml:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]any `yaml:"properties"`
+				Enum       []string       `yaml:"enum"`
+			} `yaml:"schemas"`
+		} `yaml:"components"`
+	}
+	if err := yaml.Unmarshal(openAPIYAML, &spec); err != nil {
+		return fmt.Errorf("openapi.yaml: %w", err)
+	}
+
+	var errs []error
+	documented := map[string]bool{}
+	for path, ops := range spec.Paths {
+		for method := range ops {
+			if method != "parameters" {
+				documented[strings.ToUpper(method)+" "+path] = true
+			}
+		}
+	}
+	for _, route := range s.routes {
+		if !documented[route] {
+			errs = append(errs, fmt.Errorf("route %s is not documented", route))
+		}
+		delete(documented, route)
+	}
+	for _, op := range sortedKeys(documented) {
+		errs = append(errs, fmt.Errorf("%s is documented but not routed", op))
+	}
+
+	for _, name := range sortedKeys(openAPISchemas) {
+		schema, ok := spec.Components.Schemas[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("schema %s is missing", name))
+			continue
+		}
+		fields := jsonFields(reflect.TypeOf(openAPISchemas[name]))
+		for _, f := range sortedKeys(fields) {
+			if _, ok := schema.Properties[f]; !ok {
+				errs = append(errs, fmt.Errorf("schema %s is missing property %s", name, f))
+			}
+		}
+		for _, p := range sortedKeys(schema.Properties) {
+			if !fields[p] {
+				errs = append(errs, fmt.Errorf("schema %s has property %s, which its type doesn't", name, p))
+			}
+		}
+	}
+	if codes := spec.Components.Schemas["ErrorCode"].Enum; !slices.Equal(codes, errorCodes) {
+		errs = append(errs, fmt.Errorf("ErrorCode lists %v, not the registered %v", codes, errorCodes))
+	}
+	return errors.Join(errs...)
+}
+
+// jsonFields returns the names t's fields have in JSON.
+func jsonFields(t reflect.Type) map[string]bool {
+	fields := map[string]bool{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || name == "-" || f.Tag.Get("openapi") == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = true
+	}
+	return fields
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
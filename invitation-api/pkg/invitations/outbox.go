@@ -0,0 +1,343 @@
+package invitations
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"time"
+)
+
+const (
+	outboxKind     = "outbox"
+	deadLetterKind = "failed_message"
+
+	outboxPollInterval = time.Second
+	sendBackoffBase    = 5 * time.Second
+	sendBackoffMax     = 15 * time.Minute
+)
+
+// An invitation's Priority orders its messages in the outbox: due urgent
+// messages go out before normal ones, and normal before low.
+const (
+	priorityLow    = "low"
+	priorityNormal = "normal"
+	priorityUrgent = "urgent"
+)
+
+var priorityRanks = map[string]int{priorityLow: -1, "": 0, priorityNormal: 0, priorityUrgent: 1}
+
+func validatePriority(p string) error {
+	if _, ok := priorityRanks[p]; !ok {
+		return badRequest("priority must be low, normal or urgent")
+	}
+	return nil
+}
+
+// outboundMessage is one notification waiting to be sent. It stays in the
+// outbox until a send succeeds, and moves to the dead-letter list when it
+// fails permanently or runs out of attempts.
+type outboundMessage struct {
+	ID           string    `json:"id"`
+	InvitationID string    `json:"invitation_id"`
+	Channel      string    `json:"channel"`
+	Body         string    `json:"body"`
+	Attempts     int       `json:"attempts"`
+	NextAt       time.Time `json:"next_at"`
+	LastError    string    `json:"last_error,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	FailedAt     time.Time `json:"failed_at,omitempty"`
+	RequestID    string    `json:"request_id,omitempty"`
+	// To, when set, addresses the message to the host instead of the
+	// invitee; see notifyHost.
+	To string `json:"to,omitempty"`
+	// Priority is the rank of the invitation's priority.
+	Priority int `json:"priority,omitempty"`
+}
+
+// enqueue stores msgs in the outbox and wakes the dispatcher.
+func (s *Server) enqueue(ctx context.Context, msgs []outboundMessage) {
+	for _, m := range msgs {
+		if err := putRecord(ctx, s.store, outboxKind, m.ID, m); err != nil {
+			slog.ErrorContext(ctx, "failed to queue message", "invitation_id", m.InvitationID, "channel", m.Channel, "err", err)
+		}
+	}
+	select {
+	case s.outboxWake <- struct{}{}:
+	default:
+	}
+}
+
+// runOutbox hands due messages to a pool of cfg.SendWorkers senders, highest
+// priority and then oldest first. Newly queued messages interrupt a pass so
+// that urgent ones needn't wait behind a bulk send. The outbox lives in the
+// store, so queued messages survive restarts with the sqlite or postgres
+// store.
+func (s *Server) runOutbox(ctx context.Context) {
+	jobs := make(chan outboundMessage)
+	for i := 0; i < s.cfg.SendWorkers; i++ {
+		s.goWorker(func() {
+			for m := range jobs {
+				s.send(withJobID(ctx, "send"), m)
+				s.sending.release(m.ID)
+			}
+		})
+	}
+	defer close(jobs)
+
+	ticks, stop := s.clock.NewTicker(outboxPollInterval)
+	defer stop()
+	for {
+		msgs, err := listRecords[outboundMessage](ctx, s.store, outboxKind)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to load outbox", "err", err)
+		}
+		slices.SortFunc(msgs, func(a, b outboundMessage) int {
+			if a.Priority != b.Priority {
+				return b.Priority - a.Priority
+			}
+			return a.CreatedAt.Compare(b.CreatedAt)
+		})
+		woken := false
+	pass:
+		for _, m := range msgs {
+			if m.NextAt.After(s.now()) || !s.sending.claim(m.ID) {
+				continue
+			}
+			select {
+			case jobs <- m:
+			case <-s.outboxWake:
+				s.sending.release(m.ID)
+				woken = true
+				break pass
+			case <-ctx.Done():
+				s.sending.release(m.ID)
+				return
+			}
+		}
+		if woken {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticks:
+		case <-s.outboxWake:
+		}
+	}
+}
+
+// send makes one attempt at m. The attempt is not cut short by shutdown,
+// which waits for it instead.
+func (s *Server) send(ctx context.Context, m outboundMessage) {
+	if m.RequestID != "" {
+		ctx = withRequestID(ctx, m.RequestID)
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+
+	// The pass that handed m over may have listed it before another worker
+	// sent or requeued it.
+	cur, err := getRecord[outboundMessage](ctx, s.store, outboxKind, m.ID)
+	if err == errNotFound || err == nil && cur.NextAt.After(s.now()) {
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to load queued message", "invitation_id", m.InvitationID, "err", err)
+		return
+	}
+	m = cur
+
+	inv, err := s.store.Get(ctx, m.InvitationID)
+	if err == errNotFound {
+		// Purged while queued; there is nobody left to tell.
+		s.store.DeleteRecord(ctx, outboxKind, m.ID)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to load invitation for message", "invitation_id", m.InvitationID, "err", err)
+		return
+	}
+
+	switch {
+	case m.To == "":
+	case m.Channel == channelEmail:
+		inv.Email = m.To
+	default:
+		inv.PhoneNumber = m.To
+	}
+
+	var optedOut bool
+	if m.Channel == channelSMS {
+		// Reminders and nudges queued before a STOP fail rather than go out.
+		optedOut, _ = s.suppressed(ctx, inv.PhoneNumber)
+	}
+
+	var providerID string
+	n, ok := s.notifiers[m.Channel]
+	if inv.Test {
+		n, ok = testNotifier{}, true
+	}
+	if !ok {
+		err = errChannelNotConfigured
+	} else if optedOut {
+		err = errOptedOut
+	} else {
+		sendCtx := ctx
+		if m.Channel == channelSMS && !inv.Test {
+			var from string
+			if from, err = s.poolSender(ctx, inv); err != nil {
+				// Rather than break the invitee's sticky sender.
+				err = transientError{err}
+			} else if from != "" {
+				sendCtx = withSMSFrom(ctx, from)
+			}
+		}
+		if err == nil {
+			if !inv.Test {
+				s.throttle(ctx, s.messageProvider(ctx, inv, m.Channel))
+			}
+			providerID, err = n.Notify(sendCtx, inv, m.Body)
+		}
+	}
+	m.Attempts++
+	if err == nil {
+		if !inv.Test {
+			notifications.inc(m.Channel, deliverySent)
+			s.recordUsage(ctx, inv, m)
+		}
+		s.setMessageStatus(ctx, m, DeliveryStatus{Status: deliverySent, MessageID: providerID})
+		if providerID != "" && m.To == "" {
+			if err := putRecord(ctx, s.store, messageKind, providerID, messageRecord{InvitationID: m.InvitationID}); err != nil {
+				slog.ErrorContext(ctx, "failed to index message", "invitation_id", m.InvitationID, "message_id", providerID, "err", err)
+			}
+		}
+		s.store.DeleteRecord(ctx, outboxKind, m.ID)
+		if inv.Test && m.To == "" {
+			// As the provider's status callback would.
+			if err := s.advanceDelivery(ctx, providerID, deliveryDelivered, ""); err != nil {
+				slog.ErrorContext(ctx, "failed to simulate delivery", "invitation_id", m.InvitationID, "err", err)
+			}
+		}
+		return
+	}
+
+	m.LastError = err.Error()
+	if isTransient(err) && m.Attempts < s.cfg.SendAttempts {
+		d := min(sendBackoffBase<<(m.Attempts-1), sendBackoffMax)
+		m.NextAt = s.now().Add(d + rand.N(d/2)).UTC()
+		slog.WarnContext(ctx, "message send failed, will retry", "invitation_id", m.InvitationID, "channel", m.Channel,
+			"attempt", m.Attempts, "next_at", m.NextAt, "err", err)
+		if err := putRecord(ctx, s.store, outboxKind, m.ID, m); err != nil {
+			slog.ErrorContext(ctx, "failed to requeue message", "invitation_id", m.InvitationID, "err", err)
+		}
+		return
+	}
+
+	slog.ErrorContext(ctx, "giving up on message", "invitation_id", m.InvitationID, "channel", m.Channel,
+		"attempts", m.Attempts, "err", err)
+	if !inv.Test {
+		notifications.inc(m.Channel, deliveryFailed)
+	}
+	m.FailedAt = s.now().UTC()
+	if err := putRecord(ctx, s.store, deadLetterKind, m.ID, m); err != nil {
+		slog.ErrorContext(ctx, "failed to dead-letter message", "invitation_id", m.InvitationID, "err", err)
+		return
+	}
+	s.store.DeleteRecord(ctx, outboxKind, m.ID)
+	s.setMessageStatus(ctx, m, DeliveryStatus{Status: deliveryFailed, Error: m.LastError})
+	s.appendEvent(ctx, m.InvitationID, InvitationEvent{Type: "notification_failed", Message: m.Body,
+		Delivery: map[string]DeliveryStatus{m.Channel: {Channel: m.Channel, ID: m.ID, Status: deliveryFailed, Error: m.LastError, At: m.FailedAt}}})
+}
+
+// throttle waits until provider's send_rates cap allows another message.
+// Workers waiting on the same provider go in turn.
+func (s *Server) throttle(ctx context.Context, provider string) {
+	l, ok := s.sendRates[provider]
+	if !ok {
+		return
+	}
+	wait := l.reserve(provider, s.now())
+	if wait <= 0 {
+		return
+	}
+	ticks, stop := s.clock.NewTicker(wait)
+	defer stop()
+	select {
+	case <-ticks:
+	case <-ctx.Done():
+	}
+}
+
+// setMessageStatus applies the outcome of sending m to the invitation's
+// record of it.
+func (s *Server) setMessageStatus(ctx context.Context, m outboundMessage, st DeliveryStatus) {
+	var applied []DeliveryStatus
+	inv, err := s.store.Update(ctx, m.InvitationID, func(inv *Invitation) error {
+		applied = nil
+		apply := func(d *DeliveryStatus) bool {
+			if d.ID != m.ID {
+				return false
+			}
+			d.Status, d.Error, d.MessageID, d.UpdatedAt = st.Status, st.Error, st.MessageID, s.now().UTC()
+			return true
+		}
+		for i := range inv.Messages {
+			if apply(&inv.Messages[i]) {
+				applied = append(applied, inv.Messages[i])
+			}
+		}
+		for ch, d := range inv.Delivery {
+			if apply(&d) {
+				applied = append(applied, d)
+			}
+			inv.Delivery[ch] = d
+		}
+		if len(applied) == 0 {
+			// Messages to the host aren't recorded on the invitation.
+			return errSkip
+		}
+		return nil
+	})
+	if err == nil {
+		s.record(ctx, inv, deliveryEvent(applied...))
+	} else if err != errNotFound && err != errSkip {
+		slog.ErrorContext(ctx, "failed to record message status", "invitation_id", m.InvitationID, "err", err)
+	}
+}
+
+func (s *Server) handleListFailedMessages(w http.ResponseWriter, r *http.Request) {
+	msgs, err := listRecords[outboundMessage](r.Context(), s.store, deadLetterKind)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if id := r.URL.Query().Get("invitation_id"); id != "" {
+		msgs = slices.DeleteFunc(msgs, func(m outboundMessage) bool { return m.InvitationID != id })
+	}
+	slices.SortFunc(msgs, func(a, b outboundMessage) int { return b.FailedAt.Compare(a.FailedAt) })
+	writeJSON(w, http.StatusOK, msgs)
+}
+
+// handleRetryFailedMessage puts a dead-lettered message back in the outbox
+// with a fresh set of attempts.
+func (s *Server) handleRetryFailedMessage(w http.ResponseWriter, r *http.Request) {
+	m, err := getRecord[outboundMessage](r.Context(), s.store, deadLetterKind, r.PathValue("id"))
+	if err == errNotFound {
+		writeError(w, r, http.StatusNotFound, "failed message not found")
+		return
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	m.Attempts, m.NextAt, m.FailedAt = 0, s.now().UTC(), time.Time{}
+	s.setMessageStatus(r.Context(), m, DeliveryStatus{Status: deliveryQueued})
+	s.enqueue(r.Context(), []outboundMessage{m})
+	if err := s.store.DeleteRecord(r.Context(), deadLetterKind, m.ID); err != nil && err != errNotFound {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, m)
+}
@@ -0,0 +1,103 @@
+package invitations
+
+import (
+	"errors"
+	"strings"
+)
+
+// callingCodes maps ISO 3166 country codes to their calling code and the
+// trunk prefix dialled before national numbers. North American numbers are
+// also checked for their fixed ten-digit length.
+var callingCodes = map[string]struct{ code, trunk string }{
+	"US": {"1", "1"}, "CA": {"1", "1"},
+	"GB": {"44", "0"}, "IE": {"353", "0"},
+	"DE": {"49", "0"}, "FR": {"33", "0"}, "ES": {"34", ""}, "IT": {"39", ""},
+	"NL": {"31", "0"}, "BE": {"32", "0"}, "CH": {"41", "0"}, "AT": {"43", "0"},
+	"SE": {"46", "0"}, "NO": {"47", ""}, "DK": {"45", ""}, "FI": {"358", "0"},
+	"PL": {"48", ""}, "PT": {"351", ""},
+	"AU": {"61", "0"}, "NZ": {"64", "0"},
+	"IN": {"91", "0"}, "JP": {"81", "0"}, "SG": {"65", ""}, "HK": {"852", ""},
+	"BR": {"55", "0"}, "MX": {"52", ""}, "ZA": {"27", "0"},
+}
+
+var (
+	errPhoneEmpty    = errors.New("phone_number is empty")
+	errPhoneChars    = errors.New("phone_number may only contain digits, spaces, dashes, dots, parentheses and a leading +")
+	errPhoneLength   = errors.New("phone_number must have between 8 and 15 digits including the country code")
+	errPhoneNational = errors.New("phone_number has no country code and the default country is not supported")
+	errPhoneNANP     = errors.New("phone_number must have 10 digits for North American numbers")
+)
+
+// normalizePhone converts raw to E.164. Numbers without a leading + or 00
+// are treated as national numbers in country.
+func normalizePhone(raw, country string) (string, error) {
+	s := strings.TrimSpace(raw)
+	if s == "" {
+		return "", errPhoneEmpty
+	}
+
+	var digits strings.Builder
+	for i, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			digits.WriteRune(c)
+		case c == '+' && i == 0:
+		case strings.ContainsRune(" -.()", c):
+		default:
+			return "", errPhoneChars
+		}
+	}
+	d := digits.String()
+
+	switch {
+	case strings.HasPrefix(s, "+"):
+	case strings.HasPrefix(d, "00"):
+		d = d[2:]
+	default:
+		cc, ok := callingCodes[strings.ToUpper(country)]
+		if !ok {
+			return "", errPhoneNational
+		}
+		if cc.trunk != "" {
+			d = strings.TrimPrefix(d, cc.trunk)
+		}
+		d = cc.code + d
+	}
+	if strings.HasPrefix(d, "1") && (len(d) != 11 || d[1] < '2') {
+		return "", errPhoneNANP
+	}
+
+	if len(d) < 8 || len(d) > 15 || d[0] == '0' {
+		return "", errPhoneLength
+	}
+	return "+" + d, nil
+}
+
+// phoneCountry is the country of an E.164 number, by the longest calling
+// code it starts with, or "" for countries callingCodes doesn't know. The
+// North American plan counts as US.
+func phoneCountry(e164 string) string {
+	d := strings.TrimPrefix(e164, "+")
+	if strings.HasPrefix(d, "1") {
+		return "US"
+	}
+	var country, code string
+	for c, cc := range callingCodes {
+		if len(cc.code) > len(code) && strings.HasPrefix(d, cc.code) {
+			country, code = c, cc.code
+		}
+	}
+	return country
+}
+
+// lookupPhone normalizes a number used as a search key, falling back to the
+// input as given so that records stored before normalization still match.
+func (s *Server) lookupPhone(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	if p, err := normalizePhone(raw, s.cfg.DefaultCountry); err == nil {
+		return p
+	}
+	return raw
+}
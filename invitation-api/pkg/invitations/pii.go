@@ -0,0 +1,629 @@
+package invitations
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"invitation-api/pkg/config"
+)
+
+const (
+	dataKeyKind = "data_key"
+
+	sealedPrefix = "enc:"  // a sealed value: enc:<data key id>:<nonce and ciphertext>
+	indexPrefix  = "hmac:" // a phone number's blind index
+)
+
+// sealedRecordKinds hold personal data and are stored sealed whole.
+// Suppressions are keyed by phone number, so their IDs are replaced with its
+// blind index as well.
+var sealedRecordKinds = map[string]bool{
+	contactKind: true, suppressionKind: true, privacyRequestKind: true, userKind: true,
+	outboxKind: true, deadLetterKind: true, busKind: true, archiveKind: true, batchKind: true,
+}
+
+// keyWrapper is the master key that data keys are stored wrapped with.
+type keyWrapper interface {
+	wrap(ctx context.Context, key []byte) (string, error)
+	unwrap(ctx context.Context, wrapped string) ([]byte, error)
+	// indexKey derives the key of the phone blind index, which must stay
+	// the same for as long as the data does.
+	indexKey(ctx context.Context) ([]byte, error)
+}
+
+func newKeyWrapper(cfg *config.Config) (keyWrapper, error) {
+	if cfg.PIIVaultAddr != "" {
+		token := os.Getenv("VAULT_TOKEN")
+		if token == "" {
+			return nil, errors.New("pii_vault_addr needs VAULT_TOKEN")
+		}
+		return &vaultKeyWrapper{
+			addr: strings.TrimSuffix(cfg.PIIVaultAddr, "/"), key: cfg.PIIVaultKey, token: token,
+			client: &http.Client{Timeout: 10 * time.Second},
+		}, nil
+	}
+	data, err := os.ReadFile(cfg.PIIKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	s := strings.TrimSpace(string(data))
+	key, err := hex.DecodeString(s)
+	if err != nil {
+		key, err = base64.StdEncoding.DecodeString(s)
+	}
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("pii_key_file must hold a 32-byte key, hex or base64")
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return fileKeyWrapper{key: key, aead: aead}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func sealBytes(aead cipher.AEAD, plaintext, aad []byte) []byte {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		panic("crypto/rand: " + err.Error())
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad)
+}
+
+func openBytes(aead cipher.AEAD, sealed, aad []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("sealed value too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], aad)
+}
+
+type fileKeyWrapper struct {
+	key  []byte
+	aead cipher.AEAD
+}
+
+func (w fileKeyWrapper) wrap(_ context.Context, key []byte) (string, error) {
+	return base64.RawStdEncoding.EncodeToString(sealBytes(w.aead, key, []byte(dataKeyKind))), nil
+}
+
+func (w fileKeyWrapper) unwrap(_ context.Context, wrapped string) ([]byte, error) {
+	sealed, err := base64.RawStdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return openBytes(w.aead, sealed, []byte(dataKeyKind))
+}
+
+func (w fileKeyWrapper) indexKey(context.Context) ([]byte, error) {
+	m := hmac.New(sha256.New, w.key)
+	m.Write([]byte("invit-timer phone index"))
+	return m.Sum(nil), nil
+}
+
+// vaultKeyWrapper wraps data keys with a key of Vault's transit engine,
+// which never leaves Vault.
+type vaultKeyWrapper struct {
+	addr, key, token string
+	client           *http.Client
+}
+
+func (w *vaultKeyWrapper) call(ctx context.Context, op string, body map[string]any, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.addr+"/v1/transit/"+op+"/"+w.key, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", w.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("vault transit %s: %s", op, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(&struct {
+		Data any `json:"data"`
+	}{out})
+}
+
+func (w *vaultKeyWrapper) wrap(ctx context.Context, key []byte) (string, error) {
+	var out struct {
+		Ciphertext string `json:"ciphertext"`
+	}
+	err := w.call(ctx, "encrypt", map[string]any{"plaintext": base64.StdEncoding.EncodeToString(key)}, &out)
+	return out.Ciphertext, err
+}
+
+func (w *vaultKeyWrapper) unwrap(ctx context.Context, wrapped string) ([]byte, error) {
+	var out struct {
+		Plaintext string `json:"plaintext"`
+	}
+	if err := w.call(ctx, "decrypt", map[string]any{"ciphertext": wrapped}, &out); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(out.Plaintext)
+}
+
+// indexKey is Vault's HMAC of a fixed label with the first version of the
+// transit key, which rotating the key leaves alone.
+func (w *vaultKeyWrapper) indexKey(ctx context.Context) ([]byte, error) {
+	var out struct {
+		HMAC string `json:"hmac"`
+	}
+	input := base64.StdEncoding.EncodeToString([]byte("invit-timer phone index"))
+	if err := w.call(ctx, "hmac", map[string]any{"input": input, "key_version": 1}, &out); err != nil {
+		return nil, err
+	}
+	i := strings.LastIndex(out.HMAC, ":")
+	return base64.StdEncoding.DecodeString(out.HMAC[i+1:])
+}
+
+// dataKey is stored wrapped by the master key. Data keys are kept after
+// they are replaced, for reading what they sealed.
+type dataKey struct {
+	ID        string    `json:"id"`
+	Wrapped   string    `json:"wrapped"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// piiCipher seals personal data with the current data key, replacing it
+// once it is older than pii_data_key_ttl, and opens it with whichever key
+// sealed it.
+type piiCipher struct {
+	kms   keyWrapper
+	store Store
+	ttl   time.Duration
+	index []byte
+
+	mu        sync.Mutex
+	keys      map[string]cipher.AEAD
+	current   string
+	currentAt time.Time
+}
+
+func newPIICipher(ctx context.Context, cfg *config.Config, st Store) (*piiCipher, error) {
+	kms, err := newKeyWrapper(cfg)
+	if err != nil {
+		return nil, err
+	}
+	index, err := kms.indexKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("deriving the phone index key: %w", err)
+	}
+	c := &piiCipher{kms: kms, store: st, ttl: cfg.PIIDataKeyTTL, index: index, keys: map[string]cipher.AEAD{}}
+	keys, err := listRecords[dataKey](ctx, st, dataKeyKind)
+	if err != nil {
+		return nil, err
+	}
+	// Unwrapping every key up front fails startup on a wrong master key,
+	// and keeps store reads out of opens inside Update transactions.
+	for _, k := range keys {
+		if _, err := c.key(ctx, k.ID); err != nil {
+			return nil, err
+		}
+		if k.CreatedAt.After(c.currentAt) {
+			c.current, c.currentAt = k.ID, k.CreatedAt
+		}
+	}
+	return c, nil
+}
+
+// key returns data key id, unwrapping it on first use.
+func (c *piiCipher) key(ctx context.Context, id string) (cipher.AEAD, error) {
+	if aead, ok := c.keys[id]; ok {
+		return aead, nil
+	}
+	k, err := getRecord[dataKey](ctx, c.store, dataKeyKind, id)
+	if err != nil {
+		return nil, fmt.Errorf("data key %s: %w", id, err)
+	}
+	raw, err := c.kms.unwrap(ctx, k.Wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("unwrapping data key %s: %w", id, err)
+	}
+	aead, err := newAEAD(raw)
+	if err != nil {
+		return nil, err
+	}
+	c.keys[id] = aead
+	return aead, nil
+}
+
+// currentKey returns the data key to seal with, making a new one when the
+// current one is due for replacement.
+func (c *piiCipher) currentKey(ctx context.Context) (string, cipher.AEAD, error) {
+	if c.current != "" && time.Since(c.currentAt) < c.ttl {
+		aead, err := c.key(ctx, c.current)
+		return c.current, aead, err
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		panic("crypto/rand: " + err.Error())
+	}
+	wrapped, err := c.kms.wrap(ctx, raw)
+	if err != nil {
+		return "", nil, fmt.Errorf("wrapping a data key: %w", err)
+	}
+	k := dataKey{ID: randomHex(8), Wrapped: wrapped, CreatedAt: time.Now().UTC()}
+	if err := putRecord(ctx, c.store, dataKeyKind, k.ID, k); err != nil {
+		return "", nil, err
+	}
+	aead, err := newAEAD(raw)
+	if err != nil {
+		return "", nil, err
+	}
+	slog.InfoContext(ctx, "created data key", "data_key_id", k.ID)
+	c.keys[k.ID], c.current, c.currentAt = aead, k.ID, k.CreatedAt
+	return k.ID, aead, nil
+}
+
+// prepare makes sure the current data key is ready, so that replacing it
+// doesn't write to the store from inside another transaction.
+func (c *piiCipher) prepare(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, _, err := c.currentKey(ctx)
+	return err
+}
+
+// seal encrypts v, bound to aad, which must be given again to open it.
+func (c *piiCipher) seal(ctx context.Context, v, aad string) (string, error) {
+	if v == "" {
+		return "", nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id, aead, err := c.currentKey(ctx)
+	if err != nil {
+		return "", err
+	}
+	return sealedPrefix + id + ":" + base64.RawStdEncoding.EncodeToString(sealBytes(aead, []byte(v), []byte(aad))), nil
+}
+
+// open decrypts what seal made, and returns anything else, written before
+// encryption was turned on, as it is.
+func (c *piiCipher) open(ctx context.Context, v, aad string) (string, error) {
+	rest, ok := strings.CutPrefix(v, sealedPrefix)
+	if !ok {
+		return v, nil
+	}
+	id, enc, ok := strings.Cut(rest, ":")
+	sealed, err := base64.RawStdEncoding.DecodeString(enc)
+	if !ok || err != nil {
+		return "", errors.New("malformed sealed value")
+	}
+	c.mu.Lock()
+	aead, err := c.key(ctx, id)
+	c.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	plain, err := openBytes(aead, sealed, []byte(aad))
+	return string(plain), err
+}
+
+// blindIndex stands in for a phone number where the store looks it up.
+func (c *piiCipher) blindIndex(phone string) string {
+	if phone == "" || strings.HasPrefix(phone, indexPrefix) {
+		return phone
+	}
+	m := hmac.New(sha256.New, c.index)
+	m.Write([]byte(phone))
+	return indexPrefix + hex.EncodeToString(m.Sum(nil))
+}
+
+// sealedStore encrypts personal data on its way into the store below it
+// and decrypts it on the way out, so that only the service above ever sees
+// it in the clear. An invitation's phone number is stored as its blind
+// index, in the column or key the store looks it up by, and sealed in
+// sealed_phone_number; its raw number, email and note, and the host's phone
+// and email, are sealed in place.
+type sealedStore struct {
+	next Store
+	c    *piiCipher
+}
+
+// sealedFields are the fields of inv sealed in place, by the name each is
+// bound to. The host's are in a copy of inv.Notify, so that sealing or
+// opening inv leaves the one it was given alone.
+func sealedFields(inv *Invitation) map[string]*string {
+	fields := map[string]*string{"phone_number_raw": &inv.PhoneRaw, "email": &inv.Email, "note": &inv.Note, "notes": &inv.Notes}
+	if inv.Notify != nil {
+		n := *inv.Notify
+		inv.Notify = &n
+		fields["notify.phone"], fields["notify.email"] = &n.Phone, &n.Email
+	}
+	return fields
+}
+
+func (st sealedStore) sealInvitation(ctx context.Context, inv Invitation) (Invitation, error) {
+	var err error
+	if inv.PhoneNumber != "" && !strings.HasPrefix(inv.PhoneNumber, indexPrefix) {
+		if inv.SealedPhone, err = st.c.seal(ctx, inv.PhoneNumber, inv.ID+".phone_number"); err != nil {
+			return inv, err
+		}
+		inv.PhoneNumber = st.c.blindIndex(inv.PhoneNumber)
+	}
+	for field, v := range sealedFields(&inv) {
+		if strings.HasPrefix(*v, sealedPrefix) {
+			continue
+		}
+		if *v, err = st.c.seal(ctx, *v, inv.ID+"."+field); err != nil {
+			return inv, err
+		}
+	}
+	return inv, nil
+}
+
+func (st sealedStore) openInvitation(ctx context.Context, inv Invitation) (Invitation, error) {
+	var err error
+	if inv.SealedPhone != "" {
+		if inv.PhoneNumber, err = st.c.open(ctx, inv.SealedPhone, inv.ID+".phone_number"); err != nil {
+			return inv, fmt.Errorf("invitation %s: %w", inv.ID, err)
+		}
+		inv.SealedPhone = ""
+	}
+	for field, v := range sealedFields(&inv) {
+		if *v, err = st.c.open(ctx, *v, inv.ID+"."+field); err != nil {
+			return inv, fmt.Errorf("invitation %s: %w", inv.ID, err)
+		}
+	}
+	return inv, nil
+}
+
+func (st sealedStore) Create(ctx context.Context, inv Invitation) error {
+	sealed, err := st.sealInvitation(ctx, inv)
+	if err != nil {
+		return err
+	}
+	return st.next.Create(ctx, sealed)
+}
+
+func (st sealedStore) Get(ctx context.Context, id string) (Invitation, error) {
+	inv, err := st.next.Get(ctx, id)
+	if err != nil {
+		return inv, err
+	}
+	return st.openInvitation(ctx, inv)
+}
+
+func (st sealedStore) Update(ctx context.Context, id string, fn func(*Invitation) error) (Invitation, error) {
+	if err := st.c.prepare(ctx); err != nil {
+		return Invitation{}, err
+	}
+	inv, err := st.next.Update(ctx, id, func(stored *Invitation) error {
+		inv, err := st.openInvitation(ctx, *stored)
+		if err != nil {
+			return err
+		}
+		if err := fn(&inv); err != nil {
+			return err
+		}
+		*stored, err = st.sealInvitation(ctx, inv)
+		return err
+	})
+	if err != nil {
+		return inv, err
+	}
+	return st.openInvitation(ctx, inv)
+}
+
+func (st sealedStore) List(ctx context.Context, f ListFilter) ([]Invitation, error) {
+	f.PhoneNumber = st.c.blindIndex(f.PhoneNumber)
+	invs, err := st.next.List(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	for i := range invs {
+		if invs[i], err = st.openInvitation(ctx, invs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return invs, nil
+}
+
+// Stats needs none of the sealed fields.
+func (st sealedStore) Stats(ctx context.Context, f StatsFilter) (InvitationStats, error) {
+	return st.next.Stats(ctx, f)
+}
+
+func (st sealedStore) DeleteExpired(ctx context.Context, before time.Time) (int, error) {
+	return st.next.DeleteExpired(ctx, before)
+}
+
+func (st sealedStore) Delete(ctx context.Context, id string) error { return st.next.Delete(ctx, id) }
+
+func (st sealedStore) AppendEvent(ctx context.Context, id string, ev InvitationEvent) error {
+	var err error
+	if ev.Note, err = st.c.seal(ctx, ev.Note, id+".event.note"); err != nil {
+		return err
+	}
+	return st.next.AppendEvent(ctx, id, ev)
+}
+
+func (st sealedStore) Events(ctx context.Context, id string) ([]InvitationEvent, error) {
+	evs, err := st.next.Events(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	for i := range evs {
+		if evs[i].Note, err = st.c.open(ctx, evs[i].Note, id+".event.note"); err != nil {
+			return nil, err
+		}
+	}
+	return evs, nil
+}
+
+func (st sealedStore) DeleteEvents(ctx context.Context, id string) error {
+	return st.next.DeleteEvents(ctx, id)
+}
+
+// recordKey returns whether records of kind, which may carry a tenant
+// suffix, are sealed, and the ID to store record id under. Sealed records
+// are bound to their kind, tenant included.
+func (st sealedStore) recordKey(kind, id string) (bool, string) {
+	base, _, _ := strings.Cut(kind, ":")
+	if base == suppressionKind {
+		id = st.c.blindIndex(id)
+	}
+	return sealedRecordKinds[base], id
+}
+
+func (st sealedStore) PutRecord(ctx context.Context, kind, id string, data []byte) error {
+	sealed, id := st.recordKey(kind, id)
+	if sealed {
+		v, err := st.c.seal(ctx, string(data), kind)
+		if err != nil {
+			return err
+		}
+		data = []byte(v)
+	}
+	return st.next.PutRecord(ctx, kind, id, data)
+}
+
+func (st sealedStore) GetRecord(ctx context.Context, kind, id string) ([]byte, error) {
+	sealed, id := st.recordKey(kind, id)
+	data, err := st.next.GetRecord(ctx, kind, id)
+	if err != nil || !sealed {
+		return data, err
+	}
+	v, err := st.c.open(ctx, string(data), kind)
+	return []byte(v), err
+}
+
+func (st sealedStore) ListRecords(ctx context.Context, kind string) ([][]byte, error) {
+	docs, err := st.next.ListRecords(ctx, kind)
+	if err != nil {
+		return nil, err
+	}
+	if sealed, _ := st.recordKey(kind, ""); !sealed {
+		return docs, nil
+	}
+	for i, data := range docs {
+		v, err := st.c.open(ctx, string(data), kind)
+		if err != nil {
+			return nil, err
+		}
+		docs[i] = []byte(v)
+	}
+	return docs, nil
+}
+
+func (st sealedStore) DeleteRecord(ctx context.Context, kind, id string) error {
+	_, id = st.recordKey(kind, id)
+	return st.next.DeleteRecord(ctx, kind, id)
+}
+
+func (st sealedStore) Ping(ctx context.Context) error { return st.next.Ping(ctx) }
+func (st sealedStore) Close() error                   { return st.next.Close() }
+
+// sealLegacy seals what was stored before encryption was turned on, so
+// that lookups by phone find it. Invitations it rewrites get new versions.
+func (st sealedStore) sealLegacy(ctx context.Context) error {
+	invs, err := st.next.List(ctx, ListFilter{})
+	if err != nil {
+		return err
+	}
+	plain := func(v string) bool { return v != "" && !strings.HasPrefix(v, sealedPrefix) }
+	n := 0
+	for _, inv := range invs {
+		// Or sealed before the host's contact details were.
+		legacy := inv.SealedPhone == "" && (inv.PhoneNumber != "" || inv.Email != "" || inv.Note != "")
+		if !legacy && (inv.Notify == nil || !plain(inv.Notify.Phone) && !plain(inv.Notify.Email)) {
+			continue
+		}
+		if _, err := st.Update(ctx, inv.ID, func(*Invitation) error { return nil }); err != nil && err != errNotFound {
+			return err
+		}
+		evs, err := st.next.Events(ctx, inv.ID)
+		if err != nil {
+			return err
+		}
+		if slices.ContainsFunc(evs, func(ev InvitationEvent) bool { return ev.Note != "" && !strings.HasPrefix(ev.Note, sealedPrefix) }) {
+			if err := st.next.DeleteEvents(ctx, inv.ID); err != nil {
+				return err
+			}
+			for _, ev := range evs {
+				if err := st.AppendEvent(ctx, inv.ID, ev); err != nil {
+					return err
+				}
+			}
+		}
+		n++
+	}
+
+	tenants, err := listRecords[tenant](ctx, st.next, tenantKind)
+	if err != nil {
+		return err
+	}
+	for base := range sealedRecordKinds {
+		kinds := []string{base}
+		for _, t := range tenants {
+			kinds = append(kinds, base+":"+t.ID)
+		}
+		for _, kind := range kinds {
+			docs, err := st.next.ListRecords(ctx, kind)
+			if err != nil {
+				return err
+			}
+			for _, data := range docs {
+				if bytes.HasPrefix(data, []byte(sealedPrefix)) {
+					continue
+				}
+				var doc struct {
+					ID          string `json:"id"`
+					PhoneNumber string `json:"phone_number"`
+				}
+				if err := json.Unmarshal(data, &doc); err != nil {
+					return fmt.Errorf("%s record: %w", kind, err)
+				}
+				id := doc.ID
+				if base == suppressionKind {
+					id = doc.PhoneNumber
+				}
+				if err := st.PutRecord(ctx, kind, id, data); err != nil {
+					return err
+				}
+				if _, stored := st.recordKey(kind, id); stored != id {
+					if err := st.next.DeleteRecord(ctx, kind, id); err != nil && err != errNotFound {
+						return err
+					}
+				}
+				n++
+			}
+		}
+	}
+	if n > 0 {
+		slog.InfoContext(ctx, "encrypted existing personal data", "count", n)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package invitations
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"invitation-api/pkg/config"
+)
+
+// newSealedStore returns a sealedStore over a memory store, which it also
+// returns to look at what was stored.
+func newSealedStore(t *testing.T) (sealedStore, Store) {
+	t.Helper()
+	key := filepath.Join(t.TempDir(), "pii.key")
+	if err := os.WriteFile(key, []byte(strings.Repeat("ab", 32)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load([]string{"-require-api-key=false", "-pii-key-file=" + key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := NewMemoryStore()
+	c, err := newPIICipher(context.Background(), cfg, mem)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sealedStore{next: mem, c: c}, mem
+}
+
+func isSealed(v string) bool { return strings.HasPrefix(v, sealedPrefix) }
+
+func sameContact(a, b *HostNotify) bool {
+	return a.Phone == b.Phone && a.Email == b.Email && a.WebhookURL == b.WebhookURL
+}
+
+func TestSealedStoreSealsHostContact(t *testing.T) {
+	st, raw := newSealedStore(t)
+	ctx := context.Background()
+	notify := &HostNotify{Phone: "+14155550199", Email: "host@example.com", WebhookURL: "https://host.example.com/hook"}
+	inv := Invitation{ID: "inv-1", PhoneNumber: "+14155550101", Email: "guest@example.com", Notify: notify, CreatedAt: testStart, ExpiresAt: testStart}
+	if err := st.Create(ctx, inv); err != nil {
+		t.Fatal(err)
+	}
+	if inv.Notify.Phone != "+14155550199" || inv.Notify.Email != "host@example.com" {
+		t.Fatalf("sealing changed the caller's notify: %+v", inv.Notify)
+	}
+
+	check := func(when string) {
+		t.Helper()
+		stored, err := raw.Get(ctx, inv.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := stored.Notify; !isSealed(n.Phone) || !isSealed(n.Email) || n.WebhookURL != notify.WebhookURL {
+			t.Errorf("%s: stored notify %+v, want phone and email sealed", when, n)
+		}
+		got, err := st.Get(ctx, inv.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameContact(got.Notify, notify) {
+			t.Errorf("%s: opened notify %+v, want %+v", when, got.Notify, notify)
+		}
+	}
+	check("created")
+
+	updated, err := st.Update(ctx, inv.ID, func(inv *Invitation) error {
+		if inv.Notify.Phone != notify.Phone {
+			t.Errorf("updating with notify phone %q", inv.Notify.Phone)
+		}
+		inv.Response = "yes"
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameContact(updated.Notify, notify) {
+		t.Errorf("updated notify %+v, want %+v", updated.Notify, notify)
+	}
+	check("updated")
+
+	invs, err := st.List(ctx, ListFilter{PhoneNumber: inv.PhoneNumber})
+	if err != nil || len(invs) != 1 || !sameContact(invs[0].Notify, notify) {
+		t.Errorf("listed %+v, %v; want the invitation with its notify opened", invs, err)
+	}
+}
+
+func TestSealLegacySealsHostContact(t *testing.T) {
+	st, raw := newSealedStore(t)
+	ctx := context.Background()
+	// As sealed before the host's details were.
+	inv := Invitation{ID: "inv-1", PhoneNumber: "+14155550101", CreatedAt: testStart, ExpiresAt: testStart}
+	sealed, err := st.sealInvitation(ctx, inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed.Notify = &HostNotify{Phone: "+14155550199", Email: "host@example.com"}
+	if err := raw.Create(ctx, sealed); err != nil {
+		t.Fatal(err)
+	}
+	b := batch{ID: "batch-1", Notify: &HostNotify{Phone: "+14155550199"}}
+	if err := putRecord(ctx, raw, batchKind, b.ID, b); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.sealLegacy(ctx); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := raw.Get(ctx, inv.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isSealed(stored.Notify.Phone) || !isSealed(stored.Notify.Email) {
+		t.Errorf("stored notify %+v, want it sealed", stored.Notify)
+	}
+	if got, err := st.Get(ctx, inv.ID); err != nil || got.Notify.Phone != "+14155550199" || got.PhoneNumber != inv.PhoneNumber {
+		t.Errorf("opened %+v, %v", got, err)
+	}
+
+	data, err := raw.GetRecord(ctx, batchKind, b.ID)
+	if err != nil || !isSealed(string(data)) {
+		t.Errorf("stored batch %s, %v; want it sealed", data, err)
+	}
+	if got, err := getRecord[batch](ctx, st, batchKind, b.ID); err != nil || got.Notify.Phone != "+14155550199" {
+		t.Errorf("opened batch %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,166 @@
+package invitations
+
+import (
+	"maps"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxQuestions      = 5
+	maxQuestionLen    = 200
+	answerFieldPrefix = "answer_"
+)
+
+var questionIDPattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// Question is asked alongside the invitation's own response, as in "Which
+// day works?" with options Mon, Tue and Wed. Answers are recorded by
+// question ID in Invitation.Answers.
+type Question struct {
+	ID      string   `json:"id"`
+	Text    string   `json:"text"`
+	Options []string `json:"options"`
+}
+
+// validateQuestions checks the questions of a create request, numbering
+// those without an ID q1, q2 and so on.
+func validateQuestions(qs []Question) ([]Question, error) {
+	if len(qs) > maxQuestions {
+		return nil, badRequest("questions may have at most " + strconv.Itoa(maxQuestions) + " entries")
+	}
+	seen := map[string]bool{}
+	result := make([]Question, 0, len(qs))
+	for i, q := range qs {
+		field := "questions[" + strconv.Itoa(i) + "]"
+		if q.ID == "" {
+			q.ID = "q" + strconv.Itoa(i+1)
+		}
+		if !questionIDPattern.MatchString(q.ID) {
+			return nil, badRequest(field + ".id must be 1 to 32 lowercase letters, digits, dashes or underscores")
+		}
+		if seen[q.ID] {
+			return nil, badRequest(field + ".id must be unique")
+		}
+		seen[q.ID] = true
+		if q.Text = strings.TrimSpace(q.Text); q.Text == "" || len(q.Text) > maxQuestionLen {
+			return nil, badRequest(field + ".text must be between 1 and " + strconv.Itoa(maxQuestionLen) + " bytes")
+		}
+		if len(q.Options) == 0 {
+			return nil, badRequest(field + ".options is required")
+		}
+		opts, err := validateOptions(q.Options)
+		if err != nil {
+			return nil, badRequest(field + "." + strings.TrimPrefix(err.Error(), "response_"))
+		}
+		q.Options = opts
+		result = append(result, q)
+	}
+	if len(result) == 0 {
+		return nil, nil
+	}
+	return result, nil
+}
+
+// matchAnswers resolves the answers given to inv's questions, each to one
+// of its question's options.
+func matchAnswers(qs []Question, given map[string]string) (map[string]string, error) {
+	if len(given) == 0 {
+		return nil, nil
+	}
+	answers := make(map[string]string, len(given))
+	for id, a := range given {
+		i := questionIndex(qs, id)
+		if i < 0 {
+			return nil, badRequest("answers has no question " + strconv.Quote(id))
+		}
+		opt, ok := matchResponse(qs[i].Options, a)
+		if !ok {
+			return nil, badRequest("answers." + id + " must be one of: " + strings.Join(qs[i].Options, ", "))
+		}
+		answers[id] = opt
+	}
+	return answers, nil
+}
+
+func questionIndex(qs []Question, id string) int {
+	for i, q := range qs {
+		if q.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// applyAnswers merges answers into inv's and returns what changed. Answers
+// not given again are kept, so they can be changed one at a time.
+func applyAnswers(inv *Invitation, answers map[string]string) []Change {
+	if len(answers) == 0 {
+		return nil
+	}
+	var changes []Change
+	merged := maps.Clone(inv.Answers)
+	if merged == nil {
+		merged = make(map[string]string, len(answers))
+	}
+	for _, q := range inv.Questions {
+		a, ok := answers[q.ID]
+		if !ok {
+			continue
+		}
+		if old, had := merged[q.ID]; had && old != a {
+			changes = append(changes, Change{Field: "answers." + q.ID, Old: old, New: a})
+		}
+		merged[q.ID] = a
+	}
+	inv.Answers = merged
+	return changes
+}
+
+// parseSMSAnswers reads one answer per question, in order, from the start
+// of text that follows the response, as in "yes 2 1", returning the rest
+// as the note. Unless every question is answered, text is all note.
+func parseSMSAnswers(qs []Question, text string) (map[string]string, string, bool) {
+	words := strings.Fields(text)
+	if len(words) < len(qs) {
+		return nil, text, false
+	}
+	answers := make(map[string]string, len(qs))
+	for i, q := range qs {
+		opt, ok := matchResponse(q.Options, strings.TrimSuffix(words[i], ","))
+		if !ok {
+			return nil, text, false
+		}
+		answers[q.ID] = opt
+	}
+	return answers, strings.Join(words[len(qs):], " "), true
+}
+
+// questionsHint tells SMS invitees how to answer the questions in the same
+// reply as their response.
+func questionsHint(locale string, qs []Question) string {
+	if len(qs) == 0 {
+		return ""
+	}
+	parts := make([]string, len(qs))
+	for i, q := range qs {
+		opts := make([]string, len(q.Options))
+		for j, o := range q.Options {
+			opts[j] = strconv.Itoa(j+1) + ") " + o
+		}
+		parts[i] = q.Text + " " + strings.Join(opts, " ")
+	}
+	return localize(locale, "reply_questions", strings.Join(parts, "; "))
+}
+
+// addAnswers counts inv's answers into byQuestion, by question ID and then
+// option.
+func addAnswers(byQuestion map[string]map[string]int, inv Invitation) {
+	for id, a := range inv.Answers {
+		if byQuestion[id] == nil {
+			byQuestion[id] = map[string]int{}
+		}
+		byQuestion[id][a]++
+	}
+}
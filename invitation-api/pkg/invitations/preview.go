@@ -0,0 +1,115 @@
+package invitations
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// invitationPreview is what creating an invitation would send, for UIs to
+// show before it is created.
+type invitationPreview struct {
+	// Invitation is as it would be stored, without an ID.
+	Invitation Invitation       `json:"invitation"`
+	Messages   []previewMessage `json:"messages"`
+	// Cost is the estimate for the messages on the invitation's own
+	// channels; fallbacks go out only if those aren't answered.
+	Cost     float64 `json:"cost"`
+	Currency string  `json:"currency"`
+}
+
+type previewMessage struct {
+	Channel  string       `json:"channel"`
+	Body     string       `json:"body"`
+	SMS      *SMSEstimate `json:"sms,omitempty"`
+	Cost     float64      `json:"cost"`
+	Fallback bool         `json:"fallback,omitempty"`
+}
+
+// previewInvitation validates req as createFromRequest does and renders the
+// invitation on each of its channels, storing and sending nothing. The
+// response link is a real one's shape but leads nowhere.
+func (s *Server) previewInvitation(ctx context.Context, req CreateInvitationRequest) (invitationPreview, error) {
+	if err := s.resolveContact(ctx, &req); err != nil {
+		return invitationPreview{}, err
+	}
+	if err := s.resolveTemplate(ctx, &req); err != nil {
+		return invitationPreview{}, err
+	}
+	if req.BatchID != "" {
+		if _, err := s.store.GetRecord(ctx, batchKind, req.BatchID); err == errNotFound {
+			return invitationPreview{}, &requestError{status: http.StatusUnprocessableEntity, msg: "unknown batch_id"}
+		} else if err != nil {
+			return invitationPreview{}, err
+		}
+	}
+	req.preview = true
+	inv, err := s.newInvitation(ctx, req)
+	if err != nil {
+		return invitationPreview{}, err
+	}
+	// Rendered again with an ID, as createInvitation does, for signed links.
+	inv.ID = s.ids.NewID()
+	if err := s.renderMessage(&inv); err != nil {
+		return invitationPreview{}, err
+	}
+	if err := s.checkSMSLength(&inv); err != nil {
+		return invitationPreview{}, err
+	}
+
+	p := invitationPreview{Currency: s.cfg.Currency, Messages: []previewMessage{}}
+	text := strings.TrimSpace(s.inviteText(inv))
+	var micros int64
+	add := func(ch string, fallback bool) {
+		m := previewMessage{Channel: ch, Body: s.channelText(inv, ch, text), Fallback: fallback}
+		segments := 1
+		if ch == channelSMS {
+			e := estimateSMS(m.Body)
+			m.SMS, segments = &e, e.Segments
+		}
+		var country string
+		switch ch {
+		case channelSMS, channelVoice, channelWhatsApp:
+			country = phoneCountry(inv.PhoneNumber)
+		}
+		var cost int64
+		if !inv.Test {
+			cost = costMicros(s.prices, ch, s.messageProvider(ctx, inv, ch), country, segments)
+		}
+		m.Cost = float64(cost) / 1e6
+		if !fallback {
+			micros += cost
+		}
+		p.Messages = append(p.Messages, m)
+	}
+	channels := channelsFor(inv)
+	for _, ch := range channels {
+		add(ch, false)
+	}
+	if inv.Fallback != nil {
+		for _, ch := range inv.Fallback.Channels {
+			if !slices.Contains(channels, ch) {
+				add(ch, true)
+			}
+		}
+	}
+	p.Cost = float64(micros) / 1e6
+	inv.ID, inv.ResponseToken = "", ""
+	p.Invitation = inv.withStatus(s.now())
+	return p, nil
+}
+
+func (s *Server) handlePreviewInvitation(w http.ResponseWriter, r *http.Request) {
+	var req CreateInvitationRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	p, err := s.previewInvitation(r.Context(), req)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
@@ -0,0 +1,190 @@
+package invitations
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+const privacyRequestKind = "privacy_request"
+
+// privacyRequest is the audit entry kept for each subject access or erasure
+// request. The phone number is masked so the entry itself doesn't keep
+// what was erased.
+type privacyRequest struct {
+	ID           string    `json:"id"`
+	Type         string    `json:"type"` // export or erase
+	PhoneNumber  string    `json:"phone_number"`
+	Invitations  int       `json:"invitations"`
+	Contacts     int       `json:"contacts"`
+	Actor        string    `json:"actor"`
+	CreatedAt    time.Time `json:"created_at"`
+	CreatedByKey string    `json:"created_by_key,omitempty"`
+}
+
+type privacyInvitation struct {
+	Invitation
+	Events []InvitationEvent `json:"events"`
+}
+
+type privacyExport struct {
+	PhoneNumber string              `json:"phone_number"`
+	Invitations []privacyInvitation `json:"invitations"`
+	Contacts    []contact           `json:"contacts"`
+	Messages    []outboundMessage   `json:"messages"`
+}
+
+// privacyPhone reads the required ?phone= of a privacy request.
+func (s *Server) privacyPhone(r *http.Request) (string, error) {
+	phone := s.lookupPhone(r.URL.Query().Get("phone"))
+	if phone == "" {
+		return "", badRequest("phone is required")
+	}
+	return phone, nil
+}
+
+// subjectData finds everything held about phone: its invitations, address
+// book entries and messages still queued or dead-lettered for them.
+func (s *Server) subjectData(ctx context.Context, phone string) (privacyExport, error) {
+	out := privacyExport{PhoneNumber: phone, Invitations: []privacyInvitation{}, Contacts: []contact{}, Messages: []outboundMessage{}}
+	invs, err := s.store.List(ctx, ListFilter{PhoneNumber: phone})
+	if err != nil {
+		return out, err
+	}
+	t := s.now()
+	archived, err := s.listArchived(ctx, ListFilter{PhoneNumber: phone, AsOf: t})
+	if err != nil {
+		return out, err
+	}
+	invs = append(invs, archived...)
+	ids := make(map[string]bool, len(invs))
+	for _, inv := range invs {
+		events, err := s.invitationEvents(ctx, inv)
+		if err != nil {
+			return out, err
+		}
+		out.Invitations = append(out.Invitations, privacyInvitation{inv.withStatus(t), events})
+		ids[inv.ID] = true
+	}
+	contacts, err := listRecords[contact](ctx, s.store, contactKind)
+	if err != nil {
+		return out, err
+	}
+	for _, c := range contacts {
+		if c.PhoneNumber == phone {
+			out.Contacts = append(out.Contacts, c)
+		}
+	}
+	for _, kind := range []string{outboxKind, deadLetterKind} {
+		msgs, err := listRecords[outboundMessage](ctx, s.store, kind)
+		if err != nil {
+			return out, err
+		}
+		for _, m := range msgs {
+			if ids[m.InvitationID] {
+				out.Messages = append(out.Messages, m)
+			}
+		}
+	}
+	return out, nil
+}
+
+func (s *Server) auditPrivacyRequest(ctx context.Context, typ, phone string, invitations, contacts int) (privacyRequest, error) {
+	pr := privacyRequest{
+		ID:          s.ids.NewID(),
+		Type:        typ,
+		PhoneNumber: maskPhone(phone),
+		Invitations: invitations,
+		Contacts:    contacts,
+		Actor:       actorFrom(ctx),
+		CreatedAt:   s.now().UTC(),
+	}
+	if k, ok := apiKeyFrom(ctx); ok {
+		pr.CreatedByKey = k.ID
+	}
+	return pr, putRecord(ctx, s.store, privacyRequestKind, pr.ID, pr)
+}
+
+// handlePrivacyExport answers a subject access request with everything
+// held for a phone number.
+func (s *Server) handlePrivacyExport(w http.ResponseWriter, r *http.Request) {
+	phone, err := s.privacyPhone(r)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	data, err := s.subjectData(r.Context(), phone)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if _, err := s.auditPrivacyRequest(r.Context(), "export", phone, len(data.Invitations), len(data.Contacts)); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, data)
+}
+
+// handlePrivacyErase anonymizes every invitation sent to a phone number,
+// keeping responses and timestamps so batch and dashboard counts still add
+// up, deletes its address book entries, drops messages not yet sent and
+// forgets its pool sender.
+func (s *Server) handlePrivacyErase(w http.ResponseWriter, r *http.Request) {
+	phone, err := s.privacyPhone(r)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	data, err := s.subjectData(r.Context(), phone)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	for _, m := range data.Messages {
+		kind := outboxKind
+		if !m.FailedAt.IsZero() {
+			kind = deadLetterKind
+		}
+		if err := s.store.DeleteRecord(r.Context(), kind, m.ID); err != nil && err != errNotFound {
+			writeResponseError(w, r, err)
+			return
+		}
+	}
+	for _, inv := range data.Invitations {
+		if err := s.anonymize(r.Context(), inv.Invitation); err != nil {
+			writeResponseError(w, r, err)
+			return
+		}
+	}
+	for _, c := range data.Contacts {
+		if err := s.store.DeleteRecord(r.Context(), contactKind, c.ID); err != nil && err != errNotFound {
+			writeResponseError(w, r, err)
+			return
+		}
+	}
+	if err := s.forgetSender(r.Context(), phone); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	pr, err := s.auditPrivacyRequest(r.Context(), "erase", phone, len(data.Invitations), len(data.Contacts))
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, pr)
+}
+
+// handleListPrivacyRequests lists the audit entries for past export and
+// erase requests.
+func (s *Server) handleListPrivacyRequests(w http.ResponseWriter, r *http.Request) {
+	reqs, err := listRecords[privacyRequest](r.Context(), s.store, privacyRequestKind)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if reqs == nil {
+		reqs = []privacyRequest{}
+	}
+	writeJSON(w, http.StatusOK, reqs)
+}
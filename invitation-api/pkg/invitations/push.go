@@ -0,0 +1,359 @@
+package invitations
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	platformFCM  = "fcm"
+	platformAPNs = "apns"
+)
+
+// pushSender delivers one notification to a device token and returns the
+// provider's ID for it.
+type pushSender interface {
+	push(ctx context.Context, token string, n pushNotification) (id string, err error)
+}
+
+type pushNotification struct {
+	Title string
+	Body  string
+	Data  map[string]string
+}
+
+// newPushSenders builds a sender per platform: FCM when
+// FCM_CREDENTIALS_FILE names a service account key, APNs when APNS_KEY_FILE
+// names a .p8 key, and otherwise one that only logs.
+func newPushSenders() (map[string]pushSender, error) {
+	senders := map[string]pushSender{platformFCM: logPushSender{platformFCM}, platformAPNs: logPushSender{platformAPNs}}
+	if path := os.Getenv("FCM_CREDENTIALS_FILE"); path != "" {
+		s, err := newFCMSender(path)
+		if err != nil {
+			return nil, err
+		}
+		senders[platformFCM] = s
+	}
+	if path := os.Getenv("APNS_KEY_FILE"); path != "" {
+		s, err := newAPNsSender(path)
+		if err != nil {
+			return nil, err
+		}
+		senders[platformAPNs] = s
+	}
+	return senders, nil
+}
+
+type logPushSender struct{ platform string }
+
+func (l logPushSender) push(ctx context.Context, token string, n pushNotification) (string, error) {
+	id := "log-" + randomHex(8)
+	slog.InfoContext(ctx, "sending push", "platform", l.platform, "title", n.Title, "body", n.Body, "message_id", id)
+	return id, nil
+}
+
+// pushNotifier sends invitations to the device named by the invitation's
+// device_id, looked up when each message goes out so refreshed tokens are
+// used.
+type pushNotifier struct {
+	store   Store
+	senders map[string]pushSender
+}
+
+func (p pushNotifier) Notify(ctx context.Context, inv Invitation, message string) (string, error) {
+	d, err := getRecord[device](ctx, p.store, deviceKind, inv.DeviceID)
+	if err == errNotFound {
+		return "", errors.New("device not registered")
+	}
+	if err != nil {
+		return "", transientError{err}
+	}
+	return p.senders[d.Platform].push(ctx, d.Token, pushNotification{
+		Title: localize(inv.Locale, "page_title"),
+		Body:  message,
+		Data:  map[string]string{"invitation_id": inv.ID},
+	})
+}
+
+// signJWT returns a compact JWS of header and claims, signed by sign over
+// the signing input.
+func signJWT(header, claims map[string]any, sign func([]byte) ([]byte, error)) (string, error) {
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	sig, err := sign([]byte(input))
+	if err != nil {
+		return "", err
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func parsePKCS8PEM(data []byte) (any, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	return x509.ParsePKCS8PrivateKey(block.Bytes)
+}
+
+// fcmSender uses the FCM HTTP v1 API, authenticating with OAuth access
+// tokens obtained for a service account and cached until shortly before
+// they expire.
+type fcmSender struct {
+	projectID   string
+	clientEmail string
+	tokenURI    string
+	key         *rsa.PrivateKey
+	client      *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+func newFCMSender(path string) (*fcmSender, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("FCM credentials: %w", err)
+	}
+	var sa struct {
+		ProjectID   string `json:"project_id"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(data, &sa); err != nil {
+		return nil, fmt.Errorf("FCM credentials: %w", err)
+	}
+	k, err := parsePKCS8PEM([]byte(sa.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("FCM credentials: %w", err)
+	}
+	key, ok := k.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("FCM credentials: private_key is not an RSA key")
+	}
+	if sa.ProjectID == "" || sa.ClientEmail == "" {
+		return nil, errors.New("FCM credentials: project_id and client_email are required")
+	}
+	if sa.TokenURI == "" {
+		sa.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	return &fcmSender{
+		projectID: sa.ProjectID, clientEmail: sa.ClientEmail, tokenURI: sa.TokenURI, key: key,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (f *fcmSender) token(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.accessToken != "" && time.Now().Before(f.expiresAt) {
+		return f.accessToken, nil
+	}
+	now := time.Now()
+	assertion, err := signJWT(
+		map[string]any{"alg": "RS256", "typ": "JWT"},
+		map[string]any{
+			"iss":   f.clientEmail,
+			"scope": "https://www.googleapis.com/auth/firebase.messaging",
+			"aud":   f.tokenURI,
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Hour).Unix(),
+		},
+		func(input []byte) ([]byte, error) {
+			sum := sha256.Sum256(input)
+			return rsa.SignPKCS1v15(rand.Reader, f.key, crypto.SHA256, sum[:])
+		})
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"}, "assertion": {assertion}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", transientError{err}
+	}
+	defer resp.Body.Close()
+	if err := classifyHTTP("fcm", resp); err != nil {
+		return "", err
+	}
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return "", transientError{err}
+	}
+	f.accessToken = tok.AccessToken
+	f.expiresAt = now.Add(time.Duration(tok.ExpiresIn)*time.Second - time.Minute)
+	return f.accessToken, nil
+}
+
+func (f *fcmSender) push(ctx context.Context, token string, n pushNotification) (string, error) {
+	access, err := f.token(ctx)
+	if err != nil {
+		return "", err
+	}
+	body, err := json.Marshal(map[string]any{"message": map[string]any{
+		"token":        token,
+		"notification": map[string]string{"title": n.Title, "body": n.Body},
+		"data":         n.Data,
+	}})
+	if err != nil {
+		return "", err
+	}
+	endpoint := "https://fcm.googleapis.com/v1/projects/" + f.projectID + "/messages:send"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+access)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", transientError{err}
+	}
+	defer resp.Body.Close()
+	if err := classifyHTTP("fcm", resp); err != nil {
+		return "", err
+	}
+	var sent struct {
+		Name string `json:"name"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&sent)
+	return sent.Name, nil
+}
+
+// apnsSender uses token-based authentication: a JWT signed with the team's
+// key, reused for 50 minutes as Apple asks. APNS_SANDBOX=true sends to the
+// development environment.
+type apnsSender struct {
+	keyID, teamID, topic string
+	host                 string
+	key                  *ecdsa.PrivateKey
+	client               *http.Client
+
+	mu       sync.Mutex
+	jwt      string
+	issuedAt time.Time
+}
+
+func newAPNsSender(path string) (*apnsSender, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("APNs key: %w", err)
+	}
+	k, err := parsePKCS8PEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("APNs key: %w", err)
+	}
+	key, ok := k.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("APNs key: not an EC key")
+	}
+	s := &apnsSender{
+		keyID:  os.Getenv("APNS_KEY_ID"),
+		teamID: os.Getenv("APNS_TEAM_ID"),
+		topic:  os.Getenv("APNS_TOPIC"),
+		host:   "https://api.push.apple.com",
+		key:    key,
+		// The default transport negotiates the HTTP/2 APNs requires.
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+	if s.keyID == "" || s.teamID == "" || s.topic == "" {
+		return nil, errors.New("APNs requires APNS_KEY_ID, APNS_TEAM_ID and APNS_TOPIC")
+	}
+	if os.Getenv("APNS_SANDBOX") == "true" {
+		s.host = "https://api.sandbox.push.apple.com"
+	}
+	return s, nil
+}
+
+func (a *apnsSender) token() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.jwt != "" && time.Since(a.issuedAt) < 50*time.Minute {
+		return a.jwt, nil
+	}
+	now := time.Now()
+	jwt, err := signJWT(
+		map[string]any{"alg": "ES256", "kid": a.keyID},
+		map[string]any{"iss": a.teamID, "iat": now.Unix()},
+		func(input []byte) ([]byte, error) {
+			sum := sha256.Sum256(input)
+			r, s, err := ecdsa.Sign(rand.Reader, a.key, sum[:])
+			if err != nil {
+				return nil, err
+			}
+			// JWS wants r and s as fixed-width big-endian halves.
+			sig := make([]byte, 64)
+			r.FillBytes(sig[:32])
+			s.FillBytes(sig[32:])
+			return sig, nil
+		})
+	if err != nil {
+		return "", err
+	}
+	a.jwt, a.issuedAt = jwt, now
+	return jwt, nil
+}
+
+func (a *apnsSender) push(ctx context.Context, token string, n pushNotification) (string, error) {
+	jwt, err := a.token()
+	if err != nil {
+		return "", err
+	}
+	payload := map[string]any{"aps": map[string]any{"alert": map[string]string{"title": n.Title, "body": n.Body}}}
+	for k, v := range n.Data {
+		payload[k] = v
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.host+"/3/device/"+url.PathEscape(token), bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "bearer "+jwt)
+	req.Header.Set("apns-topic", a.topic)
+	req.Header.Set("apns-push-type", "alert")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", transientError{err}
+	}
+	defer resp.Body.Close()
+	if err := classifyHTTP("apns", resp); err != nil {
+		return "", err
+	}
+	return resp.Header.Get("apns-id"), nil
+}
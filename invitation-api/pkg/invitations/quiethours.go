@@ -0,0 +1,63 @@
+package invitations
+
+import (
+	"net/http"
+	"slices"
+	"time"
+)
+
+// quietHoursEnd returns when the quiet hours around t end in loc, or t
+// itself if t falls outside them.
+func quietHoursEnd(t time.Time, loc *time.Location, start, end int) time.Time {
+	lt := t.In(loc)
+	tod := lt.Hour()*60 + lt.Minute()
+	at := func(days int) time.Time {
+		return time.Date(lt.Year(), lt.Month(), lt.Day()+days, end/60, end%60, 0, 0, loc)
+	}
+	if start < end {
+		if tod >= start && tod < end {
+			return at(0)
+		}
+		return t
+	}
+	// The window wraps past midnight, as 21:00-08:00 does.
+	switch {
+	case tod >= start:
+		return at(1)
+	case tod < end:
+		return at(0)
+	}
+	return t
+}
+
+// deferForQuietHours moves an SMS or voice invitation due to go out at start during
+// the configured quiet hours, in the invitee's timezone, to when they end.
+// It is then scheduled, with DeferredFrom keeping start. The deadline moves
+// by as much unless QuietHoursShiftExpiry is off, in which case an
+// invitation that would expire before it could be sent is an error.
+func (s *Server) deferForQuietHours(inv *Invitation, start time.Time) error {
+	qs, qe, ok := s.cfg.QuietWindow()
+	if !ok || !(slices.Contains(inv.Channels, channelSMS) || slices.Contains(inv.Channels, channelVoice)) {
+		return nil
+	}
+	loc := s.cfg.Location()
+	if inv.Timezone != "" {
+		if l, err := time.LoadLocation(inv.Timezone); err == nil {
+			loc = l
+		}
+	}
+	sendAt := quietHoursEnd(start, loc, qs, qe)
+	if !sendAt.After(start) {
+		return nil
+	}
+	if s.cfg.QuietHoursShiftExpiry {
+		inv.ExpiresAt = inv.ExpiresAt.Add(sendAt.Sub(start))
+		rescheduleReminders(inv, s.now())
+	} else if !sendAt.Before(inv.ExpiresAt) {
+		return &requestError{status: http.StatusUnprocessableEntity, code: codeQuietHours, msg: "invitation would expire during quiet hours, before it could be sent"}
+	}
+	inv.DeferredFrom = start.UTC()
+	inv.SendAt = sendAt.UTC()
+	inv.Status = statusScheduled
+	return nil
+}
@@ -0,0 +1,236 @@
+package invitations
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+)
+
+// Batch outcomes, once min_yes or max_yes is set. A batch goes from open
+// ("") to on and then possibly full, or to off; full and off are final.
+const (
+	outcomeOn   = "on"   // min_yes people accepted
+	outcomeFull = "full" // max_yes people accepted; the rest were closed
+	outcomeOff  = "off"  // too few invitations left open to reach min_yes
+)
+
+var errFull = errors.New("the event is full")
+
+func validateThresholds(minYes, maxYes int, waitlist bool) error {
+	if minYes < 0 || maxYes < 0 {
+		return badRequest("min_yes and max_yes must not be negative")
+	}
+	if maxYes > 0 && minYes > maxYes {
+		return badRequest("min_yes must not be more than max_yes")
+	}
+	if waitlist && maxYes == 0 {
+		return badRequest("waitlist needs max_yes")
+	}
+	return nil
+}
+
+func (b batch) hasThresholds() bool { return b.MinYes > 0 || b.MaxYes > 0 }
+
+// thresholdBatch returns the batch of inv when it has thresholds to check.
+func (s *Server) thresholdBatch(ctx context.Context, inv Invitation) (batch, bool, error) {
+	if inv.BatchID == "" {
+		return batch{}, false, nil
+	}
+	b, err := getRecord[batch](withTenant(ctx, inv.TenantID), s.store, batchKind, inv.BatchID)
+	if err == errNotFound {
+		return batch{}, false, nil
+	}
+	if err != nil {
+		return batch{}, false, err
+	}
+	return b, b.hasThresholds(), nil
+}
+
+// countOthers tallies the batch's invitations other than except.
+func (s *Server) countOthers(ctx context.Context, b batch, except string) (batchCounts, error) {
+	var c batchCounts
+	invs, err := s.store.List(ctx, ListFilter{BatchID: b.ID})
+	if err != nil {
+		return c, err
+	}
+	for _, inv := range invs {
+		if inv.ID != except {
+			c.add(inv.withStatus(s.now()))
+		}
+	}
+	return c, nil
+}
+
+func waitlistMessage(locale string, position int) string {
+	return localize(locale, "waitlisted", position)
+}
+
+// settleBatch moves the batch of inv to its next outcome, if the counts
+// call for one, and tells the invitees. It is called after anything that
+// changes the counts: a response, a cancellation or an expiry.
+func (s *Server) settleBatch(ctx context.Context, inv Invitation) {
+	ctx = withTenant(context.WithoutCancel(ctx), inv.TenantID)
+	unlock, err := s.locks.lock(ctx, batchLockKey(inv.BatchID))
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to lock batch", "batch_id", inv.BatchID, "err", err)
+		return
+	}
+	defer unlock()
+	b, ok, err := s.thresholdBatch(ctx, inv)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to load batch", "batch_id", inv.BatchID, "err", err)
+		return
+	}
+	if !ok || b.Outcome == outcomeOff || b.Outcome == outcomeFull && !b.Waitlist {
+		return
+	}
+	invs, err := s.store.List(ctx, ListFilter{BatchID: b.ID})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to list batch", "batch_id", b.ID, "err", err)
+		return
+	}
+	if b.Waitlist {
+		s.advanceWaitlist(ctx, b, invs)
+		if b.Outcome == outcomeFull {
+			return
+		}
+	}
+	var counts batchCounts
+	var accepted, open []Invitation
+	for _, inv := range invs {
+		inv = inv.withStatus(s.now())
+		counts.add(inv)
+		switch inv.Status {
+		case statusAccepted:
+			accepted = append(accepted, inv)
+		case statusPending, statusViewed, statusScheduled:
+			open = append(open, inv)
+		}
+	}
+
+	outcome := b.Outcome
+	switch {
+	case b.MaxYes > 0 && counts.Accepted >= b.MaxYes:
+		outcome = outcomeFull
+	case b.MinYes > 0 && counts.Accepted >= b.MinYes:
+		outcome = outcomeOn
+	case b.MinYes > 0 && b.Outcome == "" && counts.Accepted+len(open) < b.MinYes:
+		outcome = outcomeOff
+	}
+	if outcome == b.Outcome {
+		return
+	}
+	previous := b.Outcome
+	b.Outcome, b.OutcomeAt = outcome, s.now().UTC()
+	if err := putRecord(ctx, s.store, batchKind, b.ID, b); err != nil {
+		slog.ErrorContext(ctx, "failed to record batch outcome", "batch_id", b.ID, "err", err)
+		return
+	}
+	slog.InfoContext(ctx, "batch outcome", "batch_id", b.ID, "outcome", outcome, "accepted", counts.Accepted)
+
+	switch outcome {
+	case outcomeOn:
+		for _, inv := range append(accepted, open...) {
+			s.notifyInvitee(ctx, inv, localize(inv.Locale, "its_on", counts.Accepted))
+		}
+	case outcomeFull:
+		if previous == "" {
+			for _, inv := range accepted {
+				s.notifyInvitee(ctx, inv, localize(inv.Locale, "its_on", counts.Accepted))
+			}
+		}
+		for _, inv := range open {
+			if b.Waitlist {
+				s.notifyInvitee(ctx, inv, localize(inv.Locale, "now_full_waitlist"))
+			} else {
+				s.closeInvitation(ctx, inv, localize(inv.Locale, "now_full"))
+			}
+		}
+	case outcomeOff:
+		for _, inv := range accepted {
+			s.notifyInvitee(ctx, inv, localize(inv.Locale, "its_off"))
+		}
+		for _, inv := range open {
+			s.closeInvitation(ctx, inv, localize(inv.Locale, "its_off"))
+		}
+	}
+}
+
+// closeInvitation cancels an open invitation on the host's behalf and texts
+// the invitee why, unless it was never sent.
+func (s *Server) closeInvitation(ctx context.Context, inv Invitation, notice string) {
+	var from string
+	id := inv.ID
+	inv, err := s.store.Update(ctx, id, func(inv *Invitation) error {
+		from = inv.withStatus(s.now()).Status
+		if !isPending(from) && from != statusScheduled {
+			return errSkip
+		}
+		inv.Status = statusCancelled
+		inv.CancelledAt = s.now().UTC()
+		return nil
+	})
+	if err == errSkip {
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to close invitation", "invitation_id", id, "err", err)
+		return
+	}
+	s.record(ctx, inv, InvitationEvent{Type: historyCancelled, Actor: "system", From: from, To: statusCancelled, Message: notice})
+	if from != statusScheduled {
+		s.notifyInvitee(ctx, inv, notice)
+	}
+}
+
+// advanceWaitlist gives places freed below the batch's capacity to the
+// longest waiting, in order, and closes up the positions of the rest. invs
+// is updated in place.
+func (s *Server) advanceWaitlist(ctx context.Context, b batch, invs []Invitation) {
+	free := b.MaxYes
+	var waiting []int
+	for i, inv := range invs {
+		switch inv.withStatus(s.now()).Status {
+		case statusAccepted:
+			free--
+		case statusWaitlisted:
+			waiting = append(waiting, i)
+		default:
+			if inv.WaitlistPosition > 0 {
+				// Cancelled while waiting.
+				s.moveOnWaitlist(ctx, &invs[i], 0)
+			}
+		}
+	}
+	slices.SortFunc(waiting, func(i, j int) int { return invs[i].WaitlistPosition - invs[j].WaitlistPosition })
+	for n, i := range waiting {
+		if n < free {
+			if s.moveOnWaitlist(ctx, &invs[i], 0) {
+				slog.InfoContext(ctx, "promoted from waitlist", "invitation_id", invs[i].ID, "batch_id", b.ID)
+				s.record(ctx, invs[i], InvitationEvent{Type: historyPromoted, Actor: "system", From: statusWaitlisted, To: statusAccepted})
+				s.notifyInvitee(ctx, invs[i], localize(invs[i].Locale, "promoted"))
+			}
+			continue
+		}
+		s.moveOnWaitlist(ctx, &invs[i], n+1-max(free, 0))
+	}
+}
+
+// moveOnWaitlist sets the waitlist position of *inv, zero taking it off the
+// list, and reports whether it changed.
+func (s *Server) moveOnWaitlist(ctx context.Context, inv *Invitation, position int) bool {
+	if inv.WaitlistPosition == position {
+		return false
+	}
+	updated, err := s.store.Update(ctx, inv.ID, func(inv *Invitation) error {
+		inv.WaitlistPosition = position
+		return nil
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to update waitlist position", "invitation_id", inv.ID, "err", err)
+		return false
+	}
+	*inv = updated
+	return true
+}
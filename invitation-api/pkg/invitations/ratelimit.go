@@ -0,0 +1,134 @@
+package invitations
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a set of token buckets, one per key, each holding up to
+// limit tokens and refilling at limit per window. A zero limit disables it.
+type rateLimiter struct {
+	name   string
+	limit  int
+	window time.Duration
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// maxBuckets bounds memory. Once it is reached full buckets are dropped,
+// since they behave exactly like missing ones, and failing any, the one
+// idle longest.
+const maxBuckets = 10000
+
+func newRateLimiter(name string, limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{name: name, limit: limit, window: window, buckets: make(map[string]*bucket)}
+}
+
+// allow takes a token for key at t. When none is left it reports how long
+// until one is.
+func (l *rateLimiter) allow(key string, t time.Time) (bool, time.Duration) {
+	if l.limit <= 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, rate := l.refill(key, t)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	rateLimited.inc(l.name)
+	return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
+
+// reserve takes a token for key at t even when none is left, and returns
+// how long to wait before using it. Callers that wait are served in the
+// order they reserved.
+func (l *rateLimiter) reserve(key string, t time.Time) time.Duration {
+	if l.limit <= 0 {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, rate := l.refill(key, t)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	rateLimited.inc(l.name)
+	return time.Duration(-b.tokens / rate * float64(time.Second))
+}
+
+// refill returns key's bucket topped up to t, and the rate it refills at.
+// l.mu must be held.
+func (l *rateLimiter) refill(key string, t time.Time) (*bucket, float64) {
+	rate := float64(l.limit) / l.window.Seconds()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxBuckets {
+			l.prune(t, rate)
+		}
+		b = &bucket{tokens: float64(l.limit), last: t}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(l.limit), b.tokens+t.Sub(b.last).Seconds()*rate)
+	b.last = t
+	return b, rate
+}
+
+func (l *rateLimiter) prune(t time.Time, rate float64) {
+	oldest := ""
+	for k, b := range l.buckets {
+		if b.tokens+t.Sub(b.last).Seconds()*rate >= float64(l.limit) {
+			delete(l.buckets, k)
+		} else if oldest == "" || b.last.Before(l.buckets[oldest].last) {
+			oldest = k
+		}
+	}
+	if len(l.buckets) >= maxBuckets {
+		delete(l.buckets, oldest)
+	}
+}
+
+func writeRateLimited(w http.ResponseWriter, r *http.Request, retry time.Duration, msg string) {
+	secs := int(math.Ceil(retry.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	writeErrorBody(w, r, http.StatusTooManyRequests, errorBody{Code: codeRateLimited, Message: msg, Details: map[string]any{"retry_after_seconds": secs}})
+}
+
+// remoteHost is the address of the directly connected client.
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rateLimitCaller limits requests per API key, or per client address when
+// API keys are not required.
+func (s *Server) rateLimitCaller(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := ""
+		if k, ok := apiKeyFrom(r.Context()); ok {
+			key = "key:" + k.ID
+		} else {
+			key = "addr:" + remoteHost(r)
+		}
+		if ok, retry := s.callerLimit.allow(key, s.now()); !ok {
+			writeRateLimited(w, r, retry, "too many requests for this API key")
+			return
+		}
+		next(w, r)
+	}
+}
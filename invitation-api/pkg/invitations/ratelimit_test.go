@@ -0,0 +1,32 @@
+package invitations
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBounded(t *testing.T) {
+	l := newRateLimiter("test", 5, time.Minute)
+	for i := range maxBuckets {
+		l.allow(fmt.Sprintf("key-%d", i), testStart.Add(time.Duration(i)*time.Millisecond))
+	}
+	// None has refilled, so the one idle longest makes room.
+	at := testStart.Add(maxBuckets * time.Millisecond)
+	l.allow("new", at)
+	if n := len(l.buckets); n > maxBuckets {
+		t.Errorf("%d buckets, want at most %d", n, maxBuckets)
+	}
+	if _, ok := l.buckets["key-0"]; ok {
+		t.Error("the bucket idle longest was kept")
+	}
+	if _, ok := l.buckets["key-1"]; !ok {
+		t.Error("a bucket more recently used than the oldest was dropped")
+	}
+
+	// Once they have refilled, they all go.
+	l.allow("later", at.Add(time.Minute))
+	if n := len(l.buckets); n != 1 {
+		t.Errorf("%d buckets after the rest refilled, want just the new one", n)
+	}
+}
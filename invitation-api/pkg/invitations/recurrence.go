@@ -0,0 +1,155 @@
+package invitations
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// recurrence is the subset of an iCalendar RRULE (RFC 5545) that series
+// accept, e.g. "FREQ=WEEKLY;BYDAY=MO" or "FREQ=DAILY;INTERVAL=2;COUNT=10".
+// Occurrences keep the wall-clock time of the series start in its zone.
+type recurrence struct {
+	freq     string
+	interval int
+	byDay    []time.Weekday
+	count    int
+	until    time.Time
+}
+
+const (
+	freqDaily   = "DAILY"
+	freqWeekly  = "WEEKLY"
+	freqMonthly = "MONTHLY"
+)
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+func parseRecurrence(rule string) (recurrence, error) {
+	r := recurrence{interval: 1}
+	rule = strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:")
+	if rule == "" {
+		return r, badRequest("recurrence is required")
+	}
+	for _, part := range strings.Split(rule, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return r, badRequest("recurrence must be NAME=VALUE pairs separated by ';'")
+		}
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			r.freq = strings.ToUpper(value)
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return r, badRequest("recurrence INTERVAL must be a positive number")
+			}
+			r.interval = n
+		case "BYDAY":
+			for _, d := range strings.Split(value, ",") {
+				wd, ok := weekdays[strings.ToUpper(d)]
+				if !ok {
+					return r, badRequest("recurrence BYDAY must list days as MO, TU, WE, TH, FR, SA or SU")
+				}
+				r.byDay = append(r.byDay, wd)
+			}
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return r, badRequest("recurrence COUNT must be a positive number")
+			}
+			r.count = n
+		case "UNTIL":
+			t, err := time.Parse("20060102T150405Z", value)
+			if err != nil {
+				return r, badRequest("recurrence UNTIL must be a UTC time such as 20261231T235959Z")
+			}
+			r.until = t
+		default:
+			return r, badRequest("recurrence " + name + " is not supported")
+		}
+	}
+	switch r.freq {
+	case freqDaily, freqWeekly, freqMonthly:
+	case "":
+		return r, badRequest("recurrence FREQ is required")
+	default:
+		return r, badRequest("recurrence FREQ must be DAILY, WEEKLY or MONTHLY")
+	}
+	if len(r.byDay) > 0 && r.freq != freqWeekly {
+		return r, badRequest("recurrence BYDAY is only supported with FREQ=WEEKLY")
+	}
+	if r.count > 0 && !r.until.IsZero() {
+		return r, badRequest("recurrence COUNT and UNTIL are mutually exclusive")
+	}
+	return r, nil
+}
+
+// next returns the first occurrence of a series starting at start that is
+// strictly after after, or false once UNTIL has passed. COUNT is left to the
+// caller, which knows how many occurrences there have been.
+func (r recurrence) next(start, after time.Time, loc *time.Location) (time.Time, bool) {
+	start = start.In(loc)
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, start.Hour(), start.Minute(), start.Second(), 0, loc)
+	}
+	var t time.Time
+	if r.freq == freqMonthly {
+		// Months without the start's day of the month are skipped, as in
+		// RFC 5545, rather than moved to the end of the month.
+		months := 0
+		if a := after.In(loc); a.After(start) {
+			months = (a.Year()-start.Year())*12 + int(a.Month()-start.Month())
+			months -= months % r.interval
+		}
+		for ; ; months += r.interval {
+			t = at(start.Year(), start.Month()+time.Month(months), start.Day())
+			if t.Day() == start.Day() && t.After(after) && !t.Before(start) {
+				break
+			}
+		}
+	} else {
+		from := start
+		if a := after.In(loc); a.After(start) {
+			from = at(a.Year(), a.Month(), a.Day())
+		}
+		for d := 0; ; d++ {
+			t = at(from.Year(), from.Month(), from.Day()+d)
+			if t.After(after) && !t.Before(start) && r.onDay(start, t) {
+				break
+			}
+		}
+	}
+	if !r.until.IsZero() && t.After(r.until) {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// onDay reports whether day t is in the daily or weekly pattern of a series
+// starting at start. Weeks start on Monday.
+func (r recurrence) onDay(start, t time.Time) bool {
+	days := civilDay(t) - civilDay(start)
+	if r.freq == freqDaily {
+		return days%r.interval == 0
+	}
+	if len(r.byDay) == 0 {
+		if t.Weekday() != start.Weekday() {
+			return false
+		}
+	} else if !slices.Contains(r.byDay, t.Weekday()) {
+		return false
+	}
+	monday := civilDay(start) - (int(start.Weekday())+6)%7
+	return (civilDay(t)-monday)/7%r.interval == 0
+}
+
+// civilDay numbers the calendar day of t in its own zone.
+func civilDay(t time.Time) int {
+	y, m, d := t.Date()
+	return int(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / 86400)
+}
@@ -0,0 +1,330 @@
+package invitations
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redisClient speaks just enough RESP2 for the redis store: commands over a
+// small pool of connections, transactions on a connection of their own, and
+// subscriptions. Replies come back as string for simple strings, int64,
+// []byte for bulk strings, []any for arrays, redisError, or nil.
+type redisClient struct {
+	addr     string
+	user     string
+	password string
+	db       int
+	tls      *tls.Config
+	idle     chan *redisConn
+}
+
+const (
+	redisPoolSize    = 16
+	redisDialTimeout = 5 * time.Second
+)
+
+// redisError is an error reply. It leaves the connection usable.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+var errRedisNil = errors.New("redis: nil reply")
+
+// newRedisClient parses a redis:// or rediss:// URL of the form
+// redis://[user:password@]host[:port][/db].
+func newRedisClient(rawURL string) (*redisClient, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+	c := &redisClient{addr: u.Host, idle: make(chan *redisConn, redisPoolSize)}
+	switch u.Scheme {
+	case "redis":
+	case "rediss":
+		c.tls = &tls.Config{ServerName: u.Hostname()}
+	default:
+		return nil, fmt.Errorf("redis URL must start with redis:// or rediss://, not %q", u.Scheme+"://")
+	}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.user = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid redis database %q", db)
+		}
+	}
+	return c, nil
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+	// broken is set once a read or write fails, after which replies may be
+	// out of step with commands.
+	broken bool
+}
+
+func (c *redisClient) dial(ctx context.Context) (*redisConn, error) {
+	d := &net.Dialer{Timeout: redisDialTimeout}
+	var conn net.Conn
+	var err error
+	if c.tls != nil {
+		conn, err = (&tls.Dialer{NetDialer: d, Config: c.tls}).DialContext(ctx, "tcp", c.addr)
+	} else {
+		conn, err = d.DialContext(ctx, "tcp", c.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rc := &redisConn{Conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+	if c.password != "" {
+		args := []any{"AUTH", c.password}
+		if c.user != "" {
+			args = []any{"AUTH", c.user, c.password}
+		}
+		if _, err := rc.do(ctx, args...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if c.db != 0 {
+		if _, err := rc.do(ctx, "SELECT", c.db); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return rc, nil
+}
+
+func (c *redisClient) get(ctx context.Context) (*redisConn, error) {
+	select {
+	case rc := <-c.idle:
+		return rc, nil
+	default:
+		return c.dial(ctx)
+	}
+}
+
+func (c *redisClient) put(rc *redisConn) {
+	if rc.broken {
+		rc.Close()
+		return
+	}
+	select {
+	case c.idle <- rc:
+	default:
+		rc.Close()
+	}
+}
+
+// do runs one command on a pooled connection.
+func (c *redisClient) do(ctx context.Context, args ...any) (any, error) {
+	rc, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := rc.do(ctx, args...)
+	c.put(rc)
+	return reply, err
+}
+
+// withConn runs fn on a connection of its own, for WATCH and MULTI.
+func (c *redisClient) withConn(ctx context.Context, fn func(*redisConn) error) error {
+	rc, err := c.get(ctx)
+	if err != nil {
+		return err
+	}
+	if err = fn(rc); err != nil && !rc.broken {
+		// fn may have given up with keys still watched.
+		rc.do(ctx, "UNWATCH")
+	}
+	c.put(rc)
+	return err
+}
+
+// subscribe calls fn with each message published to channel until ctx is
+// done or the connection fails.
+func (c *redisClient) subscribe(ctx context.Context, channel string, fn func([]byte)) error {
+	rc, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	stop := context.AfterFunc(ctx, func() { rc.Close() })
+	defer stop()
+	if err := rc.send("SUBSCRIBE", channel); err != nil {
+		return err
+	}
+	for {
+		reply, err := rc.read()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return err
+		}
+		msg, ok := reply.([]any)
+		if !ok || len(msg) != 3 {
+			continue
+		}
+		if kind, _ := msg[0].([]byte); string(kind) == "message" {
+			payload, _ := msg[2].([]byte)
+			fn(payload)
+		}
+	}
+}
+
+func (c *redisClient) Close() error {
+	for {
+		select {
+		case rc := <-c.idle:
+			rc.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (rc *redisConn) do(ctx context.Context, args ...any) (any, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		rc.SetDeadline(deadline)
+	} else {
+		rc.SetDeadline(time.Time{})
+	}
+	if err := rc.send(args...); err != nil {
+		rc.broken = true
+		return nil, err
+	}
+	reply, err := rc.read()
+	if err != nil {
+		rc.broken = true
+		return nil, err
+	}
+	if re, ok := reply.(redisError); ok {
+		return nil, re
+	}
+	return reply, nil
+}
+
+func (rc *redisConn) send(args ...any) error {
+	fmt.Fprintf(rc.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		var s string
+		switch v := arg.(type) {
+		case string:
+			s = v
+		case []byte:
+			s = string(v)
+		case int:
+			s = strconv.Itoa(v)
+		case int64:
+			s = strconv.FormatInt(v, 10)
+		default:
+			s = fmt.Sprint(v)
+		}
+		fmt.Fprintf(rc.w, "$%d\r\n%s\r\n", len(s), s)
+	}
+	return rc.w.Flush()
+}
+
+func (rc *redisConn) read() (any, error) {
+	line, err := rc.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return redisError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rc.r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = rc.read(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+// redisBytes and the helpers below convert replies, turning a nil reply
+// into errRedisNil.
+func redisBytes(reply any, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	switch v := reply.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	case nil:
+		return nil, errRedisNil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %T", reply)
+}
+
+func redisInt(reply any, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	if n, ok := reply.(int64); ok {
+		return n, nil
+	}
+	return 0, fmt.Errorf("redis: unexpected reply %T", reply)
+}
+
+func redisStrings(reply any, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	items, ok := reply.([]any)
+	if !ok {
+		if reply == nil {
+			return nil, errRedisNil
+		}
+		return nil, fmt.Errorf("redis: unexpected reply %T", reply)
+	}
+	result := make([]string, len(items))
+	for i, item := range items {
+		b, _ := item.([]byte)
+		result[i] = string(b)
+	}
+	return result, nil
+}
@@ -0,0 +1,192 @@
+package invitations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const maxReminders = 5
+
+// Reminder is texted BeforeMin minutes before the deadline, at At, and
+// SentAt is when it went.
+type Reminder struct {
+	BeforeMin int       `json:"before_min"`
+	At        time.Time `json:"at"`
+	SentAt    time.Time `json:"sent_at,omitempty"`
+}
+
+// MinuteList accepts either a single number or an array of numbers.
+type MinuteList []int
+
+func (m *MinuteList) UnmarshalJSON(b []byte) error {
+	var one int
+	if err := json.Unmarshal(b, &one); err == nil {
+		*m = MinuteList{one}
+		return nil
+	}
+	var many []int
+	if err := json.Unmarshal(b, &many); err != nil {
+		return errors.New("remind_before_min must be a number or an array of numbers")
+	}
+	*m = many
+	return nil
+}
+
+// buildReminders validates the requested lead times against the invitation
+// duration and returns them soonest first.
+func buildReminders(before MinuteList, durationMin int, expiresAt time.Time) ([]Reminder, error) {
+	if len(before) > maxReminders {
+		return nil, errors.New("at most " + strconv.Itoa(maxReminders) + " reminders are allowed")
+	}
+	seen := map[int]bool{}
+	var result []Reminder
+	for _, m := range before {
+		if m <= 0 || m >= durationMin {
+			return nil, errors.New("remind_before_min values must be between 1 and duration_min-1")
+		}
+		if seen[m] {
+			continue
+		}
+		seen[m] = true
+		result = append(result, Reminder{BeforeMin: m, At: expiresAt.Add(-time.Duration(m) * time.Minute).UTC()})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].At.Before(result[j].At) })
+	return result, nil
+}
+
+func reminderMessage(locale string, m int) string {
+	return countText(locale, "reminder", m)
+}
+
+// runScheduler sends time-based messages that are stored on invitations, so
+// pending work survives restarts with the sqlite or postgres store.
+func (s *Server) runScheduler(ctx context.Context, interval time.Duration) {
+	ticks, stop := s.clock.NewTicker(interval)
+	defer stop()
+	for {
+		pass, span := tracer.Start(withJobID(ctx, "remind"), "scheduler.pass")
+		t := s.now()
+		err := errors.Join(s.sendScheduled(pass, t), s.sendDueReminders(pass, t), s.sendDueNudges(pass, t), s.sendDueFallbacks(pass, t), s.sendDueDigests(pass, t), s.sendTestResponses(pass, t))
+		endSpan(span, err)
+		if err != nil {
+			slog.ErrorContext(pass, "reminder pass failed", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticks:
+		}
+	}
+}
+
+// sendScheduled sends invitations whose send_at has come. The deadline and
+// reminders move by however late the send is, so the invitee always gets
+// the full duration.
+func (s *Server) sendScheduled(ctx context.Context, t time.Time) error {
+	candidates, err := s.store.List(ctx, ListFilter{Status: statusScheduled, AsOf: t})
+	if err != nil {
+		return err
+	}
+	for _, c := range candidates {
+		if c.SendAt.After(t) {
+			continue
+		}
+		// The next occurrence is created first: if this pass dies before
+		// the send it is simply created again, under the same ID, next time.
+		if c.SeriesID != "" {
+			if err := s.scheduleNextOccurrence(ctx, c); err != nil {
+				slog.ErrorContext(ctx, "failed to schedule next occurrence", "invitation_id", c.ID, "series_id", c.SeriesID, "err", err)
+				continue
+			}
+		}
+		inv, err := s.store.Update(ctx, c.ID, func(inv *Invitation) error {
+			if inv.Status != statusScheduled || inv.SendAt.After(t) {
+				return errSkip
+			}
+			inv.Status = ""
+			inv.ExpiresAt = inv.ExpiresAt.Add(t.Sub(inv.SendAt))
+			rescheduleReminders(inv, t)
+			return s.renderMessage(inv)
+		})
+		if err == errSkip {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		slog.InfoContext(ctx, "scheduled invitation sent", "invitation_id", inv.ID, "phone", maskPhone(inv.PhoneNumber))
+		s.record(ctx, inv, InvitationEvent{Type: historySent, From: statusScheduled, To: statusPending})
+		s.sendInvitation(ctx, &inv)
+	}
+	return nil
+}
+
+func (s *Server) sendDueReminders(ctx context.Context, t time.Time) error {
+	candidates, err := s.store.List(ctx, ListFilter{Status: statusPending, AsOf: t, ExpiresAfter: t})
+	if err != nil {
+		return err
+	}
+	for _, c := range candidates {
+		if !hasDueReminder(c, t) {
+			continue
+		}
+		var due []int
+		inv, err := s.store.Update(ctx, c.ID, func(inv *Invitation) error {
+			due = nil
+			if !isPending(inv.withStatus(t).Status) {
+				return errSkip
+			}
+			for i := range inv.Reminders {
+				rm := &inv.Reminders[i]
+				if rm.SentAt.IsZero() && !rm.At.After(t) {
+					rm.SentAt = t.UTC()
+					due = append(due, rm.BeforeMin)
+				}
+			}
+			if len(due) == 0 {
+				return errSkip
+			}
+			return nil
+		})
+		if err == errSkip {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		// Only the tightest deadline is worth texting if several came due
+		// at once, e.g. after downtime.
+		m := due[len(due)-1]
+		s.notifyInvitee(ctx, inv, reminderMessage(inv.Locale, m))
+		s.appendEvent(ctx, inv.ID, InvitationEvent{Type: "reminded"})
+	}
+	return nil
+}
+
+func hasDueReminder(inv Invitation, t time.Time) bool {
+	for _, rm := range inv.Reminders {
+		if rm.SentAt.IsZero() && !rm.At.After(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) handleListReminders(w http.ResponseWriter, r *http.Request) {
+	inv, err := s.store.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	reminders := inv.Reminders
+	if reminders == nil {
+		reminders = []Reminder{}
+	}
+	writeJSON(w, http.StatusOK, reminders)
+}
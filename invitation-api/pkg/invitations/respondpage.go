@@ -0,0 +1,386 @@
+package invitations
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const responseTokenKind = "response_token"
+
+// responseTokenRecord maps a response token to its invitation, so the short
+// link doesn't have to carry the invitation ID.
+type responseTokenRecord struct {
+	InvitationID string `json:"invitation_id"`
+}
+
+// responseToken is the token to send in inv's response links: signed
+// with the first of link_signing_keys when there are any, and otherwise
+// the stored random one.
+func (s *Server) responseToken(inv Invitation) string {
+	if len(s.cfg.LinkSigningKeys) == 0 || inv.ResponseToken == "" {
+		return inv.ResponseToken
+	}
+	kid, secret, _ := strings.Cut(strings.TrimSpace(s.cfg.LinkSigningKeys[0]), ":")
+	payload := kid + "." + strconv.FormatInt(inv.ExpiresAt.Unix(), 36)
+	return payload + "." + linkSignature(secret, payload, inv.ID) + "." + inv.ID
+}
+
+// linkSignature is the truncated HMAC-SHA256 a signed token carries: 128
+// bits, enough for a link that dies by its deadline.
+func linkSignature(secret, payload, id string) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(payload + "." + id))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil)[:16])
+}
+
+// verifySignedToken checks a token "<key id>.<deadline>.<signature>.<id>"
+// made by responseToken and returns the invitation ID it is for, without
+// touching the store, so forgeries are turned away unlooked-up. The
+// deadline is the one the link was sent with; the invitation's own, which
+// a PATCH may have moved since, is what decides whether it still works,
+// until cfg.LinkGrace past the link's, when it fails with errExpired
+// unlooked-up too. Random tokens have no dots.
+func (s *Server) verifySignedToken(token string) (string, error) {
+	parts := strings.SplitN(token, ".", 4)
+	if len(parts) != 4 {
+		return "", errBadToken
+	}
+	for _, k := range s.cfg.LinkSigningKeys {
+		kid, secret, _ := strings.Cut(strings.TrimSpace(k), ":")
+		if kid != parts[0] {
+			continue
+		}
+		payload := parts[0] + "." + parts[1]
+		if !hmac.Equal([]byte(parts[2]), []byte(linkSignature(secret, payload, parts[3]))) {
+			return "", errBadToken
+		}
+		deadline, err := strconv.ParseInt(parts[1], 36, 64)
+		if err != nil {
+			return "", errBadToken
+		}
+		if s.now().After(time.Unix(deadline, 0).Add(s.cfg.LinkGrace)) {
+			return "", errExpired
+		}
+		return parts[3], nil
+	}
+	// Signed with a key since retired.
+	return "", errBadToken
+}
+
+// expiredLink fails with errExpired for a signed token past its deadline and
+// cfg.LinkGrace, so that callers can refuse it before loading the invitation.
+func (s *Server) expiredLink(token string) error {
+	if !strings.Contains(token, ".") {
+		return nil
+	}
+	if _, err := s.verifySignedToken(token); err == errExpired {
+		return err
+	}
+	return nil
+}
+
+// checkResponseToken checks that token proves the caller holds inv's
+// response link, failing with errExpired for a signed link to an invitation
+// past its deadline and errBadToken otherwise. Invitations made before tokens
+// existed have none and can only be answered by SMS or by an admin.
+func (s *Server) checkResponseToken(inv Invitation, token string) error {
+	if strings.Contains(token, ".") {
+		id, err := s.verifySignedToken(token)
+		if err == nil && (id != inv.ID || inv.ResponseToken == "") {
+			err = errBadToken
+		}
+		if err == nil && s.now().After(inv.ExpiresAt) {
+			err = errExpired
+		}
+		return err
+	}
+	if inv.ResponseToken == "" || subtle.ConstantTimeCompare([]byte(inv.ResponseToken), []byte(token)) != 1 {
+		return errBadToken
+	}
+	return nil
+}
+
+// invitationForToken loads the invitation of a response link's token,
+// which reads as not found unless it is valid. Signed tokens to an
+// invitation past its deadline fail with errExpired.
+func (s *Server) invitationForToken(ctx context.Context, token string) (Invitation, error) {
+	if strings.Contains(token, ".") {
+		id, err := s.verifySignedToken(token)
+		if err == errBadToken {
+			return Invitation{}, errNotFound
+		}
+		if err != nil {
+			return Invitation{}, err
+		}
+		inv, err := s.store.Get(ctx, id)
+		if err == nil && inv.ResponseToken == "" {
+			err = errNotFound
+		}
+		if err == nil && s.now().After(inv.ExpiresAt) {
+			err = errExpired
+		}
+		return inv, err
+	}
+	rec, err := getRecord[responseTokenRecord](ctx, s.store, responseTokenKind, token)
+	if err != nil {
+		return Invitation{}, err
+	}
+	inv, err := s.store.Get(ctx, rec.InvitationID)
+	if err != nil {
+		return Invitation{}, err
+	}
+	if s.checkResponseToken(inv, token) != nil {
+		return Invitation{}, errNotFound
+	}
+	return inv, nil
+}
+
+var respondPage = template.Must(template.New("respond").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 32rem; margin: 2rem auto; padding: 0 1rem; }
+button { font-size: 1.1rem; padding: .6rem 1.2rem; margin: .25rem .25rem .25rem 0; }
+textarea { width: 100%; box-sizing: border-box; }
+.notice { padding: .75rem; background: #f3f3f3; border-radius: .25rem; }
+</style>
+</head>
+<body>
+<p>{{.Message}}</p>
+{{if .Notice}}<p class="notice">{{.Notice}}</p>{{end}}
+{{if .Confirming}}<form method="post">
+<p><label for="code">{{.CodeLabel}}</label><br>
+<input type="text" id="code" name="code" inputmode="numeric" autocomplete="one-time-code" maxlength="6" required></p>
+<button type="submit">{{.ConfirmButton}}</button>
+</form>
+{{end}}{{if .Open}}
+<p>{{.RespondBy}}</p>
+<form method="post">
+<p><label for="note">{{.NoteLabel}}</label><br>
+<textarea id="note" name="note" rows="3" maxlength="500"></textarea></p>
+{{if .MaxGuests}}<p><label for="guests">{{.GuestsLabel}}</label><br>
+<input type="number" id="guests" name="guests" min="0" max="{{.MaxGuests}}" value="0"></p>
+{{end}}{{range .Questions}}<p><label for="answer_{{.ID}}">{{.Text}}</label><br>
+<select id="answer_{{.ID}}" name="answer_{{.ID}}"><option value=""></option>{{$a := index $.Answers .ID}}{{range .Options}}<option{{if eq . $a}} selected{{end}}>{{.}}</option>{{end}}</select></p>
+{{end}}{{range .Options}}<button type="submit" name="response" value="{{.Value}}">{{.Label}}</button>
+{{end}}
+</form>
+{{if .Forwardable}}<form method="post">
+<p><label for="forward_to">{{.ForwardLabel}}</label><br>
+<input type="tel" id="forward_to" name="forward_to" required></p>
+<button type="submit">{{.ForwardButton}}</button>
+</form>
+{{end}}{{end}}
+</body>
+</html>
+`))
+
+// respondPageData is the page in the invitation's language.
+type respondPageData struct {
+	Lang      string
+	Title     string
+	Message   string
+	RespondBy string
+	Options   []respondOption
+	Open      bool
+	Notice    string
+	MaxGuests int
+	Questions []Question
+	Answers   map[string]string
+	// Forwardable offers passing the invitation on instead of answering.
+	Forwardable bool
+	// Confirming asks for the code of a held response.
+	Confirming bool
+
+	NoteLabel, GuestsLabel      string
+	ForwardLabel, ForwardButton string
+	CodeLabel, ConfirmButton    string
+}
+
+type respondOption struct{ Value, Label string }
+
+// handleRespondPage serves the page behind an invitation's short response
+// link. The same URL accepts the form post; the outcome is shown in place.
+func (s *Server) handleRespondPage(w http.ResponseWriter, r *http.Request) {
+	inv, err := s.invitationForToken(r.Context(), r.PathValue("token"))
+	if err == errNotFound {
+		http.Error(w, "This invitation link is not valid.", http.StatusNotFound)
+		return
+	}
+	if err == errExpired {
+		http.Error(w, "This invitation has expired.", http.StatusGone)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to load invitation for response page", "err", err)
+		http.Error(w, "Something went wrong. Please try again later.", http.StatusInternalServerError)
+		return
+	}
+	status := http.StatusOK
+	var notice string
+	locale := inv.Locale
+	if r.Method == http.MethodGet && inv.ViewedAt.IsZero() && !isLinkPreview(r) {
+		inv = s.markViewed(r.Context(), inv)
+	}
+	if r.Method == http.MethodPost {
+		id := inv.ID
+		note, err := validateNote(r.PostFormValue("note"))
+		if code := r.PostFormValue("code"); code != "" {
+			inv, err = s.confirmResponse(r.Context(), id, "", code, viaWeb)
+		} else if to := r.PostFormValue("forward_to"); to != "" {
+			var child Invitation
+			if inv, child, err = s.forwardInvitation(r.Context(), id, forwardInput{PhoneNumber: to, Via: viaWeb}); err == nil {
+				notice = localize(locale, "forward_sent", inviteeName(child))
+			}
+		} else if err == nil {
+			resp := r.PostFormValue("response")
+			guests, _ := strconv.Atoi(r.PostFormValue("guests"))
+			if !strings.EqualFold(resp, "yes") {
+				guests = 0
+			}
+			answers := map[string]string{}
+			for _, q := range inv.Questions {
+				if a := r.PostFormValue(answerFieldPrefix + q.ID); a != "" {
+					answers[q.ID] = a
+				}
+			}
+			inv, err = s.recordResponse(r.Context(), id, responseInput{Response: resp, Note: note, GuestCount: guests, Answers: answers, Via: viaWeb})
+		}
+		if err != nil {
+			status, notice = respondPageError(locale, err)
+			if status == http.StatusInternalServerError {
+				slog.ErrorContext(r.Context(), "failed to record response from response page", "invitation_id", id, "err", err)
+			}
+			if inv, err = s.store.Get(r.Context(), id); err != nil {
+				http.Error(w, localize(locale, "page_went_wrong"), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	inv = inv.withStatus(s.now())
+	base, _ := localeLanguage(locale).Base()
+	data := respondPageData{
+		Lang:        base.String(),
+		Title:       localize(locale, "page_title"),
+		Message:     inv.Message,
+		RespondBy:   localize(locale, "page_respond_by", s.formatDeadline(inv, inv.ExpiresAt)),
+		Notice:      notice,
+		MaxGuests:   inv.MaxGuests,
+		Questions:   inv.Questions,
+		Answers:     inv.Answers,
+		NoteLabel:   localize(locale, "page_note"),
+		GuestsLabel: localize(locale, "page_guests", inv.MaxGuests),
+
+		ForwardLabel:  localize(locale, "page_forward"),
+		ForwardButton: localize(locale, "page_forward_button"),
+		CodeLabel:     localize(locale, "page_confirm"),
+		ConfirmButton: localize(locale, "page_confirm_button"),
+	}
+	for _, o := range inv.options() {
+		data.Options = append(data.Options, respondOption{o, responseLabel(locale, o)})
+	}
+	switch inv.Status {
+	case statusCancelled:
+		data.Notice = localize(locale, "withdrawn")
+	case statusExpired:
+		data.Notice = localize(locale, "page_expired")
+	case statusScheduled:
+		data.Notice = localize(locale, "page_not_sent")
+	case statusDelegated:
+		if notice == "" {
+			data.Notice = localize(locale, "forwarded")
+		}
+	case statusPending, statusViewed:
+		data.Open = true
+	default:
+		if notice == "" && inv.WaitlistPosition > 0 {
+			data.Notice = waitlistMessage(locale, inv.WaitlistPosition)
+		} else if notice == "" {
+			data.Notice = localize(locale, "page_recorded_as", responseLabel(locale, inv.Response))
+		}
+		data.Open = s.responseChangeable(inv, s.now())
+	}
+	data.Forwardable = data.Open && inv.ForwardDepth < s.cfg.MaxForwardDepth
+	data.Confirming = data.Open && inv.PendingResponse != nil && !s.now().After(inv.PendingResponse.ExpiresAt)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := respondPage.Execute(w, data); err != nil {
+		slog.ErrorContext(r.Context(), "failed to render response page", "err", err)
+	}
+}
+
+// linkPreviewAgents are found in the user agents of the bots that fetch a
+// page to preview a link shared in a chat, which isn't the invitee opening
+// it.
+var linkPreviewAgents = []string{"bot", "facebookexternalhit", "preview", "whatsapp", "slack", "discord", "skype"}
+
+func isLinkPreview(r *http.Request) bool {
+	ua := strings.ToLower(r.UserAgent())
+	for _, a := range linkPreviewAgents {
+		if strings.Contains(ua, a) {
+			return true
+		}
+	}
+	return false
+}
+
+// markViewed records the first opening of a pending invitation's response
+// page, which makes it viewed, and returns inv as it now stands.
+func (s *Server) markViewed(ctx context.Context, inv Invitation) Invitation {
+	t := s.now()
+	viewed, err := s.store.Update(ctx, inv.ID, func(cur *Invitation) error {
+		if !cur.ViewedAt.IsZero() || cur.withStatus(t).Status != statusPending {
+			return errSkip
+		}
+		cur.ViewedAt = t.UTC()
+		return nil
+	})
+	if err != nil {
+		if err != errSkip {
+			slog.ErrorContext(ctx, "failed to record response page view", "invitation_id", inv.ID, "err", err)
+		}
+		return inv
+	}
+	s.record(ctx, viewed, InvitationEvent{Type: historyViewed, Actor: "invitee", From: statusPending, To: statusViewed, Via: viaWeb})
+	return viewed
+}
+
+// respondPageError is the status and notice for err, in the language of
+// locale. Validation messages are only in English.
+func respondPageError(locale string, err error) (int, string) {
+	var re *requestError
+	switch {
+	case errors.As(err, &re):
+		return re.status, strings.ToUpper(re.msg[:1]) + re.msg[1:] + "."
+	case err == errExpired:
+		return http.StatusGone, localize(locale, "page_expired")
+	case err == errCancelled:
+		return http.StatusGone, localize(locale, "withdrawn")
+	case err == errLocked:
+		return http.StatusConflict, localize(locale, "page_already_recorded")
+	case err == errFull:
+		return http.StatusConflict, localize(locale, "already_full")
+	case err == errForwarded:
+		return http.StatusConflict, localize(locale, "forwarded")
+	case err == errWrongCode:
+		return http.StatusUnprocessableEntity, localize(locale, "page_wrong_code")
+	case err == errNoPendingResponse:
+		return http.StatusConflict, localize(locale, "page_code_lapsed")
+	}
+	return http.StatusInternalServerError, localize(locale, "page_went_wrong")
+}
@@ -0,0 +1,82 @@
+package invitations
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignedLinkFollowsExtendedDeadline(t *testing.T) {
+	ts := newTestServer(t, "-link-signing-keys=k1:first-secret-0123456789abcdefghijk")
+	inv := ts.create(invite("+14155550101"))
+	token := ts.responseToken(inv)
+	if !strings.HasPrefix(token, "k1.") {
+		t.Fatalf("token %q isn't signed with k1", token)
+	}
+
+	w := ts.do("PATCH", "/invitations/"+inv.ID, map[string]any{"extend_min": 60, "notify": false})
+	if w.Code != http.StatusOK {
+		t.Fatalf("extend: got %d: %s", w.Code, w.Body)
+	}
+	// Past the deadline the link was sent with, before the new one.
+	ts.clock.Advance(90 * time.Minute)
+	if w := ts.do("GET", "/r/"+token, nil); w.Code != http.StatusOK {
+		t.Errorf("page after the original deadline: got %d, want 200: %s", w.Code, w.Body)
+	}
+	w = ts.do("POST", "/invitations/"+inv.ID+"/respond", map[string]any{"token": token, "response": "yes"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("respond after the original deadline: got %d, want 200: %s", w.Code, w.Body)
+	}
+
+	ts.clock.Advance(time.Hour)
+	if w := ts.do("GET", "/r/"+token, nil); w.Code != http.StatusGone {
+		t.Errorf("page after the extended deadline: got %d, want 410", w.Code)
+	}
+}
+
+func TestExpiredSignedLinkNotLookedUp(t *testing.T) {
+	ts := newTestServer(t, "-link-signing-keys=k1:first-secret-0123456789abcdefghijk")
+	inv := ts.create(invite("+14155550101"))
+	token := ts.responseToken(inv)
+
+	// Gone from the store, so a lookup would read as not found.
+	if err := ts.store.Delete(context.Background(), inv.ID); err != nil {
+		t.Fatal(err)
+	}
+	ts.clock.Advance(time.Hour + ts.cfg.LinkGrace + time.Second)
+	if w := ts.do("GET", "/r/"+token, nil); w.Code != http.StatusGone {
+		t.Errorf("page past the link's deadline and grace: got %d, want 410", w.Code)
+	}
+	w := ts.do("POST", "/invitations/"+inv.ID+"/respond", map[string]any{"token": token, "response": "yes"})
+	if w.Code != http.StatusGone {
+		t.Errorf("respond past the link's deadline and grace: got %d, want 410: %s", w.Code, w.Body)
+	}
+}
+
+func TestSignedLinkRejectsForgeries(t *testing.T) {
+	ts := newTestServer(t, "-link-signing-keys=k2:second-secret-0123456789abcdefghij,k1:first-secret-0123456789abcdefghijk")
+	inv := ts.create(invite("+14155550101"))
+	token := ts.responseToken(inv)
+	if !strings.HasPrefix(token, "k2.") {
+		t.Fatalf("token %q isn't signed with the first key", token)
+	}
+
+	parts := strings.Split(token, ".")
+	for name, forged := range map[string]string{
+		"other invitation": strings.Join(append(parts[:3:3], "someone-else"), "."),
+		"later deadline":   strings.Join([]string{parts[0], "zzzzzz", parts[2], parts[3]}, "."),
+		"retired key":      strings.Join(append([]string{"k0"}, parts[1:]...), "."),
+	} {
+		if w := ts.do("GET", "/r/"+forged, nil); w.Code != http.StatusNotFound {
+			t.Errorf("%s: got %d, want 404", name, w.Code)
+		}
+	}
+
+	// Links signed with a key that is still listed keep working.
+	old := newTestServer(t, "-link-signing-keys=k1:first-secret-0123456789abcdefghijk")
+	if got := old.responseToken(inv); ts.checkResponseToken(inv, got) != nil {
+		t.Errorf("a link signed with k1 was refused after rotating to k2")
+	}
+}
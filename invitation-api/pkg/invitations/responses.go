@@ -0,0 +1,121 @@
+package invitations
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	maxResponseOptions = 10
+	maxOptionLen       = 50
+	maxNoteLen         = 500
+)
+
+var defaultResponseOptions = []string{"yes", "no"}
+
+// options returns the answers inv accepts.
+func (inv Invitation) options() []string {
+	if len(inv.ResponseOptions) == 0 {
+		return defaultResponseOptions
+	}
+	return inv.ResponseOptions
+}
+
+// validateOptions checks the response_options of a create request. Numeric
+// options are refused because invitees may answer with an option's number.
+func validateOptions(opts []string) ([]string, error) {
+	if len(opts) == 0 {
+		return nil, nil
+	}
+	if len(opts) < 2 || len(opts) > maxResponseOptions {
+		return nil, badRequest("response_options must have between 2 and " + strconv.Itoa(maxResponseOptions) + " entries")
+	}
+	seen := map[string]bool{}
+	result := make([]string, 0, len(opts))
+	for _, o := range opts {
+		o = strings.TrimSpace(o)
+		if o == "" || len(o) > maxOptionLen {
+			return nil, badRequest("response_options entries must be between 1 and " + strconv.Itoa(maxOptionLen) + " bytes")
+		}
+		if _, err := strconv.Atoi(o); err == nil {
+			return nil, badRequest("response_options entries must not be numbers")
+		}
+		if seen[strings.ToLower(o)] {
+			return nil, badRequest("response_options entries must be unique")
+		}
+		seen[strings.ToLower(o)] = true
+		result = append(result, o)
+	}
+	return result, nil
+}
+
+// matchResponse resolves an answer to one of opts, case-insensitively or by
+// its 1-based number. With the default options "y" and "n" also count.
+func matchResponse(opts []string, answer string) (string, bool) {
+	a := strings.ToLower(strings.Trim(strings.TrimSpace(answer), ".!"))
+	if a == "" {
+		return "", false
+	}
+	for _, o := range opts {
+		if strings.ToLower(o) == a {
+			return o, true
+		}
+	}
+	if n, err := strconv.Atoi(a); err == nil && n >= 1 && n <= len(opts) {
+		return opts[n-1], true
+	}
+	if len(opts) == 2 && opts[0] == "yes" && opts[1] == "no" {
+		switch a {
+		case "y":
+			return "yes", true
+		case "n":
+			return "no", true
+		}
+	}
+	return "", false
+}
+
+func invalidResponse(opts []string) error {
+	return badRequest("response must be one of: " + strings.Join(opts, ", "))
+}
+
+func validateNote(note string) (string, error) {
+	note = strings.TrimSpace(note)
+	if len(note) > maxNoteLen {
+		return "", badRequest("note must be at most " + strconv.Itoa(maxNoteLen) + " bytes")
+	}
+	return note, nil
+}
+
+// inviteText is the invitation as sent to the invitee: the message, how to
+// reply, the deadline and the response link, leaving out whatever the
+// message template already placed.
+func (s *Server) inviteText(inv Invitation) string {
+	return inv.Message + s.inviteTail(inv, s.responseLink(inv))
+}
+
+// inviteTail is what inviteText adds to the message, with link as the
+// response link.
+func (s *Server) inviteTail(inv Invitation, link string) string {
+	text := replyHint(inv.Locale, inv.ResponseOptions) + questionsHint(inv.Locale, inv.Questions)
+	if !strings.Contains(inv.Template, ".Deadline") {
+		text += localize(inv.Locale, "open_until", s.formatDeadline(inv, inv.ExpiresAt))
+	}
+	if link != "" && !strings.Contains(inv.Template, ".ResponseLink") {
+		text += localize(inv.Locale, "respond_link", link)
+	}
+	return text
+}
+
+// replyHint tells SMS invitees how to answer when the options aren't the
+// familiar yes/no.
+func replyHint(locale string, opts []string) string {
+	if len(opts) == 0 {
+		return ""
+	}
+	parts := make([]string, len(opts))
+	for i, o := range opts {
+		parts[i] = strconv.Itoa(i+1) + ") " + o
+	}
+	return localize(locale, "reply_with", strings.Join(parts, " "))
+}
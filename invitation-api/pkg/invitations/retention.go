@@ -0,0 +1,238 @@
+package invitations
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	retentionPurge     = "purge"
+	retentionAnonymize = "anonymize"
+)
+
+// retentionPolicy says how long invitations are kept after they expire.
+// Days of 0 keeps them forever.
+type retentionPolicy struct {
+	Days int    `json:"days"`
+	Mode string `json:"mode,omitempty"` // purge or anonymize; the server's mode when empty
+}
+
+func (p retentionPolicy) validate() error {
+	if p.Days < 0 {
+		return badRequest("retention.days must not be negative")
+	}
+	switch p.Mode {
+	case "", retentionPurge, retentionAnonymize:
+		return nil
+	}
+	return badRequest("retention.mode must be purge or anonymize")
+}
+
+type retentionResult struct {
+	Purged     int `json:"purged"`
+	Anonymized int `json:"anonymized"`
+	Archived   int `json:"archived"`
+}
+
+// runRetention applies the retention policies every interval.
+func (s *Server) runRetention(ctx context.Context, interval time.Duration) {
+	ticks, stop := s.clock.NewTicker(interval)
+	defer stop()
+	for {
+		pass, span := tracer.Start(withJobID(ctx, "retention"), "retention.pass")
+		res, err := s.applyRetention(pass, s.now())
+		endSpan(span, err)
+		if err != nil {
+			slog.ErrorContext(pass, "retention pass failed", "err", err)
+		} else if res.Purged > 0 || res.Anonymized > 0 || res.Archived > 0 {
+			slog.InfoContext(pass, "retention applied", "purged", res.Purged, "anonymized", res.Anonymized, "archived", res.Archived)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticks:
+		}
+	}
+}
+
+// applyRetention purges or anonymizes every invitation, in any tenant and
+// archived or not, whose policy says it has been kept long enough after
+// expiring as of t, and then archives those due to be. Idempotency keys
+// past their window are forgotten too.
+func (s *Server) applyRetention(ctx context.Context, t time.Time) (retentionResult, error) {
+	var res retentionResult
+	if err := s.retain(ctx, t, &res); err != nil {
+		return res, err
+	}
+	if s.cfg.ArchiveAfterDays > 0 {
+		n, err := s.archiveResolved(ctx, t)
+		res.Archived = n
+		if err != nil {
+			return res, err
+		}
+	}
+	return res, s.purgeIdempotency(ctx, t)
+}
+
+func (s *Server) retain(ctx context.Context, t time.Time, res *retentionResult) error {
+	tenants, err := listRecords[tenant](ctx, s.store, tenantKind)
+	if err != nil {
+		return err
+	}
+	def := retentionPolicy{Days: s.cfg.RetentionDays, Mode: s.cfg.RetentionMode}
+	policies := map[string]retentionPolicy{}
+	minDays := def.Days
+	for _, tn := range tenants {
+		if tn.Retention == nil {
+			continue
+		}
+		p := *tn.Retention
+		if p.Mode == "" {
+			p.Mode = def.Mode
+		}
+		policies[tn.ID] = p
+		if p.Days > 0 && (minDays == 0 || p.Days < minDays) {
+			minDays = p.Days
+		}
+	}
+	if minDays == 0 {
+		return nil
+	}
+
+	candidates, err := s.store.List(ctx, ListFilter{ExpiresBefore: t.Add(-retentionAge(minDays))})
+	if err != nil {
+		return err
+	}
+	archived, err := s.listArchived(ctx, ListFilter{ExpiresBefore: t.Add(-retentionAge(minDays)), AsOf: t})
+	if err != nil {
+		return err
+	}
+	for _, inv := range append(candidates, archived...) {
+		p, ok := policies[inv.TenantID]
+		if !ok {
+			p = def
+		}
+		if p.Days == 0 || !inv.ExpiresAt.Before(t.Add(-retentionAge(p.Days))) {
+			continue
+		}
+		if p.Mode == retentionAnonymize {
+			if !inv.AnonymizedAt.IsZero() {
+				continue
+			}
+			if err := s.anonymize(ctx, inv); err != nil {
+				return err
+			}
+			res.Anonymized++
+			continue
+		}
+		if err := s.purge(ctx, inv); err != nil {
+			return err
+		}
+		res.Purged++
+	}
+	return nil
+}
+
+func retentionAge(days int) time.Duration { return time.Duration(days) * 24 * time.Hour }
+
+// purge deletes inv, its history and its response link, wherever they are
+// kept.
+func (s *Server) purge(ctx context.Context, inv Invitation) error {
+	if !inv.ArchivedAt.IsZero() {
+		a, err := s.getArchived(ctx, inv.ID)
+		if err == nil {
+			err = s.dropArchived(ctx, a)
+		}
+		if err != nil && err != errNotFound {
+			return err
+		}
+	} else if err := s.store.Delete(ctx, inv.ID); err != nil && err != errNotFound {
+		return err
+	}
+	return s.dropResponseToken(ctx, inv)
+}
+
+// anonymize keeps inv for reporting but removes who it was sent to and
+// anything they wrote, along with its history and response link. One still
+// open is cancelled, as there is nobody left to send it to.
+func (s *Server) anonymize(ctx context.Context, inv Invitation) error {
+	if !inv.ArchivedAt.IsZero() {
+		return s.anonymizeArchived(ctx, inv)
+	}
+	_, err := s.store.Update(ctx, inv.ID, func(inv *Invitation) error {
+		s.scrub(inv)
+		return nil
+	})
+	if err == errNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.store.DeleteEvents(ctx, inv.ID); err != nil {
+		return err
+	}
+	return s.dropResponseToken(ctx, inv)
+}
+
+// scrub removes the personal data anonymize does from inv.
+func (s *Server) scrub(inv *Invitation) {
+	now := s.now().UTC()
+	if st := inv.withStatus(now).Status; isPending(st) || st == statusScheduled {
+		inv.Status, inv.CancelledAt = statusCancelled, now
+	}
+	inv.PhoneNumber, inv.PhoneRaw, inv.Email, inv.TelegramChatID, inv.DeviceID = "", "", "", "", ""
+	inv.ContactID, inv.ContactName = "", ""
+	inv.Message, inv.Template, inv.Variables = "", "", nil
+	inv.ChannelMessages = nil
+	inv.Note, inv.Notes = "", ""
+	inv.ResponseToken = ""
+	inv.AnonymizedAt = now
+}
+
+// anonymizeArchived does for an archived invitation what anonymize does for
+// a live one, rewriting its archive entry without the history.
+func (s *Server) anonymizeArchived(ctx context.Context, inv Invitation) error {
+	a, err := s.getArchived(ctx, inv.ID)
+	if err == errNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	token := a.Invitation.ResponseToken
+	s.scrub(&a.Invitation)
+	if err := putRecord(ctx, s.store, archiveKind, inv.ID, archivedInvitation{Invitation: a.Invitation}); err != nil {
+		return err
+	}
+	if a.Object != "" && s.cold != nil {
+		if err := s.cold.remove(ctx, a.Object); err != nil {
+			return err
+		}
+	}
+	return s.dropResponseToken(ctx, Invitation{ResponseToken: token})
+}
+
+func (s *Server) dropResponseToken(ctx context.Context, inv Invitation) error {
+	if inv.ResponseToken == "" {
+		return nil
+	}
+	if err := s.store.DeleteRecord(ctx, responseTokenKind, inv.ResponseToken); err != nil && err != errNotFound {
+		return err
+	}
+	return nil
+}
+
+// handleAdminRetention applies the retention policies now rather than
+// waiting for the janitor's next pass.
+func (s *Server) handleAdminRetention(w http.ResponseWriter, r *http.Request) {
+	res, err := s.applyRetention(r.Context(), s.now())
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
@@ -0,0 +1,165 @@
+package invitations
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// SMS length policies for invitations over sms_max_segments.
+const (
+	segmentsTruncate = "truncate" // cut the message short, keeping the deadline and link
+	segmentsShorten  = "shorten"  // use short_link_url for the link, then truncate if still over
+	segmentsReject   = "reject"   // refuse the invitation with 422
+)
+
+const (
+	encodingGSM7 = "gsm7"
+	encodingUCS2 = "ucs2"
+)
+
+// gsm7Basic and gsm7Extended are the GSM 03.38 default alphabet and its
+// extension table, whose characters take two septets.
+const (
+	gsm7Basic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+		"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	gsm7Extended = "\f^{}\\[~]|€"
+)
+
+// SMSEstimate is how an SMS body is expected to be billed. Providers may
+// substitute characters or encode differently, so it is an estimate.
+type SMSEstimate struct {
+	Segments int    `json:"segments"`
+	Encoding string `json:"encoding"`
+	Length   int    `json:"length"`
+}
+
+// estimateSMS counts the segments of text: up to 160 GSM-7 characters fit
+// in one, or 153 per segment of a longer message; anything outside GSM-7
+// sends the whole message as UCS-2, 70 code units or 67 per segment.
+// Characters aren't split across segments, as concatenation doesn't allow.
+func estimateSMS(text string) SMSEstimate {
+	units := func(r rune) int {
+		if strings.ContainsRune(gsm7Extended, r) {
+			return 2
+		}
+		return 1
+	}
+	e := SMSEstimate{Encoding: encodingGSM7}
+	for _, r := range text {
+		if !strings.ContainsRune(gsm7Basic, r) && !strings.ContainsRune(gsm7Extended, r) {
+			e.Encoding = encodingUCS2
+			break
+		}
+	}
+	single, multi := 160, 153
+	if e.Encoding == encodingUCS2 {
+		single, multi = 70, 67
+		units = func(r rune) int {
+			if r >= 0x10000 {
+				return 2 // a surrogate pair
+			}
+			return 1
+		}
+	}
+	for _, r := range text {
+		e.Length += units(r)
+	}
+	if e.Length <= single {
+		e.Segments = min(e.Length, 1)
+		return e
+	}
+	used := 0
+	e.Segments = 1
+	for _, r := range text {
+		if n := units(r); used+n > multi {
+			e.Segments++
+			used = n
+		} else {
+			used += n
+		}
+	}
+	return e
+}
+
+// smsText is the invitation as texted: its SMS channel message or the
+// usual text, brought within sms_max_segments by the truncate and shorten
+// policies.
+func (s *Server) smsText(inv Invitation) string {
+	if _, ok := inv.ChannelMessages[channelSMS]; ok {
+		body := s.channelText(inv, channelSMS, s.inviteText(inv))
+		if s.smsOverLimit(body) && s.cfg.SMSSegmentPolicy != segmentsReject {
+			return s.truncateSMS(body, "")
+		}
+		return body
+	}
+	tail := s.inviteTail(inv, s.responseLink(inv))
+	text := inv.Message + tail
+	if !s.smsOverLimit(text) || s.cfg.SMSSegmentPolicy == segmentsReject {
+		return text
+	}
+	if s.cfg.SMSSegmentPolicy == segmentsShorten {
+		tail = s.inviteTail(inv, s.shortLink(inv))
+		if text = inv.Message + tail; !s.smsOverLimit(text) {
+			return text
+		}
+	}
+	return s.truncateSMS(inv.Message, tail)
+}
+
+func (s *Server) smsOverLimit(text string) bool {
+	return s.cfg.SMSMaxSegments > 0 && estimateSMS(text).Segments > s.cfg.SMSMaxSegments
+}
+
+// truncateSMS cuts message, marked with "...", until it and tail fit. The
+// tail is kept whole; if it doesn't fit on its own the message goes
+// entirely.
+func (s *Server) truncateSMS(message, tail string) string {
+	runes := []rune(message)
+	lo, hi := 0, len(runes)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if s.smsOverLimit(strings.TrimSpace(string(runes[:mid])) + "..." + tail) {
+			hi = mid - 1
+		} else {
+			lo = mid
+		}
+	}
+	if lo == 0 {
+		return strings.TrimSpace(tail)
+	}
+	return strings.TrimSpace(string(runes[:lo])) + "..." + tail
+}
+
+// shortLink is the response link on short_link_url, or without its scheme
+// when there is none, which phones still recognize as a link.
+func (s *Server) shortLink(inv Invitation) string {
+	link := s.responseLink(inv)
+	if link == "" {
+		return ""
+	}
+	if s.cfg.ShortLinkURL != "" {
+		return strings.TrimRight(s.cfg.ShortLinkURL, "/") + "/r/" + s.responseToken(inv)
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(link, "https://"), "http://")
+}
+
+// checkSMSLength estimates the texted invitation of inv, for the create and
+// update responses, and with the reject policy refuses one over
+// sms_max_segments.
+func (s *Server) checkSMSLength(inv *Invitation) error {
+	if !slices.Contains(inv.Channels, channelSMS) && (inv.Fallback == nil || !slices.Contains(inv.Fallback.Channels, channelSMS)) {
+		inv.SMSEstimate = nil
+		return nil
+	}
+	e := estimateSMS(s.smsText(*inv))
+	inv.SMSEstimate = &e
+	if s.cfg.SMSSegmentPolicy == segmentsReject && s.cfg.SMSMaxSegments > 0 && e.Segments > s.cfg.SMSMaxSegments {
+		return &requestError{
+			status: http.StatusUnprocessableEntity, code: codeMessageTooLong,
+			msg:     "the texted invitation would take more than the allowed SMS segments",
+			details: map[string]any{"segments": e.Segments, "max_segments": s.cfg.SMSMaxSegments, "encoding": e.Encoding},
+		}
+	}
+	return nil
+}
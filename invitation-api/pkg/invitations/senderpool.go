@@ -0,0 +1,157 @@
+package invitations
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	senderAssignmentKind = "sender_assignment"
+	maxSenderPool        = 50
+	maxAlphanumericLen   = 11
+)
+
+// senderAssignment is the sender from its tenant's sender_pool that a phone
+// number is texted from, kept so the invitee always hears from the same
+// one. It is keyed by a digest of the number rather than the number itself.
+type senderAssignment struct {
+	Sender     string    `json:"sender"`
+	AssignedAt time.Time `json:"assigned_at"`
+}
+
+// alphanumericUnsupported are the countries whose carriers refuse texts from
+// alphanumeric sender IDs, so only a pool's numbers text them.
+var alphanumericUnsupported = map[string]bool{"US": true, "CA": true}
+
+func isAlphanumericSender(sender string) bool { return !strings.HasPrefix(sender, "+") }
+
+// normalizeSenderPool converts the numbers in pool to E.164, checks the
+// rest are alphanumeric sender IDs of up to 11 letters, digits and spaces,
+// and drops repeats.
+func normalizeSenderPool(pool []string) ([]string, error) {
+	if len(pool) > maxSenderPool {
+		return nil, badRequest("sender_pool may have at most " + strconv.Itoa(maxSenderPool) + " senders")
+	}
+	var out []string
+	for _, sender := range pool {
+		sender = strings.TrimSpace(sender)
+		if isAlphanumericSender(sender) {
+			if !validAlphanumericSender(sender) {
+				return nil, badRequest("sender_pool entries must be numbers with a leading + or sender IDs of 1 to " + strconv.Itoa(maxAlphanumericLen) +
+					" letters, digits and spaces with at least one letter; got " + strconv.Quote(sender))
+			}
+		} else {
+			n, err := normalizePhone(sender, "")
+			if err != nil {
+				return nil, badRequest("sender_pool entry " + strconv.Quote(sender) + ": " + strings.TrimPrefix(err.Error(), "phone_number "))
+			}
+			sender = n
+		}
+		if !slices.Contains(out, sender) {
+			out = append(out, sender)
+		}
+	}
+	return out, nil
+}
+
+func validAlphanumericSender(id string) bool {
+	if id == "" || len(id) > maxAlphanumericLen {
+		return false
+	}
+	letter := false
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+			letter = true
+		case c >= '0' && c <= '9', c == ' ':
+		default:
+			return false
+		}
+	}
+	return letter
+}
+
+// senderTurns counts each tenant's new assignments, to hand its senders out
+// in turn.
+type senderTurns struct {
+	mu   sync.Mutex
+	next map[string]int
+}
+
+func (t *senderTurns) take(tenantID string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.next == nil {
+		t.next = map[string]int{}
+	}
+	n := t.next[tenantID]
+	t.next[tenantID] = n + 1
+	return n
+}
+
+// poolSender picks the sender from the pool of inv's tenant for a text to
+// inv.PhoneNumber: the one it was texted from before while that is still in
+// the pool, or else the next in turn. It is "" when the tenant has no
+// sender for the number's country, leaving the provider's default.
+func (s *Server) poolSender(ctx context.Context, inv Invitation) (string, error) {
+	if inv.TenantID == "" {
+		return "", nil
+	}
+	t, err := getRecord[tenant](ctx, s.store, tenantKind, inv.TenantID)
+	if err == errNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	pool := t.SenderPool
+	if alphanumericUnsupported[phoneCountry(inv.PhoneNumber)] {
+		pool = slices.DeleteFunc(slices.Clone(pool), isAlphanumericSender)
+	}
+	if len(pool) == 0 {
+		return "", nil
+	}
+	ctx = withTenant(ctx, inv.TenantID)
+	key := sha256Hex(inv.PhoneNumber)
+	a, err := getRecord[senderAssignment](ctx, s.store, senderAssignmentKind, key)
+	switch {
+	case err == nil && slices.Contains(pool, a.Sender):
+		return a.Sender, nil
+	case err != nil && err != errNotFound:
+		return "", err
+	}
+	a = senderAssignment{Sender: pool[s.turns.take(inv.TenantID)%len(pool)], AssignedAt: s.now().UTC()}
+	return a.Sender, putRecord(ctx, s.store, senderAssignmentKind, key, a)
+}
+
+// forgetSender drops phone's assignment in the tenant of ctx, so it gets
+// whichever sender is next should it be texted again.
+func (s *Server) forgetSender(ctx context.Context, phone string) error {
+	err := s.store.DeleteRecord(ctx, senderAssignmentKind, sha256Hex(phone))
+	if err == errNotFound {
+		return nil
+	}
+	return err
+}
+
+type smsFromContextKey struct{}
+
+// withSMSFrom has texts sent with ctx go from sender, in place of the
+// provider's default and sms_sender_ids.
+func withSMSFrom(ctx context.Context, sender string) context.Context {
+	return context.WithValue(ctx, smsFromContextKey{}, sender)
+}
+
+// smsFrom is the sender for a text to to: the one set by withSMSFrom, or
+// else senders' for its country.
+func smsFrom(ctx context.Context, senders map[string]string, to string) (string, bool) {
+	if sender, ok := ctx.Value(smsFromContextKey{}).(string); ok {
+		return sender, true
+	}
+	sender, ok := senders[phoneCountry(to)]
+	return sender, ok
+}
@@ -0,0 +1,328 @@
+package invitations
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const seriesKind = "series"
+
+// invitationSeries sends the same invitation on a recurring schedule. Each occurrence
+// is an ordinary scheduled invitation linked back by SeriesID; only the next
+// one exists ahead of time, and it is created as the one before it is sent.
+type invitationSeries struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name,omitempty"`
+	Recurrence   string    `json:"recurrence"`
+	StartsAt     time.Time `json:"starts_at"`
+	Timezone     string    `json:"timezone,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	StoppedAt    time.Time `json:"stopped_at,omitempty"`
+	CreatedByKey string    `json:"created_by_key,omitempty"`
+}
+
+// createSeriesRequest takes the invitation fields alongside the schedule.
+type createSeriesRequest struct {
+	Name       string    `json:"name"`
+	Recurrence string    `json:"recurrence"`
+	StartsAt   time.Time `json:"starts_at"`
+	CreateInvitationRequest
+}
+
+// occurrenceID is deterministic so that an occurrence created twice, by two
+// scheduler passes racing or by a pass retried after a crash, is only
+// stored once.
+func occurrenceID(seriesID string, n int) string {
+	return seriesID + "-" + strconv.Itoa(n)
+}
+
+func (s *Server) seriesLocation(sr invitationSeries) *time.Location {
+	if sr.Timezone != "" {
+		if loc, err := time.LoadLocation(sr.Timezone); err == nil {
+			return loc
+		}
+	}
+	return s.cfg.Location()
+}
+
+func (s *Server) handleCreateSeries(w http.ResponseWriter, r *http.Request) {
+	var req createSeriesRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	rule, err := parseRecurrence(req.Recurrence)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if req.StartsAt.IsZero() {
+		writeError(w, r, http.StatusBadRequest, "starts_at is required")
+		return
+	}
+	if req.SendAt != nil || req.BatchID != "" || req.ExternalID != "" {
+		writeError(w, r, http.StatusBadRequest, "send_at, batch_id and external_id can't be set on a series")
+		return
+	}
+	sr := invitationSeries{
+		ID:         s.ids.NewID(),
+		Name:       strings.TrimSpace(req.Name),
+		Recurrence: req.Recurrence,
+		StartsAt:   req.StartsAt.UTC(),
+		Timezone:   req.Timezone,
+		CreatedAt:  s.now().UTC(),
+	}
+	if k, ok := apiKeyFrom(r.Context()); ok {
+		sr.CreatedByKey = k.ID
+	}
+	if sr.Timezone != "" {
+		if _, err := loadTimezone(sr.Timezone); err != nil {
+			writeResponseError(w, r, err)
+			return
+		}
+	}
+	after := sr.StartsAt.Add(-time.Nanosecond)
+	if now := s.now(); now.After(after) {
+		after = now
+	}
+	first, ok := rule.next(sr.StartsAt, after, s.seriesLocation(sr))
+	if !ok {
+		writeError(w, r, http.StatusBadRequest, "recurrence has no occurrences after now")
+		return
+	}
+
+	// The first occurrence is built like any invitation, which validates
+	// the content once for the whole series.
+	inv := req.CreateInvitationRequest
+	if err := s.resolveContact(r.Context(), &inv); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if err := s.resolveTemplate(r.Context(), &inv); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	inv.SendAt = &first
+	occ, err := s.newInvitation(r.Context(), inv)
+	if err == errMerged {
+		// A series can't be folded into a single invitation.
+		err = &requestError{status: http.StatusConflict, code: codeDuplicateInvitation, msg: "phone_number already has invitation " + occ.ID + " in this batch",
+			details: map[string]any{"invitation_id": occ.ID}}
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	occ.SeriesID, occ.Occurrence = sr.ID, 1
+	if err := putRecord(r.Context(), s.store, seriesKind, sr.ID, sr); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if err := s.createOccurrence(r.Context(), &occ); err != nil {
+		s.store.DeleteRecord(r.Context(), seriesKind, sr.ID)
+		writeResponseError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, struct {
+		invitationSeries
+		Next Invitation `json:"next"`
+	}{sr, occ.withStatus(s.now())})
+}
+
+// createOccurrence stores occ, a scheduled invitation of a series, and
+// announces it. An occurrence that already exists is left alone.
+func (s *Server) createOccurrence(ctx context.Context, occ *Invitation) error {
+	occ.ID = occurrenceID(occ.SeriesID, occ.Occurrence)
+	if err := s.renderMessage(occ); err != nil {
+		return err
+	}
+	if err := putRecord(ctx, s.store, responseTokenKind, occ.ResponseToken, responseTokenRecord{InvitationID: occ.ID}); err != nil {
+		return err
+	}
+	err := s.store.Create(ctx, *occ)
+	if err == errDuplicateID {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	invitationsCreated.inc()
+	slog.InfoContext(ctx, "series occurrence scheduled", "invitation_id", occ.ID, "series_id", occ.SeriesID, "send_at", occ.SendAt)
+	s.record(ctx, *occ, InvitationEvent{Type: historyCreated, To: statusScheduled})
+	return nil
+}
+
+// scheduleNextOccurrence creates the occurrence after prev unless the series
+// has stopped or run its course. The content is carried over from prev, so
+// the series keeps the message and recipient it was created with.
+func (s *Server) scheduleNextOccurrence(ctx context.Context, prev Invitation) error {
+	ctx = withTenant(ctx, prev.TenantID)
+	sr, err := getRecord[invitationSeries](ctx, s.store, seriesKind, prev.SeriesID)
+	if err == errNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !sr.StoppedAt.IsZero() {
+		return nil
+	}
+	rule, err := parseRecurrence(sr.Recurrence)
+	if err != nil {
+		slog.ErrorContext(ctx, "invalid series recurrence", "series_id", sr.ID, "err", err)
+		return nil
+	}
+	n := prev.Occurrence + 1
+	if rule.count > 0 && n > rule.count {
+		return nil
+	}
+	// Offsets are taken from when prev was due, before any quiet hours
+	// deferred it.
+	planned := prev.SendAt
+	if !prev.DeferredFrom.IsZero() {
+		planned = prev.DeferredFrom
+	}
+	at, ok := rule.next(sr.StartsAt, planned, s.seriesLocation(sr))
+	if !ok {
+		return nil
+	}
+
+	next := Invitation{
+		PhoneNumber:     prev.PhoneNumber,
+		PhoneRaw:        prev.PhoneRaw,
+		Email:           prev.Email,
+		Channels:        prev.Channels,
+		Message:         prev.Message,
+		CreatedAt:       s.now().UTC(),
+		SendAt:          at.UTC(),
+		ExpiresAt:       at.Add(prev.ExpiresAt.Sub(planned)),
+		ResponseOptions: prev.ResponseOptions,
+		MaxGuests:       prev.MaxGuests,
+		EventDuration:   prev.EventDuration,
+		Location:        prev.Location,
+		Status:          statusScheduled,
+		Timezone:        prev.Timezone,
+		Nudge:           prev.Nudge,
+		ResponseToken:   newResponseToken(),
+		TemplateID:      prev.TemplateID,
+		Template:        prev.Template,
+		Variables:       prev.Variables,
+		CreatedByKey:    prev.CreatedByKey,
+		TenantID:        prev.TenantID,
+		ContactID:       prev.ContactID,
+		ContactName:     prev.ContactName,
+		Metadata:        prev.Metadata,
+		Tags:            prev.Tags,
+		Notes:           prev.Notes,
+		SeriesID:        prev.SeriesID,
+		Occurrence:      n,
+	}
+	if !prev.EventAt.IsZero() {
+		next.EventAt = at.Add(prev.EventAt.Sub(planned))
+	}
+	for _, rm := range prev.Reminders {
+		next.Reminders = append(next.Reminders, Reminder{BeforeMin: rm.BeforeMin})
+	}
+	rescheduleReminders(&next, next.CreatedAt)
+	if err := s.deferForQuietHours(&next, at); err != nil {
+		// Sent on time rather than not at all.
+		slog.WarnContext(ctx, "occurrence not deferred for quiet hours", "series_id", sr.ID, "occurrence", n, "err", err)
+	}
+	return s.createOccurrence(ctx, &next)
+}
+
+func (s *Server) getSeries(w http.ResponseWriter, r *http.Request) (invitationSeries, bool) {
+	sr, err := getRecord[invitationSeries](r.Context(), s.store, seriesKind, r.PathValue("id"))
+	if err == errNotFound {
+		writeError(w, r, http.StatusNotFound, "series not found")
+		return sr, false
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return sr, false
+	}
+	return sr, true
+}
+
+type occurrence struct {
+	InvitationID string    `json:"invitation_id"`
+	Occurrence   int       `json:"occurrence"`
+	SendAt       time.Time `json:"send_at"`
+	Status       string    `json:"status"`
+	Response     string    `json:"response,omitempty"`
+	RespondedAt  time.Time `json:"responded_at,omitempty"`
+}
+
+// handleGetSeries reports a series with its occurrences so far and their
+// status counts.
+func (s *Server) handleGetSeries(w http.ResponseWriter, r *http.Request) {
+	sr, ok := s.getSeries(w, r)
+	if !ok {
+		return
+	}
+	invs, err := s.store.List(r.Context(), ListFilter{SeriesID: sr.ID})
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	resp := struct {
+		invitationSeries
+		Counts      batchCounts  `json:"counts"`
+		Occurrences []occurrence `json:"occurrences"`
+	}{invitationSeries: sr, Occurrences: make([]occurrence, 0, len(invs))}
+	t := s.now()
+	for _, inv := range invs {
+		inv = inv.withStatus(t)
+		resp.Counts.add(inv)
+		resp.Occurrences = append(resp.Occurrences, occurrence{
+			InvitationID: inv.ID,
+			Occurrence:   inv.Occurrence,
+			SendAt:       inv.SendAt,
+			Status:       inv.Status,
+			Response:     inv.Response,
+			RespondedAt:  inv.RespondedAt,
+		})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleListSeries(w http.ResponseWriter, r *http.Request) {
+	all, err := listRecords[invitationSeries](r.Context(), s.store, seriesKind)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, all)
+}
+
+// handleStopSeries ends a series, cancelling the occurrence not yet sent.
+// Occurrences already sent run their course.
+func (s *Server) handleStopSeries(w http.ResponseWriter, r *http.Request) {
+	sr, ok := s.getSeries(w, r)
+	if !ok {
+		return
+	}
+	if sr.StoppedAt.IsZero() {
+		sr.StoppedAt = s.now().UTC()
+		if err := putRecord(r.Context(), s.store, seriesKind, sr.ID, sr); err != nil {
+			writeResponseError(w, r, err)
+			return
+		}
+	}
+	scheduled, err := s.store.List(r.Context(), ListFilter{SeriesID: sr.ID, Status: statusScheduled, AsOf: s.now()})
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	for _, inv := range scheduled {
+		if _, err := s.cancelInvitation(r.Context(), inv.ID, false, nil); err != nil && err != errAlreadyCancelled {
+			writeResponseError(w, r, err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, sr)
+}
@@ -0,0 +1,345 @@
+package invitations
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"invitation-api/pkg/config"
+)
+
+// Server holds everything the handlers and background workers depend on.
+// Build one with NewServer; the zero value is not usable.
+type Server struct {
+	cfg       *config.Config
+	store     Store
+	notifiers map[string]Notifier
+	ids       IDGenerator
+	clock     Clock
+	now       func() time.Time
+
+	expiryMu        sync.Mutex
+	expiryCallbacks []func(context.Context, Invitation)
+	locks           locker // serializes threshold checks per batch; see settleBatch
+	leases          leaser // nil when this instance has the store to itself
+	instance        string
+
+	// projections are told of each event record appends.
+	projections []projection
+
+	idemInFlight keySet
+	phoneLimit   *rateLimiter
+	callerLimit  *rateLimiter
+
+	deliveries *deliveryLog
+	webhookWG  sync.WaitGroup
+	live       liveHub
+
+	outboxWake chan struct{}
+	bus        eventBus // nil unless event_bus is set
+	busWake    chan struct{}
+	sending    keySet
+	sendRates  map[string]*rateLimiter // by provider; see throttle
+	turns      senderTurns             // see poolSender
+	providers  providerChecks
+	prices     []price     // see costMicros
+	cold       coldStorage // where archived history goes; nil keeps it in the store
+	oidc       *oidcProvider
+
+	http       *http.Server
+	acme       *http.Server // answers ACME HTTP challenges, when configured
+	grpc       *grpc.Server
+	routes     []string
+	workers    sync.WaitGroup
+	stopWorker context.CancelFunc
+}
+
+// NewServer wires a server around its dependencies. notifiers is keyed by
+// channel name; a nil clock falls back to the system clock, and a nil ids to
+// UUIDv7 IDs or, with compat_ids, timestamped ones from clock.
+func NewServer(cfg *config.Config, store Store, notifiers map[string]Notifier, ids IDGenerator, clock Clock) *Server {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	if ids == nil {
+		ids = uuidV7Generator{clock}
+		if cfg.CompatIDs {
+			ids = compatIDGenerator{clock}
+		}
+	}
+	s := &Server{
+		cfg:         cfg,
+		store:       tenantStore{clockStore{store, clock.Now}},
+		notifiers:   notifiers,
+		ids:         ids,
+		clock:       clock,
+		now:         clock.Now,
+		deliveries:  &deliveryLog{max: deliveryLogSize},
+		locks:       &localLocks{},
+		instance:    newInstanceID(),
+		outboxWake:  make(chan struct{}, 1),
+		busWake:     make(chan struct{}, 1),
+		phoneLimit:  newRateLimiter("phone", cfg.PhoneRateLimit, cfg.PhoneRateWindow),
+		callerLimit: newRateLimiter("api_key", cfg.KeyRateLimit, cfg.KeyRateWindow),
+		prices:      defaultPrices,
+		sendRates:   map[string]*rateLimiter{},
+	}
+	for _, r := range cfg.SendRates {
+		provider, n, _ := strings.Cut(strings.TrimSpace(r), ":")
+		limit, _ := strconv.Atoi(n)
+		s.sendRates[provider] = newRateLimiter("send_"+provider, limit, time.Second)
+	}
+	if cfg.OIDCIssuer != "" {
+		s.oidc = newOIDCProvider(cfg)
+	}
+	s.projections = []projection{s.projectLive, s.projectWebhooks, s.projectBus, s.projectFollowUps}
+	s.onExpire(func(ctx context.Context, inv Invitation) {
+		if inv.BatchID != "" {
+			s.settleBatch(ctx, inv)
+		}
+		s.notifyHostExpired(ctx, inv)
+	})
+	s.http = &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           s.Routes(),
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+	s.http.RegisterOnShutdown(s.live.close)
+	if cfg.GRPCAddr != "" {
+		s.grpc = s.newGRPCServer()
+	}
+	return s
+}
+
+// Routes returns the HTTP API. Every route is instrumented and recovers
+// from panics; mws, such as authentication, are applied after, in order.
+func (s *Server) Routes() http.Handler {
+	mux := http.NewServeMux()
+	handle := func(pattern string, h http.HandlerFunc, mws ...middleware) {
+		s.routes = append(s.routes, pattern)
+		mux.HandleFunc(pattern, instrument(pattern, chain(h, append([]middleware{recoverPanics}, mws...)...)))
+	}
+	handle("POST /invitations", s.handleCreateInvitation, s.requireAPIKey, s.requireJSON, s.idempotent, s.rateLimitCaller)
+	handle("POST /invitations/bulk", s.handleBulkCreate, s.requireAPIKey, s.idempotent, s.rateLimitCaller)
+	handle("POST /invitations/preview", s.handlePreviewInvitation, s.requireAPIKey, s.requireJSON, s.rateLimitCaller)
+	handle("GET /invitations", s.handleListInvitations, s.requireAPIKey)
+	handle("GET /invitations/expiring-soon", s.handleExpiringSoon, s.requireAPIKey)
+	handle("GET /invitations/{id}", s.handleGetInvitation, s.requireAPIKey)
+	handle("PATCH /invitations/{id}", s.handleUpdateInvitation, s.requireAPIKey, s.requireJSON)
+	handle("DELETE /invitations/{id}", s.handleCancelInvitation, s.requireAPIKey)
+	handle("GET /invitations/{id}/history", s.handleInvitationHistory, s.requireAPIKey)
+	handle("POST /invitations/{id}/restore", s.handleRestoreInvitation, s.requireAPIKey)
+	handle("GET /invitations/{id}/reminders", s.handleListReminders, s.requireAPIKey)
+	handle("GET /invitations/{id}/events", s.handleInvitationStream, s.requireAPIKey)
+	handle("POST /contacts", s.handleCreateContact, s.requireAPIKey, s.requireJSON)
+	handle("GET /contacts", s.handleListContacts, s.requireAPIKey)
+	handle("GET /contacts/{id}", s.handleGetContact, s.requireAPIKey)
+	handle("PUT /contacts/{id}", s.handleUpdateContact, s.requireAPIKey, s.requireJSON)
+	handle("DELETE /contacts/{id}", s.handleDeleteContact, s.requireAPIKey)
+	handle("POST /devices", s.handleRegisterDevice, s.requireAPIKey, s.requireJSON)
+	handle("GET /devices", s.handleListDevices, s.requireAPIKey)
+	handle("DELETE /devices/{id}", s.handleDeleteDevice, s.requireAPIKey)
+	handle("PUT /app/device", s.handleUpdateAppDevice, s.requireDevice, s.requireJSON)
+	handle("GET /app/invitations/{id}", s.handleAppGetInvitation, s.requireDevice)
+	handle("POST /app/invitations/{id}/respond", s.handleAppRespond, s.requireDevice, s.requireJSON)
+	handle("GET /privacy/export", s.handlePrivacyExport, s.requireAPIKey, s.requireOwner)
+	handle("DELETE /privacy/erase", s.handlePrivacyErase, s.requireAPIKey, s.requireOwner)
+	handle("GET /privacy/requests", s.handleListPrivacyRequests, s.requireAPIKey, s.requireOwner)
+	handle("POST /templates", s.handleCreateTemplate, s.requireAPIKey, s.requireJSON)
+	handle("GET /templates", s.handleListTemplates, s.requireAPIKey)
+	handle("GET /templates/{id}", s.handleGetTemplate, s.requireAPIKey)
+	handle("DELETE /templates/{id}", s.handleDeleteTemplate, s.requireAPIKey)
+	handle("POST /batches", s.handleCreateBatch, s.requireAPIKey, s.requireJSON)
+	handle("GET /batches", s.handleListBatches, s.requireAPIKey)
+	handle("GET /batches/{id}", s.handleGetBatch, s.requireAPIKey)
+	handle("PATCH /batches/{id}", s.handleUpdateBatch, s.requireAPIKey, s.requireJSON)
+	handle("POST /series", s.handleCreateSeries, s.requireAPIKey, s.requireJSON)
+	handle("GET /series", s.handleListSeries, s.requireAPIKey)
+	handle("GET /series/{id}", s.handleGetSeries, s.requireAPIKey)
+	handle("DELETE /series/{id}", s.handleStopSeries, s.requireAPIKey)
+	handle("GET /events/{id}/stream", s.handleBatchStream, s.requireAPIKey)
+	handle("POST /events/{id}/import", s.handleImportBatch, s.requireAPIKey, s.idempotent, s.rateLimitCaller)
+	handle("GET /events/{id}/export", s.handleExportBatch, s.requireAPIKey)
+	handle("GET /batches/{id}/ws", s.handleBatchSocket, queryToken, s.requireAPIKey)
+	handle("POST /webhooks", s.handleCreateWebhook, s.requireAPIKey, s.requireOwner, s.requireJSON)
+	handle("GET /webhooks", s.handleListWebhooks, s.requireAPIKey, s.requireOwner)
+	handle("DELETE /webhooks/{id}", s.handleDeleteWebhook, s.requireAPIKey, s.requireOwner)
+	handle("GET /webhooks/deliveries", s.handleListDeliveries, s.requireAPIKey, s.requireOwner)
+	handle("POST /users", s.handleCreateUser, s.requireAPIKey, s.requireOwner, s.requireJSON)
+	handle("GET /users", s.handleListUsers, s.requireAPIKey, s.requireOwner)
+	handle("PATCH /users/{id}", s.handleUpdateUser, s.requireAPIKey, s.requireOwner, s.requireJSON)
+	handle("DELETE /users/{id}", s.handleDeleteUser, s.requireAPIKey, s.requireOwner)
+	handle("POST /keys", s.handleCreateAPIKey, s.requireAPIKey, s.requireOwner, s.requireJSON)
+	handle("GET /keys", s.handleListAPIKeys, s.requireAPIKey, s.requireOwner)
+	handle("DELETE /keys/{id}", s.handleRevokeAPIKey, s.requireAPIKey, s.requireOwner)
+	handle("GET /usage", s.handleUsage, s.requireAPIKey)
+	handle("GET /stats", s.handleStats, s.requireAPIKey)
+	handle("GET /dashboard", s.handleDashboard, s.requireSession)
+	handle("GET /dashboard/stream", s.handleDashboardStream, s.requireSession)
+	handle("POST /dashboard/invitations/{id}/{action}", s.handleDashboardAction, s.requireSession)
+	handle("GET /dashboard/login", s.handleDashboardLogin)
+	handle("POST /dashboard/login", s.handleDashboardLogin)
+	handle("GET /dashboard/login/oidc", s.handleOIDCLogin)
+	handle("GET /dashboard/login/callback", s.handleOIDCCallback)
+	handle("POST /dashboard/logout", s.handleDashboardLogout)
+	handle("GET /invitations/{id}/calendar.ics", s.handleCalendar)
+	handle("GET /r/{token}", s.handleRespondPage)
+	handle("POST /r/{token}", s.handleRespondPage)
+	handle("POST /sms/status", s.handleSMSStatus)
+	handle("POST /sms/inbound", s.handleInboundSMS)
+	handle("POST /voice/gather", s.handleVoiceGather)
+	handle("GET /whatsapp/webhook", s.handleWhatsAppVerify)
+	handle("POST /whatsapp/webhook", s.handleWhatsAppWebhook)
+	handle("POST /telegram/webhook", s.handleTelegramWebhook)
+	handle("GET /admin/invitations", s.handleListInvitations, s.requireAdmin)
+	handle("POST /admin/invitations/{id}/expire", s.handleAdminExpire, s.requireAdmin)
+	handle("POST /admin/invitations/{id}/resend", s.handleAdminResend, s.requireAdmin)
+	handle("POST /admin/purge", s.handleAdminPurge, s.requireAdmin, s.requireJSON)
+	handle("POST /admin/retention/run", s.handleAdminRetention, s.requireAdmin)
+	handle("GET /admin/export", s.handleAdminExport, s.requireAdmin)
+	handle("POST /admin/import", s.handleAdminImport, s.requireAdmin)
+	handle("GET /admin/suppressions", s.handleListSuppressions, s.requireAdmin)
+	handle("POST /admin/suppressions", s.handleAddSuppression, s.requireAdmin, s.requireJSON)
+	handle("DELETE /admin/suppressions/{phone}", s.handleRemoveSuppression, s.requireAdmin)
+	handle("POST /admin/invitations/{id}/respond", s.handleAdminRespond, s.requireAdmin, s.requireJSON)
+	handle("GET /admin/failed-messages", s.handleListFailedMessages, s.requireAdmin)
+	handle("POST /admin/failed-messages/{id}/retry", s.handleRetryFailedMessage, s.requireAdmin)
+	handle("POST /admin/tenants", s.handleCreateTenant, s.requireAdmin, s.requireJSON)
+	handle("GET /admin/tenants", s.handleListTenants, s.requireAdmin)
+	handle("PATCH /admin/tenants/{id}", s.handleUpdateTenant, s.requireAdmin, s.requireJSON)
+	handle("POST /admin/keys", s.handleCreateAPIKey, s.requireAdmin, s.requireJSON)
+	handle("GET /admin/keys", s.handleListAPIKeys, s.requireAdmin)
+	handle("DELETE /admin/keys/{id}", s.handleRevokeAPIKey, s.requireAdmin)
+	mux.HandleFunc("GET /openapi.json", handleOpenAPI)
+	mux.HandleFunc("GET /docs", handleDocs)
+	mux.HandleFunc("GET /metrics", handleMetrics)
+	mux.HandleFunc("GET /healthz", handleHealthz)
+	mux.HandleFunc("GET /readyz", s.handleReadyz)
+	// Registered by hand, so probes stay out of the request log and
+	// metrics, but documented like the rest.
+	s.routes = append(s.routes, "GET /metrics", "GET /healthz", "GET /readyz", "POST /invitations/{id}/respond")
+	mux.HandleFunc("POST /invitations/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/respond") {
+			instrument("POST /invitations/{id}/respond", chain(s.handleRespondInvitation, recoverPanics, s.requireJSON))(w, r)
+			return
+		}
+		writeError(w, r, http.StatusNotFound, "not found")
+	})
+	// Recovering here too covers the routes registered by hand.
+	return chain(mux.ServeHTTP, recoverPanics, s.cors, s.limitBody)
+}
+
+// Start launches the background workers and serves HTTP, and gRPC when
+// configured, until Shutdown is called or a listener fails. Cancelling ctx
+// does not stop the server; use Shutdown so in-flight work can finish.
+func (s *Server) Start(ctx context.Context) error {
+	// Listening first means a taken port fails before the workers start.
+	var lis net.Listener
+	if s.grpc != nil {
+		var err error
+		if lis, err = net.Listen("tcp", s.cfg.GRPCAddr); err != nil {
+			return err
+		}
+	}
+	s.startWorkers(ctx)
+
+	errc := make(chan error, 2)
+	if lis != nil {
+		slog.Info("gRPC API listening", "addr", lis.Addr().String())
+		go func() { errc <- s.grpc.Serve(lis) }()
+	}
+	go func() {
+		if err := s.listenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			errc <- err
+			return
+		}
+		errc <- nil
+	}()
+	if err := <-errc; err != nil {
+		s.stopWorker()
+		s.workers.Wait()
+		return err
+	}
+	return nil
+}
+
+// startWorkers launches the sweeper, scheduler, outbox and the other
+// background jobs, which run until stopWorker is called.
+func (s *Server) startWorkers(ctx context.Context) {
+	workerCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	s.stopWorker = cancel
+	s.goWorker(func() {
+		s.runAsLeader(workerCtx, jobSweeper, func(ctx context.Context) { s.runSweeper(ctx, s.cfg.SweepInterval) })
+	})
+	s.goWorker(func() {
+		s.runAsLeader(workerCtx, jobScheduler, func(ctx context.Context) { s.runScheduler(ctx, s.cfg.SchedulerInterval) })
+	})
+	s.goWorker(func() { s.runAsLeader(workerCtx, jobOutbox, s.runOutbox) })
+	if s.bus != nil {
+		s.goWorker(func() { s.runAsLeader(workerCtx, jobBus, s.runBus) })
+	}
+	s.goWorker(func() {
+		s.runAsLeader(workerCtx, jobRetention, func(ctx context.Context) { s.runRetention(ctx, s.cfg.RetentionInterval) })
+	})
+	if s.live.relay != nil {
+		s.goWorker(func() { s.live.runRelay(workerCtx) })
+	}
+}
+
+func (s *Server) goWorker(fn func()) {
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		fn()
+	}()
+}
+
+// Shutdown stops accepting connections, waits for in-flight requests, then
+// stops the workers, letting sends already under way finish, and waits for
+// queued webhook deliveries. It gives up when ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.http.Shutdown(ctx)
+	if s.acme != nil {
+		err = errors.Join(err, s.acme.Shutdown(ctx))
+	}
+	if s.grpc != nil {
+		stopped := make(chan struct{})
+		go func() {
+			s.grpc.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			s.grpc.Stop()
+		}
+	}
+	if s.stopWorker != nil {
+		s.stopWorker()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.workers.Wait()
+		s.webhookWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return errors.Join(err, ctx.Err())
+	}
+	return err
+}
@@ -0,0 +1,382 @@
+package invitations
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"invitation-api/pkg/config"
+	"invitation-api/testutil"
+)
+
+var testStart = time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+
+func TestMain(m *testing.M) {
+	// Request and worker logs would bury test failures.
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// sentMessage is one message a fakeNotifier was asked to deliver.
+type sentMessage struct {
+	InvitationID string
+	To           string
+	Body         string
+}
+
+// fakeNotifier records what it is asked to send instead of sending it.
+type fakeNotifier struct {
+	mu   sync.Mutex
+	sent []sentMessage
+	err  error
+}
+
+func (n *fakeNotifier) Notify(ctx context.Context, inv Invitation, message string) (string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.err != nil {
+		return "", n.err
+	}
+	n.sent = append(n.sent, sentMessage{InvitationID: inv.ID, To: inv.PhoneNumber, Body: message})
+	return "", nil
+}
+
+func (n *fakeNotifier) messages() []sentMessage {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]sentMessage(nil), n.sent...)
+}
+
+// testServer is a Server on an in-memory store and a fake clock, sending
+// SMS through a fakeNotifier.
+type testServer struct {
+	*Server
+	t       *testing.T
+	clock   *testutil.FakeClock
+	sms     *fakeNotifier
+	handler http.Handler
+}
+
+// newTestServer builds a testServer configured by the defaults, without API
+// keys, and then flags.
+func newTestServer(t *testing.T, flags ...string) *testServer {
+	t.Helper()
+	cfg, err := config.Load(append([]string{"-require-api-key=false", "-timezone=UTC"}, flags...))
+	if err != nil {
+		t.Fatalf("config: %v", err)
+	}
+	clock := testutil.NewFakeClock(testStart)
+	sms := &fakeNotifier{}
+	srv := NewServer(cfg, NewMemoryStore(), map[string]Notifier{channelSMS: sms}, nil, clock)
+	return &testServer{Server: srv, t: t, clock: clock, sms: sms, handler: srv.Routes()}
+}
+
+// do sends a request to the server's routes, with body encoded as JSON
+// unless it is a string.
+func (ts *testServer) do(method, path string, body any, header ...string) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	var r *http.Request
+	switch b := body.(type) {
+	case nil:
+		r = httptest.NewRequest(method, path, nil)
+	case string:
+		r = httptest.NewRequest(method, path, strings.NewReader(b))
+		r.Header.Set("Content-Type", "application/json")
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			ts.t.Fatal(err)
+		}
+		r = httptest.NewRequest(method, path, bytes.NewReader(data))
+		r.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	ts.handler.ServeHTTP(w, r)
+	return w
+}
+
+// create makes an invitation through the API and returns it.
+func (ts *testServer) create(req map[string]any) Invitation {
+	ts.t.Helper()
+	w := ts.do("POST", "/invitations", req)
+	if w.Code != http.StatusCreated {
+		ts.t.Fatalf("create: got %d: %s", w.Code, w.Body)
+	}
+	return decodeBody[Invitation](ts.t, w)
+}
+
+// get fetches an invitation through the API.
+func (ts *testServer) get(id string) Invitation {
+	ts.t.Helper()
+	w := ts.do("GET", "/invitations/"+id, nil)
+	if w.Code != http.StatusOK {
+		ts.t.Fatalf("get %s: got %d: %s", id, w.Code, w.Body)
+	}
+	return decodeBody[Invitation](ts.t, w)
+}
+
+// respond answers inv with its response token.
+func (ts *testServer) respond(inv Invitation, response string) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	return ts.do("POST", "/invitations/"+inv.ID+"/respond", map[string]any{"token": inv.ResponseToken, "response": response})
+}
+
+// drainOutbox makes one send attempt at every due message, as the outbox
+// workers would.
+func (ts *testServer) drainOutbox() {
+	ts.t.Helper()
+	ctx := context.Background()
+	msgs, err := listRecords[outboundMessage](ctx, ts.store, outboxKind)
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	for _, m := range msgs {
+		if !m.NextAt.After(ts.now()) {
+			ts.send(ctx, m)
+		}
+	}
+}
+
+func decodeBody[T any](t *testing.T, w *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+		t.Fatalf("decoding %q: %v", w.Body, err)
+	}
+	return v
+}
+
+func invite(phone string) map[string]any {
+	return map[string]any{"phone_number": phone, "message": "Dinner at 8?", "duration_min": 60}
+}
+
+func TestCreateInvitation(t *testing.T) {
+	ts := newTestServer(t)
+	inv := ts.create(invite("+14155550101"))
+
+	if inv.ID == "" || inv.ResponseToken == "" {
+		t.Fatalf("got ID %q and token %q, want both set", inv.ID, inv.ResponseToken)
+	}
+	if inv.Status != statusPending {
+		t.Errorf("status = %q, want %q", inv.Status, statusPending)
+	}
+	if want := testStart.Add(time.Hour); !inv.ExpiresAt.Equal(want) {
+		t.Errorf("expires_at = %v, want %v", inv.ExpiresAt, want)
+	}
+
+	ts.drainOutbox()
+	sent := ts.sms.messages()
+	if len(sent) != 1 || sent[0].To != "+14155550101" || !strings.Contains(sent[0].Body, "Dinner at 8?") {
+		t.Fatalf("sent %+v, want the invitation texted to +14155550101", sent)
+	}
+	if got := ts.get(inv.ID); got.Delivery[channelSMS].Status != deliverySent {
+		t.Errorf("delivery = %+v, want sms sent", got.Delivery)
+	}
+}
+
+func TestCreateInvitationRejectsInvalidRequests(t *testing.T) {
+	ts := newTestServer(t)
+	for _, tc := range []struct {
+		name string
+		req  map[string]any
+		want int
+	}{
+		{"no recipient", map[string]any{"message": "hi", "duration_min": 10}, http.StatusBadRequest},
+		{"bad phone", map[string]any{"phone_number": "nope", "message": "hi", "duration_min": 10}, http.StatusUnprocessableEntity},
+		{"no duration", map[string]any{"phone_number": "+14155550101", "message": "hi"}, http.StatusBadRequest},
+		{"too long", map[string]any{"phone_number": "+14155550101", "message": "hi", "duration_min": 20000}, http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if w := ts.do("POST", "/invitations", tc.req); w.Code != tc.want {
+				t.Errorf("got %d, want %d: %s", w.Code, tc.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestGetInvitation(t *testing.T) {
+	ts := newTestServer(t)
+	inv := ts.create(invite("+14155550101"))
+
+	got := ts.get(inv.ID)
+	if got.ID != inv.ID || got.Message != "Dinner at 8?" || got.Status != statusPending {
+		t.Errorf("got %+v, want the pending invitation just created", got)
+	}
+
+	ts.clock.Advance(time.Hour + time.Second)
+	if got := ts.get(inv.ID); got.Status != statusExpired {
+		t.Errorf("status after the deadline = %q, want %q", got.Status, statusExpired)
+	}
+
+	if w := ts.do("GET", "/invitations/missing", nil); w.Code != http.StatusNotFound {
+		t.Errorf("unknown ID: got %d, want 404", w.Code)
+	}
+}
+
+func TestRespondInvitation(t *testing.T) {
+	ts := newTestServer(t)
+	inv := ts.create(invite("+14155550101"))
+
+	if w := ts.do("POST", "/invitations/"+inv.ID+"/respond", map[string]any{"token": "wrong", "response": "yes"}); w.Code != http.StatusForbidden {
+		t.Errorf("wrong token: got %d, want 403: %s", w.Code, w.Body)
+	}
+	if w := ts.respond(inv, "maybe"); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown option: got %d, want 400: %s", w.Code, w.Body)
+	}
+	if w := ts.respond(inv, "YES"); w.Code != http.StatusOK {
+		t.Fatalf("respond: got %d: %s", w.Code, w.Body)
+	}
+
+	got := ts.get(inv.ID)
+	if got.Status != statusAccepted || got.Response != "yes" || !got.RespondedAt.Equal(testStart) {
+		t.Errorf("got status %q, response %q at %v; want accepted yes at %v", got.Status, got.Response, got.RespondedAt, testStart)
+	}
+	ts.drainOutbox()
+	if sent := ts.sms.messages(); len(sent) != 2 {
+		t.Errorf("sent %d messages, want the invitation and a confirmation", len(sent))
+	}
+}
+
+func TestRespondAfterExpiry(t *testing.T) {
+	ts := newTestServer(t)
+	inv := ts.create(invite("+14155550101"))
+
+	ts.clock.Advance(time.Hour + time.Second)
+	if w := ts.respond(inv, "yes"); w.Code != http.StatusGone {
+		t.Errorf("got %d, want 410: %s", w.Code, w.Body)
+	}
+	if got := ts.get(inv.ID); got.Response != "" {
+		t.Errorf("response = %q, want none", got.Response)
+	}
+}
+
+func TestListInvitations(t *testing.T) {
+	ts := newTestServer(t)
+	a := ts.create(invite("+14155550101"))
+	ts.clock.Advance(time.Minute)
+	b := ts.create(invite("+14155550102"))
+	ts.clock.Advance(time.Minute)
+	c := ts.create(invite("+14155550103"))
+	if w := ts.respond(b, "no"); w.Code != http.StatusOK {
+		t.Fatalf("respond: got %d: %s", w.Code, w.Body)
+	}
+
+	list := func(query string) []string {
+		t.Helper()
+		w := ts.do("GET", "/invitations"+query, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("list %s: got %d: %s", query, w.Code, w.Body)
+		}
+		var ids []string
+		for _, inv := range decodeBody[invitationPage](t, w).Invitations {
+			ids = append(ids, inv.ID)
+		}
+		return ids
+	}
+	for _, tc := range []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{a.ID, b.ID, c.ID}},
+		{"?status=pending", []string{a.ID, c.ID}},
+		{"?status=declined", []string{b.ID}},
+		{"?phone=%2B14155550103", []string{c.ID}},
+	} {
+		if got := list(tc.query); !slices.Equal(got, tc.want) {
+			t.Errorf("list %q = %v, want %v", tc.query, got, tc.want)
+		}
+	}
+
+	w := ts.do("GET", "/invitations?limit=2", nil)
+	page := decodeBody[invitationPage](t, w)
+	if len(page.Invitations) != 2 || page.NextCursor == "" {
+		t.Fatalf("first page: %d invitations, cursor %q", len(page.Invitations), page.NextCursor)
+	}
+	if got := list("?limit=2&cursor=" + page.NextCursor); !slices.Equal(got, []string{c.ID}) {
+		t.Errorf("second page = %v, want %v", got, []string{c.ID})
+	}
+
+	if w := ts.do("GET", "/invitations?status=bogus", nil); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown status: got %d, want 400", w.Code)
+	}
+}
+
+func TestCancelInvitation(t *testing.T) {
+	ts := newTestServer(t)
+	inv := ts.create(invite("+14155550101"))
+	ts.drainOutbox()
+
+	w := ts.do("DELETE", "/invitations/"+inv.ID+"?notify=true", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("cancel: got %d: %s", w.Code, w.Body)
+	}
+	if got := decodeBody[Invitation](t, w); got.Status != statusCancelled || !got.CancelledAt.Equal(testStart) {
+		t.Errorf("got status %q cancelled at %v, want cancelled at %v", got.Status, got.CancelledAt, testStart)
+	}
+	ts.drainOutbox()
+	if sent := ts.sms.messages(); len(sent) != 2 || sent[1].Body != localize("", "withdrawn_by_host") {
+		t.Errorf("sent %+v, want the invitation then the withdrawal", sent)
+	}
+
+	if w := ts.do("DELETE", "/invitations/"+inv.ID, nil); w.Code != http.StatusConflict {
+		t.Errorf("cancelling again: got %d, want 409", w.Code)
+	}
+	if w := ts.respond(inv, "yes"); w.Code != http.StatusGone {
+		t.Errorf("responding to a cancelled invitation: got %d, want 410", w.Code)
+	}
+}
+
+func TestCancelExpiredInvitation(t *testing.T) {
+	ts := newTestServer(t)
+	inv := ts.create(invite("+14155550101"))
+	ts.clock.Advance(2 * time.Hour)
+	if w := ts.do("DELETE", "/invitations/"+inv.ID, nil); w.Code != http.StatusGone {
+		t.Errorf("got %d, want 410: %s", w.Code, w.Body)
+	}
+}
+
+func TestStartStopsWorkersWhenListenFails(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+	addr := taken.Addr().String()
+
+	ts := newTestServer(t, "-addr=127.0.0.1:0", "-grpc-addr="+addr)
+	if err := ts.Start(context.Background()); err == nil {
+		t.Fatal("started with the gRPC port taken")
+	}
+	if ts.stopWorker != nil {
+		t.Error("workers started though gRPC couldn't listen")
+	}
+
+	ts = newTestServer(t, "-addr="+addr)
+	if err := ts.Start(context.Background()); err == nil {
+		t.Fatal("started with the HTTP port taken")
+	}
+	stopped := make(chan struct{})
+	go func() {
+		ts.workers.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Error("workers still running after the HTTP listener failed")
+	}
+}
@@ -0,0 +1,243 @@
+package invitations
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// SMSSender delivers a single text message and returns the provider's ID
+// for it, if any, for matching later delivery-status callbacks.
+// Implementations wrap errors that are worth retrying in transientError.
+type SMSSender interface {
+	Send(ctx context.Context, to, body string) (id string, err error)
+}
+
+// healthChecker is implemented by senders and notifiers that can check
+// their provider is reachable without sending anything.
+type healthChecker interface {
+	Check(ctx context.Context) error
+}
+
+type transientError struct{ err error }
+
+func (e transientError) Error() string { return e.err.Error() }
+func (e transientError) Unwrap() error { return e.err }
+
+func isTransient(err error) bool {
+	var t transientError
+	return errors.As(err, &t)
+}
+
+// newSMSSender builds the sender named by provider, reading credentials from
+// the environment. Providers that support it are asked to post delivery
+// status to statusCallback when that is set. senders gives the sender for
+// texts to a country, by ISO code, in place of the provider's default,
+// unless the text's context names one with withSMSFrom.
+func newSMSSender(provider, statusCallback string, senders map[string]string) (SMSSender, error) {
+	switch provider {
+	case "", "log":
+		return instrumentedSender{logSender{senders}, "log"}, nil
+	case "twilio":
+		s := &twilioSender{
+			accountSID: os.Getenv("TWILIO_ACCOUNT_SID"),
+			authToken:  os.Getenv("TWILIO_AUTH_TOKEN"),
+			from:       os.Getenv("TWILIO_FROM_NUMBER"),
+			senders:    senders,
+			callback:   statusCallback,
+			client:     &http.Client{Timeout: 10 * time.Second},
+		}
+		if s.accountSID == "" || s.authToken == "" || s.from == "" {
+			return nil, errors.New("twilio requires TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN and TWILIO_FROM_NUMBER")
+		}
+		return instrumentedSender{s, provider}, nil
+	case "sns":
+		s := &snsSender{
+			creds:   awsCredentialsFromEnv(),
+			senders: senders,
+			client:  &http.Client{Timeout: 10 * time.Second},
+		}
+		if !s.creds.complete() {
+			return nil, errors.New("sns requires AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_REGION")
+		}
+		return instrumentedSender{s, provider}, nil
+	default:
+		return nil, fmt.Errorf("unknown SMS provider %q", provider)
+	}
+}
+
+type logSender struct{ senders map[string]string }
+
+func (s logSender) Send(ctx context.Context, to, body string) (string, error) {
+	id := "log-" + randomHex(8)
+	attrs := []any{"to", maskPhone(to), "body", body, "message_id", id}
+	if from, ok := smsFrom(ctx, s.senders, to); ok {
+		attrs = append(attrs, "from", from)
+	}
+	slog.InfoContext(ctx, "sending SMS", attrs...)
+	return id, nil
+}
+
+// classifyHTTP turns a provider response into an error, marking throttling
+// and server-side failures as transient.
+func classifyHTTP(provider string, resp *http.Response) error {
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err := fmt.Errorf("%s: %s: %s", provider, resp.Status, strings.TrimSpace(string(msg)))
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return transientError{err}
+	}
+	return err
+}
+
+type twilioSender struct {
+	accountSID, authToken, from string
+	senders                     map[string]string
+	callback                    string
+	client                      *http.Client
+}
+
+// Check fetches the account, which confirms both reachability and the
+// credentials.
+func (s *twilioSender) Check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.twilio.com/2010-04-01/Accounts/"+s.accountSID+".json", nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(s.accountSID, s.authToken)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return classifyHTTP("twilio", resp)
+}
+
+func (s *twilioSender) Send(ctx context.Context, to, body string) (string, error) {
+	from := s.from
+	if f, ok := smsFrom(ctx, s.senders, to); ok {
+		from = f
+	}
+	form := url.Values{"To": {to}, "From": {from}, "Body": {body}}
+	if s.callback != "" {
+		form.Set("StatusCallback", s.callback)
+	}
+	endpoint := "https://api.twilio.com/2010-04-01/Accounts/" + s.accountSID + "/Messages.json"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(s.accountSID, s.authToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", transientError{err}
+	}
+	defer resp.Body.Close()
+	if err := classifyHTTP("twilio", resp); err != nil {
+		return "", err
+	}
+	var msg struct {
+		SID string `json:"sid"`
+	}
+	// The message was accepted either way; a missing SID only means its
+	// delivery status can't be tracked.
+	_ = json.NewDecoder(resp.Body).Decode(&msg)
+	return msg.SID, nil
+}
+
+// snsSender publishes directly to a phone number through the SNS query API,
+// signing requests with AWS Signature Version 4.
+type snsSender struct {
+	creds   awsCredentials
+	senders map[string]string
+	client  *http.Client
+}
+
+// Send returns the SNS message ID. SNS reports delivery status through
+// CloudWatch rather than a callback, so it is not tracked past "sent".
+func (s *snsSender) Send(ctx context.Context, to, body string) (string, error) {
+	form := url.Values{
+		"Action":      {"Publish"},
+		"Version":     {"2010-03-31"},
+		"PhoneNumber": {to},
+		"Message":     {body},
+	}
+	if id, ok := smsFrom(ctx, s.senders, to); ok {
+		attr := "AWS.SNS.SMS.SenderID"
+		if strings.HasPrefix(id, "+") {
+			attr = "AWS.MM.SMS.OriginationNumber"
+		}
+		form.Set("MessageAttributes.entry.1.Name", attr)
+		form.Set("MessageAttributes.entry.1.Value.DataType", "String")
+		form.Set("MessageAttributes.entry.1.Value.StringValue", id)
+	}
+	resp, err := s.call(ctx, form)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var result struct {
+		MessageID string `xml:"PublishResult>MessageId"`
+	}
+	_ = xml.NewDecoder(resp.Body).Decode(&result)
+	return result.MessageID, nil
+}
+
+// Check reads the account's SMS attributes, which confirms both
+// reachability and the credentials.
+func (s *snsSender) Check(ctx context.Context) error {
+	resp, err := s.call(ctx, url.Values{"Action": {"GetSMSAttributes"}, "Version": {"2010-03-31"}})
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// call makes a signed query API request, returning the response only when
+// it succeeded.
+func (s *snsSender) call(ctx context.Context, form url.Values) (*http.Response, error) {
+	payload := form.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://sns."+s.creds.region+".amazonaws.com/", strings.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	s.creds.sign(req, "sns", sha256Hex(payload), time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, transientError{err}
+	}
+	if err := classifyHTTP("sns", resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
@@ -0,0 +1,279 @@
+package invitations
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const snapshotVersion = 1
+
+// snapshotLine is one line of an export: a header first, then tenants,
+// their contacts, and invitations each with its event history, archived
+// ones last with archived_at set.
+type snapshotLine struct {
+	Type       string            `json:"type"`
+	Version    int               `json:"version,omitempty"`
+	CreatedAt  *time.Time        `json:"created_at,omitempty"`
+	TenantID   string            `json:"tenant_id,omitempty"`
+	Tenant     *tenant           `json:"tenant,omitempty"`
+	Contact    *contact          `json:"contact,omitempty"`
+	Invitation *Invitation       `json:"invitation,omitempty"`
+	Events     []InvitationEvent `json:"events,omitempty"`
+}
+
+const (
+	snapshotHeader     = "snapshot"
+	snapshotTenant     = "tenant"
+	snapshotContact    = "contact"
+	snapshotInvitation = "invitation"
+	// snapshotEnd closes a complete export, so a cut-off download is told
+	// apart from a small one.
+	snapshotEnd = "end"
+)
+
+// handleAdminExport streams every tenant, contact and invitation, with its
+// history, as NDJSON that handleAdminImport restores. Stored PII comes out
+// decrypted, so the file needs the same care as the database.
+func (s *Server) handleAdminExport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tenants, err := listRecords[tenant](ctx, s.store, tenantKind)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="snapshot-`+s.now().UTC().Format("20060102T150405Z")+`.ndjson"`)
+	rc := http.NewResponseController(w)
+	extend := func() {
+		if s.cfg.WriteTimeout > 0 {
+			_ = rc.SetWriteDeadline(time.Now().Add(s.cfg.WriteTimeout))
+		}
+	}
+	extend()
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	fail := func(err error) {
+		// The status line has gone out already; a truncated file, which
+		// import reports, is all the client can be told.
+		slog.ErrorContext(ctx, "export failed", "err", err)
+	}
+
+	t := s.now().UTC()
+	if err := enc.Encode(snapshotLine{Type: snapshotHeader, Version: snapshotVersion, CreatedAt: &t}); err != nil {
+		return
+	}
+	ids := []string{""}
+	for i := range tenants {
+		if err := enc.Encode(snapshotLine{Type: snapshotTenant, Tenant: &tenants[i]}); err != nil {
+			return
+		}
+		ids = append(ids, tenants[i].ID)
+	}
+	for _, id := range ids {
+		contacts, err := listRecords[contact](withTenant(ctx, id), s.store, contactKind)
+		if err != nil {
+			fail(err)
+			return
+		}
+		for i := range contacts {
+			if err := enc.Encode(snapshotLine{Type: snapshotContact, TenantID: id, Contact: &contacts[i]}); err != nil {
+				return
+			}
+		}
+	}
+
+	f := ListFilter{Limit: exportPageSize}
+	for {
+		invs, err := s.store.List(ctx, f)
+		if err != nil {
+			fail(err)
+			return
+		}
+		for i := range invs {
+			events, err := s.store.Events(ctx, invs[i].ID)
+			if err != nil {
+				fail(err)
+				return
+			}
+			if err := enc.Encode(snapshotLine{Type: snapshotInvitation, Invitation: &invs[i], Events: events}); err != nil {
+				return
+			}
+		}
+		if bw.Flush() != nil {
+			return
+		}
+		_ = rc.Flush()
+		extend()
+		if len(invs) < exportPageSize {
+			break
+		}
+		last := invs[len(invs)-1]
+		f.After = &ListCursor{last.CreatedAt, last.ID}
+	}
+	archived, err := listRecords[archivedInvitation](ctx, s.store, archiveKind)
+	if err != nil {
+		fail(err)
+		return
+	}
+	for i := range archived {
+		events, err := s.archivedEvents(ctx, archived[i])
+		if err != nil {
+			fail(err)
+			return
+		}
+		if err := enc.Encode(snapshotLine{Type: snapshotInvitation, Invitation: &archived[i].Invitation, Events: events}); err != nil {
+			return
+		}
+		if i%exportPageSize == exportPageSize-1 {
+			if bw.Flush() != nil {
+				return
+			}
+			_ = rc.Flush()
+			extend()
+		}
+	}
+	if err := enc.Encode(snapshotLine{Type: snapshotEnd}); err == nil {
+		bw.Flush()
+	}
+}
+
+type importResult struct {
+	Tenants     int `json:"tenants"`
+	Contacts    int `json:"contacts"`
+	Invitations int `json:"invitations"`
+	Events      int `json:"events"`
+	// Skipped counts records already present, which are left as they are,
+	// so an interrupted import can simply be run again.
+	Skipped int `json:"skipped"`
+}
+
+// handleAdminImport restores a snapshot from handleAdminExport. Records are
+// written with their original IDs, along with the response-link and
+// provider message indexes, so links already sent keep working.
+func (s *Server) handleAdminImport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var res importResult
+	dec := json.NewDecoder(r.Body)
+	complete := false
+	for n := 1; ; n++ {
+		var l snapshotLine
+		err := dec.Decode(&l)
+		if err == io.EOF {
+			break
+		}
+		if err == nil && n == 1 && (l.Type != snapshotHeader || l.Version != snapshotVersion) {
+			err = badRequest("not a version " + strconv.Itoa(snapshotVersion) + " snapshot")
+		} else if err != nil {
+			err = badRequest(err.Error())
+		} else {
+			err = s.importLine(ctx, l, &res)
+		}
+		var re *requestError
+		if errors.As(err, &re) {
+			writeResponseError(w, r, badRequest("line "+strconv.Itoa(n)+": "+re.msg))
+			return
+		}
+		if err != nil {
+			writeResponseError(w, r, err)
+			return
+		}
+		complete = l.Type == snapshotEnd
+	}
+	if !complete {
+		writeResponseError(w, r, badRequest("snapshot is truncated; the records before the cut were imported"))
+		return
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (s *Server) importLine(ctx context.Context, l snapshotLine, res *importResult) error {
+	switch l.Type {
+	case snapshotHeader, snapshotEnd:
+		return nil
+	case snapshotTenant:
+		if l.Tenant == nil || l.Tenant.ID == "" {
+			return badRequest("tenant line without a tenant")
+		}
+		return importRecord(ctx, s.store, tenantKind, l.Tenant.ID, *l.Tenant, &res.Tenants, &res.Skipped)
+	case snapshotContact:
+		if l.Contact == nil || l.Contact.ID == "" {
+			return badRequest("contact line without a contact")
+		}
+		return importRecord(withTenant(ctx, l.TenantID), s.store, contactKind, l.Contact.ID, *l.Contact, &res.Contacts, &res.Skipped)
+	case snapshotInvitation:
+		if l.Invitation == nil || l.Invitation.ID == "" {
+			return badRequest("invitation line without an invitation")
+		}
+		return s.importInvitation(ctx, *l.Invitation, l.Events, res)
+	}
+	return badRequest("unknown line type " + strconv.Quote(l.Type))
+}
+
+// importRecord writes v unless a record with id already exists.
+func importRecord[T any](ctx context.Context, st Store, kind, id string, v T, count, skipped *int) error {
+	_, err := st.GetRecord(ctx, kind, id)
+	if err == nil {
+		*skipped++
+		return nil
+	}
+	if err != errNotFound {
+		return err
+	}
+	if err := putRecord(ctx, st, kind, id, v); err != nil {
+		return err
+	}
+	*count++
+	return nil
+}
+
+func (s *Server) importInvitation(ctx context.Context, inv Invitation, events []InvitationEvent, res *importResult) error {
+	var err error
+	archived := !inv.ArchivedAt.IsZero()
+	if !archived {
+		err = s.store.Create(ctx, inv)
+	} else if _, err = s.store.GetRecord(ctx, archiveKind, inv.ID); err == nil {
+		err = errDuplicateID
+	} else if err == errNotFound {
+		// Archived history comes back into the store, whatever cold
+		// storage it was exported from.
+		err = putRecord(ctx, s.store, archiveKind, inv.ID, archivedInvitation{Invitation: inv, Events: events})
+	}
+	if err == errDuplicateID {
+		res.Skipped++
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if inv.ResponseToken != "" {
+		if err := putRecord(ctx, s.store, responseTokenKind, inv.ResponseToken, responseTokenRecord{InvitationID: inv.ID}); err != nil {
+			return err
+		}
+	}
+	for _, m := range inv.Messages {
+		if m.MessageID != "" {
+			if err := putRecord(ctx, s.store, messageKind, m.MessageID, messageRecord{InvitationID: inv.ID}); err != nil {
+				return err
+			}
+		}
+	}
+	for _, ev := range events {
+		if archived {
+			break // kept with the archive record
+		}
+		if err := s.store.AppendEvent(ctx, inv.ID, ev); err != nil {
+			return err
+		}
+	}
+	res.Invitations++
+	res.Events += len(events)
+	return nil
+}
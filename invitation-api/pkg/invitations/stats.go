@@ -0,0 +1,177 @@
+package invitations
+
+import (
+	"net/http"
+	"sort"
+	"time"
+)
+
+// StatsFilter selects the invitations Stats totals: those created in
+// [From, To), by every tenant when TenantID is nil, and with Tag if it's
+// set. Expiry is judged as of AsOf.
+type StatsFilter struct {
+	TenantID *string
+	Tag      string
+	From     time.Time
+	To       time.Time
+	AsOf     time.Time
+}
+
+func (f StatsFilter) list() ListFilter {
+	return ListFilter{TenantID: f.TenantID, Tag: f.Tag, CreatedAfter: f.From, CreatedBefore: f.To}
+}
+
+// InvitationStats are what Stats totals. Test invitations and those still
+// scheduled to be sent are left out.
+type InvitationStats struct {
+	Invitations int
+	Responded   int
+	Expired     int
+	Cancelled   int
+	// Viewed counts those whose response page was opened, answered or not.
+	Viewed         int
+	MedianResponse time.Duration
+	// ResponsesByHour counts responses by the hour, in UTC, they came in.
+	ResponsesByHour [24]int
+	// Deliveries counts each channel's messages by delivery status.
+	Deliveries map[string]map[string]int
+}
+
+// statsCounter totals invitations one at a time, for stores that can't
+// aggregate in a query.
+type statsCounter struct {
+	asOf          time.Time
+	stats         InvitationStats
+	responseTimes []time.Duration
+}
+
+func newStatsCounter(asOf time.Time) *statsCounter {
+	return &statsCounter{asOf: asOf, stats: InvitationStats{Deliveries: map[string]map[string]int{}}}
+}
+
+func (c *statsCounter) add(inv Invitation) {
+	if inv.Test || inv.Status == statusScheduled {
+		return
+	}
+	c.stats.Invitations++
+	switch inv.withStatus(c.asOf).Status {
+	case statusExpired:
+		c.stats.Expired++
+	case statusCancelled:
+		c.stats.Cancelled++
+	}
+	if !inv.ViewedAt.IsZero() {
+		c.stats.Viewed++
+	}
+	if inv.Response != "" {
+		c.stats.Responded++
+		c.stats.ResponsesByHour[inv.RespondedAt.UTC().Hour()]++
+		c.responseTimes = append(c.responseTimes, inv.RespondedAt.Sub(inv.CreatedAt))
+	}
+	for ch, d := range inv.Delivery {
+		if c.stats.Deliveries[ch] == nil {
+			c.stats.Deliveries[ch] = map[string]int{}
+		}
+		c.stats.Deliveries[ch][d.Status]++
+	}
+}
+
+func (c *statsCounter) result() InvitationStats {
+	if n := len(c.responseTimes); n > 0 {
+		sort.Slice(c.responseTimes, func(i, j int) bool { return c.responseTimes[i] < c.responseTimes[j] })
+		c.stats.MedianResponse = c.responseTimes[n/2]
+		if n%2 == 0 {
+			c.stats.MedianResponse = (c.responseTimes[n/2-1] + c.responseTimes[n/2]) / 2
+		}
+	}
+	return c.stats
+}
+
+type deliveryStats struct {
+	// Messages counts those that left the outbox; success is any of them
+	// that didn't fail, as channels without delivery receipts stay sent.
+	Messages    int     `json:"messages"`
+	Delivered   int     `json:"delivered"`
+	Failed      int     `json:"failed"`
+	SuccessRate float64 `json:"success_rate"`
+}
+
+type hourCount struct {
+	Hour      int `json:"hour"`
+	Responses int `json:"responses"`
+}
+
+type statsReport struct {
+	From              time.Time                 `json:"from"`
+	To                time.Time                 `json:"to"`
+	Invitations       int                       `json:"invitations"`
+	Responded         int                       `json:"responded"`
+	Expired           int                       `json:"expired"`
+	Cancelled         int                       `json:"cancelled"`
+	Viewed            int                       `json:"viewed"`
+	ResponseRate      float64                   `json:"response_rate"`
+	ExpiryRate        float64                   `json:"expiry_rate"`
+	ViewRate          float64                   `json:"view_rate"`
+	MedianResponseSec int                       `json:"median_response_sec,omitempty"`
+	Delivery          map[string]*deliveryStats `json:"delivery"`
+	BusiestHours      []hourCount               `json:"busiest_hours"`
+	ResponsesByHour   [24]int                   `json:"responses_by_hour"`
+}
+
+// busiestHours is how many of the hours with the most responses a report
+// lists.
+const busiestHours = 3
+
+func newStatsReport(st InvitationStats, from, to time.Time) statsReport {
+	rep := statsReport{
+		From: from.UTC(), To: to.UTC(), Invitations: st.Invitations, Responded: st.Responded, Expired: st.Expired, Cancelled: st.Cancelled, Viewed: st.Viewed,
+		MedianResponseSec: int(st.MedianResponse.Round(time.Second) / time.Second),
+		Delivery:          map[string]*deliveryStats{}, BusiestHours: []hourCount{}, ResponsesByHour: st.ResponsesByHour,
+	}
+	if st.Invitations > 0 {
+		rep.ResponseRate = float64(st.Responded) / float64(st.Invitations)
+		rep.ExpiryRate = float64(st.Expired) / float64(st.Invitations)
+		rep.ViewRate = float64(st.Viewed) / float64(st.Invitations)
+	}
+	for ch, byStatus := range st.Deliveries {
+		d := &deliveryStats{Delivered: byStatus[deliveryDelivered], Failed: byStatus[deliveryFailed]}
+		d.Messages = d.Delivered + d.Failed + byStatus[deliverySent]
+		if d.Messages > 0 {
+			d.SuccessRate = float64(d.Messages-d.Failed) / float64(d.Messages)
+		}
+		rep.Delivery[ch] = d
+	}
+	for h, n := range st.ResponsesByHour {
+		if n > 0 {
+			rep.BusiestHours = append(rep.BusiestHours, hourCount{Hour: h, Responses: n})
+		}
+	}
+	sort.SliceStable(rep.BusiestHours, func(i, j int) bool { return rep.BusiestHours[i].Responses > rep.BusiestHours[j].Responses })
+	if len(rep.BusiestHours) > busiestHours {
+		rep.BusiestHours = rep.BusiestHours[:busiestHours]
+	}
+	return rep
+}
+
+// handleStats reports on the invitations the caller's tenant created
+// between from and to, by default in the current month so far. Callers not
+// scoped to a tenant see every tenant's, or one's with tenant_id. With tag,
+// only the invitations carrying it are counted.
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	t := s.now()
+	from, to, err := timeRange(r, monthStart(t), t)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	f := StatsFilter{Tag: normalizeTag(r.URL.Query().Get("tag")), From: from, To: to, AsOf: t}
+	if id := r.URL.Query().Get("tenant_id"); id != "" {
+		f.TenantID = &id
+	}
+	st, err := s.store.Stats(r.Context(), f)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newStatsReport(st, from, to))
+}
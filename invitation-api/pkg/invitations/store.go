@@ -0,0 +1,222 @@
+package invitations
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Store persists invitations and their event history. Create fails with
+// ErrDuplicateID rather than overwriting an existing invitation, and lookups
+// of missing invitations and records with ErrNotFound. Update runs fn
+// against the current record and saves the result atomically, with Version
+// bumped; if fn returns an error nothing is written and the error is
+// returned unchanged. The server sets UpdatedAt itself, from its clock.
+type Store interface {
+	Create(ctx context.Context, inv Invitation) error
+	Get(ctx context.Context, id string) (Invitation, error)
+	Update(ctx context.Context, id string, fn func(*Invitation) error) (Invitation, error)
+	List(ctx context.Context, f ListFilter) ([]Invitation, error)
+	// Stats totals the invitations f selects; see InvitationStats.
+	Stats(ctx context.Context, f StatsFilter) (InvitationStats, error)
+	DeleteExpired(ctx context.Context, before time.Time) (int, error)
+	// Delete removes one invitation with its event history.
+	Delete(ctx context.Context, id string) error
+
+	AppendEvent(ctx context.Context, id string, ev InvitationEvent) error
+	Events(ctx context.Context, id string) ([]InvitationEvent, error)
+	DeleteEvents(ctx context.Context, id string) error
+
+	// Records hold small auxiliary collections such as webhook
+	// registrations, stored as JSON documents keyed by kind and ID.
+	PutRecord(ctx context.Context, kind, id string, data []byte) error
+	GetRecord(ctx context.Context, kind, id string) ([]byte, error)
+	ListRecords(ctx context.Context, kind string) ([][]byte, error)
+	DeleteRecord(ctx context.Context, kind, id string) error
+
+	// Ping checks that the backing database can be reached.
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+func putRecord(ctx context.Context, st Store, kind, id string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return st.PutRecord(ctx, kind, id, data)
+}
+
+func getRecord[T any](ctx context.Context, st Store, kind, id string) (T, error) {
+	var v T
+	data, err := st.GetRecord(ctx, kind, id)
+	if err != nil {
+		return v, err
+	}
+	err = json.Unmarshal(data, &v)
+	return v, err
+}
+
+func listRecords[T any](ctx context.Context, st Store, kind string) ([]T, error) {
+	docs, err := st.ListRecords(ctx, kind)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]T, 0, len(docs))
+	for _, data := range docs {
+		var v T
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+	return result, nil
+}
+
+// ListFilter selects invitations for List. Results are ordered by creation
+// time then ID; After resumes strictly past a previous page and Limit caps the
+// page size (zero means no limit). Status is evaluated as of AsOf. Time
+// ranges are inclusive of the lower bound and exclusive of the upper one.
+type ListFilter struct {
+	PhoneNumber   string
+	BatchID       string
+	SeriesID      string
+	ExternalID    string
+	Tag           string
+	TenantID      *string // nil matches every tenant
+	Status        string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	ExpiresAfter  time.Time
+	ExpiresBefore time.Time
+	AsOf          time.Time
+	After         *ListCursor
+	Limit         int
+}
+
+// ListCursor is the last invitation of a page, which the next starts after.
+type ListCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+func (c ListCursor) encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(c.CreatedAt.UnixNano(), 10) + "|" + c.ID))
+}
+
+func decodeCursor(s string) (*ListCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	ts, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, errInvalidCursor
+	}
+	n, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	return &ListCursor{CreatedAt: time.Unix(0, n).UTC(), ID: id}, nil
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// Match reports whether f selects inv, Limit aside. Stores can narrow the
+// candidates by index and call it on the rest before ordering them.
+func (f ListFilter) Match(inv Invitation) bool {
+	if f.PhoneNumber != "" && inv.PhoneNumber != f.PhoneNumber {
+		return false
+	}
+	if f.BatchID != "" && inv.BatchID != f.BatchID {
+		return false
+	}
+	if f.SeriesID != "" && inv.SeriesID != f.SeriesID {
+		return false
+	}
+	if f.ExternalID != "" && inv.ExternalID != f.ExternalID {
+		return false
+	}
+	if f.Tag != "" && !slices.Contains(inv.Tags, f.Tag) {
+		return false
+	}
+	if f.TenantID != nil && inv.TenantID != *f.TenantID {
+		return false
+	}
+	if !f.CreatedAfter.IsZero() && inv.CreatedAt.Before(f.CreatedAfter) {
+		return false
+	}
+	if !f.CreatedBefore.IsZero() && !inv.CreatedAt.Before(f.CreatedBefore) {
+		return false
+	}
+	if !f.ExpiresAfter.IsZero() && inv.ExpiresAt.Before(f.ExpiresAfter) {
+		return false
+	}
+	if !f.ExpiresBefore.IsZero() && !inv.ExpiresAt.Before(f.ExpiresBefore) {
+		return false
+	}
+	if f.After != nil && !cursorLess(*f.After, inv) {
+		return false
+	}
+	if f.Status == statusPending {
+		return isPending(inv.withStatus(f.AsOf).Status)
+	}
+	return f.Status == "" || inv.withStatus(f.AsOf).Status == f.Status
+}
+
+func cursorLess(c ListCursor, inv Invitation) bool {
+	if !c.CreatedAt.Equal(inv.CreatedAt) {
+		return c.CreatedAt.Before(inv.CreatedAt)
+	}
+	return c.ID < inv.ID
+}
+
+func sortInvitations(invs []Invitation) {
+	sort.Slice(invs, func(i, j int) bool {
+		return cursorLess(ListCursor{invs[i].CreatedAt, invs[i].ID}, invs[j])
+	})
+}
+
+// OpenStore opens the store of kind: memory, sqlite, postgres or redis. A
+// SQL store's schema is migrated to this build's version when migrate is
+// set, and otherwise must already be at it.
+func OpenStore(kind, dsn string, migrate bool) (Store, error) {
+	switch kind {
+	case "memory":
+		return newMemoryStore(), nil
+	case "sqlite", "postgres":
+		s, err := openSQLDatabase(kind, dsn)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.prepareSchema(context.Background(), migrate); err != nil {
+			s.Close()
+			return nil, err
+		}
+		return s, nil
+	case "redis":
+		if dsn == "" {
+			return nil, fmt.Errorf("redis store requires -db-dsn")
+		}
+		return openRedisStore(dsn)
+	default:
+		return nil, fmt.Errorf("unknown store %q", kind)
+	}
+}
+
+func openSQLDatabase(dialect, dsn string) (*sqlStore, error) {
+	if dsn == "" {
+		if dialect == "postgres" {
+			return nil, fmt.Errorf("postgres store requires -db-dsn")
+		}
+		dsn = "invitations.db"
+	}
+	return openSQLStore(dialect, dsn)
+}
@@ -0,0 +1,363 @@
+package invitations
+
+import (
+	"context"
+	"hash/fnv"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryShards is how many independently locked partitions the in-memory
+// store splits invitations into, so requests for different invitations
+// don't wait on each other.
+const memoryShards = 32
+
+// memoryStore keeps everything in maps. Invitations, their events and the
+// phone and expiry indexes over them live in the shard their ID hashes to,
+// so a write locks one shard and nothing else.
+type memoryStore struct {
+	shards []memoryShard
+
+	recordsMu sync.RWMutex
+	records   map[string]map[string][]byte
+}
+
+type memoryShard struct {
+	mu          sync.RWMutex
+	invitations map[string]Invitation
+	events      map[string][]InvitationEvent
+	byPhone     map[string]map[string]struct{}
+	byExpiry    map[int64]map[string]struct{} // by expiry, truncated to the minute
+}
+
+func newMemoryStore() *memoryStore { return newShardedMemoryStore(memoryShards) }
+
+func newShardedMemoryStore(n int) *memoryStore {
+	s := &memoryStore{
+		shards:  make([]memoryShard, n),
+		records: make(map[string]map[string][]byte),
+	}
+	for i := range s.shards {
+		s.shards[i] = memoryShard{
+			invitations: make(map[string]Invitation),
+			events:      make(map[string][]InvitationEvent),
+			byPhone:     make(map[string]map[string]struct{}),
+			byExpiry:    make(map[int64]map[string]struct{}),
+		}
+	}
+	return s
+}
+
+func (s *memoryStore) shard(id string) *memoryShard {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return &s.shards[h.Sum32()%uint32(len(s.shards))]
+}
+
+func expiryBucket(t time.Time) int64 { return t.Unix() / 60 }
+
+func (s *memoryStore) Create(_ context.Context, inv Invitation) error {
+	sh := s.shard(inv.ID)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if _, ok := sh.invitations[inv.ID]; ok {
+		return errDuplicateID
+	}
+	sh.put(inv)
+	return nil
+}
+
+func (s *memoryStore) Get(_ context.Context, id string) (Invitation, error) {
+	sh := s.shard(id)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	inv, ok := sh.invitations[id]
+	if !ok {
+		return Invitation{}, errNotFound
+	}
+	return inv.clone(), nil
+}
+
+func (s *memoryStore) Update(_ context.Context, id string, fn func(*Invitation) error) (Invitation, error) {
+	sh := s.shard(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	inv, ok := sh.invitations[id]
+	if !ok {
+		return Invitation{}, errNotFound
+	}
+	inv = inv.clone()
+	if err := fn(&inv); err != nil {
+		return Invitation{}, err
+	}
+	inv.Version++
+	sh.put(inv)
+	return inv, nil
+}
+
+// List looks candidates up in each shard's phone index when filtering by
+// phone, in its expiry index when there's an upper bound on expiry, and
+// otherwise scans the shard. Either way, each candidate is matched against
+// the whole filter.
+func (s *memoryStore) List(_ context.Context, f ListFilter) ([]Invitation, error) {
+	result := []Invitation{}
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.RLock()
+		switch {
+		case f.PhoneNumber != "":
+			for id := range sh.byPhone[f.PhoneNumber] {
+				if inv := sh.invitations[id]; f.Match(inv) {
+					result = append(result, inv.clone())
+				}
+			}
+		case !f.ExpiresBefore.IsZero():
+			for _, id := range sh.expiringBetween(f.ExpiresAfter, f.ExpiresBefore) {
+				if inv := sh.invitations[id]; f.Match(inv) {
+					result = append(result, inv.clone())
+				}
+			}
+		default:
+			for _, inv := range sh.invitations {
+				if f.Match(inv) {
+					result = append(result, inv.clone())
+				}
+			}
+		}
+		sh.mu.RUnlock()
+	}
+	sortInvitations(result)
+	if f.Limit > 0 && len(result) > f.Limit {
+		result = result[:f.Limit]
+	}
+	return result, nil
+}
+
+func (s *memoryStore) Stats(_ context.Context, f StatsFilter) (InvitationStats, error) {
+	lf, c := f.list(), newStatsCounter(f.AsOf)
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.RLock()
+		for _, inv := range sh.invitations {
+			if lf.Match(inv) {
+				c.add(inv)
+			}
+		}
+		sh.mu.RUnlock()
+	}
+	return c.result(), nil
+}
+
+// expiringBetween returns the IDs in the expiry buckets that may hold
+// invitations expiring in [after, before). A zero after has no lower bound.
+// Narrow windows, like the sweeper's, visit just the buckets in range.
+// Callers must hold the shard's lock.
+func (sh *memoryShard) expiringBetween(after, before time.Time) []string {
+	var ids []string
+	lo, hi := int64(-1<<63), expiryBucket(before)
+	if !after.IsZero() {
+		lo = expiryBucket(after)
+	}
+	if !after.IsZero() && hi >= lo && hi-lo < int64(len(sh.byExpiry)) {
+		for b := lo; b <= hi; b++ {
+			for id := range sh.byExpiry[b] {
+				ids = append(ids, id)
+			}
+		}
+		return ids
+	}
+	for b, set := range sh.byExpiry {
+		if b < lo || b > hi {
+			continue
+		}
+		for id := range set {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (s *memoryStore) DeleteExpired(_ context.Context, before time.Time) (int, error) {
+	n := 0
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		for _, id := range sh.expiringBetween(time.Time{}, before) {
+			if sh.invitations[id].ExpiresAt.Before(before) {
+				sh.remove(id)
+				n++
+			}
+		}
+		sh.mu.Unlock()
+	}
+	return n, nil
+}
+
+func (s *memoryStore) Delete(_ context.Context, id string) error {
+	sh := s.shard(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if _, ok := sh.invitations[id]; !ok {
+		return errNotFound
+	}
+	sh.remove(id)
+	return nil
+}
+
+func (s *memoryStore) AppendEvent(_ context.Context, id string, ev InvitationEvent) error {
+	sh := s.shard(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	sh.events[id] = append(sh.events[id], ev)
+	return nil
+}
+
+func (s *memoryStore) Events(_ context.Context, id string) ([]InvitationEvent, error) {
+	sh := s.shard(id)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	return append([]InvitationEvent{}, sh.events[id]...), nil
+}
+
+func (s *memoryStore) DeleteEvents(_ context.Context, id string) error {
+	sh := s.shard(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	delete(sh.events, id)
+	return nil
+}
+
+func (s *memoryStore) PutRecord(_ context.Context, kind, id string, data []byte) error {
+	s.recordsMu.Lock()
+	defer s.recordsMu.Unlock()
+	if s.records[kind] == nil {
+		s.records[kind] = make(map[string][]byte)
+	}
+	s.records[kind][id] = data
+	return nil
+}
+
+func (s *memoryStore) GetRecord(_ context.Context, kind, id string) ([]byte, error) {
+	s.recordsMu.RLock()
+	defer s.recordsMu.RUnlock()
+	data, ok := s.records[kind][id]
+	if !ok {
+		return nil, errNotFound
+	}
+	return data, nil
+}
+
+func (s *memoryStore) ListRecords(_ context.Context, kind string) ([][]byte, error) {
+	s.recordsMu.RLock()
+	defer s.recordsMu.RUnlock()
+	ids := make([]string, 0, len(s.records[kind]))
+	for id := range s.records[kind] {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	result := make([][]byte, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, s.records[kind][id])
+	}
+	return result, nil
+}
+
+func (s *memoryStore) DeleteRecord(_ context.Context, kind, id string) error {
+	s.recordsMu.Lock()
+	defer s.recordsMu.Unlock()
+	if _, ok := s.records[kind][id]; !ok {
+		return errNotFound
+	}
+	delete(s.records[kind], id)
+	return nil
+}
+
+func (s *memoryStore) Ping(context.Context) error { return nil }
+func (s *memoryStore) Close() error               { return nil }
+
+// put and remove keep the shard's indexes in step with its invitations.
+// Callers must hold the shard's lock.
+func (sh *memoryShard) put(inv Invitation) {
+	if old, ok := sh.invitations[inv.ID]; ok {
+		if old.PhoneNumber != inv.PhoneNumber {
+			unindex(sh.byPhone, old.PhoneNumber, old.ID)
+		}
+		if ob := expiryBucket(old.ExpiresAt); ob != expiryBucket(inv.ExpiresAt) {
+			unindex(sh.byExpiry, ob, old.ID)
+		}
+	}
+	sh.invitations[inv.ID] = inv.clone()
+	index(sh.byPhone, inv.PhoneNumber, inv.ID)
+	index(sh.byExpiry, expiryBucket(inv.ExpiresAt), inv.ID)
+}
+
+func (sh *memoryShard) remove(id string) {
+	inv, ok := sh.invitations[id]
+	if !ok {
+		return
+	}
+	delete(sh.invitations, id)
+	delete(sh.events, id)
+	unindex(sh.byPhone, inv.PhoneNumber, id)
+	unindex(sh.byExpiry, expiryBucket(inv.ExpiresAt), id)
+}
+
+func index[K comparable](idx map[K]map[string]struct{}, key K, id string) {
+	ids, ok := idx[key]
+	if !ok {
+		ids = make(map[string]struct{})
+		idx[key] = ids
+	}
+	ids[id] = struct{}{}
+}
+
+func unindex[K comparable](idx map[K]map[string]struct{}, key K, id string) {
+	ids := idx[key]
+	delete(ids, id)
+	if len(ids) == 0 {
+		delete(idx, key)
+	}
+}
+
+// clone copies the slices, maps and pointed-to policies that callers update
+// in place, so that what the store holds is never shared with an invitation
+// it has handed out.
+func (inv Invitation) clone() Invitation {
+	inv.Channels = slices.Clone(inv.Channels)
+	inv.ResponseOptions = slices.Clone(inv.ResponseOptions)
+	inv.Questions = slices.Clone(inv.Questions)
+	inv.Answers = maps.Clone(inv.Answers)
+	inv.Reminders = slices.Clone(inv.Reminders)
+	inv.Nudges = slices.Clone(inv.Nudges)
+	inv.Delivery = maps.Clone(inv.Delivery)
+	inv.Messages = slices.Clone(inv.Messages)
+	inv.ChannelMessages = maps.Clone(inv.ChannelMessages)
+	inv.Fallbacks = slices.Clone(inv.Fallbacks)
+	inv.FollowUps = slices.Clone(inv.FollowUps)
+	inv.Variables = maps.Clone(inv.Variables)
+	inv.Metadata = maps.Clone(inv.Metadata)
+	inv.Tags = slices.Clone(inv.Tags)
+	inv.Nudge = clonePtr(inv.Nudge)
+	inv.SMSEstimate = clonePtr(inv.SMSEstimate)
+	inv.Fallback = clonePtr(inv.Fallback)
+	inv.OnExpire = clonePtr(inv.OnExpire)
+	inv.Notify = clonePtr(inv.Notify)
+	inv.Confirm = clonePtr(inv.Confirm)
+	inv.TestResponse = clonePtr(inv.TestResponse)
+	if p := clonePtr(inv.PendingResponse); p != nil {
+		p.Answers = maps.Clone(p.Answers)
+		inv.PendingResponse = p
+	}
+	return inv
+}
+
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
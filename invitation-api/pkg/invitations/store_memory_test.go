@@ -0,0 +1,171 @@
+package invitations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreIndexesMatchScan(t *testing.T) {
+	s := newShardedMemoryStore(4)
+	ctx := context.Background()
+	rng := rand.New(rand.NewPCG(1, 2))
+	phones := []string{"+14155550101", "+14155550102", "+14155550103", "+14155550104", "+14155550105"}
+	at := func() time.Time { return testStart.Add(time.Duration(rng.IntN(180)) * time.Minute) }
+
+	var ids []string
+	for op := 0; op < 2000; op++ {
+		switch n := rng.IntN(10); {
+		case n < 4 || len(ids) == 0:
+			inv := Invitation{ID: fmt.Sprintf("inv-%d", op), PhoneNumber: phones[rng.IntN(len(phones))], CreatedAt: testStart, ExpiresAt: at()}
+			if err := s.Create(ctx, inv); err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, inv.ID)
+		case n < 6:
+			phone := phones[rng.IntN(len(phones))]
+			s.Update(ctx, ids[rng.IntN(len(ids))], func(inv *Invitation) error {
+				inv.PhoneNumber = phone
+				return nil
+			})
+		case n < 8:
+			exp := at()
+			s.Update(ctx, ids[rng.IntN(len(ids))], func(inv *Invitation) error {
+				inv.ExpiresAt, inv.Status = exp, statusExpired
+				return nil
+			})
+		case n < 9:
+			s.Delete(ctx, ids[rng.IntN(len(ids))])
+		default:
+			if _, err := s.DeleteExpired(ctx, testStart.Add(time.Duration(rng.IntN(30))*time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	all, err := s.List(ctx, ListFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) == 0 {
+		t.Fatal("nothing left to check")
+	}
+	scan := func(keep func(Invitation) bool) []string {
+		var want []string
+		for _, inv := range all {
+			if keep(inv) {
+				want = append(want, inv.ID)
+			}
+		}
+		return want
+	}
+	listed := func(f ListFilter) []string {
+		invs, err := s.List(ctx, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, inv := range invs {
+			got = append(got, inv.ID)
+		}
+		return got
+	}
+
+	for _, phone := range phones {
+		want := scan(func(inv Invitation) bool { return inv.PhoneNumber == phone })
+		if got := listed(ListFilter{PhoneNumber: phone}); !slices.Equal(got, want) {
+			t.Errorf("by phone %s: index has %v, scan %v", phone, got, want)
+		}
+	}
+	for _, w := range [][2]time.Duration{{0, 45 * time.Minute}, {60 * time.Minute, 61 * time.Minute}, {90 * time.Minute, 4 * time.Hour}} {
+		after, before := testStart.Add(w[0]), testStart.Add(w[1])
+		want := scan(func(inv Invitation) bool { return !inv.ExpiresAt.Before(after) && inv.ExpiresAt.Before(before) })
+		if got := listed(ListFilter{ExpiresAfter: after, ExpiresBefore: before}); !slices.Equal(got, want) {
+			t.Errorf("expiring in [%v, %v): index has %v, scan %v", w[0], w[1], got, want)
+		}
+	}
+
+	// Nothing is left in an index that isn't stored as indexed.
+	for i := range s.shards {
+		sh := &s.shards[i]
+		for phone, set := range sh.byPhone {
+			for id := range set {
+				if inv, ok := sh.invitations[id]; !ok || inv.PhoneNumber != phone {
+					t.Errorf("phone index has %s under %s", id, phone)
+				}
+			}
+		}
+		for b, set := range sh.byExpiry {
+			for id := range set {
+				if inv, ok := sh.invitations[id]; !ok || expiryBucket(inv.ExpiresAt) != b {
+					t.Errorf("expiry index has %s under %d", id, b)
+				}
+			}
+		}
+	}
+}
+
+// Delivery updates write into the invitation's messages and delivery map;
+// under -race this fails if those are shared with copies read before.
+func TestDeliveryUpdatesDontRaceReaders(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	inv := ts.create(invite("+14155550101"))
+	ts.drainOutbox()
+	sent := ts.get(inv.ID).Messages[0]
+	if err := putRecord(ctx, ts.store, messageKind, "SM1", messageRecord{InvitationID: inv.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 200 {
+			got, err := ts.store.Get(ctx, inv.ID)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if _, err := json.Marshal(got); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	m := outboundMessage{ID: sent.ID, InvitationID: inv.ID, Channel: sent.Channel}
+	for range 200 {
+		ts.setMessageStatus(ctx, m, DeliveryStatus{Status: deliverySent, MessageID: "SM1"})
+		if err := ts.advanceDelivery(ctx, "SM1", deliveryDelivered, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+
+	got := ts.get(inv.ID)
+	if got.Messages[0].Status != deliveryDelivered || got.Delivery[sent.Channel].Status != deliveryDelivered {
+		t.Errorf("messages %+v, delivery %+v; want delivered", got.Messages, got.Delivery)
+	}
+}
+
+// benchmarkStore runs fn, as "invitation-api bench-store" does, against a
+// seeded store with one lock over everything and against the sharded
+// default.
+func benchmarkStore(b *testing.B, fn func(*testing.B, *memoryStore, []string)) {
+	for _, shards := range []int{1, memoryShards} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			st, ids := seededStore(shards, 10000)
+			b.ResetTimer()
+			fn(b, st, ids)
+		})
+	}
+}
+
+func BenchmarkMemoryStoreCreate(b *testing.B)  { benchmarkStore(b, benchCreate) }
+func BenchmarkMemoryStoreGet(b *testing.B)     { benchmarkStore(b, benchGet) }
+func BenchmarkMemoryStoreRespond(b *testing.B) { benchmarkStore(b, benchRespond) }
+func BenchmarkMemoryStoreMixed(b *testing.B)   { benchmarkStore(b, benchMixed) }
+func BenchmarkMemoryStoreSweep(b *testing.B)   { benchmarkStore(b, benchSweep) }
@@ -0,0 +1,557 @@
+package invitations
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// redisStore keeps each invitation as a JSON string, with sorted sets
+// ordering them by creation and expiry and sets indexing phone numbers and
+// batches. Writes go through WATCH and MULTI so the indexes change with the
+// document or not at all. Several API instances can share one; it also
+// provides the distributed locks and live event relay they need to.
+//
+// With a TTL, Redis drops an invitation and its events that long after it
+// expires. Index entries left behind are cleaned up when a read finds them
+// dangling.
+type redisStore struct {
+	c   *redisClient
+	ttl time.Duration
+}
+
+const (
+	redisPrefix     = "invit:"
+	redisCreatedKey = redisPrefix + "created" // members are createdMember(inv), all scored 0
+	redisExpiryKey  = redisPrefix + "expiry"  // members are IDs, scored by expiry in Unix ms
+	redisLiveKey    = redisPrefix + "live"
+
+	redisLockTTL  = 10 * time.Second
+	redisPageSize = 500
+)
+
+func redisInvKey(id string) string       { return redisPrefix + "inv:" + id }
+func redisEventsKey(id string) string    { return redisPrefix + "events:" + id }
+func redisPhoneKey(phone string) string  { return redisPrefix + "phone:" + phone }
+func redisBatchKey(id string) string     { return redisPrefix + "batch:" + id }
+func redisRecordsKey(kind string) string { return redisPrefix + "records:" + kind }
+func redisLockKey(key string) string     { return redisPrefix + "lock:" + key }
+func redisLeaseKey(name string) string   { return redisPrefix + "lease:" + name }
+
+// createdMember sorts by creation time then ID when compared bytewise.
+func createdMember(createdAt time.Time, id string) string {
+	return fmt.Sprintf("%020d|%s", createdAt.UnixNano(), id)
+}
+
+// openRedisStore connects to dsn, a redis:// URL that may carry a ttl
+// query parameter such as ?ttl=720h.
+func openRedisStore(dsn string) (*redisStore, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+	s := &redisStore{}
+	q := u.Query()
+	if ttl := q.Get("ttl"); ttl != "" {
+		if s.ttl, err = time.ParseDuration(ttl); err != nil || s.ttl < 0 {
+			return nil, fmt.Errorf("invalid redis ttl %q", ttl)
+		}
+		q.Del("ttl")
+		u.RawQuery = q.Encode()
+	}
+	if s.c, err = newRedisClient(u.String()); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisDialTimeout)
+	defer cancel()
+	if err := s.Ping(ctx); err != nil {
+		s.c.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *redisStore) Create(ctx context.Context, inv Invitation) error {
+	return s.c.withConn(ctx, func(rc *redisConn) error {
+		if _, err := rc.do(ctx, "WATCH", redisInvKey(inv.ID)); err != nil {
+			return err
+		}
+		n, err := redisInt(rc.do(ctx, "EXISTS", redisInvKey(inv.ID)))
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return errDuplicateID
+		}
+		return s.save(ctx, rc, nil, inv)
+	})
+}
+
+func (s *redisStore) Get(ctx context.Context, id string) (Invitation, error) {
+	data, err := redisBytes(s.c.do(ctx, "GET", redisInvKey(id)))
+	if err == errRedisNil {
+		return Invitation{}, errNotFound
+	}
+	if err != nil {
+		return Invitation{}, err
+	}
+	var inv Invitation
+	err = json.Unmarshal(data, &inv)
+	return inv, err
+}
+
+var errConcurrentUpdate = errors.New("invitation changed concurrently")
+
+// Update holds the invitation's lock while fn runs, so fn runs once and
+// sees the latest version. The WATCH only matters if the lock lapses.
+func (s *redisStore) Update(ctx context.Context, id string, fn func(*Invitation) error) (Invitation, error) {
+	unlock, err := s.lock(ctx, "inv:"+id)
+	if err != nil {
+		return Invitation{}, err
+	}
+	defer unlock()
+	var inv Invitation
+	err = s.c.withConn(ctx, func(rc *redisConn) error {
+		if _, err := rc.do(ctx, "WATCH", redisInvKey(id)); err != nil {
+			return err
+		}
+		data, err := redisBytes(rc.do(ctx, "GET", redisInvKey(id)))
+		if err == errRedisNil {
+			return errNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &inv); err != nil {
+			return err
+		}
+		old := inv
+		if err := fn(&inv); err != nil {
+			return err
+		}
+		inv.Version++
+		return s.save(ctx, rc, &old, inv)
+	})
+	if err != nil {
+		return Invitation{}, err
+	}
+	return inv, nil
+}
+
+// save writes inv and its index entries in one transaction on rc, which
+// must be watching the invitation's key. old is the version being
+// replaced, if any.
+func (s *redisStore) save(ctx context.Context, rc *redisConn, old *Invitation, inv Invitation) error {
+	data, err := json.Marshal(inv)
+	if err != nil {
+		return err
+	}
+	cmds := [][]any{{"SET", redisInvKey(inv.ID), data}}
+	if s.ttl > 0 {
+		at := inv.ExpiresAt.Add(s.ttl).UnixMilli()
+		cmds = append(cmds,
+			[]any{"PEXPIREAT", redisInvKey(inv.ID), at},
+			[]any{"PEXPIREAT", redisEventsKey(inv.ID), at})
+	}
+	if old != nil {
+		if old.PhoneNumber != inv.PhoneNumber {
+			cmds = append(cmds, []any{"SREM", redisPhoneKey(old.PhoneNumber), inv.ID})
+		}
+		if old.BatchID != inv.BatchID && old.BatchID != "" {
+			cmds = append(cmds, []any{"SREM", redisBatchKey(old.BatchID), inv.ID})
+		}
+		if !old.CreatedAt.Equal(inv.CreatedAt) {
+			cmds = append(cmds, []any{"ZREM", redisCreatedKey, createdMember(old.CreatedAt, inv.ID)})
+		}
+	}
+	cmds = append(cmds,
+		[]any{"ZADD", redisCreatedKey, 0, createdMember(inv.CreatedAt, inv.ID)},
+		[]any{"ZADD", redisExpiryKey, inv.ExpiresAt.UnixMilli(), inv.ID},
+		[]any{"SADD", redisPhoneKey(inv.PhoneNumber), inv.ID})
+	if inv.BatchID != "" {
+		cmds = append(cmds, []any{"SADD", redisBatchKey(inv.BatchID), inv.ID})
+	}
+	return exec(ctx, rc, cmds)
+}
+
+// exec runs cmds as a MULTI/EXEC transaction, failing with
+// errConcurrentUpdate if a watched key changed first.
+func exec(ctx context.Context, rc *redisConn, cmds [][]any) error {
+	if _, err := rc.do(ctx, "MULTI"); err != nil {
+		return err
+	}
+	for _, cmd := range cmds {
+		if _, err := rc.do(ctx, cmd...); err != nil {
+			return err
+		}
+	}
+	reply, err := rc.do(ctx, "EXEC")
+	if err != nil {
+		return err
+	}
+	results, ok := reply.([]any)
+	if !ok {
+		return errConcurrentUpdate
+	}
+	for _, r := range results {
+		if err, ok := r.(redisError); ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// List reads candidate IDs from the phone or batch index when filtering on
+// one, from the expiry index when there's an upper bound on expiry, and
+// otherwise pages through the creation index from the cursor. Each
+// candidate is matched against the whole filter.
+func (s *redisStore) List(ctx context.Context, f ListFilter) ([]Invitation, error) {
+	var ids []string
+	var err error
+	var index string
+	switch {
+	case f.PhoneNumber != "":
+		index = redisPhoneKey(f.PhoneNumber)
+		ids, err = redisStrings(s.c.do(ctx, "SMEMBERS", index))
+	case f.BatchID != "":
+		index = redisBatchKey(f.BatchID)
+		ids, err = redisStrings(s.c.do(ctx, "SMEMBERS", index))
+	case !f.ExpiresBefore.IsZero():
+		lo := "-inf"
+		if !f.ExpiresAfter.IsZero() {
+			lo = fmt.Sprint(f.ExpiresAfter.UnixMilli())
+		}
+		ids, err = redisStrings(s.c.do(ctx, "ZRANGEBYSCORE", redisExpiryKey, lo, f.ExpiresBefore.UnixMilli()))
+	default:
+		return s.listCreated(ctx, f)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := []Invitation{}
+	err = s.fetch(ctx, ids, func(id string, inv *Invitation) {
+		if inv == nil {
+			if index != "" {
+				s.c.do(ctx, "SREM", index, id)
+			} else {
+				s.c.do(ctx, "ZREM", redisExpiryKey, id)
+			}
+			return
+		}
+		if f.Match(*inv) {
+			result = append(result, *inv)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortInvitations(result)
+	if f.Limit > 0 && len(result) > f.Limit {
+		result = result[:f.Limit]
+	}
+	return result, nil
+}
+
+// listCreated pages through the creation index in order, stopping once it
+// has a full page of matches.
+func (s *redisStore) listCreated(ctx context.Context, f ListFilter) ([]Invitation, error) {
+	lo, hi := "-", "+"
+	if !f.CreatedAfter.IsZero() {
+		lo = "[" + createdMember(f.CreatedAfter, "")
+	}
+	if f.After != nil {
+		if after := "(" + createdMember(f.After.CreatedAt, f.After.ID); lo == "-" || after[1:] > lo[1:] {
+			lo = after
+		}
+	}
+	if !f.CreatedBefore.IsZero() {
+		hi = "(" + createdMember(f.CreatedBefore, "")
+	}
+	result := []Invitation{}
+	for {
+		members, err := redisStrings(s.c.do(ctx, "ZRANGEBYLEX", redisCreatedKey, lo, hi, "LIMIT", 0, redisPageSize))
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]string, len(members))
+		member := make(map[string]string, len(members))
+		for i, m := range members {
+			_, ids[i], _ = strings.Cut(m, "|")
+			member[ids[i]] = m
+		}
+		err = s.fetch(ctx, ids, func(id string, inv *Invitation) {
+			if inv == nil {
+				s.c.do(ctx, "ZREM", redisCreatedKey, member[id])
+				return
+			}
+			if (f.Limit == 0 || len(result) < f.Limit) && f.Match(*inv) {
+				result = append(result, *inv)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(members) < redisPageSize || f.Limit > 0 && len(result) >= f.Limit {
+			return result, nil
+		}
+		lo = "(" + members[len(members)-1]
+	}
+}
+
+// fetch loads ids in pages, calling fn with each in the order given and a
+// nil invitation for any that no longer exist.
+func (s *redisStore) fetch(ctx context.Context, ids []string, fn func(string, *Invitation)) error {
+	for len(ids) > 0 {
+		page := ids[:min(len(ids), redisPageSize)]
+		ids = ids[len(page):]
+		args := []any{"MGET"}
+		for _, id := range page {
+			args = append(args, redisInvKey(id))
+		}
+		reply, err := s.c.do(ctx, args...)
+		if err != nil {
+			return err
+		}
+		docs, _ := reply.([]any)
+		for i, id := range page {
+			data, ok := docs[i].([]byte)
+			if !ok {
+				fn(id, nil)
+				continue
+			}
+			var inv Invitation
+			if err := json.Unmarshal(data, &inv); err != nil {
+				return err
+			}
+			fn(id, &inv)
+		}
+	}
+	return nil
+}
+
+// Stats totals a List, as Redis can't aggregate the JSON it keeps.
+func (s *redisStore) Stats(ctx context.Context, f StatsFilter) (InvitationStats, error) {
+	invs, err := s.List(ctx, f.list())
+	if err != nil {
+		return InvitationStats{}, err
+	}
+	c := newStatsCounter(f.AsOf)
+	for _, inv := range invs {
+		c.add(inv)
+	}
+	return c.result(), nil
+}
+
+func (s *redisStore) DeleteExpired(ctx context.Context, before time.Time) (int, error) {
+	ids, err := redisStrings(s.c.do(ctx, "ZRANGEBYSCORE", redisExpiryKey, "-inf", "("+fmt.Sprint(before.UnixMilli())))
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, id := range ids {
+		switch err := s.Delete(ctx, id); err {
+		case nil:
+			n++
+		case errNotFound:
+			// Dropped by its TTL; the index entry is all that's left.
+			s.c.do(ctx, "ZREM", redisExpiryKey, id)
+		default:
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (s *redisStore) Delete(ctx context.Context, id string) error {
+	return s.c.withConn(ctx, func(rc *redisConn) error {
+		if _, err := rc.do(ctx, "WATCH", redisInvKey(id)); err != nil {
+			return err
+		}
+		data, err := redisBytes(rc.do(ctx, "GET", redisInvKey(id)))
+		if err == errRedisNil {
+			return errNotFound
+		}
+		if err != nil {
+			return err
+		}
+		var inv Invitation
+		if err := json.Unmarshal(data, &inv); err != nil {
+			return err
+		}
+		cmds := [][]any{
+			{"DEL", redisInvKey(id), redisEventsKey(id)},
+			{"ZREM", redisCreatedKey, createdMember(inv.CreatedAt, id)},
+			{"ZREM", redisExpiryKey, id},
+			{"SREM", redisPhoneKey(inv.PhoneNumber), id},
+		}
+		if inv.BatchID != "" {
+			cmds = append(cmds, []any{"SREM", redisBatchKey(inv.BatchID), id})
+		}
+		return exec(ctx, rc, cmds)
+	})
+}
+
+// appendEventScript gives the event log the invitation's remaining TTL.
+const appendEventScript = `
+redis.call('RPUSH', KEYS[1], ARGV[1])
+local ttl = redis.call('PTTL', KEYS[2])
+if ttl > 0 then redis.call('PEXPIRE', KEYS[1], ttl) end
+return 1`
+
+func (s *redisStore) AppendEvent(ctx context.Context, id string, ev InvitationEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = s.c.do(ctx, "EVAL", appendEventScript, 2, redisEventsKey(id), redisInvKey(id), data)
+	return err
+}
+
+func (s *redisStore) Events(ctx context.Context, id string) ([]InvitationEvent, error) {
+	items, err := redisStrings(s.c.do(ctx, "LRANGE", redisEventsKey(id), 0, -1))
+	if err != nil {
+		return nil, err
+	}
+	events := make([]InvitationEvent, 0, len(items))
+	for _, item := range items {
+		var ev InvitationEvent
+		if err := json.Unmarshal([]byte(item), &ev); err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+func (s *redisStore) DeleteEvents(ctx context.Context, id string) error {
+	_, err := s.c.do(ctx, "DEL", redisEventsKey(id))
+	return err
+}
+
+func (s *redisStore) PutRecord(ctx context.Context, kind, id string, data []byte) error {
+	_, err := s.c.do(ctx, "HSET", redisRecordsKey(kind), id, data)
+	return err
+}
+
+func (s *redisStore) GetRecord(ctx context.Context, kind, id string) ([]byte, error) {
+	data, err := redisBytes(s.c.do(ctx, "HGET", redisRecordsKey(kind), id))
+	if err == errRedisNil {
+		return nil, errNotFound
+	}
+	return data, err
+}
+
+func (s *redisStore) ListRecords(ctx context.Context, kind string) ([][]byte, error) {
+	fields, err := redisStrings(s.c.do(ctx, "HGETALL", redisRecordsKey(kind)))
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string][]byte, len(fields)/2)
+	ids := make([]string, 0, len(fields)/2)
+	for i := 0; i+1 < len(fields); i += 2 {
+		ids = append(ids, fields[i])
+		byID[fields[i]] = []byte(fields[i+1])
+	}
+	sort.Strings(ids)
+	result := make([][]byte, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, byID[id])
+	}
+	return result, nil
+}
+
+func (s *redisStore) DeleteRecord(ctx context.Context, kind, id string) error {
+	n, err := redisInt(s.c.do(ctx, "HDEL", redisRecordsKey(kind), id))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+func (s *redisStore) Ping(ctx context.Context) error {
+	_, err := s.c.do(ctx, "PING")
+	return err
+}
+
+func (s *redisStore) Close() error { return s.c.Close() }
+
+// unlockScript deletes a lock only if it still holds our token, so a lock
+// that lapsed and was taken by another instance is left alone.
+const unlockScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then return redis.call('DEL', KEYS[1]) end
+return 0`
+
+// lock takes key across every instance sharing the store, waiting until it
+// is free or ctx is done. Locks lapse after redisLockTTL if their holder
+// dies.
+func (s *redisStore) lock(ctx context.Context, key string) (func(), error) {
+	b := make([]byte, 16)
+	rand.Read(b)
+	token := hex.EncodeToString(b)
+	wait := 5 * time.Millisecond
+	for {
+		reply, err := s.c.do(ctx, "SET", redisLockKey(key), token, "NX", "PX", redisLockTTL.Milliseconds())
+		if err != nil {
+			return nil, err
+		}
+		if reply != nil {
+			return func() {
+				ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Second)
+				defer cancel()
+				s.c.do(ctx, "EVAL", unlockScript, 1, redisLockKey(key), token)
+			}, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		wait = min(2*wait, 100*time.Millisecond)
+	}
+}
+
+// leaseScript takes or extends a lease for ARGV[1], which Redis expires
+// after ARGV[2] milliseconds.
+const leaseScript = `
+local holder = redis.call('GET', KEYS[1])
+if holder and holder ~= ARGV[1] then return 0 end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return 1`
+
+func (s *redisStore) acquireLease(ctx context.Context, name, holder string, _ time.Time, ttl time.Duration) (bool, error) {
+	n, err := redisInt(s.c.do(ctx, "EVAL", leaseScript, 1, redisLeaseKey(name), holder, ttl.Milliseconds()))
+	return n == 1, err
+}
+
+func (s *redisStore) releaseLease(ctx context.Context, name, holder string) error {
+	_, err := s.c.do(ctx, "EVAL", unlockScript, 1, redisLeaseKey(name), holder)
+	return err
+}
+
+// publishLive and subscribeLive relay live events through Redis so a
+// stream sees changes made through any instance.
+func (s *redisStore) publishLive(ctx context.Context, data []byte) error {
+	_, err := s.c.do(ctx, "PUBLISH", redisLiveKey, data)
+	return err
+}
+
+func (s *redisStore) subscribeLive(ctx context.Context, fn func([]byte)) error {
+	return s.c.subscribe(ctx, redisLiveKey, fn)
+}
+
+// useRedis has s take its locks from rs and relay live events through it,
+// so several instances can serve the same invitations.
+func (s *Server) useRedis(rs *redisStore) {
+	s.locks = rs
+	s.live.relay = rs
+}
@@ -0,0 +1,511 @@
+package invitations
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// sqlStore keeps each invitation as a JSON document alongside the columns
+// that queries filter on, so new fields don't need a schema change.
+type sqlStore struct {
+	db      *sql.DB
+	dialect string
+}
+
+func openSQLStore(dialect, dsn string) (*sqlStore, error) {
+	driver := dialect
+	if dialect == "postgres" {
+		driver = "pgx"
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if dialect == "sqlite" {
+		// SQLite allows a single writer; serializing on one connection
+		// avoids SQLITE_BUSY inside Update transactions.
+		db.SetMaxOpenConns(1)
+	}
+	return &sqlStore{db: db, dialect: dialect}, nil
+}
+
+// addColumn adds a column to an existing table unless it is already there.
+// Rows written before the column existed keep the value only in data, so
+// columns added this way must have a default that matches "unset".
+func (s *sqlStore) addColumn(ctx context.Context, q sqlQuerier, table, column, def string) error {
+	if s.dialect == "postgres" {
+		_, err := q.ExecContext(ctx, `ALTER TABLE `+table+` ADD COLUMN IF NOT EXISTS `+column+` `+def)
+		return err
+	}
+	var n int
+	if err := q.QueryRowContext(ctx, `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`, table, column).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	_, err := q.ExecContext(ctx, `ALTER TABLE `+table+` ADD COLUMN `+column+` `+def)
+	return err
+}
+
+// rebind rewrites ? placeholders to $n for Postgres.
+func (s *sqlStore) rebind(query string) string {
+	if s.dialect != "postgres" {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func (s *sqlStore) Create(ctx context.Context, inv Invitation) error {
+	data, err := json.Marshal(inv)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.ExecContext(ctx, s.rebind(
+		`INSERT INTO invitations (id, phone_number, batch_id, tenant_id, series_id, external_id, created_at, expires_at, data) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO NOTHING`),
+		inv.ID, inv.PhoneNumber, inv.BatchID, inv.TenantID, inv.SeriesID, inv.ExternalID, inv.CreatedAt.UnixNano(), inv.ExpiresAt.UnixNano(), string(data))
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errDuplicateID
+	}
+	return nil
+}
+
+func (s *sqlStore) Get(ctx context.Context, id string) (Invitation, error) {
+	row := s.db.QueryRowContext(ctx, s.rebind(`SELECT data FROM invitations WHERE id = ?`), id)
+	return scanInvitation(row)
+}
+
+func (s *sqlStore) Update(ctx context.Context, id string, fn func(*Invitation) error) (Invitation, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Invitation{}, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT data FROM invitations WHERE id = ?`
+	if s.dialect == "postgres" {
+		query += ` FOR UPDATE`
+	}
+	inv, err := scanInvitation(tx.QueryRowContext(ctx, s.rebind(query), id))
+	if err != nil {
+		return Invitation{}, err
+	}
+	if err := fn(&inv); err != nil {
+		return Invitation{}, err
+	}
+	inv.Version++
+	data, err := json.Marshal(inv)
+	if err != nil {
+		return Invitation{}, err
+	}
+	if _, err := tx.ExecContext(ctx, s.rebind(
+		`UPDATE invitations SET phone_number = ?, batch_id = ?, tenant_id = ?, series_id = ?, external_id = ?, expires_at = ?, data = ? WHERE id = ?`),
+		inv.PhoneNumber, inv.BatchID, inv.TenantID, inv.SeriesID, inv.ExternalID, inv.ExpiresAt.UnixNano(), string(data), id); err != nil {
+		return Invitation{}, err
+	}
+	return inv, tx.Commit()
+}
+
+func (s *sqlStore) List(ctx context.Context, f ListFilter) ([]Invitation, error) {
+	var where []string
+	var args []any
+	if f.PhoneNumber != "" {
+		where = append(where, `phone_number = ?`)
+		args = append(args, f.PhoneNumber)
+	}
+	if f.BatchID != "" {
+		where = append(where, `batch_id = ?`)
+		args = append(args, f.BatchID)
+	}
+	if f.SeriesID != "" {
+		where = append(where, `series_id = ?`)
+		args = append(args, f.SeriesID)
+	}
+	if f.ExternalID != "" {
+		where = append(where, `external_id = ?`)
+		args = append(args, f.ExternalID)
+	}
+	if f.Tag != "" {
+		where = append(where, s.hasTag())
+		args = append(args, f.Tag)
+	}
+	if f.TenantID != nil {
+		where = append(where, `tenant_id = ?`)
+		args = append(args, *f.TenantID)
+	}
+	if !f.CreatedAfter.IsZero() {
+		where = append(where, `created_at >= ?`)
+		args = append(args, f.CreatedAfter.UnixNano())
+	}
+	if !f.CreatedBefore.IsZero() {
+		where = append(where, `created_at < ?`)
+		args = append(args, f.CreatedBefore.UnixNano())
+	}
+	if !f.ExpiresAfter.IsZero() {
+		where = append(where, `expires_at >= ?`)
+		args = append(args, f.ExpiresAfter.UnixNano())
+	}
+	if !f.ExpiresBefore.IsZero() {
+		where = append(where, `expires_at < ?`)
+		args = append(args, f.ExpiresBefore.UnixNano())
+	}
+	if f.After != nil {
+		ts := f.After.CreatedAt.UnixNano()
+		where = append(where, `(created_at > ? OR (created_at = ? AND id > ?))`)
+		args = append(args, ts, ts, f.After.ID)
+	}
+	query := `SELECT data FROM invitations`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+	query += ` ORDER BY created_at, id`
+	// Status depends on the clock, so it is filtered here rather than in SQL
+	// and the limit can only be pushed down when no status is requested.
+	if f.Limit > 0 && f.Status == "" {
+		query += ` LIMIT ` + strconv.Itoa(f.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []Invitation{}
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		if !f.Match(inv) {
+			continue
+		}
+		result = append(result, inv)
+		if f.Limit > 0 && len(result) == f.Limit {
+			break
+		}
+	}
+	return result, rows.Err()
+}
+
+// jsonField is the text of the top-level field name of an invitation's data,
+// or NULL when it is absent.
+func (s *sqlStore) jsonField(name string) string {
+	if s.dialect == "postgres" {
+		return `(data::jsonb ->> '` + name + `')`
+	}
+	return `json_extract(data, '$.` + name + `')`
+}
+
+// hasTag matches invitations with the tag given as its argument.
+func (s *sqlStore) hasTag() string {
+	if s.dialect == "postgres" {
+		return `EXISTS (SELECT 1 FROM jsonb_array_elements_text(invitations.data::jsonb -> 'tags') t WHERE t = ?)`
+	}
+	return `EXISTS (SELECT 1 FROM json_each(invitations.data, '$.tags') t WHERE t.value = ?)`
+}
+
+// respondedAt is the time responded_at holds, in milliseconds since the
+// epoch, and respondedHour its hour in UTC.
+func (s *sqlStore) respondedAt() (ms, hour string) {
+	if s.dialect == "postgres" {
+		t := s.jsonField("responded_at") + `::timestamptz`
+		return `CAST(EXTRACT(EPOCH FROM ` + t + `) * 1000 AS BIGINT)`, `CAST(EXTRACT(HOUR FROM ` + t + ` AT TIME ZONE 'UTC') AS INTEGER)`
+	}
+	t := s.jsonField("responded_at")
+	return `CAST(ROUND((julianday(` + t + `) - 2440587.5) * 86400000) AS BIGINT)`, `CAST(strftime('%H', ` + t + `) AS INTEGER)`
+}
+
+// Stats aggregates in the database, so only the counts come back rather
+// than every invitation of the period.
+func (s *sqlStore) Stats(ctx context.Context, f StatsFilter) (InvitationStats, error) {
+	st := InvitationStats{Deliveries: map[string]map[string]int{}}
+	status := `COALESCE(` + s.jsonField("status") + `, '')`
+	response := `COALESCE(` + s.jsonField("response") + `, '')`
+	where := `created_at >= ? AND created_at < ? AND ` + status + ` <> '` + statusScheduled + `' AND NOT COALESCE(CAST(` + s.jsonField("test") + ` AS BOOLEAN), FALSE)`
+	args := []any{f.From.UnixNano(), f.To.UnixNano()}
+	if f.TenantID != nil {
+		where += ` AND tenant_id = ?`
+		args = append(args, *f.TenantID)
+	}
+	if f.Tag != "" {
+		where += ` AND ` + s.hasTag()
+		args = append(args, f.Tag)
+	}
+	responded := where + ` AND ` + response + ` <> ''`
+	// A zero viewed_at is still written out, as time.Time isn't omitted.
+	viewed := `COALESCE(` + s.jsonField("viewed_at") + `, '') NOT IN ('', '0001-01-01T00:00:00Z')`
+
+	// Mirrors withStatus: only an unanswered invitation can expire, and a
+	// cancellation stands whatever else it has.
+	err := s.db.QueryRowContext(ctx, s.rebind(`SELECT COUNT(*),
+		COALESCE(SUM(CASE WHEN `+response+` <> '' THEN 1 ELSE 0 END), 0),
+		COALESCE(SUM(CASE WHEN `+status+` = '`+statusCancelled+`' THEN 1 ELSE 0 END), 0),
+		COALESCE(SUM(CASE WHEN `+status+` <> '`+statusCancelled+`' AND `+response+` = '' AND (`+status+` = '`+statusExpired+`' OR expires_at < ?) THEN 1 ELSE 0 END), 0),
+		COALESCE(SUM(CASE WHEN `+viewed+` THEN 1 ELSE 0 END), 0)
+		FROM invitations WHERE `+where), append([]any{f.AsOf.UnixNano()}, args...)...).Scan(&st.Invitations, &st.Responded, &st.Cancelled, &st.Expired, &st.Viewed)
+	if err != nil {
+		return st, err
+	}
+
+	ms, hour := s.respondedAt()
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT `+hour+`, COUNT(*) FROM invitations WHERE `+responded+` GROUP BY 1`), args...)
+	if err != nil {
+		return st, err
+	}
+	for rows.Next() {
+		var h, n int
+		if err := rows.Scan(&h, &n); err != nil {
+			rows.Close()
+			return st, err
+		}
+		if h >= 0 && h < 24 {
+			st.ResponsesByHour[h] = n
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return st, err
+	}
+
+	if n := st.Responded; n > 0 {
+		// The middle one or two response times.
+		rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT `+ms+` - created_at / 1000000 AS rt FROM invitations WHERE `+responded+
+			` ORDER BY rt LIMIT `+strconv.Itoa(2-n%2)+` OFFSET `+strconv.Itoa((n-1)/2)), args...)
+		if err != nil {
+			return st, err
+		}
+		var sum, k int64
+		for rows.Next() {
+			var rt int64
+			if err := rows.Scan(&rt); err != nil {
+				rows.Close()
+				return st, err
+			}
+			sum, k = sum+rt, k+1
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return st, err
+		}
+		if k > 0 {
+			st.MedianResponse = time.Duration(sum/k) * time.Millisecond
+		}
+	}
+
+	each, deliveryStatus := `json_each(invitations.data, '$.delivery') d`, `json_extract(d.value, '$.status')`
+	if s.dialect == "postgres" {
+		each, deliveryStatus = `jsonb_each(invitations.data::jsonb -> 'delivery') d`, `(d.value ->> 'status')`
+	}
+	rows, err = s.db.QueryContext(ctx, s.rebind(`SELECT d.key, COALESCE(`+deliveryStatus+`, ''), COUNT(*) FROM invitations, `+each+
+		` WHERE `+where+` GROUP BY 1, 2`), args...)
+	if err != nil {
+		return st, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ch, status string
+		var n int
+		if err := rows.Scan(&ch, &status, &n); err != nil {
+			return st, err
+		}
+		if st.Deliveries[ch] == nil {
+			st.Deliveries[ch] = map[string]int{}
+		}
+		st.Deliveries[ch][status] = n
+	}
+	return st, rows.Err()
+}
+
+func (s *sqlStore) DeleteExpired(ctx context.Context, before time.Time) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	cutoff := before.UnixNano()
+	if _, err := tx.ExecContext(ctx, s.rebind(
+		`DELETE FROM invitation_events WHERE invitation_id IN (SELECT id FROM invitations WHERE expires_at < ?)`),
+		cutoff); err != nil {
+		return 0, err
+	}
+	res, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM invitations WHERE expires_at < ?`), cutoff)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(n), tx.Commit()
+}
+
+func (s *sqlStore) Delete(ctx context.Context, id string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM invitation_events WHERE invitation_id = ?`), id); err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, s.rebind(`DELETE FROM invitations WHERE id = ?`), id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return errNotFound
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) AppendEvent(ctx context.Context, id string, ev InvitationEvent) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, s.rebind(
+		`INSERT INTO invitation_events (invitation_id, data) VALUES (?, ?)`), id, string(data))
+	return err
+}
+
+func (s *sqlStore) Events(ctx context.Context, id string) ([]InvitationEvent, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(
+		`SELECT data FROM invitation_events WHERE invitation_id = ? ORDER BY id`), id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []InvitationEvent{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var ev InvitationEvent
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			return nil, err
+		}
+		result = append(result, ev)
+	}
+	return result, rows.Err()
+}
+
+func (s *sqlStore) DeleteEvents(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(`DELETE FROM invitation_events WHERE invitation_id = ?`), id)
+	return err
+}
+
+func (s *sqlStore) PutRecord(ctx context.Context, kind, id string, data []byte) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(
+		`INSERT INTO records (kind, id, data) VALUES (?, ?, ?)
+		ON CONFLICT (kind, id) DO UPDATE SET data = excluded.data`), kind, id, string(data))
+	return err
+}
+
+func (s *sqlStore) GetRecord(ctx context.Context, kind, id string) ([]byte, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, s.rebind(`SELECT data FROM records WHERE kind = ? AND id = ?`), kind, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errNotFound
+	}
+	return []byte(data), err
+}
+
+func (s *sqlStore) ListRecords(ctx context.Context, kind string) ([][]byte, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(`SELECT data FROM records WHERE kind = ? ORDER BY id`), kind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result [][]byte
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		result = append(result, []byte(data))
+	}
+	return result, rows.Err()
+}
+
+func (s *sqlStore) DeleteRecord(ctx context.Context, kind, id string) error {
+	res, err := s.db.ExecContext(ctx, s.rebind(`DELETE FROM records WHERE kind = ? AND id = ?`), kind, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errNotFound
+	}
+	return err
+}
+
+// acquireLease relies on the upsert only touching the row when the lease
+// is free, expired or already holder's.
+func (s *sqlStore) acquireLease(ctx context.Context, name, holder string, now time.Time, ttl time.Duration) (bool, error) {
+	res, err := s.db.ExecContext(ctx, s.rebind(
+		`INSERT INTO leases (name, holder, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET holder = excluded.holder, expires_at = excluded.expires_at
+		WHERE leases.holder = excluded.holder OR leases.expires_at < ?`),
+		name, holder, now.Add(ttl).UnixNano(), now.UnixNano())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *sqlStore) releaseLease(ctx context.Context, name, holder string) error {
+	_, err := s.db.ExecContext(ctx, s.rebind(`DELETE FROM leases WHERE name = ? AND holder = ?`), name, holder)
+	return err
+}
+
+func (s *sqlStore) Ping(ctx context.Context) error { return s.db.PingContext(ctx) }
+func (s *sqlStore) Close() error                   { return s.db.Close() }
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanInvitation(row rowScanner) (Invitation, error) {
+	var data string
+	if err := row.Scan(&data); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Invitation{}, errNotFound
+		}
+		return Invitation{}, err
+	}
+	var inv Invitation
+	err := json.Unmarshal([]byte(data), &inv)
+	return inv, err
+}
@@ -0,0 +1,114 @@
+package invitations
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const suppressionKind = "suppression"
+
+// suppression records that a phone number has opted out of SMS, either by
+// texting STOP or through the admin API. Opt-outs apply to the sending
+// number, so the list is shared by every tenant.
+type suppression struct {
+	PhoneNumber string    `json:"phone_number"`
+	Source      string    `json:"source"` // sms or admin
+	Reason      string    `json:"reason,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+var errOptedOut = errors.New("phone number has opted out of SMS")
+
+// stopWords and startWords are the carrier-standard opt-out and opt-in
+// keywords, matched against the whole reply.
+var (
+	stopWords  = []string{"stop", "stopall", "unsubscribe", "cancel", "end", "quit"}
+	startWords = []string{"start", "unstop"}
+)
+
+func isKeyword(words []string, body string) bool {
+	body = strings.ToLower(strings.TrimSpace(body))
+	for _, w := range words {
+		if body == w {
+			return true
+		}
+	}
+	return false
+}
+
+// suppressed reports whether phone has opted out of SMS.
+func (s *Server) suppressed(ctx context.Context, phone string) (bool, error) {
+	_, err := s.store.GetRecord(ctx, suppressionKind, phone)
+	if err == errNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *Server) suppress(ctx context.Context, phone, source, reason string) (suppression, error) {
+	sp := suppression{PhoneNumber: phone, Source: source, Reason: reason, CreatedAt: s.now().UTC()}
+	if err := putRecord(ctx, s.store, suppressionKind, phone, sp); err != nil {
+		return sp, err
+	}
+	slog.InfoContext(ctx, "phone number suppressed", "phone", maskPhone(phone), "source", source)
+	return sp, nil
+}
+
+func (s *Server) unsuppress(ctx context.Context, phone string) error {
+	err := s.store.DeleteRecord(ctx, suppressionKind, phone)
+	if err == nil {
+		slog.InfoContext(ctx, "phone number unsuppressed", "phone", maskPhone(phone))
+	}
+	return err
+}
+
+func (s *Server) handleListSuppressions(w http.ResponseWriter, r *http.Request) {
+	list, err := listRecords[suppression](r.Context(), s.store, suppressionKind)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if list == nil {
+		list = []suppression{}
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) handleAddSuppression(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		PhoneNumber string `json:"phone_number"`
+		Reason      string `json:"reason"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	phone, err := normalizePhone(req.PhoneNumber, s.cfg.DefaultCountry)
+	if err != nil {
+		writeResponseError(w, r, phoneError(err))
+		return
+	}
+	sp, err := s.suppress(r.Context(), phone, "admin", strings.TrimSpace(req.Reason))
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, sp)
+}
+
+func (s *Server) handleRemoveSuppression(w http.ResponseWriter, r *http.Request) {
+	err := s.unsuppress(r.Context(), s.lookupPhone(r.PathValue("phone")))
+	if err == errNotFound {
+		writeError(w, r, http.StatusNotFound, "phone number is not suppressed")
+		return
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
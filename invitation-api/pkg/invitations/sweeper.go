@@ -0,0 +1,138 @@
+package invitations
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// onExpire registers fn to be called by the sweeper for every invitation it
+// marks expired.
+func (s *Server) onExpire(fn func(context.Context, Invitation)) {
+	s.expiryMu.Lock()
+	defer s.expiryMu.Unlock()
+	s.expiryCallbacks = append(s.expiryCallbacks, fn)
+}
+
+var errSkip = errors.New("skip")
+
+// runSweeper marks invitations expired once their deadline passes without a
+// response. Each pass only looks at invitations that expired since the
+// previous one; the first pass covers everything already overdue.
+func (s *Server) runSweeper(ctx context.Context, interval time.Duration) {
+	ticks, stop := s.clock.NewTicker(interval)
+	defer stop()
+
+	var since time.Time
+	for {
+		until := s.now()
+		pass, span := tracer.Start(withJobID(ctx, "sweep"), "sweeper.pass")
+		err := s.sweepExpired(pass, since, until)
+		endSpan(span, err)
+		if err != nil {
+			slog.ErrorContext(pass, "expiry sweep failed", "err", err)
+		} else {
+			since = until
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticks:
+		}
+	}
+}
+
+func (s *Server) sweepExpired(ctx context.Context, since, until time.Time) error {
+	candidates, err := s.store.List(ctx, ListFilter{ExpiresAfter: since, ExpiresBefore: until})
+	if err != nil {
+		return err
+	}
+	for _, c := range candidates {
+		if c.Response != "" || c.Status != "" || !c.ForwardedAt.IsZero() {
+			continue
+		}
+		var action, from string
+		var extended Change
+		inv, err := s.store.Update(ctx, c.ID, func(inv *Invitation) error {
+			if inv.Response != "" || inv.Status != "" || !inv.ForwardedAt.IsZero() || !inv.ExpiresAt.Before(until) {
+				return errSkip
+			}
+			action = inv.OnExpire.firing()
+			// As it stood before the deadline.
+			from = inv.withStatus(time.Time{}).Status
+			t := s.now()
+			switch action {
+			case expireAutoDecline:
+				inv.Response, _ = matchResponse(inv.options(), "no")
+				inv.RespondedAt = t.UTC()
+			case expireExtendOnce:
+				d := time.Duration(inv.OnExpire.ExtendMin) * time.Minute
+				exp := inv.ExpiresAt.Add(d)
+				if !exp.After(t) {
+					exp = t.Add(d)
+				}
+				extended = Change{"expires_at", inv.ExpiresAt.UTC().Format(time.RFC3339), exp.UTC().Format(time.RFC3339)}
+				p := *inv.OnExpire
+				p.ExtendedAt = t.UTC()
+				inv.OnExpire, inv.ExpiresAt = &p, exp
+				rescheduleReminders(inv, t)
+				return s.renderMessage(inv)
+			default:
+				inv.Status = statusExpired
+			}
+			return nil
+		})
+		if err == errSkip {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		switch action {
+		case expireAutoDecline:
+			s.autoDecline(ctx, inv, from)
+		case expireExtendOnce:
+			s.record(ctx, inv, InvitationEvent{Type: historyExtended, Actor: "system", Changes: []Change{extended}, OnExpire: action})
+			s.notifyInvitee(ctx, inv, localize(inv.Locale, "update", s.inviteText(inv)))
+		default:
+			s.expire(ctx, inv)
+		}
+	}
+	return nil
+}
+
+// autoDecline follows up a no recorded by an auto_decline policy as it
+// would one from the invitee, short of confirming it to them.
+func (s *Server) autoDecline(ctx context.Context, inv Invitation, from string) {
+	slog.InfoContext(ctx, "invitation declined on expiry", "invitation_id", inv.ID)
+	s.record(ctx, inv, InvitationEvent{Type: historyResponded, Actor: "system", From: from, To: inv.withStatus(s.now()).Status, Response: inv.Response, OnExpire: expireAutoDecline})
+	s.pushHosts(ctx, inv)
+	if inv.BatchID != "" {
+		s.settleBatch(ctx, inv)
+	}
+	s.notifyHostResponse(ctx, inv)
+}
+
+func (s *Server) expire(ctx context.Context, inv Invitation) {
+	slog.InfoContext(ctx, "invitation expired", "invitation_id", inv.ID)
+	if !inv.Test {
+		invitationsExpired.inc()
+	}
+	ev := InvitationEvent{Type: historyExpired, From: statusPending, To: statusExpired}
+	if inv.OnExpire != nil {
+		ev.OnExpire = expireClose
+	}
+	s.record(ctx, inv, ev)
+	if s.cfg.ExpirySMS {
+		s.notifyInvitee(ctx, inv, localize(inv.Locale, "expired_notice"))
+	}
+
+	s.expiryMu.Lock()
+	callbacks := append([]func(context.Context, Invitation){}, s.expiryCallbacks...)
+	s.expiryMu.Unlock()
+	for _, fn := range callbacks {
+		fn(ctx, inv)
+	}
+}
@@ -0,0 +1,44 @@
+package invitations
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxTags     = 20
+	maxTagLen   = 40
+	maxNotesLen = 2000
+)
+
+func normalizeTag(t string) string { return strings.ToLower(strings.TrimSpace(t)) }
+
+// normalizeTags normalizes each of tags and drops repeats, so "VIP" and
+// "vip " are one tag to filter on.
+func normalizeTags(tags []string) ([]string, error) {
+	if len(tags) > maxTags {
+		return nil, badRequest("at most " + strconv.Itoa(maxTags) + " tags are allowed")
+	}
+	var out []string
+	for _, t := range tags {
+		t = normalizeTag(t)
+		if t == "" {
+			return nil, badRequest("tags must not be empty")
+		}
+		if len(t) > maxTagLen {
+			return nil, badRequest("tags must be at most " + strconv.Itoa(maxTagLen) + " bytes")
+		}
+		if !slices.Contains(out, t) {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+func validateNotes(notes string) error {
+	if len(notes) > maxNotesLen {
+		return badRequest("notes must be at most " + strconv.Itoa(maxNotesLen) + " bytes")
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package invitations
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const telegramAPI = "https://api.telegram.org/bot"
+
+// newTelegramNotifier sends through the Telegram Bot API when
+// TELEGRAM_BOT_TOKEN is set and otherwise only logs. Bots can only message
+// chats that have started a conversation with them, so invitations name
+// the chat by telegram_chat_id; /start tells the invitee theirs.
+func newTelegramNotifier() Notifier {
+	token := os.Getenv("TELEGRAM_BOT_TOKEN")
+	if token == "" {
+		return logChatNotifier{channelTelegram}
+	}
+	return &telegramNotifier{token: token, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+type telegramNotifier struct {
+	token  string
+	client *http.Client
+}
+
+// Notify sends message with a button per response option while the
+// invitation is open, and returns the chat and message IDs joined by a
+// colon, which is what replies quote.
+func (n *telegramNotifier) Notify(ctx context.Context, inv Invitation, message string) (string, error) {
+	req := map[string]any{"chat_id": inv.TelegramChatID, "text": message}
+	if inv.Response == "" && inv.Status == "" {
+		req["reply_markup"] = map[string]any{"inline_keyboard": telegramButtons(inv)}
+	}
+	var sent struct {
+		MessageID int64 `json:"message_id"`
+	}
+	if err := n.call(ctx, "sendMessage", req, &sent); err != nil {
+		return "", err
+	}
+	return inv.TelegramChatID + ":" + strconv.FormatInt(sent.MessageID, 10), nil
+}
+
+// telegramButtons lays the options out three to a row. Each button's data
+// is the invitation ID and the option's position from 1.
+func telegramButtons(inv Invitation) [][]map[string]string {
+	var rows [][]map[string]string
+	for i, o := range inv.options() {
+		if i%3 == 0 {
+			rows = append(rows, nil)
+		}
+		b := map[string]string{"text": o, "callback_data": inv.ID + "|" + strconv.Itoa(i+1)}
+		rows[len(rows)-1] = append(rows[len(rows)-1], b)
+	}
+	return rows
+}
+
+// Check calls getMe, which confirms both reachability and the token.
+func (n *telegramNotifier) Check(ctx context.Context) error {
+	return n.call(ctx, "getMe", map[string]any{}, nil)
+}
+
+func (n *telegramNotifier) answerCallback(ctx context.Context, id string) error {
+	return n.call(ctx, "answerCallbackQuery", map[string]any{"callback_query_id": id}, nil)
+}
+
+func (n *telegramNotifier) call(ctx context.Context, method string, args map[string]any, result any) error {
+	body, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, telegramAPI+n.token+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return transientError{err}
+	}
+	defer resp.Body.Close()
+	if err := classifyHTTP("telegram", resp); err != nil {
+		return err
+	}
+	var reply struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return transientError{err}
+	}
+	if !reply.OK {
+		return fmt.Errorf("telegram: %s", reply.Description)
+	}
+	if result != nil {
+		return json.Unmarshal(reply.Result, result)
+	}
+	return nil
+}
+
+type telegramChat struct {
+	ID int64 `json:"id"`
+}
+
+// telegramUpdate is the part of a Telegram webhook update we use.
+type telegramUpdate struct {
+	Message *struct {
+		Chat    telegramChat `json:"chat"`
+		Text    string       `json:"text"`
+		ReplyTo *struct {
+			MessageID int64 `json:"message_id"`
+		} `json:"reply_to_message"`
+	} `json:"message"`
+	CallbackQuery *struct {
+		ID      string `json:"id"`
+		Data    string `json:"data"`
+		Message *struct {
+			Chat telegramChat `json:"chat"`
+		} `json:"message"`
+	} `json:"callback_query"`
+}
+
+// handleTelegramWebhook accepts taps on an invitation's buttons and text
+// replies quoting one of our messages, and answers in the chat by returning
+// a sendMessage call, which Telegram makes on our behalf.
+func (s *Server) handleTelegramWebhook(w http.ResponseWriter, r *http.Request) {
+	valid := func(secret string) bool {
+		return hmac.Equal([]byte(r.Header.Get("X-Telegram-Bot-Api-Secret-Token")), []byte(secret))
+	}
+	if !s.verifyWebhook(w, r, "TELEGRAM_WEBHOOK_SECRET", valid, "invalid secret token") {
+		return
+	}
+	// Updates carry far more than we read, so unknown fields are fine.
+	var update telegramUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	var chat int64
+	var reply string
+	var err error
+	switch {
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil:
+		q := update.CallbackQuery
+		chat = q.Message.Chat.ID
+		if tn, ok := s.notifiers[channelTelegram].(*telegramNotifier); ok {
+			if err := tn.answerCallback(r.Context(), q.ID); err != nil {
+				slog.WarnContext(r.Context(), "failed to answer telegram callback", "err", err)
+			}
+		}
+		reply, err = s.telegramButtonReply(r.Context(), chat, q.Data)
+	case update.Message != nil:
+		m := update.Message
+		chat = m.Chat.ID
+		switch {
+		case strings.HasPrefix(m.Text, "/start"):
+			reply = "Your chat ID is " + strconv.FormatInt(chat, 10) + ". Give it to the organizer to get invitations here."
+		case m.ReplyTo == nil:
+			reply = "To answer, tap a button on the invitation or reply to it."
+		default:
+			reply, err = s.telegramTextReply(r.Context(), chat, m.ReplyTo.MessageID, m.Text)
+		}
+	default:
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"method": "sendMessage", "chat_id": chat, "text": reply})
+}
+
+// telegramInvitation loads invitation id for a reply from chat, which must
+// be the chat it was sent to.
+func (s *Server) telegramInvitation(ctx context.Context, chat int64, id string) (Invitation, bool, error) {
+	inv, err := s.store.Get(ctx, id)
+	if err == errNotFound {
+		return Invitation{}, false, nil
+	}
+	if err != nil {
+		return Invitation{}, false, err
+	}
+	return inv, inv.TelegramChatID == strconv.FormatInt(chat, 10), nil
+}
+
+func (s *Server) telegramButtonReply(ctx context.Context, chat int64, data string) (string, error) {
+	id, pos, _ := strings.Cut(data, "|")
+	inv, ok, err := s.telegramInvitation(ctx, chat, id)
+	if err != nil || !ok {
+		return "We couldn't find this invitation.", err
+	}
+	opts := inv.options()
+	n, err := strconv.Atoi(pos)
+	if err != nil || n < 1 || n > len(opts) {
+		return localize(inv.Locale, "not_a_choice"), nil
+	}
+	locale := inv.Locale
+	if inv, err = s.recordResponse(ctx, inv.ID, responseInput{Response: opts[n-1], Via: viaTelegram}); err != nil {
+		return responseRefusal(locale, err)
+	}
+	return s.confirmationMessage(inv), nil
+}
+
+// telegramTextReply answers a reply quoting message msgID in chat, which
+// the outbox indexed when it sent the message.
+func (s *Server) telegramTextReply(ctx context.Context, chat, msgID int64, text string) (string, error) {
+	key := strconv.FormatInt(chat, 10) + ":" + strconv.FormatInt(msgID, 10)
+	rec, err := getRecord[messageRecord](ctx, s.store, messageKind, key)
+	if err == errNotFound {
+		return "To answer, tap a button on the invitation or reply to it.", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	inv, ok, err := s.telegramInvitation(ctx, chat, rec.InvitationID)
+	if err != nil || !ok {
+		return "We couldn't find this invitation.", err
+	}
+	return s.replyTo(ctx, inv, text, viaTelegram)
+}
@@ -0,0 +1,223 @@
+package invitations
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const templateKind = "template"
+
+// messageTemplate is a stored message body that invitations can reference
+// by ID. Bodies use text/template syntax; see templateData for the fields
+// available.
+type messageTemplate struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Body string `json:"body"`
+	// ChannelBodies replace Body on the channels they name.
+	ChannelBodies map[string]string `json:"channel_bodies,omitempty"`
+	CreatedAt     time.Time         `json:"created_at"`
+	CreatedByKey  string            `json:"created_by_key,omitempty"`
+}
+
+func isTemplate(body string) bool { return strings.Contains(body, "{{") }
+
+func parseTemplate(body string) (*template.Template, error) {
+	t, err := template.New("message").Option("missingkey=error").Parse(body)
+	if err != nil {
+		return nil, badRequest("invalid template: " + err.Error())
+	}
+	return t, nil
+}
+
+// templateData is what a message template is executed against: the
+// caller's variables plus Deadline and ResponseLink, which always win.
+func (s *Server) templateData(inv Invitation) map[string]string {
+	data := make(map[string]string, len(inv.Variables)+2)
+	for k, v := range inv.Variables {
+		data[k] = v
+	}
+	data["Deadline"] = s.formatDeadline(inv, inv.ExpiresAt)
+	data["ResponseLink"] = s.responseLink(inv)
+	return data
+}
+
+// responseLink is the invitee's short link to the response page, or empty
+// when no public URL is configured.
+func (s *Server) responseLink(inv Invitation) string {
+	token := s.responseToken(inv)
+	if s.cfg.PublicURL == "" || token == "" {
+		return ""
+	}
+	return strings.TrimRight(s.cfg.PublicURL, "/") + "/r/" + token
+}
+
+// renderMessage sets inv.Message from inv.Template. Invitations without a
+// template are left alone.
+func (s *Server) renderMessage(inv *Invitation) error {
+	if inv.Template == "" {
+		return nil
+	}
+	t, err := parseTemplate(inv.Template)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, s.templateData(*inv)); err != nil {
+		return &requestError{status: http.StatusUnprocessableEntity, msg: "failed to render message: " + err.Error()}
+	}
+	inv.Message = b.String()
+	return nil
+}
+
+// channelText is the invitation as sent on ch: its channel message, rendered
+// like the main one, if it has one for ch, and otherwise text, or for voice
+// calls, which have no use for the reply hint or link, the bare message.
+// Texts are fitted to sms_max_segments by smsText.
+func (s *Server) channelText(inv Invitation, ch, text string) string {
+	body, ok := inv.ChannelMessages[ch]
+	if !ok {
+		switch ch {
+		case channelVoice:
+			return s.voiceText(inv)
+		case channelSMS:
+			return s.smsText(inv)
+		}
+		return text
+	}
+	if !isTemplate(body) {
+		return body
+	}
+	alt := inv
+	alt.Template = body
+	if err := s.renderMessage(&alt); err != nil {
+		slog.Warn("failed to render channel message", "invitation_id", inv.ID, "channel", ch, "err", err)
+		return text
+	}
+	return alt.Message
+}
+
+// validateChannelMessages checks per-channel message overrides the way the
+// main message is checked.
+func (s *Server) validateChannelMessages(msgs map[string]string) error {
+	for ch, body := range msgs {
+		if !slices.Contains(knownChannels, ch) {
+			return badRequest("unknown channel " + strconv.Quote(ch) + " in channel messages")
+		}
+		if body == "" {
+			return badRequest("channel messages must not be empty")
+		}
+		if len(body) > s.cfg.MaxMessageLen {
+			return badRequest("channel messages must be at most " + strconv.Itoa(s.cfg.MaxMessageLen) + " bytes")
+		}
+		if isTemplate(body) {
+			if _, err := parseTemplate(body); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolveTemplate replaces req.TemplateID with the stored template's body
+// and channel bodies, which channel messages given with the request
+// override.
+func (s *Server) resolveTemplate(ctx context.Context, req *CreateInvitationRequest) error {
+	if req.TemplateID == "" {
+		return nil
+	}
+	if req.Message != "" {
+		return badRequest("message and template_id are mutually exclusive")
+	}
+	t, err := getRecord[messageTemplate](ctx, s.store, templateKind, req.TemplateID)
+	if err == errNotFound {
+		return &requestError{status: http.StatusUnprocessableEntity, msg: "unknown template_id"}
+	}
+	if err != nil {
+		return err
+	}
+	req.Message = t.Body
+	for ch, body := range t.ChannelBodies {
+		if _, ok := req.ChannelMessages[ch]; !ok {
+			if req.ChannelMessages == nil {
+				req.ChannelMessages = make(map[string]string, len(t.ChannelBodies))
+			}
+			req.ChannelMessages[ch] = body
+		}
+	}
+	return nil
+}
+
+func (s *Server) handleCreateTemplate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name          string            `json:"name"`
+		Body          string            `json:"body"`
+		ChannelBodies map[string]string `json:"channel_bodies"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" || req.Body == "" {
+		writeError(w, r, http.StatusBadRequest, "name and body are required")
+		return
+	}
+	if _, err := parseTemplate(req.Body); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if err := s.validateChannelMessages(req.ChannelBodies); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	t := messageTemplate{ID: s.ids.NewID(), Name: strings.TrimSpace(req.Name), Body: req.Body, ChannelBodies: req.ChannelBodies, CreatedAt: s.now().UTC()}
+	if k, ok := apiKeyFrom(r.Context()); ok {
+		t.CreatedByKey = k.ID
+	}
+	if err := putRecord(r.Context(), s.store, templateKind, t.ID, t); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, t)
+}
+
+func (s *Server) handleGetTemplate(w http.ResponseWriter, r *http.Request) {
+	t, err := getRecord[messageTemplate](r.Context(), s.store, templateKind, r.PathValue("id"))
+	if err == errNotFound {
+		writeError(w, r, http.StatusNotFound, "template not found")
+		return
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+func (s *Server) handleListTemplates(w http.ResponseWriter, r *http.Request) {
+	templates, err := listRecords[messageTemplate](r.Context(), s.store, templateKind)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, templates)
+}
+
+func (s *Server) handleDeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	err := s.store.DeleteRecord(r.Context(), templateKind, r.PathValue("id"))
+	if err == errNotFound {
+		writeError(w, r, http.StatusNotFound, "template not found")
+		return
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,253 @@
+package invitations
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const tenantKind = "tenant"
+
+// tenant is one organizer sharing the deployment. Each API key belongs to a
+// tenant; keys created without one, and every request when API keys are
+// not required, belong to the implicit default tenant whose ID is "".
+type tenant struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	// Nudge applies to the tenant's invitations that don't set their own.
+	Nudge *NudgePolicy `json:"nudge,omitempty"`
+	// UniqueExternalIDs rejects an invitation whose external_id another of
+	// the tenant's invitations already has.
+	UniqueExternalIDs bool `json:"unique_external_ids,omitempty"`
+	// Duplicates is the policy for a second active invitation to a phone
+	// number in one batch; see checkDuplicate.
+	Duplicates string `json:"duplicates,omitempty"`
+	// Retention replaces the server's retention policy for the tenant's
+	// invitations.
+	Retention *retentionPolicy `json:"retention,omitempty"`
+	// Locale is the default for the tenant's invitations, and what hosts are
+	// written to in.
+	Locale string `json:"locale,omitempty"`
+	// Budget, when set, stops new invitations once the month's messages
+	// have cost as much; see checkBudget.
+	Budget *budget `json:"budget,omitempty"`
+	// SenderPool are the numbers and alphanumeric sender IDs the tenant's
+	// texts go from; see poolSender.
+	SenderPool []string `json:"sender_pool,omitempty"`
+}
+
+type tenantContextKey struct{}
+
+// withTenant scopes store access made with ctx to one tenant.
+func withTenant(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, id)
+}
+
+// tenantFrom returns the tenant ctx is scoped to. Background work, admin
+// and invitee-facing requests are unscoped and see every tenant.
+func tenantFrom(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(tenantContextKey{}).(string)
+	return id, ok
+}
+
+// tenantScopedKinds are the record kinds each tenant has its own set of.
+// Other kinds, such as API keys and response tokens, are looked up before
+// the tenant is known.
+var tenantScopedKinds = map[string]bool{
+	webhookKind:  true,
+	batchKind:    true,
+	templateKind: true,
+	seriesKind:   true,
+	contactKind:  true,
+	userKind:     true,
+
+	senderAssignmentKind: true,
+
+	privacyRequestKind: true,
+}
+
+// tenantStore enforces tenant isolation for requests scoped with
+// withTenant: invitations of other tenants read as not found, and scoped
+// record kinds are kept apart. Unscoped contexts pass straight through.
+type tenantStore struct{ next Store }
+
+func (s tenantStore) owns(ctx context.Context, inv Invitation) bool {
+	t, ok := tenantFrom(ctx)
+	return !ok || inv.TenantID == t
+}
+
+func (s tenantStore) Create(ctx context.Context, inv Invitation) error {
+	if !s.owns(ctx, inv) {
+		return errWrongTenant
+	}
+	return s.next.Create(ctx, inv)
+}
+
+func (s tenantStore) Get(ctx context.Context, id string) (Invitation, error) {
+	inv, err := s.next.Get(ctx, id)
+	if err == nil && !s.owns(ctx, inv) {
+		return Invitation{}, errNotFound
+	}
+	return inv, err
+}
+
+func (s tenantStore) Update(ctx context.Context, id string, fn func(*Invitation) error) (Invitation, error) {
+	return s.next.Update(ctx, id, func(inv *Invitation) error {
+		if !s.owns(ctx, *inv) {
+			return errNotFound
+		}
+		owner := inv.TenantID
+		err := fn(inv)
+		inv.TenantID = owner
+		return err
+	})
+}
+
+func (s tenantStore) List(ctx context.Context, f ListFilter) ([]Invitation, error) {
+	if t, ok := tenantFrom(ctx); ok {
+		f.TenantID = &t
+	}
+	return s.next.List(ctx, f)
+}
+
+func (s tenantStore) Stats(ctx context.Context, f StatsFilter) (InvitationStats, error) {
+	if t, ok := tenantFrom(ctx); ok {
+		f.TenantID = &t
+	}
+	return s.next.Stats(ctx, f)
+}
+
+// DeleteExpired is an operator action and purges every tenant.
+func (s tenantStore) DeleteExpired(ctx context.Context, before time.Time) (int, error) {
+	return s.next.DeleteExpired(ctx, before)
+}
+
+func (s tenantStore) Delete(ctx context.Context, id string) error {
+	if _, ok := tenantFrom(ctx); ok {
+		if _, err := s.Get(ctx, id); err != nil {
+			return err
+		}
+	}
+	return s.next.Delete(ctx, id)
+}
+
+func (s tenantStore) AppendEvent(ctx context.Context, id string, ev InvitationEvent) error {
+	return s.next.AppendEvent(ctx, id, ev)
+}
+
+func (s tenantStore) Events(ctx context.Context, id string) ([]InvitationEvent, error) {
+	if _, ok := tenantFrom(ctx); ok {
+		if _, err := s.Get(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+	return s.next.Events(ctx, id)
+}
+
+func (s tenantStore) DeleteEvents(ctx context.Context, id string) error {
+	if _, ok := tenantFrom(ctx); ok {
+		if _, err := s.Get(ctx, id); err != nil {
+			return err
+		}
+	}
+	return s.next.DeleteEvents(ctx, id)
+}
+
+// kind maps a scoped record kind to the tenant's own collection. The
+// default tenant keeps the plain kind, so records made before tenants
+// existed stay where they were.
+func (s tenantStore) kind(ctx context.Context, kind string) string {
+	if t, ok := tenantFrom(ctx); ok && t != "" && tenantScopedKinds[kind] {
+		return kind + ":" + t
+	}
+	return kind
+}
+
+func (s tenantStore) PutRecord(ctx context.Context, kind, id string, data []byte) error {
+	return s.next.PutRecord(ctx, s.kind(ctx, kind), id, data)
+}
+
+func (s tenantStore) GetRecord(ctx context.Context, kind, id string) ([]byte, error) {
+	return s.next.GetRecord(ctx, s.kind(ctx, kind), id)
+}
+
+func (s tenantStore) ListRecords(ctx context.Context, kind string) ([][]byte, error) {
+	return s.next.ListRecords(ctx, s.kind(ctx, kind))
+}
+
+func (s tenantStore) DeleteRecord(ctx context.Context, kind, id string) error {
+	return s.next.DeleteRecord(ctx, s.kind(ctx, kind), id)
+}
+
+func (s tenantStore) Ping(ctx context.Context) error { return s.next.Ping(ctx) }
+func (s tenantStore) Close() error                   { return s.next.Close() }
+
+func (s *Server) handleCreateTenant(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name              string           `json:"name"`
+		Nudge             *NudgePolicy     `json:"nudge"`
+		UniqueExternalIDs bool             `json:"unique_external_ids"`
+		Duplicates        string           `json:"duplicates"`
+		Retention         *retentionPolicy `json:"retention"`
+		Locale            string           `json:"locale"`
+		Budget            *budget          `json:"budget"`
+		SenderPool        []string         `json:"sender_pool"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		writeError(w, r, http.StatusBadRequest, "name is required")
+		return
+	}
+	if req.Nudge != nil {
+		if err := req.Nudge.validate(); err != nil {
+			writeResponseError(w, r, err)
+			return
+		}
+	}
+	if req.Retention != nil {
+		if err := req.Retention.validate(); err != nil {
+			writeResponseError(w, r, err)
+			return
+		}
+	}
+	if err := validateLocale(req.Locale); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if err := validateDuplicates(req.Duplicates); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if req.Budget != nil {
+		if err := req.Budget.validate(); err != nil {
+			writeResponseError(w, r, err)
+			return
+		}
+	}
+	pool, err := normalizeSenderPool(req.SenderPool)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	t := tenant{ID: randomHex(8), Name: strings.TrimSpace(req.Name), CreatedAt: s.now().UTC(), Nudge: req.Nudge, UniqueExternalIDs: req.UniqueExternalIDs, Retention: req.Retention,
+		Locale: req.Locale, Budget: req.Budget, Duplicates: req.Duplicates, SenderPool: pool}
+	if err := putRecord(r.Context(), s.store, tenantKind, t.ID, t); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, t)
+}
+
+func (s *Server) handleListTenants(w http.ResponseWriter, r *http.Request) {
+	tenants, err := listRecords[tenant](r.Context(), s.store, tenantKind)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, tenants)
+}
@@ -0,0 +1,203 @@
+package invitations
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const viaTest = "test"
+
+// Personas preset a test response to behave like a kind of invitee, for
+// exercising reminders, expiry and quorums end to end.
+const (
+	personaFastYes       = "fast_yes"       // accepts as soon as the invitation is sent
+	personaFastNo        = "fast_no"        // declines as soon as it is sent
+	personaAfterReminder = "after_reminder" // answers once reminded
+	personaNever         = "never"          // never answers
+	personaAfterExpiry   = "after_expiry"   // answers too late, once the invitation has expired
+)
+
+var personas = []string{personaFastYes, personaFastNo, personaAfterReminder, personaNever, personaAfterExpiry}
+
+// TestResponse has the server answer a test invitation itself AfterSec
+// seconds after it is sent, standing in for the invitee so that clients can
+// exercise their response handling end to end. With AfterReminders it waits
+// for that many reminders first, and with AfterExpiry it waits for the
+// invitation to expire, counting AfterSec from the last reminder or the
+// expiry instead.
+type TestResponse struct {
+	Persona        string `json:"persona,omitempty"`
+	Response       string `json:"response,omitempty"`
+	Note           string `json:"note,omitempty"`
+	GuestCount     int    `json:"guest_count,omitempty"`
+	AfterSec       int    `json:"after_sec,omitempty"`
+	AfterReminders int    `json:"after_reminders,omitempty"`
+	AfterExpiry    bool   `json:"after_expiry,omitempty"`
+}
+
+// validate checks t, first filling in what its persona presets.
+func (t *TestResponse) validate(opts []string, maxGuests int) error {
+	switch t.Persona {
+	case "":
+	case personaFastYes, personaAfterReminder, personaAfterExpiry:
+		if t.Response == "" {
+			t.Response = opts[0]
+		}
+		if t.Persona == personaAfterReminder {
+			t.AfterReminders = max(t.AfterReminders, 1)
+		}
+		t.AfterExpiry = t.AfterExpiry || t.Persona == personaAfterExpiry
+	case personaFastNo:
+		if t.Response == "" {
+			t.Response = opts[len(opts)-1]
+		}
+	case personaNever:
+		if t.Response != "" {
+			return badRequest("test_response.response can't be given for never")
+		}
+		*t = TestResponse{Persona: personaNever}
+		return nil
+	default:
+		return badRequest("test_response.persona must be one of " + strings.Join(personas, ", "))
+	}
+	if t.AfterSec < 0 || t.AfterSec > 24*60*60 {
+		return badRequest("test_response.after_sec must be between 0 and 86400")
+	}
+	if t.AfterReminders < 0 || t.AfterReminders > maxReminders {
+		return badRequest("test_response.after_reminders must be between 0 and " + strconv.Itoa(maxReminders))
+	}
+	if _, ok := matchResponse(opts, t.Response); !ok {
+		return invalidResponse(opts)
+	}
+	if t.GuestCount < 0 || t.GuestCount > maxGuests {
+		return badRequest("test_response.guest_count must be between 0 and " + strconv.Itoa(maxGuests))
+	}
+	_, err := validateNote(t.Note)
+	return err
+}
+
+// personaCycle spreads personas, weighted by count, over a cycle that a
+// batch's recipients are assigned from in turn, so that the same request
+// always gets the same mix: fast_yes 2 and never 1 gives fast_yes, never,
+// fast_yes.
+func personaCycle(weights map[string]int) ([]string, error) {
+	names, total := make([]string, 0, len(weights)), 0
+	for p, w := range weights {
+		if !slices.Contains(personas, p) {
+			return nil, badRequest("personas must be among " + strings.Join(personas, ", "))
+		}
+		if w < 1 || w > maxBulkRecipients {
+			return nil, badRequest("persona weights must be between 1 and " + strconv.Itoa(maxBulkRecipients))
+		}
+		names, total = append(names, p), total+w
+	}
+	slices.Sort(names)
+	// Smooth weighted round robin: each turn goes to the persona furthest
+	// behind its share.
+	credit := make(map[string]int, len(names))
+	cycle := make([]string, 0, total)
+	for range total {
+		best := ""
+		for _, p := range names {
+			credit[p] += weights[p]
+			if best == "" || credit[p] > credit[best] {
+				best = p
+			}
+		}
+		credit[best] -= total
+		cycle = append(cycle, best)
+	}
+	return cycle, nil
+}
+
+// testMode reports whether invitations created in ctx are tests: asked for
+// by the request or always, for a key created with test_mode.
+func testMode(ctx context.Context, requested bool) bool {
+	k, _ := apiKeyFrom(ctx)
+	return requested || k.TestMode
+}
+
+// testNotifier stands in for every channel's provider for test
+// invitations, accepting each message without sending it.
+type testNotifier struct{}
+
+func (testNotifier) Notify(ctx context.Context, inv Invitation, message string) (string, error) {
+	id := "test-" + randomHex(8)
+	slog.InfoContext(ctx, "simulating message", "invitation_id", inv.ID, "message_id", id)
+	return id, nil
+}
+
+// testResponseDue reports whether the test response of inv is due by t.
+func testResponseDue(inv Invitation, t time.Time) bool {
+	tr := inv.TestResponse
+	if !inv.Test || tr == nil || tr.Persona == personaNever {
+		return false
+	}
+	from := inv.CreatedAt
+	if !inv.SendAt.IsZero() {
+		from = inv.SendAt
+	}
+	if tr.AfterReminders > 0 {
+		n := 0
+		for _, r := range inv.Reminders {
+			if !r.SentAt.IsZero() {
+				n++
+				from = later(from, r.SentAt)
+			}
+		}
+		if n < tr.AfterReminders {
+			return false
+		}
+	}
+	if tr.AfterExpiry {
+		if !t.After(inv.ExpiresAt) {
+			return false
+		}
+		from = later(from, inv.ExpiresAt)
+	}
+	return !t.Before(from.Add(time.Duration(tr.AfterSec) * time.Second))
+}
+
+func later(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+// sendTestResponses records the test responses due by t. Those of
+// invitations expired for no longer than after_sec allows are attempted
+// too, for after_expiry.
+func (s *Server) sendTestResponses(ctx context.Context, t time.Time) error {
+	pending, err := s.store.List(ctx, ListFilter{Status: statusPending, AsOf: t, ExpiresAfter: t})
+	if err != nil {
+		return err
+	}
+	expired, err := s.store.List(ctx, ListFilter{Status: statusExpired, AsOf: t, ExpiresAfter: t.Add(-25 * time.Hour)})
+	if err != nil {
+		return err
+	}
+	for _, inv := range append(pending, expired...) {
+		if !testResponseDue(inv, t) {
+			continue
+		}
+		tr := inv.TestResponse
+		in := responseInput{Response: tr.Response, Note: tr.Note, GuestCount: tr.GuestCount, Via: viaTest}
+		if _, err := s.respondToInvitation(ctx, inv.ID, in); err != nil {
+			// Expired, as after_expiry means, or the event filled up; it
+			// is only tried the once.
+			slog.InfoContext(ctx, "test response not recorded", "invitation_id", inv.ID, "err", err)
+			if _, err := s.store.Update(ctx, inv.ID, func(inv *Invitation) error {
+				inv.TestResponse = nil
+				return nil
+			}); err != nil && err != errNotFound {
+				return err
+			}
+		}
+	}
+	return nil
+}
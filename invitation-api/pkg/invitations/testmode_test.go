@@ -0,0 +1,199 @@
+package invitations
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func testInvite(phone string, tr map[string]any) map[string]any {
+	req := invite(phone)
+	req["test_mode"] = true
+	if tr != nil {
+		req["test_response"] = tr
+	}
+	return req
+}
+
+func TestTestModeSuppressesDelivery(t *testing.T) {
+	ts := newTestServer(t)
+	inv := ts.create(testInvite("+14155550101", nil))
+	if !inv.Test {
+		t.Fatal("created without test set")
+	}
+	ts.create(invite("+14155550102"))
+	ts.drainOutbox()
+
+	for _, m := range ts.sms.messages() {
+		if m.InvitationID == inv.ID {
+			t.Errorf("test invitation sent to the SMS provider: %q", m.Body)
+		}
+	}
+	if n := len(ts.sms.messages()); n != 1 {
+		t.Errorf("provider sent %d messages, want just the real invitation's", n)
+	}
+	// Delivery is simulated as far as the provider's status callback.
+	if got := ts.get(inv.ID).Delivery[channelSMS]; got.Status != deliveryDelivered {
+		t.Errorf("sms delivery = %+v, want delivered", got)
+	}
+
+	ts.clock.Advance(time.Minute)
+	w := ts.do("GET", "/stats", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("stats: got %d: %s", w.Code, w.Body)
+	}
+	if got := decodeBody[struct{ Invitations int }](t, w); got.Invitations != 1 {
+		t.Errorf("stats count %d invitations, want 1 without the test one", got.Invitations)
+	}
+}
+
+func TestTestModeCannedResponse(t *testing.T) {
+	ts := newTestServer(t)
+	ctx := context.Background()
+	inv := ts.create(testInvite("+14155550101", map[string]any{"response": "no", "note": "Away that week", "after_sec": 30}))
+	ts.drainOutbox()
+
+	ts.clock.Advance(29 * time.Second)
+	if err := ts.sendTestResponses(ctx, ts.now()); err != nil {
+		t.Fatal(err)
+	}
+	if got := ts.get(inv.ID); got.Status != statusPending {
+		t.Fatalf("status before after_sec = %q, want pending", got.Status)
+	}
+
+	ts.clock.Advance(time.Second)
+	if err := ts.sendTestResponses(ctx, ts.now()); err != nil {
+		t.Fatal(err)
+	}
+	got := ts.get(inv.ID)
+	if got.Status != statusDeclined || got.Note != "Away that week" {
+		t.Fatalf("after after_sec: status %q, note %q; want the canned decline", got.Status, got.Note)
+	}
+	events, err := ts.store.Events(ctx, inv.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var via string
+	for _, ev := range events {
+		if ev.Type == historyResponded {
+			via = ev.Via
+		}
+	}
+	if via != viaTest {
+		t.Errorf("response recorded via %q, want %q", via, viaTest)
+	}
+}
+
+func TestTestResponseNeedsTestMode(t *testing.T) {
+	ts := newTestServer(t)
+	req := invite("+14155550101")
+	req["test_response"] = map[string]any{"response": "yes"}
+	if w := ts.do("POST", "/invitations", req); w.Code != http.StatusBadRequest {
+		t.Errorf("test_response without test_mode: got %d, want 400: %s", w.Code, w.Body)
+	}
+	if w := ts.do("POST", "/invitations", testInvite("+14155550101", map[string]any{"response": "maybe later"})); w.Code == http.StatusCreated {
+		t.Errorf("test_response with an invalid response: got %d", w.Code)
+	}
+}
+
+// schedule runs the sweeper and the scheduler's reminder and test response
+// passes as of after testStart.
+func (ts *testServer) schedule(after time.Duration) {
+	ts.t.Helper()
+	ctx := context.Background()
+	ts.clock.Set(testStart.Add(after))
+	t := ts.now()
+	if err := errors.Join(ts.sweepExpired(ctx, time.Time{}, t), ts.sendDueReminders(ctx, t), ts.sendTestResponses(ctx, t)); err != nil {
+		ts.t.Fatal(err)
+	}
+	ts.drainOutbox()
+}
+
+func TestPersonas(t *testing.T) {
+	type step struct {
+		after  time.Duration
+		status string
+	}
+	for _, tc := range []struct {
+		persona string
+		steps   []step
+	}{
+		{personaFastYes, []step{{0, statusAccepted}}},
+		{personaFastNo, []step{{0, statusDeclined}}},
+		{personaAfterReminder, []step{{0, statusPending}, {44 * time.Minute, statusPending}, {45 * time.Minute, statusAccepted}}},
+		{personaNever, []step{{0, statusPending}, {45 * time.Minute, statusPending}, {61 * time.Minute, statusExpired}, {2 * time.Hour, statusExpired}}},
+		{personaAfterExpiry, []step{{0, statusPending}, {45 * time.Minute, statusPending}, {61 * time.Minute, statusExpired}}},
+	} {
+		t.Run(tc.persona, func(t *testing.T) {
+			ts := newTestServer(t)
+			req := testInvite("+14155550101", map[string]any{"persona": tc.persona})
+			req["remind_before_min"] = 15
+			inv := ts.create(req)
+			for _, s := range tc.steps {
+				ts.schedule(s.after)
+				if got := ts.get(inv.ID); got.Status != s.status {
+					t.Fatalf("after %v: status %q, want %q", s.after, got.Status, s.status)
+				}
+			}
+			if tc.persona == personaAfterExpiry {
+				// Its late answer was tried, refused and not tried again.
+				if got, _ := ts.store.Get(context.Background(), inv.ID); got.TestResponse != nil || got.Response != "" {
+					t.Errorf("after expiry: test response %+v, response %q", got.TestResponse, got.Response)
+				}
+			}
+		})
+	}
+}
+
+func TestPersonaCycle(t *testing.T) {
+	cycle, err := personaCycle(map[string]int{personaFastYes: 2, personaNever: 1})
+	if want := []string{personaFastYes, personaNever, personaFastYes}; err != nil || !slices.Equal(cycle, want) {
+		t.Errorf("cycle = %v, %v; want %v", cycle, err, want)
+	}
+	for _, weights := range []map[string]int{{"slow": 1}, {personaFastYes: 0}} {
+		if _, err := personaCycle(weights); err == nil {
+			t.Errorf("%v: no error", weights)
+		}
+	}
+}
+
+func TestBulkPersonas(t *testing.T) {
+	ts := newTestServer(t)
+	req := map[string]any{
+		"message":      "Dinner at 8?",
+		"duration_min": 60,
+		"test_mode":    true,
+		"personas":     map[string]int{personaFastYes: 2, personaNever: 1},
+		"recipients": []map[string]any{
+			{"phone_number": "+14155550101"}, {"phone_number": "+14155550102"}, {"phone_number": "+14155550103"},
+		},
+	}
+	w := ts.do("POST", "/invitations/bulk", req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("bulk: got %d: %s", w.Code, w.Body)
+	}
+	var got []string
+	for _, r := range decodeBody[struct{ Results []bulkResult }](t, w).Results {
+		if r.Invitation == nil || r.Invitation.TestResponse == nil {
+			t.Fatalf("result %d without a test response: %+v", r.Index, r)
+		}
+		got = append(got, r.Invitation.TestResponse.Persona)
+	}
+	if want := []string{personaFastYes, personaNever, personaFastYes}; !slices.Equal(got, want) {
+		t.Errorf("personas %v, want %v", got, want)
+	}
+
+	ts.schedule(0)
+	invs, err := ts.List(context.Background(), ListFilter{Status: statusAccepted, AsOf: ts.now()})
+	if err != nil || len(invs) != 2 {
+		t.Errorf("accepted %d, %v; want the two fast_yes", len(invs), err)
+	}
+
+	delete(req, "test_mode")
+	if w := ts.do("POST", "/invitations/bulk", req); w.Code != http.StatusBadRequest {
+		t.Errorf("personas without test_mode: got %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,45 @@
+package invitations
+
+import (
+	"time"
+
+	// Recipient zones come from API clients, so the zone database is
+	// embedded rather than relying on the host having one installed.
+	_ "time/tzdata"
+)
+
+// loadTimezone parses an IANA zone name given by a client. "Local" is
+// rejected because it would silently mean the server's zone.
+func loadTimezone(name string) (*time.Location, error) {
+	if name == "Local" {
+		return nil, badRequest("timezone must be an IANA name such as America/New_York")
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, badRequest("timezone must be an IANA name such as America/New_York")
+	}
+	return loc, nil
+}
+
+// location returns the zone human-facing times for inv are shown in: the
+// recipient's when known, otherwise the server default.
+func (s *Server) location(inv Invitation) *time.Location {
+	if inv.Timezone != "" {
+		if loc, err := time.LoadLocation(inv.Timezone); err == nil {
+			return loc
+		}
+	}
+	return s.cfg.Location()
+}
+
+// formatDeadline renders t for the invitee, e.g. "3:04PM EST", adding the
+// date when t falls on a different day than now in that zone.
+func (s *Server) formatDeadline(inv Invitation, t time.Time) string {
+	loc := s.location(inv)
+	t = t.In(loc)
+	now := s.now().In(loc)
+	if ty, tm, td := t.Date(); ty == now.Year() && tm == now.Month() && td == now.Day() {
+		return t.Format(localize(inv.Locale, "time_today"))
+	}
+	return t.Format(localize(inv.Locale, "time_other_day"))
+}
@@ -0,0 +1,41 @@
+package invitations
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// listenAndServe serves the HTTP API on Addr, over TLS when a certificate
+// or autocert domains are configured. net/http negotiates HTTP/2 on TLS
+// connections by itself.
+func (s *Server) listenAndServe() error {
+	switch {
+	case s.cfg.TLSCertFile != "":
+		slog.Info("API listening", "addr", s.http.Addr, "tls", "files")
+		return s.http.ListenAndServeTLS(s.cfg.TLSCertFile, s.cfg.TLSKeyFile)
+	case len(s.cfg.AutocertDomains) > 0:
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(s.cfg.AutocertDomains...),
+			Cache:      autocert.DirCache(s.cfg.AutocertCacheDir),
+			Email:      s.cfg.AutocertEmail,
+		}
+		s.http.TLSConfig = m.TLSConfig()
+		if s.cfg.AutocertHTTPAddr != "" {
+			s.acme = &http.Server{Addr: s.cfg.AutocertHTTPAddr, Handler: m.HTTPHandler(nil), ReadHeaderTimeout: 10 * time.Second}
+			go func() {
+				if err := s.acme.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+					slog.Error("ACME HTTP listener failed", "addr", s.acme.Addr, "err", err)
+				}
+			}()
+		}
+		slog.Info("API listening", "addr", s.http.Addr, "tls", "autocert", "domains", s.cfg.AutocertDomains)
+		return s.http.ListenAndServeTLS("", "")
+	}
+	slog.Info("API listening", "addr", s.http.Addr)
+	return s.http.ListenAndServe()
+}
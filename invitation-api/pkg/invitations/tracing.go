@@ -0,0 +1,145 @@
+package invitations
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("invitation-api")
+
+// SetupTracing exports spans over OTLP/HTTP to endpoint. With no endpoint
+// the global no-op provider stays in place and spans cost next to nothing.
+// The returned func flushes buffered spans.
+func SetupTracing(ctx context.Context, endpoint string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	exp, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "invitation-api"))),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// endSpan records err on span, if any, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil && err != errNotFound && err != errSkip {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// tracedStore wraps every Store call in a span.
+type tracedStore struct{ next Store }
+
+func (s tracedStore) start(ctx context.Context, op string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "store."+op, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+func (s tracedStore) Create(ctx context.Context, inv Invitation) (err error) {
+	ctx, span := s.start(ctx, "Create", attribute.String("invitation.id", inv.ID))
+	defer func() { endSpan(span, err) }()
+	return s.next.Create(ctx, inv)
+}
+
+func (s tracedStore) Get(ctx context.Context, id string) (_ Invitation, err error) {
+	ctx, span := s.start(ctx, "Get", attribute.String("invitation.id", id))
+	defer func() { endSpan(span, err) }()
+	return s.next.Get(ctx, id)
+}
+
+func (s tracedStore) Update(ctx context.Context, id string, fn func(*Invitation) error) (_ Invitation, err error) {
+	ctx, span := s.start(ctx, "Update", attribute.String("invitation.id", id))
+	defer func() { endSpan(span, err) }()
+	return s.next.Update(ctx, id, fn)
+}
+
+func (s tracedStore) List(ctx context.Context, f ListFilter) (_ []Invitation, err error) {
+	ctx, span := s.start(ctx, "List", attribute.String("filter.status", f.Status), attribute.Int("filter.limit", f.Limit))
+	defer func() { endSpan(span, err) }()
+	return s.next.List(ctx, f)
+}
+
+func (s tracedStore) Stats(ctx context.Context, f StatsFilter) (_ InvitationStats, err error) {
+	ctx, span := s.start(ctx, "Stats")
+	defer func() { endSpan(span, err) }()
+	return s.next.Stats(ctx, f)
+}
+
+func (s tracedStore) DeleteExpired(ctx context.Context, before time.Time) (_ int, err error) {
+	ctx, span := s.start(ctx, "DeleteExpired")
+	defer func() { endSpan(span, err) }()
+	return s.next.DeleteExpired(ctx, before)
+}
+
+func (s tracedStore) Delete(ctx context.Context, id string) (err error) {
+	ctx, span := s.start(ctx, "Delete", attribute.String("invitation.id", id))
+	defer func() { endSpan(span, err) }()
+	return s.next.Delete(ctx, id)
+}
+
+func (s tracedStore) AppendEvent(ctx context.Context, id string, ev InvitationEvent) (err error) {
+	ctx, span := s.start(ctx, "AppendEvent", attribute.String("invitation.id", id), attribute.String("event.type", ev.Type))
+	defer func() { endSpan(span, err) }()
+	return s.next.AppendEvent(ctx, id, ev)
+}
+
+func (s tracedStore) Events(ctx context.Context, id string) (_ []InvitationEvent, err error) {
+	ctx, span := s.start(ctx, "Events", attribute.String("invitation.id", id))
+	defer func() { endSpan(span, err) }()
+	return s.next.Events(ctx, id)
+}
+
+func (s tracedStore) DeleteEvents(ctx context.Context, id string) (err error) {
+	ctx, span := s.start(ctx, "DeleteEvents", attribute.String("invitation.id", id))
+	defer func() { endSpan(span, err) }()
+	return s.next.DeleteEvents(ctx, id)
+}
+
+func (s tracedStore) PutRecord(ctx context.Context, kind, id string, data []byte) (err error) {
+	ctx, span := s.start(ctx, "PutRecord", attribute.String("record.kind", kind))
+	defer func() { endSpan(span, err) }()
+	return s.next.PutRecord(ctx, kind, id, data)
+}
+
+func (s tracedStore) GetRecord(ctx context.Context, kind, id string) (_ []byte, err error) {
+	ctx, span := s.start(ctx, "GetRecord", attribute.String("record.kind", kind))
+	defer func() { endSpan(span, err) }()
+	return s.next.GetRecord(ctx, kind, id)
+}
+
+func (s tracedStore) ListRecords(ctx context.Context, kind string) (_ [][]byte, err error) {
+	ctx, span := s.start(ctx, "ListRecords", attribute.String("record.kind", kind))
+	defer func() { endSpan(span, err) }()
+	return s.next.ListRecords(ctx, kind)
+}
+
+func (s tracedStore) DeleteRecord(ctx context.Context, kind, id string) (err error) {
+	ctx, span := s.start(ctx, "DeleteRecord", attribute.String("record.kind", kind))
+	defer func() { endSpan(span, err) }()
+	return s.next.DeleteRecord(ctx, kind, id)
+}
+
+func (s tracedStore) Ping(ctx context.Context) (err error) {
+	ctx, span := s.start(ctx, "Ping")
+	defer func() { endSpan(span, err) }()
+	return s.next.Ping(ctx)
+}
+
+func (s tracedStore) Close() error { return s.next.Close() }
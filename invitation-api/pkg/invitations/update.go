@@ -0,0 +1,211 @@
+package invitations
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type updateInvitationRequest struct {
+	Message   *string    `json:"message"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	ExtendMin int        `json:"extend_min"`
+	Notify    *bool      `json:"notify"`
+
+	// Tags and Notes are the host's alone, and can be changed whatever the
+	// invitation's status without telling the invitee.
+	Tags  *[]string `json:"tags"`
+	Notes *string   `json:"notes"`
+}
+
+// content reports whether req changes what the invitee was sent.
+func (req updateInvitationRequest) content() bool {
+	return req.Message != nil || req.ExpiresAt != nil || req.ExtendMin != 0
+}
+
+// Change is one field edit recorded in the event log.
+type Change struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// handleUpdateInvitation lets the host edit the message or move the
+// deadline of an invitation that is still pending. The invitee is sent the
+// updated invitation unless notify is false. Tags and notes can be edited
+// at any time.
+func (s *Server) handleUpdateInvitation(w http.ResponseWriter, r *http.Request) {
+	var req updateInvitationRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if !req.content() && req.Tags == nil && req.Notes == nil {
+		writeError(w, r, http.StatusBadRequest, "nothing to update")
+		return
+	}
+	if req.ExpiresAt != nil && req.ExtendMin != 0 {
+		writeError(w, r, http.StatusBadRequest, "expires_at and extend_min are mutually exclusive")
+		return
+	}
+	if req.ExtendMin < 0 {
+		writeError(w, r, http.StatusBadRequest, "extend_min must be positive")
+		return
+	}
+	if req.Message != nil && (*req.Message == "" || len(*req.Message) > s.cfg.MaxMessageLen) {
+		writeError(w, r, http.StatusBadRequest, "message must be between 1 and "+strconv.Itoa(s.cfg.MaxMessageLen)+" bytes")
+		return
+	}
+	if req.Tags != nil {
+		tags, err := normalizeTags(*req.Tags)
+		if err != nil {
+			writeResponseError(w, r, err)
+			return
+		}
+		req.Tags = &tags
+	}
+	if req.Notes != nil {
+		if err := validateNotes(*req.Notes); err != nil {
+			writeResponseError(w, r, err)
+			return
+		}
+	}
+
+	match, err := s.readIfMatch(r)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	inv, err := s.updateInvitation(r.Context(), r.PathValue("id"), req, match)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeInvitation(w, http.StatusOK, inv)
+}
+
+// updateInvitation applies req, already checked, to invitation id, which
+// must be pending for req to change its content.
+func (s *Server) updateInvitation(ctx context.Context, id string, req updateInvitationRequest, match ifMatch) (Invitation, error) {
+	t := s.now()
+	var changes []Change
+	var resend bool
+	ev := InvitationEvent{Type: historyUpdated}
+	inv, err := s.store.Update(ctx, id, func(inv *Invitation) error {
+		changes, ev.Type, resend = nil, historyUpdated, false
+		if err := match.check(*inv); err != nil {
+			return err
+		}
+		if req.Tags != nil && !slices.Equal(*req.Tags, inv.Tags) {
+			changes = append(changes, Change{"tags", strings.Join(inv.Tags, ","), strings.Join(*req.Tags, ",")})
+			inv.Tags = *req.Tags
+		}
+		if req.Notes != nil && *req.Notes != inv.Notes {
+			// Notes are sealed with the invitee's details, so their text is
+			// kept out of the log.
+			changes = append(changes, Change{Field: "notes"})
+			inv.Notes = *req.Notes
+		}
+		hostOnly := len(changes)
+		if !req.content() {
+			if hostOnly == 0 {
+				return errSkip
+			}
+			return nil
+		}
+		switch inv.withStatus(t).Status {
+		case statusPending, statusViewed:
+		case statusCancelled:
+			return errCancelled
+		case statusScheduled:
+			return errNotSent
+		case statusExpired:
+			return errExpired
+		case statusDelegated:
+			return errForwarded
+		default:
+			return errLocked
+		}
+
+		old := inv.Message
+		if req.Message != nil && *req.Message != inv.Message {
+			inv.Message, inv.Template = *req.Message, ""
+			if isTemplate(inv.Message) {
+				inv.Template = inv.Message
+			}
+		}
+		exp := inv.ExpiresAt
+		if req.ExpiresAt != nil {
+			exp = *req.ExpiresAt
+		}
+		if req.ExtendMin > 0 {
+			exp = exp.Add(time.Duration(req.ExtendMin) * time.Minute)
+		}
+		if !exp.Equal(inv.ExpiresAt) {
+			if !exp.After(t) {
+				return badRequest("the new deadline must be in the future")
+			}
+			if exp.Sub(t) > time.Duration(s.cfg.MaxDurationMin)*time.Minute {
+				return badRequest("the new deadline must be at most " + strconv.Itoa(s.cfg.MaxDurationMin) + " minutes away")
+			}
+			changes = append(changes, Change{"expires_at", inv.ExpiresAt.UTC().Format(time.RFC3339), exp.UTC().Format(time.RFC3339)})
+			if exp.After(inv.ExpiresAt) {
+				ev.Type = historyExtended
+			}
+			inv.ExpiresAt = exp
+			rescheduleReminders(inv, t)
+		}
+		if err := s.renderMessage(inv); err != nil {
+			return err
+		}
+		if len(inv.Message) > s.cfg.MaxMessageLen {
+			return badRequest("rendered message must be at most " + strconv.Itoa(s.cfg.MaxMessageLen) + " bytes")
+		}
+		if inv.Message != old {
+			changes = append(changes, Change{"message", old, inv.Message})
+		}
+		if len(changes) == 0 {
+			return errSkip
+		}
+		if resend = len(changes) > hostOnly; !resend {
+			return nil
+		}
+		return s.checkSMSLength(inv)
+	})
+	if err == errSkip {
+		// Nothing changed; report the invitation as it stands.
+		if inv, err = s.store.Get(ctx, id); err != nil {
+			return Invitation{}, err
+		}
+		return inv.withStatus(t), nil
+	}
+	if err != nil {
+		return Invitation{}, err
+	}
+	ev.Changes = changes
+	s.record(ctx, inv, ev)
+
+	if resend && (req.Notify == nil || *req.Notify) {
+		s.notifyInvitee(ctx, inv, localize(inv.Locale, "update", s.inviteText(inv)))
+		// Recording the message made a new version.
+		if latest, err := s.store.Get(ctx, inv.ID); err == nil {
+			inv = latest
+		}
+	}
+	return inv.withStatus(t), nil
+}
+
+// rescheduleReminders moves each reminder to keep its lead time before the
+// new deadline. Reminders that now fall in the future are sent again.
+func rescheduleReminders(inv *Invitation, t time.Time) {
+	for i := range inv.Reminders {
+		rm := &inv.Reminders[i]
+		rm.At = inv.ExpiresAt.Add(-time.Duration(rm.BeforeMin) * time.Minute).UTC()
+		if rm.At.After(t) {
+			rm.SentAt = time.Time{}
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package invitations
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const usageKind = "usage"
+
+// price is what sending one message costs on the channel, provider and
+// destination country it names; empty fields match any. SMS are charged per
+// segment as well as per message.
+type price struct {
+	Channel    string  `yaml:"channel" json:"channel,omitempty"`
+	Provider   string  `yaml:"provider" json:"provider,omitempty"`
+	Country    string  `yaml:"country" json:"country,omitempty"`
+	PerMessage float64 `yaml:"per_message" json:"per_message,omitempty"`
+	PerSegment float64 `yaml:"per_segment" json:"per_segment,omitempty"`
+}
+
+// defaultPrices are rough list prices, for estimates until prices_file
+// gives the deployment's own.
+var defaultPrices = []price{
+	{Channel: channelSMS, Country: "US", PerSegment: 0.0079},
+	{Channel: channelSMS, Country: "CA", PerSegment: 0.0079},
+	{Channel: channelSMS, PerSegment: 0.05},
+	{Channel: channelVoice, PerMessage: 0.014},
+	{Channel: channelWhatsApp, PerMessage: 0.005},
+	{Channel: channelEmail, PerMessage: 0.0001},
+}
+
+// loadPrices reads a YAML list of prices. They are consulted before the
+// defaults, which still cover what they leave out.
+func loadPrices(path string) ([]price, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var prices []price
+	if err := yaml.Unmarshal(data, &prices); err != nil {
+		return nil, err
+	}
+	for _, p := range prices {
+		if p.PerMessage < 0 || p.PerSegment < 0 {
+			return nil, errors.New("prices must not be negative")
+		}
+	}
+	return append(prices, defaultPrices...), nil
+}
+
+// costMicros prices a message at the most specific matching entry, the
+// first of equally specific ones, in millionths of the currency.
+func costMicros(prices []price, channel, provider, country string, segments int) int64 {
+	best, score := price{}, -1
+	for _, p := range prices {
+		n := 0
+		for _, f := range []struct{ want, got string }{{p.Channel, channel}, {p.Provider, provider}, {p.Country, country}} {
+			if f.want == "" {
+				continue
+			}
+			if f.want != f.got {
+				n = -1
+				break
+			}
+			n++
+		}
+		if n > score {
+			best, score = p, n
+		}
+	}
+	return int64(math.Round((best.PerMessage + best.PerSegment*float64(segments)) * 1e6))
+}
+
+// usageRecord is one sent message as billed. Records outlive the
+// invitations they were sent for, and hold nothing about the recipient but
+// their country.
+type usageRecord struct {
+	ID           string    `json:"id"`
+	TenantID     string    `json:"tenant_id,omitempty"`
+	InvitationID string    `json:"invitation_id"`
+	BatchID      string    `json:"batch_id,omitempty"`
+	Channel      string    `json:"channel"`
+	Provider     string    `json:"provider"`
+	Country      string    `json:"country,omitempty"`
+	Segments     int       `json:"segments"`
+	CostMicros   int64     `json:"cost_micros"`
+	Host         bool      `json:"host,omitempty"`
+	At           time.Time `json:"at"`
+}
+
+// messageProvider names who carries messages on ch: the configured SMS or
+// voice provider, the platform of a push device, and otherwise the channel
+// itself, which has only the one.
+func (s *Server) messageProvider(ctx context.Context, inv Invitation, ch string) string {
+	switch ch {
+	case channelSMS:
+		return s.cfg.SMSProvider
+	case channelVoice:
+		return s.cfg.VoiceProvider
+	case channelPush:
+		if d, err := getRecord[device](ctx, s.store, deviceKind, inv.DeviceID); err == nil {
+			return d.Platform
+		}
+	}
+	return ch
+}
+
+// recordUsage notes the cost of m, just sent to inv.
+func (s *Server) recordUsage(ctx context.Context, inv Invitation, m outboundMessage) {
+	u := usageRecord{
+		ID: m.ID, TenantID: inv.TenantID, InvitationID: inv.ID, BatchID: inv.BatchID, Channel: m.Channel,
+		Provider: s.messageProvider(ctx, inv, m.Channel), Segments: 1, Host: m.To != "", At: s.now().UTC(),
+	}
+	switch m.Channel {
+	case channelSMS, channelVoice, channelWhatsApp:
+		u.Country = phoneCountry(inv.PhoneNumber)
+	}
+	if m.Channel == channelSMS {
+		u.Segments = estimateSMS(m.Body).Segments
+	}
+	u.CostMicros = costMicros(s.prices, u.Channel, u.Provider, u.Country, u.Segments)
+	if err := putRecord(ctx, s.store, usageKind, u.ID, u); err != nil {
+		slog.ErrorContext(ctx, "failed to record usage", "invitation_id", inv.ID, "message_id", m.ID, "err", err)
+	}
+}
+
+type usageTotals struct {
+	Messages   int     `json:"messages"`
+	Segments   int     `json:"segments"`
+	Cost       float64 `json:"cost"`
+	costMicros int64
+}
+
+func (t *usageTotals) add(u usageRecord) {
+	t.Messages++
+	t.Segments += u.Segments
+	t.costMicros += u.CostMicros
+	t.Cost = float64(t.costMicros) / 1e6
+}
+
+type usageReport struct {
+	From      time.Time               `json:"from"`
+	To        time.Time               `json:"to"`
+	Currency  string                  `json:"currency"`
+	Total     usageTotals             `json:"total"`
+	ByChannel map[string]*usageTotals `json:"by_channel"`
+	ByCountry map[string]*usageTotals `json:"by_country"`
+	ByBatch   map[string]*usageTotals `json:"by_batch"`
+	ByTenant  map[string]*usageTotals `json:"by_tenant,omitempty"`
+}
+
+// usage totals the messages of tenant sent in [from, to), and of every
+// tenant when all is set.
+func (s *Server) usage(ctx context.Context, tenant string, all bool, from, to time.Time) (usageReport, error) {
+	rep := usageReport{
+		From: from.UTC(), To: to.UTC(), Currency: s.cfg.Currency,
+		ByChannel: map[string]*usageTotals{}, ByCountry: map[string]*usageTotals{}, ByBatch: map[string]*usageTotals{},
+	}
+	if all {
+		rep.ByTenant = map[string]*usageTotals{}
+	}
+	records, err := listRecords[usageRecord](ctx, s.store, usageKind)
+	if err != nil {
+		return rep, err
+	}
+	bump := func(m map[string]*usageTotals, key string, u usageRecord) {
+		t, ok := m[key]
+		if !ok {
+			t = &usageTotals{}
+			m[key] = t
+		}
+		t.add(u)
+	}
+	for _, u := range records {
+		if !all && u.TenantID != tenant || u.At.Before(from) || !u.At.Before(to) {
+			continue
+		}
+		rep.Total.add(u)
+		bump(rep.ByChannel, u.Channel, u)
+		if u.Country != "" {
+			bump(rep.ByCountry, u.Country, u)
+		}
+		if u.BatchID != "" {
+			bump(rep.ByBatch, u.BatchID, u)
+		}
+		if all {
+			bump(rep.ByTenant, u.TenantID, u)
+		}
+	}
+	return rep, nil
+}
+
+// handleUsage reports the caller's tenant's usage for from and to, by
+// default the current month so far. Callers not scoped to a tenant see
+// every tenant.
+func (s *Server) handleUsage(w http.ResponseWriter, r *http.Request) {
+	t := s.now().UTC()
+	from, to, err := timeRange(r, monthStart(t), t)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	tenant, scoped := tenantFrom(r.Context())
+	rep, err := s.usage(r.Context(), tenant, !scoped, from, to)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, rep)
+}
+
+// timeRange reads the from and to query parameters, which default to from
+// and to.
+func timeRange(r *http.Request, from, to time.Time) (time.Time, time.Time, error) {
+	q := r.URL.Query()
+	for param, dst := range map[string]*time.Time{"from": &from, "to": &to} {
+		v := q.Get(param)
+		if v == "" {
+			continue
+		}
+		p, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return from, to, badRequest(param + " must be an RFC 3339 timestamp")
+		}
+		*dst = p
+	}
+	if !from.Before(to) {
+		return from, to, badRequest("from must be before to")
+	}
+	return from, to, nil
+}
+
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// budget caps the estimated cost of a tenant's messages per calendar
+// month, in UTC.
+type budget struct {
+	MonthlyLimit float64 `json:"monthly_limit"`
+}
+
+func (b *budget) validate() error {
+	if b.MonthlyLimit <= 0 {
+		return badRequest("budget.monthly_limit must be positive")
+	}
+	return nil
+}
+
+// checkBudget refuses new invitations once the caller's tenant has spent
+// its monthly budget, unless an owner sets override. Messages of
+// invitations already created still go out.
+func (s *Server) checkBudget(ctx context.Context, override bool) error {
+	id, _ := tenantFrom(ctx)
+	if id == "" {
+		return nil
+	}
+	t, err := getRecord[tenant](ctx, s.store, tenantKind, id)
+	if err == errNotFound || err == nil && t.Budget == nil {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	now := s.now()
+	rep, err := s.usage(ctx, id, false, monthStart(now), now.Add(time.Second))
+	if err != nil {
+		return err
+	}
+	if rep.Total.Cost < t.Budget.MonthlyLimit {
+		return nil
+	}
+	if override && roleAtLeast(roleFrom(ctx), roleOwner) {
+		slog.InfoContext(ctx, "creating invitation over budget", "tenant_id", id, "spent", rep.Total.Cost, "monthly_limit", t.Budget.MonthlyLimit)
+		return nil
+	}
+	return &requestError{
+		status: http.StatusPaymentRequired, code: codeBudgetExceeded,
+		msg:     "the monthly budget of " + strconv.FormatFloat(t.Budget.MonthlyLimit, 'f', -1, 64) + " " + s.cfg.Currency + " has been spent; an owner can set override_budget to send anyway",
+		details: map[string]any{"spent": rep.Total.Cost, "monthly_limit": t.Budget.MonthlyLimit},
+	}
+}
@@ -0,0 +1,231 @@
+package invitations
+
+import (
+	"context"
+	"net/http"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+)
+
+const userKind = "user"
+
+// Roles of a tenant's users, each allowed everything the one before it is.
+const (
+	roleViewer    = "viewer"    // reads invitations, events and usage
+	roleOrganizer = "organizer" // also sends and manages invitations, within the budget
+	roleOwner     = "owner"     // also manages users, keys, webhooks and privacy requests
+)
+
+var roles = []string{roleViewer, roleOrganizer, roleOwner}
+
+func roleAtLeast(have, want string) bool {
+	return slices.Index(roles, have) >= slices.Index(roles, want)
+}
+
+// user is a member of a tenant's team. Users act through API keys issued
+// to them, or dashboard sessions opened with those, and are allowed what
+// their role is at the time of each request.
+type user struct {
+	ID        string    `json:"id"`
+	TenantID  string    `json:"tenant_id,omitempty"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name,omitempty"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+type roleContextKey struct{}
+
+func withRole(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, roleContextKey{}, role)
+}
+
+// roleFrom returns the caller's role. Keys that belong to no user, the
+// admin, background work and servers that don't require API keys act as
+// owners.
+func roleFrom(ctx context.Context) string {
+	if r, ok := ctx.Value(roleContextKey{}).(string); ok {
+		return r
+	}
+	return roleOwner
+}
+
+// keyRole looks up the role k acts with: its user's, or owner for a key
+// that belongs to no user. A key whose user is gone reads as not found.
+func (s *Server) keyRole(ctx context.Context, k apiKey) (string, error) {
+	if k.role != "" {
+		return k.role, nil
+	}
+	if k.UserID == "" {
+		return roleOwner, nil
+	}
+	u, err := getRecord[user](withTenant(ctx, k.TenantID), s.store, userKind, k.UserID)
+	if err != nil {
+		return "", err
+	}
+	return u.Role, nil
+}
+
+// requireOwner limits a route to the tenant's owners, inside requireAPIKey.
+func (s *Server) requireOwner(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !roleAtLeast(roleFrom(r.Context()), roleOwner) {
+			writeError(w, r, http.StatusForbidden, "only owners can do this")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func validRole(role string) error {
+	if !slices.Contains(roles, role) {
+		return badRequest("role must be one of " + strings.Join(roles, ", "))
+	}
+	return nil
+}
+
+func (s *Server) handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+		Name  string `json:"name"`
+		Role  string `json:"role"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	addr, err := mail.ParseAddress(req.Email)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "email must be a valid email address")
+		return
+	}
+	if err := validRole(req.Role); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	users, err := listRecords[user](r.Context(), s.store, userKind)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if slices.ContainsFunc(users, func(u user) bool { return strings.EqualFold(u.Email, addr.Address) }) {
+		writeError(w, r, http.StatusConflict, "a user with that email already exists")
+		return
+	}
+	u := user{ID: randomHex(8), Email: addr.Address, Name: strings.TrimSpace(req.Name), Role: req.Role, CreatedAt: s.now().UTC()}
+	u.TenantID, _ = tenantFrom(r.Context())
+	if err := putRecord(r.Context(), s.store, userKind, u.ID, u); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, u)
+}
+
+func (s *Server) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := listRecords[user](r.Context(), s.store, userKind)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	slices.SortFunc(users, func(a, b user) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	writeJSON(w, http.StatusOK, users)
+}
+
+// handleUpdateUser renames a user or changes their role, which applies to
+// their keys and sessions from the next request.
+func (s *Server) handleUpdateUser(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name *string `json:"name"`
+		Role *string `json:"role"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	u, err := getRecord[user](r.Context(), s.store, userKind, r.PathValue("id"))
+	if err == errNotFound {
+		writeError(w, r, http.StatusNotFound, "user not found")
+		return
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if req.Name != nil {
+		u.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Role != nil && *req.Role != u.Role {
+		if err := validRole(*req.Role); err != nil {
+			writeResponseError(w, r, err)
+			return
+		}
+		if err := s.checkOtherOwner(r.Context(), u); err != nil {
+			writeResponseError(w, r, err)
+			return
+		}
+		u.Role = *req.Role
+	}
+	u.UpdatedAt = s.now().UTC()
+	if err := putRecord(r.Context(), s.store, userKind, u.ID, u); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, u)
+}
+
+// handleDeleteUser removes a user and revokes their keys.
+func (s *Server) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	u, err := getRecord[user](r.Context(), s.store, userKind, r.PathValue("id"))
+	if err == errNotFound {
+		writeError(w, r, http.StatusNotFound, "user not found")
+		return
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if err := s.checkOtherOwner(r.Context(), u); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	keys, err := listRecords[apiKey](r.Context(), s.store, apiKeyKind)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	for _, k := range keys {
+		if k.UserID != u.ID || k.TenantID != u.TenantID || !k.RevokedAt.IsZero() {
+			continue
+		}
+		k.RevokedAt = s.now().UTC()
+		if err := putRecord(r.Context(), s.store, apiKeyKind, k.ID, k); err != nil {
+			writeResponseError(w, r, err)
+			return
+		}
+	}
+	if err := s.store.DeleteRecord(r.Context(), userKind, u.ID); err != nil && err != errNotFound {
+		writeResponseError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkOtherOwner refuses to demote or remove u if it is the tenant's last
+// owner, leaving nobody to manage the team. Owner keys belonging to no user
+// don't count.
+func (s *Server) checkOtherOwner(ctx context.Context, u user) error {
+	if u.Role != roleOwner {
+		return nil
+	}
+	users, err := listRecords[user](ctx, s.store, userKind)
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(users, func(o user) bool { return o.ID != u.ID && o.Role == roleOwner }) {
+		return nil
+	}
+	return &requestError{status: http.StatusConflict, msg: "the tenant must keep at least one owner"}
+}
@@ -0,0 +1,206 @@
+package invitations
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+// newVoiceNotifier builds the voice channel's notifier for provider, or
+// returns nil when provider is empty and the channel is off. Calls made
+// while an invitation is open ask for a keypad answer, which Twilio posts
+// to /voice/gather under publicURL.
+func newVoiceNotifier(provider, publicURL string) (Notifier, error) {
+	switch provider {
+	case "":
+		return nil, nil
+	case "log":
+		return logVoiceNotifier{}, nil
+	case "twilio":
+		n := &twilioVoiceNotifier{
+			twilioSender: &twilioSender{
+				accountSID: os.Getenv("TWILIO_ACCOUNT_SID"),
+				authToken:  os.Getenv("TWILIO_AUTH_TOKEN"),
+				from:       os.Getenv("TWILIO_FROM_NUMBER"),
+				client:     &http.Client{Timeout: 10 * time.Second},
+			},
+			publicURL: publicURL,
+		}
+		if n.accountSID == "" || n.authToken == "" || n.from == "" {
+			return nil, errors.New("twilio requires TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN and TWILIO_FROM_NUMBER")
+		}
+		return n, nil
+	default:
+		return nil, fmt.Errorf("unknown voice provider %q", provider)
+	}
+}
+
+type logVoiceNotifier struct{}
+
+func (logVoiceNotifier) Notify(ctx context.Context, inv Invitation, message string) (string, error) {
+	id := "log-" + randomHex(8)
+	slog.InfoContext(ctx, "placing call", "invitation_id", inv.ID, "to", maskPhone(inv.PhoneNumber), "say", message, "call_id", id)
+	return id, nil
+}
+
+// twilioVoiceNotifier places calls through Twilio's Calls API with the
+// TwiML inline. It shares the SMS sender's credentials and health check.
+type twilioVoiceNotifier struct {
+	*twilioSender
+	publicURL string
+}
+
+func (n *twilioVoiceNotifier) Notify(ctx context.Context, inv Invitation, message string) (string, error) {
+	var twiml string
+	if inv.Response == "" && inv.Status == "" {
+		twiml = callTwiML(inv.Locale, message, inv.options(), gatherURL(n.publicURL, inv.ID))
+	} else {
+		twiml = callTwiML(inv.Locale, message, nil, "")
+	}
+	form := url.Values{"To": {inv.PhoneNumber}, "From": {n.from}, "Twiml": {twiml}}
+	endpoint := "https://api.twilio.com/2010-04-01/Accounts/" + n.accountSID + "/Calls.json"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.SetBasicAuth(n.accountSID, n.authToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return "", transientError{err}
+	}
+	defer resp.Body.Close()
+	if err := classifyHTTP("twilio", resp); err != nil {
+		return "", err
+	}
+	var call struct {
+		SID string `json:"sid"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&call)
+	return call.SID, nil
+}
+
+func gatherURL(base, id string) string {
+	return strings.TrimSuffix(base, "/") + "/voice/gather?invitation=" + url.QueryEscape(id)
+}
+
+// voiceText is the invitation as read out on a call: the message and
+// deadline, without the SMS reply hint or response link.
+func (s *Server) voiceText(inv Invitation) string {
+	return inv.Message + localize(inv.Locale, "voice_open_until", s.formatDeadline(inv, inv.ExpiresAt))
+}
+
+// callTwiML reads message in the language of locale and, given an action
+// URL, then asks for one of opts on the keypad, to be posted there.
+func callTwiML(locale, message string, opts []string, action string) string {
+	var b strings.Builder
+	b.WriteString(xml.Header + "<Response>")
+	if action == "" {
+		say(&b, locale, message)
+	} else {
+		fmt.Fprintf(&b, `<Gather numDigits="%d" timeout="10" method="POST" action="`, len(strconv.Itoa(len(opts))))
+		xml.EscapeText(&b, []byte(action))
+		b.WriteString(`">`)
+		say(&b, locale, message)
+		say(&b, locale, keypadPrompt(locale, opts))
+		b.WriteString("</Gather>")
+		say(&b, locale, localize(locale, "no_answer_goodbye"))
+	}
+	b.WriteString("</Response>")
+	return b.String()
+}
+
+// say reads text with Twilio's voice for locale, which takes a language
+// and region; English is left to the default voice.
+func say(b *strings.Builder, locale, text string) {
+	b.WriteString("<Say")
+	if lang := twilioLanguage(locale); lang != "" {
+		b.WriteString(` language="` + lang + `"`)
+	}
+	b.WriteString(">")
+	xml.EscapeText(b, []byte(text))
+	b.WriteString("</Say>")
+}
+
+// twilioLanguage is the <Say> language for locale, keeping its region when
+// it has one.
+func twilioLanguage(locale string) string {
+	base, _ := localeLanguage(locale).Base()
+	if base.String() == "en" {
+		return ""
+	}
+	if tag, err := language.Parse(locale); err == nil {
+		if region, conf := tag.Region(); conf == language.Exact {
+			return base.String() + "-" + region.String()
+		}
+	}
+	return map[string]string{"es": "es-ES", "fr": "fr-FR", "de": "de-DE", "pt": "pt-PT"}[base.String()]
+}
+
+func keypadPrompt(locale string, opts []string) string {
+	parts := make([]string, len(opts))
+	for i, o := range opts {
+		parts[i] = localize(locale, "press_for", i+1, responseLabel(locale, o))
+	}
+	return strings.Join(parts, " ")
+}
+
+func writeCallTwiML(w http.ResponseWriter, twiml string) {
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(twiml))
+}
+
+// handleVoiceGather accepts the keypad answer Twilio gathered on an
+// invitation call, records it like an SMS reply and reads back the outcome.
+func (s *Server) handleVoiceGather(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid form body")
+		return
+	}
+	if !s.verifyTwilio(w, r) {
+		return
+	}
+	inv, err := s.store.Get(r.Context(), r.URL.Query().Get("invitation"))
+	if err == errNotFound {
+		writeCallTwiML(w, callTwiML("", "We couldn't find this invitation. Goodbye.", nil, ""))
+		return
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	// On an outbound call, To is the invitee.
+	if to := r.PostForm.Get("To"); to != "" && s.lookupPhone(to) != inv.PhoneNumber {
+		writeError(w, r, http.StatusForbidden, "call was not placed to this invitation's phone number")
+		return
+	}
+
+	opts := inv.options()
+	n, err := strconv.Atoi(r.PostForm.Get("Digits"))
+	if err != nil || n < 1 || n > len(opts) {
+		writeCallTwiML(w, callTwiML(inv.Locale, localize(inv.Locale, "not_a_choice"), opts, gatherURL(s.cfg.PublicURL, inv.ID)))
+		return
+	}
+	locale := inv.Locale
+	var reply string
+	if inv, err = s.recordResponse(r.Context(), inv.ID, responseInput{Response: opts[n-1], Via: viaVoice}); err == nil {
+		reply = s.confirmationMessage(inv)
+	} else if reply, err = responseRefusal(locale, err); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeCallTwiML(w, callTwiML(locale, reply, nil, ""))
+}
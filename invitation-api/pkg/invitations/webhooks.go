@@ -0,0 +1,293 @@
+package invitations
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	eventCreated   = "invitation.created"
+	eventResponded = "invitation.responded"
+	eventExpired   = "invitation.expired"
+	eventCancelled = "invitation.cancelled"
+	eventUpdated   = "invitation.updated"
+
+	webhookKind = "webhook"
+)
+
+var webhookEvents = []string{eventCreated, eventResponded, eventExpired, eventCancelled, eventUpdated}
+
+var (
+	webhookClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+type webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Events    []string  `json:"events,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (h webhook) wants(event string) bool {
+	return len(h.Events) == 0 || slices.Contains(h.Events, event)
+}
+
+type webhookPayload struct {
+	ID        string     `json:"id"`
+	Type      string     `json:"type"`
+	CreatedAt time.Time  `json:"created_at"`
+	Data      Invitation `json:"data"`
+}
+
+// webhookData is inv as posted to webhooks and the bus, with its status as
+// of t and without the secrets of its response link and confirmation code,
+// which would let any receiver answer for the invitee.
+func webhookData(inv Invitation, t time.Time) Invitation {
+	inv = inv.withStatus(t)
+	inv.ResponseToken = ""
+	if p := inv.PendingResponse; p != nil {
+		held := *p
+		held.CodeHash = ""
+		inv.PendingResponse = &held
+	}
+	return inv
+}
+
+type delivery struct {
+	TenantID   string    `json:"-"`
+	WebhookID  string    `json:"webhook_id"`
+	URL        string    `json:"url"`
+	EventID    string    `json:"event_id"`
+	Event      string    `json:"event"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	At         time.Time `json:"at"`
+}
+
+// deliveryLog keeps the most recent delivery attempts for debugging.
+type deliveryLog struct {
+	mu      sync.Mutex
+	max     int
+	entries []delivery
+}
+
+func (l *deliveryLog) add(d delivery) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, d)
+	if len(l.entries) > l.max {
+		l.entries = l.entries[len(l.entries)-l.max:]
+	}
+}
+
+func (l *deliveryLog) list(ctx context.Context, webhookID string) []delivery {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	tenantID, scoped := tenantFrom(ctx)
+	result := []delivery{}
+	for i := len(l.entries) - 1; i >= 0; i-- {
+		if scoped && l.entries[i].TenantID != tenantID {
+			continue
+		}
+		if webhookID == "" || l.entries[i].WebhookID == webhookID {
+			result = append(result, l.entries[i])
+		}
+	}
+	return result
+}
+
+func (s *Server) configuredWebhooks() []webhook {
+	hooks := []webhook{}
+	for i, u := range s.cfg.WebhookURLs {
+		hooks = append(hooks, webhook{ID: "config-" + strconv.Itoa(i+1), URL: u, Secret: s.cfg.WebhookSecret})
+	}
+	return hooks
+}
+
+// sendWebhooks delivers event to every interested webhook of inv's tenant,
+// and to the operator's configured webhooks, in the background.
+func (s *Server) sendWebhooks(ctx context.Context, event string, inv Invitation) {
+	ctx = withTenant(ctx, inv.TenantID)
+	hooks, err := listRecords[webhook](ctx, s.store, webhookKind)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to load webhooks", "event", event, "err", err)
+	}
+	hooks = append(s.configuredWebhooks(), hooks...)
+
+	payload := webhookPayload{ID: randomHex(16), Type: event, CreatedAt: s.now().UTC(), Data: webhookData(inv, s.now())}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to encode webhook payload", "event", event, "err", err)
+		return
+	}
+	// Deliveries outlive the request that triggered them.
+	ctx = context.WithoutCancel(ctx)
+	for _, h := range hooks {
+		if !h.wants(event) {
+			continue
+		}
+		s.webhookWG.Add(1)
+		go func(h webhook) {
+			defer s.webhookWG.Done()
+			s.deliverWebhook(ctx, h, payload, body)
+		}(h)
+	}
+}
+
+const (
+	webhookAttempts = 5
+	deliveryLogSize = 200
+)
+
+func (s *Server) deliverWebhook(ctx context.Context, h webhook, payload webhookPayload, body []byte) {
+	backoff := time.Second
+	for attempt := 1; attempt <= webhookAttempts; attempt++ {
+		d := delivery{TenantID: payload.Data.TenantID, WebhookID: h.ID, URL: h.URL, EventID: payload.ID, Event: payload.Type, Attempt: attempt, At: s.now().UTC()}
+		status, err := s.postWebhook(ctx, h, body)
+		d.StatusCode = status
+		if err != nil {
+			d.Error = err.Error()
+		}
+		s.deliveries.add(d)
+		if err == nil {
+			return
+		}
+		if attempt == webhookAttempts {
+			slog.ErrorContext(ctx, "giving up on webhook delivery", "event", payload.Type, "event_id", payload.ID,
+				"invitation_id", payload.Data.ID, "url", h.URL, "err", err)
+			return
+		}
+		ticks, stop := s.clock.NewTicker(backoff)
+		select {
+		case <-ticks:
+		case <-ctx.Done():
+			stop()
+			return
+		}
+		stop()
+		backoff *= 2
+	}
+}
+
+// postWebhook signs body as HMAC-SHA256 over "<timestamp>.<body>" so
+// receivers can verify both authenticity and freshness.
+func (s *Server) postWebhook(ctx context.Context, h webhook, body []byte) (status int, err error) {
+	ctx, span := tracer.Start(ctx, "webhook.deliver", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("webhook.id", h.ID)))
+	defer func() { endSpan(span, err) }()
+
+	ts := strconv.FormatInt(s.now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Timestamp", ts)
+	if id := requestIDFrom(ctx); id != "" {
+		req.Header.Set("X-Request-ID", id)
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	if h.Secret != "" {
+		req.Header.Set("X-Webhook-Signature", "sha256="+signWebhook(h.Secret, ts, body))
+	}
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+func signWebhook(secret, ts string, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(ts + "."))
+	m.Write(body)
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+func (s *Server) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		URL    string   `json:"url"`
+		Secret string   `json:"secret"`
+		Events []string `json:"events"`
+	}
+	if err := decodeJSON(r, &req); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		writeError(w, r, http.StatusBadRequest, "url must be an absolute http(s) URL")
+		return
+	}
+	for _, ev := range req.Events {
+		if !slices.Contains(webhookEvents, ev) {
+			writeError(w, r, http.StatusBadRequest, "unknown event "+strconv.Quote(ev))
+			return
+		}
+	}
+
+	h := webhook{ID: randomHex(8), URL: req.URL, Secret: req.Secret, Events: req.Events, CreatedAt: s.now().UTC()}
+	if h.Secret == "" {
+		h.Secret = randomHex(32)
+	}
+	if err := putRecord(r.Context(), s.store, webhookKind, h.ID, h); err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, h)
+}
+
+func (s *Server) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	hooks, err := listRecords[webhook](r.Context(), s.store, webhookKind)
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	if t, scoped := tenantFrom(r.Context()); !scoped || t == "" {
+		hooks = append(s.configuredWebhooks(), hooks...)
+	}
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+	writeJSON(w, http.StatusOK, hooks)
+}
+
+func (s *Server) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	err := s.store.DeleteRecord(r.Context(), webhookKind, r.PathValue("id"))
+	if err == errNotFound {
+		writeError(w, r, http.StatusNotFound, "webhook not found")
+		return
+	}
+	if err != nil {
+		writeResponseError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleListDeliveries(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.deliveries.list(r.Context(), r.URL.Query().Get("webhook_id")))
+}
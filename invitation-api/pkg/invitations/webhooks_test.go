@@ -0,0 +1,134 @@
+package invitations
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failingHook stands up a webhook receiver that answers 500 and reports each
+// attempt on the returned channel.
+func failingHook(t *testing.T) (webhook, <-chan struct{}) {
+	t.Helper()
+	hits := make(chan struct{}, webhookAttempts)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits <- struct{}{}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(srv.Close)
+	return webhook{ID: "wh-1", URL: srv.URL}, hits
+}
+
+func waitHit(t *testing.T, hits <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-hits:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no delivery attempt")
+	}
+}
+
+func TestWebhookRetriesOnServerClock(t *testing.T) {
+	ts := newTestServer(t)
+	h, hits := failingHook(t)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ts.deliverWebhook(context.Background(), h, webhookPayload{ID: "evt-1", Type: eventCreated}, []byte(`{}`))
+	}()
+
+	waitHit(t, hits)
+	select {
+	case <-hits:
+		t.Fatal("retried before the clock moved")
+	case <-time.After(50 * time.Millisecond):
+	}
+	// Step the clock until the backoff has passed, however far the retry
+	// loop has got to waiting on it.
+	for attempt := 2; attempt <= webhookAttempts; attempt++ {
+		for retried := false; !retried; {
+			ts.clock.Advance(time.Second)
+			select {
+			case <-hits:
+				retried = true
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("still delivering after the last attempt")
+	}
+	if n := len(ts.deliveries.list(context.Background(), h.ID)); n != webhookAttempts {
+		t.Errorf("logged %d attempts, want %d", n, webhookAttempts)
+	}
+}
+
+func TestWebhookBackoffStopsWithContext(t *testing.T) {
+	ts := newTestServer(t)
+	h, hits := failingHook(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ts.deliverWebhook(ctx, h, webhookPayload{ID: "evt-1", Type: eventCreated}, []byte(`{}`))
+	}()
+
+	waitHit(t, hits)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("backoff kept waiting after the context was done")
+	}
+	if len(hits) != 0 {
+		t.Errorf("retried after the context was done")
+	}
+}
+
+func TestWebhookPayloadHasNoSecrets(t *testing.T) {
+	ts := newTestServer(t)
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	t.Cleanup(srv.Close)
+	if w := ts.do("POST", "/webhooks", map[string]any{"url": srv.URL, "events": []string{eventCreated}}); w.Code != http.StatusCreated {
+		t.Fatalf("register webhook: got %d: %s", w.Code, w.Body)
+	}
+
+	inv := ts.create(invite("+14155550101"))
+	var body []byte
+	select {
+	case body = <-bodies:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook posted")
+	}
+	var posted struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.Unmarshal(body, &posted); err != nil {
+		t.Fatal(err)
+	}
+	if posted.Data["id"] != inv.ID {
+		t.Fatalf("posted %s, want invitation %s", body, inv.ID)
+	}
+	if _, ok := posted.Data["response_token"]; ok || strings.Contains(string(body), inv.ResponseToken) {
+		t.Errorf("payload carries the response token: %s", body)
+	}
+
+	inv.PendingResponse = &PendingResponse{Response: "yes", CodeHash: "digest"}
+	if got := webhookData(inv, ts.now()); got.PendingResponse.CodeHash != "" {
+		t.Errorf("webhook data carries the confirmation code hash")
+	}
+	if inv.PendingResponse.CodeHash != "digest" {
+		t.Errorf("webhookData cleared the caller's code hash")
+	}
+}
@@ -0,0 +1,265 @@
+package invitations
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const whatsappAPI = "https://graph.facebook.com/v21.0/"
+
+// chatReplier is implemented by notifiers for chat channels whose inbound
+// webhooks can't answer in the response, so replies go out as messages.
+type chatReplier interface {
+	Reply(ctx context.Context, inv Invitation, text string) error
+}
+
+// newWhatsAppNotifier sends through the WhatsApp Business Cloud API when
+// WHATSAPP_TOKEN is set and otherwise only logs. Messages a business starts
+// need an approved template, so when WHATSAPP_TEMPLATE is set notifications
+// go out as that template with the text as its one body parameter; replies
+// to the invitee's own messages are always plain text.
+func newWhatsAppNotifier() (Notifier, error) {
+	token := os.Getenv("WHATSAPP_TOKEN")
+	if token == "" {
+		return logChatNotifier{channelWhatsApp}, nil
+	}
+	n := &whatsappNotifier{
+		token:    token,
+		phoneID:  os.Getenv("WHATSAPP_PHONE_NUMBER_ID"),
+		template: os.Getenv("WHATSAPP_TEMPLATE"),
+		language: envOr("WHATSAPP_TEMPLATE_LANGUAGE", "en"),
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+	if n.phoneID == "" {
+		return nil, errors.New("WHATSAPP_PHONE_NUMBER_ID is required when WHATSAPP_TOKEN is set")
+	}
+	return n, nil
+}
+
+// logChatNotifier stands in for an unconfigured chat channel.
+type logChatNotifier struct{ channel string }
+
+func (n logChatNotifier) Notify(ctx context.Context, inv Invitation, message string) (string, error) {
+	id := "log-" + randomHex(8)
+	slog.InfoContext(ctx, "sending "+n.channel+" message", "invitation_id", inv.ID, "body", message, "message_id", id)
+	return id, nil
+}
+
+func (n logChatNotifier) Reply(ctx context.Context, inv Invitation, text string) error {
+	_, err := n.Notify(ctx, inv, text)
+	return err
+}
+
+type whatsappNotifier struct {
+	token, phoneID     string
+	template, language string
+	client             *http.Client
+}
+
+func (n *whatsappNotifier) Notify(ctx context.Context, inv Invitation, message string) (string, error) {
+	msg := map[string]any{"type": "text", "text": map[string]string{"body": message}}
+	if n.template != "" {
+		msg = map[string]any{"type": "template", "template": map[string]any{
+			"name":     n.template,
+			"language": map[string]string{"code": n.language},
+			"components": []any{map[string]any{
+				"type":       "body",
+				"parameters": []any{map[string]string{"type": "text", "text": message}},
+			}},
+		}}
+	}
+	return n.send(ctx, inv.PhoneNumber, msg)
+}
+
+func (n *whatsappNotifier) Reply(ctx context.Context, inv Invitation, text string) error {
+	_, err := n.send(ctx, inv.PhoneNumber, map[string]any{"type": "text", "text": map[string]string{"body": text}})
+	return err
+}
+
+func (n *whatsappNotifier) send(ctx context.Context, to string, msg map[string]any) (string, error) {
+	msg["messaging_product"] = "whatsapp"
+	msg["to"] = strings.TrimPrefix(to, "+")
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, whatsappAPI+n.phoneID+"/messages", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+n.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return "", transientError{err}
+	}
+	defer resp.Body.Close()
+	if err := classifyHTTP("whatsapp", resp); err != nil {
+		return "", err
+	}
+	var sent struct {
+		Messages []struct {
+			ID string `json:"id"`
+		} `json:"messages"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&sent)
+	if len(sent.Messages) == 0 {
+		return "", nil
+	}
+	return sent.Messages[0].ID, nil
+}
+
+// Check fetches the sending phone number, which confirms both reachability
+// and the token.
+func (n *whatsappNotifier) Check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, whatsappAPI+n.phoneID, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+n.token)
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return classifyHTTP("whatsapp", resp)
+}
+
+// whatsappStatuses maps the Cloud API's message statuses onto ours.
+var whatsappStatuses = map[string]string{
+	"sent":      deliverySent,
+	"delivered": deliveryDelivered,
+	"read":      deliveryDelivered,
+	"failed":    deliveryFailed,
+}
+
+// whatsappUpdate is the part of a WhatsApp webhook notification we use.
+type whatsappUpdate struct {
+	Entry []struct {
+		Changes []struct {
+			Value struct {
+				Messages []struct {
+					From string `json:"from"`
+					Type string `json:"type"`
+					Text struct {
+						Body string `json:"body"`
+					} `json:"text"`
+					// Quick-reply buttons on template messages.
+					Button struct {
+						Text string `json:"text"`
+					} `json:"button"`
+					Interactive struct {
+						ButtonReply struct {
+							Title string `json:"title"`
+						} `json:"button_reply"`
+					} `json:"interactive"`
+				} `json:"messages"`
+				Statuses []struct {
+					ID     string `json:"id"`
+					Status string `json:"status"`
+					Errors []struct {
+						Code  int    `json:"code"`
+						Title string `json:"title"`
+					} `json:"errors"`
+				} `json:"statuses"`
+			} `json:"value"`
+		} `json:"changes"`
+	} `json:"entry"`
+}
+
+// handleWhatsAppVerify answers the subscription handshake Meta makes when
+// the webhook is configured, echoing the challenge if the verify token
+// matches WHATSAPP_VERIFY_TOKEN.
+func (s *Server) handleWhatsAppVerify(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	token := os.Getenv("WHATSAPP_VERIFY_TOKEN")
+	if q.Get("hub.mode") != "subscribe" || token == "" || !hmac.Equal([]byte(q.Get("hub.verify_token")), []byte(token)) {
+		writeError(w, r, http.StatusForbidden, "invalid verify token")
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	io.WriteString(w, q.Get("hub.challenge"))
+}
+
+// handleWhatsAppWebhook accepts inbound WhatsApp messages, which are
+// answered like SMS replies, and delivery statuses for ours.
+func (s *Server) handleWhatsAppWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid body")
+		return
+	}
+	valid := func(secret string) bool { return validHubSignature(body, r.Header.Get("X-Hub-Signature-256"), secret) }
+	if !s.verifyWebhook(w, r, "WHATSAPP_APP_SECRET", valid, "invalid signature") {
+		return
+	}
+	var update whatsappUpdate
+	if err := json.Unmarshal(body, &update); err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	replier, _ := s.notifiers[channelWhatsApp].(chatReplier)
+	for _, entry := range update.Entry {
+		for _, change := range entry.Changes {
+			for _, st := range change.Value.Statuses {
+				status, ok := whatsappStatuses[st.Status]
+				if !ok {
+					continue
+				}
+				var reason string
+				if status == deliveryFailed && len(st.Errors) > 0 {
+					reason = "provider reported " + st.Errors[0].Title
+				}
+				if err := s.advanceDelivery(r.Context(), st.ID, status, reason); err != nil {
+					writeResponseError(w, r, err)
+					return
+				}
+			}
+			for _, m := range change.Value.Messages {
+				text := m.Text.Body
+				switch m.Type {
+				case "button":
+					text = m.Button.Text
+				case "interactive":
+					text = m.Interactive.ButtonReply.Title
+				}
+				phone := s.lookupPhone("+" + m.From)
+				reply, err := s.replyFromPhone(r.Context(), phone, text, viaWhatsApp)
+				if err != nil {
+					writeResponseError(w, r, err)
+					return
+				}
+				if replier != nil {
+					if err := replier.Reply(r.Context(), Invitation{PhoneNumber: phone}, reply); err != nil {
+						slog.ErrorContext(r.Context(), "failed to reply on whatsapp", "to", maskPhone(phone), "err", err)
+					}
+				}
+			}
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// validHubSignature checks an X-Hub-Signature-256 header: "sha256=" and the
+// hex HMAC-SHA256 of the body under the app secret.
+func validHubSignature(body []byte, header, secret string) bool {
+	got, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write(body)
+	return hmac.Equal([]byte(hex.EncodeToString(m.Sum(nil))), []byte(got))
+}
@@ -0,0 +1,75 @@
+// Package testutil helps drive the server deterministically in tests.
+package testutil
+
+import (
+	"sync"
+	"time"
+)
+
+// FakeClock only moves when told to. It satisfies the server's Clock, so
+// time-based behaviour such as expiry, reminders and quiet hours can be
+// stepped through: tickers fire as Advance moves past their deadlines, and,
+// like time.Ticker, drop ticks nobody is ready to receive.
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+type fakeTicker struct {
+	c       chan time.Time
+	every   time.Duration
+	next    time.Time
+	stopped bool
+}
+
+// NewFakeClock returns a FakeClock reading t.
+func NewFakeClock(t time.Time) *FakeClock { return &FakeClock{now: t} }
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) NewTicker(d time.Duration) (<-chan time.Time, func()) {
+	if d <= 0 {
+		panic("testutil: non-positive interval for NewTicker")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTicker{c: make(chan time.Time, 1), every: d, next: c.now.Add(d)}
+	c.tickers = append(c.tickers, t)
+	return t.c, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		t.stopped = true
+	}
+}
+
+// Advance moves the clock forward by d, firing tickers due on the way.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	live := c.tickers[:0]
+	for _, t := range c.tickers {
+		if t.stopped {
+			continue
+		}
+		for !t.next.After(c.now) {
+			select {
+			case t.c <- t.next:
+			default:
+			}
+			t.next = t.next.Add(t.every)
+		}
+		live = append(live, t)
+	}
+	c.tickers = live
+}
+
+// Set moves the clock to t, which must not be before the current time.
+func (c *FakeClock) Set(t time.Time) {
+	c.Advance(t.Sub(c.Now()))
+}